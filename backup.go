@@ -0,0 +1,536 @@
+package wal
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrIncompleteBackup is returned when restoring a backup that has no manifest, because it was interrupted.
+var ErrIncompleteBackup = errors.New("backup is incomplete")
+
+// backupManifestFileName is the file describing a backup. It is written last, so a backup without it is
+// incomplete.
+const backupManifestFileName = "backup-manifest.json"
+
+// BackupManifest describes a backup taken by Backup or BackupTo.
+type BackupManifest struct {
+	// Time is when the backup was taken.
+	Time time.Time `json:"time"`
+	// LastSequenceNumber is the sequence number of the last entry in the backup.
+	LastSequenceNumber uint64 `json:"last_sequence_number"`
+	// Files are the paths of the files of the backup, relative to the WAL directory and slash separated:
+	// the segments, the checkpoint and consumer offsets side-files, and the blobs and value log files.
+	Files []string `json:"files"`
+}
+
+// backupWriter stores the files of a backup.
+type backupWriter interface {
+	// link adds the file at path, which is never modified anymore, to the backup as name without copying
+	// it, and reports whether it could. It is called while holding wal.lock.
+	link(path, name string) bool
+	// add adds size bytes read from r to the backup as name.
+	add(name string, r io.Reader, size int64) error
+	// finish adds the manifest, which completes the backup.
+	finish(manifest BackupManifest) error
+}
+
+// backupSource is a file to copy into a backup: size bytes of file, or data if file is nil.
+type backupSource struct {
+	name string
+	file File
+	size int64
+	data []byte
+}
+
+// Backup takes a consistent copy of the WAL into directory, which must be empty or not exist, without
+// stopping the writers: the backup holds the entries flushed when it starts, and the side-files as of then.
+// The sealed segments are hard-linked into directory when the FS implements LinkFS and the WAL doesn't
+// recycle segments, and copied otherwise; the current segment is copied up to the end of its flushed
+// entries. The files of the blobs directory and of the value log are included too. Segments aren't
+// recycled while a backup is in progress. The manifest is written last, see RestoreBackup.
+func (wal *WAL) Backup(ctx context.Context, directory string) (BackupManifest, error) {
+	if err := wal.fs.MkdirAll(directory, 0755); err != nil {
+		return BackupManifest{}, err
+	}
+	if files, err := wal.fs.Glob(filepath.Join(directory, "*")); err != nil {
+		return BackupManifest{}, err
+	} else if len(files) > 0 {
+		return BackupManifest{}, fmt.Errorf("cannot back up to %s: it isn't empty", directory)
+	}
+	return wal.backup(ctx, directory, &dirBackup{fs: wal.fs, directory: directory, canLink: !wal.recycleSegments})
+}
+
+// BackupTo is Backup, writing the backup to w as a tar archive, with the manifest last, see
+// RestoreBackupFrom.
+func (wal *WAL) BackupTo(ctx context.Context, w io.Writer) (BackupManifest, error) {
+	return wal.backup(ctx, "", &tarBackup{w: tar.NewWriter(w)})
+}
+
+func (wal *WAL) backup(ctx context.Context, destination string, w backupWriter) (manifest BackupManifest, err error) {
+	defer func() {
+		wal.recordAdmin(AdminOpBackup, destination,
+			fmt.Sprintf("%d files, up to lsn %d", len(manifest.Files), manifest.LastSequenceNumber), err)
+	}()
+
+	sources, manifest, err := wal.prepareBackup(w)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer func() {
+		closeBackupSources(sources)
+		wal.lock.Lock()
+		wal.backups--
+		wal.lock.Unlock()
+	}()
+
+	for _, source := range sources {
+		if err := ctx.Err(); err != nil {
+			return BackupManifest{}, err
+		}
+		var r io.Reader = bytes.NewReader(source.data)
+		if source.file != nil {
+			r = source.file
+		}
+		if err := w.add(source.name, r, source.size); err != nil {
+			return BackupManifest{}, fmt.Errorf("could not back up %s: %w", source.name, err)
+		}
+	}
+	if err := w.finish(manifest); err != nil {
+		return BackupManifest{}, err
+	}
+	return manifest, nil
+}
+
+// prepareBackup flushes the buffered entries, then links the files of the WAL that can be linked into
+// the backup and opens the others, or reads them if they are small side-files, while holding wal.lock,
+// so that their content is the one of the backup even if they are deleted or rewritten afterwards.
+func (wal *WAL) prepareBackup(w backupWriter) (sources []*backupSource, manifest BackupManifest, err error) {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	defer func() {
+		if err != nil {
+			closeBackupSources(sources)
+		}
+	}()
+
+	if err := wal.flush(); err != nil {
+		return nil, BackupManifest{}, err
+	}
+	manifest = BackupManifest{Time: wal.clock.Now(), LastSequenceNumber: wal.lastSequenceNo}
+	include := func(path, name string, immutable bool, size int64) error {
+		manifest.Files = append(manifest.Files, name)
+		if immutable && w.link(path, name) {
+			return nil
+		}
+		file, err := wal.fs.OpenFile(path, os.O_RDONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if size < 0 {
+			info, err := file.Stat()
+			if err != nil {
+				file.Close()
+				return err
+			}
+			size = info.Size()
+		}
+		sources = append(sources, &backupSource{name: name, file: file, size: size})
+		return nil
+	}
+
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return sources, BackupManifest{}, err
+	}
+	current := wal.currentSegment.Name()
+	for _, segment := range segments {
+		size := int64(-1)
+		if segment.path == current {
+			// The current segment is copied up to the end of the entries flushed, as appended later.
+			info, err := wal.currentSegment.Stat()
+			if err != nil {
+				return sources, BackupManifest{}, err
+			}
+			size = info.Size()
+		}
+		if err := include(segment.path, filepath.Base(segment.path), segment.path != current, size); err != nil {
+			return sources, BackupManifest{}, err
+		}
+	}
+
+	for _, name := range []string{checkpointFileName, consumerOffsetsFileName} {
+		data, err := readSideFile(wal.fs, filepath.Join(wal.directory, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return sources, BackupManifest{}, err
+		}
+		manifest.Files = append(manifest.Files, name)
+		sources = append(sources, &backupSource{name: name, size: int64(len(data)), data: data})
+	}
+
+	// Blobs are never modified once stored.
+	blobs, err := wal.fs.Glob(filepath.Join(wal.directory, blobDirName, "*"))
+	if err != nil {
+		return sources, BackupManifest{}, err
+	}
+	for _, blob := range blobs {
+		if strings.HasSuffix(blob, ".tmp") {
+			continue
+		}
+		if err := include(blob, path.Join(blobDirName, filepath.Base(blob)), true, -1); err != nil {
+			return sources, BackupManifest{}, err
+		}
+	}
+
+	// The values are appended to the newest file of the value log, while holding its lock. The older files
+	// aren't modified anymore.
+	if wal.valueLog != nil {
+		wal.valueLog.lock.Lock()
+		defer wal.valueLog.lock.Unlock()
+	}
+	values, err := listSegmentFiles(wal.fs, filepath.Join(wal.directory, valueLogDirName))
+	if err != nil {
+		return sources, BackupManifest{}, err
+	}
+	for i, value := range values {
+		name := path.Join(valueLogDirName, filepath.Base(value.path))
+		if err := include(value.path, name, i < len(values)-1, -1); err != nil {
+			return sources, BackupManifest{}, err
+		}
+	}
+
+	wal.backups++
+	return sources, manifest, nil
+}
+
+func closeBackupSources(sources []*backupSource) {
+	for _, source := range sources {
+		if source.file != nil {
+			source.file.Close()
+		}
+	}
+}
+
+// readSideFile returns the content of the side-file at path.
+func readSideFile(fs FS, path string) ([]byte, error) {
+	file, err := fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// dirBackup stores a backup in a directory.
+type dirBackup struct {
+	fs        FS
+	directory string
+	canLink   bool
+}
+
+func (b *dirBackup) link(path, name string) bool {
+	linker, ok := b.fs.(LinkFS)
+	if !ok || !b.canLink {
+		return false
+	}
+	target := filepath.Join(b.directory, filepath.FromSlash(name))
+	if err := b.fs.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return false
+	}
+	// Links fail across filesystems, the file is copied then.
+	return linker.Link(path, target) == nil
+}
+
+func (b *dirBackup) add(name string, r io.Reader, size int64) error {
+	return writeBackupFile(b.fs, filepath.Join(b.directory, filepath.FromSlash(name)), r, size)
+}
+
+func (b *dirBackup) finish(manifest BackupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	filePath := filepath.Join(b.directory, backupManifestFileName)
+	tempFilePath := fmt.Sprintf("%s.tmp", filePath)
+	if err := writeBackupFile(b.fs, tempFilePath, bytes.NewReader(data), int64(len(data))); err != nil {
+		return err
+	}
+	return b.fs.Rename(tempFilePath, filePath)
+}
+
+// writeBackupFile writes size bytes read from r, or all of them if size is negative, to a new file at
+// path, and syncs it.
+func writeBackupFile(fs FS, path string, r io.Reader, size int64) error {
+	if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := fs.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		_, err = io.Copy(file, r)
+	} else {
+		_, err = io.CopyN(file, r, size)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// tarBackup writes a backup as a tar archive.
+type tarBackup struct {
+	w *tar.Writer
+}
+
+func (b *tarBackup) link(path, name string) bool {
+	return false
+}
+
+func (b *tarBackup) add(name string, r io.Reader, size int64) error {
+	if err := b.w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := io.CopyN(b.w, r, size)
+	return err
+}
+
+func (b *tarBackup) finish(manifest BackupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := b.add(backupManifestFileName, bytes.NewReader(data), int64(len(data))); err != nil {
+		return err
+	}
+	return b.w.Close()
+}
+
+// RestoreBackup copies the backup taken by Backup in backupDirectory to directory, which must not hold a
+// WAL already, and returns its manifest. It returns ErrIncompleteBackup if the backup has no manifest.
+// The files are copied rather than linked, so that the restored WAL can be written to without modifying
+// the backup. Like Restore, a failed restore leaves nothing in directory. The option used is WithFS.
+func RestoreBackup(ctx context.Context, backupDirectory, directory string, opts ...Option) (BackupManifest, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	manifest, err := readBackupManifest(o.fs, backupDirectory)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	if err := checkRestoreDirectory(o.fs, directory); err != nil {
+		return BackupManifest{}, err
+	}
+
+	err = stageRestore(o.fs, directory, func(staging string) error {
+		for _, name := range manifest.Files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !filepath.IsLocal(filepath.FromSlash(name)) {
+				return fmt.Errorf("invalid file name %q in backup manifest", name)
+			}
+			if err := copyBackupFile(o.fs, filepath.Join(backupDirectory, filepath.FromSlash(name)),
+				filepath.Join(staging, filepath.FromSlash(name))); err != nil {
+				return fmt.Errorf("could not restore %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	return manifest, nil
+}
+
+// RestoreBackupFrom is RestoreBackup, reading the tar archive written by BackupTo from r. It returns
+// ErrIncompleteBackup if the archive ends before the manifest, or misses files listed in it.
+func RestoreBackupFrom(ctx context.Context, r io.Reader, directory string, opts ...Option) (BackupManifest, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := checkRestoreDirectory(o.fs, directory); err != nil {
+		return BackupManifest{}, err
+	}
+
+	var manifest BackupManifest
+	err := stageRestore(o.fs, directory, func(staging string) (err error) {
+		manifest, err = extractBackup(ctx, o.fs, r, staging)
+		return err
+	})
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	return manifest, nil
+}
+
+// extractBackup writes the files of the tar archive written by BackupTo read from r to directory, and
+// returns its manifest.
+func extractBackup(ctx context.Context, fs FS, r io.Reader, directory string) (BackupManifest, error) {
+	restored := make(map[string]bool)
+	reader := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return BackupManifest{}, err
+		}
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return BackupManifest{}, fmt.Errorf("%w: the archive has no manifest", ErrIncompleteBackup)
+		}
+		if err != nil {
+			return BackupManifest{}, err
+		}
+		if !filepath.IsLocal(filepath.FromSlash(header.Name)) || header.Typeflag != tar.TypeReg {
+			return BackupManifest{}, fmt.Errorf("invalid file %q in backup archive", header.Name)
+		}
+
+		if header.Name == backupManifestFileName {
+			var manifest BackupManifest
+			if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+				return BackupManifest{}, fmt.Errorf("could not read backup manifest: %w", err)
+			}
+			for _, name := range manifest.Files {
+				if !restored[name] {
+					return BackupManifest{}, fmt.Errorf("%w: the archive misses %s", ErrIncompleteBackup, name)
+				}
+			}
+			return manifest, nil
+		}
+		err = writeBackupFile(fs, filepath.Join(directory, filepath.FromSlash(header.Name)), reader, header.Size)
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return BackupManifest{}, fmt.Errorf("%w: the archive ends within %s", ErrIncompleteBackup, header.Name)
+		}
+		if err != nil {
+			return BackupManifest{}, fmt.Errorf("could not restore %s: %w", header.Name, err)
+		}
+		restored[header.Name] = true
+	}
+}
+
+// checkRestoreDirectory creates directory, and checks that it doesn't hold a WAL already.
+func checkRestoreDirectory(fs FS, directory string) error {
+	if err := fs.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+	if existing, err := listSegmentFiles(fs, directory); err != nil {
+		return err
+	} else if len(existing) > 0 {
+		return fmt.Errorf("cannot restore to %s: it already holds a wal", directory)
+	}
+	return nil
+}
+
+// copyBackupFile copies the file at source to a new file at target.
+func copyBackupFile(fs FS, source, target string) error {
+	file, err := fs.OpenFile(source, os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return writeBackupFile(fs, target, file, info.Size())
+}
+
+// BackupArchive reads a backup taken by Backup as an Archive, so that Restore reconstructs the WAL it
+// holds as of a point in time or sequence number before the end of the backup, e.g. to roll back to the
+// state before a bad deployment. It implements DataArchive, so the blobs and value log files of the backup
+// are restored too.
+type BackupArchive struct {
+	fs        FS
+	directory string
+	manifest  BackupManifest
+}
+
+// OpenBackup opens the backup in directory, and returns ErrIncompleteBackup if it has no manifest.
+// The option used is WithFS.
+func OpenBackup(directory string, opts ...Option) (*BackupArchive, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	manifest, err := readBackupManifest(o.fs, directory)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupArchive{fs: o.fs, directory: directory, manifest: manifest}, nil
+}
+
+// Manifest returns the manifest of the backup.
+func (a *BackupArchive) Manifest() BackupManifest {
+	return a.manifest
+}
+
+// ListSegments implements Archive.
+func (a *BackupArchive) ListSegments(ctx context.Context) ([]ArchivedSegment, error) {
+	var segments []ArchivedSegment
+	for _, name := range a.manifest.Files {
+		if strings.HasPrefix(name, segmentPrefix) {
+			segments = append(segments, ArchivedSegment{Name: name})
+		}
+	}
+	return segments, nil
+}
+
+// OpenSegment implements Archive.
+func (a *BackupArchive) OpenSegment(ctx context.Context, segment ArchivedSegment) (io.ReadCloser, error) {
+	return a.OpenDataFile(ctx, segment.Name)
+}
+
+// ListDataFiles implements DataArchive.
+func (a *BackupArchive) ListDataFiles(ctx context.Context) ([]string, error) {
+	var names []string
+	for _, name := range a.manifest.Files {
+		if strings.HasPrefix(name, blobDirName+"/") || strings.HasPrefix(name, valueLogDirName+"/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// OpenDataFile implements DataArchive.
+func (a *BackupArchive) OpenDataFile(ctx context.Context, name string) (io.ReadCloser, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return nil, fmt.Errorf("invalid file name %q in backup manifest", name)
+	}
+	return a.fs.OpenFile(filepath.Join(a.directory, filepath.FromSlash(name)), os.O_RDONLY, 0644)
+}
+
+// readBackupManifest reads the manifest of the backup in directory.
+func readBackupManifest(fs FS, directory string) (BackupManifest, error) {
+	data, err := readSideFile(fs, filepath.Join(directory, backupManifestFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return BackupManifest{}, fmt.Errorf("%w: %s has no manifest", ErrIncompleteBackup, directory)
+	}
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return BackupManifest{}, fmt.Errorf("could not read backup manifest: %w", err)
+	}
+	return manifest, nil
+}
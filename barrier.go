@@ -0,0 +1,187 @@
+package wal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BarrierStream is the stream of the marker entries written by Barrier.
+const BarrierStream = "gowal.barrier"
+
+// Labels of the marker entries written by Barrier.
+const (
+	// BarrierLabelID is the ID of the barrier.
+	BarrierLabelID = "gowal.barrier.id"
+	// BarrierLabelPhase is "prepare" for the marker that delimits the cut, and "commit" for the marker
+	// written once the cut is durable in every WAL.
+	BarrierLabelPhase = "gowal.barrier.phase"
+)
+
+const (
+	barrierPrepare = "prepare"
+	barrierCommit  = "commit"
+)
+
+// ErrNoBarrier is returned by LastBarrier when no barrier was committed in all of the WALs.
+var ErrNoBarrier = errors.New("no barrier found")
+
+// barrierLock serializes barriers, so that barriers over overlapping WALs can't lock them in different orders.
+var barrierLock sync.Mutex
+
+// BarrierCut is a consistent cut across several WALs, written by Barrier: an entry is before the cut
+// in one WAL if and only if it was written before the cut was taken, in every WAL.
+type BarrierCut struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// SequenceNumbers holds, for every WAL in the order they were passed to Barrier, the sequence number
+	// of its prepare marker. The entries before it are the state of the WAL at the cut.
+	SequenceNumbers []uint64 `json:"sequence_numbers"`
+}
+
+// Barrier writes correlated marker entries into wals, for applications sharding their data across
+// several WALs, so that a globally consistent restore point can be identified, see LastBarrier.
+//
+// It works in two phases. Writes to all of the WALs are paused while a prepare marker is written to
+// each of them: the prepare markers delimit the cut. Once they have been synced to disk, a commit
+// marker recording the cut is written to each WAL and synced, so that a barrier interrupted by a crash
+// is never used. The markers belong to BarrierStream, and are labeled with the ID and phase of the barrier.
+func Barrier(id string, wals ...*WAL) (BarrierCut, error) {
+	for i, wal := range wals {
+		for _, other := range wals[:i] {
+			if wal == other {
+				return BarrierCut{}, fmt.Errorf("barrier %s: WAL %s is given twice", id, wal.directory)
+			}
+		}
+	}
+
+	barrierLock.Lock()
+	defer barrierLock.Unlock()
+
+	for i, wal := range wals {
+		if !wal.beginWrite() {
+			for _, wal := range wals[:i] {
+				wal.writers.Done()
+			}
+			return BarrierCut{}, ErrClosed
+		}
+	}
+	defer func() {
+		for _, wal := range wals {
+			wal.writers.Done()
+		}
+	}()
+
+	cut, err := prepareBarrier(id, wals)
+	if err != nil {
+		return BarrierCut{}, err
+	}
+
+	for _, wal := range wals {
+		if err := wal.Sync(); err != nil {
+			return BarrierCut{}, fmt.Errorf("could not prepare barrier %s in %s: %w", id, wal.directory, err)
+		}
+	}
+	data, err := json.Marshal(cut)
+	if err != nil {
+		return BarrierCut{}, err
+	}
+	for _, wal := range wals {
+		wal.lock.Lock()
+		err := wal.appendEntry(barrierMarker(id, barrierCommit, data))
+		if err == nil {
+			err = wal.sync()
+		}
+		wal.lock.Unlock()
+		if err != nil {
+			return BarrierCut{}, fmt.Errorf("could not commit barrier %s in %s: %w", id, wal.directory, err)
+		}
+	}
+	return cut, nil
+}
+
+// prepareBarrier writes the prepare markers while holding the locks of all the WALs.
+func prepareBarrier(id string, wals []*WAL) (BarrierCut, error) {
+	for _, wal := range wals {
+		wal.lock.Lock()
+		defer wal.lock.Unlock()
+	}
+
+	cut := BarrierCut{ID: id, SequenceNumbers: make([]uint64, len(wals))}
+	if len(wals) > 0 {
+		cut.Time = wals[0].clock.Now()
+	}
+	for i, wal := range wals {
+		marker := barrierMarker(id, barrierPrepare, nil)
+		if err := wal.appendEntry(marker); err != nil {
+			return BarrierCut{}, fmt.Errorf("could not prepare barrier %s in %s: %w", id, wal.directory, err)
+		}
+		cut.SequenceNumbers[i] = marker.GetLogSequenceNumber()
+	}
+	return cut, nil
+}
+
+func barrierMarker(id, phase string, data []byte) *WAL_Entry {
+	return &WAL_Entry{
+		Data:   data,
+		Stream: BarrierStream,
+		Labels: map[string]string{BarrierLabelID: id, BarrierLabelPhase: phase},
+	}
+}
+
+// Barriers returns the barriers committed in the WAL that are still in the log, oldest first.
+func (wal *WAL) Barriers() ([]BarrierCut, error) {
+	tail, err := wal.Tail(0)
+	if err != nil {
+		return nil, err
+	}
+	defer tail.Stop()
+
+	var cuts []BarrierCut
+	err = tail.Read(func(entry *WAL_Entry) error {
+		if entry.GetStream() != BarrierStream || entry.GetLabels()[BarrierLabelPhase] != barrierCommit {
+			return nil
+		}
+		var cut BarrierCut
+		if err := json.Unmarshal(entry.GetData(), &cut); err != nil {
+			return fmt.Errorf("invalid barrier at sequence number %d: %w", entry.GetLogSequenceNumber(), err)
+		}
+		cuts = append(cuts, cut)
+		return nil
+	})
+	return cuts, err
+}
+
+// LastBarrier returns the last barrier committed in every one of wals, which must be passed in the
+// same order as to Barrier. It returns ErrNoBarrier if there is none.
+func LastBarrier(wals ...*WAL) (BarrierCut, error) {
+	if len(wals) == 0 {
+		return BarrierCut{}, ErrNoBarrier
+	}
+
+	committed := make(map[string]int)
+	var cuts []BarrierCut
+	for i, wal := range wals {
+		walCuts, err := wal.Barriers()
+		if err != nil {
+			return BarrierCut{}, err
+		}
+		for _, cut := range walCuts {
+			if len(cut.SequenceNumbers) == len(wals) && committed[cut.ID] == i {
+				committed[cut.ID]++
+			}
+		}
+		if i == 0 {
+			cuts = walCuts
+		}
+	}
+
+	for i := len(cuts) - 1; i >= 0; i-- {
+		if committed[cuts[i].ID] == len(wals) {
+			return cuts[i], nil
+		}
+	}
+	return BarrierCut{}, ErrNoBarrier
+}
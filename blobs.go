@@ -0,0 +1,190 @@
+package wal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// blobDirName is the directory, inside the WAL directory, holding the data stored by WithBlobThreshold,
+// in files named after the hex SHA-256 of their content.
+const blobDirName = "blobs"
+
+// WithBlobThreshold stores the data of the entries larger than threshold bytes in the blobs directory of
+// the WAL, once per distinct content, and writes only its SHA-256 in the log. Repeated large values are
+// stored once, and the segments stay small. The read APIs return the entries with their data, read back
+// from the blobs directory; blobs no longer referenced by any segment are deleted by CollectBlobs.
+// Checkpoints are always stored in the log. Defaults to 0, which disables it.
+func WithBlobThreshold(threshold int) Option {
+	return func(o *options) {
+		o.blobThreshold = threshold
+	}
+}
+
+// storeBlob stores the data of the entry in the blobs directory, if it isn't there already, and replaces
+// it with its hash. The blob is marked pending until done is called, so that CollectBlobs keeps it until
+// the entry is in the log.
+func (wal *WAL) storeBlob(entry *WAL_Entry) (done func(), err error) {
+	sum := sha256.Sum256(entry.GetData())
+	name := hex.EncodeToString(sum[:])
+
+	wal.blobLock.Lock()
+	wal.pendingBlobs[name]++
+	wal.blobLock.Unlock()
+	done = func() {
+		wal.blobLock.Lock()
+		defer wal.blobLock.Unlock()
+		if wal.pendingBlobs[name]--; wal.pendingBlobs[name] <= 0 {
+			delete(wal.pendingBlobs, name)
+		}
+	}
+
+	if err := writeBlobFile(wal.fs, filepath.Join(wal.directory, blobDirName), name, entry.GetData()); err != nil {
+		done()
+		return nil, fmt.Errorf("could not store blob %s: %w", name, err)
+	}
+	entry.Blob = sum[:]
+	entry.Data = nil
+	return done, nil
+}
+
+// blobTempFiles numbers the temporary files of writeBlobFile.
+var blobTempFiles atomic.Uint64
+
+// writeBlobFile atomically writes the blob file with the given name, unless it exists already.
+func writeBlobFile(fs FS, directory, name string, data []byte) error {
+	filePath := filepath.Join(directory, name)
+	if _, err := fs.Stat(filePath); err == nil {
+		return nil
+	}
+	if err := fs.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+
+	// Writers of the same blob write their own temporary file, since they don't hold a common lock. The
+	// blob is replaced atomically with the same content by every one of them.
+	tempFilePath := fmt.Sprintf("%s.%d.tmp", filePath, blobTempFiles.Add(1))
+	tempFile, err := fs.OpenFile(tempFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	// The blob must be durable before the entry referencing it is.
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return fs.Rename(tempFilePath, filePath)
+}
+
+// resolveBlob replaces the blob reference of the entry, if it has one, with the data read from the blobs
+// directory of the WAL in directory. It returns ErrCorruptEntry if the blob doesn't match its hash.
+func resolveBlob(fs FS, directory string, entry *WAL_Entry) error {
+	if len(entry.GetBlob()) == 0 {
+		return nil
+	}
+	name := hex.EncodeToString(entry.GetBlob())
+	file, err := fs.OpenFile(filepath.Join(directory, blobDirName, name), os.O_RDONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not read blob %s of entry %d: %w", name, entry.GetLogSequenceNumber(), err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("could not read blob %s of entry %d: %w", name, entry.GetLogSequenceNumber(), err)
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], entry.GetBlob()) {
+		return fmt.Errorf("%w: blob %s of entry %d doesn't match its hash", ErrCorruptEntry, name, entry.GetLogSequenceNumber())
+	}
+
+	entry.Data = data
+	entry.Blob = nil
+	entry.CRC = computeCRC(entry)
+	return nil
+}
+
+// resolveData replaces the blob reference or the value pointer of the entry, if it has one, with its
+// data, see resolveBlob and resolveValuePointer.
+func resolveData(fs FS, directory string, entry *WAL_Entry) error {
+	if err := resolveBlob(fs, directory, entry); err != nil {
+		return err
+	}
+	return resolveValuePointer(fs, directory, entry)
+}
+
+// resolveEntries resolves the data of the entries, see resolveData.
+func (wal *WAL) resolveEntries(entries []*WAL_Entry) error {
+	for _, entry := range entries {
+		if err := resolveData(wal.fs, wal.directory, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollectBlobs deletes the blobs no longer referenced by the entries of any segment, e.g. once the
+// segments referencing them were compacted or deleted, and returns how many it deleted. It holds the
+// lock of the WAL while it reads the segments, so writes wait for it.
+func (wal *WAL) CollectBlobs() (deleted int, err error) {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	defer func() {
+		wal.recordAdmin(AdminOpCollectBlobs, wal.directory, fmt.Sprintf("deleted %d blobs", deleted), err)
+	}()
+
+	directory := filepath.Join(wal.directory, blobDirName)
+	files, err := wal.fs.Glob(filepath.Join(directory, "*"))
+	if err != nil || len(files) == 0 {
+		return 0, err
+	}
+
+	// The buffered entries may reference blobs too.
+	if err := wal.flush(); err != nil {
+		return 0, err
+	}
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return 0, err
+	}
+	referenced := make(map[string]bool)
+	for _, segment := range segments {
+		entries, err := wal.readSegmentFile(segment.path)
+		if err != nil {
+			return 0, err
+		}
+		for _, entry := range entries {
+			if len(entry.GetBlob()) > 0 {
+				referenced[hex.EncodeToString(entry.GetBlob())] = true
+			}
+		}
+	}
+
+	// Writers mark their blob pending before checking whether it exists, so a blob isn't deleted while
+	// it is being written, or after a writer found it and skipped writing it.
+	wal.blobLock.Lock()
+	defer wal.blobLock.Unlock()
+	for _, file := range files {
+		name := filepath.Base(file)
+		if strings.HasSuffix(name, ".tmp") || referenced[name] || wal.pendingBlobs[name] > 0 {
+			continue
+		}
+		if err := wal.fs.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,364 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// capnpEncodingMarker is the first byte of the records of EncodingCapnProto in the segments without a
+// header, the tag of the invalid protobuf field 0 with the 64-bit wire type. The Cap'n Proto message
+// follows it.
+const capnpEncodingMarker = 0x03
+
+// Layout of the Entry struct of types.capnp, as assigned by the Cap'n Proto compiler: the sizes of its
+// data and pointer sections in words, the byte offsets of its data fields, the bits of its bool fields
+// in the byte at capnpFlagsOffset, and the indexes of its pointer fields.
+const (
+	capnpDataWords = 5
+	capnpPointers  = 8
+
+	capnpLogSequenceNumberOffset = 0
+	capnpCRCOffset               = 8
+	capnpFlagsOffset             = 12
+	capnpTimestampOffset         = 16
+	capnpHLCOffset               = 24
+	capnpSchemaVersionOffset     = 32
+
+	capnpFlagIsCheckpoint  = 1 << 0
+	capnpFlagHasCheckpoint = 1 << 1
+	capnpFlagTombstone     = 1 << 2
+
+	capnpPointerData         = 0
+	capnpPointerMetadata     = 1
+	capnpPointerLabels       = 2
+	capnpPointerStream       = 3
+	capnpPointerKey          = 4
+	capnpPointerSchema       = 5
+	capnpPointerBlob         = 6
+	capnpPointerValuePointer = 7
+
+	// The Label struct has no data section, and its key and value as pointers.
+	capnpLabelPointers = 2
+)
+
+// Kinds of Cap'n Proto pointers, and sizes of list elements.
+const (
+	capnpStructPointer = 0
+	capnpListPointer   = 1
+
+	capnpByteElements      = 2
+	capnpCompositeElements = 7
+)
+
+var errInvalidCapnp = errors.New("invalid Cap'n Proto message")
+
+// appendCapnpEntry appends the entry encoded with EncodingCapnProto to b, as a single segment Cap'n Proto
+// message of the Entry struct of types.capnp, with its segment table.
+//
+// The root struct comes first in the segment, followed by the lists and texts it points to, in the order
+// of its pointers. Offsets are in words, relative to the segment, which follows the segment table.
+func appendCapnpEntry(b []byte, entry *WAL_Entry) []byte {
+	header := len(b)
+	b = append(b, make([]byte, 8)...)
+	segment := len(b)
+
+	b = binary.LittleEndian.AppendUint64(b, capnpStructPointerWord(0, capnpDataWords, capnpPointers))
+	root := len(b)
+	b = append(b, make([]byte, 8*(capnpDataWords+capnpPointers))...)
+	binary.LittleEndian.PutUint64(b[root+capnpLogSequenceNumberOffset:], entry.LogSequenceNumber)
+	binary.LittleEndian.PutUint32(b[root+capnpCRCOffset:], entry.CRC)
+	binary.LittleEndian.PutUint64(b[root+capnpTimestampOffset:], uint64(entry.Timestamp))
+	binary.LittleEndian.PutUint64(b[root+capnpHLCOffset:], entry.Hlc)
+	binary.LittleEndian.PutUint32(b[root+capnpSchemaVersionOffset:], entry.SchemaVersion)
+	var flags byte
+	if entry.IsCheckpoint != nil {
+		flags |= capnpFlagHasCheckpoint
+		if *entry.IsCheckpoint {
+			flags |= capnpFlagIsCheckpoint
+		}
+	}
+	if entry.Tombstone {
+		flags |= capnpFlagTombstone
+	}
+	b[root+capnpFlagsOffset] = flags
+
+	pointers := root + 8*capnpDataWords
+	b = appendCapnpBytes(b, pointers+8*capnpPointerData, entry.Data, false)
+	b = appendCapnpBytes(b, pointers+8*capnpPointerMetadata, entry.Metadata, false)
+	if len(entry.Labels) > 0 {
+		b = appendCapnpLabels(b, pointers+8*capnpPointerLabels, entry.Labels)
+	}
+	b = appendCapnpBytes(b, pointers+8*capnpPointerStream, []byte(entry.Stream), true)
+	b = appendCapnpBytes(b, pointers+8*capnpPointerKey, entry.Key, false)
+	b = appendCapnpBytes(b, pointers+8*capnpPointerSchema, []byte(entry.Schema), true)
+	b = appendCapnpBytes(b, pointers+8*capnpPointerBlob, entry.Blob, false)
+	b = appendCapnpBytes(b, pointers+8*capnpPointerValuePointer, entry.ValuePointer, false)
+
+	// The segment table: the number of segments minus one, and the size of the segment in words.
+	binary.LittleEndian.PutUint32(b[header+4:], uint32((len(b)-segment)/8))
+	return b
+}
+
+// capnpStructPointerWord returns a struct pointer to a struct offset words after the end of the pointer.
+func capnpStructPointerWord(offset, dataWords, pointers int) uint64 {
+	return uint64(uint32(offset)<<2|capnpStructPointer) | uint64(dataWords)<<32 | uint64(pointers)<<48
+}
+
+// capnpListPointerWord returns a list pointer to a list offset words after the end of the pointer.
+func capnpListPointerWord(offset, elementSize, count int) uint64 {
+	return uint64(uint32(offset)<<2|capnpListPointer) | uint64(elementSize)<<32 | uint64(count)<<35
+}
+
+// appendCapnpBytes appends a list of bytes, or a text, which is also null terminated, padded to a word,
+// and sets the pointer at the given position to it. Empty data and texts are left as null pointers.
+func appendCapnpBytes(b []byte, at int, data []byte, isText bool) []byte {
+	if len(data) == 0 {
+		return b
+	}
+	count := len(data)
+	if isText {
+		count++
+	}
+	binary.LittleEndian.PutUint64(b[at:], capnpListPointerWord((len(b)-at-8)/8, capnpByteElements, count))
+	b = append(b, data...)
+	if isText {
+		b = append(b, 0)
+	}
+	return append(b, make([]byte, (8-count%8)%8)...)
+}
+
+// appendCapnpLabels appends the labels as a composite list of Label structs sorted by key, and sets the
+// pointer at the given position to it.
+func appendCapnpLabels(b []byte, at int, labels map[string]string) []byte {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	words := len(keys) * capnpLabelPointers
+	binary.LittleEndian.PutUint64(b[at:], capnpListPointerWord((len(b)-at-8)/8, capnpCompositeElements, words))
+	// The tag of a composite list is a struct pointer whose offset is the number of elements.
+	b = binary.LittleEndian.AppendUint64(b, capnpStructPointerWord(len(keys), 0, capnpLabelPointers))
+	elements := len(b)
+	b = append(b, make([]byte, 8*words)...)
+	for i, key := range keys {
+		element := elements + 8*capnpLabelPointers*i
+		b = appendCapnpBytes(b, element, []byte(key), true)
+		b = appendCapnpBytes(b, element+8, []byte(labels[key]), true)
+	}
+	return b
+}
+
+// capnpEntry is an entry encoded with EncodingCapnProto, without its marker and segment table: the
+// segment. Its accessors read the fields in place; they assume the segment was checked by
+// verifyCapnpEntry.
+type capnpEntry []byte
+
+// capnpStruct is the position of a struct in a segment, in bytes, and the sizes of its sections in words.
+type capnpStruct struct {
+	data      int
+	dataWords int
+	pointers  int
+}
+
+// verifyCapnpEntry checks the segment table of the message and that the pointers of the segment are
+// within it, like the readers of Cap'n Proto do, and returns the segment.
+func verifyCapnpEntry(message []byte) (capnpEntry, error) {
+	if len(message) < 8 || binary.LittleEndian.Uint32(message) != 0 {
+		// Entries are always written as a single segment.
+		return nil, errInvalidCapnp
+	}
+	size := int64(binary.LittleEndian.Uint32(message[4:])) * 8
+	if size < 8 || size != int64(len(message)-8) {
+		return nil, errInvalidCapnp
+	}
+
+	c := capnpEntry(message[8:])
+	root, ok := c.verifyStruct(0)
+	if !ok {
+		return nil, errInvalidCapnp
+	}
+	for _, pointer := range []int{capnpPointerData, capnpPointerMetadata, capnpPointerStream, capnpPointerKey,
+		capnpPointerSchema, capnpPointerBlob, capnpPointerValuePointer} {
+		if _, _, ok := c.verifyList(root.pointer(pointer), capnpByteElements); !ok {
+			return nil, errInvalidCapnp
+		}
+	}
+
+	elements, count, ok := c.verifyList(root.pointer(capnpPointerLabels), capnpCompositeElements)
+	if !ok {
+		return nil, errInvalidCapnp
+	}
+	for i := 0; i < count; i++ {
+		label := c.element(elements, i)
+		for pointer := 0; pointer < capnpLabelPointers; pointer++ {
+			if _, _, ok := c.verifyList(label.pointer(pointer), capnpByteElements); !ok {
+				return nil, errInvalidCapnp
+			}
+		}
+	}
+	return c, nil
+}
+
+// verifyStruct checks the struct pointer at the given position, and the struct it points to.
+func (c capnpEntry) verifyStruct(at int) (capnpStruct, bool) {
+	word := binary.LittleEndian.Uint64(c[at:])
+	if word&3 != capnpStructPointer {
+		return capnpStruct{}, false
+	}
+	s := capnpStruct{
+		data:      at + 8 + 8*int(int32(uint32(word))>>2),
+		dataWords: int(uint16(word >> 32)),
+		pointers:  int(uint16(word >> 48)),
+	}
+	if s.data < 0 || s.data+8*(s.dataWords+s.pointers) > len(c) {
+		return capnpStruct{}, false
+	}
+	return s, true
+}
+
+// verifyList checks the list pointer at the given position, if any, and returns the position of its
+// elements and their number. Composite lists are checked to hold structs with the pointers of a Label.
+func (c capnpEntry) verifyList(at, elementSize int) (elements, count int, ok bool) {
+	if at < 0 {
+		return 0, 0, true
+	}
+	word := binary.LittleEndian.Uint64(c[at:])
+	if word == 0 {
+		return 0, 0, true
+	}
+	if word&3 != capnpListPointer || int(word>>32)&7 != elementSize {
+		return 0, 0, false
+	}
+	elements = at + 8 + 8*int(int32(uint32(word))>>2)
+	count = int(word >> 35)
+	size := count
+	if elementSize == capnpCompositeElements {
+		size = 8 * (count + 1)
+	}
+	if elements < 0 || elements+size > len(c) {
+		return 0, 0, false
+	}
+	if elementSize != capnpCompositeElements {
+		return elements, count, true
+	}
+
+	tag := binary.LittleEndian.Uint64(c[elements:])
+	n := int(int32(uint32(tag)) >> 2)
+	words := int(uint16(tag>>32)) + int(uint16(tag>>48))
+	if tag&3 != capnpStructPointer || n < 0 || n*words > count || uint16(tag>>48) < capnpLabelPointers {
+		return 0, 0, false
+	}
+	return elements, n, true
+}
+
+// pointer returns the position of the pointer of the struct with the given index, or -1 if the struct
+// has no such pointer, e.g. because it was written with an older schema.
+func (s capnpStruct) pointer(i int) int {
+	if i >= s.pointers {
+		return -1
+	}
+	return s.data + 8*(s.dataWords+i)
+}
+
+// element returns the i-th struct of the composite list whose tag is at the given position.
+func (c capnpEntry) element(tag, i int) capnpStruct {
+	word := binary.LittleEndian.Uint64(c[tag:])
+	s := capnpStruct{dataWords: int(uint16(word >> 32)), pointers: int(uint16(word >> 48))}
+	s.data = tag + 8 + 8*(s.dataWords+s.pointers)*i
+	return s
+}
+
+func (c capnpEntry) root() capnpStruct {
+	s, _ := c.verifyStruct(0)
+	return s
+}
+
+// uint64 returns the data field of the root struct at the given byte offset, or 0 if it is past its
+// data section.
+func (c capnpEntry) uint64(offset int) uint64 {
+	root := c.root()
+	if offset+8 > 8*root.dataWords {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(c[root.data+offset:])
+}
+
+func (c capnpEntry) uint32(offset int) uint32 {
+	root := c.root()
+	if offset+4 > 8*root.dataWords {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(c[root.data+offset:])
+}
+
+func (c capnpEntry) flags() byte {
+	root := c.root()
+	if capnpFlagsOffset >= 8*root.dataWords {
+		return 0
+	}
+	return c[root.data+capnpFlagsOffset]
+}
+
+// bytes returns the list of bytes, or the text without its null terminator, the pointer at the given
+// position points to, or nil if it is null.
+func (c capnpEntry) bytes(at int, isText bool) []byte {
+	elements, count, _ := c.verifyList(at, capnpByteElements)
+	if isText && count > 0 {
+		count--
+	}
+	if count == 0 {
+		return nil
+	}
+	return c[elements : elements+count : elements+count]
+}
+
+// The methods of inPlaceEntry.
+
+func (c capnpEntry) lsn() uint64      { return c.uint64(capnpLogSequenceNumberOffset) }
+func (c capnpEntry) crc() uint32      { return c.uint32(capnpCRCOffset) }
+func (c capnpEntry) timestamp() int64 { return int64(c.uint64(capnpTimestampOffset)) }
+func (c capnpEntry) hlc() uint64      { return c.uint64(capnpHLCOffset) }
+func (c capnpEntry) tombstone() bool  { return c.flags()&capnpFlagTombstone != 0 }
+func (c capnpEntry) data() []byte     { return c.bytes(c.root().pointer(capnpPointerData), false) }
+func (c capnpEntry) metadata() []byte { return c.bytes(c.root().pointer(capnpPointerMetadata), false) }
+func (c capnpEntry) stream() []byte   { return c.bytes(c.root().pointer(capnpPointerStream), true) }
+func (c capnpEntry) key() []byte      { return c.bytes(c.root().pointer(capnpPointerKey), false) }
+func (c capnpEntry) schema() []byte   { return c.bytes(c.root().pointer(capnpPointerSchema), true) }
+func (c capnpEntry) blob() []byte     { return c.bytes(c.root().pointer(capnpPointerBlob), false) }
+func (c capnpEntry) valuePointer() []byte {
+	return c.bytes(c.root().pointer(capnpPointerValuePointer), false)
+}
+
+func (c capnpEntry) schemaVersion() uint32 {
+	return c.uint32(capnpSchemaVersionOffset)
+}
+
+func (c capnpEntry) isCheckpoint() (value, ok bool) {
+	flags := c.flags()
+	return flags&capnpFlagIsCheckpoint != 0, flags&capnpFlagHasCheckpoint != 0
+}
+
+func (c capnpEntry) labelCount() int {
+	_, count, _ := c.verifyList(c.root().pointer(capnpPointerLabels), capnpCompositeElements)
+	return count
+}
+
+func (c capnpEntry) label(i int) (key, value []byte) {
+	tag, _, _ := c.verifyList(c.root().pointer(capnpPointerLabels), capnpCompositeElements)
+	label := c.element(tag, i)
+	return c.bytes(label.pointer(0), true), c.bytes(label.pointer(1), true)
+}
+
+// unmarshalCapnpEntry decodes a record of EncodingCapnProto, without its marker, into the entry. Like
+// UnmarshalVT, the entry is reset first and doesn't share memory with data.
+func unmarshalCapnpEntry(data []byte, entry *WAL_Entry) error {
+	c, err := verifyCapnpEntry(data)
+	if err != nil {
+		return err
+	}
+	copyInPlaceEntry(c, ChecksumIEEE, entry)
+	return nil
+}
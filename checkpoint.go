@@ -0,0 +1,146 @@
+package wal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// checkpointFileName is the side-file next to the segments that records the most recent checkpoints,
+// so that they can be retrieved without scanning the log.
+const checkpointFileName = "checkpoint"
+
+// ErrNoCheckpoint is returned by LastCheckpoint when no checkpoint has been created.
+var ErrNoCheckpoint = errors.New("no checkpoint found")
+
+// CheckpointInfo describes a checkpoint recorded in the checkpoint side-file.
+type CheckpointInfo struct {
+	// LogSequenceNumber is the sequence number of the checkpoint entry in the log.
+	LogSequenceNumber uint64 `json:"log_sequence_number"`
+	// Data is the payload the checkpoint was created with.
+	Data []byte `json:"data"`
+}
+
+// LastCheckpoint returns the log sequence number and payload of the most recent checkpoint.
+// It is backed by the checkpoint side-file and does not scan the log.
+// If no checkpoint has been created, it returns ErrNoCheckpoint.
+func (wal *WAL) LastCheckpoint() (lsn uint64, data []byte, err error) {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if len(wal.checkpoints) == 0 {
+		return 0, nil, ErrNoCheckpoint
+	}
+
+	lastCheckpoint := wal.checkpoints[len(wal.checkpoints)-1]
+	return lastCheckpoint.GetLogSequenceNumber(), lastCheckpoint.GetData(), nil
+}
+
+// Checkpoints returns the retained checkpoints, most recent first.
+// Up to the number of checkpoints configured with WithCheckpointRetention are kept,
+// so restore tooling can fall back to an older checkpoint when the newest one is unusable.
+func (wal *WAL) Checkpoints() []CheckpointInfo {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	checkpoints := make([]CheckpointInfo, 0, len(wal.checkpoints))
+	for i := len(wal.checkpoints) - 1; i >= 0; i-- {
+		checkpoints = append(checkpoints, CheckpointInfo{
+			LogSequenceNumber: wal.checkpoints[i].GetLogSequenceNumber(),
+			Data:              wal.checkpoints[i].GetData(),
+		})
+	}
+
+	return checkpoints
+}
+
+// loadCheckpoints reads the checkpoints recorded in the checkpoint side-file (oldest first), if present.
+func loadCheckpoints(fs FS, directory string) ([]*WAL_Entry, error) {
+	file, err := fs.OpenFile(filepath.Join(directory, checkpointFileName), os.O_RDONLY, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	entries, _, err := readAllEntriesFromFile(file, headerlessFormat, false, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not read checkpoint file: %v", err)
+	}
+
+	return entries, nil
+}
+
+// saveCheckpoint records the given checkpoint entry by atomically replacing the checkpoint side-file,
+// dropping the oldest checkpoints beyond the retention limit.
+// The checkpoint entry must already be durable in the log. Concurrent checkpoints may be saved out of
+// order, as they are synced without holding wal.lock, so the checkpoints are kept ordered.
+func (wal *WAL) saveCheckpoint(entry *WAL_Entry) error {
+	checkpoints := append(wal.checkpoints[:len(wal.checkpoints):len(wal.checkpoints)], entry)
+	slices.SortStableFunc(checkpoints, func(a, b *WAL_Entry) int {
+		return cmp.Compare(a.GetLogSequenceNumber(), b.GetLogSequenceNumber())
+	})
+	if len(checkpoints) > wal.checkpointRetention {
+		checkpoints = checkpoints[len(checkpoints)-wal.checkpointRetention:]
+	}
+
+	if err := wal.writeCheckpoints(checkpoints); err != nil {
+		return err
+	}
+	wal.logEvent(slog.LevelInfo, EventCheckpointSaved,
+		slog.Uint64("log_sequence_number", entry.GetLogSequenceNumber()),
+		slog.Int("retained", len(checkpoints)))
+	return nil
+}
+
+// writeCheckpoints atomically replaces the checkpoint side-file with the given checkpoints, oldest first.
+func (wal *WAL) writeCheckpoints(checkpoints []*WAL_Entry) error {
+	written, err := writeCheckpointFile(wal.fs, wal.directory, checkpoints)
+	wal.stats.PhysicalBytesWritten += uint64(written)
+	if err != nil {
+		return err
+	}
+
+	wal.checkpoints = checkpoints
+	return nil
+}
+
+// writeCheckpointFile atomically replaces the checkpoint side-file of directory with the given
+// checkpoints, and returns the number of bytes written.
+func writeCheckpointFile(fs FS, directory string, checkpoints []*WAL_Entry) (int64, error) {
+	filePath := filepath.Join(directory, checkpointFileName)
+	tempFilePath := fmt.Sprintf("%s.tmp", filePath)
+
+	tempFile, err := fs.OpenFile(tempFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	buf := getEntryBuffer()
+	defer putEntryBuffer(buf)
+	for _, checkpoint := range checkpoints {
+		*buf = appendFrame((*buf)[:0], checkpoint)
+		if _, err := tempFile.Write(*buf); err != nil {
+			tempFile.Close()
+			return written, err
+		}
+		written += int64(len(*buf))
+	}
+
+	// The side-file must be durable before it replaces the previous one.
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return written, err
+	}
+	if err := tempFile.Close(); err != nil {
+		return written, err
+	}
+	return written, fs.Rename(tempFilePath, filePath)
+}
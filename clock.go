@@ -0,0 +1,102 @@
+package wal
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Clock is the source of time used by the WAL.
+// It drives the periodic sync timer and any timestamps the WAL records,
+// so tests can replace it to trigger syncs deterministically without sleeping.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the subset of time.Timer used by the WAL.
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// systemClock is the default Clock backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{timer: time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *systemTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+func (t *systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// ticker fires at a fixed rate on top of a Timer, like time.Ticker: ticks are scheduled from when the
+// ticker started rather than from when the previous tick was handled, so slow handling doesn't make it
+// drift, and the ticks missed meanwhile are dropped. Each tick is delayed by a random duration of up to
+// jitter, which doesn't carry over to the next one, so that tickers started together spread out.
+// The timer is only stopped and reset by the goroutine receiving the ticks.
+type ticker struct {
+	clock    Clock
+	timer    Timer
+	interval time.Duration
+	jitter   time.Duration
+	next     time.Time // time of the next tick, before jitter
+}
+
+func newTicker(clock Clock, interval, jitter time.Duration) *ticker {
+	t := &ticker{clock: clock, interval: interval, jitter: jitter, next: clock.Now().Add(interval)}
+	t.timer = clock.NewTimer(t.delay())
+	return t
+}
+
+func (t *ticker) C() <-chan time.Time {
+	return t.timer.C()
+}
+
+// delay returns the time left until the next tick, jitter included.
+func (t *ticker) delay() time.Duration {
+	d := t.next.Sub(t.clock.Now())
+	if t.jitter > 0 {
+		d += rand.N(t.jitter)
+	}
+	return max(d, 0)
+}
+
+// advance schedules the next tick, once a tick was received.
+func (t *ticker) advance() {
+	now := t.clock.Now()
+	t.next = t.next.Add(t.interval)
+	if t.interval > 0 && !t.next.After(now) {
+		t.next = t.next.Add((now.Sub(t.next)/t.interval + 1) * t.interval)
+	}
+	t.timer.Reset(t.delay())
+}
+
+// setInterval changes the interval of the ticker, scheduling the next tick an interval from now.
+func (t *ticker) setInterval(interval time.Duration) {
+	t.timer.Stop()
+	t.interval = interval
+	t.next = t.clock.Now().Add(interval)
+	t.timer.Reset(t.delay())
+}
+
+func (t *ticker) stop() {
+	t.timer.Stop()
+}
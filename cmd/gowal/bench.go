@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+var benchCommand = command{
+	name:  "bench",
+	usage: "bench [--fsync] [--profile p] <dir>   benchmark writes, reads and recovery in a temporary WAL",
+	run:   runBench,
+}
+
+// benchReport is the result of the bench command.
+type benchReport struct {
+	EntrySize   int    `json:"entry_size"`
+	Entries     int    `json:"entries"`
+	Concurrency int    `json:"concurrency"`
+	Fsync       bool   `json:"fsync"`
+	Profile     string `json:"profile"`
+	MaxSegments int    `json:"max_segments,omitempty"`
+
+	Write    benchResult   `json:"write"`
+	Read     benchResult   `json:"read"`
+	Recovery time.Duration `json:"recovery"`
+
+	WriteLatencyP50    time.Duration `json:"write_latency_p50"`
+	WriteLatencyP95    time.Duration `json:"write_latency_p95"`
+	WriteLatencyP99    time.Duration `json:"write_latency_p99"`
+	WriteAmplification float64       `json:"write_amplification"`
+}
+
+// benchResult is the throughput of a phase of the benchmark.
+type benchResult struct {
+	Duration      time.Duration `json:"duration"`
+	EntriesPerSec float64       `json:"entries_per_sec"`
+	BytesPerSec   float64       `json:"bytes_per_sec"`
+}
+
+func newBenchResult(d time.Duration, entries, entrySize int) benchResult {
+	seconds := d.Seconds()
+	return benchResult{
+		Duration:      d,
+		EntriesPerSec: float64(entries) / seconds,
+		BytesPerSec:   float64(entries*entrySize) / seconds,
+	}
+}
+
+// runBench writes entries to a new WAL in a temporary directory under dir, reads them back and reopens
+// the WAL, reporting the throughput of each phase, the write latency percentiles and the write amplification.
+func runBench(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("bench", stderr)
+	entrySizeFlag := flags.String("entry-size", "1k", "size of the payload of each entry, with an optional k, m or g suffix")
+	entries := flags.Int("entries", 100000, "number of entries to write")
+	concurrency := flags.Int("concurrency", 1, "number of concurrent writers")
+	fsync := flags.Bool("fsync", false, "sync every write to disk before it is acknowledged")
+	segmentSizeFlag := flags.String("segment-size", "64m", "maximum size of a segment, with an optional k, m or g suffix")
+	profile := flags.String("profile", string(wal.DurabilityDefault), "durability profile of the WAL, default or low-latency")
+	maxSegments := flags.Int("max-segments", 0, "maximum number of segments kept, 0 for no limit")
+	keep := flags.Bool("keep", false, "keep the WAL written by the benchmark")
+	jsonOutput := flags.Bool("json", false, "print the report as JSON")
+	dir, err := parseDirArgs(flags, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal bench: %v\n", err)
+		return exitError
+	}
+	if *entries <= 0 || *concurrency <= 0 {
+		fmt.Fprintf(stderr, "gowal bench: --entries and --concurrency must be positive\n")
+		return exitError
+	}
+	if *maxSegments < 0 {
+		fmt.Fprintf(stderr, "gowal bench: --max-segments must not be negative\n")
+		return exitError
+	}
+	entrySize, err := parseSize(*entrySizeFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal bench: --entry-size: %v\n", err)
+		return exitError
+	}
+	segmentSize, err := parseSize(*segmentSizeFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal bench: --segment-size: %v\n", err)
+		return exitError
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(stderr, "gowal bench: %v\n", err)
+		return exitError
+	}
+	walDir, err := os.MkdirTemp(dir, "gowal-bench-")
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal bench: %v\n", err)
+		return exitError
+	}
+	if *keep {
+		fmt.Fprintf(stderr, "gowal bench: writing to %s\n", walDir)
+	} else {
+		defer os.RemoveAll(walDir)
+	}
+
+	report := &benchReport{EntrySize: entrySize, Entries: *entries, Concurrency: *concurrency, Fsync: *fsync,
+		Profile: *profile, MaxSegments: *maxSegments}
+	if err := bench(walDir, int64(segmentSize), report); err != nil {
+		fmt.Fprintf(stderr, "gowal bench: %v\n", err)
+		return exitFailure
+	}
+
+	if *jsonOutput {
+		if err := writeJSON(stdout, report); err != nil {
+			fmt.Fprintf(stderr, "gowal bench: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	printBenchReport(stdout, report)
+	return exitOK
+}
+
+// bench runs the phases of the benchmark in walDir, filling in the report.
+func bench(walDir string, segmentSize int64, report *benchReport) error {
+	maxSegments := report.MaxSegments
+	if maxSegments == 0 {
+		maxSegments = math.MaxInt
+	}
+	profile := wal.WithDurabilityProfile(wal.DurabilityProfile(report.Profile))
+	walog, err := wal.OpenWAL(walDir, report.Fsync, segmentSize, maxSegments, profile)
+	if err != nil {
+		return err
+	}
+
+	latencies, writeDuration, err := benchWrites(walog, report)
+	if err == nil {
+		err = walog.Sync()
+	}
+	stats := walog.Stats()
+	if closeErr := walog.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	slices.Sort(latencies)
+	report.Write = newBenchResult(writeDuration, report.Entries, report.EntrySize)
+	report.WriteLatencyP50 = percentile(latencies, 0.50)
+	report.WriteLatencyP95 = percentile(latencies, 0.95)
+	report.WriteLatencyP99 = percentile(latencies, 0.99)
+	report.WriteAmplification = stats.WriteAmplification
+
+	start := time.Now()
+	walog, err = wal.OpenWAL(walDir, report.Fsync, segmentSize, maxSegments, profile, wal.WithOpenMode(wal.MustExist))
+	if err != nil {
+		return err
+	}
+	defer walog.Close()
+	report.Recovery = time.Since(start)
+
+	start = time.Now()
+	read, err := walog.ReadAllFromOffset(-1, false)
+	if err != nil {
+		return err
+	}
+	// The oldest entries are deleted with their segments once there are more than --max-segments.
+	if len(read) != report.Entries && (report.MaxSegments == 0 || len(read) > report.Entries) {
+		return fmt.Errorf("read %d entries, expected %d", len(read), report.Entries)
+	}
+	report.Read = newBenchResult(time.Since(start), len(read), report.EntrySize)
+
+	return nil
+}
+
+// benchWrites writes the entries of the benchmark from concurrent writers and returns the latency
+// of every write and the total duration.
+func benchWrites(walog *wal.WAL, report *benchReport) ([]time.Duration, time.Duration, error) {
+	payload := make([]byte, report.EntrySize)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	latencies := make([]time.Duration, report.Entries)
+	errs := make([]error, report.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < report.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Writer w writes the entries w, w+concurrency, w+2*concurrency, ...
+			for i := w; i < report.Entries; i += report.Concurrency {
+				writeStart := time.Now()
+				err := walog.WriteEntry(payload)
+				if err == nil && report.Fsync {
+					err = walog.Sync()
+				}
+				if err != nil {
+					errs[w] = err
+					return
+				}
+				latencies[i] = time.Since(writeStart)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return latencies, time.Since(start), nil
+}
+
+// percentile returns the q-th quantile of the sorted durations.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+// parseSize parses a size in bytes with an optional k, m or g (binary) suffix.
+func parseSize(s string) (int, error) {
+	multiplier := 1
+	switch strings.ToLower(s[max(len(s)-1, 0):]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+func printBenchReport(w io.Writer, report *benchReport) {
+	fsync := "off"
+	if report.Fsync {
+		fsync = "every write"
+	}
+	fmt.Fprintf(w, "entries:             %d x %d bytes, %d writers, fsync %s, %s profile\n",
+		report.Entries, report.EntrySize, report.Concurrency, fsync, report.Profile)
+	fmt.Fprintf(w, "write:               %v, %.0f entries/s, %.1f MiB/s\n",
+		report.Write.Duration.Round(time.Millisecond), report.Write.EntriesPerSec, report.Write.BytesPerSec/(1<<20))
+	fmt.Fprintf(w, "write latency:       p50 %v, p95 %v, p99 %v\n",
+		report.WriteLatencyP50, report.WriteLatencyP95, report.WriteLatencyP99)
+	fmt.Fprintf(w, "write amplification: %.2f\n", report.WriteAmplification)
+	fmt.Fprintf(w, "read:                %v, %.0f entries/s, %.1f MiB/s\n",
+		report.Read.Duration.Round(time.Millisecond), report.Read.EntriesPerSec, report.Read.BytesPerSec/(1<<20))
+	fmt.Fprintf(w, "recovery:            %v\n", report.Recovery.Round(time.Microsecond))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBench(t *testing.T) {
+	t.Parallel()
+	// The directory is created if it doesn't exist.
+	dir := filepath.Join(t.TempDir(), "bench", "wal")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"bench", "--entries", "100", "--entry-size", "128", "--concurrency", "4", "--json", dir}
+	assert.Equal(t, exitOK, run(args, &stdout, &stderr), stderr.String())
+
+	var report benchReport
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, 100, report.Entries)
+	assert.Equal(t, 128, report.EntrySize)
+	assert.Equal(t, 4, report.Concurrency)
+	assert.Positive(t, report.Write.EntriesPerSec)
+	assert.Positive(t, report.Read.EntriesPerSec)
+	assert.LessOrEqual(t, report.WriteLatencyP50, report.WriteLatencyP99)
+
+	// The WAL written by the benchmark is removed unless --keep is set.
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestBench_Text(t *testing.T) {
+	t.Parallel()
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOK, run([]string{"bench", "--entries", "10", "--fsync", t.TempDir()}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "10 x 1024 bytes, 1 writers, fsync every write")
+	assert.Contains(t, stdout.String(), "recovery:")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestWAL writes n entries, "entry1" to "entryN", to a new WAL with a hybrid clock in dir.
+func writeTestWAL(t *testing.T, dir string, n int) {
+	t.Helper()
+	walog, err := wal.OpenWAL(dir, true, 64<<20, 10, wal.WithHybridClock())
+	assert.NoError(t, err)
+	for i := 1; i <= n; i++ {
+		assert.NoError(t, walog.WriteEntryOpts([]byte(fmt.Sprintf("entry%d", i)), wal.WithStream("orders")))
+	}
+	assert.NoError(t, walog.Close())
+}
+
+// readTestWAL returns the entries of the WAL in dir.
+func readTestWAL(t *testing.T, dir string) []*wal.WAL_Entry {
+	t.Helper()
+	walog, err := wal.OpenWAL(dir, true, 64<<20, 10)
+	assert.NoError(t, err)
+	defer walog.Close()
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	return entries
+}
+
+func TestClone(t *testing.T) {
+	t.Parallel()
+	src, dst := filepath.Join(t.TempDir(), "src"), filepath.Join(t.TempDir(), "dst")
+	writeTestWAL(t, src, 3)
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOK, run([]string{"clone", src, dst}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "copied 3 entries")
+
+	original, cloned := readTestWAL(t, src), readTestWAL(t, dst)
+	if assert.Len(t, cloned, 3) {
+		for i, entry := range cloned {
+			assert.Equal(t, original[i].GetLogSequenceNumber(), entry.GetLogSequenceNumber())
+			assert.Equal(t, original[i].GetData(), entry.GetData())
+			assert.Equal(t, "orders", entry.GetStream())
+			// The hybrid clock of the entries is kept.
+			assert.NotZero(t, entry.HLC())
+			assert.Equal(t, original[i].HLC(), entry.HLC())
+		}
+	}
+
+	// The destination must be a new WAL.
+	assert.Equal(t, exitError, run([]string{"clone", src, dst}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "is not empty")
+}
+
+func TestClone_Range(t *testing.T) {
+	t.Parallel()
+	src, dst := filepath.Join(t.TempDir(), "src"), filepath.Join(t.TempDir(), "dst")
+	writeTestWAL(t, src, 5)
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOK, run([]string{"clone", "--from-lsn", "2", "--to-lsn", "4", src, dst}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "copied 3 entries")
+
+	cloned := readTestWAL(t, dst)
+	if assert.Len(t, cloned, 3) {
+		for i, entry := range cloned {
+			assert.Equal(t, uint64(i+2), entry.GetLogSequenceNumber())
+			assert.Equal(t, []byte(fmt.Sprintf("entry%d", i+2)), entry.GetData())
+		}
+	}
+}
+
+func TestClone_Renumber(t *testing.T) {
+	t.Parallel()
+	src, dst := filepath.Join(t.TempDir(), "src"), filepath.Join(t.TempDir(), "dst")
+	writeTestWAL(t, src, 5)
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOK, run([]string{"clone", "--from-lsn", "4", "--renumber", src, dst}, &stdout, &stderr), stderr.String())
+
+	cloned := readTestWAL(t, dst)
+	if assert.Len(t, cloned, 2) {
+		assert.Equal(t, uint64(1), cloned[0].GetLogSequenceNumber())
+		assert.Equal(t, []byte("entry4"), cloned[0].GetData())
+		assert.Equal(t, uint64(2), cloned[1].GetLogSequenceNumber())
+		assert.Equal(t, []byte("entry5"), cloned[1].GetData())
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+var compactCommand = command{
+	name:  "compact",
+	usage: "compact <dir>                         drop keyed entries superseded by a later entry with the same key",
+	run:   runCompact,
+}
+
+// runCompact compacts the sealed segments of a stopped WAL.
+func runCompact(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("compact", stderr)
+	dir, err := parseDirArgs(flags, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal compact: %v\n", err)
+		return exitError
+	}
+
+	walog, err := openWAL(dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal compact: %v\n", err)
+		return exitError
+	}
+	defer walog.Close()
+
+	dropped, err := walog.Compact()
+	fmt.Fprintf(stdout, "%s: dropped %d superseded entries\n", dir, dropped)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal compact: %v\n", err)
+		return exitFailure
+	}
+
+	return exitOK
+}
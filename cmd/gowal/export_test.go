@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExport_RoundTrip doesn't run in parallel as it replaces stdin.
+func TestExport_RoundTrip(t *testing.T) {
+	src, dst := filepath.Join(t.TempDir(), "src"), filepath.Join(t.TempDir(), "dst")
+	timestamp := time.Unix(1700000000, 123456789)
+
+	walog, err := wal.OpenWAL(src, true, 64<<20, 10, wal.WithHybridClock())
+	assert.NoError(t, err)
+	assert.NoError(t, walog.WriteEntryOpts([]byte("created"), wal.WithSequenceNumber(10), wal.WithKey([]byte("order-1")),
+		wal.WithTimestamp(timestamp), wal.WithSchema("order", 2), wal.WithLabels(map[string]string{"region": "eu"})))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("checkpoint"), wal.WithCheckpoint()))
+	assert.NoError(t, walog.WriteEntryOpts(nil, wal.WithKey([]byte("order-1")), wal.WithTombstone()))
+	assert.NoError(t, walog.Close())
+
+	var exported, stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOK, run([]string{"export", "--format", "jsonl", src}, &exported, &stderr), stderr.String())
+
+	defer func(r io.Reader) { stdin = r }(stdin)
+	stdin = &exported
+	assert.Equal(t, exitOK, run([]string{"import", "--preserve-lsn", dst}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "imported 3 entries")
+
+	original, imported := readTestWAL(t, src), readTestWAL(t, dst)
+	if assert.Len(t, imported, 3) {
+		for i, entry := range imported {
+			assert.Equal(t, original[i].GetLogSequenceNumber(), entry.GetLogSequenceNumber())
+			assert.Equal(t, original[i].GetData(), entry.GetData())
+			assert.Equal(t, original[i].GetKey(), entry.GetKey())
+			assert.True(t, original[i].Time().Equal(entry.Time()))
+			assert.Equal(t, original[i].HLC(), entry.HLC())
+			assert.Equal(t, original[i].GetIsCheckpoint(), entry.GetIsCheckpoint())
+			assert.Equal(t, original[i].GetTombstone(), entry.GetTombstone())
+			assert.Equal(t, original[i].GetSchema(), entry.GetSchema())
+			assert.Equal(t, original[i].GetSchemaVersion(), entry.GetSchemaVersion())
+			assert.Equal(t, original[i].GetLabels(), entry.GetLabels())
+		}
+
+		assert.Equal(t, uint64(10), imported[0].GetLogSequenceNumber())
+		assert.True(t, timestamp.Equal(imported[0].Time()))
+		assert.Equal(t, "order", imported[0].GetSchema())
+		assert.Equal(t, uint32(2), imported[0].GetSchemaVersion())
+		assert.True(t, imported[1].GetIsCheckpoint())
+		assert.True(t, imported[2].GetTombstone())
+	}
+}
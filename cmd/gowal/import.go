@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+var importCommand = command{
+	name:  "import",
+	usage: "import [--preserve-lsn] <dir> < in    write the entries of an export into a new WAL",
+	run:   runImport,
+}
+
+// stdin is the input of the import command.
+var stdin io.Reader = os.Stdin
+
+// runImport writes the entries read as JSON lines, in the format printed by export, into a new WAL.
+func runImport(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("import", stderr)
+	preserveLSN := flags.Bool("preserve-lsn", false, "keep the sequence numbers of the imported entries instead of renumbering them from 1")
+	segmentSize := flags.Int64("segment-size", 64<<20, "maximum size of a segment in bytes")
+	dir, err := parseDirArgs(flags, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal import: %v\n", err)
+		return exitError
+	}
+
+	// Importing into an existing WAL would interleave the imported entries with its own.
+	if err := checkNewDir(dir); err != nil {
+		fmt.Fprintf(stderr, "gowal import: %v\n", err)
+		return exitError
+	}
+
+	walog, err := wal.OpenWAL(dir, true, *segmentSize, math.MaxInt)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal import: %v\n", err)
+		return exitError
+	}
+
+	imported, err := importEntries(walog, stdin, *preserveLSN)
+	if closeErr := walog.Close(); err == nil {
+		err = closeErr
+	}
+	fmt.Fprintf(stdout, "%s: imported %d entries\n", dir, imported)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal import: %v\n", err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+// importEntries writes the entries read from r to the WAL and returns how many were written.
+func importEntries(walog *wal.WAL, r io.Reader, preserveLSN bool) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, math.MaxInt32)
+
+	var imported int
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry jsonEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return imported, fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := walog.WriteEntryOpts(entry.Data, entry.options(preserveLSN)...); err != nil {
+			return imported, fmt.Errorf("line %d: %w", line, err)
+		}
+		imported++
+	}
+
+	return imported, scanner.Err()
+}
+
+// options returns the entry options recreating the exported entry.
+func (e jsonEntry) options(preserveLSN bool) []wal.EntryOption {
+	opts := []wal.EntryOption{
+		wal.WithStream(e.Stream),
+		wal.WithKey(e.Key),
+		wal.WithMetadata(e.Metadata),
+		wal.WithLabels(e.Labels),
+	}
+	if preserveLSN {
+		opts = append(opts, wal.WithSequenceNumber(e.LSN))
+	}
+	if e.Timestamp != nil {
+		opts = append(opts, wal.WithTimestamp(*e.Timestamp))
+	}
+	if e.HLC != 0 {
+		opts = append(opts, wal.WithHLC(wal.HLC(e.HLC)))
+	}
+	if e.Checkpoint {
+		opts = append(opts, wal.WithCheckpoint())
+	}
+	if e.Tombstone {
+		opts = append(opts, wal.WithTombstone())
+	}
+	if e.Schema != "" || e.SchemaVersion != 0 {
+		opts = append(opts, wal.WithSchema(e.Schema, e.SchemaVersion))
+	}
+	return opts
+}
+
+// checkNewDir returns an error unless dir doesn't exist or is empty.
+func checkNewDir(dir string) error {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("%s is not empty", dir)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Command gowal inspects and maintains the directories of goWAL write-ahead logs.
+//
+// Usage:
+//
+//	gowal <command> [flags] <dir>
+//
+// Run "gowal help" for the list of commands.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+// Exit codes of the commands.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the command ran, but found a problem (e.g. corruption)
+	exitError   = 2 // the command could not run (e.g. invalid usage)
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	verifyCommand,
+	repairCommand,
+	statsCommand,
+	truncateBeforeCommand,
+	compactCommand,
+	tailCommand,
+	exportCommand,
+	importCommand,
+	benchCommand,
+	cloneCommand,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return exitError
+		}
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+
+	fmt.Fprintf(stderr, "gowal: unknown command %q\n", args[0])
+	printUsage(stderr)
+	return exitError
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: gowal <command> [flags] <dir>\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\n", cmd.usage)
+	}
+}
+
+// newFlagSet returns a flag set for the named command that reports errors to stderr.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("gowal "+name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	return flags
+}
+
+// parseDirArgs parses the flags of a command taking a single directory argument.
+func parseDirArgs(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() != 1 {
+		return "", fmt.Errorf("expected a single WAL directory, got %d arguments", flags.NArg())
+	}
+	return flags.Arg(0), nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// openWAL opens an existing WAL for maintenance. The service using the WAL must be stopped.
+// Operations are recorded in the admin journal, so what was done can be reconstructed later.
+func openWAL(dir string) (*wal.WAL, error) {
+	// No entries are written, so the segment limits never apply.
+	return wal.OpenWAL(dir, true, math.MaxInt64, math.MaxInt,
+		wal.WithOpenMode(wal.MustExist), wal.WithAdminJournal())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+var repairCommand = command{
+	name:  "repair",
+	usage: "repair [--dry-run] [--backup] <dir>   truncate corrupted segments at their first corrupted entry",
+	run:   runRepair,
+}
+
+// runRepair repairs every segment of the WAL, printing what is (or would be) truncated.
+func runRepair(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("repair", stderr)
+	dryRun := flags.Bool("dry-run", false, "only print what would be truncated")
+	backup := flags.Bool("backup", false, "copy segments to the repair-backups directory before truncating them")
+	jsonOutput := flags.Bool("json", false, "print the report as JSON")
+	concurrency := flags.Int("concurrency", runtime.GOMAXPROCS(0), "number of segments repaired at once")
+	dir, err := parseDirArgs(flags, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal repair: %v\n", err)
+		return exitError
+	}
+
+	report, err := wal.RepairDir(dir, *dryRun, *backup, wal.WithRepairConcurrency(*concurrency))
+	if report != nil {
+		if *jsonOutput {
+			if err := writeJSON(stdout, report); err != nil {
+				fmt.Fprintf(stderr, "gowal repair: %v\n", err)
+				return exitError
+			}
+		} else {
+			printRepairReport(stdout, report)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal repair: %v\n", err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func printRepairReport(w io.Writer, report *wal.RepairReport) {
+	verb := "truncated"
+	if report.DryRun {
+		verb = "would truncate"
+	}
+
+	if len(report.Segments) == 0 {
+		fmt.Fprintf(w, "%s: no corruption found\n", report.Directory)
+	}
+	for _, segment := range report.Segments {
+		fmt.Fprintf(w, "%s: %s at offset %d, keeping %d entries and dropping %d bytes (%s)\n",
+			segment.Path, verb, segment.TruncatedAt, segment.EntriesKept, segment.Size-segment.TruncatedAt, segment.Reason)
+		if segment.Backup != "" {
+			fmt.Fprintf(w, "  backup: %s\n", segment.Backup)
+		}
+	}
+	if report.DryRun {
+		fmt.Fprintf(w, "dry run: no files were modified\n")
+	}
+}
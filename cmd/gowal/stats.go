@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+var statsCommand = command{
+	name:  "stats",
+	usage: "stats [--json] <dir>                  print the segment layout, LSN ranges, sizes and last checkpoint",
+	run:   runStats,
+}
+
+// runStats prints a description of the WAL directory as a table or as JSON.
+func runStats(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("stats", stderr)
+	jsonOutput := flags.Bool("json", false, "print the stats as JSON")
+	dir, err := parseDirArgs(flags, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal stats: %v\n", err)
+		return exitError
+	}
+
+	info, err := wal.InspectDir(dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal stats: %v\n", err)
+		return exitError
+	}
+
+	if *jsonOutput {
+		if err := writeJSON(stdout, info); err != nil {
+			fmt.Fprintf(stderr, "gowal stats: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	printDirInfo(stdout, info)
+	return exitOK
+}
+
+func printDirInfo(w io.Writer, info *wal.DirInfo) {
+	fmt.Fprintf(w, "directory:       %s\n", info.Directory)
+	fmt.Fprintf(w, "format version:  %d\n", info.FormatVersion)
+	fmt.Fprintf(w, "segments:        %d\n", len(info.Segments))
+	fmt.Fprintf(w, "total size:      %d bytes\n", info.TotalSize)
+	fmt.Fprintf(w, "entries:         %d\n", info.Entries)
+	fmt.Fprintf(w, "lsn range:       [%d, %d]\n", info.FirstSequenceNumber, info.LastSequenceNumber)
+	if info.LastCheckpoint != nil {
+		fmt.Fprintf(w, "last checkpoint: %d\n", info.LastCheckpoint.LogSequenceNumber)
+	} else {
+		fmt.Fprintf(w, "last checkpoint: none\n")
+	}
+	if len(info.ConsumerOffsets) > 0 {
+		consumers := make([]string, 0, len(info.ConsumerOffsets))
+		for consumer := range info.ConsumerOffsets {
+			consumers = append(consumers, consumer)
+		}
+		sort.Strings(consumers)
+		fmt.Fprintf(w, "consumers:\n")
+		for _, consumer := range consumers {
+			fmt.Fprintf(w, "  %s: %d\n", consumer, info.ConsumerOffsets[consumer])
+		}
+	}
+	if info.Corrupt {
+		fmt.Fprintf(w, "corrupt:         yes (run gowal verify for details)\n")
+	}
+	fmt.Fprintln(w)
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "INDEX\tSIZE\tENTRIES\tFIRST LSN\tLAST LSN\tSTATUS\n")
+	for _, segment := range info.Segments {
+		status := "ok"
+		if segment.Error != "" {
+			status = segment.Error
+		} else if len(segment.CorruptRanges) > 0 {
+			status = fmt.Sprintf("corrupt (%d ranges)", len(segment.CorruptRanges))
+		}
+		fmt.Fprintf(table, "%d\t%d\t%d\t%d\t%d\t%s\n", segment.Index, segment.Size, segment.Entries,
+			segment.FirstSequenceNumber, segment.LastSequenceNumber, status)
+	}
+	table.Flush()
+}
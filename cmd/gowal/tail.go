@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"plugin"
+	"strconv"
+	"strings"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+var tailCommand = command{
+	name:  "tail",
+	usage: "tail [-f] [--from-lsn N] <dir>        print entries, following new ones with -f",
+	run:   runTail,
+}
+
+// payloadDecoders format the payload of an entry for the --decode flag.
+var payloadDecoders = map[string]func([]byte) string{
+	"text":   func(data []byte) string { return strconv.Quote(string(data)) },
+	"hex":    hex.EncodeToString,
+	"base64": base64.StdEncoding.EncodeToString,
+	"json": func(data []byte) string {
+		if json.Valid(data) {
+			return string(data)
+		}
+		return strconv.Quote(string(data))
+	},
+}
+
+// runTail prints the entries of the WAL, one per line, and with -f keeps printing new entries
+// until interrupted.
+func runTail(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("tail", stderr)
+	follow := flags.Bool("f", false, "keep printing entries as they are written")
+	fromLSN := flags.Uint64("from-lsn", 0, "first sequence number to print")
+	decode := flags.String("decode", "text", "how to print payloads: text, hex, base64 or json")
+	interval := flags.Duration("interval", 200*time.Millisecond, "how often to poll for new entries with -f")
+	var plugins stringsFlag
+	flags.Var(&plugins, "plugin", "Go plugin registering payload decoders with wal.RegisterDecoder; may be repeated")
+	dir, err := parseDirArgs(flags, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal tail: %v\n", err)
+		return exitError
+	}
+	decodePayload, ok := payloadDecoders[*decode]
+	if !ok {
+		fmt.Fprintf(stderr, "gowal tail: unknown --decode %q\n", *decode)
+		return exitError
+	}
+
+	for _, path := range plugins {
+		// The plugin registers its decoders when it is initialized.
+		if _, err := plugin.Open(path); err != nil {
+			fmt.Fprintf(stderr, "gowal tail: %v\n", err)
+			return exitError
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err = wal.TailDir(ctx, dir, *fromLSN, *follow, func(entry *wal.WAL_Entry) error {
+		_, err := fmt.Fprintln(stdout, formatEntry(entry, decodePayload))
+		return err
+	}, wal.WithSyncInterval(*interval))
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(stderr, "gowal tail: %v\n", err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+// formatEntry formats an entry as a single line of space separated fields.
+func formatEntry(entry *wal.WAL_Entry, decodePayload func([]byte) string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "lsn=%d", entry.GetLogSequenceNumber())
+	if t := entry.Time(); !t.IsZero() {
+		fmt.Fprintf(&b, " time=%s", t.Format(time.RFC3339Nano))
+	}
+	if entry.GetIsCheckpoint() {
+		b.WriteString(" checkpoint")
+	}
+	if stream := entry.GetStream(); stream != "" {
+		fmt.Fprintf(&b, " stream=%s", strconv.Quote(stream))
+	}
+	if key := entry.GetKey(); len(key) > 0 {
+		fmt.Fprintf(&b, " key=%s", decodePayload(key))
+	}
+	if entry.GetTombstone() {
+		b.WriteString(" tombstone")
+	}
+	if schema := entry.GetSchema(); schema != "" {
+		fmt.Fprintf(&b, " schema=%s/v%d", strconv.Quote(schema), entry.GetSchemaVersion())
+	}
+
+	// Decoders registered for the stream take precedence over --decode.
+	text, ok, err := wal.DecodeEntry(entry)
+	switch {
+	case ok && err == nil:
+		fmt.Fprintf(&b, " data=%s", strconv.Quote(text))
+	case ok:
+		fmt.Fprintf(&b, " decode_error=%s data=%s", strconv.Quote(err.Error()), decodePayload(entry.GetData()))
+	default:
+		fmt.Fprintf(&b, " data=%s", decodePayload(entry.GetData()))
+	}
+	return b.String()
+}
+
+// stringsFlag is a flag that may be repeated, collecting its values.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
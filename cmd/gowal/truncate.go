@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+var truncateBeforeCommand = command{
+	name:  "truncate-before",
+	usage: "truncate-before --lsn N <dir>         delete the segments holding only entries before sequence number N",
+	run:   runTruncateBefore,
+}
+
+// runTruncateBefore deletes the oldest segments of a stopped WAL up to the given sequence number.
+func runTruncateBefore(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("truncate-before", stderr)
+	lsn := flags.Uint64("lsn", 0, "first sequence number to keep")
+	dir, err := parseDirArgs(flags, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal truncate-before: %v\n", err)
+		return exitError
+	}
+	if *lsn == 0 {
+		fmt.Fprintf(stderr, "gowal truncate-before: --lsn is required\n")
+		return exitError
+	}
+
+	walog, err := openWAL(dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal truncate-before: %v\n", err)
+		return exitError
+	}
+	defer walog.Close()
+
+	deleted, err := walog.TruncateBefore(*lsn)
+	fmt.Fprintf(stdout, "%s: deleted %d segments before sequence number %d\n", dir, deleted, *lsn)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal truncate-before: %v\n", err)
+		return exitFailure
+	}
+
+	return exitOK
+}
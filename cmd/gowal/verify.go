@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+var verifyCommand = command{
+	name:  "verify",
+	usage: "verify <dir>                          check the framing and CRC of every entry, print a JSON report",
+	run:   runVerify,
+}
+
+// runVerify prints a JSON report of the corrupt ranges of the WAL and exits with exitFailure if there are any.
+func runVerify(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("verify", stderr)
+	dir, err := parseDirArgs(flags, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal verify: %v\n", err)
+		return exitError
+	}
+
+	report, err := wal.Verify(dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "gowal verify: %v\n", err)
+		return exitError
+	}
+
+	if err := writeJSON(stdout, report); err != nil {
+		fmt.Fprintf(stderr, "gowal verify: %v\n", err)
+		return exitError
+	}
+
+	if report.Corrupt {
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,147 @@
+// Command gowald serves a WAL as a durable log service, so that clients that aren't written in Go,
+// or sidecars, can append to and read from a goWAL log.
+//
+// Usage:
+//
+//	gowald [flags] <dir>
+//
+// It serves the Log service of the walservice package, and the Replication service for followers,
+// over gRPC, and the HTTP handler of walservice, which includes the operational endpoints of the WAL.
+// Followers that fell behind the retention of the log are caught up from its last checkpoint.
+// It stops on SIGINT or SIGTERM, closing the WAL once the in-flight writes are done.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/replication"
+	"github.com/ashwaniYDV/goWAL/walservice"
+	"google.golang.org/grpc"
+)
+
+// Exit codes of the command.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the server failed
+	exitError   = 2 // invalid usage
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gowald", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	grpcAddr := flags.String("grpc", ":7070", "address of the gRPC server, empty to disable it")
+	httpAddr := flags.String("http", ":7071", "address of the HTTP server, empty to disable it")
+	fsync := flags.Bool("fsync", true, "fsync the segment files when the log is synced")
+	maxSegmentSize := flags.Int64("max-segment-size", 64<<20, "maximum size of a segment file in bytes")
+	maxSegments := flags.Int("max-segments", 16, "maximum number of segment files to keep")
+	syncInterval := flags.Duration("sync-interval", 200*time.Millisecond, "interval of the background sync")
+	serverID := flags.String("server-id", "", "ID of the replication server, embedded in its resume tokens")
+	entryCache := flags.Int("entry-cache", 0, "number of recently read entries kept decoded in memory, 0 to disable the cache")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(stderr, "gowald: expected a single WAL directory, got %d arguments\n", flags.NArg())
+		return exitError
+	}
+	if *grpcAddr == "" && *httpAddr == "" {
+		fmt.Fprintln(stderr, "gowald: at least one of --grpc and --http must be set")
+		return exitError
+	}
+
+	walog, err := wal.OpenWAL(flags.Arg(0), *fsync, *maxSegmentSize, *maxSegments, wal.WithSyncInterval(*syncInterval),
+		wal.WithEntryCache(*entryCache))
+	if err != nil {
+		fmt.Fprintf(stderr, "gowald: %v\n", err)
+		return exitFailure
+	}
+	if err := serve(ctx, walog, *grpcAddr, *httpAddr, *serverID); err != nil {
+		fmt.Fprintf(stderr, "gowald: %v\n", err)
+		walog.Close()
+		return exitFailure
+	}
+	if err := walog.Close(); err != nil {
+		fmt.Fprintf(stderr, "gowald: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// serve serves the WAL until ctx is done or a server fails, then stops the servers gracefully.
+func serve(ctx context.Context, walog *wal.WAL, grpcAddr, httpAddr, serverID string) error {
+	server := walservice.NewServer(walog)
+	errs := make(chan error, 2)
+
+	var grpcServer *grpc.Server
+	if grpcAddr != "" {
+		listener, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			return err
+		}
+		grpcServer = grpc.NewServer()
+		walservice.RegisterLogServer(grpcServer, server)
+		replication.RegisterReplicationServer(grpcServer, replication.NewServer(walog,
+			replication.WithServerID(serverID), replication.WithSnapshots(replication.CheckpointSnapshots(walog))))
+		log.Printf("Serving gRPC on %s", listener.Addr())
+		go func() { errs <- grpcServer.Serve(listener) }()
+	}
+
+	var httpServer *http.Server
+	if httpAddr != "" {
+		listener, err := net.Listen("tcp", httpAddr)
+		if err != nil {
+			if grpcServer != nil {
+				grpcServer.Stop()
+			}
+			return err
+		}
+		// Tails are streamed until the request is canceled, so they end with the base context.
+		baseCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		httpServer = &http.Server{Handler: server.Handler(), BaseContext: func(net.Listener) context.Context { return baseCtx }}
+		httpServer.RegisterOnShutdown(cancel)
+		log.Printf("Serving HTTP on %s", listener.Addr())
+		go func() { errs <- httpServer.Serve(listener) }()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+
+	log.Printf("Shutting down")
+	if httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if shutdownErr := httpServer.Shutdown(shutdownCtx); err == nil {
+			err = shutdownErr
+		}
+	}
+	if grpcServer != nil {
+		// Tail streams only end when their client cancels them.
+		grpcServer.Stop()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
@@ -0,0 +1,382 @@
+package wal
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// TruncateBefore deletes the oldest segments as long as all their entries have a sequence number
+// lower than lsn, reclaiming the space of entries that are no longer needed (for instance because
+// they are covered by a snapshot). Truncation has segment granularity: entries before lsn that share
+// a segment with later entries are kept. The current segment is never deleted.
+// It returns the number of deleted segments.
+func (wal *WAL) TruncateBefore(lsn uint64) (deleted int, err error) {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	defer func() {
+		wal.recordAdmin(AdminOpTruncateBefore, wal.directory,
+			fmt.Sprintf("lsn %d, deleted %d segments", lsn, deleted), err)
+	}()
+
+	if err := wal.checkLease(); err != nil {
+		return 0, err
+	}
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, segment := range segments {
+		if segment.index >= wal.currentSegmentIndex {
+			break
+		}
+
+		state := wal.segmentState(segment)
+		if state.Error != "" {
+			return deleted, fmt.Errorf("could not read %s: %s", segment.path, state.Error)
+		}
+		if state.Entries > 0 && state.LastSequenceNumber >= lsn {
+			break
+		}
+
+		if err := wal.fs.Remove(segment.path); err != nil {
+			return deleted, err
+		}
+		delete(wal.segmentEntries, segment.path)
+		deleted++
+
+		if wal.budget != nil {
+			wal.budget.release(state.Size)
+		}
+		if wal.entryCache != nil && state.Entries > 0 {
+			wal.entryCache.evictBefore(state.LastSequenceNumber + 1)
+		}
+		wal.logEvent(slog.LevelInfo, EventSegmentDeleted,
+			slog.String("path", segment.path),
+			slog.Int64("size", state.Size),
+			slog.String("reason", "truncate before "+strconv.FormatUint(lsn, 10)))
+		if wal.hooks.OnSegmentDelete != nil {
+			wal.hooks.OnSegmentDelete(segment.path)
+		}
+	}
+
+	return deleted, nil
+}
+
+// TruncateAfter deletes every entry with a sequence number greater than lsn, for instance to discard
+// uncommitted entries that conflict with those of a new leader. Segments containing only such entries
+// are deleted and the segment containing lsn is rewritten, so the next entry written gets sequence
+// number lsn+1 (or the requested one, see WithSequenceNumber). Checkpoints after lsn are forgotten.
+// It returns the number of deleted entries.
+func (wal *WAL) TruncateAfter(lsn uint64) (deleted int, err error) {
+	if !wal.beginWrite() {
+		return 0, ErrClosed
+	}
+	defer wal.writers.Done()
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	defer func() {
+		wal.recordAdmin(AdminOpTruncateAfter, wal.directory,
+			fmt.Sprintf("lsn %d, deleted %d entries", lsn, deleted), err)
+	}()
+
+	if lsn >= wal.lastSequenceNo {
+		return 0, nil
+	}
+	if err := wal.sync(); err != nil {
+		return 0, err
+	}
+
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return 0, err
+	}
+	if err := wal.currentSegment.Close(); err != nil {
+		return 0, err
+	}
+
+	// Walk back from the newest segment until one that keeps entries; the oldest segment is always kept
+	// so that the WAL has a segment to write to.
+	current := segments[0]
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		entries, err := wal.readSegmentFile(segment.path)
+		if err != nil {
+			return deleted, err
+		}
+
+		kept := entries
+		for len(kept) > 0 && kept[len(kept)-1].GetLogSequenceNumber() > lsn {
+			kept = kept[:len(kept)-1]
+		}
+		deleted += len(entries) - len(kept)
+
+		if len(kept) == 0 && i > 0 {
+			if err := wal.removeSegment(segment.path, "truncate after "+strconv.FormatUint(lsn, 10)); err != nil {
+				return deleted, err
+			}
+			continue
+		}
+		if len(kept) != len(entries) {
+			if err := wal.rewriteSegmentFile(segment.path, kept); err != nil {
+				return deleted, fmt.Errorf("could not rewrite %s: %w", segment.path, err)
+			}
+		}
+		current = segment
+		break
+	}
+
+	file, err := wal.fs.OpenFile(current.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return deleted, err
+	}
+	wal.currentSegment = file
+	wal.currentSegmentIndex = current.index
+	wal.setSegmentWriter(file)
+	wal.writebackFlushed = wal.stats.FlushedBytes
+	if wal.lastSequenceNo, err = wal.getLastSequenceNo(); err != nil {
+		return deleted, err
+	}
+	wal.resetSynced()
+	if err := wal.openCurrentSegment(); err != nil {
+		return deleted, err
+	}
+	if wal.segmentEnd == 0 {
+		if err := wal.startSegment(); err != nil {
+			return deleted, err
+		}
+	}
+
+	kept := wal.checkpoints
+	for len(kept) > 0 && kept[len(kept)-1].GetLogSequenceNumber() > lsn {
+		kept = kept[:len(kept)-1]
+	}
+	if len(kept) != len(wal.checkpoints) {
+		if err := wal.writeCheckpoints(kept); err != nil {
+			return deleted, fmt.Errorf("could not update checkpoint file: %w", err)
+		}
+	}
+
+	return deleted, nil
+}
+
+// removeSegment deletes the segment file at path, returning its space to the byte budget.
+func (wal *WAL) removeSegment(path, reason string) error {
+	var size int64
+	if fileInfo, err := wal.fs.Stat(path); err == nil {
+		size = fileInfo.Size()
+	}
+	if err := wal.fs.Remove(path); err != nil {
+		return err
+	}
+
+	delete(wal.segmentEntries, path)
+	if wal.entryCache != nil {
+		wal.entryCache.clear()
+	}
+	if wal.budget != nil {
+		wal.budget.release(size)
+	}
+	wal.logEvent(slog.LevelInfo, EventSegmentDeleted,
+		slog.String("path", path),
+		slog.Int64("size", size),
+		slog.String("reason", reason))
+	if wal.hooks.OnSegmentDelete != nil {
+		wal.hooks.OnSegmentDelete(path)
+	}
+	return nil
+}
+
+// Compact rewrites the segments other than the current one, dropping every entry with a key (see WithKey)
+// that is superseded by a later entry with the same stream and key. Entries without a key and checkpoints
+// are always kept, and the sequence numbers of the kept entries don't change.
+//
+// A tombstone (see WithTombstone) that is the latest version of its key is dropped too, since the earlier
+// versions it deletes are, once it is safe: when every consumer has committed an offset past it (see
+// CommitOffset), and the oldest snapshot of the SnapshotStore, if any, includes it. Readers replaying the
+// log from elsewhere must commit an offset to keep the tombstones they haven't read yet.
+// Writes are blocked while the log is scanned and rewritten. With WithValueLog, the value log files no
+// entry references anymore are deleted afterwards, see CollectValueLog.
+// It returns the number of entries dropped.
+func (wal *WAL) Compact() (dropped int, err error) {
+	if !wal.beginWrite() {
+		return 0, ErrClosed
+	}
+	defer wal.writers.Done()
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	defer func() {
+		wal.recordAdmin(AdminOpCompact, wal.directory, fmt.Sprintf("dropped %d entries", dropped), err)
+	}()
+
+	// A writer that lost its lease must not rewrite the segments of the new holder.
+	if err := wal.checkLease(); err != nil {
+		return 0, err
+	}
+
+	// Buffered entries may supersede entries of older segments.
+	if err := wal.flush(); err != nil {
+		return 0, err
+	}
+
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return 0, err
+	}
+
+	// Tombstones up to the horizon have been read by every consumer, and are included in every snapshot.
+	horizon := uint64(math.MaxUint64)
+	for _, offset := range wal.consumerOffsets {
+		horizon = min(horizon, offset)
+	}
+	snapshots, err := listSnapshots(wal.fs, filepath.Join(wal.directory, snapshotDirName))
+	if err != nil {
+		return 0, err
+	}
+	if len(snapshots) > 0 {
+		horizon = min(horizon, snapshots[0].lsn)
+	}
+
+	// Find the sequence number of the latest version of every key.
+	latest := make(map[string]uint64)
+	segmentEntries := make([][]*WAL_Entry, len(segments))
+	for i, segment := range segments {
+		entries, err := wal.readSegmentFile(segment.path)
+		if err != nil {
+			return 0, err
+		}
+		segmentEntries[i] = entries
+
+		for _, entry := range entries {
+			if key, ok := compactionKey(entry); ok {
+				latest[key] = entry.GetLogSequenceNumber()
+			}
+		}
+	}
+
+	for i, segment := range segments {
+		if segment.index >= wal.currentSegmentIndex {
+			break
+		}
+
+		kept := make([]*WAL_Entry, 0, len(segmentEntries[i]))
+		for _, entry := range segmentEntries[i] {
+			key, ok := compactionKey(entry)
+			if ok && !entry.GetIsCheckpoint() && latest[key] != entry.GetLogSequenceNumber() {
+				continue
+			}
+			// The earlier versions are in this segment or older ones, so they are dropped already.
+			if ok && entry.GetTombstone() && entry.GetLogSequenceNumber() <= horizon {
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		if len(kept) == len(segmentEntries[i]) {
+			continue
+		}
+
+		if err := wal.rewriteSegmentFile(segment.path, kept); err != nil {
+			return dropped, fmt.Errorf("could not rewrite %s: %w", segment.path, err)
+		}
+		dropped += len(segmentEntries[i]) - len(kept)
+	}
+
+	// The values of the dropped entries are reclaimed with the value log files no entry references anymore.
+	if _, err := wal.collectValueLog(); err != nil {
+		return dropped, fmt.Errorf("could not collect the value log: %w", err)
+	}
+	return dropped, nil
+}
+
+// compactionKey returns the key identifying the versions of the entry, if it has a key.
+func compactionKey(entry *WAL_Entry) (string, bool) {
+	if len(entry.GetKey()) == 0 {
+		return "", false
+	}
+	return entry.GetStream() + "\x00" + string(entry.GetKey()), true
+}
+
+// readSegmentFile reads all entries of the segment file at path.
+func (wal *WAL) readSegmentFile(path string) ([]*WAL_Entry, error) {
+	file, err := wal.fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := getSegmentReader(file, wal.readBufferSize)
+	defer putSegmentReader(reader)
+	entries, _, err := readSegmentEntries(reader, false, 0)
+	if err != nil {
+		wal.flagCorruption("read", path, err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// rewriteSegmentFile atomically replaces the segment file at path with the given entries.
+// The caller must hold wal.lock.
+func (wal *WAL) rewriteSegmentFile(path string, entries []*WAL_Entry) error {
+	tempFilePath := fmt.Sprintf("%s.tmp", path)
+	tempFile, err := wal.fs.OpenFile(tempFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	var oldSize int64
+	if fileInfo, err := wal.fs.Stat(path); err == nil {
+		oldSize = fileInfo.Size()
+	}
+	// The segment keeps its format, as its entries are checksummed with the checksum of the segment.
+	format, err := readSegmentFormat(wal.fs, path)
+	if err != nil && err != io.EOF {
+		tempFile.Close()
+		return err
+	}
+
+	buf := getEntryBuffer()
+	defer putEntryBuffer(buf)
+	*buf = appendSegmentHeader((*buf)[:0], format)
+	if _, err := tempFile.Write(*buf); err != nil {
+		tempFile.Close()
+		return err
+	}
+	written := int64(len(*buf))
+	for _, entry := range entries {
+		*buf = appendEncodedFrame((*buf)[:0], entry, format.encoding)
+		if _, err := tempFile.Write(*buf); err != nil {
+			tempFile.Close()
+			return err
+		}
+		written += int64(len(*buf))
+	}
+
+	// The new segment must be durable before it replaces the previous one.
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	if err := wal.fs.Rename(tempFilePath, path); err != nil {
+		return err
+	}
+
+	wal.stats.PhysicalBytesWritten += uint64(written)
+	wal.segmentEntries[path] = len(entries)
+	if wal.entryCache != nil {
+		wal.entryCache.clear()
+	}
+	if wal.budget != nil && oldSize > written {
+		wal.budget.release(oldSize - written)
+	}
+	return nil
+}
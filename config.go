@@ -0,0 +1,163 @@
+package wal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Config holds the settings of a WAL that can be changed without reopening it, see ReloadConfig.
+// Zero values (and nil pointers) leave the corresponding setting unchanged.
+type Config struct {
+	// SyncInterval is how often the background goroutine flushes or syncs the buffer.
+	SyncInterval time.Duration
+	// EnableFsync enables fsync on the segment file every time the log syncs.
+	EnableFsync *bool
+	// MaxFileSize is the maximum size of a log segment file in bytes.
+	MaxFileSize int64
+	// MaxSegments is the maximum number of log segment files to keep.
+	// Lowering it takes effect gradually, one segment is deleted per rotation.
+	MaxSegments int
+	// CheckpointRetention is how many of the most recent checkpoints are kept.
+	// Lowering it takes effect when the next checkpoint is created.
+	CheckpointRetention int
+}
+
+// Config returns the current values of the reloadable settings.
+func (wal *WAL) Config() Config {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	enableFsync := wal.shouldFsync
+	return Config{
+		SyncInterval:        wal.syncInterval,
+		EnableFsync:         &enableFsync,
+		MaxFileSize:         wal.maxFileSize,
+		MaxSegments:         wal.maxSegments,
+		CheckpointRetention: wal.checkpointRetention,
+	}
+}
+
+// ReloadConfig applies the non-zero settings in cfg to the live WAL.
+// A new sync interval takes effect right away: the next periodic sync is an interval after the reload.
+func (wal *WAL) ReloadConfig(cfg Config) error {
+	if cfg.SyncInterval < 0 || cfg.MaxFileSize < 0 || cfg.MaxSegments < 0 || cfg.CheckpointRetention < 0 {
+		return fmt.Errorf("invalid config, values must not be negative: %+v", cfg)
+	}
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if cfg.SyncInterval > 0 && cfg.SyncInterval != wal.syncInterval {
+		wal.syncInterval = cfg.SyncInterval
+		select {
+		case wal.syncIntervalChanged <- struct{}{}:
+		default:
+		}
+	}
+	if cfg.EnableFsync != nil {
+		wal.shouldFsync = *cfg.EnableFsync
+	}
+	if cfg.MaxFileSize > 0 {
+		wal.maxFileSize = cfg.MaxFileSize
+	}
+	if cfg.MaxSegments > 0 {
+		wal.maxSegments = cfg.MaxSegments
+	}
+	if cfg.CheckpointRetention > 0 {
+		wal.checkpointRetention = cfg.CheckpointRetention
+	}
+
+	return nil
+}
+
+// configFile is the JSON representation of Config read by LoadConfigFile.
+type configFile struct {
+	SyncInterval        string `json:"sync_interval"`
+	EnableFsync         *bool  `json:"enable_fsync"`
+	MaxFileSize         int64  `json:"max_file_size"`
+	MaxSegments         int    `json:"max_segments"`
+	CheckpointRetention int    `json:"checkpoint_retention"`
+}
+
+// LoadConfigFile reads a Config from a JSON file such as
+//
+//	{"sync_interval": "500ms", "enable_fsync": true, "max_segments": 10}
+//
+// Settings missing from the file are left zero, and therefore unchanged by ReloadConfig.
+func LoadConfigFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var file configFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return Config{}, fmt.Errorf("could not parse config file %s: %v", path, err)
+	}
+
+	cfg := Config{
+		EnableFsync:         file.EnableFsync,
+		MaxFileSize:         file.MaxFileSize,
+		MaxSegments:         file.MaxSegments,
+		CheckpointRetention: file.CheckpointRetention,
+	}
+	if file.SyncInterval != "" {
+		if cfg.SyncInterval, err = time.ParseDuration(file.SyncInterval); err != nil {
+			return Config{}, fmt.Errorf("could not parse sync_interval in config file %s: %v", path, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// WatchConfig calls source every interval and applies the returned Config with ReloadConfig,
+// until ctx is done. Errors are logged and the previous settings are kept.
+func (wal *WAL) WatchConfig(ctx context.Context, interval time.Duration, source func() (Config, error)) {
+	timer := wal.clock.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C():
+			timer.Reset(interval)
+
+			cfg, err := source()
+			if err == nil {
+				err = wal.ReloadConfig(cfg)
+			}
+			if err != nil {
+				log.Printf("Error while reloading config: %v", err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// WatchConfigFile polls the config file at path every interval and reloads it
+// with ReloadConfig whenever its modification time changes, until ctx is done.
+// It is meant to be run in its own goroutine by long-lived daemons.
+func (wal *WAL) WatchConfigFile(ctx context.Context, path string, interval time.Duration) {
+	var lastModified time.Time
+	wal.WatchConfig(ctx, interval, func() (Config, error) {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return Config{}, err
+		}
+		if fileInfo.ModTime().Equal(lastModified) {
+			return Config{}, nil
+		}
+
+		cfg, err := LoadConfigFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		lastModified = fileInfo.ModTime()
+		return cfg, nil
+	})
+}
@@ -0,0 +1,126 @@
+package wal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// consumerOffsetsFileName is the side-file next to the segments that records the offsets
+// committed by consumers of the log.
+const consumerOffsetsFileName = "consumer-offsets"
+
+// CommitOffset records that the named consumer has processed all entries up to and including
+// logSequenceNumber. Offsets are stored durably in a side-file, so consumers can resume from
+// ConsumerOffset after a restart. An offset may be moved backwards to replay entries.
+func (wal *WAL) CommitOffset(consumer string, logSequenceNumber uint64) error {
+	if consumer == "" {
+		return errors.New("consumer name must not be empty")
+	}
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if logSequenceNumber > wal.lastSequenceNo {
+		return fmt.Errorf("offset %d is beyond the last sequence number %d", logSequenceNumber, wal.lastSequenceNo)
+	}
+
+	offsets := make(map[string]uint64, len(wal.consumerOffsets)+1)
+	for name, offset := range wal.consumerOffsets {
+		offsets[name] = offset
+	}
+	offsets[consumer] = logSequenceNumber
+
+	if err := wal.saveConsumerOffsets(offsets); err != nil {
+		return fmt.Errorf("could not commit offset, error while saving consumer offsets file: %w", err)
+	}
+	return nil
+}
+
+// ConsumerOffset returns the last offset committed by the named consumer,
+// or 0 if it hasn't committed any.
+func (wal *WAL) ConsumerOffset(consumer string) uint64 {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	return wal.consumerOffsets[consumer]
+}
+
+// DeleteConsumer removes the offset of the named consumer, so that it no longer shows up in Stats.
+func (wal *WAL) DeleteConsumer(consumer string) error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if _, ok := wal.consumerOffsets[consumer]; !ok {
+		return nil
+	}
+
+	offsets := make(map[string]uint64, len(wal.consumerOffsets))
+	for name, offset := range wal.consumerOffsets {
+		if name != consumer {
+			offsets[name] = offset
+		}
+	}
+
+	return wal.saveConsumerOffsets(offsets)
+}
+
+// loadConsumerOffsets reads the offsets recorded in the consumer offsets side-file, if present.
+func loadConsumerOffsets(fs FS, directory string) (map[string]uint64, error) {
+	file, err := fs.OpenFile(filepath.Join(directory, consumerOffsetsFileName), os.O_RDONLY, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var offsets map[string]uint64
+	if err := json.NewDecoder(file).Decode(&offsets); err != nil {
+		return nil, fmt.Errorf("could not read consumer offsets file: %v", err)
+	}
+
+	return offsets, nil
+}
+
+// saveConsumerOffsets atomically replaces the consumer offsets side-file with the given offsets.
+// The caller must hold wal.lock.
+func (wal *WAL) saveConsumerOffsets(offsets map[string]uint64) error {
+	filePath := filepath.Join(wal.directory, consumerOffsetsFileName)
+	tempFilePath := fmt.Sprintf("%s.tmp", filePath)
+
+	tempFile, err := wal.fs.OpenFile(tempFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(offsets)
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	wal.stats.PhysicalBytesWritten += uint64(len(data))
+
+	// The side-file must be durable before it replaces the previous one.
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	if err := wal.fs.Rename(tempFilePath, filePath); err != nil {
+		return err
+	}
+
+	wal.consumerOffsets = offsets
+	return nil
+}
@@ -0,0 +1,130 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrInvalidEntry is returned when an entry read from the log cannot be unmarshaled.
+var ErrInvalidEntry = errors.New("invalid entry: could not unmarshal")
+
+// CorruptionKind classifies corrupted data found in the log.
+type CorruptionKind int
+
+const (
+	// CorruptionChecksum means an entry's CRC doesn't match its contents.
+	CorruptionChecksum CorruptionKind = iota
+	// CorruptionInvalidEntry means an entry could not be unmarshaled.
+	CorruptionInvalidEntry
+	// CorruptionTruncated means the log ends in the middle of an entry.
+	CorruptionTruncated
+)
+
+func (k CorruptionKind) String() string {
+	switch k {
+	case CorruptionChecksum:
+		return "CRC mismatch"
+	case CorruptionInvalidEntry:
+		return "invalid entry"
+	case CorruptionTruncated:
+		return "truncated entry"
+	default:
+		return fmt.Sprintf("CorruptionKind(%d)", int(k))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k CorruptionKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *CorruptionKind) UnmarshalText(text []byte) error {
+	for _, kind := range []CorruptionKind{CorruptionChecksum, CorruptionInvalidEntry, CorruptionTruncated} {
+		if kind.String() == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown corruption kind %q", text)
+}
+
+// CorruptionEvent describes corrupted data found in the log, see Hooks.OnCorruptionDetected.
+type CorruptionEvent struct {
+	Kind CorruptionKind
+	// Operation is the operation that found the corruption, "read" or "repair".
+	Operation string
+	// Path is the path of the segment file.
+	Path string
+	// Offset is the byte offset in the segment file of the corrupted entry.
+	Offset int64
+	Err    error
+}
+
+// entryError is returned when reading an entry fails, recording where the entry starts.
+type entryError struct {
+	offset int64
+	err    error
+}
+
+func (e *entryError) Error() string {
+	return fmt.Sprintf("entry at offset %d: %v", e.offset, e.err)
+}
+
+func (e *entryError) Unwrap() error {
+	return e.err
+}
+
+// corruptionKind classifies err, returning false if it doesn't indicate corrupted data.
+func corruptionKind(err error) (CorruptionKind, bool) {
+	switch {
+	case errors.Is(err, ErrCorruptEntry):
+		return CorruptionChecksum, true
+	case errors.Is(err, ErrInvalidEntry):
+		return CorruptionInvalidEntry, true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return CorruptionTruncated, true
+	default:
+		return 0, false
+	}
+}
+
+// flagCorruption records err if it indicates corrupted data in the segment at path,
+// found by the given operation.
+func (wal *WAL) flagCorruption(operation, path string, err error) {
+	kind, ok := corruptionKind(err)
+	if !ok {
+		return
+	}
+
+	event := CorruptionEvent{Kind: kind, Operation: operation, Path: path, Offset: -1, Err: err}
+	var entryErr *entryError
+	if errors.As(err, &entryErr) {
+		event.Offset = entryErr.offset
+	}
+
+	wal.corruptionLock.Lock()
+	wal.corruptionErr = err
+	wal.corruptionEvents++
+	switch kind {
+	case CorruptionChecksum:
+		wal.checksumFailures++
+	case CorruptionInvalidEntry:
+		wal.unmarshalFailures++
+	case CorruptionTruncated:
+		wal.truncations++
+	}
+	wal.corruptionLock.Unlock()
+
+	if wal.hooks.OnCorruptionDetected != nil {
+		wal.hooks.OnCorruptionDetected(event)
+	}
+	wal.notifyWebhooks(WebhookPayload{Event: WebhookEventCorruption, Corruption: &WebhookCorruption{
+		Kind:      kind,
+		Operation: operation,
+		Path:      path,
+		Offset:    event.Offset,
+		Error:     err.Error(),
+	}})
+}
@@ -0,0 +1,8 @@
+package wal
+
+import "golang.org/x/sys/unix"
+
+// datasyncFd commits the data of the file to stable storage with fdatasync.
+func datasyncFd(fd uintptr) error {
+	return unix.Fdatasync(int(fd))
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package wal
+
+import "errors"
+
+// datasyncFd is not supported on this platform.
+func datasyncFd(fd uintptr) error {
+	return errors.ErrUnsupported
+}
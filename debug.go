@@ -0,0 +1,136 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DebugState describes the internal state of a WAL, for inclusion in bug reports and support bundles.
+type DebugState struct {
+	Directory           string         `json:"directory"`
+	CurrentSegmentIndex int            `json:"current_segment_index"`
+	LastSequenceNumber  uint64         `json:"last_sequence_number"`
+	Segments            []SegmentState `json:"segments"`
+	BufferedBytes       int            `json:"buffered_bytes"`
+	BufferCapacity      int            `json:"buffer_capacity"`
+	Checkpoints         []uint64       `json:"checkpoints,omitempty"`
+	Closed              bool           `json:"closed"`
+	LastSyncError       string         `json:"last_sync_error,omitempty"`
+	CorruptionError     string         `json:"corruption_error,omitempty"`
+}
+
+// SegmentState describes a single log segment file.
+type SegmentState struct {
+	Index               int    `json:"index"`
+	Path                string `json:"path"`
+	Size                int64  `json:"size"`
+	Entries             int    `json:"entries"`
+	FirstSequenceNumber uint64 `json:"first_sequence_number"`
+	LastSequenceNumber  uint64 `json:"last_sequence_number"`
+	// Error is set if the segment could not be fully read.
+	Error string `json:"error,omitempty"`
+}
+
+// DebugState returns a description of the WAL's segment layout, LSN ranges,
+// buffer occupancy and pending errors. It is safe to call concurrently with writes;
+// segments are scanned without holding the write lock, so entries that are still
+// buffered are not reflected in the segment LSN ranges.
+func (wal *WAL) DebugState() DebugState {
+	wal.lock.Lock()
+	state := DebugState{
+		Directory:           wal.directory,
+		CurrentSegmentIndex: wal.currentSegmentIndex,
+		LastSequenceNumber:  wal.lastSequenceNo,
+		BufferedBytes:       wal.bufWriter.Buffered(),
+		BufferCapacity:      wal.bufWriter.Size(),
+	}
+	if wal.lastSyncErr != nil {
+		state.LastSyncError = wal.lastSyncErr.Error()
+	}
+	for _, checkpoint := range wal.checkpoints {
+		state.Checkpoints = append(state.Checkpoints, checkpoint.GetLogSequenceNumber())
+	}
+	wal.lock.Unlock()
+
+	wal.closeLock.Lock()
+	state.Closed = wal.closed
+	wal.closeLock.Unlock()
+
+	wal.corruptionLock.Lock()
+	if wal.corruptionErr != nil {
+		state.CorruptionError = wal.corruptionErr.Error()
+	}
+	wal.corruptionLock.Unlock()
+
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		state.Segments = []SegmentState{{Index: -1, Error: err.Error()}}
+		return state
+	}
+
+	for _, segment := range segments {
+		state.Segments = append(state.Segments, wal.segmentState(segment))
+	}
+
+	return state
+}
+
+func (wal *WAL) segmentState(segment segmentFile) SegmentState {
+	state := SegmentState{Index: segment.index, Path: segment.path}
+
+	file, err := wal.fs.OpenFile(segment.path, os.O_RDONLY, 0644)
+	if err != nil {
+		state.Error = err.Error()
+		return state
+	}
+	defer file.Close()
+
+	if fileInfo, err := file.Stat(); err == nil {
+		state.Size = fileInfo.Size()
+	}
+
+	reader := getSegmentReader(file, wal.readBufferSize)
+	defer putSegmentReader(reader)
+	entries, _, err := readSegmentEntries(reader, false, 0)
+	if err != nil {
+		state.Error = err.Error()
+	}
+	state.Entries = len(entries)
+	if len(entries) > 0 {
+		state.FirstSequenceNumber = entries[0].GetLogSequenceNumber()
+		state.LastSequenceNumber = entries[len(entries)-1].GetLogSequenceNumber()
+	}
+
+	return state
+}
+
+// String renders the state as human readable text.
+func (s DebugState) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "directory: %s\n", s.Directory)
+	fmt.Fprintf(&b, "current segment: %d\n", s.CurrentSegmentIndex)
+	fmt.Fprintf(&b, "last sequence number: %d\n", s.LastSequenceNumber)
+	fmt.Fprintf(&b, "buffer: %d/%d bytes\n", s.BufferedBytes, s.BufferCapacity)
+	fmt.Fprintf(&b, "checkpoints: %v\n", s.Checkpoints)
+	fmt.Fprintf(&b, "closed: %t\n", s.Closed)
+	if s.LastSyncError != "" {
+		fmt.Fprintf(&b, "last sync error: %s\n", s.LastSyncError)
+	}
+	if s.CorruptionError != "" {
+		fmt.Fprintf(&b, "corruption: %s\n", s.CorruptionError)
+	}
+
+	fmt.Fprintf(&b, "segments:\n")
+	for _, segment := range s.Segments {
+		fmt.Fprintf(&b, "  %d: %s size=%d entries=%d lsn=[%d, %d]",
+			segment.Index, segment.Path, segment.Size, segment.Entries, segment.FirstSequenceNumber, segment.LastSequenceNumber)
+		if segment.Error != "" {
+			fmt.Fprintf(&b, " error=%q", segment.Error)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+
+	return b.String()
+}
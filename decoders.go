@@ -0,0 +1,43 @@
+package wal
+
+import "sync"
+
+// Decoder renders the payload of an entry as human-readable text, for tooling such as gowal tail.
+type Decoder interface {
+	Decode(entry *WAL_Entry) (string, error)
+}
+
+// DecoderFunc adapts a function to a Decoder.
+type DecoderFunc func(entry *WAL_Entry) (string, error)
+
+func (f DecoderFunc) Decode(entry *WAL_Entry) (string, error) {
+	return f(entry)
+}
+
+var (
+	decodersLock sync.RWMutex
+	decoders     = make(map[string]Decoder)
+)
+
+// RegisterDecoder registers the decoder for the entries of the given stream, or for the entries
+// without a stream if stream is empty, replacing any decoder registered before. Applications usually
+// register their decoders in an init function, which also makes them loadable by gowal as a Go plugin.
+func RegisterDecoder(stream string, decoder Decoder) {
+	decodersLock.Lock()
+	defer decodersLock.Unlock()
+	decoders[stream] = decoder
+}
+
+// DecodeEntry renders the entry with the decoder registered for its stream.
+// It reports false if no decoder is registered for the stream.
+func DecodeEntry(entry *WAL_Entry) (text string, ok bool, err error) {
+	decodersLock.RLock()
+	decoder, ok := decoders[entry.GetStream()]
+	decodersLock.RUnlock()
+	if !ok {
+		return "", false, nil
+	}
+
+	text, err = decoder.Decode(entry)
+	return text, true, err
+}
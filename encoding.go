@@ -0,0 +1,371 @@
+package wal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Encoding selects how the entries written by a WAL are encoded in the segment files, see WithEncoding.
+//
+// The encoding is recorded in the header of every segment, so that segments with different encodings
+// are read alike. Segments written before headers existed have none: there, the records that aren't
+// protobuf encoded start with a byte identifying their encoding instead, see decodeEntry.
+type Encoding int
+
+const (
+	// EncodingProtobuf encodes the entries with the protobuf wire format. It is the default.
+	EncodingProtobuf Encoding = iota
+	// EncodingBinary encodes the entries with a compact binary format of their own, which can be read
+	// without a protobuf implementation.
+	EncodingBinary
+	// EncodingJSON encodes the entries as JSON objects, for debugging: the segments can be read with
+	// a text editor, at the cost of larger records.
+	EncodingJSON
+	// EncodingFlatBuffers encodes the entries as FlatBuffers of the Entry table of types.fbs, whose
+	// fields can be read in place, without unmarshaling and copying the entry, see Tail.ReadViews.
+	EncodingFlatBuffers
+	// EncodingCapnProto encodes the entries as Cap'n Proto messages of the Entry struct of types.capnp,
+	// whose fields can be read in place like those of EncodingFlatBuffers. Its fixed layout suits reading
+	// sealed segments mapped into memory, see WithMmapReads.
+	EncodingCapnProto
+)
+
+// String returns the name of the encoding.
+func (e Encoding) String() string {
+	switch e {
+	case EncodingProtobuf:
+		return "protobuf"
+	case EncodingBinary:
+		return "binary"
+	case EncodingJSON:
+		return "json"
+	case EncodingFlatBuffers:
+		return "flatbuffers"
+	case EncodingCapnProto:
+		return "capnproto"
+	default:
+		return fmt.Sprintf("Encoding(%d)", int(e))
+	}
+}
+
+// binaryEncodingMarker is the first byte of the records of EncodingBinary in the segments without a
+// header, the tag of the invalid protobuf field 0.
+const binaryEncodingMarker = 0x01
+
+// Flags of the records of EncodingBinary.
+const (
+	binaryFlagHasCheckpoint = 1 << iota // IsCheckpoint is set
+	binaryFlagCheckpoint                // IsCheckpoint is true
+	binaryFlagTombstone
+)
+
+// appendEncodedFrame appends the frame of the entry, as stored in segment files, to b: the size of the
+// record as a little-endian int32, followed by the entry encoded with the given encoding. Neither the
+// encoding nor the checksum of the entry are part of the record, they are recorded in the header of the
+// segment.
+func appendEncodedFrame(b []byte, entry *WAL_Entry, encoding Encoding) []byte {
+	start := len(b)
+	b = append(b, 0, 0, 0, 0)
+	switch encoding {
+	case EncodingProtobuf:
+		b = entry.appendRecordVT(b)
+	case EncodingBinary:
+		b = appendBinaryEntry(b, entry)
+	case EncodingJSON:
+		b = appendJSONEntry(b, entry)
+	case EncodingFlatBuffers:
+		b = appendFlatBufferEntry(b, entry)
+	case EncodingCapnProto:
+		b = appendCapnpEntry(b, entry)
+	}
+	binary.LittleEndian.PutUint32(b[start:], uint32(len(b)-start-4))
+	return b
+}
+
+// unmarshalEntry decodes the record, read from a file of the given format, into the entry. The encoding
+// and the checksum of the entry are those recorded in the header of the file, if it has one.
+func unmarshalEntry(data []byte, format segmentFormat, entry *WAL_Entry) error {
+	if format.version == 0 {
+		return decodeEntry(data, entry)
+	}
+
+	var err error
+	switch format.encoding {
+	case EncodingBinary:
+		err = unmarshalBinaryEntry(data, entry)
+	case EncodingJSON:
+		err = unmarshalJSONEntry(data, entry)
+	case EncodingFlatBuffers:
+		err = unmarshalFlatEntry(data, entry)
+	case EncodingCapnProto:
+		err = unmarshalCapnpEntry(data, entry)
+	default:
+		err = entry.UnmarshalVT(data)
+	}
+	if err != nil {
+		return err
+	}
+	entry.Checksum = uint32(format.checksum)
+	return nil
+}
+
+// decodeEntry decodes a record of a file without a header into the entry, whatever its encoding: records
+// starting with binaryEncodingMarker, flatBuffersEncodingMarker or capnpEncodingMarker are binary,
+// FlatBuffers or Cap'n Proto records, those starting with the opening brace of a JSON object are JSON,
+// and the others, starting with the tag of one of their fields, are protobuf encoded.
+func decodeEntry(data []byte, entry *WAL_Entry) error {
+	if len(data) == 0 {
+		return entry.UnmarshalVT(data)
+	}
+	switch data[0] {
+	case binaryEncodingMarker:
+		return unmarshalBinaryEntry(data[1:], entry)
+	case flatBuffersEncodingMarker:
+		return unmarshalFlatEntry(data[1:], entry)
+	case capnpEncodingMarker:
+		return unmarshalCapnpEntry(data[1:], entry)
+	case '{':
+		return unmarshalJSONEntry(data, entry)
+	default:
+		return entry.UnmarshalVT(data)
+	}
+}
+
+// appendBinaryEntry appends the entry encoded with EncodingBinary to b: the sequence number, CRC, flags,
+// timestamp and HLC, then the data, metadata, stream and key prefixed with their length, and the labels,
+// prefixed with their number. Integers are varints, except the CRC. The schema and its version follow if
+// the entry has one, a blob or a value pointer, then the blob, empty if it has none, and the value
+// pointer; records without them end before.
+func appendBinaryEntry(b []byte, entry *WAL_Entry) []byte {
+	var flags byte
+	if entry.IsCheckpoint != nil {
+		flags |= binaryFlagHasCheckpoint
+		if *entry.IsCheckpoint {
+			flags |= binaryFlagCheckpoint
+		}
+	}
+	if entry.Tombstone {
+		flags |= binaryFlagTombstone
+	}
+
+	b = binary.AppendUvarint(b, entry.LogSequenceNumber)
+	b = binary.LittleEndian.AppendUint32(b, entry.CRC)
+	b = append(b, flags)
+	b = binary.AppendVarint(b, entry.Timestamp)
+	b = binary.AppendUvarint(b, entry.Hlc)
+	b = appendBinaryBytes(b, entry.Data)
+	b = appendBinaryBytes(b, entry.Metadata)
+	b = appendBinaryBytes(b, []byte(entry.Stream))
+	b = appendBinaryBytes(b, entry.Key)
+
+	// Labels are encoded in key order, so that the encoding of an entry is deterministic.
+	keys := make([]string, 0, len(entry.Labels))
+	for key := range entry.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	b = binary.AppendUvarint(b, uint64(len(keys)))
+	for _, key := range keys {
+		b = appendBinaryBytes(b, []byte(key))
+		b = appendBinaryBytes(b, []byte(entry.Labels[key]))
+	}
+	if entry.Schema != "" || entry.SchemaVersion != 0 || len(entry.Blob) > 0 || len(entry.ValuePointer) > 0 {
+		b = appendBinaryBytes(b, []byte(entry.Schema))
+		b = binary.AppendUvarint(b, uint64(entry.SchemaVersion))
+	}
+	if len(entry.Blob) > 0 || len(entry.ValuePointer) > 0 {
+		b = appendBinaryBytes(b, entry.Blob)
+	}
+	if len(entry.ValuePointer) > 0 {
+		b = appendBinaryBytes(b, entry.ValuePointer)
+	}
+	return b
+}
+
+func appendBinaryBytes(b []byte, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// binaryDecoder decodes the fields of a record of EncodingBinary, or of a protobuf encoded record, see
+// UnmarshalVT, recording the first error.
+type binaryDecoder struct {
+	data []byte
+	err  error
+}
+
+var errTruncatedRecord = errors.New("truncated record")
+
+func (d *binaryDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.data, d.err = nil, errTruncatedRecord
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *binaryDecoder) varint() int64 {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.data, d.err = nil, errTruncatedRecord
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *binaryDecoder) bytes(n int) []byte {
+	if len(d.data) < n {
+		d.data, d.err = nil, errTruncatedRecord
+		return nil
+	}
+	v := d.data[:n]
+	d.data = d.data[n:]
+	return v
+}
+
+// lengthPrefixed decodes a length-prefixed slice, without copying it.
+func (d *binaryDecoder) lengthPrefixed() []byte {
+	length := d.uvarint()
+	if length > uint64(len(d.data)) {
+		d.data, d.err = nil, errTruncatedRecord
+		return nil
+	}
+	return d.bytes(int(length))
+}
+
+// slice decodes a length-prefixed slice, and returns a copy of it, or nil if it is empty.
+func (d *binaryDecoder) slice() []byte {
+	v := d.lengthPrefixed()
+	if len(v) == 0 {
+		return nil
+	}
+	return append([]byte{}, v...)
+}
+
+// unmarshalBinaryEntry decodes a record of EncodingBinary, without its marker, into the entry. Like
+// UnmarshalVT, the entry is reset first and doesn't share memory with data.
+func unmarshalBinaryEntry(data []byte, entry *WAL_Entry) error {
+	entry.Reset()
+	d := &binaryDecoder{data: data}
+	entry.LogSequenceNumber = d.uvarint()
+	if crc := d.bytes(4); crc != nil {
+		entry.CRC = binary.LittleEndian.Uint32(crc)
+	}
+	var flags byte
+	if f := d.bytes(1); f != nil {
+		flags = f[0]
+	}
+	if flags&binaryFlagHasCheckpoint != 0 {
+		isCheckpoint := flags&binaryFlagCheckpoint != 0
+		entry.IsCheckpoint = &isCheckpoint
+	}
+	entry.Tombstone = flags&binaryFlagTombstone != 0
+	entry.Timestamp = d.varint()
+	entry.Hlc = d.uvarint()
+	entry.Data = d.slice()
+	entry.Metadata = d.slice()
+	entry.Stream = string(d.slice())
+	entry.Key = d.slice()
+	for labels := d.uvarint(); labels > 0 && d.err == nil; labels-- {
+		if entry.Labels == nil {
+			entry.Labels = make(map[string]string)
+		}
+		key := d.slice()
+		entry.Labels[string(key)] = string(d.slice())
+	}
+	if len(d.data) > 0 && d.err == nil {
+		entry.Schema = string(d.slice())
+		entry.SchemaVersion = uint32(d.uvarint())
+	}
+	if len(d.data) > 0 && d.err == nil {
+		entry.Blob = d.slice()
+	}
+	if len(d.data) > 0 && d.err == nil {
+		entry.ValuePointer = d.slice()
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) > 0 {
+		return fmt.Errorf("%d unexpected bytes after the record", len(d.data))
+	}
+	return nil
+}
+
+// jsonEntry is an entry encoded with EncodingJSON. Byte fields are base64 encoded.
+type jsonEntry struct {
+	LogSequenceNumber uint64            `json:"lsn"`
+	CRC               uint32            `json:"crc"`
+	IsCheckpoint      *bool             `json:"checkpoint,omitempty"`
+	Tombstone         bool              `json:"tombstone,omitempty"`
+	Timestamp         int64             `json:"timestamp,omitempty"`
+	HLC               uint64            `json:"hlc,omitempty"`
+	Stream            string            `json:"stream,omitempty"`
+	Key               []byte            `json:"key,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Metadata          []byte            `json:"metadata,omitempty"`
+	Data              []byte            `json:"data,omitempty"`
+	Schema            string            `json:"schema,omitempty"`
+	SchemaVersion     uint32            `json:"schemaVersion,omitempty"`
+	Blob              []byte            `json:"blob,omitempty"`
+	ValuePointer      []byte            `json:"valuePointer,omitempty"`
+}
+
+// appendJSONEntry appends the entry encoded with EncodingJSON to b.
+func appendJSONEntry(b []byte, entry *WAL_Entry) []byte {
+	data, err := json.Marshal(jsonEntry{
+		LogSequenceNumber: entry.LogSequenceNumber,
+		CRC:               entry.CRC,
+		IsCheckpoint:      entry.IsCheckpoint,
+		Tombstone:         entry.Tombstone,
+		Timestamp:         entry.Timestamp,
+		HLC:               entry.Hlc,
+		Stream:            entry.Stream,
+		Key:               entry.Key,
+		Labels:            entry.Labels,
+		Metadata:          entry.Metadata,
+		Data:              entry.Data,
+		Schema:            entry.Schema,
+		SchemaVersion:     entry.SchemaVersion,
+		Blob:              entry.Blob,
+		ValuePointer:      entry.ValuePointer,
+	})
+	// this err means the struct can't be marshaled, which it always can, so we should panic
+	if err != nil {
+		panic(fmt.Sprintf("Marshal should never fail (%v)", err))
+	}
+	return append(b, data...)
+}
+
+// unmarshalJSONEntry decodes a record of EncodingJSON into the entry. Like UnmarshalVT, the entry is
+// reset first.
+func unmarshalJSONEntry(data []byte, entry *WAL_Entry) error {
+	var e jsonEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	entry.Reset()
+	entry.LogSequenceNumber = e.LogSequenceNumber
+	entry.CRC = e.CRC
+	entry.IsCheckpoint = e.IsCheckpoint
+	entry.Tombstone = e.Tombstone
+	entry.Timestamp = e.Timestamp
+	entry.Hlc = e.HLC
+	entry.Stream = e.Stream
+	entry.Key = e.Key
+	entry.Labels = e.Labels
+	entry.Metadata = e.Metadata
+	entry.Data = e.Data
+	entry.Schema = e.Schema
+	entry.SchemaVersion = e.SchemaVersion
+	entry.Blob = e.Blob
+	entry.ValuePointer = e.ValuePointer
+	return nil
+}
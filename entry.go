@@ -0,0 +1,141 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrSequenceNumberTooLow is returned when writing an entry with WithSequenceNumber that is not
+// greater than the last sequence number of the log.
+var ErrSequenceNumberTooLow = errors.New("sequence number must be greater than the last sequence number")
+
+// ErrInvalidUTF8 is returned when writing an entry whose stream, labels or schema aren't valid UTF-8.
+// The encodings don't all preserve invalid strings, which would fail the CRC of the entry once read.
+var ErrInvalidUTF8 = errors.New("entry strings must be valid UTF-8")
+
+// EntryOption sets an attribute of an entry written with WriteEntryOpts.
+type EntryOption func(*WAL_Entry)
+
+// WriteEntryOpts writes an entry to the WAL with the attributes set by the given options, e.g.
+//
+//	wal.WriteEntryOpts(data, WithStream("orders"), WithKey(key), WithTimestamp(time.Now()))
+//
+// All attributes are covered by the entry's CRC.
+func (wal *WAL) WriteEntryOpts(data []byte, opts ...EntryOption) error {
+	entry := &WAL_Entry{Data: data}
+	for _, opt := range opts {
+		opt(entry)
+	}
+
+	return wal.writeEntry(entry)
+}
+
+// AppendEntry writes an entry like WriteEntryOpts and returns the sequence number assigned to it.
+func (wal *WAL) AppendEntry(data []byte, opts ...EntryOption) (uint64, error) {
+	entry := &WAL_Entry{Data: data}
+	for _, opt := range opts {
+		opt(entry)
+	}
+
+	if err := wal.writeEntry(entry); err != nil {
+		return 0, err
+	}
+	return entry.GetLogSequenceNumber(), nil
+}
+
+// WriteTombstone writes a tombstone deleting key, see WithTombstone, and returns its sequence number.
+func (wal *WAL) WriteTombstone(key []byte, opts ...EntryOption) (uint64, error) {
+	if len(key) == 0 {
+		return 0, errors.New("tombstone must have a key")
+	}
+	// The options are copied, so that the caller's slice isn't modified.
+	return wal.AppendEntry(nil, append(append([]EntryOption(nil), opts...), WithKey(key), WithTombstone())...)
+}
+
+// WithCheckpoint marks the entry as a checkpoint, see CreateCheckpoint.
+func WithCheckpoint() EntryOption {
+	return func(entry *WAL_Entry) {
+		isCheckpoint := true
+		entry.IsCheckpoint = &isCheckpoint
+	}
+}
+
+// WithSequenceNumber writes the entry with the given sequence number instead of the next one,
+// for instance to reconstitute an exported log. It must be greater than the last sequence number;
+// numbers skipped in between are left as a gap. Otherwise the write fails with ErrSequenceNumberTooLow.
+func WithSequenceNumber(lsn uint64) EntryOption {
+	return func(entry *WAL_Entry) {
+		entry.LogSequenceNumber = lsn
+	}
+}
+
+// WithStream sets the stream the entry belongs to. It must be valid UTF-8, see ErrInvalidUTF8.
+func WithStream(stream string) EntryOption {
+	return func(entry *WAL_Entry) {
+		entry.Stream = stream
+	}
+}
+
+// WithKey sets the key of the entry.
+func WithKey(key []byte) EntryOption {
+	return func(entry *WAL_Entry) {
+		entry.Key = key
+	}
+}
+
+// WithTombstone marks the entry as a tombstone: it deletes its key, see WithKey, in the stream of the
+// entry. Compact drops the earlier versions of the key, then the tombstone itself once it is safe.
+func WithTombstone() EntryOption {
+	return func(entry *WAL_Entry) {
+		entry.Tombstone = true
+	}
+}
+
+// WithTimestamp sets the application timestamp of the entry.
+func WithTimestamp(t time.Time) EntryOption {
+	return func(entry *WAL_Entry) {
+		entry.Timestamp = t.UnixNano()
+	}
+}
+
+// WithMetadata sets application defined metadata stored alongside the entry's data.
+func WithMetadata(metadata []byte) EntryOption {
+	return func(entry *WAL_Entry) {
+		entry.Metadata = metadata
+	}
+}
+
+// WithLabels sets application defined labels on the entry. Their keys and values must be valid UTF-8,
+// see ErrInvalidUTF8.
+func WithLabels(labels map[string]string) EntryOption {
+	return func(entry *WAL_Entry) {
+		entry.Labels = labels
+	}
+}
+
+// Time returns the application timestamp of the entry, or the zero time if it has none.
+func (x *WAL_Entry) Time() time.Time {
+	if x.GetTimestamp() == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, x.GetTimestamp())
+}
+
+// validateStrings returns ErrInvalidUTF8 if the stream, a label or the schema of the entry isn't valid
+// UTF-8.
+func validateStrings(entry *WAL_Entry) error {
+	if !utf8.ValidString(entry.GetStream()) {
+		return fmt.Errorf("%w: stream %q", ErrInvalidUTF8, entry.GetStream())
+	}
+	for key, value := range entry.GetLabels() {
+		if !utf8.ValidString(key) || !utf8.ValidString(value) {
+			return fmt.Errorf("%w: label %q", ErrInvalidUTF8, key)
+		}
+	}
+	if !utf8.ValidString(entry.GetSchema()) {
+		return fmt.Errorf("%w: schema %q", ErrInvalidUTF8, entry.GetSchema())
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package wal
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrEntryNotFound is returned by GetEntry for a sequence number that isn't in the log.
+var ErrEntryNotFound = errors.New("entry not found")
+
+// EntryCacheStats reports the use of the cache set with WithEntryCache.
+type EntryCacheStats struct {
+	// Entries is the number of entries in the cache, and Capacity the maximum.
+	Entries  int `json:"entries"`
+	Capacity int `json:"capacity"`
+	// Hits and Misses count the entries read by GetEntry and ReadRange from the cache, and from the
+	// segment files.
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// WithEntryCache keeps the last entries read by GetEntry and ReadRange, up to the given number, decoded
+// in memory, so that the callers reading the same entries again, such as replicas and the API frontends
+// catching up with the hot tail of the log, don't read and unmarshal them again. The least recently read
+// entries are evicted first. The cache is cleared by the operations that rewrite entries, such as
+// TruncateAfter and Compact, and the entries of deleted segments are evicted, so that the cache never
+// returns entries the segment files no longer hold. Defaults to 0, which disables it.
+func WithEntryCache(entries int) Option {
+	return func(o *options) {
+		o.entryCacheSize = entries
+	}
+}
+
+// entryCache is a bounded LRU cache of decoded entries, by sequence number.
+type entryCache struct {
+	lock     sync.Mutex
+	capacity int
+	entries  map[uint64]*list.Element
+	order    *list.List // of *WAL_Entry, most recently used first
+	hits     uint64
+	misses   uint64
+	// generation counts the clears, so that the entries read before a clear aren't added after it.
+	generation uint64
+}
+
+func newEntryCache(capacity int) *entryCache {
+	return &entryCache{capacity: capacity, entries: make(map[uint64]*list.Element), order: list.New()}
+}
+
+// get returns the cached entry with the given sequence number, if any.
+func (c *entryCache) get(lsn uint64) (*WAL_Entry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	element, ok := c.entries[lsn]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	c.hits++
+	return element.Value.(*WAL_Entry), true
+}
+
+// currentGeneration returns the generation of the cache, to pass to add.
+func (c *entryCache) currentGeneration() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.generation
+}
+
+// add caches the entries read from the segment files, evicting the least recently used ones, unless the
+// cache was cleared since the given generation.
+func (c *entryCache) add(entries []*WAL_Entry, generation uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.misses += uint64(len(entries))
+	if generation != c.generation {
+		return
+	}
+	for _, entry := range entries {
+		if element, ok := c.entries[entry.GetLogSequenceNumber()]; ok {
+			element.Value = entry
+			c.order.MoveToFront(element)
+			continue
+		}
+		c.entries[entry.GetLogSequenceNumber()] = c.order.PushFront(entry)
+		if c.order.Len() > c.capacity {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*WAL_Entry).GetLogSequenceNumber())
+		}
+	}
+}
+
+// evictBefore removes the entries with a sequence number lower than lsn, once they were deleted.
+func (c *entryCache) evictBefore(lsn uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for sequenceNo, element := range c.entries {
+		if sequenceNo < lsn {
+			c.order.Remove(element)
+			delete(c.entries, sequenceNo)
+		}
+	}
+	c.generation++
+}
+
+// clear empties the cache, once entries were deleted or rewritten.
+func (c *entryCache) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	clear(c.entries)
+	c.order.Init()
+	c.generation++
+}
+
+func (c *entryCache) stats() *EntryCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return &EntryCacheStats{Entries: c.order.Len(), Capacity: c.capacity, Hits: c.hits, Misses: c.misses}
+}
+
+// GetEntry returns the entry with the given sequence number, or ErrEntryNotFound if there is none, e.g.
+// because it was compacted or deleted. It is served by the cache set with WithEntryCache, if any. The
+// returned entry may be shared with other callers, and must not be modified.
+func (wal *WAL) GetEntry(lsn uint64) (*WAL_Entry, error) {
+	if wal.entryCache != nil {
+		if entry, ok := wal.entryCache.get(lsn); ok {
+			return entry, nil
+		}
+	}
+	entries, err := wal.ReadRange(lsn, lsn, 1)
+	if errors.Is(err, ErrEntriesDeleted) {
+		return nil, fmt.Errorf("%w: %w", ErrEntryNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: sequence number %d", ErrEntryNotFound, lsn)
+	}
+	return entries[0], nil
+}
+
+// ReadRange returns the entries with a sequence number from from to to, or to the last one if to is 0,
+// up to limit entries if limit is greater than 0. The buffered entries are flushed first, so that they
+// are included. The entries are served by the cache set with WithEntryCache, if any, as long as they
+// are cached; the returned entries may be shared with other callers, and must not be modified.
+func (wal *WAL) ReadRange(from, to uint64, limit int) ([]*WAL_Entry, error) {
+	var entries []*WAL_Entry
+	var generation uint64
+	next := from
+	if wal.entryCache != nil {
+		generation = wal.entryCache.currentGeneration()
+		for (to == 0 || next <= to) && (limit <= 0 || len(entries) < limit) {
+			entry, ok := wal.entryCache.get(next)
+			if !ok {
+				break
+			}
+			entries = append(entries, entry)
+			next++
+		}
+		if (to != 0 && next > to) || (limit > 0 && len(entries) >= limit) {
+			return entries, nil
+		}
+	}
+
+	// Entries are only readable once they have been flushed to the segment files.
+	if err := wal.Flush(); err != nil {
+		return nil, err
+	}
+	tail, err := wal.Tail(next)
+	if err != nil {
+		return nil, err
+	}
+	defer tail.Stop()
+
+	read := len(entries)
+	err = tail.Read(func(entry *WAL_Entry) error {
+		if to != 0 && entry.GetLogSequenceNumber() > to {
+			return errReadRangeDone
+		}
+		entries = append(entries, entry)
+		if limit > 0 && len(entries) >= limit {
+			return errReadRangeDone
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errReadRangeDone) {
+		return nil, err
+	}
+	if wal.entryCache != nil {
+		wal.entryCache.add(entries[read:], generation)
+	}
+	return entries, nil
+}
+
+// errReadRangeDone stops ReadRange once it has read the range.
+var errReadRangeDone = errors.New("read range done")
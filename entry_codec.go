@@ -0,0 +1,406 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"unicode/utf8"
+)
+
+// Fast path encoding of WAL_Entry, in the style of the methods generated by vtprotobuf: the fields are
+// encoded and decoded directly instead of through the reflection based proto.Marshal and proto.Unmarshal.
+// The encoding is the protobuf wire format, so entries marshaled either way can be unmarshaled either way,
+// and unknown fields, e.g. written by a newer version, are kept. It doesn't depend on the protobuf module,
+// so that the package can be built without it, see types_noprotobuf.go.
+
+// Field numbers of WAL_Entry, see types.proto.
+const (
+	entryFieldLogSequenceNumber = iota + 1
+	entryFieldData
+	entryFieldCRC
+	entryFieldIsCheckpoint
+	entryFieldMetadata
+	entryFieldLabels
+	entryFieldStream
+	entryFieldKey
+	entryFieldTimestamp
+	entryFieldHLC
+	entryFieldChecksum
+	entryFieldTombstone
+	entryFieldSchema
+	entryFieldSchemaVersion
+	entryFieldBlob
+	entryFieldValuePointer
+)
+
+// Wire types of the protobuf wire format, and the largest valid field number.
+const (
+	wireVarint     = 0
+	wireFixed64    = 1
+	wireBytes      = 2
+	wireStartGroup = 3
+	wireEndGroup   = 4
+	wireFixed32    = 5
+
+	maxFieldNumber = 1<<29 - 1
+)
+
+var (
+	// errInvalidWireType is returned when unmarshaling a field encoded with an unexpected wire type.
+	errInvalidWireType    = errors.New("invalid wire type")
+	errInvalidFieldNumber = errors.New("invalid field number")
+)
+
+// sizeVarint returns the size of v encoded as a varint.
+func sizeVarint(v uint64) int {
+	return (bits.Len64(v|1) + 6) / 7
+}
+
+// sizeTag returns the size of the tag of the field with the given number.
+func sizeTag(num int) int {
+	return sizeVarint(uint64(num) << 3)
+}
+
+// sizeBytes returns the size of a length-prefixed field of n bytes, without its tag.
+func sizeBytes(n int) int {
+	return sizeVarint(uint64(n)) + n
+}
+
+// appendTag appends the tag of the field with the given number and wire type to b.
+func appendTag(b []byte, num, typ int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(typ))
+}
+
+// appendString appends s, prefixed with its length, to b, like appendBinaryBytes.
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendBool appends v encoded as a varint to b.
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// SizeVT returns the size of the entry once marshaled.
+func (x *WAL_Entry) SizeVT() int {
+	if x == nil {
+		return 0
+	}
+
+	n := 0
+	if x.LogSequenceNumber != 0 {
+		n += sizeTag(entryFieldLogSequenceNumber) + sizeVarint(x.LogSequenceNumber)
+	}
+	if len(x.Data) > 0 {
+		n += sizeTag(entryFieldData) + sizeBytes(len(x.Data))
+	}
+	if x.CRC != 0 {
+		n += sizeTag(entryFieldCRC) + sizeVarint(uint64(x.CRC))
+	}
+	if x.IsCheckpoint != nil {
+		n += sizeTag(entryFieldIsCheckpoint) + 1
+	}
+	if len(x.Metadata) > 0 {
+		n += sizeTag(entryFieldMetadata) + sizeBytes(len(x.Metadata))
+	}
+	for k, v := range x.Labels {
+		n += sizeTag(entryFieldLabels) + sizeBytes(sizeLabel(k, v))
+	}
+	if len(x.Stream) > 0 {
+		n += sizeTag(entryFieldStream) + sizeBytes(len(x.Stream))
+	}
+	if len(x.Key) > 0 {
+		n += sizeTag(entryFieldKey) + sizeBytes(len(x.Key))
+	}
+	if x.Timestamp != 0 {
+		n += sizeTag(entryFieldTimestamp) + sizeVarint(uint64(x.Timestamp))
+	}
+	if x.Hlc != 0 {
+		n += sizeTag(entryFieldHLC) + sizeVarint(x.Hlc)
+	}
+	if x.Checksum != 0 {
+		n += sizeTag(entryFieldChecksum) + sizeVarint(uint64(x.Checksum))
+	}
+	if x.Tombstone {
+		n += sizeTag(entryFieldTombstone) + 1
+	}
+	if len(x.Schema) > 0 {
+		n += sizeTag(entryFieldSchema) + sizeBytes(len(x.Schema))
+	}
+	if x.SchemaVersion != 0 {
+		n += sizeTag(entryFieldSchemaVersion) + sizeVarint(uint64(x.SchemaVersion))
+	}
+	if len(x.Blob) > 0 {
+		n += sizeTag(entryFieldBlob) + sizeBytes(len(x.Blob))
+	}
+	if len(x.ValuePointer) > 0 {
+		n += sizeTag(entryFieldValuePointer) + sizeBytes(len(x.ValuePointer))
+	}
+	return n + len(x.unknownFields)
+}
+
+// sizeLabel returns the size of the map entry of a label.
+func sizeLabel(k, v string) int {
+	return sizeTag(1) + sizeBytes(len(k)) + sizeTag(2) + sizeBytes(len(v))
+}
+
+// MarshalVT marshals the entry, like proto.Marshal.
+func (x *WAL_Entry) MarshalVT() ([]byte, error) {
+	return x.appendVT(make([]byte, 0, x.SizeVT())), nil
+}
+
+// appendVT appends the marshaled entry to b.
+func (x *WAL_Entry) appendVT(b []byte) []byte {
+	return x.appendFields(b, true)
+}
+
+// appendRecordVT appends the marshaled entry to b without its checksum, which the segments record in their
+// header instead, see appendEncodedFrame.
+func (x *WAL_Entry) appendRecordVT(b []byte) []byte {
+	return x.appendFields(b, false)
+}
+
+// appendFields appends the marshaled entry to b, with its checksum if withChecksum is set.
+func (x *WAL_Entry) appendFields(b []byte, withChecksum bool) []byte {
+	if x == nil {
+		return b
+	}
+
+	if x.LogSequenceNumber != 0 {
+		b = appendTag(b, entryFieldLogSequenceNumber, wireVarint)
+		b = binary.AppendUvarint(b, x.LogSequenceNumber)
+	}
+	if len(x.Data) > 0 {
+		b = appendTag(b, entryFieldData, wireBytes)
+		b = appendBinaryBytes(b, x.Data)
+	}
+	if x.CRC != 0 {
+		b = appendTag(b, entryFieldCRC, wireVarint)
+		b = binary.AppendUvarint(b, uint64(x.CRC))
+	}
+	if x.IsCheckpoint != nil {
+		b = appendTag(b, entryFieldIsCheckpoint, wireVarint)
+		b = appendBool(b, *x.IsCheckpoint)
+	}
+	if len(x.Metadata) > 0 {
+		b = appendTag(b, entryFieldMetadata, wireBytes)
+		b = appendBinaryBytes(b, x.Metadata)
+	}
+	for k, v := range x.Labels {
+		b = appendTag(b, entryFieldLabels, wireBytes)
+		b = binary.AppendUvarint(b, uint64(sizeLabel(k, v)))
+		b = appendTag(b, 1, wireBytes)
+		b = appendString(b, k)
+		b = appendTag(b, 2, wireBytes)
+		b = appendString(b, v)
+	}
+	if len(x.Stream) > 0 {
+		b = appendTag(b, entryFieldStream, wireBytes)
+		b = appendString(b, x.Stream)
+	}
+	if len(x.Key) > 0 {
+		b = appendTag(b, entryFieldKey, wireBytes)
+		b = appendBinaryBytes(b, x.Key)
+	}
+	if x.Timestamp != 0 {
+		b = appendTag(b, entryFieldTimestamp, wireVarint)
+		b = binary.AppendUvarint(b, uint64(x.Timestamp))
+	}
+	if x.Hlc != 0 {
+		b = appendTag(b, entryFieldHLC, wireVarint)
+		b = binary.AppendUvarint(b, x.Hlc)
+	}
+	if x.Checksum != 0 && withChecksum {
+		b = appendTag(b, entryFieldChecksum, wireVarint)
+		b = binary.AppendUvarint(b, uint64(x.Checksum))
+	}
+	if x.Tombstone {
+		b = appendTag(b, entryFieldTombstone, wireVarint)
+		b = appendBool(b, x.Tombstone)
+	}
+	if len(x.Schema) > 0 {
+		b = appendTag(b, entryFieldSchema, wireBytes)
+		b = appendString(b, x.Schema)
+	}
+	if x.SchemaVersion != 0 {
+		b = appendTag(b, entryFieldSchemaVersion, wireVarint)
+		b = binary.AppendUvarint(b, uint64(x.SchemaVersion))
+	}
+	if len(x.Blob) > 0 {
+		b = appendTag(b, entryFieldBlob, wireBytes)
+		b = appendBinaryBytes(b, x.Blob)
+	}
+	if len(x.ValuePointer) > 0 {
+		b = appendTag(b, entryFieldValuePointer, wireBytes)
+		b = appendBinaryBytes(b, x.ValuePointer)
+	}
+	return append(b, x.unknownFields...)
+}
+
+// UnmarshalVT unmarshals data into the entry, like proto.Unmarshal. The entry is reset first, and
+// doesn't share memory with data.
+func (x *WAL_Entry) UnmarshalVT(data []byte) error {
+	x.Reset()
+	d := &binaryDecoder{data: data}
+	for len(d.data) > 0 {
+		field := d.data
+		num, typ := d.tag()
+		if d.err != nil {
+			return d.err
+		}
+
+		switch num {
+		case entryFieldLogSequenceNumber, entryFieldCRC, entryFieldIsCheckpoint, entryFieldTimestamp, entryFieldHLC, entryFieldChecksum, entryFieldTombstone, entryFieldSchemaVersion:
+			if typ != wireVarint {
+				return fmt.Errorf("field %d: %w", num, errInvalidWireType)
+			}
+			v := d.uvarint()
+			if d.err != nil {
+				return d.err
+			}
+			switch num {
+			case entryFieldLogSequenceNumber:
+				x.LogSequenceNumber = v
+			case entryFieldCRC:
+				x.CRC = uint32(v)
+			case entryFieldIsCheckpoint:
+				isCheckpoint := v != 0
+				x.IsCheckpoint = &isCheckpoint
+			case entryFieldTimestamp:
+				x.Timestamp = int64(v)
+			case entryFieldHLC:
+				x.Hlc = v
+			case entryFieldChecksum:
+				x.Checksum = uint32(v)
+			case entryFieldTombstone:
+				x.Tombstone = v != 0
+			case entryFieldSchemaVersion:
+				x.SchemaVersion = uint32(v)
+			}
+
+		case entryFieldData, entryFieldMetadata, entryFieldLabels, entryFieldStream, entryFieldKey, entryFieldSchema, entryFieldBlob,
+			entryFieldValuePointer:
+			if typ != wireBytes {
+				return fmt.Errorf("field %d: %w", num, errInvalidWireType)
+			}
+			v := d.lengthPrefixed()
+			if d.err != nil {
+				return d.err
+			}
+			switch num {
+			case entryFieldData:
+				x.Data = append([]byte{}, v...)
+			case entryFieldMetadata:
+				x.Metadata = append([]byte{}, v...)
+			case entryFieldKey:
+				x.Key = append([]byte{}, v...)
+			case entryFieldBlob:
+				x.Blob = append([]byte{}, v...)
+			case entryFieldValuePointer:
+				x.ValuePointer = append([]byte{}, v...)
+			case entryFieldStream:
+				if !utf8.Valid(v) {
+					return fmt.Errorf("field %d: invalid UTF-8", num)
+				}
+				x.Stream = string(v)
+			case entryFieldSchema:
+				if !utf8.Valid(v) {
+					return fmt.Errorf("field %d: invalid UTF-8", num)
+				}
+				x.Schema = string(v)
+			case entryFieldLabels:
+				if err := x.unmarshalLabel(v); err != nil {
+					return fmt.Errorf("field %d: %w", num, err)
+				}
+			}
+
+		default:
+			d.skipField(num, typ)
+			if d.err != nil {
+				return d.err
+			}
+			x.unknownFields = append(x.unknownFields, field[:len(field)-len(d.data)]...)
+		}
+	}
+	return nil
+}
+
+// unmarshalLabel adds the label encoded as a map entry to the labels of the entry.
+func (x *WAL_Entry) unmarshalLabel(data []byte) error {
+	var k, v string
+	d := &binaryDecoder{data: data}
+	for len(d.data) > 0 {
+		num, typ := d.tag()
+		if (num != 1 && num != 2) || typ != wireBytes {
+			d.skipField(num, typ)
+			if d.err != nil {
+				return d.err
+			}
+			continue
+		}
+
+		s := d.lengthPrefixed()
+		if d.err != nil {
+			return d.err
+		}
+		if !utf8.Valid(s) {
+			return errors.New("invalid UTF-8")
+		}
+		if num == 1 {
+			k = string(s)
+		} else {
+			v = string(s)
+		}
+	}
+
+	if x.Labels == nil {
+		x.Labels = make(map[string]string)
+	}
+	x.Labels[k] = v
+	return nil
+}
+
+// tag decodes the tag of a field of a protobuf encoded record, and returns its number and wire type.
+func (d *binaryDecoder) tag() (num, typ int) {
+	tag := d.uvarint()
+	if d.err == nil && (tag>>3 == 0 || tag>>3 > maxFieldNumber) {
+		d.data, d.err = nil, errInvalidFieldNumber
+	}
+	return int(tag >> 3), int(tag & 7)
+}
+
+// skipField skips the value of the field of a protobuf encoded record with the given number and wire type.
+func (d *binaryDecoder) skipField(num, typ int) {
+	if d.err != nil {
+		return
+	}
+	switch typ {
+	case wireVarint:
+		d.uvarint()
+	case wireFixed64:
+		d.bytes(8)
+	case wireBytes:
+		d.lengthPrefixed()
+	case wireFixed32:
+		d.bytes(4)
+	case wireStartGroup:
+		// The fields of the group follow, up to the end of the group with the same number.
+		for d.err == nil {
+			fieldNum, fieldTyp := d.tag()
+			if d.err == nil && fieldTyp == wireEndGroup {
+				if fieldNum != num {
+					d.data, d.err = nil, errInvalidWireType
+				}
+				return
+			}
+			d.skipField(fieldNum, fieldTyp)
+		}
+	default:
+		d.data, d.err = nil, errInvalidWireType
+	}
+}
@@ -0,0 +1,53 @@
+package wal
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Messages of the events logged to the logger set with WithEventLogger. Every event
+// has a "directory" attribute; the other attributes are listed with each message.
+const (
+	// EventOpened is logged when the WAL has been opened and recovered.
+	// Attributes: segment, last_sequence_number, checkpoints, created.
+	EventOpened = "wal opened"
+	// EventSegmentCreated is logged when the log is rotated to a new segment. Attributes: segment, path.
+	EventSegmentCreated = "segment created"
+	// EventSegmentDeleted is logged when the oldest segment is deleted because of the segment limit.
+	// Attributes: path, size, reason.
+	EventSegmentDeleted = "segment deleted"
+	// EventSegmentTruncated is logged at warning level when Repair drops the corrupted tail of a segment.
+	// Attributes: path, entries_kept, reason.
+	EventSegmentTruncated = "segment truncated"
+	// EventCheckpointSaved is logged when a checkpoint is recorded in the checkpoint file.
+	// Attributes: log_sequence_number, retained.
+	EventCheckpointSaved = "checkpoint saved"
+	// EventSnapshotSaved is logged when a SnapshotStore has saved a snapshot and recorded its checkpoint.
+	// Attributes: log_sequence_number, size.
+	EventSnapshotSaved = "snapshot saved"
+	// EventClosed is logged when the WAL has been closed. Attributes: last_sequence_number.
+	EventClosed = "wal closed"
+	// EventLeaseAcquired is logged when the WAL acquires its lease, see WithLease. Attributes: epoch, holder, expires.
+	EventLeaseAcquired = "lease acquired"
+	// EventLeaseLost is logged at error level when another writer took over the lease of the WAL.
+	// Attributes: epoch, holder, new_epoch.
+	EventLeaseLost = "lease lost"
+	// EventWebhookFailed is logged at warning level when a webhook notification could not be delivered,
+	// see WithWebhook. Attributes: event, url (unless the notification was dropped before delivery), error.
+	EventWebhookFailed = "webhook failed"
+	// EventShippingFailed is logged at warning level when shipping segments to the target set with
+	// WithShipping failed. Attributes: error, retry_in.
+	EventShippingFailed = "shipping failed"
+	// EventMirrorDetached is logged at error level when the mirror directory set with WithMirror failed
+	// and was detached, see MirrorAllowDegraded. Attributes: mirror, error.
+	EventMirrorDetached = "mirror detached"
+)
+
+// logEvent logs an event to the event logger, if one is set.
+func (wal *WAL) logEvent(level slog.Level, msg string, attrs ...slog.Attr) {
+	if wal.eventLogger == nil {
+		return
+	}
+	attrs = append(attrs, slog.String("directory", wal.directory))
+	wal.eventLogger.LogAttrs(context.Background(), level, msg, attrs...)
+}
@@ -0,0 +1,35 @@
+package wal
+
+import (
+	"expvar"
+	"fmt"
+)
+
+// PublishExpvar publishes the WAL's Stats under the given name with the expvar package,
+// so they are served on the standard /debug/vars endpoint. The stats are collected
+// every time the variable is read. It returns an error if the name is already published.
+func (wal *WAL) PublishExpvar(prefix string) error {
+	return publishStats(prefix, wal.Stats)
+}
+
+// NewExpvarSink returns a StatsSink that publishes the last Stats reported to it under
+// the given name with the expvar package. It returns an error if the name is already published.
+func NewExpvarSink(name string) (*StatsRecorder, error) {
+	recorder := &StatsRecorder{}
+	if err := publishStats(name, recorder.Stats); err != nil {
+		return nil, err
+	}
+	return recorder, nil
+}
+
+func publishStats(name string, stats func() Stats) error {
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar %q is already published", name)
+	}
+
+	expvar.Publish(name, expvar.Func(func() any {
+		return stats()
+	}))
+
+	return nil
+}
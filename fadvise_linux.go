@@ -0,0 +1,18 @@
+package wal
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// DropCache implements CacheDropFS, advising the kernel with posix_fadvise that the cached pages of
+// the file at path won't be needed.
+func (OSFS) DropCache(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
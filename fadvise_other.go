@@ -0,0 +1,10 @@
+//go:build !linux
+
+package wal
+
+import "errors"
+
+// DropCache is not supported on this platform.
+func (OSFS) DropCache(path string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,423 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// flatBuffersEncodingMarker is the first byte of the records of EncodingFlatBuffers in the segments
+// without a header, the tag of the invalid protobuf field 0 with the length-delimited wire type. The
+// FlatBuffer follows it.
+const flatBuffersEncodingMarker = 0x02
+
+// flatBuffersIdentifier is the file identifier of the FlatBuffers encoded entries, see types.fbs.
+const flatBuffersIdentifier = "WALE"
+
+// Slots of the fields of the Entry table of types.fbs, in declaration order.
+const (
+	flatFieldLogSequenceNumber = iota
+	flatFieldData
+	flatFieldCRC
+	flatFieldIsCheckpoint
+	flatFieldMetadata
+	flatFieldLabels
+	flatFieldStream
+	flatFieldKey
+	flatFieldTimestamp
+	flatFieldHLC
+	flatFieldChecksum // deprecated, see types.fbs
+	flatFieldTombstone
+	flatFieldSchema
+	flatFieldSchemaVersion
+	flatFieldBlob
+	flatFieldValuePointer
+	flatFieldCount
+)
+
+// Slots of the fields of the Label table of types.fbs.
+const (
+	flatLabelKey = iota
+	flatLabelValue
+	flatLabelFieldCount
+)
+
+// appendFlatBufferEntry appends the entry encoded with EncodingFlatBuffers to b, as a FlatBuffer of the
+// Entry table of types.fbs.
+//
+// The buffer is laid out front to back, which keeps every offset positive: the root offset and the
+// identifier, the vtable, the table, then the vectors and strings the table refers to. Fields with their
+// default value are omitted, like FlatBuffers builders do. Alignment is relative to the buffer.
+func appendFlatBufferEntry(b []byte, entry *WAL_Entry) []byte {
+	base := len(b)
+	b = append(b, 0, 0, 0, 0)
+	b = append(b, flatBuffersIdentifier...)
+
+	// The vtable, filled as the fields are laid out.
+	vtable := len(b)
+	b = append(b, make([]byte, 4+2*flatFieldCount)...)
+	binary.LittleEndian.PutUint16(b[vtable:], uint16(4+2*flatFieldCount))
+	b = padTo(b, base, 8)
+	table := len(b)
+	binary.LittleEndian.PutUint32(b[base:], uint32(table-base))
+	b = binary.LittleEndian.AppendUint32(b, uint32(table-vtable))
+
+	setField := func(slot int) {
+		binary.LittleEndian.PutUint16(b[vtable+4+2*slot:], uint16(len(b)-table))
+	}
+
+	// 4 byte fields first, right after the vtable offset, then bools, then 8 byte fields.
+	if entry.CRC != 0 {
+		setField(flatFieldCRC)
+		b = binary.LittleEndian.AppendUint32(b, entry.CRC)
+	}
+	if entry.SchemaVersion != 0 {
+		setField(flatFieldSchemaVersion)
+		b = binary.LittleEndian.AppendUint32(b, entry.SchemaVersion)
+	}
+	var vectors [flatFieldCount]int // position of the offset of each vector field, 0 if absent
+	for _, slot := range []int{flatFieldData, flatFieldMetadata, flatFieldLabels, flatFieldStream,
+		flatFieldKey, flatFieldSchema, flatFieldBlob, flatFieldValuePointer} {
+		if flatVectorLen(entry, slot) > 0 {
+			setField(slot)
+			vectors[slot] = len(b)
+			b = append(b, 0, 0, 0, 0)
+		}
+	}
+	if entry.IsCheckpoint != nil {
+		setField(flatFieldIsCheckpoint)
+		b = append(b, boolByte(*entry.IsCheckpoint))
+	}
+	if entry.Tombstone {
+		setField(flatFieldTombstone)
+		b = append(b, 1)
+	}
+	b = padTo(b, base, 8)
+	for _, field := range []struct {
+		slot  int
+		value uint64
+	}{
+		{flatFieldLogSequenceNumber, entry.LogSequenceNumber},
+		{flatFieldTimestamp, uint64(entry.Timestamp)},
+		{flatFieldHLC, entry.Hlc},
+	} {
+		if field.value != 0 {
+			setField(field.slot)
+			b = binary.LittleEndian.AppendUint64(b, field.value)
+		}
+	}
+	binary.LittleEndian.PutUint16(b[vtable+2:], uint16(len(b)-table))
+
+	if at := vectors[flatFieldData]; at > 0 {
+		b = appendFlatVector(b, base, at, entry.Data, false)
+	}
+	if at := vectors[flatFieldMetadata]; at > 0 {
+		b = appendFlatVector(b, base, at, entry.Metadata, false)
+	}
+	if at := vectors[flatFieldLabels]; at > 0 {
+		b = appendFlatLabels(b, base, at, entry.Labels)
+	}
+	if at := vectors[flatFieldStream]; at > 0 {
+		b = appendFlatVector(b, base, at, []byte(entry.Stream), true)
+	}
+	if at := vectors[flatFieldKey]; at > 0 {
+		b = appendFlatVector(b, base, at, entry.Key, false)
+	}
+	if at := vectors[flatFieldSchema]; at > 0 {
+		b = appendFlatVector(b, base, at, []byte(entry.Schema), true)
+	}
+	if at := vectors[flatFieldBlob]; at > 0 {
+		b = appendFlatVector(b, base, at, entry.Blob, false)
+	}
+	if at := vectors[flatFieldValuePointer]; at > 0 {
+		b = appendFlatVector(b, base, at, entry.ValuePointer, false)
+	}
+	return b
+}
+
+func flatVectorLen(entry *WAL_Entry, slot int) int {
+	switch slot {
+	case flatFieldData:
+		return len(entry.Data)
+	case flatFieldMetadata:
+		return len(entry.Metadata)
+	case flatFieldLabels:
+		return len(entry.Labels)
+	case flatFieldStream:
+		return len(entry.Stream)
+	case flatFieldSchema:
+		return len(entry.Schema)
+	case flatFieldBlob:
+		return len(entry.Blob)
+	case flatFieldValuePointer:
+		return len(entry.ValuePointer)
+	default:
+		return len(entry.Key)
+	}
+}
+
+// appendFlatVector appends a vector of bytes, or a string, which is also null terminated, and points the
+// offset at the given position to it.
+func appendFlatVector(b []byte, base, at int, data []byte, isString bool) []byte {
+	b = padTo(b, base, 4)
+	binary.LittleEndian.PutUint32(b[at:], uint32(len(b)-at))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	if isString {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// appendFlatLabels appends the labels as a vector of Label tables sorted by key, as required to look
+// them up by key, and points the offset at the given position to it. The tables share a vtable.
+func appendFlatLabels(b []byte, base, at int, labels map[string]string) []byte {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	b = padTo(b, base, 4)
+	binary.LittleEndian.PutUint32(b[at:], uint32(len(b)-at))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(keys)))
+	offsets := len(b)
+	b = append(b, make([]byte, 4*len(keys))...)
+
+	vtable := len(b)
+	b = binary.LittleEndian.AppendUint16(b, uint16(4+2*flatLabelFieldCount))
+	b = binary.LittleEndian.AppendUint16(b, 12)
+	b = binary.LittleEndian.AppendUint16(b, 4)
+	b = binary.LittleEndian.AppendUint16(b, 8)
+	for i, key := range keys {
+		b = padTo(b, base, 4)
+		table := len(b)
+		binary.LittleEndian.PutUint32(b[offsets+4*i:], uint32(table-(offsets+4*i)))
+		b = binary.LittleEndian.AppendUint32(b, uint32(table-vtable))
+		b = append(b, make([]byte, 8)...)
+		b = appendFlatVector(b, base, table+4, []byte(key), true)
+		b = appendFlatVector(b, base, table+8, []byte(labels[key]), true)
+	}
+	return b
+}
+
+func padTo(b []byte, base, alignment int) []byte {
+	for (len(b)-base)%alignment != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func boolByte(v bool) byte {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+var errInvalidFlatBuffer = errors.New("invalid FlatBuffer")
+
+// flatEntry is an entry encoded with EncodingFlatBuffers, without its marker. Its accessors read the
+// fields in place; they assume the buffer was checked by verifyFlatEntry.
+type flatEntry []byte
+
+// verifyFlatEntry checks that the offsets and lengths of the buffer are within it, like the verifiers
+// of FlatBuffers, so that its fields can be read without bounds checks failing.
+func verifyFlatEntry(buf []byte) (flatEntry, error) {
+	f := flatEntry(buf)
+	if len(f) < 8 || string(f[4:8]) != flatBuffersIdentifier {
+		return nil, errInvalidFlatBuffer
+	}
+	table, ok := f.verifyTable(int(binary.LittleEndian.Uint32(f)), flatFieldCount)
+	if !ok {
+		return nil, errInvalidFlatBuffer
+	}
+	for _, field := range []struct{ slot, size int }{
+		{flatFieldLogSequenceNumber, 8}, {flatFieldCRC, 4}, {flatFieldIsCheckpoint, 1},
+		{flatFieldTimestamp, 8}, {flatFieldHLC, 8}, {flatFieldTombstone, 1}, {flatFieldSchemaVersion, 4},
+	} {
+		if at := f.field(table, field.slot); at > 0 && at+field.size > len(f) {
+			return nil, errInvalidFlatBuffer
+		}
+	}
+	for _, slot := range []int{flatFieldData, flatFieldMetadata, flatFieldStream, flatFieldKey,
+		flatFieldSchema, flatFieldBlob, flatFieldValuePointer} {
+		if _, ok := f.verifyVector(f.field(table, slot), 1); !ok {
+			return nil, errInvalidFlatBuffer
+		}
+	}
+
+	labels, ok := f.verifyVector(f.field(table, flatFieldLabels), 4)
+	if !ok {
+		return nil, errInvalidFlatBuffer
+	}
+	for i := 0; i < f.vectorLen(labels); i++ {
+		at := labels + 4 + 4*i
+		label, ok := f.verifyTable(at+int(binary.LittleEndian.Uint32(f[at:])), flatLabelFieldCount)
+		if !ok {
+			return nil, errInvalidFlatBuffer
+		}
+		for _, slot := range []int{flatLabelKey, flatLabelValue} {
+			if _, ok := f.verifyVector(f.field(label, slot), 1); !ok {
+				return nil, errInvalidFlatBuffer
+			}
+		}
+	}
+	return f, nil
+}
+
+// verifyTable checks the table at the given position and its vtable, and returns the position.
+func (f flatEntry) verifyTable(table, fields int) (int, bool) {
+	if table < 8 || table+4 > len(f) {
+		return 0, false
+	}
+	vtable := table - int(int32(binary.LittleEndian.Uint32(f[table:])))
+	if vtable < 0 || vtable+4 > len(f) {
+		return 0, false
+	}
+	size := int(binary.LittleEndian.Uint16(f[vtable:]))
+	if size < 4 || size%2 != 0 || vtable+size > len(f) || table+int(binary.LittleEndian.Uint16(f[vtable+2:])) > len(f) {
+		return 0, false
+	}
+	for slot := 0; slot < fields && 4+2*slot < size; slot++ {
+		if table+int(binary.LittleEndian.Uint16(f[vtable+4+2*slot:])) > len(f) {
+			return 0, false
+		}
+	}
+	return table, true
+}
+
+// verifyVector checks the vector whose offset is at the given position, if any, and returns its position.
+func (f flatEntry) verifyVector(at, elementSize int) (int, bool) {
+	if at == 0 {
+		return 0, true
+	}
+	if at+4 > len(f) {
+		return 0, false
+	}
+	vector := at + int(binary.LittleEndian.Uint32(f[at:]))
+	if vector+4 > len(f) || vector < at {
+		return 0, false
+	}
+	if int64(vector)+4+int64(binary.LittleEndian.Uint32(f[vector:]))*int64(elementSize) > int64(len(f)) {
+		return 0, false
+	}
+	return vector, true
+}
+
+func (f flatEntry) root() int {
+	return int(binary.LittleEndian.Uint32(f))
+}
+
+// field returns the position of the field in the table, or 0 if it is absent.
+func (f flatEntry) field(table, slot int) int {
+	vtable := table - int(int32(binary.LittleEndian.Uint32(f[table:])))
+	if 4+2*slot >= int(binary.LittleEndian.Uint16(f[vtable:])) {
+		return 0
+	}
+	offset := int(binary.LittleEndian.Uint16(f[vtable+4+2*slot:]))
+	if offset == 0 {
+		return 0
+	}
+	return table + offset
+}
+
+func (f flatEntry) vectorLen(vector int) int {
+	if vector == 0 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(f[vector:]))
+}
+
+// bytes returns the vector of bytes, or the string, of the field of the table, or nil if it is absent.
+func (f flatEntry) bytes(table, slot int) []byte {
+	at := f.field(table, slot)
+	if at == 0 {
+		return nil
+	}
+	vector := at + int(binary.LittleEndian.Uint32(f[at:]))
+	n := int(binary.LittleEndian.Uint32(f[vector:]))
+	if n == 0 {
+		return nil
+	}
+	return f[vector+4 : vector+4+n : vector+4+n]
+}
+
+func (f flatEntry) uint64(slot int) uint64 {
+	if at := f.field(f.root(), slot); at > 0 {
+		return binary.LittleEndian.Uint64(f[at:])
+	}
+	return 0
+}
+
+func (f flatEntry) uint32(slot int) uint32 {
+	if at := f.field(f.root(), slot); at > 0 {
+		return binary.LittleEndian.Uint32(f[at:])
+	}
+	return 0
+}
+
+// bool returns the value of the bool field, and whether it is present.
+func (f flatEntry) bool(slot int) (value, ok bool) {
+	if at := f.field(f.root(), slot); at > 0 {
+		return f[at] != 0, true
+	}
+	return false, false
+}
+
+// label returns the key and value of the i-th label, in key order.
+func (f flatEntry) label(i int) (key, value []byte) {
+	labels := f.field(f.root(), flatFieldLabels)
+	vector := labels + int(binary.LittleEndian.Uint32(f[labels:]))
+	at := vector + 4 + 4*i
+	table := at + int(binary.LittleEndian.Uint32(f[at:]))
+	return f.bytes(table, flatLabelKey), f.bytes(table, flatLabelValue)
+}
+
+func (f flatEntry) labelCount() int {
+	labels := f.field(f.root(), flatFieldLabels)
+	if labels == 0 {
+		return 0
+	}
+	return f.vectorLen(labels + int(binary.LittleEndian.Uint32(f[labels:])))
+}
+
+// The methods of inPlaceEntry.
+
+func (f flatEntry) lsn() uint64      { return f.uint64(flatFieldLogSequenceNumber) }
+func (f flatEntry) crc() uint32      { return f.uint32(flatFieldCRC) }
+func (f flatEntry) timestamp() int64 { return int64(f.uint64(flatFieldTimestamp)) }
+func (f flatEntry) hlc() uint64      { return f.uint64(flatFieldHLC) }
+func (f flatEntry) data() []byte     { return f.bytes(f.root(), flatFieldData) }
+func (f flatEntry) metadata() []byte { return f.bytes(f.root(), flatFieldMetadata) }
+func (f flatEntry) stream() []byte   { return f.bytes(f.root(), flatFieldStream) }
+func (f flatEntry) key() []byte      { return f.bytes(f.root(), flatFieldKey) }
+func (f flatEntry) schema() []byte   { return f.bytes(f.root(), flatFieldSchema) }
+func (f flatEntry) blob() []byte     { return f.bytes(f.root(), flatFieldBlob) }
+func (f flatEntry) valuePointer() []byte {
+	return f.bytes(f.root(), flatFieldValuePointer)
+}
+
+func (f flatEntry) schemaVersion() uint32 {
+	return f.uint32(flatFieldSchemaVersion)
+}
+
+func (f flatEntry) isCheckpoint() (value, ok bool) {
+	return f.bool(flatFieldIsCheckpoint)
+}
+
+func (f flatEntry) tombstone() bool {
+	tombstone, _ := f.bool(flatFieldTombstone)
+	return tombstone
+}
+
+// unmarshalFlatEntry decodes a record of EncodingFlatBuffers, without its marker, into the entry. Like
+// UnmarshalVT, the entry is reset first and doesn't share memory with data.
+func unmarshalFlatEntry(data []byte, entry *WAL_Entry) error {
+	f, err := verifyFlatEntry(data)
+	if err != nil {
+		return err
+	}
+	copyInPlaceEntry(f, ChecksumIEEE, entry)
+	return nil
+}
@@ -0,0 +1,160 @@
+package wal
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FS is the filesystem the WAL performs all of its file operations through.
+// The default is OSFS; other implementations make in-memory testing, fault injection
+// and remote or platform-specific backends possible without touching the WAL itself.
+type FS interface {
+	Create(name string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Rename(oldPath, newPath string) error
+	Remove(name string) error
+	MkdirAll(path string, perm os.FileMode) error
+	Glob(pattern string) ([]string, error)
+	Stat(name string) (os.FileInfo, error)
+}
+
+// File is an open file returned by an FS.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	// Sync commits the contents of the file to stable storage (fsync).
+	Sync() error
+}
+
+// WritebackFile is implemented by files that can start writing a range of their data back to stable
+// storage without waiting for it to complete, see WithWriteback. The files of OSFS support it on Linux,
+// with sync_file_range.
+type WritebackFile interface {
+	Writeback(offset, length int64) error
+}
+
+// DataSyncFile is implemented by files that can commit their data to stable storage without the
+// metadata that isn't needed to read it back, such as the modification time, see WithDataSync. The
+// files of OSFS support it on Linux, with fdatasync.
+type DataSyncFile interface {
+	DataSync() error
+}
+
+// CacheDropFS is implemented by filesystems that can drop the pages of a file from the page cache,
+// see WithDropSealedCache. OSFS implements it on Linux, with posix_fadvise(POSIX_FADV_DONTNEED).
+type CacheDropFS interface {
+	DropCache(path string) error
+}
+
+// LinkFS is implemented by filesystems that can create hard links, which Backup uses to include the sealed
+// segments without copying them. OSFS implements it.
+type LinkFS interface {
+	Link(oldPath, newPath string) error
+}
+
+// RemoveAllFS is implemented by filesystems that can remove a directory and its content at once.
+// OSFS implements it.
+type RemoveAllFS interface {
+	RemoveAll(path string) error
+}
+
+// removeAll removes path and its content, if it exists.
+func removeAll(fs FS, path string) error {
+	if f, ok := fs.(RemoveAllFS); ok {
+		return f.RemoveAll(path)
+	}
+	info, err := fs.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		files, err := fs.Glob(filepath.Join(path, "*"))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := removeAll(fs, file); err != nil {
+				return err
+			}
+		}
+	}
+	if err := fs.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// writeback starts the writeback of the given range of the file, or returns errors.ErrUnsupported.
+func writeback(file File, offset, length int64) error {
+	if f, ok := file.(WritebackFile); ok {
+		return f.Writeback(offset, length)
+	}
+	if f, ok := file.(interface{ Fd() uintptr }); ok {
+		return writebackFd(f.Fd(), offset, length)
+	}
+	return errors.ErrUnsupported
+}
+
+// datasync commits the data of the file to stable storage, with fdatasync if the file supports it, and
+// with Sync otherwise.
+func datasync(file File) error {
+	if f, ok := file.(DataSyncFile); ok {
+		return f.DataSync()
+	}
+	if f, ok := file.(interface{ Fd() uintptr }); ok {
+		if err := datasyncFd(f.Fd()); !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+// OSFS is the FS backed by the host operating system.
+type OSFS struct{}
+
+func (OSFS) Create(name string) (File, error) {
+	return os.Create(name)
+}
+
+func (OSFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (OSFS) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (OSFS) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (OSFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Link implements LinkFS.
+func (OSFS) Link(oldPath, newPath string) error {
+	return os.Link(oldPath, newPath)
+}
+
+// RemoveAll implements RemoveAllFS.
+func (OSFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package wal
+
+import "errors"
+
+// FreeSpace is not supported on this platform.
+func (OSFS) FreeSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
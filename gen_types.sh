@@ -1,3 +1,7 @@
 #!/bin/bash
 
-protoc --go_out=. --go_opt=paths=source_relative types.proto
\ No newline at end of file
+protoc --go_out=. --go_opt=paths=source_relative types.proto
+# types_noprotobuf.go declares WAL_Entry instead when building with the noprotobuf tag.
+sed -i '1i //go:build !noprotobuf\n' types.pb.go
+protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative replication/replication.proto
+protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative walservice/service.proto
@@ -0,0 +1,123 @@
+package wal
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+// maxCheckpointRequestSize limits the payload of checkpoints created through the admin endpoint.
+const maxCheckpointRequestSize = 1 << 20
+
+// HandlerOption configures the handler returned by Handler.
+type HandlerOption func(*handler)
+
+// WithAdminActions enables the endpoints of the handler that modify the WAL.
+func WithAdminActions() HandlerOption {
+	return func(h *handler) {
+		h.adminActions = true
+	}
+}
+
+type handler struct {
+	wal          *WAL
+	adminActions bool
+}
+
+// Handler returns an http.Handler serving the operational state of the WAL as JSON:
+//
+//	GET  /stats        Stats
+//	GET  /health       Health
+//	GET  /segments     the segment files and their LSN ranges
+//	GET  /checkpoints  the retained checkpoints, most recent first
+//	GET  /debug        DebugState
+//
+// With WithAdminActions, it also serves:
+//
+//	POST /rotate       rotates the log
+//	POST /checkpoint   creates a checkpoint with the request body as payload
+//
+// Paths are relative to the root of the handler; use http.StripPrefix to mount it in an existing mux:
+//
+//	mux.Handle("/wal/", http.StripPrefix("/wal", walog.Handler()))
+func (wal *WAL) Handler(opts ...HandlerOption) http.Handler {
+	h := &handler{wal: wal}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, wal.Stats())
+	})
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		status := wal.Health(r.Context())
+		code := http.StatusOK
+		if !status.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, status)
+	})
+	mux.HandleFunc("GET /segments", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, wal.DebugState().Segments)
+	})
+	mux.HandleFunc("GET /checkpoints", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, wal.Checkpoints())
+	})
+	mux.HandleFunc("GET /debug", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, wal.DebugState())
+	})
+
+	if h.adminActions {
+		mux.HandleFunc("POST /rotate", h.rotate)
+		mux.HandleFunc("POST /checkpoint", h.checkpoint)
+	}
+
+	return mux
+}
+
+func (h *handler) rotate(w http.ResponseWriter, r *http.Request) {
+	if err := h.wal.Rotate(); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"current_segment_index": h.wal.DebugState().CurrentSegmentIndex})
+}
+
+func (h *handler) checkpoint(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCheckpointRequestSize))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := h.wal.CreateCheckpoint(data); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	lsn, _, err := h.wal.LastCheckpoint()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]uint64{"log_sequence_number": lsn})
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, ErrClosed) {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error while writing response: %v", err)
+	}
+}
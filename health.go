@@ -0,0 +1,144 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	healthProbeFileName = "health.probe"
+	// staleSyncIntervals is how many sync intervals may pass without a successful
+	// flush or sync before Health reports the WAL as unhealthy.
+	staleSyncIntervals = 10
+)
+
+// HealthStatus is the result of a Health self-check, suitable for readiness probes.
+type HealthStatus struct {
+	Healthy bool          `json:"healthy"`
+	Checks  []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the result of a single check performed by Health.
+type HealthCheck struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// FreeSpaceFS is implemented by filesystems that can report the free space available at a path.
+// Health uses it to check disk headroom; the check is skipped for filesystems that don't implement it.
+type FreeSpaceFS interface {
+	FreeSpace(path string) (uint64, error)
+}
+
+// Health runs a self-check of the WAL. It verifies that the directory is writable,
+// that the last sync succeeded recently, that there is room on disk for at least one more
+// segment, and that no corruption has been detected while reading or repairing the log.
+// If ctx expires, the remaining checks are reported as failed.
+func (wal *WAL) Health(ctx context.Context) HealthStatus {
+	checks := []struct {
+		name  string
+		check func() error
+	}{
+		{"writable", wal.checkWritable},
+		{"sync", wal.checkSync},
+		{"disk_headroom", wal.checkDiskHeadroom},
+		{"corruption", wal.checkCorruption},
+	}
+
+	status := HealthStatus{Healthy: true}
+	for _, c := range checks {
+		err := ctx.Err()
+		if err == nil {
+			err = c.check()
+		}
+
+		check := HealthCheck{Name: c.name, Healthy: err == nil}
+		if err != nil {
+			check.Message = err.Error()
+			status.Healthy = false
+		}
+		status.Checks = append(status.Checks, check)
+	}
+
+	return status
+}
+
+// checkWritable creates and removes a probe file in the WAL directory.
+func (wal *WAL) checkWritable() error {
+	probePath := filepath.Join(wal.directory, healthProbeFileName)
+	file, err := wal.fs.OpenFile(probePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write([]byte("ok")); err != nil {
+		file.Close()
+		wal.fs.Remove(probePath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		wal.fs.Remove(probePath)
+		return err
+	}
+
+	return wal.fs.Remove(probePath)
+}
+
+// checkSync verifies the last background sync succeeded and that the buffer was synced recently.
+func (wal *WAL) checkSync() error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if wal.lastSyncErr != nil {
+		return fmt.Errorf("last sync failed: %v", wal.lastSyncErr)
+	}
+
+	// In PeriodicFlush mode the background goroutine only flushes, so a flush counts as well.
+	lastSync := wal.lastFlushTime
+	if lastSync.Before(wal.openedAt) {
+		lastSync = wal.openedAt
+	}
+
+	if since := wal.clock.Now().Sub(lastSync); since > staleSyncIntervals*wal.syncInterval {
+		return fmt.Errorf("no successful sync for %v", since)
+	}
+
+	return nil
+}
+
+// checkDiskHeadroom verifies there is room on disk for at least one more full segment.
+func (wal *WAL) checkDiskHeadroom() error {
+	freeSpaceFS, ok := wal.fs.(FreeSpaceFS)
+	if !ok {
+		return nil
+	}
+
+	free, err := freeSpaceFS.FreeSpace(wal.directory)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if free < uint64(wal.maxFileSize) {
+		return fmt.Errorf("only %d bytes free, need at least %d for the next segment", free, wal.maxFileSize)
+	}
+
+	return nil
+}
+
+// checkCorruption reports corruption detected while reading or repairing the log.
+func (wal *WAL) checkCorruption() error {
+	wal.corruptionLock.Lock()
+	defer wal.corruptionLock.Unlock()
+
+	if wal.corruptionErr != nil {
+		return fmt.Errorf("corruption detected: %v", wal.corruptionErr)
+	}
+
+	return nil
+}
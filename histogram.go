@@ -0,0 +1,107 @@
+package wal
+
+import "time"
+
+// latencyBuckets are the upper bounds of the buckets of latency histograms.
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+}
+
+// writeLatencyBuckets extend latencyBuckets with finer buckets for buffered writes,
+// which usually complete in microseconds.
+var writeLatencyBuckets = append([]time.Duration{
+	time.Microsecond,
+	2500 * time.Nanosecond,
+	5 * time.Microsecond,
+	10 * time.Microsecond,
+	25 * time.Microsecond,
+	50 * time.Microsecond,
+}, latencyBuckets...)
+
+// Histogram is a fixed-bucket histogram of durations.
+type Histogram struct {
+	// Bounds are the inclusive upper bounds of the buckets.
+	Bounds []time.Duration `json:"bounds"`
+	// Counts holds the number of observations per bucket (not cumulative).
+	// It has one more element than Bounds, counting the observations above the last bound.
+	Counts []uint64 `json:"counts"`
+	// Count is the total number of observations.
+	Count uint64 `json:"count"`
+	// Sum is the sum of all observations.
+	Sum time.Duration `json:"sum"`
+}
+
+func newLatencyHistogram() Histogram {
+	return newHistogram(latencyBuckets)
+}
+
+func newHistogram(bounds []time.Duration) Histogram {
+	return Histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// observe records a single duration.
+func (h *Histogram) observe(d time.Duration) {
+	bucket := len(h.Bounds)
+	for i, bound := range h.Bounds {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+
+	h.Counts[bucket]++
+	h.Count++
+	h.Sum += d
+}
+
+// clone returns a copy of the histogram that doesn't share its counts.
+func (h Histogram) clone() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// Quantile estimates the duration below which the given fraction (0 to 1) of observations fall,
+// interpolating linearly within the bucket that contains it. Observations above the last bound
+// are reported as the last bound. It returns 0 if there are no observations.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+
+	rank := q * float64(h.Count)
+	var cumulative uint64
+	for i, count := range h.Counts {
+		if count == 0 || float64(cumulative+count) < rank {
+			cumulative += count
+			continue
+		}
+		if i == len(h.Bounds) {
+			return h.Bounds[len(h.Bounds)-1]
+		}
+
+		var lower time.Duration
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		}
+		fraction := (rank - float64(cumulative)) / float64(count)
+		return lower + time.Duration(fraction*float64(h.Bounds[i]-lower))
+	}
+
+	return h.Bounds[len(h.Bounds)-1]
+}
@@ -0,0 +1,152 @@
+package wal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// hlcLogicalBits is the number of bits of an HLC holding its logical counter.
+const hlcLogicalBits = 16
+
+// HLC is a hybrid logical clock timestamp: the physical time in milliseconds since the Unix epoch in its
+// high 48 bits, and a logical counter in its low 16 bits, which orders the events of the same millisecond.
+// HLCs compare like integers, and the order of the HLCs of entries is consistent with causality across
+// the WALs that exchange them, see WithHybridClock and WAL.ObserveHLC.
+type HLC uint64
+
+// NewHLC returns the HLC with the given physical time, truncated to the millisecond, and logical counter.
+func NewHLC(physical time.Time, logical uint16) HLC {
+	return HLC(physical.UnixMilli())<<hlcLogicalBits | HLC(logical)
+}
+
+// Physical returns the physical time of the timestamp.
+func (t HLC) Physical() time.Time {
+	return time.UnixMilli(int64(t >> hlcLogicalBits))
+}
+
+// Logical returns the logical counter of the timestamp.
+func (t HLC) Logical() uint16 {
+	return uint16(t)
+}
+
+// String returns the physical time of the timestamp in RFC 3339 format, followed by its logical counter.
+func (t HLC) String() string {
+	return fmt.Sprintf("%s+%d", t.Physical().UTC().Format("2006-01-02T15:04:05.000Z07:00"), t.Logical())
+}
+
+// HLC returns the hybrid logical clock timestamp of the entry, or 0 if it has none.
+func (x *WAL_Entry) HLC() HLC {
+	return HLC(x.GetHlc())
+}
+
+// CompareHLC orders entries by HLC, then by sequence number, e.g. to merge the entries of several WALs
+// with slices.SortFunc. It returns a negative number if a is before b, a positive one if it is after b.
+func CompareHLC(a, b *WAL_Entry) int {
+	switch {
+	case a.GetHlc() < b.GetHlc():
+		return -1
+	case a.GetHlc() > b.GetHlc():
+		return 1
+	case a.GetLogSequenceNumber() < b.GetLogSequenceNumber():
+		return -1
+	case a.GetLogSequenceNumber() > b.GetLogSequenceNumber():
+		return 1
+	}
+	return 0
+}
+
+// WithHLC sets the hybrid logical clock timestamp of the entry, e.g. to keep the timestamp of an entry
+// copied from another WAL. A WAL with a hybrid clock observes it, see WAL.ObserveHLC, instead of
+// stamping the entry.
+func WithHLC(t HLC) EntryOption {
+	return func(entry *WAL_Entry) {
+		entry.Hlc = uint64(t)
+	}
+}
+
+// hybridClock is the hybrid logical clock of a WAL opened WithHybridClock.
+// It is shared by the partitions of a PartitionedWAL, so it has its own lock.
+type hybridClock struct {
+	clock Clock
+	lock  sync.Mutex
+	last  HLC
+}
+
+// now returns a timestamp greater than every timestamp returned or observed before.
+func (c *hybridClock) now() HLC {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// A logical counter overflowing carries into the physical time, which keeps timestamps increasing.
+	c.last = max(c.last+1, NewHLC(c.clock.Now(), 0))
+	return c.last
+}
+
+// observe makes the timestamps returned afterwards greater than t.
+func (c *hybridClock) observe(t HLC) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.last = max(c.last, t)
+}
+
+// HLC returns a new hybrid logical clock timestamp, greater than the timestamps of the entries written
+// so far, e.g. to send along with a message to another node, which then observes it with ObserveHLC.
+// It returns 0 if the WAL wasn't opened WithHybridClock.
+func (wal *WAL) HLC() HLC {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if wal.hybridClock == nil {
+		return 0
+	}
+	return wal.hybridClock.now()
+}
+
+// ObserveHLC merges a timestamp received from another node or WAL into the hybrid clock of the WAL,
+// so that the entries written afterwards are ordered after it. It does nothing if the WAL wasn't opened
+// WithHybridClock.
+func (wal *WAL) ObserveHLC(t HLC) {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if wal.hybridClock != nil {
+		wal.hybridClock.observe(t)
+	}
+}
+
+// stampHLC sets the HLC of the entry if it has none, or observes it otherwise.
+// The caller must hold wal.lock.
+func (wal *WAL) stampHLC(entry *WAL_Entry) {
+	if wal.hybridClock == nil {
+		return
+	}
+	if t := entry.HLC(); t != 0 {
+		wal.hybridClock.observe(t)
+		return
+	}
+	entry.Hlc = uint64(wal.hybridClock.now())
+}
+
+// newHybridClock returns the hybrid clock of the WAL, which starts after the HLCs of the entries of the
+// segment holding the last entry, so that timestamps keep increasing across restarts even if the physical
+// clock went backwards. The whole segment is read as entries written WithHLC may have older timestamps.
+func (wal *WAL) newHybridClock() (*hybridClock, error) {
+	c := &hybridClock{clock: wal.clock}
+	if wal.lastSequenceNo == 0 {
+		return c, nil
+	}
+
+	tail, err := NewTail(wal.directory, wal.lastSequenceNo, WithFS(wal.fs))
+	if err != nil {
+		return nil, err
+	}
+	defer tail.Stop()
+	tail.fromLSN = 0
+	err = tail.Read(func(entry *WAL_Entry) error {
+		c.observe(entry.HLC())
+		return nil
+	})
+	return c, err
+}
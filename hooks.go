@@ -0,0 +1,23 @@
+package wal
+
+import "time"
+
+// Hooks are callbacks invoked on WAL lifecycle events. Any of them may be nil.
+//
+// Hooks are called synchronously from the goroutine performing the operation, in most cases
+// while the WAL's lock is held: they must return quickly and must not call back into the WAL.
+type Hooks struct {
+	// OnSync is called after the buffer has been flushed and, if fsync is enabled, synced,
+	// with the duration of the whole sync.
+	OnSync func(duration time.Duration)
+	// OnRotate is called after the log has been rotated, with the index of the new segment.
+	OnRotate func(segment int)
+	// OnSegmentDelete is called after the oldest segment has been deleted because of the segment limit.
+	OnSegmentDelete func(path string)
+	// OnCheckpoint is called after a checkpoint has been made durable.
+	OnCheckpoint func(logSequenceNumber uint64)
+	// OnRepair is called after Repair has truncated a segment, with the number of entries kept.
+	OnRepair func(path string, entriesKept int)
+	// OnCorruptionDetected is called when corrupted data is detected while reading or repairing the log.
+	OnCorruptionDetected func(event CorruptionEvent)
+}
@@ -0,0 +1,76 @@
+package wal
+
+// FormatVersion is the version of the on-disk format written by this package. In version 1, segments
+// start with a header recording the checksum and the encoding of their entries, followed by the entries,
+// each preceded by its size as a little-endian int32. Segments written before headers existed start with
+// their first entry instead.
+const FormatVersion = 1
+
+// DirInfo describes the contents of a WAL directory, see InspectDir.
+type DirInfo struct {
+	Directory     string `json:"directory"`
+	FormatVersion int    `json:"format_version"`
+	// Segments are the reports of the segments, as returned by Verify.
+	Segments            []SegmentReport `json:"segments"`
+	TotalSize           int64           `json:"total_size"`
+	Entries             int             `json:"entries"`
+	FirstSequenceNumber uint64          `json:"first_sequence_number,omitempty"`
+	LastSequenceNumber  uint64          `json:"last_sequence_number,omitempty"`
+	// LastCheckpoint is the most recent checkpoint recorded in the checkpoint file, if any.
+	LastCheckpoint *CheckpointInfo `json:"last_checkpoint,omitempty"`
+	// ConsumerOffsets are the offsets committed by consumers, if any.
+	ConsumerOffsets map[string]uint64 `json:"consumer_offsets,omitempty"`
+	// Corrupt is set if any segment has a corrupt range or could not be read.
+	Corrupt bool `json:"corrupt"`
+}
+
+// InspectDir scans the WAL in the directory and describes its segments, LSN ranges, sizes,
+// entry counts, last checkpoint and consumer offsets, without opening it.
+// The only option used is WithFS.
+func InspectDir(directory string, opts ...Option) (*DirInfo, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	report, err := Verify(directory, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &DirInfo{
+		Directory:     directory,
+		FormatVersion: FormatVersion,
+		Segments:      report.Segments,
+		Corrupt:       report.Corrupt,
+	}
+	for _, segment := range report.Segments {
+		info.TotalSize += segment.Size
+		info.Entries += segment.Entries
+		if segment.Entries == 0 {
+			continue
+		}
+		if info.FirstSequenceNumber == 0 {
+			info.FirstSequenceNumber = segment.FirstSequenceNumber
+		}
+		info.LastSequenceNumber = segment.LastSequenceNumber
+	}
+
+	checkpoints, err := loadCheckpoints(o.fs, directory)
+	if err != nil {
+		return info, err
+	}
+	if len(checkpoints) > 0 {
+		lastCheckpoint := checkpoints[len(checkpoints)-1]
+		info.LastCheckpoint = &CheckpointInfo{
+			LogSequenceNumber: lastCheckpoint.GetLogSequenceNumber(),
+			Data:              lastCheckpoint.GetData(),
+		}
+	}
+
+	if info.ConsumerOffsets, err = loadConsumerOffsets(o.fs, directory); err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
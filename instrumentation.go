@@ -0,0 +1,51 @@
+package wal
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Instrumentation traces and measures the operations of a WAL, see WithInstrumentation. The walotel
+// package implements it with OpenTelemetry, so that the wal package doesn't depend on a tracing or
+// metrics library.
+type Instrumentation interface {
+	// StartSpan starts a span for an operation of the WAL, such as "wal.WriteEntry" or "wal.Sync".
+	// The WAL API doesn't take contexts, so spans are started as roots.
+	StartSpan(name string, attrs ...slog.Attr) Span
+	// RecordFsync records the duration of an fsync of a segment file.
+	RecordFsync(duration time.Duration)
+	// RegisterStats exposes the Stats returned by stats, e.g. as metrics observed on collection, until
+	// the returned function is called, when the WAL is closed.
+	RegisterStats(stats func() Stats) (unregister func(), err error)
+}
+
+// Span is an operation of a WAL traced by an Instrumentation.
+type Span interface {
+	SetAttributes(attrs ...slog.Attr)
+	// End ends the span, recording err if it isn't nil.
+	End(err error)
+}
+
+// noopSpan is the Span of the WALs without instrumentation.
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...slog.Attr) {}
+func (noopSpan) End(error)                  {}
+
+// startSpan starts a span for a WAL operation, which records nothing without instrumentation.
+func (wal *WAL) startSpan(name string, attrs ...slog.Attr) Span {
+	if wal.instrumentation == nil {
+		return noopSpan{}
+	}
+	return wal.instrumentation.StartSpan(name, attrs...)
+}
+
+// registerStats exposes the Stats of the WAL through its instrumentation, if any.
+func (wal *WAL) registerStats() error {
+	if wal.instrumentation == nil {
+		return nil
+	}
+	var err error
+	wal.unregisterStats, err = wal.instrumentation.RegisterStats(wal.Stats)
+	return err
+}
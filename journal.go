@@ -0,0 +1,120 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// adminJournalFileName is the append-only journal of administrative operations, see WithAdminJournal.
+const adminJournalFileName = "admin-journal"
+
+// Operations recorded in the admin journal.
+const (
+	AdminOpRepair          = "repair"
+	AdminOpTruncateSegment = "truncate_segment"
+	AdminOpDeleteSegment   = "delete_segment"
+	AdminOpRotate          = "rotate"
+	AdminOpTruncateBefore  = "truncate_before"
+	AdminOpCompact         = "compact"
+	AdminOpTruncateAfter   = "truncate_after"
+	AdminOpCollectBlobs    = "collect_blobs"
+	AdminOpCollectValueLog = "collect_value_log"
+	AdminOpBackup          = "backup"
+)
+
+// AdminRecord is an entry of the admin journal.
+type AdminRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	// Path is the file the operation applied to, if any.
+	Path    string `json:"path,omitempty"`
+	Details string `json:"details,omitempty"`
+	// Error is the error the operation failed with, empty if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// Succeeded reports whether the operation succeeded.
+func (r AdminRecord) Succeeded() bool {
+	return r.Error == ""
+}
+
+// recordAdmin appends a record of an administrative operation to the admin journal, if it is enabled.
+// Failing to write the journal doesn't fail the operation; the error is logged instead.
+func (wal *WAL) recordAdmin(operation, path, details string, opErr error) {
+	if !wal.adminJournal {
+		return
+	}
+
+	record := AdminRecord{Time: wal.clock.Now(), Operation: operation, Path: path, Details: details}
+	if opErr != nil {
+		record.Error = opErr.Error()
+	}
+
+	if err := wal.appendAdminRecord(record); err != nil {
+		log.Printf("Error while writing admin journal: %v", err)
+	}
+}
+
+func (wal *WAL) appendAdminRecord(record AdminRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	wal.journalLock.Lock()
+	defer wal.journalLock.Unlock()
+
+	file, err := wal.fs.OpenFile(filepath.Join(wal.directory, adminJournalFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// AdminJournal returns the records of the admin journal, oldest first. The journal records destructive
+// and administrative operations (repairs, truncations, compactions, retention deletions, manual
+// rotations) when enabled with WithAdminJournal, so that what tooling did can be reconstructed after an incident.
+// A partially written last record, left by a crash, is ignored.
+func (wal *WAL) AdminJournal() ([]AdminRecord, error) {
+	wal.journalLock.Lock()
+	defer wal.journalLock.Unlock()
+
+	file, err := wal.fs.OpenFile(filepath.Join(wal.directory, adminJournalFileName), os.O_RDONLY, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []AdminRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AdminRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			if !scanner.Scan() {
+				break
+			}
+			return records, fmt.Errorf("could not read admin journal: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
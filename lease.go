@@ -0,0 +1,197 @@
+package wal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// leaseFileName is the side-file recording which process holds the right to write the WAL, see WithLease.
+const leaseFileName = "lease"
+
+// ErrLeaseHeld is returned by OpenWAL with WithLease when another holder has an unexpired lease.
+var ErrLeaseHeld = errors.New("wal lease is held by another writer")
+
+// ErrFenced is returned by writes and syncs once the lease of the WAL has been taken over by another
+// writer, for instance because this process was paused for longer than the lease duration.
+// The WAL must be closed: nothing is written to the segment files anymore.
+var ErrFenced = errors.New("wal writer was fenced by a newer lease")
+
+// Lease is the content of the lease side-file.
+type Lease struct {
+	// Epoch is incremented every time the lease is acquired, so that a writer that lost the lease
+	// can tell, even if it is acquired again by a holder with the same name.
+	Epoch   uint64    `json:"epoch"`
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// ReadLease returns the lease recorded in the WAL directory, or a zero Lease if none was ever acquired.
+// The only option used is WithFS.
+func ReadLease(directory string, opts ...Option) (Lease, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return readLease(o.fs, directory)
+}
+
+// Lease returns the lease held by the WAL, and ErrFenced if it was lost.
+// It returns a zero Lease if the WAL wasn't opened WithLease.
+func (wal *WAL) Lease() (Lease, error) {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	return wal.lease, wal.leaseErr
+}
+
+func readLease(fs FS, directory string) (Lease, error) {
+	var lease Lease
+	file, err := fs.OpenFile(filepath.Join(directory, leaseFileName), os.O_RDONLY, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lease, nil
+		}
+		return lease, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&lease); err != nil {
+		return lease, fmt.Errorf("could not read lease file: %v", err)
+	}
+	return lease, nil
+}
+
+// writeLease atomically replaces the lease side-file.
+func writeLease(fs FS, directory string, lease Lease) error {
+	filePath := filepath.Join(directory, leaseFileName)
+	tempFilePath := fmt.Sprintf("%s.tmp", filePath)
+
+	tempFile, err := fs.OpenFile(tempFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(tempFile).Encode(lease); err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	// The side-file must be durable before it replaces the previous one.
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return fs.Rename(tempFilePath, filePath)
+}
+
+// acquireLease takes the lease of the WAL directory for holder, unless another holder has an unexpired lease.
+func acquireLease(fs FS, clock Clock, directory, holder string, duration time.Duration) (Lease, error) {
+	current, err := readLease(fs, directory)
+	if err != nil {
+		return Lease{}, err
+	}
+	now := clock.Now()
+	if current.Holder != holder && current.Expires.After(now) {
+		return Lease{}, fmt.Errorf("%w: %q holds epoch %d until %s", ErrLeaseHeld, current.Holder, current.Epoch, current.Expires.Format(time.RFC3339))
+	}
+
+	lease := Lease{Epoch: current.Epoch + 1, Holder: holder, Expires: now.Add(duration)}
+	if err := writeLease(fs, directory, lease); err != nil {
+		return Lease{}, err
+	}
+
+	// Another writer may have replaced the lease concurrently: the last one written wins.
+	if current, err = readLease(fs, directory); err != nil {
+		return Lease{}, err
+	}
+	if current.Epoch != lease.Epoch || current.Holder != holder {
+		return Lease{}, fmt.Errorf("%w: %q acquired epoch %d concurrently", ErrLeaseHeld, current.Holder, current.Epoch)
+	}
+	return lease, nil
+}
+
+// checkLease verifies that the lease file still records the lease of the WAL, and fences the WAL
+// otherwise. It is called before anything is written to the segment files.
+// The caller must hold wal.lock.
+func (wal *WAL) checkLease() error {
+	if wal.leaseDuration == 0 || wal.leaseErr != nil {
+		return wal.leaseErr
+	}
+
+	current, err := readLease(wal.fs, wal.directory)
+	if err != nil {
+		return err
+	}
+	if current.Epoch != wal.lease.Epoch || current.Holder != wal.lease.Holder {
+		wal.leaseErr = fmt.Errorf("%w: %q holds epoch %d, this writer held epoch %d", ErrFenced, current.Holder, current.Epoch, wal.lease.Epoch)
+		wal.logEvent(slog.LevelError, EventLeaseLost,
+			slog.Uint64("epoch", wal.lease.Epoch),
+			slog.String("holder", current.Holder),
+			slog.Uint64("new_epoch", current.Epoch))
+	}
+	return wal.leaseErr
+}
+
+// renewLease extends the lease of the WAL, unless it was lost.
+// The caller must hold wal.lock.
+func (wal *WAL) renewLease() error {
+	if err := wal.checkLease(); err != nil {
+		return err
+	}
+
+	lease := wal.lease
+	lease.Expires = wal.clock.Now().Add(wal.leaseDuration)
+	if err := writeLease(wal.fs, wal.directory, lease); err != nil {
+		return err
+	}
+	wal.lease = lease
+	return nil
+}
+
+// keepLease renews the lease every third of its duration until the WAL is closed.
+func (wal *WAL) keepLease(timer Timer) {
+	defer timer.Stop()
+	for {
+		select {
+		case <-wal.ctx.Done():
+			return
+		case <-timer.C():
+			wal.lock.Lock()
+			if wal.ctx.Err() != nil {
+				// The WAL was closed, and the lease released, while waiting for the lock.
+				wal.lock.Unlock()
+				return
+			}
+			err := wal.renewLease()
+			wal.lock.Unlock()
+			if errors.Is(err, ErrFenced) {
+				return
+			}
+			timer.Reset(wal.leaseDuration / 3)
+		}
+	}
+}
+
+// releaseLease lets the lease expire immediately, so that another writer can take over without waiting.
+// The caller must hold wal.lock.
+func (wal *WAL) releaseLease() error {
+	if wal.leaseDuration == 0 {
+		return nil
+	}
+	if err := wal.checkLease(); errors.Is(err, ErrFenced) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	lease := wal.lease
+	lease.Expires = wal.clock.Now()
+	return writeLease(wal.fs, wal.directory, lease)
+}
@@ -0,0 +1,299 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrBudgetExceeded is returned by writes that would take a Manager over its byte budget.
+var ErrBudgetExceeded = errors.New("byte budget exceeded")
+
+// byteBudget accounts for the bytes written by a WAL. admit is called before an entry is staged, without
+// holding any lock, and may delay or reject it, given its approximate size. reserve is called before
+// the entry is written and may reject it, release is called when bytes are removed from disk.
+type byteBudget interface {
+	admit(n int64) error
+	reserve(n int64) error
+	release(n int64)
+}
+
+// Manager owns a root directory and hands out an independent WAL per namespace,
+// each stored in a subdirectory named after the namespace.
+// All WALs of a Manager share one sync scheduler and, optionally, one byte budget. Every namespace may
+// also have a Quota of its own.
+type Manager struct {
+	root        string
+	enableFsync bool
+	maxFileSize int64
+	maxSegments int
+	walOptions  []Option
+	fs          FS
+	clock       Clock
+
+	// byteLimit is the maximum number of bytes all namespaces may use on disk, 0 means unlimited.
+	budgetLock   sync.Mutex
+	byteLimit    int64
+	bytesUsed    int64
+	defaultQuota Quota
+	quotas       map[string]Quota
+	usage        map[string]*namespaceUsage
+
+	lock   sync.Mutex
+	wals   map[string]*WAL
+	closed bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// ManagerOption configures optional behaviour of a Manager.
+type ManagerOption func(*Manager)
+
+// WithWALOptions sets the options used to open the WAL of every namespace.
+// The clock and sync interval are also used by the shared sync scheduler.
+func WithWALOptions(opts ...Option) ManagerOption {
+	return func(m *Manager) {
+		m.walOptions = append(m.walOptions, opts...)
+	}
+}
+
+// WithByteBudget limits the number of bytes all namespaces together may use on disk.
+// Writes that would exceed it fail with ErrBudgetExceeded until segments are deleted by retention
+// or namespaces are deleted.
+func WithByteBudget(bytes int64) ManagerOption {
+	return func(m *Manager) {
+		m.byteLimit = bytes
+	}
+}
+
+// NewManager creates a Manager for the given root directory, creating it if it doesn't exist.
+// enableFsync, maxFileSize and maxSegments are applied to the WAL of every namespace, see OpenWAL.
+func NewManager(root string, enableFsync bool, maxFileSize int64, maxSegments int, opts ...ManagerOption) (*Manager, error) {
+	m := &Manager{
+		root:        root,
+		enableFsync: enableFsync,
+		maxFileSize: maxFileSize,
+		maxSegments: maxSegments,
+		wals:        make(map[string]*WAL),
+		quotas:      make(map[string]Quota),
+		usage:       make(map[string]*namespaceUsage),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	o := defaultOptions()
+	for _, opt := range m.walOptions {
+		opt(&o)
+	}
+	m.fs = o.fs
+	m.clock = o.clock
+
+	if err := m.fs.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	// Account for the data already on disk in every namespace.
+	namespaces, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, namespace := range namespaces {
+		size, err := m.namespaceSize(namespace)
+		if err != nil {
+			return nil, err
+		}
+		m.bytesUsed += size
+		m.usageOf(namespace).bytesUsed = size
+	}
+
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	go m.keepSyncing(newTicker(o.clock, o.syncInterval, o.syncJitter))
+
+	return m, nil
+}
+
+// Get returns the WAL of the given namespace, opening (and creating) it if needed.
+func (m *Manager) Get(namespace string) (*WAL, error) {
+	if err := validateNamespace(namespace); err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+	if wal, ok := m.wals[namespace]; ok {
+		return wal, nil
+	}
+
+	opts := append(m.walOptions[:len(m.walOptions):len(m.walOptions)], func(o *options) {
+		o.backgroundSync = false
+		o.budget = &namespaceBudget{manager: m, namespace: namespace}
+	})
+	wal, err := OpenWAL(filepath.Join(m.root, namespace), m.enableFsync, m.maxFileSize, m.maxSegments, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	m.wals[namespace] = wal
+	return wal, nil
+}
+
+// List returns the namespaces that exist under the root directory, whether they are open or not.
+func (m *Manager) List() ([]string, error) {
+	files, err := m.fs.Glob(filepath.Join(m.root, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []string
+	for _, file := range files {
+		fileInfo, err := m.fs.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if fileInfo.IsDir() {
+			namespaces = append(namespaces, filepath.Base(file))
+		}
+	}
+
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// Delete closes the WAL of the given namespace, if open, and removes its directory.
+func (m *Manager) Delete(namespace string) error {
+	if err := validateNamespace(namespace); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if wal, ok := m.wals[namespace]; ok {
+		if err := wal.Close(); err != nil {
+			return err
+		}
+		delete(m.wals, namespace)
+	}
+
+	size, err := m.namespaceSize(namespace)
+	if err != nil {
+		return err
+	}
+
+	// The namespace may hold directories too, such as the blobs and the value log.
+	if err := removeAll(m.fs, filepath.Join(m.root, namespace)); err != nil {
+		return err
+	}
+
+	m.budgetLock.Lock()
+	m.bytesUsed = max(m.bytesUsed-size, 0)
+	delete(m.usage, namespace)
+	m.budgetLock.Unlock()
+	return nil
+}
+
+// BytesUsed returns the number of bytes accounted against the byte budget across all namespaces.
+func (m *Manager) BytesUsed() int64 {
+	m.budgetLock.Lock()
+	defer m.budgetLock.Unlock()
+
+	return m.bytesUsed
+}
+
+// Close closes the WALs of all namespaces and stops the shared sync scheduler.
+func (m *Manager) Close() error {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return ErrClosed
+	}
+	m.closed = true
+	m.lock.Unlock()
+
+	// The scheduler takes the lock, so it must be stopped before the lock is held again.
+	m.cancel()
+	<-m.done
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var errs []error
+	for namespace, wal := range m.wals {
+		if err := wal.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("could not close namespace %s: %v", namespace, err))
+		}
+	}
+	m.wals = nil
+
+	return errors.Join(errs...)
+}
+
+// keepSyncing is the sync scheduler shared by all WALs of the manager.
+func (m *Manager) keepSyncing(ticker *ticker) {
+	defer close(m.done)
+	defer ticker.stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			// The WALs are synced without holding the lock, so that the other namespaces can be opened
+			// and deleted meanwhile. A WAL closed since is skipped, and Close waits for a sync in progress.
+			m.lock.Lock()
+			wals := make([]*WAL, 0, len(m.wals))
+			for _, wal := range m.wals {
+				wals = append(wals, wal)
+			}
+			m.lock.Unlock()
+			for _, wal := range wals {
+				if !wal.beginWrite() {
+					continue
+				}
+				wal.periodicSync()
+				wal.writers.Done()
+			}
+			ticker.advance()
+
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// namespaceSize returns the size of the segment files of the given namespace.
+func (m *Manager) namespaceSize(namespace string) (int64, error) {
+	files, err := m.fs.Glob(filepath.Join(m.root, namespace, segmentPrefix+"*"))
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, file := range files {
+		fileInfo, err := m.fs.Stat(file)
+		if err != nil {
+			return 0, err
+		}
+		size += fileInfo.Size()
+	}
+
+	return size, nil
+}
+
+// validateNamespace ensures the namespace maps to a single directory directly under the root.
+func validateNamespace(namespace string) error {
+	if namespace == "" || namespace == "." || namespace == ".." || strings.ContainsAny(namespace, `/\`) {
+		return fmt.Errorf("invalid namespace %q", namespace)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package wal
+
+import (
+	"time"
+)
+
+// MetricsSnapshot is a serializable snapshot of the WAL's metrics, including per-segment metrics,
+// for orchestration tooling that alerts on the state of individual segments.
+type MetricsSnapshot struct {
+	// Time is when the snapshot was taken, according to the WAL's clock.
+	Time     time.Time        `json:"time"`
+	Stats    Stats            `json:"stats"`
+	Segments []SegmentMetrics `json:"segments"`
+}
+
+// SegmentMetrics describes a single log segment file at the time of a MetricsSnapshot.
+type SegmentMetrics struct {
+	SegmentState
+	// Active is set for the segment currently being written to.
+	Active bool `json:"active"`
+	// ModTime is when the segment was last modified. For inactive segments,
+	// this is approximately when they were rotated out.
+	ModTime time.Time `json:"mod_time"`
+	// Age is the time elapsed since ModTime.
+	Age time.Duration `json:"age"`
+}
+
+// MetricsSnapshot returns the Stats of the WAL along with the size, age and entry count of every segment.
+// Segments are scanned to count their entries, so it is more expensive than Stats.
+// As with DebugState, entries that are still buffered are not reflected in the segment metrics.
+func (wal *WAL) MetricsSnapshot() (MetricsSnapshot, error) {
+	snapshot := MetricsSnapshot{Stats: wal.Stats()}
+
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return MetricsSnapshot{}, err
+	}
+
+	wal.lock.Lock()
+	currentSegmentIndex := wal.currentSegmentIndex
+	wal.lock.Unlock()
+
+	snapshot.Time = wal.clock.Now()
+	for _, segment := range segments {
+		metrics := SegmentMetrics{
+			SegmentState: wal.segmentState(segment),
+			Active:       segment.index == currentSegmentIndex,
+		}
+		if fileInfo, err := wal.fs.Stat(segment.path); err == nil {
+			metrics.ModTime = fileInfo.ModTime()
+			metrics.Age = snapshot.Time.Sub(metrics.ModTime)
+		}
+		snapshot.Segments = append(snapshot.Segments, metrics)
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,479 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MirrorPolicy selects how a WAL mirrored with WithMirror handles failures of its mirror directory.
+type MirrorPolicy int
+
+const (
+	// MirrorRequireBoth fails writes, syncs and file operations unless they succeed in both directories,
+	// so that a synced entry is always on both disks.
+	MirrorRequireBoth MirrorPolicy = iota
+	// MirrorAllowDegraded detaches the mirror directory when an operation fails in it, logging
+	// EventMirrorDetached, and keeps writing to the WAL directory only, until the WAL is reopened.
+	MirrorAllowDegraded
+)
+
+// MirrorStats reports the state of the mirror directory set with WithMirror.
+type MirrorStats struct {
+	Directory string `json:"directory"`
+	// Detached is set once the mirror was detached after a failure, see MirrorAllowDegraded.
+	Detached bool `json:"detached"`
+	// Error is the error that detached the mirror.
+	Error string `json:"error,omitempty"`
+}
+
+// mirrorFS is an FS writing the files of the WAL directory to a mirror directory as well.
+// Reads are served by the WAL directory.
+type mirrorFS struct {
+	FS
+	directory string
+	mirror    string
+	policy    MirrorPolicy
+
+	lock     sync.Mutex
+	err      error       // error that detached the mirror, nil while it is attached
+	onDetach func(error) // called when the mirror is detached
+}
+
+// newMirrorFS returns an FS mirroring the files of directory to mirror, after copying the files that
+// differ between them to the mirror, e.g. when the mirror is a replaced disk.
+func newMirrorFS(fs FS, directory, mirror string, policy MirrorPolicy) (*mirrorFS, error) {
+	m := &mirrorFS{FS: fs, directory: filepath.Clean(directory), mirror: filepath.Clean(mirror), policy: policy}
+	if err := m.mirrorErr(m.resilver()); err != nil {
+		return nil, fmt.Errorf("could not copy the wal to mirror %s: %w", mirror, err)
+	}
+	return m, nil
+}
+
+// resilver makes the files of the mirror match the files of the directory, including those of its
+// subdirectories such as the blobs and the value log. Segments are rewritten by compaction and
+// truncation, so a file is copied unless its copy has the same size and checksum.
+func (m *mirrorFS) resilver() error {
+	files, dirs, err := m.walk(m.directory)
+	if err != nil {
+		return err
+	}
+	mirroredDirs := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		mirrorPath, _ := m.mirrorPath(dir)
+		mirroredDirs[mirrorPath] = true
+		if err := m.FS.MkdirAll(mirrorPath, 0755); err != nil {
+			return err
+		}
+	}
+	mirrored := make(map[string]bool, len(files))
+	for _, file := range files {
+		mirrorPath, _ := m.mirrorPath(file)
+		mirrored[mirrorPath] = true
+		same, err := m.sameContents(file, mirrorPath)
+		if err != nil {
+			return err
+		}
+		if same {
+			continue
+		}
+		if err := m.copyFile(file, mirrorPath); err != nil {
+			return err
+		}
+	}
+
+	// Files deleted while the mirror was detached, e.g. by retention, are deleted from it as well.
+	mirrorFiles, mirrorDirs, err := m.walk(m.mirror)
+	if err != nil {
+		return err
+	}
+	for _, file := range mirrorFiles {
+		if mirrored[file] {
+			continue
+		}
+		if err := m.FS.Remove(file); err != nil {
+			return err
+		}
+	}
+	// Subdirectories come after their parent, so they are removed first.
+	for _, dir := range slices.Backward(mirrorDirs) {
+		if mirroredDirs[dir] {
+			continue
+		}
+		if err := m.FS.Remove(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk returns the files under root and its directories, root included, each directory before its
+// subdirectories.
+func (m *mirrorFS) walk(root string) (files, dirs []string, err error) {
+	dirs = []string{root}
+	for i := 0; i < len(dirs); i++ {
+		entries, err := m.FS.Glob(filepath.Join(dirs[i], "*"))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			info, err := m.FS.Stat(entry)
+			if err != nil {
+				return nil, nil, err
+			}
+			if info.IsDir() {
+				dirs = append(dirs, entry)
+			} else {
+				files = append(files, entry)
+			}
+		}
+	}
+	return files, dirs, nil
+}
+
+// sameContents reports whether the file at dst exists and has the same size and checksum as the file at src.
+func (m *mirrorFS) sameContents(src, dst string) (bool, error) {
+	info, err := m.FS.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	if dstInfo, err := m.FS.Stat(dst); err != nil || dstInfo.Size() != info.Size() {
+		return false, nil
+	}
+
+	srcSum, err := m.checksum(src)
+	if err != nil {
+		return false, err
+	}
+	dstSum, err := m.checksum(dst)
+	if err != nil {
+		return false, nil
+	}
+	return srcSum == dstSum, nil
+}
+
+// checksum returns the CRC-32C of the contents of the file at name.
+func (m *mirrorFS) checksum(name string) (uint32, error) {
+	file, err := m.FS.OpenFile(name, os.O_RDONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	hash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := io.Copy(hash, file); err != nil {
+		return 0, err
+	}
+	return hash.Sum32(), nil
+}
+
+// copyFile atomically replaces the file at dst with a copy of the file at src.
+func (m *mirrorFS) copyFile(src, dst string) error {
+	source, err := m.FS.OpenFile(src, os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	tempPath := dst + ".tmp"
+	temp, err := m.FS.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(temp, source); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return m.FS.Rename(tempPath, dst)
+}
+
+// setOnDetach sets the function called when the mirror is detached, and calls it if it already was.
+func (m *mirrorFS) setOnDetach(fn func(error)) {
+	m.lock.Lock()
+	m.onDetach = fn
+	err := m.err
+	m.lock.Unlock()
+
+	if err != nil {
+		fn(err)
+	}
+}
+
+// mirrorPath returns the path of the copy of the file at name in the mirror, and whether the file is
+// in the WAL directory and mirrored at all.
+func (m *mirrorFS) mirrorPath(name string) (string, bool) {
+	rel, err := filepath.Rel(m.directory, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(m.mirror, rel), true
+}
+
+// attached reports whether the file at name is mirrored, and returns the path of its copy.
+func (m *mirrorFS) attached(name string) (string, bool) {
+	m.lock.Lock()
+	detached := m.err != nil
+	m.lock.Unlock()
+	if detached {
+		return "", false
+	}
+	return m.mirrorPath(name)
+}
+
+// mirrorErr returns the error of an operation on the mirror, unless the policy allows the mirror
+// to be detached instead.
+func (m *mirrorFS) mirrorErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("mirror %s: %w", m.mirror, err)
+	if m.policy != MirrorAllowDegraded {
+		return err
+	}
+
+	m.lock.Lock()
+	if m.err != nil {
+		m.lock.Unlock()
+		return nil
+	}
+	m.err = err
+	onDetach := m.onDetach
+	m.lock.Unlock()
+
+	if onDetach != nil {
+		onDetach(err)
+	}
+	return nil
+}
+
+// stats returns the state of the mirror.
+func (m *mirrorFS) stats() *MirrorStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stats := &MirrorStats{Directory: m.mirror, Detached: m.err != nil}
+	if m.err != nil {
+		stats.Error = m.err.Error()
+	}
+	return stats
+}
+
+func (m *mirrorFS) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *mirrorFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := m.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	mirrorPath, ok := m.attached(name)
+	if !ok || flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return file, nil
+	}
+
+	mirror, err := m.FS.OpenFile(mirrorPath, flag, perm)
+	if err != nil {
+		if err := m.mirrorErr(err); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+	return &mirrorFile{File: file, mirror: mirror, fs: m}, nil
+}
+
+func (m *mirrorFS) Rename(oldPath, newPath string) error {
+	if err := m.FS.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	oldMirrorPath, oldOK := m.attached(oldPath)
+	newMirrorPath, newOK := m.mirrorPath(newPath)
+	if !oldOK || !newOK {
+		return nil
+	}
+	return m.mirrorErr(m.FS.Rename(oldMirrorPath, newMirrorPath))
+}
+
+func (m *mirrorFS) Remove(name string) error {
+	if err := m.FS.Remove(name); err != nil {
+		return err
+	}
+	mirrorPath, ok := m.attached(name)
+	if !ok {
+		return nil
+	}
+	if err := m.FS.Remove(mirrorPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return m.mirrorErr(err)
+	}
+	return nil
+}
+
+func (m *mirrorFS) MkdirAll(path string, perm os.FileMode) error {
+	if err := m.FS.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	mirrorPath, ok := m.attached(path)
+	if !ok {
+		return nil
+	}
+	return m.mirrorErr(m.FS.MkdirAll(mirrorPath, perm))
+}
+
+// FreeSpace implements FreeSpaceFS, returning the free space of the fuller of the two directories.
+func (m *mirrorFS) FreeSpace(path string) (uint64, error) {
+	freeSpaceFS, ok := m.FS.(FreeSpaceFS)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	free, err := freeSpaceFS.FreeSpace(path)
+	if err != nil {
+		return 0, err
+	}
+	if mirrorPath, ok := m.attached(path); ok {
+		mirrorFree, err := freeSpaceFS.FreeSpace(mirrorPath)
+		if err != nil {
+			return 0, err
+		}
+		free = min(free, mirrorFree)
+	}
+	return free, nil
+}
+
+// DropCache implements CacheDropFS, dropping the pages of the file from the page cache in both directories.
+func (m *mirrorFS) DropCache(path string) error {
+	cacheDropFS, ok := m.FS.(CacheDropFS)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	if err := cacheDropFS.DropCache(path); err != nil {
+		return err
+	}
+	if mirrorPath, ok := m.attached(path); ok {
+		return cacheDropFS.DropCache(mirrorPath)
+	}
+	return nil
+}
+
+// mirrorFile is a file of the WAL directory opened for writing, along with its copy in the mirror.
+// The segment file is synced while it is written to, see WAL.Sync, so lock guards mirror.
+type mirrorFile struct {
+	File
+	fs *mirrorFS
+
+	lock sync.Mutex
+	// mirror is set to nil once the mirror is detached.
+	mirror File
+}
+
+// mirrorOp runs op on the copy of the file, unless the mirror was detached.
+func (f *mirrorFile) mirrorOp(op func(File) error) error {
+	f.lock.Lock()
+	mirror := f.mirror
+	f.lock.Unlock()
+	if mirror == nil {
+		return nil
+	}
+	if err := f.fs.mirrorErr(op(mirror)); err != nil {
+		return err
+	}
+	if _, attached := f.fs.attached(f.Name()); !attached {
+		f.detach()
+	}
+	return nil
+}
+
+// detach closes the copy of the file, once the mirror is detached.
+func (f *mirrorFile) detach() error {
+	f.lock.Lock()
+	mirror := f.mirror
+	f.mirror = nil
+	f.lock.Unlock()
+	if mirror == nil {
+		return nil
+	}
+	return mirror.Close()
+}
+
+func (f *mirrorFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	// The copy must stay at the same offset, for the writes that follow.
+	if seekErr := f.mirrorOp(func(mirror File) error {
+		_, err := mirror.Seek(int64(n), io.SeekCurrent)
+		return err
+	}); seekErr != nil {
+		return n, seekErr
+	}
+	return n, err
+}
+
+func (f *mirrorFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, f.mirrorOp(func(mirror File) error {
+		_, err := mirror.Write(p)
+		return err
+	})
+}
+
+func (f *mirrorFile) Seek(offset int64, whence int) (int64, error) {
+	position, err := f.File.Seek(offset, whence)
+	if err != nil {
+		return position, err
+	}
+	return position, f.mirrorOp(func(mirror File) error {
+		_, err := mirror.Seek(position, io.SeekStart)
+		return err
+	})
+}
+
+func (f *mirrorFile) Sync() error {
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	return f.mirrorOp(File.Sync)
+}
+
+// DataSync implements DataSyncFile, syncing the data of the file in both directories.
+func (f *mirrorFile) DataSync() error {
+	if err := datasync(f.File); err != nil {
+		return err
+	}
+	return f.mirrorOp(datasync)
+}
+
+// Writeback implements WritebackFile, starting the writeback in both directories.
+func (f *mirrorFile) Writeback(offset, length int64) error {
+	if err := writeback(f.File, offset, length); err != nil {
+		return err
+	}
+	return f.mirrorOp(func(mirror File) error {
+		if err := writeback(mirror, offset, length); !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (f *mirrorFile) Close() error {
+	err := f.File.Close()
+	if mirrorErr := f.fs.mirrorErr(f.detach()); err == nil {
+		err = mirrorErr
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package wal
+
+import "errors"
+
+// newMmapFile is not supported on this platform, segments are written with regular writes.
+func newMmapFile(file File, size, capacity int64) (File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// mapSealedSegment is not supported on this platform, sealed segments are read like the others.
+func mapSealedSegment(file File, size int64) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func unmapSealedSegment(data []byte) error {
+	return nil
+}
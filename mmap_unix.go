@@ -0,0 +1,206 @@
+//go:build linux || darwin
+
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmapFile is a segment file written through a shared memory mapping, see WithMmap. The file is
+// preallocated, appends are copies into the mapping, and Sync msyncs the pages written since the last
+// one. The space past the written data reads as zeros, which readers take as the end of the segment,
+// and it is truncated when the file is closed.
+//
+// Writes only copy complete frames to the mapping, the data of each frame before its size prefix, so
+// that readers of the segment file, e.g. Tail, don't see a frame before it is complete. The header of the
+// segment is copied the same way, its magic last. The rest of a
+// write is kept until the frame is completed by the next one.
+type mmapFile struct {
+	File
+	fd int
+
+	// lock is held to read data in Sync, and to remap it when the file grows in Write.
+	lock    sync.RWMutex
+	data    []byte
+	size    atomic.Int64 // end of the frames copied to data
+	written atomic.Int64 // end of the data written, including pending
+	grown   atomic.Bool  // set once the file is resized, until the size is synced
+	pending []byte       // incomplete frame of the last write
+
+	syncLock sync.Mutex
+	synced   int64 // end of the data synced, guarded by syncLock
+}
+
+// newMmapFile maps file, opened for reading and writing, with size bytes of data, preallocating at
+// least capacity bytes. It returns errors.ErrUnsupported if the file has no file descriptor.
+func newMmapFile(file File, size, capacity int64) (File, error) {
+	f, ok := file.(interface{ Fd() uintptr })
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	m := &mmapFile{File: file, fd: int(f.Fd())}
+	if err := m.remap(max(size, capacity)); err != nil {
+		return nil, err
+	}
+	m.size.Store(size)
+	m.written.Store(size)
+	return m, nil
+}
+
+// remap resizes the file to capacity bytes, rounded up to whole pages, and maps it again.
+func (f *mmapFile) remap(capacity int64) error {
+	pageSize := int64(os.Getpagesize())
+	capacity = max(pageSize, (capacity+pageSize-1)/pageSize*pageSize)
+
+	if f.data != nil {
+		if err := unix.Munmap(f.data); err != nil {
+			return err
+		}
+		f.data = nil
+	}
+	if err := unix.Ftruncate(f.fd, capacity); err != nil {
+		return err
+	}
+	f.grown.Store(true)
+	data, err := unix.Mmap(f.fd, 0, int(capacity), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	f.data = data
+	return nil
+}
+
+// completeFrames returns the length of the complete frames at the start of b.
+func completeFrames(b []byte) int {
+	n := 0
+	for len(b)-n >= 4 {
+		end := n + 4 + int(binary.LittleEndian.Uint32(b[n:]))
+		if end > len(b) || end < n {
+			break
+		}
+		n = end
+	}
+	return n
+}
+
+func (f *mmapFile) Write(p []byte) (int, error) {
+	b := p
+	if len(f.pending) > 0 {
+		f.pending = append(f.pending, p...)
+		b = f.pending
+	}
+	size := f.size.Load()
+	// The header of a new segment is copied like a frame, once complete.
+	var header int
+	if size == 0 && len(b) >= segmentHeaderSize && bytes.Equal(b[:len(segmentMagic)], segmentMagic[:]) {
+		header = segmentHeaderSize
+	}
+	complete := header + completeFrames(b[header:])
+
+	if end := size + int64(complete); end > int64(len(f.data)) {
+		f.lock.Lock()
+		err := f.remap(max(end, 2*int64(len(f.data))))
+		f.lock.Unlock()
+		if err != nil {
+			f.pending = f.pending[:0]
+			return 0, err
+		}
+	}
+
+	if header > 0 {
+		copy(f.data[len(segmentMagic):header], b[len(segmentMagic):header])
+		copy(f.data[:len(segmentMagic)], b[:len(segmentMagic)])
+		size = int64(header)
+	}
+	for frame := b[header:complete]; len(frame) > 0; {
+		n := 4 + int(binary.LittleEndian.Uint32(frame))
+		copy(f.data[size+4:], frame[4:n])
+		copy(f.data[size:size+4], frame[:4])
+		size += int64(n)
+		frame = frame[n:]
+	}
+	f.size.Store(size)
+	f.pending = append(f.pending[:0], b[complete:]...)
+	f.written.Store(size + int64(len(f.pending)))
+	return len(p), nil
+}
+
+// Seek only reports the end of the data written, the file is always appended to.
+func (f *mmapFile) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekCurrent {
+		return 0, errors.ErrUnsupported
+	}
+	return f.written.Load(), nil
+}
+
+// Stat reports the size of the data written, not of the preallocated file.
+func (f *mmapFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return sizedFileInfo{FileInfo: info, size: f.written.Load()}, nil
+}
+
+// Sync msyncs the pages written since the last sync, and fsyncs the file if it was resized.
+func (f *mmapFile) Sync() error {
+	f.syncLock.Lock()
+	defer f.syncLock.Unlock()
+
+	f.lock.RLock()
+	size := f.size.Load()
+	start := f.synced / int64(os.Getpagesize()) * int64(os.Getpagesize())
+	var err error
+	if size > start && f.data != nil {
+		err = unix.Msync(f.data[start:size], unix.MS_SYNC)
+	}
+	f.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if f.grown.Swap(false) {
+		if err := f.File.Sync(); err != nil {
+			f.grown.Store(true)
+			return err
+		}
+	}
+	f.synced = size
+	return nil
+}
+
+// Close unmaps the file and truncates the preallocated space past the data.
+func (f *mmapFile) Close() error {
+	size := f.size.Load()
+	if len(f.pending) > 0 {
+		// A frame cut short by a failed write is kept, as it would be in a regular segment.
+		size += int64(copy(f.data[size:], f.pending))
+	}
+	errs := []error{unix.Munmap(f.data)}
+	f.data = nil
+	errs = append(errs, unix.Ftruncate(f.fd, size), f.File.Close())
+	return errors.Join(errs...)
+}
+
+// mapSealedSegment maps the first size bytes of a segment file that is no longer written into memory,
+// read-only, see WithMmapReads. It returns errors.ErrUnsupported if the file has no file descriptor.
+func mapSealedSegment(file File, size int64) ([]byte, error) {
+	f, ok := file.(interface{ Fd() uintptr })
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	return unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+}
+
+// unmapSealedSegment unmaps a segment mapped by mapSealedSegment.
+func unmapSealedSegment(data []byte) error {
+	return unix.Munmap(data)
+}
@@ -0,0 +1,484 @@
+package wal
+
+import (
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// SyncMode selects what the background goroutine does every sync interval.
+type SyncMode int
+
+const (
+	// PeriodicSync flushes the buffer and fsyncs the segment file (if fsync is enabled).
+	PeriodicSync SyncMode = iota
+	// PeriodicFlush only flushes the buffer to the OS. Fsync is left to explicit
+	// calls to Sync, checkpoints, rotation and Close.
+	PeriodicFlush
+)
+
+// OpenMode selects how OpenWAL treats a missing WAL.
+type OpenMode int
+
+const (
+	// CreateIfMissing creates the directory and the first segment if they don't exist.
+	CreateIfMissing OpenMode = iota
+	// MustExist requires the directory and at least one segment to already exist,
+	// failing with ErrNotExist otherwise. This guards against silently starting
+	// a brand-new empty WAL when the path is wrong.
+	MustExist
+)
+
+// UnknownFilesPolicy selects how OpenWAL treats files in the directory that don't match
+// the names of the files the WAL creates (segments, checkpoint side-file and their temporary files).
+type UnknownFilesPolicy int
+
+const (
+	// AllowUnknownFiles ignores unknown files.
+	AllowUnknownFiles UnknownFilesPolicy = iota
+	// WarnUnknownFiles logs a warning listing the unknown files.
+	WarnUnknownFiles
+	// RejectUnknownFiles fails OpenWAL with ErrUnknownFiles. This catches misconfigurations
+	// where two systems share a directory.
+	RejectUnknownFiles
+)
+
+// Checksum selects the CRC algorithm of the entries written by a WAL, see WithChecksum.
+// It is recorded once in the header of every segment, so segments with different checksums are read alike.
+type Checksum uint32
+
+const (
+	// ChecksumIEEE is CRC-32 with the IEEE polynomial, the checksum of the entries written before
+	// Checksum existed.
+	ChecksumIEEE Checksum = iota
+	// ChecksumCastagnoli is CRC-32C, with the Castagnoli polynomial, which is computed with dedicated
+	// instructions on amd64 (SSE4.2) and arm64 (ARMv8).
+	ChecksumCastagnoli
+)
+
+// Option configures optional behaviour of a WAL opened with OpenWAL.
+type Option func(*options)
+
+type options struct {
+	clock        Clock
+	fs           FS
+	syncInterval time.Duration
+	syncJitter   time.Duration
+	syncMode     SyncMode
+	openMode     OpenMode
+	unknownFiles UnknownFilesPolicy
+
+	checkpointRetention int
+
+	slowSyncThreshold time.Duration
+	onSlowSync        func(time.Duration)
+	hooks             Hooks
+	eventLogger       *slog.Logger
+	statsSinks        []statsSink
+	adminJournal      bool
+	leaseHolder       string
+	leaseDuration     time.Duration
+	webhookSecret     []byte
+	webhookURLs       []string
+	shipTarget        ShipTarget
+	shipInterval      time.Duration
+	hybridClock       bool
+	reuseEntries      bool
+	mmapReads         bool
+	writeback         int64
+	dropSealedCache   bool
+	readBufferSize    int
+	flushThreshold    int
+	checksum          Checksum
+	checksumSet       bool
+	encoding          Encoding
+	blobThreshold     int
+	valueLogThreshold int
+	entryCacheSize    int
+	repairConcurrency int
+	mmap              bool
+	writePipeline     int
+	dataSync          bool
+	preallocate       bool
+	recycleSegments   bool
+	durabilityProfile DurabilityProfile
+	mirrorDirectory   string
+	mirrorPolicy      MirrorPolicy
+
+	instrumentation Instrumentation
+
+	// set by Manager for the WALs it owns
+	backgroundSync bool
+	budget         byteBudget
+}
+
+func defaultOptions() options {
+	return options{
+		clock:             systemClock{},
+		fs:                OSFS{},
+		syncInterval:      defaultSyncInterval,
+		readBufferSize:    defaultReadBufferSize,
+		repairConcurrency: runtime.GOMAXPROCS(0),
+		syncMode:          PeriodicSync,
+		openMode:          CreateIfMissing,
+
+		checkpointRetention: 1,
+		backgroundSync:      true,
+	}
+}
+
+// WithClock sets the clock used for the periodic sync timer and timestamps.
+// Defaults to the system clock.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithFS sets the filesystem used for all file operations.
+// Defaults to OSFS.
+func WithFS(fs FS) Option {
+	return func(o *options) {
+		o.fs = fs
+	}
+}
+
+// WithSyncInterval sets how often the background goroutine flushes or syncs the buffer.
+// Defaults to 200ms.
+func WithSyncInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.syncInterval = interval
+	}
+}
+
+// WithSyncJitter delays every periodic sync by a random duration of up to jitter, so that the syncs of
+// WALs opened at the same time, e.g. by a Manager or a PartitionedWAL, don't all hit the disk at once.
+// The jitter of a sync doesn't delay the next ones, which still happen once per sync interval.
+func WithSyncJitter(jitter time.Duration) Option {
+	return func(o *options) {
+		o.syncJitter = jitter
+	}
+}
+
+// WithSyncMode sets what the background goroutine does every sync interval.
+// Defaults to PeriodicSync.
+func WithSyncMode(mode SyncMode) Option {
+	return func(o *options) {
+		o.syncMode = mode
+	}
+}
+
+// WithCheckpointRetention sets how many of the most recent checkpoints are kept
+// discoverable through Checkpoints. Defaults to 1.
+func WithCheckpointRetention(k int) Option {
+	return func(o *options) {
+		if k > 0 {
+			o.checkpointRetention = k
+		}
+	}
+}
+
+// WithOpenMode sets how OpenWAL treats a missing WAL. Defaults to CreateIfMissing.
+func WithOpenMode(mode OpenMode) Option {
+	return func(o *options) {
+		o.openMode = mode
+	}
+}
+
+// WithUnknownFiles sets how OpenWAL treats unknown files in the directory.
+// Defaults to AllowUnknownFiles.
+func WithUnknownFiles(policy UnknownFilesPolicy) Option {
+	return func(o *options) {
+		o.unknownFiles = policy
+	}
+}
+
+// WithInstrumentation traces writes, syncs, rotations, recovery and repair, and exposes the fsync
+// durations and Stats, through the given Instrumentation, e.g. the OpenTelemetry one of the walotel
+// package.
+func WithInstrumentation(instrumentation Instrumentation) Option {
+	return func(o *options) {
+		o.instrumentation = instrumentation
+	}
+}
+
+// WithOnSlowSync registers a callback invoked with the duration of every fsync that takes
+// longer than threshold, so a degrading disk becomes visible before it causes an outage.
+// The callback is called synchronously while the WAL's lock is held: it must return
+// quickly and must not call back into the WAL.
+func WithOnSlowSync(threshold time.Duration, callback func(time.Duration)) Option {
+	return func(o *options) {
+		o.slowSyncThreshold = threshold
+		o.onSlowSync = callback
+	}
+}
+
+// WithHooks sets callbacks invoked on WAL lifecycle events, see Hooks.
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.hooks = hooks
+	}
+}
+
+// WithEventLogger sets a logger to which the WAL logs structured events about what it did to
+// the data on disk (opening, rotation, retention deletions, repairs and checkpoints), so they can be
+// recorded by audit systems. See the Event constants for the messages and their attributes.
+// By default no events are logged.
+func WithEventLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.eventLogger = logger
+	}
+}
+
+// WithStatsSink reports the WAL's Stats to the given sink every interval, until the WAL is closed.
+// It can be used several times to report to several sinks.
+func WithStatsSink(sink StatsSink, interval time.Duration) Option {
+	return func(o *options) {
+		o.statsSinks = append(o.statsSinks, statsSink{sink: sink, interval: interval})
+	}
+}
+
+// WithLease makes the WAL acquire a lease on its directory for holder, e.g. a host name or process ID,
+// before it is opened, so that a single writer uses a directory on shared or attached storage.
+// OpenWAL fails with ErrLeaseHeld while another holder's lease hasn't expired. The lease is renewed
+// every third of duration and checked before every flush: once another writer took it over, writes
+// fail with ErrFenced. Close releases the lease.
+func WithLease(holder string, duration time.Duration) Option {
+	return func(o *options) {
+		o.leaseHolder = holder
+		o.leaseDuration = duration
+	}
+}
+
+// WithWebhook makes the WAL POST a JSON WebhookPayload to every url when a checkpoint is made durable,
+// the log is rotated or corrupted data is detected, so that external systems such as backup jobs or
+// alerting can react without polling. Payloads are signed with secret, see WebhookSignatureHeader.
+// Notifications are delivered in order from a dedicated goroutine, without retries: failed deliveries
+// are logged as EventWebhookFailed. Close waits for the pending notifications to be delivered.
+func WithWebhook(secret []byte, urls ...string) Option {
+	return func(o *options) {
+		o.webhookSecret = secret
+		o.webhookURLs = urls
+	}
+}
+
+// WithShipping continuously ships the segments of the WAL to target, e.g. storage in another region
+// for disaster recovery. Every interval, the sealed segments are stored in full and the entries
+// flushed to the segment being written since the previous run are stored as a tail delta. Failed runs
+// are retried with exponential backoff, up to 5 minutes, and logged as EventShippingFailed. Progress
+// is recorded in a side-file, so shipping resumes where it stopped when the WAL is reopened.
+// The lag of the target is reported in Stats.Shipping.
+func WithShipping(target ShipTarget, interval time.Duration) Option {
+	return func(o *options) {
+		o.shipTarget = target
+		o.shipInterval = interval
+	}
+}
+
+// WithAdminJournal enables the admin journal, an append-only file in the WAL directory recording
+// destructive and administrative operations with their outcome. See AdminJournal.
+func WithAdminJournal() Option {
+	return func(o *options) {
+		o.adminJournal = true
+	}
+}
+
+// WithHybridClock stamps every entry with a hybrid logical clock timestamp maintained by the WAL from
+// its clock, see HLC, so that the entries of several WALs or nodes can be merged in an order consistent
+// with causality, e.g. with CompareHLC. Timestamps received from other nodes are merged with ObserveHLC.
+func WithHybridClock() Option {
+	return func(o *options) {
+		o.hybridClock = true
+	}
+}
+
+// WithMirror writes the files of the WAL to a second directory as well, e.g. on another disk, so that
+// the log survives the failure of a single disk without external replication. A sync returns once the
+// segment is synced in both directories, or, with MirrorAllowDegraded, in the WAL directory only if the
+// mirror failed. When the WAL is opened, the files that differ are copied to the mirror, so a replaced
+// disk is filled in. If the WAL directory is lost, the WAL can be opened from the mirror.
+// The state of the mirror is reported in Stats.Mirror.
+func WithMirror(directory string, policy MirrorPolicy) Option {
+	return func(o *options) {
+		o.mirrorDirectory = directory
+		o.mirrorPolicy = policy
+	}
+}
+
+// WithEntryReuse makes NewTail and TailDir pass the same WAL_Entry to their callback for every entry,
+// overwritten by the next entry once the callback returns, so that replaying a large log doesn't
+// allocate an entry per record. The callback must not retain the entry, e.g. it can copy it with
+// proto.Clone. It has no effect on the other read APIs, nor on OpenWAL.
+func WithEntryReuse() Option {
+	return func(o *options) {
+		o.reuseEntries = true
+	}
+}
+
+// WithMmapReads makes NewTail and TailDir map the sealed segments, which are no longer written, into
+// memory to read their entries, instead of reading every entry from the file. With Tail.ReadViews, the
+// entries written with EncodingFlatBuffers or EncodingCapnProto are then read in place from the mapping,
+// without being copied. The newest segment is read from the file. It has no effect on platforms without
+// mmap, nor on the other read APIs.
+func WithMmapReads() Option {
+	return func(o *options) {
+		o.mmapReads = true
+	}
+}
+
+// WithWriteback starts writing the data flushed to the segment file back to disk, without waiting for
+// it, every time bytes more have been flushed since the last writeback. The fsync of a sync then has
+// less dirty data left to write, which smooths out its latency when large amounts of data are flushed
+// between syncs. Writebacks are counted in Stats.Writebacks. It requires a file supporting
+// WritebackFile, such as the files of OSFS on Linux, and has no effect otherwise.
+func WithWriteback(bytes int64) Option {
+	return func(o *options) {
+		o.writeback = bytes
+	}
+}
+
+// WithDropSealedCache drops the pages of segments from the page cache once they are sealed by a rotation,
+// or, with WithShipping, once they are shipped, so that cold WAL data doesn't evict the working set of
+// the application. Reads of older segments, e.g. by Tail, are then served from disk. It requires an FS
+// implementing CacheDropFS, such as OSFS on Linux, and has no effect otherwise.
+func WithDropSealedCache() Option {
+	return func(o *options) {
+		o.dropSealedCache = true
+	}
+}
+
+// WithReadBufferSize sets the size of the buffer segment files are read through when they are scanned
+// sequentially: by ReadAll, ReadAllFromOffset and Repair, when the last segment is scanned on open,
+// and by tails, see NewTail.
+// Larger buffers take fewer read syscalls, which speeds up recovery on fast disks. Defaults to 1MB.
+func WithReadBufferSize(bytes int) Option {
+	return func(o *options) {
+		o.readBufferSize = bytes
+	}
+}
+
+// WithFlushThresholdBytes flushes the buffer to the segment file as soon as it holds bytes bytes, without
+// waiting for the sync timer, so that bursts of writes don't accumulate in memory until the next sync.
+// This bounds both the data lost if the process crashes and the size of flushes. The flushed data is
+// fsynced by the next sync, as usual. Flushes it triggers are counted in Stats.ThresholdFlushes.
+// Thresholds larger than the buffer have no effect, as a full buffer is flushed anyway.
+func WithFlushThresholdBytes(bytes int) Option {
+	return func(o *options) {
+		o.flushThreshold = bytes
+	}
+}
+
+// WithChecksum sets the CRC algorithm of the entries written. By default, new WALs use ChecksumCastagnoli,
+// which is cheaper to compute at high write rates, while existing WALs keep using the checksum of their
+// current segment; WALs written before segments had a header keep being written without one, so that
+// they stay readable by the versions of this package that wrote them. The checksum is recorded in the
+// header of the segments, so it applies from the next segment on: the current one keeps its own.
+func WithChecksum(checksum Checksum) Option {
+	return func(o *options) {
+		o.checksum = checksum
+		o.checksumSet = true
+	}
+}
+
+// WithEncoding sets the encoding of the entries written, see Encoding. Entries written with other
+// encodings, e.g. before the option was set, stay readable. Like the checksum, see WithChecksum, the
+// encoding is recorded in the header of the segments, so it applies from the next segment on. Defaults
+// to EncodingProtobuf.
+func WithEncoding(encoding Encoding) Option {
+	return func(o *options) {
+		o.encoding = encoding
+	}
+}
+
+// WithRepairConcurrency sets how many segments RepairDir scans and rewrites at once.
+// Defaults to GOMAXPROCS.
+func WithRepairConcurrency(workers int) Option {
+	return func(o *options) {
+		o.repairConcurrency = workers
+	}
+}
+
+// WithMmap enables the experimental memory-mapped write path: the current segment is preallocated to
+// maxFileSize and mapped into memory, appends copy the entries into the mapping instead of going through
+// write calls, and Sync msyncs the pages written since the last sync. The segments are in the same
+// format either way, so a WAL can be reopened with or without the option. The space preallocated past
+// the entries reads as zeros, which ends the segment for readers, and is truncated when the segment is
+// sealed, or when the WAL is reopened after a crash. It requires the files of OSFS on Linux or macOS,
+// and falls back to regular writes otherwise, e.g. with WithMirror.
+func WithMmap() Option {
+	return func(o *options) {
+		o.mmap = true
+	}
+}
+
+// WithWritePipeline splits the write path into two stages: entries are encoded into a buffer while the
+// full buffers are written to the segment file by a goroutine of their own, so that encoding the next
+// entries overlaps with the write calls on multi-core hosts, and a write call doesn't hold up the other
+// writers. depth is the number of full buffers that can be waiting to be written, writers wait once it
+// is reached. Flushes and syncs wait for the buffers to be written, so their guarantees are unchanged.
+func WithWritePipeline(depth int) Option {
+	return func(o *options) {
+		o.writePipeline = depth
+	}
+}
+
+// WithDataSync syncs segment files with fdatasync instead of fsync, which doesn't commit the metadata
+// that isn't needed to read the data back, such as the modification time. Appends that grow the file
+// still commit its size, see WithPreallocate. It requires a file supporting DataSyncFile, such as the
+// files of OSFS on Linux, and falls back to fsync otherwise.
+func WithDataSync() Option {
+	return func(o *options) {
+		o.dataSync = true
+	}
+}
+
+// WithPreallocate prepares the next segment in the background: a spare file is filled with zeros up to
+// maxFileSize and synced, and a rotation renames it to the new segment, whose appends then overwrite
+// blocks that are already allocated, without growing the file. The zeros read as the end of the segment,
+// and are truncated when it is sealed. The spare file takes up to maxFileSize of disk space on top of
+// the segments. A rotation that happens before the spare is ready creates a segment as usual.
+func WithPreallocate() Option {
+	return func(o *options) {
+		o.preallocate = true
+	}
+}
+
+// WithRecycleSegments keeps a segment deleted because of the segment limit to prepare the next spare
+// segment from, overwriting it with zeros instead of allocating a new file. It implies WithPreallocate.
+func WithRecycleSegments() Option {
+	return func(o *options) {
+		o.recycleSegments = true
+	}
+}
+
+// WithDurabilityProfile applies a preset of options, see DurabilityProfile. OpenWAL fails if the
+// profile is unknown.
+func WithDurabilityProfile(profile DurabilityProfile) Option {
+	return func(o *options) {
+		o.durabilityProfile = profile
+	}
+}
+
+// ReadOption configures ReadAll and ReadAllFromOffset.
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	capacityHint int
+	upconvert    bool
+}
+
+// WithCapacityHint sizes the slice returned by ReadAll or ReadAllFromOffset for n entries up front, instead
+// of the entry counts of the segments known to the WAL, for callers who know how many entries they read.
+func WithCapacityHint(n int) ReadOption {
+	return func(o *readOptions) {
+		o.capacityHint = n
+	}
+}
+
+// WithUpconversion makes ReadAll and ReadAllFromOffset convert the entries they return to the latest
+// version of their schema, see Upconvert. An entry that fails to convert fails the read.
+func WithUpconversion() ReadOption {
+	return func(o *readOptions) {
+		o.upconvert = true
+	}
+}
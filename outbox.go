@@ -0,0 +1,154 @@
+package wal
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultOutboxBatchSize     = 100
+	defaultOutboxRetryInterval = time.Second
+)
+
+// Publisher delivers the records of an Outbox to another system, e.g. a message broker.
+type Publisher interface {
+	// Publish delivers the records, in order. If it fails, the same records are published again,
+	// so the receiver must tolerate duplicates.
+	Publish(ctx context.Context, records []*WAL_Entry) error
+}
+
+// PublisherFunc adapts a function to a Publisher.
+type PublisherFunc func(ctx context.Context, records []*WAL_Entry) error
+
+// Publish implements Publisher.
+func (f PublisherFunc) Publish(ctx context.Context, records []*WAL_Entry) error {
+	return f(ctx, records)
+}
+
+// Outbox is a transactional outbox on a WAL: the application appends the records to be delivered to
+// the log, in the same write path as the rest of its state, and Run delivers them with a Publisher.
+//
+// Delivery is at least once. The records of an Outbox are the entries of its stream, named after it,
+// and the sequence number of the last record delivered is committed as the consumer offset of the same
+// name (see CommitOffset) once the Publisher acknowledged it, so a restarted Outbox resumes after it.
+// Records published when the process crashed before committing are published again.
+type Outbox struct {
+	wal       *WAL
+	name      string
+	publisher Publisher
+	outboxOptions
+}
+
+// OutboxOption configures an Outbox created with NewOutbox.
+type OutboxOption func(*outboxOptions)
+
+type outboxOptions struct {
+	batchSize     int
+	retryInterval time.Duration
+}
+
+// WithOutboxBatchSize sets the maximum number of records published at once. Defaults to 100.
+func WithOutboxBatchSize(records int) OutboxOption {
+	return func(o *outboxOptions) {
+		o.batchSize = max(records, 1)
+	}
+}
+
+// WithOutboxRetryInterval sets how long the Outbox waits before publishing again after the Publisher
+// failed. Defaults to 1s.
+func WithOutboxRetryInterval(interval time.Duration) OutboxOption {
+	return func(o *outboxOptions) {
+		o.retryInterval = interval
+	}
+}
+
+// NewOutbox returns the Outbox of the given name on the WAL, delivering its records with publisher.
+func NewOutbox(wal *WAL, name string, publisher Publisher, opts ...OutboxOption) *Outbox {
+	o := outboxOptions{batchSize: defaultOutboxBatchSize, retryInterval: defaultOutboxRetryInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Outbox{wal: wal, name: name, publisher: publisher, outboxOptions: o}
+}
+
+// Append writes a record to be delivered, like AppendEntry, and returns its sequence number. The stream
+// of the record is the name of the Outbox, whatever opts set.
+func (o *Outbox) Append(data []byte, opts ...EntryOption) (uint64, error) {
+	return o.wal.AppendEntry(data, append(append([]EntryOption(nil), opts...), WithStream(o.name))...)
+}
+
+// Delivered returns the sequence number of the last record delivered, or 0 if none was.
+func (o *Outbox) Delivered() uint64 {
+	return o.wal.ConsumerOffset(o.name)
+}
+
+// Run delivers the records after the last one delivered, then the records as they are appended, until
+// ctx is done. Records are read once they have been flushed to the segment files. Failed publishes are
+// retried after the retry interval; errors reading the WAL or committing the offset end Run.
+func (o *Outbox) Run(ctx context.Context) error {
+	var from uint64
+	if offset := o.Delivered(); offset > 0 {
+		from = offset + 1
+	}
+	tail, err := o.wal.Tail(from)
+	if err != nil {
+		return err
+	}
+	defer tail.Stop()
+
+	var batch []*WAL_Entry
+	publish := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := o.publish(ctx, batch); err != nil {
+			return err
+		}
+		if err := o.wal.CommitOffset(o.name, batch[len(batch)-1].GetLogSequenceNumber()); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		err := tail.Read(func(entry *WAL_Entry) error {
+			if entry.GetStream() != o.name || entry.GetIsCheckpoint() {
+				return nil
+			}
+			batch = append(batch, entry)
+			if len(batch) >= o.batchSize {
+				return publish()
+			}
+			return nil
+		})
+		if err == nil {
+			err = publish()
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tail.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// publish publishes the records, retrying until they are acknowledged or ctx is done.
+func (o *Outbox) publish(ctx context.Context, records []*WAL_Entry) error {
+	for {
+		err := o.publisher.Publish(ctx, records)
+		if err == nil {
+			return nil
+		}
+
+		timer := o.wal.clock.NewTimer(o.retryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"sync"
+)
+
+// partitionPrefix is the prefix of the subdirectories holding the partitions of a PartitionedWAL.
+const partitionPrefix = "partition-"
+
+// PartitionedWAL spreads entries across several WALs, its partitions, by hashing their key, so that
+// writes to different partitions are buffered and synced in parallel instead of contending for a
+// single segment file. Entries with the same key always go to the same partition, which keeps them in
+// order. Each partition is a WAL of its own, stored in a subdirectory named after its index.
+type PartitionedWAL struct {
+	directory  string
+	partitions []*WAL
+}
+
+// OpenPartitionedWAL opens the WAL in directory with the given number of partitions, creating it if needed.
+// The number of partitions can't change once the WAL is created, as keys would map to other partitions.
+// enableFsync, maxFileSize, maxSegments and opts are applied to every partition, see OpenWAL.
+func OpenPartitionedWAL(directory string, partitions int, enableFsync bool, maxFileSize int64, maxSegments int, opts ...Option) (*PartitionedWAL, error) {
+	if partitions <= 0 {
+		return nil, fmt.Errorf("invalid number of partitions %d", partitions)
+	}
+
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	existing, err := o.fs.Glob(filepath.Join(directory, partitionPrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 && len(existing) != partitions {
+		return nil, fmt.Errorf("wal %s has %d partitions, cannot open it with %d", directory, len(existing), partitions)
+	}
+
+	p := &PartitionedWAL{directory: directory, partitions: make([]*WAL, partitions)}
+	for i := range p.partitions {
+		wal, err := OpenWAL(p.partitionDirectory(i), enableFsync, maxFileSize, maxSegments, opts...)
+		if err != nil {
+			p.closePartitions()
+			return nil, fmt.Errorf("could not open partition %d: %w", i, err)
+		}
+		p.partitions[i] = wal
+	}
+	if o.hybridClock {
+		p.shareHybridClock()
+	}
+	return p, nil
+}
+
+// shareHybridClock makes the partitions stamp entries with one hybrid clock, starting after the HLCs
+// of all of them, so that HLCs order the entries across partitions.
+func (p *PartitionedWAL) shareHybridClock() {
+	shared := &hybridClock{clock: p.partitions[0].clock}
+	for _, wal := range p.partitions {
+		wal.lock.Lock()
+		shared.observe(wal.hybridClock.last)
+		wal.hybridClock = shared
+		wal.lock.Unlock()
+	}
+}
+
+func (p *PartitionedWAL) partitionDirectory(partition int) string {
+	return filepath.Join(p.directory, fmt.Sprintf("%s%d", partitionPrefix, partition))
+}
+
+// Partitions returns the number of partitions.
+func (p *PartitionedWAL) Partitions() int {
+	return len(p.partitions)
+}
+
+// Partition returns the WAL of the given partition, e.g. to read it or to checkpoint it.
+func (p *PartitionedWAL) Partition(partition int) *WAL {
+	return p.partitions[partition]
+}
+
+// PartitionOf returns the partition entries with the given key are written to.
+func (p *PartitionedWAL) PartitionOf(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(p.partitions)))
+}
+
+// WriteEntry writes an entry with the given key to its partition.
+func (p *PartitionedWAL) WriteEntry(key, data []byte) error {
+	_, _, err := p.AppendEntry(key, data)
+	return err
+}
+
+// AppendEntry writes an entry with the given key and attributes to its partition, and returns the
+// partition and the sequence number assigned to the entry in it. The key is stored in the entry.
+func (p *PartitionedWAL) AppendEntry(key, data []byte, opts ...EntryOption) (partition int, lsn uint64, err error) {
+	partition = p.PartitionOf(key)
+	lsn, err = p.partitions[partition].AppendEntry(data, append(append([]EntryOption(nil), opts...), WithKey(key))...)
+	return partition, lsn, err
+}
+
+// Sync syncs all of the partitions in parallel, see WAL.Sync.
+func (p *PartitionedWAL) Sync() error {
+	errs := make([]error, len(p.partitions))
+	var wg sync.WaitGroup
+	for i, wal := range p.partitions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := wal.Sync(); err != nil {
+				errs[i] = fmt.Errorf("could not sync partition %d: %w", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close closes all of the partitions.
+func (p *PartitionedWAL) Close() error {
+	return p.closePartitions()
+}
+
+func (p *PartitionedWAL) closePartitions() error {
+	var errs []error
+	for i, wal := range p.partitions {
+		if wal == nil {
+			continue
+		}
+		if err := wal.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("could not close partition %d: %v", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReadPartition calls fn for the entries of the given partition with a sequence number of at least
+// fromLSN, in order, until the end of the partition.
+func (p *PartitionedWAL) ReadPartition(partition int, fromLSN uint64, fn func(*WAL_Entry) error) error {
+	tail, err := p.partitions[partition].Tail(fromLSN)
+	if err != nil {
+		return err
+	}
+	defer tail.Stop()
+	return tail.Read(fn)
+}
+
+// ReadMerged calls fn for the entries of all of the partitions, merged in the order of CompareHLC,
+// until the end of every partition. If the partitions are opened WithHybridClock, they share one clock,
+// so the merged order is consistent with the order the entries were written in. Otherwise entries are
+// merged by sequence number, which only keeps the order of the entries of each partition.
+func (p *PartitionedWAL) ReadMerged(ctx context.Context, fn func(partition int, entry *WAL_Entry) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Each partition is read by its own goroutine, and the merge picks the smallest of their next entries.
+	sources := make([]chan *WAL_Entry, len(p.partitions))
+	errs := make([]error, len(p.partitions))
+	var wg sync.WaitGroup
+	for i := range p.partitions {
+		sources[i] = make(chan *WAL_Entry, 64)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(sources[i])
+			errs[i] = p.ReadPartition(i, 0, func(entry *WAL_Entry) error {
+				select {
+				case sources[i] <- entry:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}()
+	}
+
+	err := mergeEntries(sources, fn)
+	cancel()
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("could not read partition %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// mergeEntries calls fn for the entries received from sources, in the order of CompareHLC, until all
+// of the sources are closed.
+func mergeEntries(sources []chan *WAL_Entry, fn func(partition int, entry *WAL_Entry) error) error {
+	heads := make([]*WAL_Entry, len(sources))
+	for i, source := range sources {
+		heads[i] = <-source
+	}
+	for {
+		next := -1
+		for i, head := range heads {
+			if head != nil && (next < 0 || CompareHLC(head, heads[next]) < 0) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return nil
+		}
+		if err := fn(next, heads[next]); err != nil {
+			return err
+		}
+		heads[next] = <-sources[next]
+	}
+}
@@ -2,13 +2,11 @@ package wal
 
 import (
 	"fmt"
-
-	"google.golang.org/protobuf/proto"
 )
 
 // MustMarshal marshals the wal entry to bytes
 func MustMarshal(entry *WAL_Entry) []byte {
-	marshaledEntry, err := proto.Marshal(entry)
+	marshaledEntry, err := entry.MarshalVT()
 	// this err means something is wrong in proto, so we should panic
 	if err != nil {
 		panic(fmt.Sprintf("Marshal should never fail (%v)", err))
@@ -20,7 +18,13 @@ func MustMarshal(entry *WAL_Entry) []byte {
 // MustUnmarshal unmarshals the bytes to wal entry
 func MustUnmarshal(data []byte, entry *WAL_Entry) {
 	// this err means something is wrong in proto, so we should panic
-	if err := proto.Unmarshal(data, entry); err != nil {
+	if err := entry.UnmarshalVT(data); err != nil {
 		panic(fmt.Sprintf("Unmarshal should never fail (%v)", err))
 	}
 }
+
+// UnmarshalEntry unmarshals an entry as marshaled by MustMarshal and verifies its CRC.
+// It returns an error wrapping ErrInvalidEntry or ErrCorruptEntry if the entry is damaged.
+func UnmarshalEntry(data []byte) (*WAL_Entry, error) {
+	return unmarshalAndVerifyEntry(data, headerlessFormat)
+}
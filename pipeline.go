@@ -0,0 +1,163 @@
+package wal
+
+import (
+	"errors"
+	"io"
+)
+
+// pipelineBufferSize is the size of the buffers of a pipelineWriter, the default size of a bufio.Writer.
+const pipelineBufferSize = 4096
+
+// errPipelineStopped is the result of the writes queued after a failed one, which are not attempted.
+var errPipelineStopped = errors.New("write pipeline stopped after a failed write")
+
+// segmentWriter buffers the frames written to the current segment file. It is a *bufio.Writer, or
+// a *pipelineWriter with WithWritePipeline.
+type segmentWriter interface {
+	io.Writer
+	Flush() error
+	Buffered() int
+	Size() int
+}
+
+// pipelineWriter is a buffered writer handing its full buffers to a goroutine of its own, which writes
+// them to the segment file, see WithWritePipeline. The entries that follow are encoded into the next
+// buffer of a small ring while the previous ones are written, instead of waiting for the write.
+//
+// Like a bufio.Writer, it is only used while holding wal.lock. The goroutine only writes to the file,
+// the results of its writes, and the stats of the flushes, are collected by the writer. Frames are
+// never split across buffers, and the first failed write stops the pipeline: its error is returned by
+// every later call, as with a bufio.Writer.
+type pipelineWriter struct {
+	counter flushCounter
+	buf     []byte   // buffer being filled
+	spares  [][]byte // buffers written, to be reused
+	writes  chan []byte
+	results chan pipelineResult
+	done    chan struct{} // closed once the goroutine returns
+	queued  int           // buffers handed to the goroutine whose result wasn't collected
+	queuedN int           // bytes in the queued buffers
+	err     error
+}
+
+type pipelineResult struct {
+	buf []byte
+	n   int
+	err error
+}
+
+// newPipelineWriter starts a pipelineWriter writing to the writer of counter, with up to depth buffers
+// waiting to be written.
+func newPipelineWriter(counter flushCounter, depth int) *pipelineWriter {
+	w := &pipelineWriter{
+		counter: counter,
+		buf:     make([]byte, 0, pipelineBufferSize),
+		writes:  make(chan []byte, depth),
+		results: make(chan pipelineResult, depth),
+		done:    make(chan struct{}),
+	}
+	go w.writeBuffers()
+	return w
+}
+
+// writeBuffers writes the buffers handed over by the writer, in order.
+func (w *pipelineWriter) writeBuffers() {
+	defer close(w.done)
+	var failed bool
+	for buf := range w.writes {
+		if failed {
+			w.results <- pipelineResult{buf: buf, err: errPipelineStopped}
+			continue
+		}
+		n, err := w.counter.w.Write(buf)
+		failed = err != nil
+		w.results <- pipelineResult{buf: buf, n: n, err: err}
+	}
+}
+
+func (w *pipelineWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.collectWritten()
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= pipelineBufferSize {
+		if err := w.handOver(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// handOver queues the current buffer for the goroutine, waiting for the oldest queued write to complete
+// if the ring is full, and starts filling a spare buffer.
+func (w *pipelineWriter) handOver() error {
+	if w.queued == cap(w.writes) {
+		w.collect()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.writes <- w.buf
+	w.queued++
+	w.queuedN += len(w.buf)
+
+	if n := len(w.spares); n > 0 {
+		w.buf = w.spares[n-1]
+		w.spares = w.spares[:n-1]
+	} else {
+		w.buf = make([]byte, 0, pipelineBufferSize)
+	}
+	return nil
+}
+
+// collect waits for the result of the oldest queued write.
+func (w *pipelineWriter) collect() {
+	result := <-w.results
+	w.queued--
+	w.queuedN -= len(result.buf)
+	w.counter.record(result.n)
+	if result.err != nil && w.err == nil {
+		w.err = result.err
+	}
+	w.spares = append(w.spares, result.buf[:0])
+}
+
+// collectWritten collects the results of the writes that are already complete.
+func (w *pipelineWriter) collectWritten() {
+	for w.queued > 0 && len(w.results) > 0 {
+		w.collect()
+	}
+}
+
+// Flush queues the current buffer and waits for all of the queued writes to complete.
+func (w *pipelineWriter) Flush() error {
+	if len(w.buf) > 0 && w.err == nil {
+		if err := w.handOver(); err != nil {
+			return err
+		}
+	}
+	for w.queued > 0 {
+		w.collect()
+	}
+	return w.err
+}
+
+// Buffered returns the number of bytes not written to the file yet, including the queued buffers.
+func (w *pipelineWriter) Buffered() int {
+	return len(w.buf) + w.queuedN
+}
+
+// Size returns the size of the buffers.
+func (w *pipelineWriter) Size() int {
+	return pipelineBufferSize
+}
+
+// stop stops the goroutine, once the queued writes complete. The writer must not be used afterwards.
+func (w *pipelineWriter) stop() {
+	close(w.writes)
+	for w.queued > 0 {
+		w.collect()
+	}
+	<-w.done
+}
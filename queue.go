@@ -0,0 +1,288 @@
+package wal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queueDirName is the directory, inside the WAL directory, holding the state of the queues.
+const queueDirName = "queues"
+
+// ErrNotLeased is returned by Queue.Ack and Queue.Nack for a message that isn't leased, e.g. because
+// it was already acknowledged.
+var ErrNotLeased = errors.New("message is not leased")
+
+// Queue is a durable task queue on a WAL. Messages are entries of the stream of the queue, named after
+// it. Consumers lease messages with Receive, then Ack them once processed, or Nack them to have them
+// redelivered; a message whose lease expires is redelivered too.
+//
+// The state of the queue, i.e. the position before which every message is acknowledged, the messages
+// acknowledged after it and the leases, is saved to a side-file after every change, so it survives
+// crashes. Delivery is at least once: a message is redelivered if its lease expires before it is
+// acknowledged, so consumers must tolerate duplicates.
+type Queue struct {
+	wal  *WAL
+	name string
+	path string
+
+	lock    sync.Mutex
+	tail    *Tail
+	state   queueState
+	scanned uint64                // sequence number of the last entry read from the log
+	ready   []*WAL_Entry          // messages never delivered, in order
+	leased  map[uint64]*WAL_Entry // leased messages, including those whose lease expired or was nacked
+}
+
+// queueState is the state of a queue, as saved in its side-file.
+type queueState struct {
+	// Position is the sequence number before which, and at which, every message is acknowledged.
+	Position uint64 `json:"position"`
+	// Acked are the messages acknowledged after Position.
+	Acked []uint64 `json:"acked,omitempty"`
+	// Leases are the leases of the messages delivered and not acknowledged yet, by sequence number.
+	Leases map[uint64]queueLease `json:"leases,omitempty"`
+}
+
+// queueLease is the lease of a delivered message.
+type queueLease struct {
+	// Deadline is when the message is redelivered, unless acknowledged. It is zero once nacked.
+	Deadline time.Time `json:"deadline"`
+	// Deliveries is the number of times the message was delivered.
+	Deliveries int `json:"deliveries"`
+}
+
+// Message is a message leased from a Queue.
+type Message struct {
+	*WAL_Entry
+	// Deliveries is the number of times the message was delivered, including this one.
+	Deliveries int
+	// Deadline is when the lease expires, and the message is redelivered unless acknowledged.
+	Deadline time.Time
+}
+
+// OpenQueue opens the queue of the given name on the WAL, recovering its state.
+func OpenQueue(wal *WAL, name string) (*Queue, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid queue name %q", name)
+	}
+	q := &Queue{
+		wal:    wal,
+		name:   name,
+		path:   filepath.Join(wal.directory, queueDirName, name),
+		leased: make(map[uint64]*WAL_Entry),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	q.scanned = q.state.Position
+
+	tail, err := wal.Tail(q.state.Position + 1)
+	if err != nil {
+		return nil, err
+	}
+	q.tail = tail
+	if err := q.poll(); err != nil {
+		tail.Stop()
+		return nil, err
+	}
+	return q, nil
+}
+
+// load reads the side-file of the queue, if present.
+func (q *Queue) load() error {
+	file, err := q.wal.fs.OpenFile(q.path, os.O_RDONLY, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&q.state); err != nil {
+		return fmt.Errorf("could not read queue file: %v", err)
+	}
+	return nil
+}
+
+// save atomically replaces the side-file of the queue with its state.
+// The caller must hold q.lock.
+func (q *Queue) save() error {
+	// Only the messages acknowledged after the first outstanding message need to be recorded.
+	q.state.Position = q.scanned
+	for lsn := range q.state.Leases {
+		q.state.Position = min(q.state.Position, lsn-1)
+	}
+	if len(q.ready) > 0 {
+		q.state.Position = min(q.state.Position, q.ready[0].GetLogSequenceNumber()-1)
+	}
+	q.state.Acked = slices.DeleteFunc(q.state.Acked, func(lsn uint64) bool { return lsn <= q.state.Position })
+
+	data, err := json.Marshal(q.state)
+	if err != nil {
+		return err
+	}
+	if err := q.wal.fs.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return err
+	}
+	tempPath := q.path + ".tmp"
+	tempFile, err := q.wal.fs.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	// The side-file must be durable before it replaces the previous one.
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return q.wal.fs.Rename(tempPath, q.path)
+}
+
+// poll reads the messages written since the last call.
+// The caller must hold q.lock, or have the queue to itself.
+func (q *Queue) poll() error {
+	return q.tail.Read(func(entry *WAL_Entry) error {
+		lsn := entry.GetLogSequenceNumber()
+		q.scanned = lsn
+		if entry.GetStream() != q.name || entry.GetIsCheckpoint() || slices.Contains(q.state.Acked, lsn) {
+			return nil
+		}
+		if _, ok := q.state.Leases[lsn]; ok {
+			q.leased[lsn] = entry
+			return nil
+		}
+		q.ready = append(q.ready, entry)
+		return nil
+	})
+}
+
+// Enqueue writes a message to the queue, like AppendEntry, and returns its sequence number. The stream
+// of the message is the name of the queue, whatever opts set.
+func (q *Queue) Enqueue(data []byte, opts ...EntryOption) (uint64, error) {
+	return q.wal.AppendEntry(data, append(append([]EntryOption(nil), opts...), WithStream(q.name))...)
+}
+
+// Receive leases up to n messages for the visibility timeout, the messages to redeliver first, and
+// returns them. It doesn't wait for messages: it returns none if there are none to deliver.
+func (q *Queue) Receive(n int, visibility time.Duration) ([]Message, error) {
+	// Messages are read from the segment files.
+	if err := q.wal.Flush(); err != nil {
+		return nil, err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if err := q.poll(); err != nil {
+		return nil, err
+	}
+	now := q.wal.clock.Now()
+	var redelivered []uint64
+	for lsn, lease := range q.state.Leases {
+		if _, ok := q.leased[lsn]; !ok {
+			// The message was deleted from the log, e.g. with its segment because of the segment limit.
+			delete(q.state.Leases, lsn)
+			continue
+		}
+		if !lease.Deadline.After(now) {
+			redelivered = append(redelivered, lsn)
+		}
+	}
+	slices.Sort(redelivered)
+
+	var entries []*WAL_Entry
+	for _, lsn := range redelivered[:min(n, len(redelivered))] {
+		entries = append(entries, q.leased[lsn])
+	}
+	taken := min(n-len(entries), len(q.ready))
+	entries = append(entries, q.ready[:taken]...)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	if q.state.Leases == nil {
+		q.state.Leases = make(map[uint64]queueLease)
+	}
+	messages := make([]Message, 0, len(entries))
+	deadline := now.Add(visibility)
+	for _, entry := range entries {
+		lsn := entry.GetLogSequenceNumber()
+		lease := queueLease{Deadline: deadline, Deliveries: q.state.Leases[lsn].Deliveries + 1}
+		q.state.Leases[lsn] = lease
+		q.leased[lsn] = entry
+		messages = append(messages, Message{WAL_Entry: entry, Deliveries: lease.Deliveries, Deadline: deadline})
+	}
+	q.ready = q.ready[taken:]
+
+	if err := q.save(); err != nil {
+		return nil, fmt.Errorf("could not lease messages, error while saving queue file: %w", err)
+	}
+	return messages, nil
+}
+
+// Ack acknowledges the leased message with the given sequence number: it is never delivered again.
+// A message whose lease expired can still be acknowledged, until it is acknowledged after its
+// redelivery.
+func (q *Queue) Ack(lsn uint64) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok := q.state.Leases[lsn]; !ok {
+		return ErrNotLeased
+	}
+	delete(q.state.Leases, lsn)
+	delete(q.leased, lsn)
+	q.state.Acked = append(q.state.Acked, lsn)
+	if err := q.save(); err != nil {
+		return fmt.Errorf("could not ack message, error while saving queue file: %w", err)
+	}
+	return nil
+}
+
+// Nack releases the lease of the message with the given sequence number, so that it is redelivered by
+// the next Receive.
+func (q *Queue) Nack(lsn uint64) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	lease, ok := q.state.Leases[lsn]
+	if !ok {
+		return ErrNotLeased
+	}
+	lease.Deadline = time.Time{}
+	q.state.Leases[lsn] = lease
+	if err := q.save(); err != nil {
+		return fmt.Errorf("could not nack message, error while saving queue file: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of messages that are not acknowledged, leased or not, as of the last Receive.
+func (q *Queue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.ready) + len(q.state.Leases)
+}
+
+// Close releases the resources of the queue. The leases are kept.
+func (q *Queue) Close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.tail.Stop()
+}
@@ -0,0 +1,254 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQuotaExceeded is returned by writes to a namespace of a Manager that is over its quota.
+var ErrQuotaExceeded = errors.New("namespace quota exceeded")
+
+// Quota limits the resources a namespace of a Manager may use. Zero fields are unlimited.
+type Quota struct {
+	// MaxBytes is the maximum number of bytes the segments of the namespace may use on disk. Writes that
+	// would exceed it fail with ErrQuotaExceeded until segments are deleted.
+	MaxBytes int64
+	// BytesPerSecond and EntriesPerSecond limit the write rate of the namespace. Up to a second worth of
+	// writes may be written at once.
+	BytesPerSecond   int64
+	EntriesPerSecond int64
+	// Throttle makes the writes over a rate limit wait until they are within it, instead of failing
+	// with ErrQuotaExceeded. They wait before taking any lock, so other writers aren't blocked.
+	Throttle bool
+}
+
+// NamespaceStats is the usage of a namespace of a Manager, see Manager.Stats.
+type NamespaceStats struct {
+	// Quota is the quota of the namespace.
+	Quota Quota
+	// BytesUsed is the number of bytes used by the segments of the namespace.
+	BytesUsed int64
+	// RejectedWrites is the number of writes that failed because the namespace was over its quota.
+	RejectedWrites uint64
+	// ThrottledWrites is the number of writes delayed by a rate limit, and ThrottledTime the total delay.
+	ThrottledWrites uint64
+	ThrottledTime   time.Duration
+}
+
+// ManagerStats is the usage of the namespaces of a Manager, see Manager.Stats.
+type ManagerStats struct {
+	// ByteBudget is the budget set with WithByteBudget, 0 if unlimited.
+	ByteBudget int64
+	// BytesUsed is the number of bytes used by all namespaces.
+	BytesUsed int64
+	// Namespaces is the usage of the namespaces that have been written to, or that have segments on
+	// disk, by name.
+	Namespaces map[string]NamespaceStats
+}
+
+// WithDefaultQuota sets the quota of the namespaces without one set by WithNamespaceQuota or SetQuota.
+func WithDefaultQuota(quota Quota) ManagerOption {
+	return func(m *Manager) {
+		m.defaultQuota = quota
+	}
+}
+
+// WithNamespaceQuota sets the quota of the given namespace.
+func WithNamespaceQuota(namespace string, quota Quota) ManagerOption {
+	return func(m *Manager) {
+		m.quotas[namespace] = quota
+	}
+}
+
+// SetQuota sets the quota of the given namespace. It applies to the following writes; a namespace
+// already over a new MaxBytes isn't truncated.
+func (m *Manager) SetQuota(namespace string, quota Quota) {
+	m.budgetLock.Lock()
+	defer m.budgetLock.Unlock()
+
+	m.quotas[namespace] = quota
+	if usage, ok := m.usage[namespace]; ok {
+		usage.bytes, usage.entries = nil, nil
+	}
+}
+
+// Stats returns the usage of the namespaces, against their quotas and the byte budget.
+func (m *Manager) Stats() ManagerStats {
+	m.budgetLock.Lock()
+	defer m.budgetLock.Unlock()
+
+	stats := ManagerStats{
+		ByteBudget: m.byteLimit,
+		BytesUsed:  m.bytesUsed,
+		Namespaces: make(map[string]NamespaceStats, len(m.usage)),
+	}
+	for namespace, usage := range m.usage {
+		stats.Namespaces[namespace] = NamespaceStats{
+			Quota:           m.quota(namespace),
+			BytesUsed:       usage.bytesUsed,
+			RejectedWrites:  usage.rejectedWrites,
+			ThrottledWrites: usage.throttledWrites,
+			ThrottledTime:   usage.throttledTime,
+		}
+	}
+	return stats
+}
+
+// quota returns the quota of the namespace. The caller must hold m.budgetLock.
+func (m *Manager) quota(namespace string) Quota {
+	if quota, ok := m.quotas[namespace]; ok {
+		return quota
+	}
+	return m.defaultQuota
+}
+
+// namespaceUsage accounts for the writes of a namespace against its quota.
+type namespaceUsage struct {
+	bytesUsed int64
+	// bytes and entries are the rate limiters of the namespace, nil until its first write after its
+	// quota was set.
+	bytes   *rateLimiter
+	entries *rateLimiter
+
+	rejectedWrites  uint64
+	throttledWrites uint64
+	throttledTime   time.Duration
+}
+
+// usageOf returns the usage of the namespace, creating it if needed. The caller must hold m.budgetLock.
+func (m *Manager) usageOf(namespace string) *namespaceUsage {
+	usage, ok := m.usage[namespace]
+	if !ok {
+		usage = &namespaceUsage{}
+		m.usage[namespace] = usage
+	}
+	return usage
+}
+
+// namespaceBudget is the byteBudget of the WAL of a namespace: it enforces the quota of the namespace,
+// and the byte budget of the Manager.
+type namespaceBudget struct {
+	manager   *Manager
+	namespace string
+}
+
+func (b *namespaceBudget) admit(n int64) error {
+	m := b.manager
+	wait, err := b.throttle(n)
+	if err != nil || wait <= 0 {
+		return err
+	}
+
+	// The write is accounted already, it only waits for its turn.
+	timer := m.clock.NewTimer(wait)
+	select {
+	case <-timer.C():
+	case <-m.ctx.Done():
+		timer.Stop()
+	}
+	return nil
+}
+
+// throttle accounts for a write of n bytes against the rate limits of the namespace, and returns how
+// long it must wait to be within them.
+func (b *namespaceBudget) throttle(n int64) (time.Duration, error) {
+	m := b.manager
+	m.budgetLock.Lock()
+	defer m.budgetLock.Unlock()
+
+	quota := m.quota(b.namespace)
+	if quota.BytesPerSecond <= 0 && quota.EntriesPerSecond <= 0 {
+		return 0, nil
+	}
+	usage := m.usageOf(b.namespace)
+	now := m.clock.Now()
+	if quota.BytesPerSecond > 0 && usage.bytes == nil {
+		usage.bytes = newRateLimiter(quota.BytesPerSecond, now)
+	}
+	if quota.EntriesPerSecond > 0 && usage.entries == nil {
+		usage.entries = newRateLimiter(quota.EntriesPerSecond, now)
+	}
+	var wait time.Duration
+	if quota.BytesPerSecond > 0 {
+		wait = max(wait, usage.bytes.delay(float64(n), now))
+	}
+	if quota.EntriesPerSecond > 0 {
+		wait = max(wait, usage.entries.delay(1, now))
+	}
+	if wait > 0 && !quota.Throttle {
+		usage.rejectedWrites++
+		return 0, fmt.Errorf("%w: namespace %s is over its write rate", ErrQuotaExceeded, b.namespace)
+	}
+
+	if quota.BytesPerSecond > 0 {
+		usage.bytes.take(float64(n))
+	}
+	if quota.EntriesPerSecond > 0 {
+		usage.entries.take(1)
+	}
+	if wait > 0 {
+		usage.throttledWrites++
+		usage.throttledTime += wait
+	}
+	return wait, nil
+}
+
+func (b *namespaceBudget) reserve(n int64) error {
+	m := b.manager
+	m.budgetLock.Lock()
+	defer m.budgetLock.Unlock()
+
+	quota := m.quota(b.namespace)
+	usage := m.usageOf(b.namespace)
+	if quota.MaxBytes > 0 && usage.bytesUsed+n > quota.MaxBytes {
+		usage.rejectedWrites++
+		return fmt.Errorf("%w: namespace %s would use more than %d bytes", ErrQuotaExceeded, b.namespace, quota.MaxBytes)
+	}
+	if m.byteLimit > 0 && m.bytesUsed+n > m.byteLimit {
+		usage.rejectedWrites++
+		return ErrBudgetExceeded
+	}
+	usage.bytesUsed += n
+	m.bytesUsed += n
+	return nil
+}
+
+func (b *namespaceBudget) release(n int64) {
+	m := b.manager
+	m.budgetLock.Lock()
+	defer m.budgetLock.Unlock()
+
+	usage := m.usageOf(b.namespace)
+	usage.bytesUsed = max(usage.bytesUsed-n, 0)
+	m.bytesUsed = max(m.bytesUsed-n, 0)
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per second, holding up to a second worth of them.
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int64, now time.Time) *rateLimiter {
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: now}
+}
+
+// delay refills the bucket and returns how long to wait until n tokens are available. A full bucket
+// always allows a take, even of more tokens than it holds, so that large writes aren't rejected forever.
+func (l *rateLimiter) delay(n float64, now time.Time) time.Duration {
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = min(l.tokens+elapsed.Seconds()*l.rate, l.rate)
+		l.last = now
+	}
+	if l.tokens >= n || l.tokens >= l.rate {
+		return 0
+	}
+	return time.Duration((n - l.tokens) / l.rate * float64(time.Second))
+}
+
+// take takes n tokens, going into debt if there are fewer: the writes after it wait for it to be repaid.
+func (l *rateLimiter) take(n float64) {
+	l.tokens -= n
+}
@@ -0,0 +1,173 @@
+package wal
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// StateMachine is the state of an application, built by applying the entries of a WAL in order,
+// see Recover.
+type StateMachine interface {
+	// Apply applies an entry to the state.
+	Apply(entry *WAL_Entry) error
+	// Snapshot returns the state, as of the last entry applied.
+	Snapshot() ([]byte, error)
+	// Restore replaces the state with one returned by Snapshot.
+	Restore(state []byte) error
+}
+
+// Recovery drives a StateMachine from a WAL: Recover restores the latest snapshot and replays the
+// entries after it, then Write appends entries and applies them. Every so many entries, the state is
+// saved in the SnapshotStore and the segments it covers are deleted.
+//
+// The entries written to the WAL other than through Write aren't applied until the next Recover, and
+// checkpoint entries are never applied.
+type Recovery struct {
+	store         *SnapshotStore
+	machine       StateMachine
+	snapshotEvery int
+	truncate      bool
+
+	lock          sync.Mutex // serializes writes, so that entries are applied in order
+	applied       uint64     // sequence number of the last entry applied
+	sinceSnapshot int        // entries applied since the last snapshot
+	err           error      // error of a failed Apply, returned by every later Write
+}
+
+// RecoveryOption configures a Recovery.
+type RecoveryOption func(*Recovery)
+
+// WithSnapshotEvery saves a snapshot of the state every n entries written. The default is 10000; 0
+// disables automatic snapshots, which are then only saved by Snapshot.
+func WithSnapshotEvery(n int) RecoveryOption {
+	return func(r *Recovery) {
+		r.snapshotEvery = max(n, 0)
+	}
+}
+
+// WithTruncation sets whether the segments covered by the oldest snapshot kept are deleted once a
+// snapshot is saved, see WAL.TruncateBefore. It is enabled by default.
+func WithTruncation(enabled bool) RecoveryOption {
+	return func(r *Recovery) {
+		r.truncate = enabled
+	}
+}
+
+// Recover restores the machine from the latest snapshot of store, if any, then applies the entries of
+// the log written after it, and returns the Recovery to write the next entries through.
+func Recover(store *SnapshotStore, machine StateMachine, opts ...RecoveryOption) (*Recovery, error) {
+	r := &Recovery{store: store, machine: machine, snapshotEvery: 10000, truncate: true}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	snapshot, entries, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		if err := machine.Restore(snapshot.State); err != nil {
+			return nil, fmt.Errorf("could not restore snapshot %d: %w", snapshot.LogSequenceNumber, err)
+		}
+		r.applied = snapshot.LogSequenceNumber
+	}
+	for _, entry := range entries {
+		if err := r.apply(entry); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// apply applies a non-checkpoint entry to the machine.
+// The caller must hold r.lock, or have the Recovery to itself.
+func (r *Recovery) apply(entry *WAL_Entry) error {
+	if entry.GetIsCheckpoint() {
+		return nil
+	}
+	if err := r.machine.Apply(entry); err != nil {
+		return fmt.Errorf("could not apply entry %d: %w", entry.GetLogSequenceNumber(), err)
+	}
+	r.applied = entry.GetLogSequenceNumber()
+	r.sinceSnapshot++
+	return nil
+}
+
+// Write writes an entry to the WAL, like AppendEntry, applies it to the machine and returns its
+// sequence number. A snapshot is saved once WithSnapshotEvery entries have been written since the last
+// one; if that fails, the error is logged and the snapshot is retried after as many entries again.
+//
+// If Apply fails, the entry is in the log but not in the state, so the state is only consistent with
+// the log again once recovered: the error is returned by this and every later call to Write.
+func (r *Recovery) Write(data []byte, opts ...EntryOption) (uint64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return 0, r.err
+	}
+	entry := &WAL_Entry{Data: data}
+	for _, opt := range opts {
+		opt(entry)
+	}
+	if err := r.store.wal.writeEntry(entry); err != nil {
+		return 0, err
+	}
+	if err := r.apply(entry); err != nil {
+		r.err = err
+		return entry.GetLogSequenceNumber(), err
+	}
+
+	if r.snapshotEvery > 0 && r.sinceSnapshot >= r.snapshotEvery {
+		if err := r.snapshot(); err != nil {
+			log.Printf("Error while saving a snapshot of the state: %v", err)
+			r.sinceSnapshot = 0
+		}
+	}
+	return entry.GetLogSequenceNumber(), nil
+}
+
+// Snapshot saves a snapshot of the state, as of the last entry applied, and deletes the segments it
+// covers with WithTruncation.
+func (r *Recovery) Snapshot() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	return r.snapshot()
+}
+
+// snapshot saves a snapshot of the state. The caller must hold r.lock.
+func (r *Recovery) snapshot() error {
+	state, err := r.machine.Snapshot()
+	if err != nil {
+		return err
+	}
+	if err := r.store.Save(r.applied, state); err != nil {
+		return err
+	}
+	r.sinceSnapshot = 0
+	if !r.truncate {
+		return nil
+	}
+
+	// The entries are kept back to the oldest snapshot, which Load falls back to if the newer ones
+	// are unreadable.
+	names, err := r.store.list()
+	if err != nil || len(names) == 0 {
+		return err
+	}
+	_, err = r.store.wal.TruncateBefore(names[0].lsn + 1)
+	return err
+}
+
+// Applied returns the sequence number of the last entry applied to the machine.
+func (r *Recovery) Applied() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.applied
+}
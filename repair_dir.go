@@ -0,0 +1,180 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// repairBackupDirName is the directory, inside the WAL directory, holding the backups made by RepairDir.
+const repairBackupDirName = "repair-backups"
+
+// RepairReport is the result of RepairDir.
+type RepairReport struct {
+	Directory string `json:"directory"`
+	DryRun    bool   `json:"dry_run"`
+	// Segments lists the segments that were (or, in a dry run, would be) truncated.
+	Segments []SegmentRepair `json:"segments"`
+}
+
+// SegmentRepair describes the truncation of a corrupted segment.
+type SegmentRepair struct {
+	Path string `json:"path"`
+	// Size is the size of the segment before the repair.
+	Size int64 `json:"size"`
+	// TruncatedAt is the offset of the first corrupted entry; the segment is truncated to this size.
+	TruncatedAt int64 `json:"truncated_at"`
+	// EntriesKept is the number of entries preceding the corruption.
+	EntriesKept int `json:"entries_kept"`
+	// Reason describes the first corruption found in the segment.
+	Reason string `json:"reason"`
+	// Backup is the path of the copy of the segment made before truncating it, if any.
+	Backup string `json:"backup,omitempty"`
+}
+
+// RepairDir repairs every segment of the WAL in the directory, unlike Repair which only handles
+// the last one. Each corrupted segment is truncated at its first corrupted entry, as Repair does.
+// Segments are scanned and rewritten concurrently, see WithRepairConcurrency.
+// It must not be used on the directory of a running WAL.
+//
+// If dryRun is set, the segments are only scanned and the report describes what would be truncated.
+// If backup is set, a copy of each segment is saved in the repair-backups directory inside
+// the WAL directory before it is truncated. The only options used are WithFS, WithClock and
+// WithRepairConcurrency.
+//
+// If some segments can't be repaired, the others are still repaired, and the report lists them along
+// with the errors.
+func RepairDir(directory string, dryRun bool, backup bool, opts ...Option) (*RepairReport, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	segments, err := listSegmentFiles(o.fs, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RepairReport{Directory: directory, DryRun: dryRun, Segments: []SegmentRepair{}}
+	backupSuffix := strconv.FormatInt(o.clock.Now().UnixNano(), 10)
+
+	// Every segment is repaired independently, by a bounded number of workers.
+	repairs := make([]*SegmentRepair, len(segments))
+	errs := make([]error, len(segments))
+	workers := make(chan struct{}, max(o.repairConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, segment := range segments {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			repairs[i], errs[i] = repairSegment(o.fs, directory, segment, dryRun, backup, backupSuffix)
+		}()
+	}
+	wg.Wait()
+
+	for _, repair := range repairs {
+		if repair != nil {
+			report.Segments = append(report.Segments, *repair)
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// repairSegment truncates the segment at its first corrupted entry, if any, and describes the repair.
+func repairSegment(fs FS, directory string, segment segmentFile, dryRun bool, backup bool, backupSuffix string) (*SegmentRepair, error) {
+	segmentReport, entriesKept := verifySegment(fs, segment)
+	if segmentReport.Error != "" {
+		return nil, fmt.Errorf("could not read %s: %s", segment.path, segmentReport.Error)
+	}
+	if len(segmentReport.CorruptRanges) == 0 {
+		return nil, nil
+	}
+
+	corruptRange := segmentReport.CorruptRanges[0]
+	repair := &SegmentRepair{
+		Path:        segment.path,
+		Size:        segmentReport.Size,
+		TruncatedAt: corruptRange.Start,
+		EntriesKept: entriesKept,
+		Reason:      fmt.Sprintf("%s: %s", corruptRange.Kind, corruptRange.Error),
+	}
+	if dryRun {
+		return repair, nil
+	}
+
+	if backup {
+		var err error
+		if repair.Backup, err = backupSegment(fs, directory, segment.path, backupSuffix); err != nil {
+			return nil, fmt.Errorf("could not back up %s: %w", segment.path, err)
+		}
+	}
+	if err := truncateSegmentFile(fs, segment.path, repair.TruncatedAt); err != nil {
+		return nil, fmt.Errorf("could not truncate %s: %w", segment.path, err)
+	}
+	return repair, nil
+}
+
+// backupSegment copies the segment into the backup directory and returns the path of the copy.
+// Backups are suffixed with the time of the repair, so repeated repairs don't overwrite them.
+func backupSegment(fs FS, directory string, path string, suffix string) (string, error) {
+	backupDir := filepath.Join(directory, repairBackupDirName)
+	if err := fs.MkdirAll(backupDir, 0755); err != nil {
+		return "", err
+	}
+	src, err := fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	backupPath := filepath.Join(backupDir, filepath.Base(path)+"."+suffix)
+	dst, err := fs.OpenFile(backupPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return "", err
+	}
+	return backupPath, dst.Close()
+}
+
+// truncateSegmentFile atomically replaces the segment with its first size bytes.
+func truncateSegmentFile(fs FS, path string, size int64) error {
+	src, err := fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tempFilePath := fmt.Sprintf("%s.tmp", path)
+	tempFile, err := fs.OpenFile(tempFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(tempFile, src, size); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	return fs.Rename(tempFilePath, path)
+}
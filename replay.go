@@ -0,0 +1,98 @@
+package wal
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ReplayProgress is the progress of a consumer replaying the log with ReplayOnce.
+type ReplayProgress struct {
+	// Applied is the sequence number of the last entry applied, or 0 if none was.
+	Applied uint64
+	// Keys are the keys of the last entries applied, oldest first, up to the idempotency window.
+	Keys []string
+}
+
+// OnceApplier applies the entries replayed by ReplayOnce, and stores the progress of the replay in the
+// same system as their effects, e.g. a database.
+type OnceApplier interface {
+	// Progress returns the progress last committed by Apply, the zero ReplayProgress if none was.
+	Progress() (ReplayProgress, error)
+	// Apply applies the entry and commits progress, which includes it, in the same transaction as its
+	// effects: either both are committed, or neither is.
+	Apply(entry *WAL_Entry, progress ReplayProgress) error
+}
+
+// ReplayOption configures ReplayOnce.
+type ReplayOption func(*replayOptions)
+
+type replayOptions struct {
+	window int
+}
+
+// WithIdempotencyWindow remembers the keys of the last n entries applied, see WithKey, and skips the
+// entries whose key is among them, e.g. those written again by a producer retrying a write whose
+// outcome it didn't know. The default is 0: entries are only deduplicated by sequence number.
+func WithIdempotencyWindow(n int) ReplayOption {
+	return func(o *replayOptions) {
+		o.window = max(n, 0)
+	}
+}
+
+// ReplayOnce applies the entries of the log after the progress of applier, and returns the number of
+// entries applied. Since the progress is committed with the effects of every entry, an entry is never
+// applied twice, even if the process crashed in the middle of a previous replay.
+//
+// Checkpoint entries are skipped. ReplayOnce stops at the last entry written when it is called; it can
+// be called again to apply the entries written since.
+func ReplayOnce(wal *WAL, applier OnceApplier, opts ...ReplayOption) (int, error) {
+	var o replayOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	progress, err := applier.Progress()
+	if err != nil {
+		return 0, fmt.Errorf("could not load replay progress: %w", err)
+	}
+
+	// Entries are read from the segment files.
+	if err := wal.Flush(); err != nil {
+		return 0, err
+	}
+	var from uint64
+	if progress.Applied > 0 {
+		from = progress.Applied + 1
+	}
+	tail, err := wal.Tail(from)
+	if err != nil {
+		return 0, err
+	}
+	defer tail.Stop()
+
+	applied := 0
+	err = tail.Read(func(entry *WAL_Entry) error {
+		lsn := entry.GetLogSequenceNumber()
+		if lsn <= progress.Applied || entry.GetIsCheckpoint() {
+			return nil
+		}
+		key := string(entry.GetKey())
+		if o.window > 0 && key != "" && slices.Contains(progress.Keys, key) {
+			return nil
+		}
+
+		next := ReplayProgress{Applied: lsn, Keys: progress.Keys}
+		if o.window > 0 && key != "" {
+			// The keys are copied, so that the progress passed to Apply isn't modified afterwards.
+			next.Keys = append(slices.Clone(progress.Keys), key)
+			next.Keys = next.Keys[max(len(next.Keys)-o.window, 0):]
+		}
+		if err := applier.Apply(entry, next); err != nil {
+			return fmt.Errorf("could not apply entry %d: %w", lsn, err)
+		}
+		progress = next
+		applied++
+		return nil
+	})
+	return applied, err
+}
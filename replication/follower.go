@@ -0,0 +1,234 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrSequenceGap is returned by Follower.Run when the primary sends an entry that doesn't directly
+// follow the last entry of the local WAL.
+var ErrSequenceGap = errors.New("gap in replicated sequence numbers")
+
+// ErrSnapshotRequired is returned by Follower.Run when the entries following the last entry of the
+// local WAL are no longer in the log of the primary, e.g. because they were deleted by retention.
+// The follower must be restored from a snapshot or checkpoint of the primary before it can resume.
+var ErrSnapshotRequired = errors.New("snapshot required")
+
+// Follower mirrors the log of a primary into a local WAL, keeping the sequence numbers of the entries.
+type Follower struct {
+	transport Transport
+	walog     *wal.WAL
+	followerOptions
+
+	applied atomic.Uint64
+	durable atomic.Uint64
+	primary atomic.Uint64
+
+	// resumeToken is the token of the last batch written to the local WAL.
+	tokenLock   sync.Mutex
+	resumeToken []byte
+}
+
+// NewFollower returns a Follower replicating the log of the primary reached through transport
+// into walog, after the last entry already in walog. The local WAL must only be written by the Follower.
+func NewFollower(transport Transport, walog *wal.WAL, opts ...FollowerOption) *Follower {
+	o := defaultFollowerOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	f := &Follower{transport: transport, walog: walog, followerOptions: o}
+	lastSequenceNumber := walog.Stats().LastSequenceNumber
+	f.applied.Store(lastSequenceNumber)
+	f.durable.Store(lastSequenceNumber)
+	return f
+}
+
+// AppliedSequenceNumber returns the sequence number of the last entry written to the local WAL.
+func (f *Follower) AppliedSequenceNumber() uint64 {
+	return f.applied.Load()
+}
+
+// DurableSequenceNumber returns the sequence number of the last entry synced to disk by the local WAL.
+func (f *Follower) DurableSequenceNumber() uint64 {
+	return f.durable.Load()
+}
+
+// PrimarySequenceNumber returns the sequence number of the last entry of the primary, as of its
+// last heartbeat or the last entry received, whichever is newer.
+func (f *Follower) PrimarySequenceNumber() uint64 {
+	return max(f.primary.Load(), f.applied.Load())
+}
+
+// Run replicates entries until ctx is done or replication can't continue. When the stream fails
+// because the primary is unavailable, Run reconnects after the reconnect interval and resumes after
+// the last entry written to the local WAL. It returns ErrSequenceGap, or an error wrapping
+// wal.ErrCorruptEntry or wal.ErrInvalidEntry, if the primary sends entries that can't be applied,
+// and an error wrapping ErrSnapshotRequired if the primary no longer has the entries to send and
+// can't send a snapshot instead, see WithSnapshotHandler.
+func (f *Follower) Run(ctx context.Context) error {
+	for {
+		err := f.follow(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if status.Code(err) == codes.OutOfRange {
+			return fmt.Errorf("%w: %v", ErrSnapshotRequired, status.Convert(err).Message())
+		}
+		if !isTransient(err) {
+			return err
+		}
+
+		timer := time.NewTimer(f.reconnectInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// follow runs a single stream.
+func (f *Follower) follow(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := f.transport.Open(ctx)
+	if err != nil {
+		return err
+	}
+
+	start := &Start{
+		FollowerId:             f.id,
+		AfterLogSequenceNumber: f.applied.Load(),
+		Window:                 uint32(f.window),
+		AcceptSnapshot:         f.acceptSnapshots,
+	}
+	f.tokenLock.Lock()
+	start.ResumeToken = f.resumeToken
+	f.tokenLock.Unlock()
+	if err := stream.Send(&StreamRequest{Request: &StreamRequest_Start{Start: start}}); err != nil {
+		return err
+	}
+
+	// snapshot holds the chunks of the snapshot being received.
+	var snapshot []byte
+	for {
+		response, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if heartbeat := response.GetHeartbeat(); heartbeat != nil {
+			f.primary.Store(heartbeat.GetLastLogSequenceNumber())
+			continue
+		}
+
+		if chunk := response.GetSnapshot(); chunk != nil {
+			snapshot = append(snapshot, chunk.GetData()...)
+			if !chunk.GetLast() {
+				continue
+			}
+			if err := f.restore(chunk.GetLogSequenceNumber(), snapshot, chunk.GetResumeToken()); err != nil {
+				return err
+			}
+			snapshot = nil
+		} else if err := f.apply(response.GetEntries()); err != nil {
+			return err
+		}
+		ack := &Ack{AppliedLogSequenceNumber: f.applied.Load(), DurableLogSequenceNumber: f.durable.Load()}
+		if err := stream.Send(&StreamRequest{Request: &StreamRequest_Ack{Ack: ack}}); err != nil {
+			return err
+		}
+	}
+}
+
+// apply verifies the entries of the batch and writes them to the local WAL, then syncs it.
+func (f *Follower) apply(batch *Entries) error {
+	for _, data := range batch.GetEntries() {
+		entry, err := wal.UnmarshalEntry(data)
+		if err != nil {
+			return fmt.Errorf("invalid entry after sequence number %d: %w", f.applied.Load(), err)
+		}
+
+		lsn := entry.GetLogSequenceNumber()
+		if applied := f.applied.Load(); lsn <= applied || (lsn != applied+1 && !f.allowGaps) {
+			return fmt.Errorf("%w: received %d after %d", ErrSequenceGap, lsn, applied)
+		}
+
+		if err := f.walog.WriteEntryOpts(entry.GetData(), entryOptions(entry)...); err != nil {
+			return fmt.Errorf("could not write entry %d: %w", lsn, err)
+		}
+		f.applied.Store(lsn)
+	}
+
+	if err := f.walog.Sync(); err != nil {
+		return err
+	}
+	f.durable.Store(f.applied.Load())
+
+	f.tokenLock.Lock()
+	f.resumeToken = batch.GetResumeToken()
+	f.tokenLock.Unlock()
+	return nil
+}
+
+// entryOptions returns the options writing a copy of the entry, with the same sequence number.
+func entryOptions(entry *wal.WAL_Entry) []wal.EntryOption {
+	opts := []wal.EntryOption{
+		wal.WithSequenceNumber(entry.GetLogSequenceNumber()),
+		wal.WithStream(entry.GetStream()),
+		wal.WithKey(entry.GetKey()),
+		wal.WithMetadata(entry.GetMetadata()),
+		wal.WithLabels(entry.GetLabels()),
+	}
+	if !entry.Time().IsZero() {
+		opts = append(opts, wal.WithTimestamp(entry.Time()))
+	}
+	if entry.HLC() != 0 {
+		opts = append(opts, wal.WithHLC(entry.HLC()))
+	}
+	if entry.GetIsCheckpoint() {
+		opts = append(opts, wal.WithCheckpoint())
+	}
+	if entry.GetTombstone() {
+		opts = append(opts, wal.WithTombstone())
+	}
+	if entry.GetSchema() != "" || entry.GetSchemaVersion() != 0 {
+		opts = append(opts, wal.WithSchema(entry.GetSchema(), entry.GetSchemaVersion()))
+	}
+	return opts
+}
+
+// isTransient reports whether the stream failed because of the connection or the availability of
+// the primary, rather than because of the entries it sent.
+func isTransient(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return true
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted, codes.Internal, codes.Unknown, codes.DeadlineExceeded:
+		return true
+	case codes.AlreadyExists:
+		// The primary hasn't noticed yet that the previous stream of the follower ended.
+		return true
+	}
+	return false
+}
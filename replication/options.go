@@ -0,0 +1,143 @@
+package replication
+
+import "time"
+
+const (
+	defaultHeartbeatInterval = time.Second
+	defaultMaxBatchSize      = 256
+	defaultWindow            = 4096
+)
+
+// ServerOption configures a Server created with NewServer.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	id                string
+	heartbeatInterval time.Duration
+	maxBatchSize      int
+	window            int
+	quorum            int
+	snapshots         SnapshotSource
+}
+
+func defaultServerOptions() serverOptions {
+	return serverOptions{
+		heartbeatInterval: defaultHeartbeatInterval,
+		maxBatchSize:      defaultMaxBatchSize,
+		window:            defaultWindow,
+	}
+}
+
+// WithServerID sets the ID of the server, which is embedded in the resume tokens it issues.
+// Followers can only resume with tokens issued by a server with the same ID, so the ID should
+// identify the log, e.g. the name of the primary. Defaults to the empty ID.
+func WithServerID(id string) ServerOption {
+	return func(o *serverOptions) {
+		o.id = id
+	}
+}
+
+// WithHeartbeatInterval sets how long a stream may be idle before a heartbeat is sent.
+// Defaults to 1s.
+func WithHeartbeatInterval(interval time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.heartbeatInterval = interval
+	}
+}
+
+// WithMaxBatchSize sets the maximum number of entries sent in a single message.
+// Defaults to 256.
+func WithMaxBatchSize(entries int) ServerOption {
+	return func(o *serverOptions) {
+		o.maxBatchSize = entries
+	}
+}
+
+// WithWindow sets the default maximum number of entries sent to a follower but not acknowledged,
+// for followers that don't request a window. Defaults to 4096.
+func WithWindow(entries int) ServerOption {
+	return func(o *serverOptions) {
+		o.window = entries
+	}
+}
+
+// WithQuorum sets the number of followers that must acknowledge syncing an entry to disk before
+// Server.WriteEntry and Server.WaitForDurable return. Defaults to 0: only the local WAL is synced.
+func WithQuorum(followers int) ServerOption {
+	return func(o *serverOptions) {
+		o.quorum = followers
+	}
+}
+
+// WithSnapshots lets the server catch up followers that need entries it no longer has, e.g. because
+// they were deleted by retention: it sends them the latest snapshot of source, then the entries that
+// follow it. Only followers created with WithSnapshotHandler accept snapshots. By default, and when
+// source has no snapshot followed by entries still in the log, the stream fails with OUT_OF_RANGE.
+func WithSnapshots(source SnapshotSource) ServerOption {
+	return func(o *serverOptions) {
+		o.snapshots = source
+	}
+}
+
+const defaultReconnectInterval = time.Second
+
+// FollowerOption configures a Follower created with NewFollower.
+type FollowerOption func(*followerOptions)
+
+type followerOptions struct {
+	id                string
+	window            int
+	reconnectInterval time.Duration
+	allowGaps         bool
+	acceptSnapshots   bool
+	onSnapshot        func(lsn uint64, data []byte) error
+}
+
+func defaultFollowerOptions() followerOptions {
+	return followerOptions{reconnectInterval: defaultReconnectInterval}
+}
+
+// WithFollowerID sets the ID the follower reports to the primary. The primary tracks the progress of
+// followers, and counts them towards its quorum, by ID, so every follower of a primary must set a
+// distinct ID that stays the same across restarts. The primary rejects followers without an ID.
+func WithFollowerID(id string) FollowerOption {
+	return func(o *followerOptions) {
+		o.id = id
+	}
+}
+
+// WithFollowerWindow sets the maximum number of entries the primary may send before they are
+// acknowledged. Defaults to the window of the server.
+func WithFollowerWindow(entries int) FollowerOption {
+	return func(o *followerOptions) {
+		o.window = entries
+	}
+}
+
+// WithReconnectInterval sets how long the follower waits before reconnecting after the stream failed.
+// Defaults to 1s.
+func WithReconnectInterval(interval time.Duration) FollowerOption {
+	return func(o *followerOptions) {
+		o.reconnectInterval = interval
+	}
+}
+
+// WithAllowGaps accepts entries whose sequence number doesn't directly follow the previous one,
+// for primaries whose log has gaps, e.g. because it was compacted.
+func WithAllowGaps() FollowerOption {
+	return func(o *followerOptions) {
+		o.allowGaps = true
+	}
+}
+
+// WithSnapshotHandler accepts snapshots from primaries that no longer have the entries the follower
+// needs, see WithSnapshots. The snapshot is written to the local WAL as a checkpoint with the sequence
+// number of the last entry it covers, then passed to fn, if not nil, to restore the state of the
+// application. If fn fails, Run returns its error; the snapshot remains the last checkpoint of the
+// local WAL.
+func WithSnapshotHandler(fn func(lsn uint64, data []byte) error) FollowerOption {
+	return func(o *followerOptions) {
+		o.acceptSnapshots = true
+		o.onSnapshot = fn
+	}
+}
@@ -0,0 +1,56 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+// ErrQuorumNotReached is returned by Server.WriteEntry and Server.WaitForDurable when the context
+// is done before enough followers acknowledged syncing the entry. The entry is still in the log of
+// the primary and may be replicated later.
+var ErrQuorumNotReached = errors.New("quorum of followers not reached")
+
+// WriteEntry writes an entry to the WAL of the server and waits until it is durable, see WaitForDurable.
+// Together with WithQuorum, it turns the server into a synchronous replication primary.
+func (s *Server) WriteEntry(ctx context.Context, data []byte, opts ...wal.EntryOption) error {
+	lsn, err := s.walog.AppendEntry(data, opts...)
+	if err != nil {
+		return err
+	}
+	return s.WaitForDurable(ctx, lsn)
+}
+
+// WaitForDurable syncs the WAL of the server, then waits until the number of followers set with
+// WithQuorum acknowledged syncing the entries up to the given sequence number to disk. Entries are
+// sent to followers once they have been synced, which the sync makes happen right away, and followers
+// poll for them every sync interval of the WAL. It returns an error wrapping ErrQuorumNotReached and the context
+// error if ctx is done first.
+func (s *Server) WaitForDurable(ctx context.Context, lsn uint64) error {
+	if err := s.walog.Sync(); err != nil {
+		return err
+	}
+
+	for {
+		s.lock.Lock()
+		durable := 0
+		for _, follower := range s.followers {
+			if follower.DurableLogSequenceNumber >= lsn {
+				durable++
+			}
+		}
+		changed := s.durableChanged
+		s.lock.Unlock()
+
+		if durable >= s.quorum {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %d of %d followers synced entry %d: %w", ErrQuorumNotReached, durable, s.quorum, lsn, ctx.Err())
+		case <-changed:
+		}
+	}
+}
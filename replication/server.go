@@ -0,0 +1,395 @@
+// Package replication streams the entries of a WAL to followers over gRPC, so that goWAL can be used
+// as the log of a primary and its replicas.
+//
+//	server := replication.NewServer(walog, replication.WithServerID("orders-primary"))
+//	replication.RegisterReplicationServer(grpcServer, server)
+package replication
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Server implements the Replication service for a WAL. Entries are streamed once they have been
+// synced to disk, which happens at least every sync interval of the WAL, so that followers never apply
+// entries the primary could lose in a crash.
+type Server struct {
+	UnimplementedReplicationServer
+
+	walog *wal.WAL
+	serverOptions
+
+	lock      sync.Mutex
+	followers map[string]*FollowerStatus
+	// durableChanged is closed, and replaced, when a follower acknowledges syncing more entries.
+	durableChanged chan struct{}
+}
+
+// FollowerStatus is the replication progress of a follower, as reported by Server.Followers.
+type FollowerStatus struct {
+	ID        string `json:"id"`
+	Connected bool   `json:"connected"`
+	// SentLogSequenceNumber is the sequence number of the last entry sent to the follower.
+	SentLogSequenceNumber uint64 `json:"sent_log_sequence_number"`
+	// AppliedLogSequenceNumber is the last entry the follower acknowledged writing.
+	AppliedLogSequenceNumber uint64 `json:"applied_log_sequence_number"`
+	// DurableLogSequenceNumber is the last entry the follower acknowledged syncing to disk.
+	DurableLogSequenceNumber uint64    `json:"durable_log_sequence_number"`
+	LastAck                  time.Time `json:"last_ack"`
+}
+
+// NewServer returns a Server streaming the entries of walog.
+func NewServer(walog *wal.WAL, opts ...ServerOption) *Server {
+	o := defaultServerOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Server{
+		walog:          walog,
+		serverOptions:  o,
+		followers:      make(map[string]*FollowerStatus),
+		durableChanged: make(chan struct{}),
+	}
+}
+
+// Followers returns the status of the followers that connected to the server, ordered by ID.
+func (s *Server) Followers() []FollowerStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	followers := make([]FollowerStatus, 0, len(s.followers))
+	for _, follower := range s.followers {
+		followers = append(followers, *follower)
+	}
+	slices.SortFunc(followers, func(a, b FollowerStatus) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return followers
+}
+
+// Stream implements the Replication service.
+func (s *Server) Stream(stream Replication_StreamServer) error {
+	return s.Serve(stream)
+}
+
+// Serve streams entries to the follower at the other end of stream until the stream fails
+// or the follower closes it. Transports call it for every stream they accept.
+func (s *Server) Serve(stream ServerConn) error {
+	request, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	start := request.GetStart()
+	if start == nil {
+		return status.Error(codes.InvalidArgument, "the first message of the stream must be a Start")
+	}
+
+	// The progress of followers, and so the quorum, is tracked by ID.
+	if start.GetFollowerId() == "" {
+		return status.Error(codes.InvalidArgument, "the follower must set an ID")
+	}
+
+	after := start.GetAfterLogSequenceNumber()
+	if len(start.GetResumeToken()) > 0 {
+		var token ResumeToken
+		if err := proto.Unmarshal(start.GetResumeToken(), &token); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid resume token: %v", err)
+		}
+		if token.GetServerId() != s.id {
+			return status.Errorf(codes.FailedPrecondition, "resume token was issued by server %q, not %q", token.GetServerId(), s.id)
+		}
+		after = token.GetLogSequenceNumber()
+	}
+
+	window := int(start.GetWindow())
+	if window == 0 {
+		window = s.window
+	}
+
+	f := &follower{
+		server:         s,
+		id:             start.GetFollowerId(),
+		stream:         stream,
+		window:         window,
+		acceptSnapshot: start.GetAcceptSnapshot(),
+		acked:          make(chan struct{}, 1),
+	}
+	if err := s.connect(f.id, after); err != nil {
+		return err
+	}
+	defer s.disconnect(f.id)
+
+	ctx, cancel := context.WithCancelCause(stream.Context())
+	go func() {
+		cancel(f.receiveAcks())
+	}()
+	// The stream must not be used once Serve returns, so the heartbeats are stopped first.
+	heartbeatsDone := make(chan struct{})
+	defer func() {
+		cancel(nil)
+		<-heartbeatsDone
+	}()
+	go func() {
+		defer close(heartbeatsDone)
+		if err := f.sendHeartbeats(ctx); err != nil {
+			cancel(err)
+		}
+	}()
+
+	err = f.send(ctx, after)
+	if ctx.Err() != nil {
+		// The follower closing its side of the stream ends the stream normally.
+		if cause := context.Cause(ctx); !errors.Is(cause, io.EOF) {
+			return cause
+		}
+		return nil
+	}
+	return err
+}
+
+// connect records that the follower with the given ID is connected. It fails if another stream
+// of a follower with the same ID is connected, which would count it twice in the quorum.
+func (s *Server) connect(id string, after uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	progress, ok := s.followers[id]
+	if !ok {
+		progress = &FollowerStatus{ID: id}
+		s.followers[id] = progress
+	} else if progress.Connected {
+		return status.Errorf(codes.AlreadyExists, "follower %q is already connected", id)
+	}
+	progress.Connected = true
+	progress.SentLogSequenceNumber = after
+	return nil
+}
+
+func (s *Server) disconnect(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.followers[id].Connected = false
+}
+
+// follower is the state of a stream to a follower.
+type follower struct {
+	server *Server
+	id     string
+	stream ServerConn
+	window int
+	// acceptSnapshot is set if the follower can be sent a snapshot when its entries were deleted.
+	acceptSnapshot bool
+
+	// inflight holds the sequence numbers of the entries sent but not acknowledged yet, oldest first.
+	inflightLock sync.Mutex
+	inflight     []uint64
+	// acked is signalled when acknowledgements free up the window.
+	acked chan struct{}
+
+	// sendLock serializes the responses sent by send and sendHeartbeats, and guards lastSend.
+	sendLock sync.Mutex
+	lastSend time.Time
+}
+
+// sendResponse sends a response on the stream.
+func (f *follower) sendResponse(response *StreamResponse) error {
+	f.sendLock.Lock()
+	defer f.sendLock.Unlock()
+
+	if err := f.stream.Send(response); err != nil {
+		return err
+	}
+	f.lastSend = time.Now()
+	return nil
+}
+
+// sendHeartbeats sends a heartbeat whenever the stream has been idle for the heartbeat interval,
+// until ctx is done. Heartbeats are sent independently of the entries, so that a follower still
+// hears from the primary while reading the log stalls.
+func (f *follower) sendHeartbeats(ctx context.Context) error {
+	ticker := time.NewTicker(f.server.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		f.sendLock.Lock()
+		idle := time.Since(f.lastSend) >= f.server.heartbeatInterval
+		f.sendLock.Unlock()
+		if !idle {
+			continue
+		}
+		heartbeat := &Heartbeat{
+			LastLogSequenceNumber: f.server.walog.Stats().LastSequenceNumber,
+			UnixNano:              time.Now().UnixNano(),
+		}
+		if err := f.sendResponse(&StreamResponse{Response: &StreamResponse_Heartbeat{Heartbeat: heartbeat}}); err != nil {
+			return err
+		}
+	}
+}
+
+// receiveAcks records the acknowledgements of the follower until the stream ends.
+func (f *follower) receiveAcks() error {
+	for {
+		request, err := f.stream.Recv()
+		if err != nil {
+			return err
+		}
+		ack := request.GetAck()
+		if ack == nil {
+			return status.Error(codes.InvalidArgument, "expected an Ack")
+		}
+
+		f.server.lock.Lock()
+		status := f.server.followers[f.id]
+		status.AppliedLogSequenceNumber = max(status.AppliedLogSequenceNumber, ack.GetAppliedLogSequenceNumber())
+		if ack.GetDurableLogSequenceNumber() > status.DurableLogSequenceNumber {
+			status.DurableLogSequenceNumber = ack.GetDurableLogSequenceNumber()
+			close(f.server.durableChanged)
+			f.server.durableChanged = make(chan struct{})
+		}
+		status.LastAck = time.Now()
+		f.server.lock.Unlock()
+
+		f.inflightLock.Lock()
+		acknowledged := 0
+		for acknowledged < len(f.inflight) && f.inflight[acknowledged] <= ack.GetAppliedLogSequenceNumber() {
+			acknowledged++
+		}
+		f.inflight = f.inflight[acknowledged:]
+		f.inflightLock.Unlock()
+
+		select {
+		case f.acked <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// send streams the entries after the given sequence number until ctx is done. Only the entries synced
+// to disk are sent: the primary could lose the others in a crash, and the logs would diverge.
+func (f *follower) send(ctx context.Context, after uint64) error {
+	tail, err := f.server.walog.Tail(after + 1)
+	if errors.Is(err, wal.ErrEntriesDeleted) && f.acceptSnapshot && f.server.snapshots != nil {
+		if after, err = f.sendSnapshot(after, err); err != nil {
+			return err
+		}
+		tail, err = f.server.walog.Tail(after + 1)
+	}
+	if err != nil {
+		return readError(err)
+	}
+	defer tail.Stop()
+
+	batch := &Entries{}
+	flush := func() error {
+		if len(batch.GetEntries()) == 0 {
+			return nil
+		}
+		if err := f.sendResponse(&StreamResponse{Response: &StreamResponse_Entries{Entries: batch}}); err != nil {
+			return err
+		}
+		batch = &Entries{}
+		return nil
+	}
+
+	for {
+		err := tail.ReadUntil(f.server.walog.SyncedSequenceNumber(), func(entry *wal.WAL_Entry) error {
+			// Entries are only sent while the window has room, which bounds the memory used by slow followers.
+			if err := f.waitForWindow(ctx, flush); err != nil {
+				return err
+			}
+
+			lsn := entry.GetLogSequenceNumber()
+			token, err := f.server.resumeToken(lsn)
+			if err != nil {
+				return err
+			}
+			batch.Entries = append(batch.Entries, wal.MustMarshal(entry))
+			batch.ResumeToken = token
+			f.inflightLock.Lock()
+			f.inflight = append(f.inflight, lsn)
+			f.inflightLock.Unlock()
+
+			f.server.lock.Lock()
+			f.server.followers[f.id].SentLogSequenceNumber = lsn
+			f.server.lock.Unlock()
+
+			if len(batch.GetEntries()) >= f.server.maxBatchSize {
+				return flush()
+			}
+			return nil
+		})
+		if errors.Is(err, wal.ErrEntriesDeleted) {
+			return readError(err)
+		}
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tail.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// waitForWindow waits until fewer than window entries are unacknowledged. The pending batch is
+// flushed first, as the follower can't acknowledge entries it hasn't received.
+func (f *follower) waitForWindow(ctx context.Context, flush func() error) error {
+	for {
+		f.inflightLock.Lock()
+		full := len(f.inflight) >= f.window
+		f.inflightLock.Unlock()
+		if !full {
+			return nil
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-f.acked:
+		}
+	}
+}
+
+// readError converts an error reading the log to the status reported to the follower.
+// Entries deleted before they were sent are reported as OUT_OF_RANGE: the follower can only catch up
+// from a snapshot.
+func readError(err error) error {
+	if errors.Is(err, wal.ErrEntriesDeleted) {
+		return status.Errorf(codes.OutOfRange, "snapshot required: %v", err)
+	}
+	return status.Errorf(codes.Internal, "could not read the log: %v", err)
+}
+
+// resumeToken returns the token resuming a stream after the given sequence number.
+func (s *Server) resumeToken(lsn uint64) ([]byte, error) {
+	token, err := proto.Marshal(&ResumeToken{ServerId: s.id, LogSequenceNumber: lsn})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not create the resume token: %v", err)
+	}
+	return token, nil
+}
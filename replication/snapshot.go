@@ -0,0 +1,121 @@
+package replication
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+// snapshotChunkSize is the maximum size of the data of a SnapshotChunk.
+const snapshotChunkSize = 1 << 20
+
+// SnapshotSource provides the snapshots a Server sends to followers that need entries it no longer
+// has, see WithSnapshots.
+type SnapshotSource interface {
+	// LatestSnapshot returns the most recent snapshot and the sequence number of the last entry it
+	// covers. It returns wal.ErrNoCheckpoint if there is no snapshot yet.
+	LatestSnapshot() (lsn uint64, data io.ReadCloser, err error)
+}
+
+// CheckpointSnapshots returns a SnapshotSource serving the data of the last checkpoint of walog,
+// for applications whose checkpoints hold a snapshot of their state.
+func CheckpointSnapshots(walog *wal.WAL) SnapshotSource {
+	return checkpointSnapshots{walog: walog}
+}
+
+type checkpointSnapshots struct {
+	walog *wal.WAL
+}
+
+func (s checkpointSnapshots) LatestSnapshot() (uint64, io.ReadCloser, error) {
+	lsn, data, err := s.walog.LastCheckpoint()
+	if err != nil {
+		return 0, nil, err
+	}
+	return lsn, io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// sendSnapshot sends the latest snapshot to a follower whose entries after the given sequence number
+// were deleted, with the error deleted, and returns the sequence number of the last entry it covers.
+// If the snapshot doesn't help the follower catch up, it returns deleted as OUT_OF_RANGE.
+func (f *follower) sendSnapshot(after uint64, deleted error) (uint64, error) {
+	lsn, data, err := f.server.snapshots.LatestSnapshot()
+	if errors.Is(err, wal.ErrNoCheckpoint) {
+		return 0, readError(deleted)
+	}
+	if err != nil {
+		return 0, readError(fmt.Errorf("could not read the snapshot: %w", err))
+	}
+	defer data.Close()
+
+	// The snapshot is only useful if the entries that follow it are still in the log.
+	if lsn <= after {
+		return 0, readError(deleted)
+	}
+	tail, err := f.server.walog.Tail(lsn + 1)
+	if err != nil {
+		return 0, readError(err)
+	}
+	tail.Stop()
+
+	buf := make([]byte, snapshotChunkSize)
+	for {
+		n, err := io.ReadFull(data, buf)
+		last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !last {
+			return 0, readError(fmt.Errorf("could not read the snapshot: %w", err))
+		}
+
+		chunk := &SnapshotChunk{LogSequenceNumber: lsn, Data: bytes.Clone(buf[:n]), Last: last}
+		if last {
+			if chunk.ResumeToken, err = f.server.resumeToken(lsn); err != nil {
+				return 0, err
+			}
+		}
+		if err := f.sendResponse(&StreamResponse{Response: &StreamResponse_Snapshot{Snapshot: chunk}}); err != nil {
+			return 0, err
+		}
+		if last {
+			break
+		}
+	}
+
+	f.inflightLock.Lock()
+	f.inflight = append(f.inflight, lsn)
+	f.inflightLock.Unlock()
+
+	f.server.lock.Lock()
+	f.server.followers[f.id].SentLogSequenceNumber = lsn
+	f.server.lock.Unlock()
+	return lsn, nil
+}
+
+// restore writes the snapshot received from the primary to the local WAL, as a checkpoint with the
+// sequence number of the last entry it covers, and then passes it to the snapshot handler.
+func (f *Follower) restore(lsn uint64, data []byte, resumeToken []byte) error {
+	if applied := f.applied.Load(); lsn <= applied {
+		return fmt.Errorf("%w: received snapshot of %d after %d", ErrSequenceGap, lsn, applied)
+	}
+	if err := f.walog.WriteEntryOpts(data, wal.WithSequenceNumber(lsn), wal.WithCheckpoint()); err != nil {
+		return fmt.Errorf("could not write snapshot %d: %w", lsn, err)
+	}
+	if err := f.walog.Sync(); err != nil {
+		return err
+	}
+	f.applied.Store(lsn)
+	f.durable.Store(lsn)
+
+	f.tokenLock.Lock()
+	f.resumeToken = resumeToken
+	f.tokenLock.Unlock()
+
+	if f.onSnapshot != nil {
+		if err := f.onSnapshot(lsn, data); err != nil {
+			return fmt.Errorf("could not restore snapshot %d: %w", lsn, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package replication
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxFrameSize bounds the size of the messages read by the TCP transport.
+const maxFrameSize = 256 << 20
+
+// ServerConn is the server end of a replication stream, as accepted by a transport.
+// Send and Recv may be called concurrently with each other.
+type ServerConn interface {
+	// Context is done when the stream ends.
+	Context() context.Context
+	Send(*StreamResponse) error
+	Recv() (*StreamRequest, error)
+}
+
+// ClientConn is the follower end of a replication stream.
+// Send and Recv may be called concurrently with each other.
+type ClientConn interface {
+	Send(*StreamRequest) error
+	// Recv returns a gRPC status error if the server ended the stream with an error.
+	Recv() (*StreamResponse, error)
+}
+
+// Transport opens replication streams to a primary. Implementations other than gRPC and TCP,
+// e.g. over WebSockets, pair it with a listener calling Server.Serve for every stream.
+type Transport interface {
+	// Open opens a stream, which is closed when ctx is done.
+	Open(ctx context.Context) (ClientConn, error)
+}
+
+// GRPCTransport returns the Transport opening streams with a gRPC client.
+func GRPCTransport(client ReplicationClient) Transport {
+	return grpcTransport{client: client}
+}
+
+type grpcTransport struct {
+	client ReplicationClient
+}
+
+func (t grpcTransport) Open(ctx context.Context) (ClientConn, error) {
+	return t.client.Stream(ctx)
+}
+
+// TCPTransport returns the Transport opening streams over plain TCP connections to addr,
+// served by Server.ServeListener. Messages are framed like the entries of a segment,
+// with their size as a little endian int32.
+func TCPTransport(addr string) Transport {
+	return tcpTransport{addr: addr}
+}
+
+type tcpTransport struct {
+	addr string
+}
+
+func (t tcpTransport) Open(ctx context.Context) (ClientConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	return &tcpClientConn{conn: conn}, nil
+}
+
+type tcpClientConn struct {
+	conn      net.Conn
+	writeLock sync.Mutex
+}
+
+func (c *tcpClientConn) Send(request *StreamRequest) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return writeFrame(c.conn, request)
+}
+
+func (c *tcpClientConn) Recv() (*StreamResponse, error) {
+	var response StreamResponse
+	if err := readFrame(c.conn, &response); err != nil {
+		return nil, err
+	}
+	if e := response.GetError(); e != nil {
+		return nil, status.Error(codes.Code(e.GetCode()), e.GetMessage())
+	}
+	return &response, nil
+}
+
+// ServeListener accepts TCP connections from followers using TCPTransport and serves a stream
+// on each of them, until the listener is closed.
+func (s *Server) ServeListener(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		go s.serveTCP(conn)
+	}
+}
+
+// serveTCP serves a stream on conn, reporting its error to the follower.
+func (s *Server) serveTCP(conn net.Conn) {
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serverConn := &tcpServerConn{ctx: ctx, cancel: cancel, conn: conn}
+
+	if err := s.Serve(serverConn); err != nil {
+		st := status.Convert(err)
+		serverConn.Send(&StreamResponse{Response: &StreamResponse_Error{
+			Error: &Error{Code: uint32(st.Code()), Message: st.Message()},
+		}})
+	}
+}
+
+type tcpServerConn struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	conn      net.Conn
+	writeLock sync.Mutex
+}
+
+func (c *tcpServerConn) Context() context.Context {
+	return c.ctx
+}
+
+func (c *tcpServerConn) Send(response *StreamResponse) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return writeFrame(c.conn, response)
+}
+
+func (c *tcpServerConn) Recv() (*StreamRequest, error) {
+	var request StreamRequest
+	if err := readFrame(c.conn, &request); err != nil {
+		// The stream ends with the connection.
+		c.cancel()
+		return nil, err
+	}
+	return &request, nil
+}
+
+func writeFrame(w io.Writer, message proto.Message) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err = w.Write(frame)
+	return err
+}
+
+func readFrame(r io.Reader, message proto.Message) error {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return err
+	}
+	if size < 0 || size > maxFrameSize {
+		return fmt.Errorf("invalid message size %d", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, message)
+}
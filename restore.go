@@ -0,0 +1,359 @@
+package wal
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRestorePointNotArchived is returned by Restore when the archive doesn't hold the entries up to
+// the requested sequence number.
+var ErrRestorePointNotArchived = errors.New("restore point is not archived")
+
+// ArchivedSegment is a segment stored by a ShipTarget.
+type ArchivedSegment struct {
+	// Name is the file name of the segment, such as "segment-3".
+	Name string
+	// Partial is set if only the tail shipped so far is stored, because the segment was still being
+	// written when it was last shipped.
+	Partial bool
+}
+
+// Archive reads the segments stored by a ShipTarget, see Restore. DirTarget implements it.
+type Archive interface {
+	// ListSegments returns the stored segments, in any order.
+	ListSegments(ctx context.Context) ([]ArchivedSegment, error)
+	// OpenSegment returns the content of a stored segment.
+	OpenSegment(ctx context.Context, segment ArchivedSegment) (io.ReadCloser, error)
+}
+
+// DataArchive is an Archive that also stores the data files of the WAL, the blobs of WithBlobThreshold
+// and the value log of WithValueLog, which Restore restores along with the segments, since the restored
+// entries may reference them. BackupArchive implements it.
+type DataArchive interface {
+	Archive
+	// ListDataFiles returns the stored data files, by their slash separated path relative to the WAL
+	// directory, such as "blobs/<hash>" or "valuelog/segment-0".
+	ListDataFiles(ctx context.Context) ([]string, error)
+	// OpenDataFile returns the content of a stored data file.
+	OpenDataFile(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// ListSegments implements Archive.
+func (t *DirTarget) ListSegments(ctx context.Context) ([]ArchivedSegment, error) {
+	files, err := filepath.Glob(filepath.Join(t.directory, segmentPrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]bool, len(files))
+	for _, file := range files {
+		stored[filepath.Base(file)] = true
+	}
+	var segments []ArchivedSegment
+	for name := range stored {
+		switch {
+		case strings.HasSuffix(name, ".tmp"):
+		case strings.HasSuffix(name, partialSuffix):
+			// The tail is removed once the complete segment is stored, but it may have been left behind.
+			if name := strings.TrimSuffix(name, partialSuffix); !stored[name] {
+				segments = append(segments, ArchivedSegment{Name: name, Partial: true})
+			}
+		default:
+			segments = append(segments, ArchivedSegment{Name: name})
+		}
+	}
+	return segments, nil
+}
+
+// OpenSegment implements Archive.
+func (t *DirTarget) OpenSegment(ctx context.Context, segment ArchivedSegment) (io.ReadCloser, error) {
+	name := segment.Name
+	if segment.Partial {
+		name += partialSuffix
+	}
+	return os.Open(filepath.Join(t.directory, name))
+}
+
+// RestorePoint selects the last entry restored by Restore.
+// The zero RestorePoint restores all of the archived entries.
+type RestorePoint struct {
+	// LogSequenceNumber, if not 0, is the sequence number of the last entry restored.
+	LogSequenceNumber uint64
+	// Time, if not zero, restores the entries up to the first one written after it, according to the
+	// application timestamp of the entries or, if they have none, their HLC (see WithHybridClock).
+	// Entries with neither are restored along with the entries before them.
+	Time time.Time
+}
+
+// after reports whether the entry is after the restore point.
+func (p RestorePoint) after(entry *WAL_Entry) bool {
+	if p.LogSequenceNumber != 0 && entry.GetLogSequenceNumber() > p.LogSequenceNumber {
+		return true
+	}
+	if p.Time.IsZero() {
+		return false
+	}
+	t := entry.Time()
+	if t.IsZero() && entry.HLC() != 0 {
+		t = entry.HLC().Physical()
+	}
+	return !t.IsZero() && t.After(p.Time)
+}
+
+// Restore reconstructs in directory the WAL archived by WithShipping, or backed up by Backup (see
+// OpenBackup), as of the given point in time or sequence number, truncating it exactly at that point, and
+// returns the sequence number of the last entry restored. The segments are read from archive in order
+// until the restore point, and the checkpoint side-file is rebuilt from the checkpoints restored, so that
+// LastCheckpoint returns the last checkpoint before the restore point. Applications that checkpoint
+// periodically can thus restore their state from the last checkpoint and replay the entries after it. The
+// directory must not hold a WAL already. The WAL is restored next to it first, and moved to it once
+// complete, so that a failed restore leaves nothing in directory and can be retried.
+// The options used are WithFS and WithCheckpointRetention.
+func Restore(ctx context.Context, archive Archive, point RestorePoint, directory string, opts ...Option) (uint64, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	segments, err := archive.ListSegments(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(segments) == 0 {
+		return 0, fmt.Errorf("%w: the archive holds no segments", ErrNotExist)
+	}
+	indexes := make(map[string]int, len(segments))
+	for _, segment := range segments {
+		index, err := strconv.Atoi(strings.TrimPrefix(segment.Name, segmentPrefix))
+		if err != nil || !strings.HasPrefix(segment.Name, segmentPrefix) {
+			return 0, fmt.Errorf("invalid archived segment name %q", segment.Name)
+		}
+		indexes[segment.Name] = index
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return indexes[segments[i].Name] < indexes[segments[j].Name]
+	})
+
+	for i := 1; i < len(segments); i++ {
+		if indexes[segments[i].Name] != indexes[segments[i-1].Name]+1 {
+			return 0, fmt.Errorf("the archive is missing segment %d", indexes[segments[i-1].Name]+1)
+		}
+	}
+
+	if err := o.fs.MkdirAll(directory, 0755); err != nil {
+		return 0, err
+	}
+	if existing, err := listSegmentFiles(o.fs, directory); err != nil {
+		return 0, err
+	} else if len(existing) > 0 {
+		return 0, fmt.Errorf("cannot restore to %s: it already holds a wal", directory)
+	}
+
+	var last uint64
+	err = stageRestore(o.fs, directory, func(staging string) error {
+		r := &restorer{fs: o.fs, directory: staging, point: point}
+		for _, segment := range segments {
+			done, err := r.restoreSegment(ctx, archive, segment)
+			if err != nil {
+				return fmt.Errorf("could not restore %s: %w", segment.Name, err)
+			}
+			if done {
+				break
+			}
+		}
+
+		if r.last == 0 {
+			return fmt.Errorf("%w: no archived entry is before the restore point", ErrRestorePointNotArchived)
+		}
+		if point.LogSequenceNumber > r.last {
+			return fmt.Errorf("%w: the last archived entry is %d, requested %d", ErrRestorePointNotArchived, r.last, point.LogSequenceNumber)
+		}
+
+		// The data files may hold the data of entries after the restore point too, CollectBlobs and
+		// CollectValueLog reclaim it.
+		if archive, ok := archive.(DataArchive); ok {
+			if err := restoreDataFiles(ctx, o.fs, archive, staging); err != nil {
+				return err
+			}
+		}
+
+		if len(r.checkpoints) > 0 {
+			checkpoints := r.checkpoints[max(0, len(r.checkpoints)-o.checkpointRetention):]
+			if _, err := writeCheckpointFile(o.fs, staging, checkpoints); err != nil {
+				return err
+			}
+		}
+		last = r.last
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return last, nil
+}
+
+// stagingSuffix names the directory a WAL is restored to before it is moved to its directory, see
+// stageRestore.
+const stagingSuffix = ".restoring"
+
+// stageRestore runs restore on a staging directory next to directory, and moves the files it wrote to
+// directory once it succeeded, so that a failed restore leaves nothing in directory, and can be retried.
+func stageRestore(fs FS, directory string, restore func(staging string) error) error {
+	staging := filepath.Clean(directory) + stagingSuffix
+	// A staging directory left by an interrupted restore is discarded.
+	if err := removeAll(fs, staging); err != nil {
+		return err
+	}
+	if err := fs.MkdirAll(staging, 0755); err != nil {
+		return err
+	}
+	if err := restore(staging); err != nil {
+		removeAll(fs, staging)
+		return err
+	}
+
+	files, err := fs.Glob(filepath.Join(staging, "*"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := fs.Rename(file, filepath.Join(directory, filepath.Base(file))); err != nil {
+			return err
+		}
+	}
+	return fs.Remove(staging)
+}
+
+// restoreDataFiles copies the data files of the archive to directory.
+func restoreDataFiles(ctx context.Context, fs FS, archive DataArchive, directory string) error {
+	names, err := archive.ListDataFiles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dir, _, _ := strings.Cut(name, "/")
+		if !filepath.IsLocal(filepath.FromSlash(name)) || (dir != blobDirName && dir != valueLogDirName) {
+			return fmt.Errorf("invalid archived data file name %q", name)
+		}
+		source, err := archive.OpenDataFile(ctx, name)
+		if err != nil {
+			return err
+		}
+		err = writeBackupFile(fs, filepath.Join(directory, filepath.FromSlash(name)), source, -1)
+		source.Close()
+		if err != nil {
+			return fmt.Errorf("could not restore %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// restorer writes the restored segments.
+type restorer struct {
+	fs          FS
+	directory   string
+	point       RestorePoint
+	last        uint64       // sequence number of the last entry restored
+	checkpoints []*WAL_Entry // checkpoints restored, oldest first
+}
+
+// restoreSegment copies the entries of the archived segment up to the restore point, and reports
+// whether the restore point was reached.
+func (r *restorer) restoreSegment(ctx context.Context, archive Archive, segment ArchivedSegment) (done bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	source, err := archive.OpenSegment(ctx, segment)
+	if err != nil {
+		return false, err
+	}
+	defer source.Close()
+
+	file, err := r.fs.Create(filepath.Join(r.directory, segment.Name))
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	reader := bufio.NewReader(source)
+	writer := bufio.NewWriter(file)
+	// The segment keeps its header, which records the checksum of its entries.
+	format, err := readSegmentHeader(reader)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// The segment is empty, or a tail whose upload was torn before its first entry.
+		return false, file.Sync()
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := writer.Write(appendSegmentHeader(nil, format)); err != nil {
+		return false, err
+	}
+	var prefix [4]byte
+	for {
+		size, err := readFrameSize(reader, &prefix)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return false, err
+		}
+		if size == 0 {
+			// The preallocated space of a segment written with WithMmap reads as zeros, it ends the data.
+			break
+		}
+		if size < 0 {
+			return false, ErrInvalidEntry
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			// A tail ends with complete entries, so an incomplete one can only be the end of a torn upload.
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return false, err
+		}
+		entry, err := unmarshalAndVerifyEntry(data, format)
+		if err != nil {
+			return false, err
+		}
+
+		if r.point.after(entry) {
+			done = true
+			break
+		}
+		binary.LittleEndian.PutUint32(prefix[:], uint32(size))
+		if _, err := writer.Write(prefix[:]); err != nil {
+			return false, err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return false, err
+		}
+		r.last = entry.GetLogSequenceNumber()
+		if entry.GetIsCheckpoint() {
+			r.checkpoints = append(r.checkpoints, entry)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return false, err
+	}
+	return done, file.Sync()
+}
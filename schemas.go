@@ -0,0 +1,85 @@
+package wal
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Upconverter converts the data of an entry from a version of its schema to the next one, see
+// RegisterUpconverter.
+type Upconverter func(data []byte) ([]byte, error)
+
+// schemaVersion is a version of a schema, the key of the up-converters.
+type schemaVersion struct {
+	schema  string
+	version uint32
+}
+
+var (
+	upconvertersLock sync.RWMutex
+	upconverters     = make(map[schemaVersion]Upconverter)
+)
+
+// WithSchema sets the identifier of the schema of the data of the entry, e.g. the name of the message
+// type it holds, and the version of the schema, so that readers can convert the entries written with
+// older versions to the latest one, see RegisterUpconverter. The identifier must be valid UTF-8, see
+// ErrInvalidUTF8.
+func WithSchema(schema string, version uint32) EntryOption {
+	return func(entry *WAL_Entry) {
+		entry.Schema = schema
+		entry.SchemaVersion = version
+	}
+}
+
+// RegisterUpconverter registers the function converting the data of the entries with the given schema
+// from version fromVersion to fromVersion+1, replacing any registered before. Like decoders, see
+// RegisterDecoder, applications usually register their up-converters in an init function, one per
+// version their schema went through, so that long-lived logs stay readable as the schema evolves.
+func RegisterUpconverter(schema string, fromVersion uint32, upconvert Upconverter) {
+	upconvertersLock.Lock()
+	defer upconvertersLock.Unlock()
+	upconverters[schemaVersion{schema, fromVersion}] = upconvert
+}
+
+// Upconvert converts the data of the entry to the latest version of its schema, applying the
+// up-converters registered from its version on, and updates its version and CRC accordingly. It reports
+// whether the entry was converted; entries without a schema, or already at the latest version, are left
+// as they are. See also WithUpconversion.
+func Upconvert(entry *WAL_Entry) (bool, error) {
+	if entry.GetSchema() == "" {
+		return false, nil
+	}
+
+	converted := false
+	for {
+		upconvertersLock.RLock()
+		upconvert, ok := upconverters[schemaVersion{entry.GetSchema(), entry.GetSchemaVersion()}]
+		upconvertersLock.RUnlock()
+		if !ok {
+			break
+		}
+
+		data, err := upconvert(entry.GetData())
+		if err != nil {
+			return converted, fmt.Errorf("could not upconvert entry %d from %s version %d: %w",
+				entry.GetLogSequenceNumber(), entry.GetSchema(), entry.GetSchemaVersion(), err)
+		}
+		entry.Data = data
+		entry.SchemaVersion++
+		converted = true
+	}
+	if converted {
+		entry.CRC = computeCRC(entry)
+	}
+	return converted, nil
+}
+
+// upconvertEntries upconverts the entries, see Upconvert.
+func upconvertEntries(entries []*WAL_Entry) error {
+	for _, entry := range entries {
+		if _, err := Upconvert(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
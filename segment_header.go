@@ -0,0 +1,122 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Segments start with a header recording the format of their entries: segmentMagic, the version of the
+// header, the Checksum and the Encoding of the entries as a byte each, and a reserved byte, which is zero.
+// Segments written before headers existed start with their first frame instead. The magic reads as a
+// negative frame size, so those versions reject segments with a header instead of misreading them.
+const (
+	segmentHeaderSize    = 8
+	segmentHeaderVersion = 1
+)
+
+var segmentMagic = [4]byte{'W', 'A', 'L', 0x89}
+
+// segmentFormat is the format of the entries of a segment, as recorded in its header.
+type segmentFormat struct {
+	version  byte     // version of the header, 0 if the segment has none
+	checksum Checksum // CRC algorithm of the entries
+	encoding Encoding // encoding of the entries, see appendEncodedFrame
+}
+
+// headerlessFormat is the format of the files without a header: the segments written before headers
+// existed, whose entries are checksummed with ChecksumIEEE, and the side-files, whose entries record
+// their checksum themselves. Their records identify their encoding themselves, see decodeEntry.
+var headerlessFormat segmentFormat
+
+// headerSize returns the size of the header of the segments of the format.
+func (f segmentFormat) headerSize() int64 {
+	if f.version == 0 {
+		return 0
+	}
+	return segmentHeaderSize
+}
+
+// appendSegmentHeader appends the header of a segment of the given format to b.
+func appendSegmentHeader(b []byte, format segmentFormat) []byte {
+	if format.version == 0 {
+		return b
+	}
+	b = append(b, segmentMagic[:]...)
+	return append(b, format.version, byte(format.checksum), byte(format.encoding), 0)
+}
+
+// parseSegmentHeader returns the format recorded in the header at the start of data, the first bytes
+// of a segment. It returns io.EOF if data is empty and io.ErrUnexpectedEOF if it ends within the header,
+// as the header of a segment that was just created may not have been written yet.
+func parseSegmentHeader(data []byte) (segmentFormat, error) {
+	if len(data) == 0 {
+		return headerlessFormat, io.EOF
+	}
+	if !bytes.HasPrefix(data, segmentMagic[:min(len(data), len(segmentMagic))]) {
+		return headerlessFormat, nil
+	}
+	if len(data) < segmentHeaderSize {
+		return headerlessFormat, io.ErrUnexpectedEOF
+	}
+
+	format := segmentFormat{version: data[4], checksum: Checksum(data[5]), encoding: Encoding(data[6])}
+	if format.version != segmentHeaderVersion {
+		return headerlessFormat, fmt.Errorf("%w: unsupported segment header version %d", ErrInvalidEntry, format.version)
+	}
+	if format.checksum > ChecksumCastagnoli {
+		return headerlessFormat, fmt.Errorf("%w: unknown checksum %d in the segment header", ErrInvalidEntry, format.checksum)
+	}
+	if format.encoding > EncodingCapnProto {
+		return headerlessFormat, fmt.Errorf("%w: unknown encoding %d in the segment header", ErrInvalidEntry, format.encoding)
+	}
+	return format, nil
+}
+
+// readSegmentHeader reads the header of the segment read by r, if it has one, and returns its format,
+// like parseSegmentHeader. The frames of the entries follow.
+func readSegmentHeader(r *bufio.Reader) (segmentFormat, error) {
+	header, err := r.Peek(segmentHeaderSize)
+	if err != nil && err != io.EOF {
+		return headerlessFormat, err
+	}
+	format, err := parseSegmentHeader(header)
+	if err != nil {
+		return headerlessFormat, err
+	}
+	_, err = r.Discard(int(format.headerSize()))
+	return format, err
+}
+
+// readSegmentFormat returns the format of the segment file at path, like parseSegmentHeader.
+func readSegmentFormat(fs FS, path string) (segmentFormat, error) {
+	file, err := fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return headerlessFormat, err
+	}
+	defer file.Close()
+
+	var header [segmentHeaderSize]byte
+	n, err := io.ReadFull(file, header[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return headerlessFormat, err
+	}
+	return parseSegmentHeader(header[:n])
+}
+
+// startSegment writes the header of the current segment, which is empty, with the format of the
+// segments created. The caller must hold wal.lock.
+func (wal *WAL) startSegment() error {
+	wal.segmentFormat = wal.format
+	if wal.format.version == 0 {
+		return nil
+	}
+	var header [segmentHeaderSize]byte
+	if _, err := wal.bufWriter.Write(appendSegmentHeader(header[:0], wal.format)); err != nil {
+		return err
+	}
+	wal.stats.BytesWritten += segmentHeaderSize
+	return nil
+}
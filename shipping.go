@@ -0,0 +1,389 @@
+package wal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// shippingFileName is the side-file recording how much of the log was shipped, see WithShipping.
+const shippingFileName = "shipping"
+
+// maxShippingBackoff caps the delay between retries of a failing shipping target.
+const maxShippingBackoff = 5 * time.Minute
+
+// ShipTarget receives the segments shipped by WithShipping, e.g. a bucket or a mounted volume in
+// another region. Segments are identified by their file name, such as "segment-3".
+type ShipTarget interface {
+	// PutSegment stores the complete content of a sealed segment, replacing the tail stored for it, if any.
+	PutSegment(ctx context.Context, name string, r io.Reader) error
+	// PutTail stores the bytes of the segment being written from offset on. The bytes before offset
+	// were stored by the previous calls for the segment; r holds only complete entries.
+	PutTail(ctx context.Context, name string, offset int64, r io.Reader) error
+}
+
+// ShippingStats report the progress of the shipping set with WithShipping.
+type ShippingStats struct {
+	// ShippedSequenceNumber is the sequence number of the last entry stored by the target.
+	ShippedSequenceNumber uint64 `json:"shipped_sequence_number"`
+	// LagEntries is the number of entries written after ShippedSequenceNumber.
+	LagEntries uint64 `json:"lag_entries"`
+	// LagBytes is the number of bytes written to the log, including the buffer, not stored by the target.
+	LagBytes int64 `json:"lag_bytes"`
+	// Lag is how long the target has been missing entries: an upper bound of the age of the oldest
+	// entry not stored by the target, with the precision of the shipping interval, or 0 if none is missing.
+	Lag time.Duration `json:"lag"`
+	// LastShipTime is when entries were last stored by the target.
+	LastShipTime time.Time `json:"last_ship_time"`
+	// Failures is the number of failed shipping attempts since the WAL was opened.
+	Failures uint64 `json:"failures"`
+	// LastError is the error of the last attempt, if it failed.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// shippingPosition is the position in the log up to which the segments were shipped.
+type shippingPosition struct {
+	// Segment is the index of the segment being shipped, or -1 if nothing was shipped yet.
+	Segment int `json:"segment"`
+	// Offset is the number of bytes of the segment shipped.
+	Offset int64 `json:"offset"`
+	// LogSequenceNumber is the sequence number of the last entry shipped.
+	LogSequenceNumber uint64 `json:"log_sequence_number"`
+}
+
+// shippingMark records the last sequence number of the log at the start of a shipping run, so that
+// the age of the entries not shipped yet can be estimated.
+type shippingMark struct {
+	lsn  uint64
+	time time.Time
+}
+
+type shipper struct {
+	target   ShipTarget
+	interval time.Duration
+	// tail reads the entries as they are flushed, and only ever runs ahead of shipped.
+	tail *Tail
+
+	lock        sync.Mutex // guards the fields below, which are read by Stats
+	shipped     shippingPosition
+	marks       []shippingMark // the last mark not after shipped, then the marks after it
+	lastShipped time.Time
+	failures    uint64
+	lastErr     error
+}
+
+// DirTarget is a ShipTarget storing the segments in a directory, e.g. a volume mounted from another region.
+// Tails are stored as files with the ".partial" suffix until their segment is sealed.
+type DirTarget struct {
+	directory string
+}
+
+// NewDirTarget returns a DirTarget storing the segments in directory, which is created if needed.
+func NewDirTarget(directory string) (*DirTarget, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+	return &DirTarget{directory: directory}, nil
+}
+
+// PutSegment implements ShipTarget.
+func (t *DirTarget) PutSegment(ctx context.Context, name string, r io.Reader) error {
+	filePath := filepath.Join(t.directory, name)
+	tempFilePath := fmt.Sprintf("%s.tmp", filePath)
+
+	if err := writeFileSynced(tempFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0, r); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFilePath, filePath); err != nil {
+		return err
+	}
+	if err := os.Remove(filePath + ".partial"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// PutTail implements ShipTarget.
+func (t *DirTarget) PutTail(ctx context.Context, name string, offset int64, r io.Reader) error {
+	filePath := filepath.Join(t.directory, name+".partial")
+	if offset > 0 {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return err
+		}
+		if info.Size() < offset {
+			return fmt.Errorf("%s has %d bytes, expected at least %d", filePath, info.Size(), offset)
+		}
+	}
+	return writeFileSynced(filePath, os.O_CREATE|os.O_WRONLY, offset, r)
+}
+
+// writeFileSynced writes r to the file at path from offset on, truncating what follows, and syncs it.
+func writeFileSynced(path string, flag int, offset int64, r io.Reader) error {
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func loadShippingPosition(fs FS, directory string) (shippingPosition, error) {
+	position := shippingPosition{Segment: -1}
+	file, err := fs.OpenFile(filepath.Join(directory, shippingFileName), os.O_RDONLY, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return position, nil
+		}
+		return position, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&position); err != nil {
+		return position, fmt.Errorf("could not read shipping file: %v", err)
+	}
+	return position, nil
+}
+
+// saveShippingPosition atomically replaces the shipping side-file.
+func saveShippingPosition(fs FS, directory string, position shippingPosition) error {
+	filePath := filepath.Join(directory, shippingFileName)
+	tempFilePath := fmt.Sprintf("%s.tmp", filePath)
+
+	tempFile, err := fs.OpenFile(tempFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(tempFile).Encode(position); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return fs.Rename(tempFilePath, filePath)
+}
+
+// newShipper returns a shipper resuming from the position recorded in the shipping side-file.
+func newShipper(fs FS, clock Clock, directory string, target ShipTarget, interval time.Duration) (*shipper, error) {
+	shipped, err := loadShippingPosition(fs, directory)
+	if err != nil {
+		return nil, err
+	}
+	var fromLSN uint64
+	if shipped.LogSequenceNumber > 0 {
+		fromLSN = shipped.LogSequenceNumber + 1
+	}
+	tail, err := NewTail(directory, fromLSN, WithFS(fs), WithClock(clock))
+	if errors.Is(err, ErrEntriesDeleted) {
+		// The entries were deleted by retention before they could be shipped: ship what is left.
+		tail, err = NewTail(directory, 0, WithFS(fs), WithClock(clock))
+		shipped = shippingPosition{Segment: -1}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The entries not shipped yet were written before the WAL was opened, at the latest.
+	marks := []shippingMark{{lsn: shipped.LogSequenceNumber, time: clock.Now()}}
+	return &shipper{target: target, interval: interval, tail: tail, shipped: shipped, marks: marks}, nil
+}
+
+// keepShipping ships the log every interval until the WAL is closed, backing off while the target fails.
+func (wal *WAL) keepShipping(s *shipper, timer Timer) {
+	defer timer.Stop()
+	defer s.tail.Stop()
+
+	var failures int
+	for {
+		select {
+		case <-wal.ctx.Done():
+			return
+		case <-timer.C():
+			delay := s.interval
+			if err := wal.ship(s); err != nil {
+				failures++
+				delay = min(s.interval<<min(failures, 16), maxShippingBackoff)
+				wal.logEvent(slog.LevelWarn, EventShippingFailed,
+					slog.String("error", err.Error()),
+					slog.Duration("retry_in", delay))
+			} else {
+				failures = 0
+			}
+			timer.Reset(delay)
+		}
+	}
+}
+
+// ship stores the entries flushed since the last call in the target.
+func (wal *WAL) ship(s *shipper) (err error) {
+	wal.lock.Lock()
+	mark := shippingMark{lsn: wal.lastSequenceNo, time: wal.clock.Now()}
+	wal.lock.Unlock()
+
+	s.lock.Lock()
+	if mark.lsn > s.marks[len(s.marks)-1].lsn {
+		s.marks = append(s.marks, mark)
+	}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.lastErr = err
+		if err != nil {
+			s.failures++
+		}
+		// Only the last mark not after the shipped position is needed to estimate the lag.
+		for len(s.marks) > 1 && s.marks[1].lsn <= s.shipped.LogSequenceNumber {
+			s.marks = s.marks[1:]
+		}
+	}()
+
+	err = s.tail.Read(func(*WAL_Entry) error { return nil })
+	if errors.Is(err, ErrEntriesDeleted) {
+		// The entries were deleted by retention before they could be shipped: ship what is left.
+		s.tail.Stop()
+		if s.tail, err = NewTail(wal.directory, 0, WithFS(wal.fs), WithClock(wal.clock)); err != nil {
+			return err
+		}
+		s.lock.Lock()
+		s.shipped = shippingPosition{Segment: -1}
+		s.lock.Unlock()
+		err = s.tail.Read(func(*WAL_Entry) error { return nil })
+	}
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	from := s.shipped
+	s.lock.Unlock()
+	to := shippingPosition{Segment: s.tail.segment, Offset: s.tail.offset, LogSequenceNumber: s.tail.lastLSN}
+	if to.Segment < 0 || (to.Segment == from.Segment && to.Offset <= from.Offset) {
+		return nil
+	}
+
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if segment.index < from.Segment || segment.index > to.Segment {
+			continue
+		}
+		var offset int64
+		if segment.index == from.Segment {
+			offset = from.Offset
+		}
+		if err := wal.shipSegment(s, segment, offset, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shipSegment stores the segment in the target, in full if it is sealed, i.e. before the segment of to,
+// and up to the offset of to otherwise, and records the progress.
+func (wal *WAL) shipSegment(s *shipper, segment segmentFile, offset int64, to shippingPosition) error {
+	name := filepath.Base(segment.path)
+	file, err := wal.fs.OpenFile(segment.path, os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s.lock.Lock()
+	progress := s.shipped
+	s.lock.Unlock()
+	if segment.index < to.Segment {
+		if err := s.target.PutSegment(wal.ctx, name, file); err != nil {
+			return fmt.Errorf("could not ship %s: %w", name, err)
+		}
+		wal.dropCache(segment.path)
+		// The sequence number is only known at the position of the tail.
+		progress.Segment = segment.index + 1
+		progress.Offset = 0
+	} else {
+		if to.Offset > offset {
+			if _, err := file.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+			if err := s.target.PutTail(wal.ctx, name, offset, io.LimitReader(file, to.Offset-offset)); err != nil {
+				return fmt.Errorf("could not ship %s: %w", name, err)
+			}
+		}
+		progress = to
+	}
+
+	if err := saveShippingPosition(wal.fs, wal.directory, progress); err != nil {
+		return fmt.Errorf("could not save shipping file: %w", err)
+	}
+	s.lock.Lock()
+	s.shipped = progress
+	s.lastShipped = wal.clock.Now()
+	s.lock.Unlock()
+	return nil
+}
+
+// shippingStats returns the ShippingStats of the WAL.
+// The caller must hold wal.lock.
+func (wal *WAL) shippingStats() *ShippingStats {
+	s := wal.shipper
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := &ShippingStats{
+		ShippedSequenceNumber: s.shipped.LogSequenceNumber,
+		LastShipTime:          s.lastShipped,
+		Failures:              s.failures,
+		LagBytes:              int64(wal.bufWriter.Buffered()),
+	}
+	if s.lastErr != nil {
+		stats.LastError = s.lastErr.Error()
+	}
+	if wal.lastSequenceNo > s.shipped.LogSequenceNumber {
+		stats.LagEntries = wal.lastSequenceNo - s.shipped.LogSequenceNumber
+		// The oldest entry not shipped was written after the first mark.
+		stats.Lag = wal.clock.Now().Sub(s.marks[0].time)
+	}
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return stats
+	}
+	for _, segment := range segments {
+		if segment.index < s.shipped.Segment {
+			continue
+		}
+		if info, err := wal.fs.Stat(segment.path); err == nil {
+			stats.LagBytes += info.Size()
+			if segment.index == s.shipped.Segment {
+				stats.LagBytes -= s.shipped.Offset
+			}
+		}
+	}
+	return stats
+}
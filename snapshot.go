@@ -0,0 +1,263 @@
+package wal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// snapshotDirName is the directory, inside the WAL directory, holding the snapshots of a SnapshotStore.
+const snapshotDirName = "snapshots"
+
+// snapshotPrefix is the prefix of the snapshot files, followed by the sequence number they cover.
+const snapshotPrefix = "snapshot-"
+
+// ErrNoSnapshot is returned by SnapshotStore.Latest when no snapshot has been saved.
+var ErrNoSnapshot = errors.New("no snapshot found")
+
+// Snapshot is a state of the application saved in a SnapshotStore.
+type Snapshot struct {
+	// LogSequenceNumber is the sequence number of the last entry the state includes.
+	LogSequenceNumber uint64
+	// State is the state of the application, as passed to Save.
+	State []byte
+}
+
+// SnapshotStore persists snapshots of the application state next to the log, so that recovery loads
+// the latest snapshot and only replays the entries written after it, see Load. A WAL should only have
+// one SnapshotStore.
+//
+// Every snapshot is stored in its own file, written to a temporary file, synced and renamed, so a crash
+// never leaves a partial snapshot. It is then recorded in the log by a checkpoint entry, whose data is
+// the name of the snapshot file.
+type SnapshotStore struct {
+	wal       *WAL
+	directory string
+	retention int
+	lock      sync.Mutex // serializes Save
+}
+
+// SnapshotOption configures a SnapshotStore.
+type SnapshotOption func(*SnapshotStore)
+
+// WithSnapshotRetention sets the number of snapshots kept, the latest ones, so that Latest can fall
+// back to an older snapshot when the newest one is unreadable. The default is 2.
+func WithSnapshotRetention(n int) SnapshotOption {
+	return func(s *SnapshotStore) {
+		s.retention = max(n, 1)
+	}
+}
+
+// NewSnapshotStore returns the SnapshotStore of the WAL. Its snapshots are stored in the snapshots
+// directory of the WAL directory.
+func NewSnapshotStore(wal *WAL, opts ...SnapshotOption) *SnapshotStore {
+	s := &SnapshotStore{wal: wal, directory: filepath.Join(wal.directory, snapshotDirName), retention: 2}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Save persists state as the snapshot of the entries up to and including logSequenceNumber, then
+// writes a checkpoint entry recording it. The state can be taken without pausing writes: the entries
+// written after logSequenceNumber, before the checkpoint or after it, are replayed by Load.
+// Snapshots beyond the retention limit are deleted once the checkpoint is durable.
+func (s *SnapshotStore) Save(logSequenceNumber uint64, state []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.wal.lock.Lock()
+	last := s.wal.lastSequenceNo
+	s.wal.lock.Unlock()
+	if logSequenceNumber > last {
+		return fmt.Errorf("snapshot sequence number %d is beyond the last sequence number %d", logSequenceNumber, last)
+	}
+	names, err := s.list()
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 && logSequenceNumber < names[len(names)-1].lsn {
+		return fmt.Errorf("%w: snapshot sequence number %d < %d", ErrSequenceNumberTooLow,
+			logSequenceNumber, names[len(names)-1].lsn)
+	}
+
+	if err := s.wal.fs.MkdirAll(s.directory, 0755); err != nil {
+		return err
+	}
+	name := snapshotFileName(logSequenceNumber)
+	written, err := s.writeSnapshotFile(name, &WAL_Entry{LogSequenceNumber: logSequenceNumber, Data: state})
+	s.wal.lock.Lock()
+	s.wal.stats.PhysicalBytesWritten += uint64(written)
+	s.wal.lock.Unlock()
+	if err != nil {
+		return fmt.Errorf("could not save snapshot: %w", err)
+	}
+
+	// The checkpoint is only written once the snapshot is durable, so it never refers to a missing file.
+	if _, err := s.wal.AppendEntry([]byte(name), WithCheckpoint()); err != nil {
+		return err
+	}
+	s.wal.logEvent(slog.LevelInfo, EventSnapshotSaved,
+		slog.Uint64("log_sequence_number", logSequenceNumber),
+		slog.Int("size", len(state)))
+
+	names = append(names, snapshotName{name: name, lsn: logSequenceNumber})
+	for _, old := range names[:max(len(names)-s.retention, 0)] {
+		if old.lsn == logSequenceNumber {
+			continue
+		}
+		if err := s.wal.fs.Remove(filepath.Join(s.directory, old.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSnapshotFile atomically writes the entry holding a snapshot to the named file, and returns the
+// number of bytes written. The file is a single frame, like those of the segments, so it is checksummed.
+func (s *SnapshotStore) writeSnapshotFile(name string, entry *WAL_Entry) (int64, error) {
+	path := filepath.Join(s.directory, name)
+	tempPath := path + ".tmp"
+
+	entry.Checksum = uint32(s.wal.format.checksum)
+	entry.CRC = computeCRC(entry)
+	frame := appendFrame(nil, entry)
+
+	file, err := s.wal.fs.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := file.Write(frame); err != nil {
+		file.Close()
+		return 0, err
+	}
+	// The snapshot must be durable before it is renamed into place.
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return int64(len(frame)), err
+	}
+	if err := file.Close(); err != nil {
+		return int64(len(frame)), err
+	}
+	return int64(len(frame)), s.wal.fs.Rename(tempPath, path)
+}
+
+// Latest returns the latest readable snapshot. A snapshot whose file is corrupted is skipped, in favor
+// of the previous one, and an error is returned if none is readable. If no snapshot has been saved,
+// it returns ErrNoSnapshot.
+func (s *SnapshotStore) Latest() (*Snapshot, error) {
+	names, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for i := len(names) - 1; i >= 0; i-- {
+		snapshot, err := s.read(names[i])
+		if err == nil {
+			return snapshot, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", names[i].name, err))
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("no readable snapshot: %w", errors.Join(errs...))
+	}
+	return nil, ErrNoSnapshot
+}
+
+// Load returns the latest snapshot, see Latest, and the entries written after it, which are to be
+// replayed on top of its state. They include the checkpoint entries recording snapshots. If no snapshot
+// has been saved, the snapshot is nil and every entry of the log is returned.
+func (s *SnapshotStore) Load() (*Snapshot, []*WAL_Entry, error) {
+	snapshot, err := s.Latest()
+	if err != nil && !errors.Is(err, ErrNoSnapshot) {
+		return nil, nil, err
+	}
+
+	// Entries are read from the segment files.
+	if err := s.wal.Flush(); err != nil {
+		return nil, nil, err
+	}
+	var from uint64
+	if snapshot != nil {
+		from = snapshot.LogSequenceNumber + 1
+	}
+	tail, err := s.wal.Tail(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tail.Stop()
+
+	var entries []*WAL_Entry
+	err = tail.Read(func(entry *WAL_Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, entries, nil
+}
+
+// snapshotName is a snapshot file and the sequence number it covers.
+type snapshotName struct {
+	name string
+	lsn  uint64
+}
+
+// snapshotFileName returns the name of the file of the snapshot covering the given sequence number.
+// The number is zero-padded, so that the files sort in order.
+func snapshotFileName(lsn uint64) string {
+	return fmt.Sprintf("%s%020d", snapshotPrefix, lsn)
+}
+
+// list returns the snapshot files, oldest first.
+func (s *SnapshotStore) list() ([]snapshotName, error) {
+	return listSnapshots(s.wal.fs, s.directory)
+}
+
+// listSnapshots returns the snapshot files in directory, oldest first.
+func listSnapshots(fs FS, directory string) ([]snapshotName, error) {
+	files, err := fs.Glob(filepath.Join(directory, snapshotPrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []snapshotName
+	for _, file := range files {
+		name := filepath.Base(file)
+		lsn, err := strconv.ParseUint(strings.TrimPrefix(name, snapshotPrefix), 10, 64)
+		if err != nil {
+			// e.g. the temporary file of a snapshot that was being saved
+			continue
+		}
+		names = append(names, snapshotName{name: name, lsn: lsn})
+	}
+	slices.SortFunc(names, func(a, b snapshotName) int { return cmp.Compare(a.lsn, b.lsn) })
+	return names, nil
+}
+
+// read reads and verifies a snapshot file.
+func (s *SnapshotStore) read(name snapshotName) (*Snapshot, error) {
+	file, err := s.wal.fs.OpenFile(filepath.Join(s.directory, name.name), os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries, _, err := readAllEntriesFromFile(file, headerlessFormat, false, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 || entries[0].GetLogSequenceNumber() != name.lsn {
+		return nil, errors.New("snapshot file doesn't hold the snapshot of its sequence number")
+	}
+	return &Snapshot{LogSequenceNumber: name.lsn, State: entries[0].GetData()}, nil
+}
@@ -0,0 +1,270 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Names of the spare segment prepared in advance, see WithPreallocate, and of the segment kept to prepare
+// the next one from, see WithRecycleSegments. They don't match segmentPrefix+"*", so they are not taken
+// for segments of the log.
+const (
+	spareSegmentFileName    = "segment.spare"
+	recycledSegmentFileName = "segment.recycled"
+)
+
+// spareChunkSize is the size of the writes filling a spare segment with zeros.
+const spareChunkSize = 1 << 20
+
+// DurabilityProfile is a preset of the options trading disk space and background I/O for the latency
+// of syncs, see WithDurabilityProfile.
+type DurabilityProfile string
+
+const (
+	// DurabilityDefault leaves the options as they are.
+	DurabilityDefault DurabilityProfile = "default"
+	// DurabilityLowLatency combines WithPreallocate, WithRecycleSegments and WithDataSync, so that the
+	// appends to a segment overwrite blocks that are already allocated and written, without changing the
+	// size of the file, and fdatasync has no metadata to commit with them on filesystems such as ext4
+	// and XFS: a sync costs a single data write.
+	DurabilityLowLatency DurabilityProfile = "low-latency"
+)
+
+// apply sets the options of the profile.
+func (p DurabilityProfile) apply(o *options) error {
+	switch p {
+	case "", DurabilityDefault:
+	case DurabilityLowLatency:
+		o.preallocate = true
+		o.recycleSegments = true
+		o.dataSync = true
+	default:
+		return fmt.Errorf("unknown durability profile %q", p)
+	}
+	return nil
+}
+
+// sizedFileInfo reports the size of the data of a segment file rather than the size of the file, which
+// is larger while it is preallocated.
+type sizedFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i sizedFileInfo) Size() int64 {
+	return i.size
+}
+
+// preallocatedFile is a segment started from a spare segment, see WithPreallocate. The file is filled with
+// zeros up to the maximum segment size, which readers take as the end of the segment, and appends
+// overwrite them instead of growing the file. Stat reports the size of the data written, and Close
+// truncates the zeros past it, if the file supports it.
+type preallocatedFile struct {
+	File
+	size atomic.Int64 // end of the data written, updated by writes, which may run concurrently with Stat
+}
+
+func (f *preallocatedFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.size.Add(int64(n))
+	return n, err
+}
+
+func (f *preallocatedFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return sizedFileInfo{FileInfo: info, size: f.size.Load()}, nil
+}
+
+// DataSync implements DataSyncFile.
+func (f *preallocatedFile) DataSync() error {
+	return datasync(f.File)
+}
+
+// Writeback implements WritebackFile.
+func (f *preallocatedFile) Writeback(offset, length int64) error {
+	return writeback(f.File, offset, length)
+}
+
+func (f *preallocatedFile) Close() error {
+	if file, ok := f.File.(interface{ Truncate(int64) error }); ok {
+		if err := file.Truncate(f.size.Load()); err != nil {
+			f.File.Close()
+			return err
+		}
+	}
+	return f.File.Close()
+}
+
+// initSpare picks up the spare and recycled segments left by the last run, and removes those that aren't
+// used anymore. A spare left half-filled by a crash is prepared again.
+// The caller must hold wal.lock.
+func (wal *WAL) initSpare() (err error) {
+	if err := wal.fs.Remove(wal.sparePath() + ".tmp"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if wal.spareReady, err = wal.keepIfUsed(wal.sparePath(), wal.preallocate); err != nil {
+		return err
+	}
+	wal.hasRecycled, err = wal.keepIfUsed(wal.recycledPath(), wal.recycleSegments)
+	return err
+}
+
+// keepIfUsed reports whether the file at path exists and is used, removing it if it isn't.
+func (wal *WAL) keepIfUsed(path string, used bool) (bool, error) {
+	if _, err := wal.fs.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if used {
+		return true, nil
+	}
+	return false, wal.fs.Remove(path)
+}
+
+func (wal *WAL) sparePath() string {
+	return filepath.Join(wal.directory, spareSegmentFileName)
+}
+
+func (wal *WAL) recycledPath() string {
+	return filepath.Join(wal.directory, recycledSegmentFileName)
+}
+
+// signalSpare wakes up keepSpare, once the spare segment was used or a segment was recycled.
+func (wal *WAL) signalSpare() {
+	select {
+	case wal.spareSignal <- struct{}{}:
+	default:
+	}
+}
+
+// keepSpare prepares a spare segment whenever there is none, until the WAL is closed.
+func (wal *WAL) keepSpare() {
+	defer close(wal.spareDone)
+
+	for {
+		if err := wal.prepareSpare(wal.ctx); err != nil && wal.ctx.Err() == nil {
+			log.Printf("Error while preparing the spare segment: %v", err)
+		}
+		select {
+		case <-wal.spareSignal:
+		case <-wal.ctx.Done():
+			return
+		}
+	}
+}
+
+// prepareSpare fills a file with zeros up to the maximum segment size, and makes it the spare segment once
+// it is synced. The recycled segment is reused if there is one: its blocks are overwritten in place
+// rather than allocated anew.
+func (wal *WAL) prepareSpare(ctx context.Context) error {
+	tempPath := wal.sparePath() + ".tmp"
+	wal.lock.Lock()
+	if wal.spareReady {
+		wal.lock.Unlock()
+		return nil
+	}
+	size := wal.maxFileSize
+	flag := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	recycled := wal.hasRecycled
+	if recycled {
+		if err := wal.fs.Rename(wal.recycledPath(), tempPath); err != nil {
+			wal.lock.Unlock()
+			return err
+		}
+		wal.hasRecycled = false
+		flag = os.O_WRONLY
+	}
+	wal.lock.Unlock()
+
+	file, err := wal.fs.OpenFile(tempPath, flag, 0644)
+	if err != nil {
+		return err
+	}
+	// Every stale byte of a recycled segment is overwritten, it could be taken for entries otherwise.
+	if info, err := file.Stat(); err == nil {
+		size = max(size, info.Size())
+	}
+	if err := fillZeros(ctx, file, size); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	if err := wal.fs.Rename(tempPath, wal.sparePath()); err != nil {
+		return err
+	}
+	wal.spareReady = true
+	if recycled {
+		wal.stats.RecycledSegments++
+	}
+	return nil
+}
+
+// fillZeros writes size zero bytes to w, unless ctx is done first.
+func fillZeros(ctx context.Context, w io.Writer, size int64) error {
+	zeros := make([]byte, spareChunkSize)
+	for size > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := w.Write(zeros[:min(size, int64(len(zeros)))])
+		if err != nil {
+			return err
+		}
+		size -= int64(n)
+	}
+	return nil
+}
+
+// createSegment creates the file of the current segment, from the spare segment if one is ready.
+// The caller must hold wal.lock.
+func (wal *WAL) createSegment() (File, error) {
+	if !wal.spareReady {
+		file, err := createSegmentFile(wal.fs, wal.directory, wal.currentSegmentIndex)
+		if err != nil {
+			return nil, err
+		}
+		if wal.preallocate {
+			// The spare segment isn't ready, e.g. it failed to be prepared: try again for the next one.
+			wal.signalSpare()
+		}
+		return wal.mapSegment(file, 0)
+	}
+
+	path := filepath.Join(wal.directory, fmt.Sprintf("%s%d", segmentPrefix, wal.currentSegmentIndex))
+	if err := wal.fs.Rename(wal.sparePath(), path); err != nil {
+		return nil, err
+	}
+	wal.spareReady = false
+	wal.signalSpare()
+	wal.stats.PreallocatedSegments++
+
+	file, err := wal.fs.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	mapped, err := wal.mapSegment(file, 0)
+	if err != nil || mapped != file {
+		return mapped, err
+	}
+	return &preallocatedFile{File: file}, nil
+}
@@ -0,0 +1,226 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// partialSuffix is the suffix of the segment tails stored by a DirTarget, see WithShipping.
+const partialSuffix = ".partial"
+
+// ErrPromoted is returned by a Standby once it has been promoted.
+var ErrPromoted = errors.New("standby was promoted")
+
+// Standby follows a WAL directory written by another process, read-only, so that a warm standby can
+// take over writing it: for instance the directory of a primary on shared storage, or the directory
+// of a DirTarget its segments are shipped to (see WithShipping). It rescans the directory for new
+// entries every sync interval, and Promote opens it as a writable WAL without re-replicating it.
+type Standby struct {
+	directory string
+	opts      []Option
+	tail      *Tail
+
+	lock           sync.Mutex
+	lastSequenceNo uint64
+	err            error // error of the last scan, nil if it succeeded
+	promoted       bool
+	closed         bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// OpenStandby opens the existing WAL in directory read-only and follows the entries appended to it.
+// Nothing is written to the directory until the Standby is promoted. If the directory doesn't exist,
+// it returns ErrNotExist. The options are used by Promote to open the WAL; while following, only WithFS,
+// WithClock and WithSyncInterval, which sets how often the directory is rescanned, are used.
+func OpenStandby(directory string, opts ...Option) (*Standby, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if _, err := o.fs.Stat(directory); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: directory %s not found", ErrNotExist, directory)
+		}
+		return nil, err
+	}
+
+	// The first scan starts at the newest segment, as the entries of the older ones aren't needed.
+	tail, err := NewTail(directory, math.MaxUint64, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Standby{directory: directory, opts: opts, tail: tail, done: make(chan struct{})}
+	if err := s.scan(); err != nil {
+		tail.Stop()
+		return nil, err
+	}
+	if s.lastSequenceNo == 0 {
+		// The newest segment is empty after a rotation, so the last entry is in an older segment.
+		if s.lastSequenceNo, err = lastSequenceNumberBefore(o.fs, directory, tail.segment); err != nil {
+			tail.Stop()
+			return nil, err
+		}
+	}
+	tail.fromLSN = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.keepScanning(ctx)
+	return s, nil
+}
+
+// LastSequenceNumber returns the sequence number of the last entry found in the directory.
+func (s *Standby) LastSequenceNumber() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.lastSequenceNo
+}
+
+// Err returns the error of the last scan of the directory, or nil if it succeeded.
+// Failed scans are retried every sync interval.
+func (s *Standby) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.err
+}
+
+// Tail returns a Tail reading the entries of the directory with a sequence number of at least fromLSN,
+// for instance to keep the state of the application up to date while it is on standby.
+func (s *Standby) Tail(fromLSN uint64) (*Tail, error) {
+	return NewTail(s.directory, fromLSN, s.opts...)
+}
+
+// Promote stops following the directory and opens it as a writable WAL, with the options the Standby
+// was opened with, as OpenWAL in MustExist mode would. Segment tails stored by a DirTarget are
+// adopted as segments first. If the WAL can't be opened, e.g. because the primary still holds its
+// lease (see WithLease), the Standby keeps following the directory and Promote can be retried.
+func (s *Standby) Promote(enableFsync bool, maxFileSize int64, maxSegments int) (*WAL, error) {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil, ErrClosed
+	}
+	if s.promoted {
+		s.lock.Unlock()
+		return nil, ErrPromoted
+	}
+
+	o := defaultOptions()
+	for _, opt := range s.opts {
+		opt(&o)
+	}
+	if err := adoptPartialSegments(o.fs, s.directory); err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	opts := append(s.opts[:len(s.opts):len(s.opts)], WithOpenMode(MustExist))
+	walog, err := OpenWAL(s.directory, enableFsync, maxFileSize, maxSegments, opts...)
+	if err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	s.promoted = true
+	s.lock.Unlock()
+
+	s.stop()
+	return walog, nil
+}
+
+// Close stops following the directory.
+func (s *Standby) Close() error {
+	s.lock.Lock()
+	if s.closed || s.promoted {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.lock.Unlock()
+
+	s.stop()
+	return nil
+}
+
+// stop stops the scanning goroutine and waits for it to return.
+func (s *Standby) stop() {
+	s.cancel()
+	<-s.done
+	s.tail.Stop()
+}
+
+// keepScanning rescans the directory every sync interval until ctx is done.
+func (s *Standby) keepScanning(ctx context.Context) {
+	defer close(s.done)
+	for {
+		if err := s.tail.Wait(ctx); err != nil {
+			return
+		}
+
+		s.lock.Lock()
+		if !s.promoted && !s.closed {
+			s.err = s.scan()
+		}
+		s.lock.Unlock()
+	}
+}
+
+// scan reads the entries appended to the directory since the previous scan.
+// The caller must hold s.lock, except in OpenStandby.
+func (s *Standby) scan() error {
+	err := s.tail.Read(func(*WAL_Entry) error { return nil })
+	s.lastSequenceNo = max(s.lastSequenceNo, s.tail.lastLSN)
+	return err
+}
+
+// lastSequenceNumberBefore returns the sequence number of the last entry of the segments older than
+// the given segment, or 0 if they are empty.
+func lastSequenceNumberBefore(fs FS, directory string, segment int) (uint64, error) {
+	segments, err := listSegmentFiles(fs, directory)
+	if err != nil {
+		return 0, err
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i].index >= segment {
+			continue
+		}
+		report, _ := verifySegment(fs, segments[i])
+		if report.Entries > 0 {
+			return report.LastSequenceNumber, nil
+		}
+	}
+	return 0, nil
+}
+
+// adoptPartialSegments renames the segment tails stored by a DirTarget to segments, unless the
+// complete segment was stored too, in which case the tail is removed.
+func adoptPartialSegments(fs FS, directory string) error {
+	files, err := fs.Glob(filepath.Join(directory, segmentPrefix+"*"+partialSuffix))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		segmentPath := strings.TrimSuffix(file, partialSuffix)
+		if _, err := fs.Stat(segmentPath); err == nil {
+			if err := fs.Remove(file); err != nil {
+				return err
+			}
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := fs.Rename(file, segmentPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package wal
+
+import (
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// Stats is a snapshot of the WAL's operational counters.
+type Stats struct {
+	// EntriesWritten is the number of entries (including checkpoints) written since the WAL was opened.
+	EntriesWritten uint64 `json:"entries_written"`
+	// BytesWritten is the number of bytes, including framing, written since the WAL was opened.
+	BytesWritten uint64 `json:"bytes_written"`
+	// LastSequenceNumber is the sequence number of the most recently written entry.
+	LastSequenceNumber uint64 `json:"last_sequence_number"`
+	// SegmentCount is the number of log segment files in the directory.
+	SegmentCount int `json:"segment_count"`
+	// ActiveSegmentSize is the size on disk of the segment currently being written to.
+	ActiveSegmentSize int64 `json:"active_segment_size"`
+	// Rotations is the number of times the log was rotated to a new segment.
+	Rotations uint64 `json:"rotations"`
+	// SegmentsDeleted is the number of old segments deleted because of the segment limit.
+	SegmentsDeleted uint64 `json:"segments_deleted"`
+	// PreallocatedSegments is the number of rotations to a spare segment prepared in advance, see WithPreallocate.
+	PreallocatedSegments uint64 `json:"preallocated_segments"`
+	// RecycledSegments is the number of spare segments prepared from a segment deleted because of the
+	// segment limit, see WithRecycleSegments.
+	RecycledSegments uint64 `json:"recycled_segments"`
+	// Fsyncs is the number of fsync calls on segment files.
+	Fsyncs uint64 `json:"fsyncs"`
+	// FsyncLatency is the histogram of the durations of fsync calls on segment files.
+	FsyncLatency Histogram `json:"fsync_latency"`
+	// FsyncLatencyP50, FsyncLatencyP95 and FsyncLatencyP99 are percentiles of the fsync latency,
+	// estimated from FsyncLatency.
+	FsyncLatencyP50 time.Duration `json:"fsync_latency_p50"`
+	FsyncLatencyP95 time.Duration `json:"fsync_latency_p95"`
+	FsyncLatencyP99 time.Duration `json:"fsync_latency_p99"`
+	// WriteLatency is the histogram of the durations of writes, including waiting for the lock.
+	WriteLatency Histogram `json:"write_latency"`
+	// WriteLatencyP50, WriteLatencyP95 and WriteLatencyP99 are percentiles of the write latency,
+	// estimated from WriteLatency.
+	WriteLatencyP50 time.Duration `json:"write_latency_p50"`
+	WriteLatencyP95 time.Duration `json:"write_latency_p95"`
+	WriteLatencyP99 time.Duration `json:"write_latency_p99"`
+	// SyncLatency is the histogram of the durations of syncs (flush and fsync).
+	SyncLatency Histogram `json:"sync_latency"`
+	// SyncLatencyP50, SyncLatencyP95 and SyncLatencyP99 are percentiles of the sync latency,
+	// estimated from SyncLatency.
+	SyncLatencyP50 time.Duration `json:"sync_latency_p50"`
+	SyncLatencyP95 time.Duration `json:"sync_latency_p95"`
+	SyncLatencyP99 time.Duration `json:"sync_latency_p99"`
+	// SlowSyncs is the number of fsync calls that took longer than the threshold set with WithOnSlowSync.
+	SlowSyncs uint64 `json:"slow_syncs"`
+	// Writebacks is the number of writebacks of flushed data started before it is synced, see WithWriteback.
+	Writebacks uint64 `json:"writebacks"`
+	// LastSyncTime is when the buffer was last synced.
+	LastSyncTime time.Time `json:"last_sync_time"`
+	// LastSyncDuration is how long the last sync (flush and fsync) took.
+	LastSyncDuration time.Duration `json:"last_sync_duration"`
+	// BufferedBytes is the number of bytes in the in-memory buffer not yet written to the segment file.
+	BufferedBytes int `json:"buffered_bytes"`
+	// BufferSize is the capacity of the in-memory buffer.
+	BufferSize int `json:"buffer_size"`
+	// Flushes is the number of writes of the in-memory buffer to the segment file, either explicit
+	// or because the buffer filled up.
+	Flushes uint64 `json:"flushes"`
+	// ThresholdFlushes is the number of flushes made because the buffer reached the threshold set with
+	// WithFlushThresholdBytes, before the sync timer fired.
+	ThresholdFlushes uint64 `json:"threshold_flushes"`
+	// FlushedBytes is the number of bytes written to segment files by flushes.
+	FlushedBytes uint64 `json:"flushed_bytes"`
+	// LastFlushSize is the number of bytes written by the last flush.
+	LastFlushSize int `json:"last_flush_size"`
+	// LargestEntrySize is the size, including framing, of the largest entry written since the WAL was opened.
+	LargestEntrySize int `json:"largest_entry_size"`
+	// LogicalBytesWritten is the number of bytes of entry data accepted since the WAL was opened.
+	LogicalBytesWritten uint64 `json:"logical_bytes_written"`
+	// PhysicalBytesWritten is the number of bytes written to disk since the WAL was opened: segment data
+	// including framing and metadata, side-files such as the checkpoint file, and rewrites by Repair.
+	PhysicalBytesWritten uint64 `json:"physical_bytes_written"`
+	// WriteAmplification is PhysicalBytesWritten divided by LogicalBytesWritten, or 0 if nothing was written.
+	WriteAmplification float64 `json:"write_amplification"`
+	// RetentionBytesDeleted is the size of the segments deleted because of the segment limit.
+	RetentionBytesDeleted uint64 `json:"retention_bytes_deleted"`
+	// Streams breaks down the writes of entries with a stream (see WithStream) by stream name.
+	Streams map[string]StreamStats `json:"streams,omitempty"`
+	// Consumers reports the progress of the consumers that committed offsets with CommitOffset, by name.
+	Consumers map[string]ConsumerStats `json:"consumers,omitempty"`
+	// CorruptionEvents is the number of times corrupted entries were detected while reading or repairing the log.
+	CorruptionEvents uint64 `json:"corruption_events"`
+	// ChecksumFailures, UnmarshalFailures and Truncations break down CorruptionEvents
+	// by the kind of corruption, see CorruptionKind.
+	ChecksumFailures  uint64 `json:"checksum_failures"`
+	UnmarshalFailures uint64 `json:"unmarshal_failures"`
+	Truncations       uint64 `json:"truncations"`
+	// Shipping reports the progress of the shipping set with WithShipping, if any.
+	Shipping *ShippingStats `json:"shipping,omitempty"`
+	// Mirror reports the state of the mirror directory set with WithMirror, if any.
+	Mirror *MirrorStats `json:"mirror,omitempty"`
+	// EntryCache reports the use of the cache set with WithEntryCache, if any.
+	EntryCache *EntryCacheStats `json:"entry_cache,omitempty"`
+}
+
+// StreamStats are the write counters of a single stream.
+type StreamStats struct {
+	// EntriesWritten is the number of entries of the stream written since the WAL was opened.
+	EntriesWritten uint64 `json:"entries_written"`
+	// BytesWritten is the number of bytes, including framing, of the stream written since the WAL was opened.
+	BytesWritten uint64 `json:"bytes_written"`
+}
+
+// ConsumerStats describe the progress of a consumer of the log.
+type ConsumerStats struct {
+	// Offset is the last offset committed by the consumer.
+	Offset uint64 `json:"offset"`
+	// Lag is the number of entries written after Offset.
+	Lag uint64 `json:"lag"`
+}
+
+// Stats returns a snapshot of the WAL's operational counters.
+func (wal *WAL) Stats() Stats {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	stats := wal.stats
+	stats.FsyncLatency = wal.stats.FsyncLatency.clone()
+	stats.FsyncLatencyP50 = stats.FsyncLatency.Quantile(0.50)
+	stats.FsyncLatencyP95 = stats.FsyncLatency.Quantile(0.95)
+	stats.FsyncLatencyP99 = stats.FsyncLatency.Quantile(0.99)
+	stats.WriteLatency = wal.stats.WriteLatency.clone()
+	stats.WriteLatencyP50 = stats.WriteLatency.Quantile(0.50)
+	stats.WriteLatencyP95 = stats.WriteLatency.Quantile(0.95)
+	stats.WriteLatencyP99 = stats.WriteLatency.Quantile(0.99)
+	stats.SyncLatency = wal.stats.SyncLatency.clone()
+	stats.SyncLatencyP50 = stats.SyncLatency.Quantile(0.50)
+	stats.SyncLatencyP95 = stats.SyncLatency.Quantile(0.95)
+	stats.SyncLatencyP99 = stats.SyncLatency.Quantile(0.99)
+	stats.LastSequenceNumber = wal.lastSequenceNo
+	stats.BufferedBytes = wal.bufWriter.Buffered()
+	stats.BufferSize = wal.bufWriter.Size()
+	if stats.LogicalBytesWritten > 0 {
+		stats.WriteAmplification = float64(stats.PhysicalBytesWritten) / float64(stats.LogicalBytesWritten)
+	}
+
+	if files, err := wal.fs.Glob(filepath.Join(wal.directory, segmentPrefix+"*")); err == nil {
+		stats.SegmentCount = len(files)
+	}
+	if wal.shipper != nil {
+		stats.Shipping = wal.shippingStats()
+	}
+	if wal.mirror != nil {
+		stats.Mirror = wal.mirror.stats()
+	}
+	if wal.entryCache != nil {
+		stats.EntryCache = wal.entryCache.stats()
+	}
+	if fileInfo, err := wal.currentSegment.Stat(); err == nil {
+		stats.ActiveSegmentSize = fileInfo.Size()
+	}
+
+	if len(wal.streamStats) > 0 {
+		stats.Streams = make(map[string]StreamStats, len(wal.streamStats))
+		for stream, streamStats := range wal.streamStats {
+			stats.Streams[stream] = *streamStats
+		}
+	}
+	if len(wal.consumerOffsets) > 0 {
+		stats.Consumers = make(map[string]ConsumerStats, len(wal.consumerOffsets))
+		for consumer, offset := range wal.consumerOffsets {
+			consumerStats := ConsumerStats{Offset: offset}
+			if offset < wal.lastSequenceNo {
+				consumerStats.Lag = wal.lastSequenceNo - offset
+			}
+			stats.Consumers[consumer] = consumerStats
+		}
+	}
+
+	wal.corruptionLock.Lock()
+	stats.CorruptionEvents = wal.corruptionEvents
+	stats.ChecksumFailures = wal.checksumFailures
+	stats.UnmarshalFailures = wal.unmarshalFailures
+	stats.Truncations = wal.truncations
+	wal.corruptionLock.Unlock()
+
+	return stats
+}
+
+// flushCounter sits between the in-memory buffer and the segment file and counts the flushes
+// going through it. It is only written to while wal.lock is held.
+type flushCounter struct {
+	w     io.Writer
+	stats *Stats
+}
+
+func (c flushCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.record(n)
+	return n, err
+}
+
+// record counts a flush of n bytes.
+func (c flushCounter) record(n int) {
+	c.stats.Flushes++
+	c.stats.FlushedBytes += uint64(n)
+	c.stats.LastFlushSize = n
+	c.stats.PhysicalBytesWritten += uint64(n)
+}
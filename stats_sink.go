@@ -0,0 +1,62 @@
+package wal
+
+import (
+	"sync"
+	"time"
+)
+
+// StatsSink receives the Stats of a WAL periodically, see WithStatsSink.
+// It allows reporting to monitoring systems the package doesn't integrate with.
+type StatsSink interface {
+	// ReportStats is called from a dedicated goroutine with a fresh snapshot of the Stats.
+	ReportStats(stats Stats)
+}
+
+// StatsSinkFunc adapts an ordinary function to a StatsSink.
+type StatsSinkFunc func(stats Stats)
+
+// ReportStats calls f(stats).
+func (f StatsSinkFunc) ReportStats(stats Stats) {
+	f(stats)
+}
+
+// StatsRecorder is a StatsSink that keeps the most recently reported Stats.
+// It is the building block of adapters for pull based monitoring systems.
+type StatsRecorder struct {
+	lock  sync.Mutex
+	stats Stats
+}
+
+// ReportStats implements StatsSink.
+func (r *StatsRecorder) ReportStats(stats Stats) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stats = stats
+}
+
+// Stats returns the most recently reported Stats, or zero Stats if none have been reported.
+func (r *StatsRecorder) Stats() Stats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.stats
+}
+
+type statsSink struct {
+	sink     StatsSink
+	interval time.Duration
+}
+
+// reportStats reports the Stats of the WAL to the sink every interval until the WAL is closed.
+func (wal *WAL) reportStats(sink StatsSink, timer Timer, interval time.Duration) {
+	for {
+		select {
+		case <-timer.C():
+			sink.ReportStats(wal.Stats())
+			timer.Reset(interval)
+
+		case <-wal.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultSubscriptionMinBackoff = 10 * time.Millisecond
+	defaultSubscriptionMaxBackoff = 5 * time.Second
+)
+
+// Subscription delivers the entries of a WAL to a handler, in order, from a goroutine, see Subscribe.
+type Subscription struct {
+	wal     *WAL
+	name    string
+	handler func(*WAL_Entry) error
+	subscriptionOptions
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error // error the subscription ended with, set before done is closed
+}
+
+// SubscribeOption configures a Subscription.
+type SubscribeOption func(*subscriptionOptions)
+
+type subscriptionOptions struct {
+	commitEvery int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxAttempts int
+}
+
+// WithCommitEvery commits the progress of the subscription every n entries handled, instead of after
+// every entry. Delivery stays at least once, but up to n entries are delivered again after a crash.
+// The progress is also committed whenever the subscription has caught up with the log, and when it is
+// closed.
+func WithCommitEvery(n int) SubscribeOption {
+	return func(o *subscriptionOptions) {
+		o.commitEvery = max(n, 1)
+	}
+}
+
+// WithRetryBackoff sets the backoff between the attempts to handle an entry when the handler fails:
+// it starts at minBackoff and doubles after every failed attempt, up to maxBackoff. Defaults to 10ms and 5s.
+func WithRetryBackoff(minBackoff, maxBackoff time.Duration) SubscribeOption {
+	return func(o *subscriptionOptions) {
+		o.minBackoff = minBackoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithMaxAttempts ends the subscription with the error of the handler once it failed n times on the
+// same entry, instead of retrying it until the subscription is closed. The default is 0: no limit.
+func WithMaxAttempts(n int) SubscribeOption {
+	return func(o *subscriptionOptions) {
+		o.maxAttempts = max(n, 0)
+	}
+}
+
+// Subscribe starts a goroutine calling handler for every entry of the WAL, checkpoints included, in
+// order, and returns the Subscription. It is the push counterpart of Tail.
+//
+// Delivery is at least once: the sequence number of the last entry handled is committed as the consumer
+// offset of the given name (see CommitOffset), and a subscription of the same name resumes after it.
+// fromLSN is only used if the consumer hasn't committed an offset yet. If the handler fails, the entry
+// is handled again after a backoff, see WithRetryBackoff and WithMaxAttempts. Entries are delivered once
+// they have been flushed to the segment files.
+func (wal *WAL) Subscribe(name string, fromLSN uint64, handler func(*WAL_Entry) error, opts ...SubscribeOption) (*Subscription, error) {
+	if name == "" {
+		return nil, errors.New("subscription name must not be empty")
+	}
+	o := subscriptionOptions{
+		commitEvery: 1,
+		minBackoff:  defaultSubscriptionMinBackoff,
+		maxBackoff:  defaultSubscriptionMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if offset := wal.ConsumerOffset(name); offset > 0 {
+		fromLSN = offset + 1
+	}
+	tail, err := wal.Tail(fromLSN)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Subscription{
+		wal:                 wal,
+		name:                name,
+		handler:             handler,
+		subscriptionOptions: o,
+		cancel:              cancel,
+		done:                make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		defer tail.Stop()
+		s.err = s.run(ctx, tail)
+	}()
+	return s, nil
+}
+
+// run delivers the entries read by tail until ctx is done or an error ends the subscription.
+func (s *Subscription) run(ctx context.Context, tail *Tail) error {
+	var handled, committed uint64
+	pending := 0
+	commit := func() error {
+		if handled == committed {
+			return nil
+		}
+		if err := s.wal.CommitOffset(s.name, handled); err != nil {
+			return err
+		}
+		committed = handled
+		pending = 0
+		return nil
+	}
+
+	for {
+		err := tail.Read(func(entry *WAL_Entry) error {
+			if err := s.handle(ctx, entry); err != nil {
+				return err
+			}
+			handled = entry.GetLogSequenceNumber()
+			pending++
+			if pending >= s.commitEvery {
+				return commit()
+			}
+			return nil
+		})
+		if err == nil {
+			err = commit()
+		} else if ctx.Err() != nil {
+			// The entries handled before the subscription was closed are still committed.
+			err = commit()
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tail.Wait(ctx); err != nil {
+			// Closed.
+			return nil
+		}
+	}
+}
+
+// handle calls the handler for the entry, retrying with backoff until it succeeds, the attempts are
+// exhausted or ctx is done.
+func (s *Subscription) handle(ctx context.Context, entry *WAL_Entry) error {
+	backoff := s.minBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.handler(entry)
+		if err == nil {
+			return nil
+		}
+		if s.maxAttempts > 0 && attempt >= s.maxAttempts {
+			return fmt.Errorf("could not handle entry %d after %d attempts: %w", entry.GetLogSequenceNumber(), attempt, err)
+		}
+
+		timer := s.wal.clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+		backoff = min(backoff*2, s.maxBackoff)
+	}
+}
+
+// Delivered returns the sequence number of the last entry handled and committed, or 0 if none was.
+func (s *Subscription) Delivered() uint64 {
+	return s.wal.ConsumerOffset(s.name)
+}
+
+// Done returns a channel closed once the subscription has ended, because it was closed or because of
+// an error, returned by Err.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that ended the subscription, or nil if it is running or was closed.
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close stops the subscription, waiting for the handler to return, commits its progress and returns
+// the error that ended the subscription, if any.
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return s.err
+}
@@ -0,0 +1,579 @@
+package wal
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrEntriesDeleted is returned by Tail and TailDir when entries that were still to be read have been
+// deleted from the log, by retention or truncation, so they can't be read anymore.
+var ErrEntriesDeleted = errors.New("entries were deleted before they were read")
+
+// TailDir reads the entries of the WAL in directory with a sequence number of at least fromLSN,
+// in order, and calls fn for each of them. The WAL may be written concurrently, including by another
+// process: only entries that were completely written to the segment files are read.
+//
+// If follow is false, TailDir returns once it has read the end of the newest segment. Otherwise it
+// keeps polling for new entries every sync interval (see WithSyncInterval), following rotations,
+// until ctx is done or fn returns an error, which is returned. If entries after fromLSN (or after the
+// last entry read) were deleted before they could be read, it returns ErrEntriesDeleted; with a fromLSN
+// of 0, reading starts at the oldest entry still in the log. Corrupted entries end the tail with an error.
+// The options used are WithFS, WithClock, WithSyncInterval, WithEntryReuse and WithMmapReads.
+func TailDir(ctx context.Context, directory string, fromLSN uint64, follow bool, fn func(*WAL_Entry) error, opts ...Option) error {
+	t, err := NewTail(directory, fromLSN, opts...)
+	if err != nil {
+		return err
+	}
+	defer t.Stop()
+
+	for {
+		if err := t.Read(fn); err != nil || !follow {
+			return err
+		}
+		if err := t.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// errReadLimit stops a read at the entry after the limit of ReadUntil.
+var errReadLimit = errors.New("read limit reached")
+
+// Tail reads the entries of a WAL directory as they are written, see NewTail.
+// A Tail must not be used concurrently.
+type Tail struct {
+	fs        FS
+	directory string
+	fromLSN   uint64
+	clock     Clock
+	interval  time.Duration
+	timer     Timer
+
+	// segment is the index of the segment being read, or -1 if no segment exists yet.
+	segment int
+	// offset is the offset of the next entry to read in the segment, 0 until its header is read.
+	offset int64
+	// file is the segment file being read, kept open between reads, with info its FileInfo as opened.
+	// reader reads it from readerOffset on, or from offset once the two differ.
+	file         File
+	fileInfo     os.FileInfo
+	reader       *bufio.Reader
+	readerOffset int64
+	// format is the format of the segment, read from its header.
+	format segmentFormat
+	// lastLSN is the sequence number of the last entry read, or 0 if none was read yet.
+	lastLSN uint64
+	// until, if limited, is the sequence number of the last entry the current read may deliver, see ReadUntil.
+	until   uint64
+	limited bool
+
+	// prefix and buf hold the size and the data of the entry being read.
+	prefix [4]byte
+	buf    []byte
+	// entry, if not nil, is the entry every entry is read into, see WithEntryReuse.
+	entry *WAL_Entry
+	// mmapReads maps the sealed segments into memory to read them, see WithMmapReads.
+	mmapReads bool
+	// readBufferSize is the size of the buffer of reader, see WithReadBufferSize.
+	readBufferSize int
+
+	// wal, for the tails of a WAL, wakes up Wait when entries are flushed or synced, see WAL.Tail.
+	// notify is the channel of the notification following the last read.
+	wal    *WAL
+	notify <-chan struct{}
+}
+
+// NewTail returns a Tail reading the entries of the WAL in directory with a sequence number of at least
+// fromLSN. Like TailDir, it only reads entries completely written to the segment files, and returns
+// ErrEntriesDeleted if the entries from fromLSN on are no longer in the log.
+// The options used are WithFS, WithClock, WithSyncInterval, which sets the interval Wait waits for,
+// WithEntryReuse, WithMmapReads and WithReadBufferSize.
+func NewTail(directory string, fromLSN uint64, opts ...Option) (*Tail, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	t := &Tail{fs: o.fs, directory: directory, fromLSN: fromLSN, clock: o.clock, interval: o.syncInterval,
+		mmapReads: o.mmapReads, readBufferSize: o.readBufferSize}
+	if o.reuseEntries {
+		t.entry = &WAL_Entry{}
+	}
+	if err := t.seek(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Tail returns a Tail reading the entries of the WAL with a sequence number of at least fromLSN.
+// Entries are readable once they have been flushed to the segment files, and Wait returns as soon as
+// entries are flushed or synced, or else every sync interval.
+func (wal *WAL) Tail(fromLSN uint64) (*Tail, error) {
+	wal.lock.Lock()
+	interval := wal.syncInterval
+	wal.lock.Unlock()
+
+	t, err := NewTail(wal.directory, fromLSN, WithFS(wal.fs), WithClock(wal.clock), WithSyncInterval(interval),
+		WithReadBufferSize(wal.readBufferSize))
+	if err != nil {
+		return nil, err
+	}
+	t.wal = wal
+	return t, nil
+}
+
+// Read calls fn for the entries written since the previous call, in order, until it has read the end
+// of the newest segment or fn returns an error, which is returned.
+func (t *Tail) Read(fn func(*WAL_Entry) error) error {
+	return t.ReadViews(func(view EntryView) error {
+		if view.entry != nil {
+			return fn(view.entry)
+		}
+		entry := t.entry
+		if entry == nil {
+			entry = &WAL_Entry{}
+		}
+		view.copyTo(entry)
+		return fn(entry)
+	})
+}
+
+// ReadUntil is Read, stopping before the first entry with a sequence number after lsn, which is read
+// by the next call. It lets readers wait for entries to be synced, see WAL.SyncedSequenceNumber.
+func (t *Tail) ReadUntil(lsn uint64, fn func(*WAL_Entry) error) error {
+	t.until, t.limited = lsn, true
+	defer func() { t.limited = false }()
+	return t.Read(fn)
+}
+
+// ReadViews is Read, passing fn a view of every entry instead of the entry. The entries written with
+// EncodingFlatBuffers or EncodingCapnProto are read in place, without unmarshaling and copying them,
+// which makes replaying and tailing them cheaper; the view is only valid until fn returns.
+func (t *Tail) ReadViews(fn func(EntryView) error) error {
+	// The notification is taken before reading, so that no flush is missed between the read and Wait.
+	if t.wal != nil {
+		t.notify = t.wal.tailNotification()
+	}
+	for {
+		caughtUp, err := t.poll(fn)
+		if errors.Is(err, errReadLimit) {
+			return nil
+		}
+		if err != nil || caughtUp {
+			return err
+		}
+	}
+}
+
+// Wait waits for the poll interval to pass, or for ctx to be done. The tails of a WAL, see WAL.Tail,
+// also return as soon as the WAL flushes or syncs entries after the last read.
+func (t *Tail) Wait(ctx context.Context) error {
+	if t.timer == nil {
+		t.timer = t.clock.NewTimer(t.interval)
+	} else {
+		t.timer.Reset(t.interval)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.timer.C():
+		return nil
+	case <-t.notify:
+		return nil
+	}
+}
+
+// Stop releases the resources of the Tail.
+func (t *Tail) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.closeSegment()
+}
+
+// seek positions the tail at the newest segment whose first entry is not after fromLSN,
+// so that older segments don't have to be read.
+func (t *Tail) seek() error {
+	t.segment = -1
+
+	segments, err := listSegmentFiles(t.fs, t.directory)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+
+	t.segment = segments[0].index
+	for _, segment := range segments[1:] {
+		entry, err := t.readFirstEntry(segment.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if entry == nil || entry.GetLogSequenceNumber() > t.fromLSN {
+			break
+		}
+		t.segment = segment.index
+	}
+
+	// Segments are numbered from 0, so if the oldest one isn't the first, older ones were deleted.
+	if t.fromLSN > 0 && t.segment == segments[0].index && t.segment > 0 {
+		entry, err := t.readFirstEntry(segments[0].path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if entry != nil && entry.GetLogSequenceNumber() > t.fromLSN {
+			return fmt.Errorf("%w: the oldest entry is %d, requested %d", ErrEntriesDeleted, entry.GetLogSequenceNumber(), t.fromLSN)
+		}
+	}
+
+	return nil
+}
+
+// poll reads the entries available in the current segment, moving to the next segment once the current
+// one is complete. It reports whether the end of the newest segment was reached.
+func (t *Tail) poll(fn func(EntryView) error) (caughtUp bool, err error) {
+	segments, err := listSegmentFiles(t.fs, t.directory)
+	if err != nil {
+		return false, err
+	}
+	if len(segments) == 0 {
+		return true, nil
+	}
+
+	var current, next *segmentFile
+	for i := range segments {
+		if segments[i].index == t.segment {
+			current = &segments[i]
+		} else if segments[i].index > t.segment && next == nil {
+			next = &segments[i]
+		}
+	}
+
+	if current != nil {
+		// A segment is synced before the next one is created, so once a newer segment exists,
+		// reading the current one to its end reads all of its entries.
+		err := errors.ErrUnsupported
+		if next != nil && t.mmapReads {
+			err = t.readSealed(current.path, fn)
+		}
+		if errors.Is(err, errors.ErrUnsupported) {
+			err = t.readAvailable(current.path, fn)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+	}
+
+	if next == nil {
+		return true, nil
+	}
+	if current == nil || next.index != t.segment+1 {
+		if err := t.checkContinuity(*next); err != nil {
+			return false, err
+		}
+	}
+	t.closeSegment()
+	t.segment = next.index
+	t.offset = 0
+	return false, nil
+}
+
+// checkContinuity verifies that no entries were lost when the segments between the current segment
+// and next were deleted, by comparing the first entry of next with the last entry read.
+func (t *Tail) checkContinuity(next segmentFile) error {
+	if t.segment < 0 || (t.lastLSN == 0 && t.fromLSN == 0) {
+		return nil
+	}
+
+	entry, err := t.readFirstEntry(next.path)
+	if err != nil || entry == nil {
+		return err
+	}
+	if expected := max(t.lastLSN+1, t.fromLSN); entry.GetLogSequenceNumber() > expected {
+		return fmt.Errorf("%w: expected entry %d, the next one is %d", ErrEntriesDeleted, expected, entry.GetLogSequenceNumber())
+	}
+	return nil
+}
+
+// readAvailable calls fn for the complete entries of the segment file past the current offset.
+func (t *Tail) readAvailable(path string, fn func(EntryView) error) error {
+	if t.offset == 0 {
+		format, ok, err := t.readFormat(path)
+		if err != nil || !ok {
+			return err
+		}
+		t.format, t.offset = format, format.headerSize()
+	}
+	fileSize, err := t.openSegment(path)
+	if err != nil {
+		return err
+	}
+	for {
+		record, size, err := t.readNextRecord(path, fileSize)
+		if err != nil || record == nil {
+			return err
+		}
+		if err := t.deliver(path, record, size, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// openSegment keeps the segment file at path open for reading, reopening it if it was replaced, e.g.
+// rewritten by a compaction, and returns its size.
+func (t *Tail) openSegment(path string) (int64, error) {
+	if t.file != nil && t.file.Name() == path {
+		fileInfo, err := t.fs.Stat(path)
+		if err != nil {
+			t.closeSegment()
+			return 0, err
+		}
+		if os.SameFile(fileInfo, t.fileInfo) && fileInfo.Size() >= t.offset {
+			return fileInfo.Size(), nil
+		}
+	}
+
+	t.closeSegment()
+	file, err := t.fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+	t.file, t.fileInfo = file, fileInfo
+	t.reader = getSegmentReader(file, t.readBufferSize)
+	t.readerOffset = -1
+	return fileInfo.Size(), nil
+}
+
+// closeSegment closes the segment file being read, if any.
+func (t *Tail) closeSegment() {
+	if t.file == nil {
+		return
+	}
+	t.file.Close()
+	putSegmentReader(t.reader)
+	t.file, t.fileInfo, t.reader = nil, nil, nil
+}
+
+// readNextRecord reads the record at the current offset of the open segment file, of the given size,
+// like readRecordAt.
+func (t *Tail) readNextRecord(path string, fileSize int64) ([]byte, int64, error) {
+	offset := t.offset
+	if offset+4 > fileSize {
+		t.readerOffset = -1
+		return nil, 0, nil
+	}
+	if t.readerOffset != offset {
+		if _, err := t.file.Seek(offset, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		t.reader.Reset(t.file)
+		t.readerOffset = offset
+	}
+
+	prefix, err := t.reader.Peek(4)
+	if err != nil {
+		t.readerOffset = -1
+		if err == io.EOF {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	size := int32(binary.LittleEndian.Uint32(prefix))
+	if size < 0 {
+		return nil, 0, fmt.Errorf("%s at offset %d: %w", path, offset, ErrInvalidEntry)
+	}
+	if size == 0 || offset+4+int64(size) > fileSize {
+		// The preallocated space of a segment written with WithMmap reads as zeros until it is written,
+		// so the buffered data is dropped, to be read again once there is more.
+		t.readerOffset = -1
+		return nil, 0, nil
+	}
+
+	t.buf = resizeBuffer(t.buf, int(size))
+	if _, err := t.reader.Discard(4); err != nil {
+		t.readerOffset = -1
+		return nil, 0, err
+	}
+	if _, err := io.ReadFull(t.reader, t.buf); err != nil {
+		t.readerOffset = -1
+		return nil, 0, err
+	}
+	t.readerOffset = offset + 4 + int64(size)
+	return t.buf, 4 + int64(size), nil
+}
+
+// readSealed is readAvailable for a segment that is no longer written, reading its entries from the
+// file mapped into memory. It returns errors.ErrUnsupported if the file can't be mapped.
+func (t *Tail) readSealed(path string, fn func(EntryView) error) error {
+	file, err := t.fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if fileInfo.Size() <= t.offset {
+		return nil
+	}
+	data, err := mapSealedSegment(file, fileInfo.Size())
+	if err != nil {
+		return err
+	}
+	defer unmapSealedSegment(data)
+
+	if t.offset == 0 {
+		format, err := parseSegmentHeader(data[:min(len(data), segmentHeaderSize)])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		t.format, t.offset = format, format.headerSize()
+	}
+
+	for t.offset+4 <= int64(len(data)) {
+		size := int32(binary.LittleEndian.Uint32(data[t.offset:]))
+		if size == 0 {
+			return nil
+		}
+		if size < 0 {
+			return fmt.Errorf("%s at offset %d: %w", path, t.offset, ErrInvalidEntry)
+		}
+		end := t.offset + 4 + int64(size)
+		if end > int64(len(data)) {
+			return nil
+		}
+		if err := t.deliver(path, data[t.offset+4:end], 4+int64(size), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver calls fn for the record read at the current offset, unless it is before fromLSN, and moves
+// past it.
+func (t *Tail) deliver(path string, record []byte, size int64, fn func(EntryView) error) error {
+	view, err := newEntryView(record, t.format, t.entry)
+	if err != nil {
+		return fmt.Errorf("%s at offset %d: %w", path, t.offset, err)
+	}
+	if t.limited && view.LogSequenceNumber() > t.until {
+		return errReadLimit
+	}
+	t.offset += size
+	t.lastLSN = view.LogSequenceNumber()
+
+	if view.LogSequenceNumber() < t.fromLSN {
+		return nil
+	}
+	if view.hasExternalData() {
+		entry := view.entry
+		if entry == nil {
+			entry = &WAL_Entry{}
+			view.copyTo(entry)
+		}
+		if err := resolveData(t.fs, t.directory, entry); err != nil {
+			return err
+		}
+		view = EntryView{entry: entry}
+	}
+	return fn(view)
+}
+
+// readFirstEntry reads the first entry of the segment file. It returns a nil entry if no complete entry
+// has been written to it yet.
+func (t *Tail) readFirstEntry(path string) (*WAL_Entry, error) {
+	format, ok, err := t.readFormat(path)
+	if err != nil || !ok {
+		return nil, err
+	}
+	offset := format.headerSize()
+	record, _, err := t.readRecordAt(path, offset)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	entry := t.entry
+	if entry == nil {
+		entry = &WAL_Entry{}
+	}
+	if err := unmarshalAndVerifyEntryInto(record, format, entry); err != nil {
+		return nil, fmt.Errorf("%s at offset %d: %w", path, offset, err)
+	}
+	return entry, nil
+}
+
+// readFormat reads the format of the segment file from its header. It reports false if the header hasn't
+// been completely written yet.
+func (t *Tail) readFormat(path string) (segmentFormat, bool, error) {
+	format, err := readSegmentFormat(t.fs, path)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return format, false, nil
+	}
+	if err != nil {
+		return format, false, fmt.Errorf("%s: %w", path, err)
+	}
+	return format, true, nil
+}
+
+// readRecordAt reads the record at the given offset of the segment file into t.buf, and returns it with
+// its size in the file. It returns a nil record if no complete record has been written at the offset yet.
+func (t *Tail) readRecordAt(path string, offset int64) ([]byte, int64, error) {
+	file, err := t.fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset+4 > fileInfo.Size() {
+		return nil, 0, nil
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	size, err := readFrameSize(file, &t.prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size == 0 {
+		// The preallocated space of a segment written with WithMmap reads as zeros, nothing is written yet.
+		return nil, 0, nil
+	}
+	if size < 0 {
+		return nil, 0, fmt.Errorf("%s at offset %d: %w", path, offset, ErrInvalidEntry)
+	}
+	if offset+4+int64(size) > fileInfo.Size() {
+		return nil, 0, nil
+	}
+
+	t.buf = resizeBuffer(t.buf, int(size))
+	if _, err := io.ReadFull(file, t.buf); err != nil {
+		return nil, 0, err
+	}
+
+	return t.buf, 4 + int64(size), nil
+}
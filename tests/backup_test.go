@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_Backup(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Backup"
+	backupPath := "TestWAL_Backup_backup"
+	restorePath := "TestWAL_Backup_restore"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(backupPath)
+	defer os.RemoveAll(restorePath)
+
+	walog, err := wal.OpenWAL(dirPath, true, 256, 1000, wal.WithBlobThreshold(64))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 1; i <= 20; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry %d", i))))
+	}
+	assert.NoError(t, walog.WriteEntry(bytes.Repeat([]byte("blob "), 20)))
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+
+	// Writers aren't stopped by the backup, which holds the entries written before it.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, walog.WriteEntry([]byte("concurrent")))
+		}
+	}()
+	manifest, err := walog.Backup(context.Background(), backupPath)
+	assert.NoError(t, err)
+	wg.Wait()
+	assert.GreaterOrEqual(t, manifest.LastSequenceNumber, uint64(22))
+	assert.Contains(t, manifest.Files, "checkpoint")
+
+	_, err = walog.Backup(context.Background(), backupPath)
+	assert.Error(t, err, "Expected an error backing up to a non-empty directory")
+
+	restored, err := wal.RestoreBackup(context.Background(), backupPath, restorePath)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest.Files, restored.Files)
+	assert.Equal(t, manifest.LastSequenceNumber, restored.LastSequenceNumber)
+	assert.True(t, manifest.Time.Equal(restored.Time))
+
+	restoredLog, err := wal.OpenWAL(restorePath, true, 256, 1000)
+	assert.NoError(t, err, "Failed to open restored WAL")
+	defer restoredLog.Close()
+	entries, err := restoredLog.ReadAll(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("checkpoint"), entries[0].GetData())
+	all, err := restoredLog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest.LastSequenceNumber, all[len(all)-1].GetLogSequenceNumber())
+	assert.Equal(t, bytes.Repeat([]byte("blob "), 20), all[20].GetData())
+}
+
+func TestWAL_BackupTo(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_BackupTo"
+	restorePath := "TestWAL_BackupTo_restore"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(restorePath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithValueLog(64))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	large := bytes.Repeat([]byte("large value "), 10)
+	assert.NoError(t, walog.WriteEntry([]byte("small")))
+	assert.NoError(t, walog.WriteEntry(large))
+
+	var archive bytes.Buffer
+	manifest, err := walog.BackupTo(context.Background(), &archive)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), manifest.LastSequenceNumber)
+
+	// A truncated archive misses its manifest, and the restore can be retried from a complete one.
+	_, err = wal.RestoreBackupFrom(context.Background(), bytes.NewReader(archive.Bytes()[:archive.Len()/2]), restorePath)
+	assert.ErrorIs(t, err, wal.ErrIncompleteBackup)
+
+	restored, err := wal.RestoreBackupFrom(context.Background(), &archive, restorePath)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest.Files, restored.Files)
+	assert.Equal(t, manifest.LastSequenceNumber, restored.LastSequenceNumber)
+	assert.True(t, manifest.Time.Equal(restored.Time))
+
+	restoredLog, err := wal.OpenWAL(restorePath, true, maxFileSize, maxSegments, wal.WithValueLog(64))
+	assert.NoError(t, err, "Failed to open restored WAL")
+	defer restoredLog.Close()
+	entries, err := restoredLog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, large, entries[1].GetData())
+}
+
+func TestRestoreBackup_Incomplete(t *testing.T) {
+	t.Parallel()
+	backupPath := "TestRestoreBackup_Incomplete"
+	defer os.RemoveAll(backupPath)
+
+	assert.NoError(t, os.MkdirAll(backupPath, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(backupPath, "segment-0"), nil, 0644))
+	_, err := wal.RestoreBackup(context.Background(), backupPath, backupPath+"_restore")
+	assert.ErrorIs(t, err, wal.ErrIncompleteBackup)
+}
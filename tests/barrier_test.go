@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBarrier(t *testing.T) {
+	t.Parallel()
+	dirPaths := []string{"TestBarrier_shard0", "TestBarrier_shard1"}
+	var shards []*wal.WAL
+	for _, dirPath := range dirPaths {
+		defer os.RemoveAll(dirPath)
+		shard, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+		assert.NoError(t, err, "Failed to create WAL")
+		defer shard.Close()
+		shards = append(shards, shard)
+	}
+
+	_, err := wal.LastBarrier(shards...)
+	assert.ErrorIs(t, err, wal.ErrNoBarrier)
+
+	assert.NoError(t, shards[0].WriteEntry([]byte("entry1")))
+	assert.NoError(t, shards[0].WriteEntry([]byte("entry2")))
+	assert.NoError(t, shards[1].WriteEntry([]byte("entry1")))
+
+	cut, err := wal.Barrier("b1", shards...)
+	assert.NoError(t, err)
+	assert.Equal(t, "b1", cut.ID)
+	assert.Equal(t, []uint64{3, 2}, cut.SequenceNumbers)
+
+	for i, shard := range shards {
+		assert.NoError(t, shard.WriteEntry([]byte(fmt.Sprintf("after%d", i))))
+	}
+	_, err = wal.Barrier("b2", shards...)
+	assert.NoError(t, err)
+
+	// A barrier that was only committed in one of the WALs isn't a consistent cut.
+	_, err = wal.Barrier("b3", shards[0])
+	assert.NoError(t, err)
+
+	last, err := wal.LastBarrier(shards...)
+	assert.NoError(t, err)
+	assert.Equal(t, "b2", last.ID)
+	assert.Equal(t, []uint64{6, 5}, last.SequenceNumbers)
+
+	entries, err := shards[1].ReadAll(false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 6) {
+		assert.Equal(t, wal.BarrierStream, entries[1].GetStream())
+		assert.Equal(t, "prepare", entries[1].GetLabels()[wal.BarrierLabelPhase])
+		assert.Equal(t, "commit", entries[2].GetLabels()[wal.BarrierLabelPhase])
+		assert.Equal(t, "b1", entries[2].GetLabels()[wal.BarrierLabelID])
+	}
+
+	_, err = wal.Barrier("b4", shards[0], shards[0])
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_BlobThreshold(t *testing.T) {
+	t.Parallel()
+	for _, encoding := range []wal.Encoding{wal.EncodingProtobuf, wal.EncodingBinary, wal.EncodingJSON,
+		wal.EncodingFlatBuffers, wal.EncodingCapnProto} {
+		t.Run(fmt.Sprint(encoding), func(t *testing.T) {
+			dirPath := fmt.Sprintf("TestWAL_BlobThreshold_%v", encoding)
+			defer os.RemoveAll(dirPath)
+
+			walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments,
+				wal.WithEncoding(encoding), wal.WithBlobThreshold(64))
+			assert.NoError(t, err, "Failed to create WAL")
+			defer walog.Close()
+
+			large := bytes.Repeat([]byte("large value "), 100)
+			for i := 0; i < 5; i++ {
+				assert.NoError(t, walog.WriteEntry(large))
+			}
+			assert.NoError(t, walog.WriteEntry([]byte("small")))
+			assert.NoError(t, walog.Sync())
+
+			// The repeated value is stored once, and not in the segment.
+			blobs, err := filepath.Glob(filepath.Join(dirPath, "blobs", "*"))
+			assert.NoError(t, err)
+			assert.Len(t, blobs, 1)
+			segments, err := filepath.Glob(filepath.Join(dirPath, "segment-*"))
+			assert.NoError(t, err)
+			fileInfo, err := os.Stat(segments[0])
+			assert.NoError(t, err)
+			assert.Less(t, fileInfo.Size(), int64(len(large)))
+
+			entries, err := walog.ReadAll(false)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 6)
+			assert.Equal(t, large, entries[4].GetData())
+			assert.Nil(t, entries[4].GetBlob())
+			assert.Equal(t, []byte("small"), entries[5].GetData())
+
+			tail, err := walog.Tail(1)
+			assert.NoError(t, err)
+			defer tail.Stop()
+			var tailed [][]byte
+			assert.NoError(t, tail.ReadViews(func(view wal.EntryView) error {
+				tailed = append(tailed, append([]byte{}, view.Data()...))
+				return nil
+			}))
+			assert.Len(t, tailed, 6)
+			assert.Equal(t, large, tailed[0])
+		})
+	}
+}
+
+func TestWAL_CollectBlobs(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_CollectBlobs"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithBlobThreshold(16))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("a value larger than the threshold")))
+
+	// A blob of an entry that is gone, e.g. compacted away.
+	orphan := filepath.Join(dirPath, "blobs", "00000000000000000000000000000000000000000000000000000000000000ff")
+	assert.NoError(t, os.WriteFile(orphan, []byte("orphan"), 0644))
+
+	deleted, err := walog.CollectBlobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = os.Stat(orphan)
+	assert.True(t, os.IsNotExist(err))
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a value larger than the threshold"), entries[0].GetData())
+
+	// A blob that doesn't match its hash is corrupt.
+	blobs, err := filepath.Glob(filepath.Join(dirPath, "blobs", "*"))
+	assert.NoError(t, err)
+	assert.Len(t, blobs, 1)
+	assert.NoError(t, os.WriteFile(blobs[0], []byte("tampered"), 0644))
+	_, err = walog.ReadAll(false)
+	assert.ErrorIs(t, err, wal.ErrCorruptEntry)
+}
+
+func TestWAL_BlobAfterClose(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_BlobAfterClose"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithBlobThreshold(16))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.Close())
+
+	// A rejected write doesn't store its blob.
+	assert.ErrorIs(t, walog.WriteEntry(bytes.Repeat([]byte("blob "), 10)), wal.ErrClosed)
+	blobs, err := filepath.Glob(filepath.Join(dirPath, "blobs", "*"))
+	assert.NoError(t, err)
+	assert.Empty(t, blobs)
+}
+
+func TestWAL_ConcurrentSameBlob(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ConcurrentSameBlob"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithBlobThreshold(16))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	// Writers of the same payload share its blob, without failing each other's writes.
+	large := bytes.Repeat([]byte("same payload "), 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, walog.WriteEntry(large))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, walog.Sync())
+
+	blobs, err := filepath.Glob(filepath.Join(dirPath, "blobs", "*"))
+	assert.NoError(t, err)
+	assert.Len(t, blobs, 1)
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 160)
+	for _, entry := range entries {
+		assert.True(t, bytes.Equal(large, entry.GetData()), "Entry %d doesn't match", entry.GetLogSequenceNumber())
+	}
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_LastCheckpoint(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_LastCheckpoint"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+
+	_, _, err = walog.LastCheckpoint()
+	assert.ErrorIs(t, err, wal.ErrNoCheckpoint)
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint1")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint2")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+
+	lsn, data, err := walog.LastCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), lsn)
+	assert.Equal(t, []byte("checkpoint2"), data)
+
+	assert.NoError(t, walog.Close(), "Failed to close WAL")
+
+	// The checkpoint must be available after reopening, without scanning the log.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+
+	lsn, data, err = walog.LastCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), lsn)
+	assert.Equal(t, []byte("checkpoint2"), data)
+}
+
+func TestWAL_CheckpointRetention(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_CheckpointRetention"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithCheckpointRetention(2))
+	assert.NoError(t, err, "Failed to create WAL")
+
+	assert.Empty(t, walog.Checkpoints())
+
+	for _, checkpoint := range []string{"checkpoint1", "checkpoint2", "checkpoint3"} {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+		assert.NoError(t, walog.CreateCheckpoint([]byte(checkpoint)))
+	}
+	assert.NoError(t, walog.Close(), "Failed to close WAL")
+
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithCheckpointRetention(2))
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+
+	// Only the two most recent checkpoints are kept, newest first.
+	checkpoints := walog.Checkpoints()
+	assert.Equal(t, []wal.CheckpointInfo{
+		{LogSequenceNumber: 6, Data: []byte("checkpoint3")},
+		{LogSequenceNumber: 4, Data: []byte("checkpoint2")},
+	}, checkpoints)
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_ChecksumDefaults(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ChecksumDefaults"
+	defer os.RemoveAll(dirPath)
+
+	// New WALs use CRC-32C.
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Sync())
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(wal.ChecksumCastagnoli), entries[0].GetChecksum())
+	assert.NoError(t, walog.Close())
+
+	// Reopened WALs keep the checksum of their current segment.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to reopen WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Sync())
+	entries, err = walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(wal.ChecksumCastagnoli), entries[1].GetChecksum())
+	assert.NoError(t, walog.Close())
+}
+
+// WALs written with the IEEE checksum keep using it, unless another checksum is set, which applies from the
+// next segment on, and segments with either checksum are read and verified alike.
+func TestWAL_ChecksumMixed(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ChecksumMixed"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithChecksum(wal.ChecksumIEEE))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Close())
+
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to reopen WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Close())
+
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithChecksum(wal.ChecksumCastagnoli))
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry4")))
+	assert.NoError(t, walog.Sync())
+
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+	var checksums []uint32
+	for _, entry := range entries {
+		checksums = append(checksums, entry.GetChecksum())
+	}
+	assert.Equal(t, []uint32{uint32(wal.ChecksumIEEE), uint32(wal.ChecksumIEEE), uint32(wal.ChecksumIEEE), uint32(wal.ChecksumCastagnoli)}, checksums)
+
+	report, err := wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.False(t, report.Corrupt)
+	if assert.Len(t, report.Segments, 2) {
+		assert.Equal(t, wal.ChecksumIEEE, report.Segments[0].Checksum)
+		assert.Equal(t, wal.ChecksumCastagnoli, report.Segments[1].Checksum)
+	}
+}
+
+// Corrupted CRC-32C entries are detected like IEEE ones.
+func TestWAL_ChecksumCastagnoliCorruption(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ChecksumCastagnoliCorruption"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Close())
+
+	segmentPath := filepath.Join(dirPath, "segment-0")
+	data, err := os.ReadFile(segmentPath)
+	assert.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	assert.NoError(t, os.WriteFile(segmentPath, data, 0644))
+
+	report, err := wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.True(t, report.Corrupt)
+}
+
+// Segments written before segment headers existed are read, and the WAL keeps writing them without a
+// header, so that the versions that wrote them can still read them.
+func TestWAL_ChecksumHeaderlessSegment(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ChecksumHeaderlessSegment"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithChecksum(wal.ChecksumIEEE))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Close())
+
+	segmentPath := filepath.Join(dirPath, "segment-0")
+	data, err := os.ReadFile(segmentPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(segmentPath, data[segmentHeaderSize:], 0644))
+
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.Sync())
+
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, []byte("entry3"), entries[2].GetData())
+	}
+	data, err = os.ReadFile(filepath.Join(dirPath, "segment-1"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, "WAL", string(data[:3]), "The new segment should have no header")
+}
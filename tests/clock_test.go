@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a manually driven wal.Clock. Timers only fire when Fire is called.
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) wal.Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	timer := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Advance moves the clock forward without firing any timers.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Fire fires every timer created by the clock.
+func (c *fakeClock) Fire() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, timer := range c.timers {
+		select {
+		case timer.ch <- c.now:
+		default:
+		}
+	}
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	ch     chan time.Time
+	resets []time.Duration // guarded by clock.lock
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+func (t *fakeTimer) Stop() bool          { return true }
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	t.resets = append(t.resets, d)
+	return true
+}
+
+// Resets returns the durations the timer was reset to.
+func (t *fakeTimer) Resets() []time.Duration {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	return append([]time.Duration{}, t.resets...)
+}
+
+// Verifies that the periodic sync is driven by the injected clock:
+// buffered entries only reach the segment file once the fake timer fires.
+func TestWAL_InjectedClockDrivesSync(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_InjectedClockDrivesSync"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, false, maxFileSize, maxSegments, wal.WithClock(clock))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")), "Failed to write entry")
+
+	segmentPath := filepath.Join(dirPath, "segment-0")
+	info, err := os.Stat(segmentPath)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size(), "Entry should still be buffered")
+
+	clock.Fire()
+
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(segmentPath)
+		return err == nil && info.Size() > 0
+	}, time.Second, time.Millisecond, "Entry was not synced after the timer fired")
+}
+
+// Verifies that periodic syncs keep a fixed rate: explicit syncs don't postpone them, and the jitter
+// of a tick doesn't carry over to the next one.
+func TestWAL_SyncTicker(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_SyncTicker"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, false, maxFileSize, maxSegments, wal.WithClock(clock),
+		wal.WithSyncInterval(time.Second), wal.WithSyncJitter(100*time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	timer := clock.timers[0]
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Sync())
+	assert.Empty(t, timer.Resets(), "An explicit sync must not reset the timer")
+
+	// The tick is handled late, the next one is still a second after the first.
+	clock.Advance(1500 * time.Millisecond)
+	clock.Fire()
+	assert.Eventually(t, func() bool { return len(timer.Resets()) == 1 }, time.Second, time.Millisecond)
+	next := timer.Resets()[0]
+	assert.GreaterOrEqual(t, next, 500*time.Millisecond)
+	assert.Less(t, next, 600*time.Millisecond)
+
+	// A new interval takes effect right away.
+	assert.NoError(t, walog.ReloadConfig(wal.Config{SyncInterval: 5 * time.Second}))
+	assert.Eventually(t, func() bool { return len(timer.Resets()) == 2 }, time.Second, time.Millisecond)
+	next = timer.Resets()[1]
+	assert.GreaterOrEqual(t, next, 5*time.Second)
+	assert.Less(t, next, 5100*time.Millisecond)
+}
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// Closes the WAL while writers are running concurrently. Every write must either succeed
+// and be durable after the close, or be rejected with ErrClosed.
+func TestWAL_CloseContextDrainsWriters(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_CloseContextDrainsWriters"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+
+	var succeeded atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				err := walog.WriteEntry([]byte(fmt.Sprintf("writer-%d-%d", writer, j)))
+				if err != nil {
+					assert.ErrorIs(t, err, wal.ErrClosed)
+					return
+				}
+				succeeded.Add(1)
+			}
+		}(i)
+	}
+
+	// Let the writers make some progress before closing.
+	assert.Eventually(t, func() bool { return succeeded.Load() >= 100 }, 5*time.Second, time.Millisecond)
+	assert.NoError(t, walog.CloseContext(context.Background()), "Failed to close WAL")
+	wg.Wait()
+
+	assert.ErrorIs(t, walog.WriteEntry([]byte("late")), wal.ErrClosed)
+	_, err = walog.Compact()
+	assert.ErrorIs(t, err, wal.ErrClosed)
+	assert.ErrorIs(t, walog.Close(), wal.ErrClosed)
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err, "Failed to recover entries")
+	assert.Equal(t, int(succeeded.Load()), len(entries), "Every acknowledged write should be durable")
+}
@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_TruncateBefore(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_TruncateBefore"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithAdminJournal())
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	// Segments 0 to 2 hold sequence numbers 1-2, 3-4 and 5-6.
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+		assert.NoError(t, walog.Rotate())
+	}
+	assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	assert.NoError(t, walog.Sync())
+
+	deleted, err := walog.TruncateBefore(4)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = os.Stat(filepath.Join(dirPath, "segment-0"))
+	assert.True(t, os.IsNotExist(err))
+
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), entries[0].GetLogSequenceNumber())
+
+	// The current segment is kept even if all its entries are before lsn.
+	deleted, err = walog.TruncateBefore(100)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	entries, err = walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, uint64(7), entries[0].GetLogSequenceNumber())
+
+	records, err := walog.AdminJournal()
+	assert.NoError(t, err)
+	var truncations int
+	for _, record := range records {
+		if record.Operation == wal.AdminOpTruncateBefore {
+			truncations++
+		}
+	}
+	assert.Equal(t, 2, truncations)
+}
+
+func TestWAL_TruncateAfter(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_TruncateAfter"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	// Segments 0 to 2 hold sequence numbers 1-2, 3-4 (a checkpoint) and 5-6, entry 7 is buffered.
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint4")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry5")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry6")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry7")))
+
+	deleted, err := walog.TruncateAfter(3)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, deleted)
+	_, err = os.Stat(filepath.Join(dirPath, "segment-2"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, uint64(3), walog.Stats().LastSequenceNumber)
+	_, _, err = walog.LastCheckpoint()
+	assert.ErrorIs(t, err, wal.ErrNoCheckpoint)
+
+	// Writes continue after lsn, in the segment that contained it.
+	assert.NoError(t, walog.WriteEntry([]byte("entry4")))
+	assert.NoError(t, walog.Sync())
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	var data []string
+	for _, entry := range entries {
+		data = append(data, string(entry.GetData()))
+	}
+	assert.Equal(t, []string{"entry1", "entry2", "entry3", "entry4"}, data)
+	assert.Equal(t, uint64(4), entries[3].GetLogSequenceNumber())
+
+	// Truncating everything keeps an empty segment to write to.
+	deleted, err = walog.TruncateAfter(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, deleted)
+	assert.Zero(t, walog.Stats().LastSequenceNumber)
+	assert.NoError(t, walog.WriteEntryOpts([]byte("entry10"), wal.WithSequenceNumber(10)))
+	assert.NoError(t, walog.Sync())
+	entries, err = walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, uint64(10), entries[0].GetLogSequenceNumber())
+	}
+}
+
+func TestWAL_Compact(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Compact"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntryOpts([]byte("a1"), wal.WithKey([]byte("a"))))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("b1"), wal.WithKey([]byte("b"))))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("a1-other"), wal.WithKey([]byte("a")), wal.WithStream("other")))
+	assert.NoError(t, walog.WriteEntry([]byte("unkeyed")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntryOpts([]byte("a2"), wal.WithKey([]byte("a"))))
+	assert.NoError(t, walog.Rotate())
+	// Buffered in the current segment, which is never rewritten.
+	assert.NoError(t, walog.WriteEntryOpts([]byte("b2"), wal.WithKey([]byte("b"))))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("b3"), wal.WithKey([]byte("b"))))
+
+	dropped, err := walog.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dropped)
+
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	var data []string
+	var sequenceNumbers []uint64
+	for _, entry := range entries {
+		data = append(data, string(entry.GetData()))
+		sequenceNumbers = append(sequenceNumbers, entry.GetLogSequenceNumber())
+	}
+	assert.Equal(t, []string{"a1-other", "unkeyed", "a2", "b2", "b3"}, data)
+	assert.Equal(t, []uint64{3, 4, 5, 6, 7}, sequenceNumbers)
+
+	dropped, err = walog.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, dropped)
+}
+
+func TestWAL_CompactTombstones(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_CompactTombstones"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntryOpts([]byte("a1"), wal.WithKey([]byte("a"))))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("b1"), wal.WithKey([]byte("b"))))
+	assert.NoError(t, walog.Rotate())
+	lsn, err := walog.WriteTombstone([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), lsn)
+	_, err = walog.WriteTombstone([]byte("b"))
+	assert.NoError(t, err)
+	assert.NoError(t, walog.Rotate())
+	// The key is set again after its tombstone, which is superseded.
+	assert.NoError(t, walog.WriteEntryOpts([]byte("b2"), wal.WithKey([]byte("b"))))
+	_, err = walog.WriteTombstone(nil)
+	assert.Error(t, err)
+
+	// Readers see the tombstones.
+	assert.NoError(t, walog.Flush())
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+	assert.True(t, entries[2].GetTombstone())
+	assert.Equal(t, []byte("a"), entries[2].GetKey())
+
+	// A consumer that hasn't read the tombstone yet keeps it, but not the versions it deletes.
+	assert.NoError(t, walog.CommitOffset("indexer", 2))
+	dropped, err := walog.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, dropped)
+	entries, err = walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.True(t, entries[0].GetTombstone())
+	assert.Equal(t, uint64(3), entries[0].GetLogSequenceNumber())
+
+	// Once it is read, the tombstone is dropped too.
+	assert.NoError(t, walog.CommitOffset("indexer", 5))
+	dropped, err = walog.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dropped)
+	entries, err = walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []byte("b2"), entries[0].GetData())
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_ReloadConfig(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ReloadConfig"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.ReloadConfig(wal.Config{SyncInterval: time.Second, MaxSegments: 10}))
+
+	cfg := walog.Config()
+	assert.Equal(t, time.Second, cfg.SyncInterval)
+	assert.Equal(t, 10, cfg.MaxSegments)
+	assert.Equal(t, int64(maxFileSize), cfg.MaxFileSize, "Zero values should leave settings unchanged")
+	assert.True(t, *cfg.EnableFsync)
+
+	assert.Error(t, walog.ReloadConfig(wal.Config{MaxSegments: -1}))
+}
+
+func TestWAL_WatchConfigFile(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_WatchConfigFile"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	configPath := filepath.Join(dirPath, "config.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{"sync_interval": "1s", "enable_fsync": false, "max_segments": 7}`), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go walog.WatchConfigFile(ctx, configPath, time.Second)
+
+	assert.Eventually(t, func() bool {
+		clock.Fire()
+		return walog.Config().MaxSegments == 7
+	}, time.Second, time.Millisecond, "Config file was not reloaded")
+
+	cfg := walog.Config()
+	assert.Equal(t, time.Second, cfg.SyncInterval)
+	assert.False(t, *cfg.EnableFsync)
+}
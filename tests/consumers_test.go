@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_ConsumerOffsets(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ConsumerOffsets"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err, "Failed to create WAL")
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, walog.WriteEntryOpts([]byte("entry"), wal.WithStream("orders")))
+	}
+
+	assert.Equal(t, uint64(0), walog.ConsumerOffset("indexer"))
+	assert.Error(t, walog.CommitOffset("indexer", 6), "Committing an offset beyond the log should fail")
+	assert.Error(t, walog.CommitOffset("", 1))
+	assert.NoError(t, walog.CommitOffset("indexer", 3))
+	assert.NoError(t, walog.CommitOffset("mailer", 5))
+	assert.Equal(t, uint64(3), walog.ConsumerOffset("indexer"))
+
+	stats := walog.Stats()
+	assert.Equal(t, wal.StreamStats{EntriesWritten: 5, BytesWritten: stats.BytesWritten - segmentHeaderSize}, stats.Streams["orders"])
+	assert.Equal(t, wal.ConsumerStats{Offset: 3, Lag: 2}, stats.Consumers["indexer"])
+	assert.Equal(t, wal.ConsumerStats{Offset: 5, Lag: 0}, stats.Consumers["mailer"])
+
+	assert.NoError(t, walog.Close())
+
+	// Offsets survive a restart, and the side-file is not an unknown file.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+
+	assert.Equal(t, uint64(3), walog.ConsumerOffset("indexer"))
+	assert.NoError(t, walog.DeleteConsumer("mailer"))
+	assert.Equal(t, uint64(0), walog.ConsumerOffset("mailer"))
+	assert.NotContains(t, walog.Stats().Consumers, "mailer")
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// appendToSegment appends raw bytes to the given segment file.
+func appendToSegment(t *testing.T, path string, data []byte) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = file.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+}
+
+func TestWAL_CorruptionCounters(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_CorruptionCounters"
+	defer os.RemoveAll(dirPath)
+
+	var events []wal.CorruptionEvent
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithHooks(wal.Hooks{
+		OnCorruptionDetected: func(event wal.CorruptionEvent) { events = append(events, event) },
+	}))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Sync())
+	segmentPath := filepath.Join(dirPath, "segment-0")
+	info, err := os.Stat(segmentPath)
+	assert.NoError(t, err)
+	validSize := info.Size()
+
+	// A partially written entry at the end of the log.
+	appendToSegment(t, segmentPath, []byte{0x10, 0x00})
+	_, err = walog.ReadAll(false)
+	assert.Error(t, err)
+
+	// An entry whose payload is not a valid protobuf message.
+	assert.NoError(t, os.Truncate(segmentPath, validSize))
+	invalid := []byte{0x12, 0x05, 0x01}
+	frame := binary.LittleEndian.AppendUint32(nil, uint32(len(invalid)))
+	appendToSegment(t, segmentPath, append(frame, invalid...))
+	_, err = walog.ReadAll(false)
+	assert.ErrorIs(t, err, wal.ErrInvalidEntry)
+
+	// An entry whose CRC doesn't match.
+	assert.NoError(t, os.Truncate(segmentPath, validSize))
+	content, err := os.ReadFile(segmentPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(segmentPath, bytes.Replace(content, []byte("entry1"), []byte("entrX1"), 1), 0644))
+	_, err = walog.ReadAll(false)
+	assert.ErrorIs(t, err, wal.ErrCorruptEntry)
+
+	stats := walog.Stats()
+	assert.Equal(t, uint64(3), stats.CorruptionEvents)
+	assert.Equal(t, uint64(1), stats.Truncations)
+	assert.Equal(t, uint64(1), stats.UnmarshalFailures)
+	assert.Equal(t, uint64(1), stats.ChecksumFailures)
+
+	assert.Len(t, events, 3)
+	assert.Equal(t, []wal.CorruptionKind{wal.CorruptionTruncated, wal.CorruptionInvalidEntry, wal.CorruptionChecksum},
+		[]wal.CorruptionKind{events[0].Kind, events[1].Kind, events[2].Kind})
+	assert.Equal(t, validSize, events[0].Offset)
+	assert.Equal(t, validSize, events[1].Offset)
+	assert.Equal(t, int64(segmentHeaderSize), events[2].Offset)
+	for _, event := range events {
+		assert.Equal(t, "read", event.Operation)
+		assert.Equal(t, segmentPath, event.Path)
+	}
+}
@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_DebugState(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_DebugState"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, 64, 5)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("0123456789abcdef0123456789abcdef")))
+	}
+	assert.NoError(t, walog.Sync())
+
+	state := walog.DebugState()
+	assert.Equal(t, uint64(4), state.LastSequenceNumber)
+	assert.Equal(t, state.CurrentSegmentIndex+1, len(state.Segments))
+
+	// The segments must cover the LSN range without gaps.
+	nextSequenceNo := uint64(1)
+	for _, segment := range state.Segments {
+		assert.Empty(t, segment.Error)
+		if segment.Entries == 0 {
+			continue
+		}
+		assert.Equal(t, nextSequenceNo, segment.FirstSequenceNumber)
+		nextSequenceNo = segment.LastSequenceNumber + 1
+	}
+	assert.Equal(t, uint64(5), nextSequenceNo)
+
+	assert.Contains(t, state.String(), "last sequence number: 4")
+}
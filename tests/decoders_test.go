@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeEntry(t *testing.T) {
+	t.Parallel()
+
+	wal.RegisterDecoder("TestDecodeEntry.upper", wal.DecoderFunc(func(entry *wal.WAL_Entry) (string, error) {
+		return strings.ToUpper(string(entry.GetData())), nil
+	}))
+	wal.RegisterDecoder("TestDecodeEntry.failing", wal.DecoderFunc(func(entry *wal.WAL_Entry) (string, error) {
+		return "", errors.New("unknown version")
+	}))
+
+	text, ok, err := wal.DecodeEntry(&wal.WAL_Entry{Stream: "TestDecodeEntry.upper", Data: []byte("order")})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "ORDER", text)
+
+	_, ok, err = wal.DecodeEntry(&wal.WAL_Entry{Stream: "TestDecodeEntry.failing", Data: []byte("order")})
+	assert.True(t, ok)
+	assert.EqualError(t, err, "unknown version")
+
+	_, ok, err = wal.DecodeEntry(&wal.WAL_Entry{Stream: "TestDecodeEntry.unregistered", Data: []byte("order")})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+// Entries are read alike whatever their encoding, including in a WAL whose encoding changed, which applies
+// from the next segment on.
+func TestWAL_Encodings(t *testing.T) {
+	t.Parallel()
+	for _, encoding := range []wal.Encoding{wal.EncodingBinary, wal.EncodingJSON, wal.EncodingFlatBuffers, wal.EncodingCapnProto} {
+		t.Run(encoding.String(), func(t *testing.T) {
+			t.Parallel()
+			dirPath := "TestWAL_Encodings_" + encoding.String()
+			defer os.RemoveAll(dirPath)
+
+			walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithEncoding(encoding))
+			assert.NoError(t, err, "Failed to create WAL")
+			assert.NoError(t, walog.WriteEntryOpts([]byte("order"), wal.WithStream("orders"), wal.WithKey([]byte("k1")),
+				wal.WithTimestamp(time.Unix(1700000000, 0)), wal.WithMetadata([]byte{0, 1}), wal.WithSchema("order", 2),
+				wal.WithLabels(map[string]string{"tenant": "a", "region": "eu"})))
+			assert.NoError(t, walog.WriteEntry(nil))
+			_, err = walog.WriteTombstone([]byte("k1"), wal.WithStream("orders"))
+			assert.NoError(t, err)
+			assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+			assert.NoError(t, walog.Close())
+
+			walog, err = wal.OpenWAL(dirPath, true, maxFileSize, 10)
+			assert.NoError(t, err, "Failed to reopen WAL")
+			assert.NoError(t, walog.Rotate())
+			assert.NoError(t, walog.WriteEntry([]byte("protobuf")))
+			assert.NoError(t, walog.Sync())
+			entries, err := walog.ReadAllFromOffset(-1, false)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 5)
+			assert.Equal(t, "orders", entries[0].GetStream())
+			assert.Equal(t, map[string]string{"tenant": "a", "region": "eu"}, entries[0].GetLabels())
+			assert.Equal(t, []byte{0, 1}, entries[0].GetMetadata())
+			assert.Equal(t, "order", entries[0].GetSchema())
+			assert.Equal(t, uint32(2), entries[0].GetSchemaVersion())
+			assert.Equal(t, time.Unix(1700000000, 0), entries[0].Time())
+			assert.Empty(t, entries[1].GetData())
+			assert.True(t, entries[2].GetTombstone())
+			assert.True(t, entries[3].GetIsCheckpoint())
+			assert.Equal(t, []byte("protobuf"), entries[4].GetData())
+			assert.NoError(t, walog.Close())
+
+			// Tail, Verify and the segments read back the same entries.
+			var tailed []*wal.WAL_Entry
+			assert.NoError(t, wal.TailDir(context.Background(), dirPath, 0, false, func(entry *wal.WAL_Entry) error {
+				tailed = append(tailed, entry)
+				return nil
+			}))
+			assert.Len(t, tailed, len(entries))
+			for i := range entries {
+				assert.True(t, proto.Equal(entries[i], tailed[i]), "entry %d: %v", i, tailed[i])
+			}
+			report, err := wal.Verify(dirPath)
+			assert.NoError(t, err)
+			assert.False(t, report.Corrupt)
+			if assert.Len(t, report.Segments, 2) {
+				assert.Equal(t, encoding, report.Segments[0].Encoding)
+				assert.Equal(t, wal.EncodingProtobuf, report.Segments[1].Encoding)
+			}
+		})
+	}
+}
+
+func TestWAL_EncodingJSONReadable(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_EncodingJSONReadable"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithEncoding(wal.EncodingJSON))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntryOpts([]byte("order"), wal.WithStream("orders")))
+	assert.NoError(t, walog.Close())
+
+	data, err := os.ReadFile(filepath.Join(dirPath, "segment-0"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `{"lsn":1,`)
+	assert.Contains(t, string(data), `"stream":"orders"`)
+
+	// The segment keeps its encoding when the WAL is reopened with another one.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to reopen WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("order2")))
+	assert.NoError(t, walog.Close())
+	data, err = os.ReadFile(filepath.Join(dirPath, "segment-0"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `{"lsn":2,`)
+
+	_, err = wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithEncoding(wal.Encoding(42)))
+	assert.ErrorContains(t, err, "unknown encoding")
+}
+
+// Strings that aren't valid UTF-8 are rejected, as JSON can't represent them.
+func TestWAL_EncodingInvalidUTF8(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_EncodingInvalidUTF8"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithEncoding(wal.EncodingJSON))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	assert.ErrorIs(t, walog.WriteEntryOpts([]byte("order"), wal.WithStream("orders\xff")), wal.ErrInvalidUTF8)
+	assert.ErrorIs(t, walog.WriteEntryOpts([]byte("order"), wal.WithLabels(map[string]string{"tenant": "\xff"})), wal.ErrInvalidUTF8)
+	assert.ErrorIs(t, walog.WriteEntryOpts([]byte("order"), wal.WithSchema("\xfforder", 1)), wal.ErrInvalidUTF8)
+
+	lsn, err := walog.AppendEntry([]byte("order"), wal.WithStream("orders"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), lsn, "Rejected entries should not consume a sequence number")
+	assert.NoError(t, walog.Sync())
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestTail_ReadViews(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTail_ReadViews"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("protobuf")))
+	assert.NoError(t, walog.Close())
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithEncoding(wal.EncodingFlatBuffers))
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntryOpts([]byte("flat"), wal.WithKey([]byte("k1")),
+		wal.WithLabels(map[string]string{"tenant": "a", "region": "eu"})))
+	assert.NoError(t, walog.CreateCheckpoint(nil))
+
+	tail, err := walog.Tail(2)
+	assert.NoError(t, err)
+	defer tail.Stop()
+	var views []*wal.WAL_Entry
+	assert.NoError(t, tail.ReadViews(func(view wal.EntryView) error {
+		switch view.LogSequenceNumber() {
+		case 2:
+			assert.Equal(t, []byte("flat"), view.Data())
+			assert.Equal(t, []byte("k1"), view.Key())
+			region, ok := view.Label("region")
+			assert.True(t, ok)
+			assert.Equal(t, "eu", region)
+			_, ok = view.Label("zone")
+			assert.False(t, ok)
+			assert.False(t, view.IsCheckpoint())
+		case 3:
+			assert.True(t, view.IsCheckpoint())
+		}
+		views = append(views, view.Entry())
+		return nil
+	}))
+	assert.Len(t, views, 2)
+	assert.Equal(t, map[string]string{"tenant": "a", "region": "eu"}, views[0].GetLabels())
+
+	// Views of entries with other encodings are read alike.
+	tail, err = walog.Tail(0)
+	assert.NoError(t, err)
+	defer tail.Stop()
+	var data []string
+	assert.NoError(t, tail.ReadViews(func(view wal.EntryView) error {
+		data = append(data, string(view.Data()))
+		return nil
+	}))
+	assert.Equal(t, []string{"protobuf", "flat", ""}, data)
+}
+
+// Sealed segments are read in place from memory with WithMmapReads, the newest one from the file.
+func TestTail_MmapReads(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTail_MmapReads"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, 256, 10, wal.WithEncoding(wal.EncodingCapnProto))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	var expected []string
+	for i := 0; i < 20; i++ {
+		data := fmt.Sprintf("entry-%02d", i)
+		expected = append(expected, data)
+		assert.NoError(t, walog.WriteEntryOpts([]byte(data), wal.WithStream("orders"),
+			wal.WithLabels(map[string]string{"index": strconv.Itoa(i)})))
+	}
+	assert.NoError(t, walog.Sync())
+	segments, err := filepath.Glob(filepath.Join(dirPath, "segment-*"))
+	assert.NoError(t, err)
+	assert.Greater(t, len(segments), 2)
+
+	tail, err := wal.NewTail(dirPath, 3, wal.WithMmapReads())
+	assert.NoError(t, err)
+	defer tail.Stop()
+	var data []string
+	assert.NoError(t, tail.ReadViews(func(view wal.EntryView) error {
+		assert.Equal(t, "orders", view.Stream())
+		index, ok := view.Label("index")
+		assert.True(t, ok)
+		assert.Equal(t, strconv.Itoa(int(view.LogSequenceNumber())-1), index)
+		data = append(data, string(view.Data()))
+		return nil
+	}))
+	assert.Equal(t, expected[2:], data)
+
+	// Entries written since are read on the next call.
+	assert.NoError(t, walog.WriteEntry([]byte("entry-20")))
+	assert.NoError(t, walog.Sync())
+	var entries []*wal.WAL_Entry
+	assert.NoError(t, tail.Read(func(entry *wal.WAL_Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []byte("entry-20"), entries[0].GetData())
+}
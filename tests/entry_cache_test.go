@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_EntryCache(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_EntryCache"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithEntryCache(4))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 1; i <= 10; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry %d", i))))
+	}
+
+	entries, err := walog.ReadRange(3, 6, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+	assert.Equal(t, []byte("entry 3"), entries[0].GetData())
+	assert.Equal(t, uint64(6), entries[3].GetLogSequenceNumber())
+	assert.Equal(t, wal.EntryCacheStats{Entries: 4, Capacity: 4, Misses: 4}, *walog.Stats().EntryCache)
+
+	// The cached entries are returned again without reading them.
+	entry, err := walog.GetEntry(5)
+	assert.NoError(t, err)
+	assert.Same(t, entries[2], entry)
+	entries, err = walog.ReadRange(4, 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{4, 5}, []uint64{entries[0].GetLogSequenceNumber(), entries[1].GetLogSequenceNumber()})
+	assert.Equal(t, uint64(3), walog.Stats().EntryCache.Hits)
+
+	// A range is read from the segment files past the cached entries, evicting the least recently used.
+	entries, err = walog.ReadRange(5, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 6)
+	assert.Equal(t, []byte("entry 10"), entries[5].GetData())
+	assert.Equal(t, 4, walog.Stats().EntryCache.Entries)
+
+	_, err = walog.GetEntry(11)
+	assert.ErrorIs(t, err, wal.ErrEntryNotFound)
+
+	// Rewritten sequence numbers aren't served from the cache.
+	_, err = walog.TruncateAfter(8)
+	assert.NoError(t, err)
+	assert.NoError(t, walog.WriteEntry([]byte("rewritten")))
+	entry, err = walog.GetEntry(9)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("rewritten"), entry.GetData())
+}
+
+func TestWAL_ReadRangeWithoutCache(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ReadRangeWithoutCache"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry %d", i))))
+	}
+
+	entries, err := walog.ReadRange(2, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	entry, err := walog.GetEntry(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("entry 1"), entry.GetData())
+	assert.Nil(t, walog.Stats().EntryCache)
+}
+
+func TestWAL_EntryCacheEvictsDeletedSegments(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_EntryCacheEvictsDeletedSegments"
+	defer os.RemoveAll(dirPath)
+
+	// A few entries fill a segment.
+	walog, err := wal.OpenWAL(dirPath, true, 64, 3, wal.WithEntryCache(100))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 1; i <= 8; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry %d", i))))
+	}
+	entries, err := walog.ReadRange(1, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 8)
+
+	// The entries of the segment deleted by TruncateBefore aren't returned anymore.
+	deleted, err := walog.TruncateBefore(8)
+	assert.NoError(t, err)
+	assert.Greater(t, deleted, 0)
+	_, err = walog.GetEntry(1)
+	assert.ErrorIs(t, err, wal.ErrEntryNotFound)
+
+	// Nor the entries of the segments deleted because of the segment limit, while the others stay cached.
+	for i := 9; i <= 30; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry %d", i))))
+	}
+	assert.NoError(t, walog.Sync())
+	entries, err = walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	first := entries[0].GetLogSequenceNumber()
+	assert.Greater(t, first, uint64(8))
+	for lsn := uint64(1); lsn < first; lsn++ {
+		_, err = walog.GetEntry(lsn)
+		assert.ErrorIs(t, err, wal.ErrEntryNotFound)
+	}
+	_, err = walog.ReadRange(first, 0, 0)
+	assert.NoError(t, err)
+	hits := walog.Stats().EntryCache.Hits
+	_, err = walog.GetEntry(30)
+	assert.NoError(t, err)
+	assert.Equal(t, hits+1, walog.Stats().EntryCache.Hits)
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// The fast path codec is interchangeable with proto.Marshal and proto.Unmarshal.
+func TestEntryCodec_CompatibleWithProto(t *testing.T) {
+	t.Parallel()
+	isCheckpoint := false
+	entries := []*wal.WAL_Entry{
+		{},
+		{LogSequenceNumber: 1, Data: []byte("data"), CRC: 42},
+		{LogSequenceNumber: 1 << 40, IsCheckpoint: &isCheckpoint},
+		{
+			LogSequenceNumber: 7,
+			Data:              []byte("data"),
+			CRC:               0xffffffff,
+			Metadata:          []byte("metadata"),
+			Labels:            map[string]string{"a": "1", "b": "", "": "empty key"},
+			Stream:            "orders",
+			Key:               []byte("key"),
+			Timestamp:         time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(),
+			Hlc:               uint64(wal.NewHLC(time.Now(), 3)),
+			Checksum:          uint32(wal.ChecksumCastagnoli),
+			Tombstone:         true,
+			Schema:            "orders.Order",
+			SchemaVersion:     3,
+			Blob:              bytes.Repeat([]byte{0xab}, 32),
+			ValuePointer:      []byte{1, 2, 3, 0, 0, 0, 0},
+		},
+	}
+
+	for _, entry := range entries {
+		data, err := entry.MarshalVT()
+		assert.NoError(t, err)
+		assert.Len(t, data, entry.SizeVT())
+		assert.Equal(t, proto.Size(entry), entry.SizeVT())
+
+		var decoded wal.WAL_Entry
+		assert.NoError(t, proto.Unmarshal(data, &decoded))
+		assert.True(t, proto.Equal(entry, &decoded), "proto.Unmarshal of MarshalVT: %v", &decoded)
+
+		data, err = proto.Marshal(entry)
+		assert.NoError(t, err)
+		decoded = wal.WAL_Entry{}
+		assert.NoError(t, decoded.UnmarshalVT(data))
+		assert.True(t, proto.Equal(entry, &decoded), "UnmarshalVT of proto.Marshal: %v", &decoded)
+	}
+}
+
+// Fields unknown to this version, e.g. written by a newer one, are kept.
+func TestEntryCodec_UnknownFields(t *testing.T) {
+	t.Parallel()
+	data := wal.MustMarshal(&wal.WAL_Entry{LogSequenceNumber: 1, Data: []byte("data")})
+	data = protowire.AppendTag(data, 99, protowire.BytesType)
+	data = protowire.AppendString(data, "from the future")
+	data = protowire.AppendTag(data, 100, protowire.Fixed32Type)
+	data = protowire.AppendFixed32(data, 42)
+	data = protowire.AppendTag(data, 101, protowire.Fixed64Type)
+	data = protowire.AppendFixed64(data, 42)
+	data = protowire.AppendTag(data, 102, protowire.StartGroupType)
+	data = protowire.AppendTag(data, 1, protowire.VarintType)
+	data = protowire.AppendVarint(data, 42)
+	data = protowire.AppendTag(data, 102, protowire.EndGroupType)
+
+	var entry wal.WAL_Entry
+	assert.NoError(t, entry.UnmarshalVT(data))
+	assert.Equal(t, []byte("data"), entry.GetData())
+	remarshaled, err := entry.MarshalVT()
+	assert.NoError(t, err)
+	assert.Equal(t, data, remarshaled)
+
+	// Malformed data is rejected.
+	assert.Error(t, entry.UnmarshalVT(data[:len(data)-1]))
+	assert.Error(t, entry.UnmarshalVT(protowire.AppendTag(nil, 2, protowire.VarintType)))
+	assert.Error(t, entry.UnmarshalVT(protowire.AppendTag(nil, 102, protowire.StartGroupType)))
+	assert.Error(t, entry.UnmarshalVT(protowire.AppendTag(nil, 102, protowire.EndGroupType)))
+	assert.Error(t, entry.UnmarshalVT([]byte{0x01}), "Field number 0 is invalid")
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeEvents decodes the events written by a slog JSON handler.
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var events []map[string]any
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var event map[string]any
+		assert.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	buf.Reset()
+	return events
+}
+
+func eventMessages(events []map[string]any) []string {
+	var messages []string
+	for _, event := range events {
+		messages = append(messages, event["msg"].(string))
+	}
+	return messages
+}
+
+func TestWAL_EventLogger(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_EventLogger"
+	defer os.RemoveAll(dirPath)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	walog, err := wal.OpenWAL(dirPath, true, 64, 2, wal.WithEventLogger(logger))
+	assert.NoError(t, err, "Failed to create WAL")
+
+	events := decodeEvents(t, &buf)
+	assert.Equal(t, []string{wal.EventOpened}, eventMessages(events))
+	assert.Equal(t, true, events[0]["created"])
+	assert.Equal(t, dirPath, events[0]["directory"])
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")))
+	}
+	events = decodeEvents(t, &buf)
+	assert.Equal(t, []string{wal.EventSegmentCreated, wal.EventSegmentDeleted, wal.EventSegmentCreated},
+		eventMessages(events))
+	assert.Equal(t, filepath.Join(dirPath, "segment-0"), events[1]["path"])
+	assert.Equal(t, "segment limit", events[1]["reason"])
+
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+	events = decodeEvents(t, &buf)
+	assert.Equal(t, []string{wal.EventSegmentDeleted, wal.EventSegmentCreated, wal.EventCheckpointSaved},
+		eventMessages(events))
+	assert.Equal(t, float64(4), events[2]["log_sequence_number"])
+
+	assert.NoError(t, walog.Close())
+	events = decodeEvents(t, &buf)
+	assert.Equal(t, []string{wal.EventClosed}, eventMessages(events))
+
+	// Corrupt the tail of the last segment and repair it.
+	file, err := os.OpenFile(filepath.Join(dirPath, "segment-3"), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = file.Write([]byte("random data"))
+	assert.NoError(t, err)
+	file.Close()
+
+	_, err = walog.Repair()
+	assert.NoError(t, err)
+	events = decodeEvents(t, &buf)
+	assert.Equal(t, []string{wal.EventSegmentTruncated}, eventMessages(events))
+	assert.Equal(t, "WARN", events[0]["level"])
+	assert.Equal(t, float64(1), events[0]["entries_kept"])
+}
@@ -0,0 +1,320 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// In PeriodicFlush mode the background goroutine hands data to the OS but never fsyncs,
+// while an explicit Sync still does.
+func TestWAL_PeriodicFlushMode(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_PeriodicFlushMode"
+	defer os.RemoveAll(dirPath)
+
+	fs := &faultyFS{}
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments,
+		wal.WithFS(fs), wal.WithClock(clock), wal.WithSyncMode(wal.PeriodicFlush))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	clock.Fire()
+
+	segmentPath := filepath.Join(dirPath, "segment-0")
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(segmentPath)
+		return err == nil && info.Size() > 0
+	}, time.Second, time.Millisecond, "Entry was not flushed after the timer fired")
+	assert.Equal(t, int64(0), fs.syncs.Load(), "Periodic flush should not fsync")
+
+	assert.NoError(t, walog.Sync())
+	assert.Equal(t, int64(1), fs.syncs.Load(), "Sync should fsync")
+}
+
+func TestWAL_FlushThresholdBytes(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_FlushThresholdBytes"
+	defer os.RemoveAll(dirPath)
+
+	fs := &faultyFS{}
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments,
+		wal.WithFS(fs), wal.WithClock(newFakeClock()), wal.WithFlushThresholdBytes(256))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	data := make([]byte, 100)
+	assert.NoError(t, walog.WriteEntry(data))
+	assert.Equal(t, 0, readSegmentSize(t, dirPath), "Entries are buffered below the threshold")
+
+	// The timer never fires, the buffer is flushed once it holds more than the threshold.
+	assert.NoError(t, walog.WriteEntry(data))
+	assert.NoError(t, walog.WriteEntry(data))
+	assert.Greater(t, readSegmentSize(t, dirPath), 256)
+	assert.Equal(t, 0, walog.Stats().BufferedBytes)
+	assert.Equal(t, uint64(1), walog.Stats().ThresholdFlushes)
+	assert.Equal(t, int64(0), fs.syncs.Load(), "Threshold flushes should not fsync")
+}
+
+// Entries written through the write pipeline by concurrent writers, across rotations, are all in the
+// log, in sequence order.
+func TestWAL_WritePipeline(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_WritePipeline"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, 64*1024, 100,
+		wal.WithClock(newFakeClock()), wal.WithWritePipeline(4))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	const writers, perWriter = 8, 500
+	data := make([]byte, 100)
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWriter {
+				assert.NoError(t, walog.WriteEntry(data))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, walog.Sync())
+	assert.Equal(t, 0, walog.Stats().BufferedBytes)
+	assert.Greater(t, walog.Stats().Rotations, uint64(0))
+
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, writers*perWriter)
+	for i, entry := range entries {
+		if !assert.Equal(t, uint64(i+1), entry.GetLogSequenceNumber()) {
+			break
+		}
+	}
+
+	report, err := wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.False(t, report.Corrupt)
+}
+
+func readSegmentSize(t *testing.T, dirPath string) int {
+	info, err := os.Stat(filepath.Join(dirPath, "segment-0"))
+	assert.NoError(t, err)
+	return int(info.Size())
+}
+
+func TestWAL_FlushWithoutSync(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_FlushWithoutSync"
+	defer os.RemoveAll(dirPath)
+
+	fs := &faultyFS{}
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithFS(fs), wal.WithClock(newFakeClock()))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Flush())
+	assert.Equal(t, int64(0), fs.syncs.Load(), "Flush should not fsync")
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries), "Flushed entry should be readable")
+}
+
+// A slow fsync doesn't stall writers, and the syncs issued while it is in flight share the next fsync.
+func TestWAL_SyncDoesNotBlockWriters(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_SyncDoesNotBlockWriters"
+	defer os.RemoveAll(dirPath)
+
+	var blocked atomic.Bool
+	release := make(chan struct{})
+	fs := &faultyFS{onSync: func() {
+		if blocked.Load() {
+			<-release
+		}
+	}}
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithFS(fs), wal.WithClock(newFakeClock()))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	blocked.Store(true)
+	synced := make(chan error, 1)
+	go func() { synced <- walog.Sync() }()
+	assert.Eventually(t, func() bool { return fs.syncs.Load() == 1 }, time.Second, time.Millisecond)
+
+	written := make(chan error, 1)
+	go func() { written <- walog.WriteEntry([]byte("entry2")) }()
+	select {
+	case err := <-written:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("WriteEntry was blocked by the fsync in flight")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, walog.Sync())
+		}()
+	}
+	// Let the syncs flush and wait for the fsync in flight.
+	time.Sleep(100 * time.Millisecond)
+	blocked.Store(false)
+	close(release)
+	assert.NoError(t, <-synced)
+	wg.Wait()
+	assert.Equal(t, int64(2), fs.syncs.Load(), "Syncs waiting for the fsync in flight should share the next one")
+	assert.Equal(t, uint64(2), walog.Stats().Fsyncs)
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+// writebackFS records the ranges written back, see WithWriteback.
+type writebackFS struct {
+	wal.OSFS
+	lock   sync.Mutex
+	ranges [][2]int64
+}
+
+func (fs *writebackFS) Create(name string) (wal.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (fs *writebackFS) OpenFile(name string, flag int, perm os.FileMode) (wal.File, error) {
+	file, err := fs.OSFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &writebackFile{File: file, fs: fs}, nil
+}
+
+type writebackFile struct {
+	wal.File
+	fs *writebackFS
+}
+
+func (f *writebackFile) Writeback(offset, length int64) error {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	f.fs.ranges = append(f.fs.ranges, [2]int64{offset, length})
+	return nil
+}
+
+func TestWAL_Writeback(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Writeback"
+	defer os.RemoveAll(dirPath)
+
+	fs := &writebackFS{}
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments,
+		wal.WithFS(fs), wal.WithClock(newFakeClock()), wal.WithWriteback(4096))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	data := make([]byte, 1000)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, walog.WriteEntry(data))
+		assert.NoError(t, walog.Flush())
+	}
+
+	// The flushed data is written back in consecutive ranges of at least the threshold.
+	fs.lock.Lock()
+	ranges := fs.ranges
+	fs.lock.Unlock()
+	assert.NotEmpty(t, ranges)
+	var end int64
+	for _, r := range ranges {
+		assert.Equal(t, end, r[0])
+		assert.GreaterOrEqual(t, r[1], int64(4096))
+		end = r[0] + r[1]
+	}
+	assert.LessOrEqual(t, end, int64(walog.Stats().BytesWritten))
+	assert.Equal(t, uint64(len(ranges)), walog.Stats().Writebacks)
+
+	// After a rotation, ranges start at the beginning of the new segment.
+	assert.NoError(t, walog.Rotate())
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, walog.WriteEntry(data))
+		assert.NoError(t, walog.Flush())
+	}
+	fs.lock.Lock()
+	assert.Equal(t, int64(0), fs.ranges[len(ranges)][0])
+	fs.lock.Unlock()
+}
+
+// On Linux, the files of OSFS are written back with sync_file_range.
+func TestWAL_WritebackOSFS(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS != "linux" {
+		t.Skip("writeback is only supported on Linux")
+	}
+	dirPath := "TestWAL_WritebackOSFS"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(newFakeClock()), wal.WithWriteback(4096))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, walog.WriteEntry(make([]byte, 1000)))
+		assert.NoError(t, walog.Flush())
+	}
+	assert.Greater(t, walog.Stats().Writebacks, uint64(0))
+	assert.NoError(t, walog.Sync())
+}
+
+func TestWAL_SyncedSequenceNumber(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_SyncedSequenceNumber"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Hour))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Flush())
+	assert.Zero(t, walog.SyncedSequenceNumber())
+	assert.NoError(t, walog.Sync())
+	assert.Equal(t, uint64(1), walog.SyncedSequenceNumber())
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Rotate())
+	assert.Equal(t, uint64(2), walog.SyncedSequenceNumber())
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.Close())
+
+	// The entries of the segments are durable once the WAL is opened.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer walog.Close()
+	assert.Equal(t, uint64(3), walog.SyncedSequenceNumber())
+	_, err = walog.TruncateAfter(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), walog.SyncedSequenceNumber())
+
+	// Without fsync, entries count as synced once they are flushed.
+	dirPath = "TestWAL_SyncedSequenceNumber_NoFsync"
+	defer os.RemoveAll(dirPath)
+	noFsync, err := wal.OpenWAL(dirPath, false, maxFileSize, maxSegments, wal.WithSyncInterval(time.Hour))
+	assert.NoError(t, err)
+	defer noFsync.Close()
+	assert.NoError(t, noFsync.WriteEntry([]byte("entry1")))
+	assert.NoError(t, noFsync.Flush())
+	assert.Equal(t, uint64(1), noFsync.SyncedSequenceNumber())
+}
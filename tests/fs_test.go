@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+var errInjected = errors.New("injected fsync failure")
+
+// faultyFS wraps the OS filesystem and fails fsync calls while failSync is set.
+// If onSync is set, it is called before every fsync. Reads and fsyncs are counted.
+type faultyFS struct {
+	wal.OSFS
+	failSync atomic.Bool
+	syncs    atomic.Int64
+	reads    atomic.Int64
+	onSync   func()
+}
+
+func (fs *faultyFS) Create(name string) (wal.File, error) {
+	file, err := fs.OSFS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{File: file, fs: fs}, nil
+}
+
+func (fs *faultyFS) OpenFile(name string, flag int, perm os.FileMode) (wal.File, error) {
+	file, err := fs.OSFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{File: file, fs: fs}, nil
+}
+
+type faultyFile struct {
+	wal.File
+	fs *faultyFS
+}
+
+func (f *faultyFile) Read(p []byte) (int, error) {
+	f.fs.reads.Add(1)
+	return f.File.Read(p)
+}
+
+func (f *faultyFile) Sync() error {
+	f.fs.syncs.Add(1)
+	if f.fs.onSync != nil {
+		f.fs.onSync()
+	}
+	if f.fs.failSync.Load() {
+		return errInjected
+	}
+	return f.File.Sync()
+}
+
+func TestWAL_CustomFSFaultInjection(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_CustomFSFaultInjection"
+	defer os.RemoveAll(dirPath)
+
+	fs := &faultyFS{}
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithFS(fs))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+	assert.Greater(t, fs.syncs.Load(), int64(0), "Expected fsync to go through the custom FS")
+
+	fs.failSync.Store(true)
+	err = walog.CreateCheckpoint([]byte("checkpoint"))
+	assert.ErrorIs(t, err, errInjected)
+	fs.failSync.Store(false)
+}
+
+// cacheDropFS records the files dropped from the page cache.
+type cacheDropFS struct {
+	wal.OSFS
+	lock    sync.Mutex
+	dropped []string
+}
+
+func (fs *cacheDropFS) DropCache(path string) error {
+	fs.lock.Lock()
+	fs.dropped = append(fs.dropped, filepath.Base(path))
+	fs.lock.Unlock()
+	return fs.OSFS.DropCache(path)
+}
+
+func (fs *cacheDropFS) droppedFiles() []string {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return append([]string(nil), fs.dropped...)
+}
+
+func TestWAL_DropSealedCache(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_DropSealedCache"
+	defer os.RemoveAll(dirPath)
+
+	fs := &cacheDropFS{}
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithFS(fs), wal.WithDropSealedCache())
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.Empty(t, fs.droppedFiles())
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Rotate())
+	assert.Equal(t, []string{"segment-0", "segment-1"}, fs.droppedFiles())
+
+	// The sealed segments are still readable.
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+// With shipping, sealed segments are dropped from the cache once they are shipped.
+func TestWAL_DropSealedCache_Shipping(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_DropSealedCache_Shipping"
+	targetPath := "TestWAL_DropSealedCache_Shipping_target"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(targetPath)
+
+	target, err := wal.NewDirTarget(targetPath)
+	assert.NoError(t, err)
+	fs := &cacheDropFS{}
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10,
+		wal.WithFS(fs), wal.WithClock(clock), wal.WithShipping(target, time.Minute), wal.WithDropSealedCache())
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Sync())
+	assert.Empty(t, fs.droppedFiles(), "Segments are only dropped once shipped")
+
+	clock.Fire()
+	assert.Eventually(t, func() bool {
+		stats := walog.Stats().Shipping
+		return stats != nil && stats.ShippedSequenceNumber == 2
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []string{"segment-0"}, fs.droppedFiles())
+}
+
+// Segments are scanned through a read buffer, rather than with reads of every entry.
+func TestWAL_ReadBufferSize(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ReadBufferSize"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	}
+	assert.NoError(t, walog.Close())
+
+	fs := &faultyFS{}
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithFS(fs))
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	assert.Less(t, fs.reads.Load(), int64(10), "Recovery should read the segment in a few large reads")
+
+	fs.reads.Store(0)
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1000)
+	assert.Less(t, fs.reads.Load(), int64(10), "ReadAll should read the segment in a few large reads")
+
+	// A small buffer takes more reads, for the same entries.
+	small, err := wal.OpenWAL(dirPath+"_small", true, maxFileSize, maxSegments, wal.WithFS(fs), wal.WithReadBufferSize(64))
+	assert.NoError(t, err)
+	defer os.RemoveAll(dirPath + "_small")
+	defer small.Close()
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, small.WriteEntry([]byte("entry")))
+	}
+	assert.NoError(t, small.Sync())
+	fs.reads.Store(0)
+	entries, err = small.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1000)
+	assert.Greater(t, fs.reads.Load(), int64(100))
+}
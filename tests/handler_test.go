@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func getJSON(t *testing.T, url string, v any) int {
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	return resp.StatusCode
+}
+
+func TestWAL_Handler(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Handler"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+
+	mux := http.NewServeMux()
+	mux.Handle("/wal/", http.StripPrefix("/wal", walog.Handler()))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var stats wal.Stats
+	assert.Equal(t, http.StatusOK, getJSON(t, server.URL+"/wal/stats", &stats))
+	assert.Equal(t, uint64(2), stats.LastSequenceNumber)
+
+	var segments []wal.SegmentState
+	assert.Equal(t, http.StatusOK, getJSON(t, server.URL+"/wal/segments", &segments))
+	assert.Len(t, segments, 1)
+	assert.Equal(t, uint64(2), segments[0].LastSequenceNumber)
+
+	var checkpoints []wal.CheckpointInfo
+	assert.Equal(t, http.StatusOK, getJSON(t, server.URL+"/wal/checkpoints", &checkpoints))
+	assert.Equal(t, []wal.CheckpointInfo{{LogSequenceNumber: 2, Data: []byte("checkpoint")}}, checkpoints)
+
+	var health wal.HealthStatus
+	assert.Equal(t, http.StatusOK, getJSON(t, server.URL+"/wal/health", &health))
+	assert.True(t, health.Healthy)
+
+	// Admin actions are disabled by default.
+	resp, err := http.Post(server.URL+"/wal/rotate", "", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWAL_HandlerAdminActions(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_HandlerAdminActions"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+
+	server := httptest.NewServer(walog.Handler(wal.WithAdminActions()))
+	defer server.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+
+	resp, err := http.Post(server.URL+"/rotate", "", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, walog.DebugState().CurrentSegmentIndex)
+
+	resp, err = http.Post(server.URL+"/checkpoint", "application/octet-stream", strings.NewReader("state"))
+	assert.NoError(t, err)
+	var result map[string]uint64
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	assert.Equal(t, uint64(2), result["log_sequence_number"])
+
+	lsn, data, err := walog.LastCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), lsn)
+	assert.Equal(t, "state", string(data))
+
+	assert.NoError(t, walog.Close())
+	resp, err = http.Post(server.URL+"/rotate", "", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
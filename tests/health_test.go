@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func healthCheck(status wal.HealthStatus, name string) wal.HealthCheck {
+	for _, check := range status.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return wal.HealthCheck{}
+}
+
+func TestWAL_Health(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Health"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Sync())
+
+	status := walog.Health(context.Background())
+	assert.True(t, status.Healthy, "Expected a fresh WAL to be healthy: %+v", status)
+
+	// Without a sync for a long time, the sync check fails.
+	clock.Advance(time.Hour)
+	status = walog.Health(context.Background())
+	assert.False(t, status.Healthy)
+	assert.False(t, healthCheck(status, "sync").Healthy)
+
+	assert.NoError(t, walog.Sync())
+	assert.True(t, walog.Health(context.Background()).Healthy)
+
+	// Corrupt the data of the entry so that its CRC no longer matches.
+	segmentPath := filepath.Join(dirPath, "segment-0")
+	content, err := os.ReadFile(segmentPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(segmentPath, bytes.Replace(content, []byte("entry1"), []byte("entrX1"), 1), 0644))
+
+	_, err = walog.ReadAll(false)
+	assert.ErrorIs(t, err, wal.ErrCorruptEntry)
+
+	status = walog.Health(context.Background())
+	assert.False(t, status.Healthy)
+	assert.False(t, healthCheck(status, "corruption").Healthy)
+	assert.True(t, healthCheck(status, "writable").Healthy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, healthCheck(walog.Health(ctx), "writable").Healthy, "Checks should fail once the context is done")
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHLC(t *testing.T) {
+	t.Parallel()
+	physical := time.UnixMilli(1700000000123)
+	ts := wal.NewHLC(physical, 3)
+	assert.Equal(t, physical, ts.Physical())
+	assert.Equal(t, uint16(3), ts.Logical())
+	assert.Equal(t, "2023-11-14T22:13:20.123Z+3", ts.String())
+	assert.Less(t, ts, wal.NewHLC(physical, 4))
+	assert.Less(t, wal.NewHLC(physical, 65535), wal.NewHLC(physical.Add(time.Millisecond), 0))
+}
+
+func TestWAL_HybridClock(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_HybridClock"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock), wal.WithHybridClock())
+	assert.NoError(t, err, "Failed to create WAL")
+
+	// Entries written in the same millisecond are ordered by the logical counter.
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	clock.Advance(time.Second)
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+
+	// Timestamps received from other nodes order the entries written afterwards.
+	remote := wal.NewHLC(clock.Now().Add(time.Minute), 7)
+	walog.ObserveHLC(remote)
+	assert.NoError(t, walog.WriteEntry([]byte("entry4")))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("copy"), wal.WithHLC(remote)))
+	assert.Greater(t, walog.HLC(), remote)
+	assert.NoError(t, walog.Close())
+
+	// The clock keeps increasing after a restart, even if the physical clock went backwards.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(newFakeClock()), wal.WithHybridClock())
+	assert.NoError(t, err)
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry6")))
+	assert.NoError(t, walog.Sync())
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 6) {
+		start := newFakeClock().Now()
+		assert.Equal(t, wal.NewHLC(start, 0), entries[0].HLC())
+		assert.Equal(t, wal.NewHLC(start, 1), entries[1].HLC())
+		assert.Equal(t, wal.NewHLC(start.Add(time.Second), 0), entries[2].HLC())
+		assert.Equal(t, remote+1, entries[3].HLC())
+		assert.Equal(t, remote, entries[4].HLC())
+		assert.Greater(t, entries[5].HLC(), entries[4].HLC()+1)
+	}
+}
+
+func TestCompareHLC(t *testing.T) {
+	t.Parallel()
+	physical := time.Unix(1700000000, 0)
+	entries := []*wal.WAL_Entry{
+		{LogSequenceNumber: 2, Hlc: uint64(wal.NewHLC(physical, 1))},
+		{LogSequenceNumber: 1, Hlc: uint64(wal.NewHLC(physical, 1))},
+		{LogSequenceNumber: 5, Hlc: uint64(wal.NewHLC(physical, 0))},
+	}
+	slices.SortFunc(entries, wal.CompareHLC)
+	var lsns []uint64
+	for _, entry := range entries {
+		lsns = append(lsns, entry.GetLogSequenceNumber())
+	}
+	assert.Equal(t, []uint64{5, 1, 2}, lsns)
+}
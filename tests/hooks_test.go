@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_HooksRotation(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_HooksRotation"
+	defer os.RemoveAll(dirPath)
+
+	var rotated []int
+	var deleted []string
+	walog, err := wal.OpenWAL(dirPath, false, 64, 2, wal.WithHooks(wal.Hooks{
+		OnRotate:        func(segment int) { rotated = append(rotated, segment) },
+		OnSegmentDelete: func(path string) { deleted = append(deleted, filepath.Base(path)) },
+	}))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")))
+	}
+
+	assert.Equal(t, []int{1, 2, 3}, rotated)
+	assert.Equal(t, []string{"segment-0", "segment-1"}, deleted)
+}
+
+func TestWAL_HooksSyncCheckpointRepair(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_HooksSyncCheckpointRepair"
+	defer os.RemoveAll(dirPath)
+
+	var syncs int
+	var checkpoints []uint64
+	var corruptions []wal.CorruptionEvent
+	var repairedEntries = -1
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(newFakeClock()), wal.WithHooks(wal.Hooks{
+		OnSync:       func(time.Duration) { syncs++ },
+		OnCheckpoint: func(lsn uint64) { checkpoints = append(checkpoints, lsn) },
+		OnRepair:     func(_ string, entriesKept int) { repairedEntries = entriesKept },
+		OnCorruptionDetected: func(event wal.CorruptionEvent) {
+			corruptions = append(corruptions, event)
+		},
+	}))
+	assert.NoError(t, err, "Failed to create WAL")
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Sync())
+	assert.Equal(t, 1, syncs)
+
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+	assert.Equal(t, []uint64{2}, checkpoints)
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.Close())
+
+	// Corrupt the last entry so that its CRC no longer matches.
+	segmentPath := filepath.Join(dirPath, "segment-0")
+	content, err := os.ReadFile(segmentPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(segmentPath, bytes.Replace(content, []byte("entry3"), []byte("entrX3"), 1), 0644))
+
+	_, err = walog.ReadAll(false)
+	assert.ErrorIs(t, err, wal.ErrCorruptEntry)
+	assert.Len(t, corruptions, 1)
+	assert.Equal(t, "read", corruptions[0].Operation)
+
+	_, err = walog.Repair()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repairedEntries)
+	assert.Len(t, corruptions, 2)
+	assert.Equal(t, "repair", corruptions[1].Operation)
+	assert.Equal(t, corruptions[0].Offset, corruptions[1].Offset)
+}
@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectDir(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestInspectDir"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.CommitOffset("indexer", 2))
+	assert.NoError(t, walog.Close())
+
+	info, err := wal.InspectDir(dirPath)
+	assert.NoError(t, err)
+	assert.Equal(t, wal.FormatVersion, info.FormatVersion)
+	assert.Len(t, info.Segments, 2)
+	assert.Equal(t, 3, info.Entries)
+	assert.Equal(t, uint64(1), info.FirstSequenceNumber)
+	assert.Equal(t, uint64(3), info.LastSequenceNumber)
+	assert.Equal(t, info.Segments[0].Size+info.Segments[1].Size, info.TotalSize)
+	assert.Equal(t, &wal.CheckpointInfo{LogSequenceNumber: 2, Data: []byte("checkpoint")}, info.LastCheckpoint)
+	assert.Equal(t, map[string]uint64{"indexer": 2}, info.ConsumerOffsets)
+	assert.False(t, info.Corrupt)
+}
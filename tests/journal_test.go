@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_AdminJournal(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_AdminJournal"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 2, wal.WithClock(clock), wal.WithAdminJournal(),
+		wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err, "Failed to create WAL")
+
+	records, err := walog.AdminJournal()
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Rotate())
+	clock.Advance(time.Minute)
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.Close())
+
+	appendToSegment(t, filepath.Join(dirPath, "segment-2"), []byte("random data"))
+	_, err = walog.Repair()
+	assert.NoError(t, err)
+
+	records, err = walog.AdminJournal()
+	assert.NoError(t, err)
+
+	var operations []string
+	for _, record := range records {
+		operations = append(operations, record.Operation)
+		assert.True(t, record.Succeeded(), "Unexpected failure: %+v", record)
+	}
+	assert.Equal(t, []string{wal.AdminOpRotate, wal.AdminOpDeleteSegment, wal.AdminOpRotate,
+		wal.AdminOpTruncateSegment, wal.AdminOpRepair}, operations)
+	assert.True(t, clock.Now().Add(-time.Minute).Equal(records[0].Time))
+	assert.True(t, clock.Now().Equal(records[1].Time))
+	assert.Equal(t, filepath.Join(dirPath, "segment-0"), records[1].Path)
+	assert.Equal(t, "kept 0 entries: truncated entry", records[3].Details)
+
+	// The journal survives a restart and is not an unknown file.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, 2, wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	reopened, err := walog.AdminJournal()
+	assert.NoError(t, err)
+	assert.Equal(t, records, reopened)
+}
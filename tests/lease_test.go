@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_Lease(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Lease"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	primary, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments,
+		wal.WithClock(clock), wal.WithLease("primary", 10*time.Second), wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, primary.WriteEntry([]byte("entry1")))
+	assert.NoError(t, primary.Sync())
+
+	lease, err := primary.Lease()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), lease.Epoch)
+	assert.Equal(t, "primary", lease.Holder)
+
+	// The lease of the primary hasn't expired.
+	_, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock), wal.WithLease("standby", 10*time.Second))
+	assert.ErrorIs(t, err, wal.ErrLeaseHeld)
+
+	// The primary stalls for longer than its lease, and the standby takes over.
+	clock.Advance(11 * time.Second)
+	standby, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock), wal.WithLease("standby", 10*time.Second))
+	assert.NoError(t, err)
+	defer standby.Close()
+	lease, err = wal.ReadLease(dirPath)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), lease.Epoch)
+	assert.Equal(t, "standby", lease.Holder)
+	assert.True(t, lease.Expires.Equal(clock.Now().Add(10*time.Second)))
+
+	// The old primary is fenced: its buffered entry never reaches the segment files.
+	assert.NoError(t, primary.WriteEntry([]byte("stale")))
+	assert.ErrorIs(t, primary.Sync(), wal.ErrFenced)
+	assert.ErrorIs(t, primary.WriteEntry([]byte("stale")), wal.ErrFenced)
+	_, err = primary.Lease()
+	assert.ErrorIs(t, err, wal.ErrFenced)
+	_, err = primary.Compact()
+	assert.ErrorIs(t, err, wal.ErrFenced)
+	assert.ErrorIs(t, primary.Close(), wal.ErrFenced)
+
+	assert.NoError(t, standby.WriteEntry([]byte("entry2")))
+	assert.NoError(t, standby.Sync())
+	entries, err := standby.ReadAll(false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, []byte("entry2"), entries[1].GetData())
+		assert.Equal(t, uint64(2), entries[1].GetLogSequenceNumber())
+	}
+}
+
+func TestWAL_LeaseRenewedAndReleased(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_LeaseRenewedAndReleased"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock), wal.WithLease("primary", 10*time.Second))
+	assert.NoError(t, err, "Failed to create WAL")
+
+	clock.Advance(5 * time.Second)
+	clock.Fire()
+	assert.Eventually(t, func() bool {
+		lease, err := wal.ReadLease(dirPath)
+		return err == nil && lease.Expires.Equal(clock.Now().Add(10*time.Second))
+	}, time.Second, time.Millisecond)
+
+	// Closing releases the lease, so another writer doesn't have to wait for it to expire.
+	assert.NoError(t, walog.Close())
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock), wal.WithLease("standby", 10*time.Second))
+	assert.NoError(t, err)
+	defer walog.Close()
+	lease, err := walog.Lease()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), lease.Epoch)
+}
+
+func TestWAL_LeaseReleasedWhenOpenFails(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_LeaseReleasedWhenOpenFails"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.Close())
+	assert.NoError(t, os.WriteFile(filepath.Join(dirPath, "checkpoint"), []byte("not a checkpoint"), 0644))
+
+	_, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock), wal.WithLease("primary", 10*time.Second))
+	assert.Error(t, err, "Expected the corrupt checkpoint file to fail the open")
+
+	// The lease taken by the failed open doesn't keep another writer out.
+	assert.NoError(t, os.Remove(filepath.Join(dirPath, "checkpoint")))
+	standby, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock), wal.WithLease("standby", 10*time.Second))
+	assert.NoError(t, err)
+	assert.NoError(t, standby.Close())
+}
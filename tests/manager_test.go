@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_Namespaces(t *testing.T) {
+	t.Parallel()
+	rootPath := "TestManager_Namespaces"
+	defer os.RemoveAll(rootPath)
+
+	clock := newFakeClock()
+	manager, err := wal.NewManager(rootPath, true, maxFileSize, maxSegments, wal.WithWALOptions(wal.WithClock(clock)))
+	assert.NoError(t, err, "Failed to create manager")
+	defer manager.Close()
+
+	orders, err := manager.Get("orders")
+	assert.NoError(t, err)
+	tmp, err := manager.Get("tmp")
+	assert.NoError(t, err)
+
+	again, err := manager.Get("orders")
+	assert.NoError(t, err)
+	assert.Same(t, orders, again, "Expected the same WAL for the same namespace")
+
+	_, err = manager.Get("../escape")
+	assert.Error(t, err)
+
+	assert.NoError(t, orders.WriteEntry([]byte("order1")))
+	assert.NoError(t, tmp.WriteEntry([]byte("tmp1")))
+
+	// The shared scheduler syncs every namespace.
+	clock.Fire()
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(filepath.Join(rootPath, "orders", "segment-0"))
+		return err == nil && info.Size() > 0
+	}, time.Second, time.Millisecond, "Namespace was not synced by the shared scheduler")
+
+	namespaces, err := manager.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders", "tmp"}, namespaces)
+
+	assert.NoError(t, manager.Delete("tmp"))
+	namespaces, err = manager.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, namespaces)
+	assert.ErrorIs(t, tmp.WriteEntry([]byte("tmp2")), wal.ErrClosed)
+}
+
+func TestManager_DeleteWithDirectories(t *testing.T) {
+	t.Parallel()
+	rootPath := "TestManager_DeleteWithDirectories"
+	defer os.RemoveAll(rootPath)
+
+	manager, err := wal.NewManager(rootPath, true, maxFileSize, maxSegments,
+		wal.WithWALOptions(wal.WithBlobThreshold(8), wal.WithValueLog(16)))
+	assert.NoError(t, err, "Failed to create manager")
+	defer manager.Close()
+
+	orders, err := manager.Get("orders")
+	assert.NoError(t, err)
+	assert.NoError(t, orders.WriteEntry([]byte("a large order")))
+	assert.DirExists(t, filepath.Join(rootPath, "orders", "blobs"))
+
+	assert.NoError(t, manager.Delete("orders"))
+	assert.NoDirExists(t, filepath.Join(rootPath, "orders"))
+}
+
+func TestManager_ByteBudget(t *testing.T) {
+	t.Parallel()
+	rootPath := "TestManager_ByteBudget"
+	defer os.RemoveAll(rootPath)
+
+	manager, err := wal.NewManager(rootPath, true, maxFileSize, maxSegments, wal.WithByteBudget(100))
+	assert.NoError(t, err, "Failed to create manager")
+	defer manager.Close()
+
+	a, err := manager.Get("a")
+	assert.NoError(t, err)
+	b, err := manager.Get("b")
+	assert.NoError(t, err)
+
+	payload := make([]byte, 30)
+	assert.NoError(t, a.WriteEntry(payload))
+	assert.NoError(t, b.WriteEntry(payload))
+	assert.ErrorIs(t, a.WriteEntry(payload), wal.ErrBudgetExceeded, "The budget is shared across namespaces")
+	assert.Equal(t, uint64(1), a.Stats().LastSequenceNumber, "Rejected writes must not consume a sequence number")
+
+	// Deleting a namespace frees its share of the budget.
+	assert.NoError(t, manager.Delete("b"))
+	assert.NoError(t, a.WriteEntry(payload))
+}
+
+func TestManager_Quotas(t *testing.T) {
+	t.Parallel()
+	rootPath := "TestManager_Quotas"
+	defer os.RemoveAll(rootPath)
+
+	clock := newFakeClock()
+	manager, err := wal.NewManager(rootPath, true, maxFileSize, maxSegments,
+		wal.WithWALOptions(wal.WithClock(clock)),
+		wal.WithDefaultQuota(wal.Quota{EntriesPerSecond: 2}),
+		wal.WithNamespaceQuota("big", wal.Quota{MaxBytes: 100}))
+	assert.NoError(t, err, "Failed to create manager")
+	defer manager.Close()
+
+	// Writes over the rate are rejected, until the rate allows them again.
+	a, err := manager.Get("a")
+	assert.NoError(t, err)
+	assert.NoError(t, a.WriteEntry([]byte("1")))
+	assert.NoError(t, a.WriteEntry([]byte("2")))
+	assert.ErrorIs(t, a.WriteEntry([]byte("3")), wal.ErrQuotaExceeded)
+	assert.Equal(t, uint64(2), a.Stats().LastSequenceNumber, "Rejected writes must not consume a sequence number")
+	clock.Advance(time.Second)
+	assert.NoError(t, a.WriteEntry([]byte("3")))
+
+	// Writes that would take a namespace over its byte quota are rejected, without affecting the others.
+	big, err := manager.Get("big")
+	assert.NoError(t, err)
+	payload := make([]byte, 30)
+	assert.NoError(t, big.WriteEntry(payload))
+	assert.NoError(t, big.WriteEntry(payload))
+	assert.ErrorIs(t, big.WriteEntry(payload), wal.ErrQuotaExceeded)
+	clock.Advance(time.Second)
+	assert.NoError(t, a.WriteEntry(payload))
+
+	// With throttling, writes over the rate wait instead.
+	manager.SetQuota("slow", wal.Quota{EntriesPerSecond: 1, Throttle: true})
+	slow, err := manager.Get("slow")
+	assert.NoError(t, err)
+	assert.NoError(t, slow.WriteEntry([]byte("1")))
+	done := make(chan error)
+	go func() { done <- slow.WriteEntry([]byte("2")) }()
+	select {
+	case <-done:
+		t.Fatal("write over the rate wasn't throttled")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(time.Second)
+	assert.Eventually(t, func() bool {
+		clock.Fire()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+
+	stats := manager.Stats()
+	assert.Equal(t, uint64(1), stats.Namespaces["a"].RejectedWrites)
+	assert.Equal(t, uint64(1), stats.Namespaces["big"].RejectedWrites)
+	assert.Equal(t, int64(100), stats.Namespaces["big"].Quota.MaxBytes)
+	assert.Greater(t, stats.Namespaces["big"].BytesUsed, int64(60))
+	assert.Equal(t, uint64(1), stats.Namespaces["slow"].ThrottledWrites)
+	assert.Equal(t, time.Second, stats.Namespaces["slow"].ThrottledTime)
+	assert.Equal(t, stats.BytesUsed, stats.Namespaces["a"].BytesUsed+stats.Namespaces["big"].BytesUsed+stats.Namespaces["slow"].BytesUsed)
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_EntryMetadataAndLabels(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_EntryMetadataAndLabels"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+
+	labels := map[string]string{"env": "production", "tenant": "acme"}
+	assert.NoError(t, walog.WriteEntryWithMetadata([]byte("entry1"), []byte("trace-id"), labels))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Close())
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err, "Failed to recover entries")
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, []byte("trace-id"), entries[0].GetMetadata())
+	assert.Equal(t, labels, entries[0].GetLabels())
+	assert.Empty(t, entries[1].GetMetadata())
+	assert.Empty(t, entries[1].GetLabels())
+
+	// Labels are covered by the CRC.
+	segmentPath := filepath.Join(dirPath, "segment-0")
+	content, err := os.ReadFile(segmentPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(segmentPath, bytes.Replace(content, []byte("production"), []byte("productiox"), 1), 0644))
+
+	_, err = walog.ReadAll(false)
+	assert.ErrorIs(t, err, wal.ErrCorruptEntry)
+}
+
+func TestWAL_WriteEntryOpts(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_WriteEntryOpts"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	timestamp := time.Unix(1700000000, 42)
+	assert.NoError(t, walog.WriteEntryOpts([]byte("order1"),
+		wal.WithStream("orders"), wal.WithKey([]byte("order-1")), wal.WithTimestamp(timestamp)))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("snapshot"), wal.WithCheckpoint()))
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err, "Failed to recover entries")
+	assert.Equal(t, 2, len(entries))
+
+	assert.Equal(t, "orders", entries[0].GetStream())
+	assert.Equal(t, []byte("order-1"), entries[0].GetKey())
+	assert.True(t, timestamp.Equal(entries[0].Time()))
+	assert.False(t, entries[0].GetIsCheckpoint())
+
+	assert.True(t, entries[1].GetIsCheckpoint())
+	assert.True(t, entries[1].Time().IsZero())
+
+	lsn, _, err := walog.LastCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), lsn)
+}
+
+func TestWAL_WithSequenceNumber(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_WithSequenceNumber"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+
+	assert.NoError(t, walog.WriteEntryOpts([]byte("entry10"), wal.WithSequenceNumber(10)))
+	assert.NoError(t, walog.WriteEntry([]byte("entry11")))
+	err = walog.WriteEntryOpts([]byte("entry11"), wal.WithSequenceNumber(11))
+	assert.ErrorIs(t, err, wal.ErrSequenceNumberTooLow)
+	assert.NoError(t, walog.Close())
+
+	// The sequence numbers survive a restart.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry12")))
+	assert.NoError(t, walog.Sync())
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	var sequenceNumbers []uint64
+	for _, entry := range entries {
+		sequenceNumbers = append(sequenceNumbers, entry.GetLogSequenceNumber())
+	}
+	assert.Equal(t, []uint64{10, 11, 12}, sequenceNumbers)
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_MetricsSnapshot(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_MetricsSnapshot"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	}
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	assert.NoError(t, walog.Sync())
+
+	snapshot, err := walog.MetricsSnapshot()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), snapshot.Stats.EntriesWritten)
+	assert.Len(t, snapshot.Segments, 2)
+
+	sealed, active := snapshot.Segments[0], snapshot.Segments[1]
+	assert.False(t, sealed.Active)
+	assert.Equal(t, 3, sealed.Entries)
+	assert.Equal(t, uint64(1), sealed.FirstSequenceNumber)
+	assert.Equal(t, uint64(3), sealed.LastSequenceNumber)
+	assert.Greater(t, sealed.Size, int64(0))
+	assert.False(t, sealed.ModTime.IsZero())
+	assert.Equal(t, snapshot.Time.Sub(sealed.ModTime), sealed.Age)
+
+	assert.True(t, active.Active)
+	assert.Equal(t, 1, active.Entries)
+	assert.Equal(t, uint64(4), active.FirstSequenceNumber)
+
+	// The snapshot is serializable, with the segment state flattened.
+	data, err := json.Marshal(snapshot)
+	assert.NoError(t, err)
+	var decoded map[string]any
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	segment := decoded["segments"].([]any)[0].(map[string]any)
+	assert.Equal(t, float64(3), segment["entries"])
+	assert.Contains(t, segment, "age")
+}
@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// diskFailureFS wraps the OS filesystem and fails the fsync calls of the files under failedDir
+// while failed is set.
+type diskFailureFS struct {
+	wal.OSFS
+	failedDir string
+	failed    atomic.Bool
+}
+
+func (fs *diskFailureFS) Create(name string) (wal.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (fs *diskFailureFS) OpenFile(name string, flag int, perm os.FileMode) (wal.File, error) {
+	file, err := fs.OSFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(name, fs.failedDir+string(filepath.Separator)) {
+		return file, nil
+	}
+	return &diskFailureFile{File: file, fs: fs}, nil
+}
+
+type diskFailureFile struct {
+	wal.File
+	fs *diskFailureFS
+}
+
+func (f *diskFailureFile) Sync() error {
+	if f.fs.failed.Load() {
+		return errInjected
+	}
+	return f.File.Sync()
+}
+
+func TestWAL_Mirror(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Mirror"
+	mirrorPath := "TestWAL_Mirror_mirror"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(mirrorPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithMirror(mirrorPath, wal.MirrorRequireBoth))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.Sync())
+	assert.Equal(t, &wal.MirrorStats{Directory: mirrorPath}, walog.Stats().Mirror)
+	assert.NoError(t, walog.Close())
+
+	// The WAL directory is lost: the WAL is opened from the mirror, which fills in a new WAL directory.
+	assert.NoError(t, os.RemoveAll(dirPath))
+	walog, err = wal.OpenWAL(mirrorPath, true, maxFileSize, maxSegments, wal.WithMirror(dirPath, wal.MirrorRequireBoth))
+	assert.NoError(t, err)
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	lsn, data, err := walog.LastCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), lsn)
+	assert.Equal(t, []byte("checkpoint"), data)
+	assert.NoError(t, walog.WriteEntry([]byte("entry4")))
+	assert.NoError(t, walog.Close())
+
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithOpenMode(wal.MustExist))
+	assert.NoError(t, err)
+	defer walog.Close()
+	entries, err = walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestWAL_MirrorFailure(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_MirrorFailure"
+	mirrorPath := "TestWAL_MirrorFailure_mirror"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(mirrorPath)
+
+	fs := &diskFailureFS{failedDir: mirrorPath}
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithFS(fs), wal.WithMirror(mirrorPath, wal.MirrorRequireBoth))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	fs.failed.Store(true)
+	assert.ErrorIs(t, walog.Sync(), errInjected)
+	fs.failed.Store(false)
+	walog.Close()
+
+	// The mirror is detached when it fails, and the WAL keeps going.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithFS(fs), wal.WithMirror(mirrorPath, wal.MirrorAllowDegraded))
+	assert.NoError(t, err)
+	defer walog.Close()
+	fs.failed.Store(true)
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Sync())
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.Sync())
+	stats := walog.Stats().Mirror
+	assert.True(t, stats.Detached)
+	assert.Contains(t, stats.Error, errInjected.Error())
+}
+
+func TestWAL_MirrorResilver(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_MirrorResilver"
+	mirrorPath := "TestWAL_MirrorResilver_mirror"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(mirrorPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithBlobThreshold(16))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("a value large enough to be stored as a blob")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Close())
+	blobs, err := filepath.Glob(filepath.Join(dirPath, "blobs", "*"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, blobs)
+
+	// The mirror has a copy of the segment with the same size but different contents, as left by a
+	// segment rewritten while it was detached, and a file the WAL directory no longer has.
+	segments, err := filepath.Glob(filepath.Join(dirPath, "segment-*"))
+	assert.NoError(t, err)
+	data, err := os.ReadFile(segments[0])
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	assert.NoError(t, os.MkdirAll(filepath.Join(mirrorPath, "stale"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(mirrorPath, filepath.Base(segments[0])), data, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(mirrorPath, "stale", "file"), data, 0644))
+
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithBlobThreshold(16), wal.WithMirror(mirrorPath, wal.MirrorRequireBoth))
+	assert.NoError(t, err)
+	assert.NoError(t, walog.Close())
+
+	// The mirror matches the WAL directory, subdirectories included.
+	assert.Equal(t, readTree(t, dirPath), readTree(t, mirrorPath))
+	assert.NoDirExists(t, filepath.Join(mirrorPath, "stale"))
+}
+
+// readTree returns the contents of the files under root by their path relative to root.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	assert.NoError(t, filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files[rel] = string(data)
+		return err
+	}))
+	return files
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+const mmapFileSize = 4096
+
+func TestWAL_Mmap(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Mmap"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, mmapFileSize, 10, wal.WithMmap())
+	assert.NoError(t, err, "Failed to create WAL")
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Sync())
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		// The current segment is preallocated.
+		info, err := os.Stat(filepath.Join(dirPath, "segment-0"))
+		assert.NoError(t, err)
+		assert.EqualValues(t, mmapFileSize, info.Size())
+	}
+
+	// The zeros past the entries end the segment for readers.
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	tail, err := walog.Tail(0)
+	assert.NoError(t, err)
+	var tailed int
+	assert.NoError(t, tail.Read(func(entry *wal.WAL_Entry) error {
+		tailed++
+		return nil
+	}))
+	tail.Stop()
+	assert.Equal(t, 2, tailed)
+
+	// An entry larger than the preallocated space grows the segment.
+	large := bytes.Repeat([]byte("x"), 3*mmapFileSize)
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry(large))
+	assert.NoError(t, walog.WriteEntry([]byte("entry4")))
+	assert.NoError(t, walog.Close())
+
+	// The segments are truncated to their entries when sealed, and read without WithMmap alike.
+	report, err := wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.False(t, report.Corrupt)
+	// The large entry fills its segment, so the next one is rotated to.
+	if assert.Len(t, report.Segments, 3) {
+		assert.Equal(t, 2, report.Segments[0].Entries)
+		assert.Equal(t, 1, report.Segments[1].Entries)
+		assert.Equal(t, 1, report.Segments[2].Entries)
+	}
+	info, err := os.Stat(filepath.Join(dirPath, "segment-0"))
+	assert.NoError(t, err)
+	assert.Less(t, info.Size(), int64(mmapFileSize))
+
+	walog, err = wal.OpenWAL(dirPath, true, mmapFileSize, 10)
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry5")))
+	assert.NoError(t, walog.Sync())
+	entries, err = walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+	assert.Equal(t, large, entries[2].Data)
+}
+
+// A segment left preallocated by a crash is truncated to its entries when the WAL is reopened.
+func TestWAL_MmapCrash(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_MmapCrash"
+	defer os.RemoveAll(dirPath)
+
+	crashed, err := wal.OpenWAL(dirPath, true, mmapFileSize, 10, wal.WithMmap())
+	assert.NoError(t, err, "Failed to create WAL")
+	defer crashed.Close()
+	assert.NoError(t, crashed.WriteEntry([]byte("entry1")))
+	assert.NoError(t, crashed.Sync())
+
+	walog, err := wal.OpenWAL(dirPath, true, mmapFileSize, 10, wal.WithMmap())
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Sync())
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, uint64(2), entries[1].GetLogSequenceNumber())
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_OpenMustExist(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_OpenMustExist"
+	defer os.RemoveAll(dirPath)
+
+	// Missing directory
+	_, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithOpenMode(wal.MustExist))
+	assert.ErrorIs(t, err, wal.ErrNotExist)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(dirPath)
+	assert.True(t, os.IsNotExist(err), "MustExist should not create the directory")
+
+	// Empty directory without segments
+	assert.NoError(t, os.MkdirAll(dirPath, 0755))
+	_, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithOpenMode(wal.MustExist))
+	assert.ErrorIs(t, err, wal.ErrNotExist)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Close())
+
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithOpenMode(wal.MustExist))
+	assert.NoError(t, err, "Failed to open existing WAL")
+	defer walog.Close()
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+}
+
+func TestWAL_OpenRejectUnknownFiles(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_OpenRejectUnknownFiles"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+	assert.NoError(t, walog.Close())
+
+	// Only files created by the WAL itself are present.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err, "Failed to open WAL")
+	assert.NoError(t, walog.Close())
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dirPath, "000001.log"), []byte("other system"), 0644))
+
+	_, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.ErrorIs(t, err, wal.ErrUnknownFiles)
+	assert.Contains(t, err.Error(), "000001.log")
+
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithUnknownFiles(wal.WarnUnknownFiles))
+	assert.NoError(t, err, "Warning mode should still open the WAL")
+	assert.NoError(t, walog.Close())
+}
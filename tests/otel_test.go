@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/walotel"
+	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWAL_OpenTelemetry(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_OpenTelemetry"
+	defer os.RemoveAll(dirPath)
+
+	spanRecorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+	metricReader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader))
+
+	instrumentation, err := walotel.NewInstrumentation(tracerProvider, meterProvider)
+	assert.NoError(t, err)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithInstrumentation(instrumentation))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Sync())
+
+	spans := map[string]int{}
+	for _, span := range spanRecorder.Ended() {
+		spans[span.Name()]++
+		if span.Name() == "wal.WriteEntry" {
+			for _, attr := range span.Attributes() {
+				if attr.Key == "wal.entry.sequence_number" {
+					assert.Equal(t, int64(1), attr.Value.AsInt64())
+				}
+			}
+		}
+	}
+	assert.Equal(t, 1, spans["wal.Recover"])
+	assert.Equal(t, 1, spans["wal.WriteEntry"])
+	assert.GreaterOrEqual(t, spans["wal.Sync"], 1)
+
+	var metrics metricdata.ResourceMetrics
+	assert.NoError(t, metricReader.Collect(context.Background(), &metrics))
+
+	values := map[string]int64{}
+	for _, scopeMetrics := range metrics.ScopeMetrics {
+		for _, m := range scopeMetrics.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				values[m.Name] = data.DataPoints[0].Value
+			case metricdata.Gauge[int64]:
+				values[m.Name] = data.DataPoints[0].Value
+			case metricdata.Histogram[float64]:
+				values[m.Name] = int64(data.DataPoints[0].Count)
+			}
+		}
+	}
+	assert.Equal(t, int64(1), values["wal.entries.written"])
+	assert.Equal(t, int64(1), values["wal.last_sequence_number"])
+	assert.GreaterOrEqual(t, values["wal.fsync.duration"], int64(1))
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// outboxPublisher records the records published, failing the first publish.
+type outboxPublisher struct {
+	mu        sync.Mutex
+	failed    bool
+	published []string
+}
+
+func (p *outboxPublisher) Publish(ctx context.Context, records []*wal.WAL_Entry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.failed {
+		p.failed = true
+		return errors.New("broker unavailable")
+	}
+	for _, record := range records {
+		p.published = append(p.published, string(record.GetData()))
+	}
+	return nil
+}
+
+func (p *outboxPublisher) records() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.published...)
+}
+
+func TestOutbox(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestOutbox"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	publisher := &outboxPublisher{}
+	outbox := wal.NewOutbox(walog, "emails", publisher, wal.WithOutboxRetryInterval(time.Millisecond))
+	lsn, err := outbox.Append([]byte("welcome"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), lsn)
+	// Entries of other streams aren't delivered, and records are always in the stream of the outbox.
+	assert.NoError(t, walog.WriteEntry([]byte("state")))
+	_, err = outbox.Append([]byte("receipt"), wal.WithStream("ignored"))
+	assert.NoError(t, err)
+	assert.NoError(t, walog.Sync())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- outbox.Run(ctx) }()
+
+	// The first publish fails and is retried.
+	assert.Eventually(t, func() bool { return outbox.Delivered() == 3 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []string{"welcome", "receipt"}, publisher.records())
+
+	// Records appended while the outbox runs are delivered.
+	_, err = outbox.Append([]byte("reminder"))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return outbox.Delivered() == 4 }, 5*time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// A restarted outbox resumes after the last record delivered.
+	_, err = outbox.Append([]byte("survey"))
+	assert.NoError(t, err)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() { done <- outbox.Run(ctx) }()
+	assert.Eventually(t, func() bool { return outbox.Delivered() == 5 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []string{"welcome", "receipt", "reminder", "survey"}, publisher.records())
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
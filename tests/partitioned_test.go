@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionedWAL(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestPartitionedWAL"
+	defer os.RemoveAll(dirPath)
+
+	p, err := wal.OpenPartitionedWAL(dirPath, 4, true, maxFileSize, 10, wal.WithHybridClock())
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.Equal(t, 4, p.Partitions())
+
+	for i := 0; i < 20; i++ {
+		key := []byte(fmt.Sprintf("key%d", i%5))
+		partition, _, err := p.AppendEntry(key, []byte(fmt.Sprintf("entry%d", i)))
+		assert.NoError(t, err)
+		assert.Equal(t, p.PartitionOf(key), partition)
+	}
+	assert.NoError(t, p.Sync())
+
+	// Entries with the same key stay in order within their partition.
+	var total int
+	for partition := 0; partition < p.Partitions(); partition++ {
+		last := map[string]int{}
+		assert.NoError(t, p.ReadPartition(partition, 0, func(entry *wal.WAL_Entry) error {
+			assert.Equal(t, partition, p.PartitionOf(entry.GetKey()))
+			var i int
+			_, err := fmt.Sscanf(string(entry.GetData()), "entry%d", &i)
+			assert.NoError(t, err)
+			assert.Greater(t, i+1, last[string(entry.GetKey())])
+			last[string(entry.GetKey())] = i + 1
+			total++
+			return nil
+		}))
+	}
+	assert.Equal(t, 20, total)
+
+	// With hybrid clocks, the merged order is the order of the writes.
+	var merged []string
+	assert.NoError(t, p.ReadMerged(context.Background(), func(partition int, entry *wal.WAL_Entry) error {
+		merged = append(merged, string(entry.GetData()))
+		return nil
+	}))
+	assert.Len(t, merged, 20)
+	for i, data := range merged {
+		assert.Equal(t, fmt.Sprintf("entry%d", i), data)
+	}
+	assert.NoError(t, p.Close())
+
+	_, err = wal.OpenPartitionedWAL(dirPath, 2, true, maxFileSize, 10)
+	assert.Error(t, err, "The number of partitions can't change")
+
+	p, err = wal.OpenPartitionedWAL(dirPath, 4, true, maxFileSize, 10)
+	assert.NoError(t, err)
+	defer p.Close()
+	_, lsn, err := p.AppendEntry([]byte("key0"), []byte("entry20"))
+	assert.NoError(t, err)
+	assert.Greater(t, lsn, uint64(1), "Sequence numbers continue after reopening")
+}
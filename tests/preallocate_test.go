@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+const preallocatedFileSize = 64 * 1024
+
+// waitForSpare waits until the spare segment of the WAL in dirPath is ready.
+func waitForSpare(t *testing.T, dirPath string) {
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(filepath.Join(dirPath, "segment.spare"))
+		return err == nil && info.Size() >= preallocatedFileSize
+	}, 5*time.Second, time.Millisecond, "The spare segment was not prepared")
+}
+
+func TestWAL_Preallocate(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Preallocate"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, preallocatedFileSize, 10, wal.WithPreallocate())
+	assert.NoError(t, err, "Failed to create WAL")
+	waitForSpare(t, dirPath)
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Sync())
+	assert.Equal(t, uint64(1), walog.Stats().PreallocatedSegments)
+
+	// The new segment is the spare, filled with zeros past its entries, which end it for readers.
+	info, err := os.Stat(filepath.Join(dirPath, "segment-1"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, preallocatedFileSize, info.Size())
+	assert.Less(t, walog.Stats().ActiveSegmentSize, int64(preallocatedFileSize))
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// The next spare is prepared in the background.
+	waitForSpare(t, dirPath)
+	assert.NoError(t, walog.Close())
+
+	// The zeros are truncated once the segment is sealed.
+	info, err = os.Stat(filepath.Join(dirPath, "segment-1"))
+	assert.NoError(t, err)
+	assert.Less(t, info.Size(), int64(preallocatedFileSize))
+	report, err := wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.False(t, report.Corrupt)
+
+	// The spare is removed once the WAL is opened without the option.
+	walog, err = wal.OpenWAL(dirPath, true, preallocatedFileSize, 10)
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	_, err = os.Stat(filepath.Join(dirPath, "segment.spare"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// Segments deleted because of the segment limit are recycled into spare segments, and the stale entries
+// they held are never read back.
+func TestWAL_RecycleSegments(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_RecycleSegments"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, preallocatedFileSize, 2,
+		wal.WithDurabilityProfile(wal.DurabilityLowLatency))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	data := make([]byte, 1000)
+	for i := range 6 {
+		waitForSpare(t, dirPath)
+		for range 10 {
+			assert.NoError(t, walog.WriteEntry(data))
+		}
+		assert.NoError(t, walog.Sync())
+		if i < 5 {
+			assert.NoError(t, walog.Rotate())
+		}
+	}
+	assert.Eventually(t, func() bool { return walog.Stats().RecycledSegments > 0 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, uint64(5), walog.Stats().PreallocatedSegments)
+
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 20) {
+		for i, entry := range entries {
+			assert.Equal(t, uint64(41+i), entry.GetLogSequenceNumber())
+		}
+	}
+	report, err := wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.False(t, report.Corrupt)
+}
+
+func TestWAL_DurabilityProfileUnknown(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_DurabilityProfileUnknown"
+	defer os.RemoveAll(dirPath)
+
+	_, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithDurabilityProfile("fastest"))
+	assert.Error(t, err)
+}
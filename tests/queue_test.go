@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// receivedData returns the data of the messages.
+func receivedData(messages []wal.Message) []string {
+	var data []string
+	for _, message := range messages {
+		data = append(data, string(message.GetData()))
+	}
+	return data
+}
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestQueue"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock))
+	assert.NoError(t, err, "Failed to create WAL")
+	queue, err := wal.OpenQueue(walog, "tasks")
+	assert.NoError(t, err)
+
+	for _, task := range []string{"task1", "task2", "task3"} {
+		_, err := queue.Enqueue([]byte(task))
+		assert.NoError(t, err)
+	}
+	// Entries of other streams aren't messages of the queue.
+	assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	_, err = queue.Enqueue([]byte("task4"))
+	assert.NoError(t, err)
+
+	messages, err := queue.Receive(2, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"task1", "task2"}, receivedData(messages))
+	assert.Equal(t, 1, messages[0].Deliveries)
+	assert.NoError(t, queue.Ack(messages[0].GetLogSequenceNumber()))
+	assert.ErrorIs(t, queue.Ack(messages[0].GetLogSequenceNumber()), wal.ErrNotLeased)
+	assert.NoError(t, queue.Nack(messages[1].GetLogSequenceNumber()))
+
+	// The nacked message is redelivered first.
+	messages, err = queue.Receive(10, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"task2", "task3", "task4"}, receivedData(messages))
+	assert.Equal(t, 2, messages[0].Deliveries)
+	assert.NoError(t, queue.Ack(messages[2].GetLogSequenceNumber()))
+	messages, err = queue.Receive(10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+	assert.Equal(t, 2, queue.Len())
+	queue.Close()
+	assert.NoError(t, walog.Close())
+
+	// The leases survive a restart, and expired leases are redelivered.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock))
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	queue, err = wal.OpenQueue(walog, "tasks")
+	assert.NoError(t, err)
+	defer queue.Close()
+	assert.Equal(t, 2, queue.Len())
+	messages, err = queue.Receive(10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+
+	clock.Advance(time.Minute)
+	messages, err = queue.Receive(10, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"task2", "task3"}, receivedData(messages))
+	assert.Equal(t, 3, messages[0].Deliveries)
+	for _, message := range messages {
+		assert.NoError(t, queue.Ack(message.GetLogSequenceNumber()))
+	}
+	assert.Zero(t, queue.Len())
+
+	_, err = wal.OpenQueue(walog, "../tasks")
+	assert.Error(t, err)
+}
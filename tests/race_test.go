@@ -0,0 +1,8 @@
+//go:build race
+
+package tests
+
+// The race detector makes sync.Pool drop items at random, so pooled paths allocate.
+func init() {
+	raceEnabled = true
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordMachine is a key-value map built from Records.
+type recordMachine struct {
+	values  map[string]string
+	applied int
+	fail    bool
+}
+
+func newRecordMachine() *recordMachine {
+	return &recordMachine{values: map[string]string{}}
+}
+
+func (m *recordMachine) Apply(entry *wal.WAL_Entry) error {
+	if m.fail {
+		return errors.New("apply failed")
+	}
+	var record Record
+	if err := json.Unmarshal(entry.GetData(), &record); err != nil {
+		return err
+	}
+	switch record.Op {
+	case InsertOperation:
+		m.values[record.Key] = string(record.Value)
+	case DeleteOperation:
+		delete(m.values, record.Key)
+	}
+	m.applied++
+	return nil
+}
+
+func (m *recordMachine) Snapshot() ([]byte, error) {
+	return json.Marshal(m.values)
+}
+
+func (m *recordMachine) Restore(state []byte) error {
+	return json.Unmarshal(state, &m.values)
+}
+
+func writeRecord(t *testing.T, recovery *wal.Recovery, op OperationType, key, value string) uint64 {
+	data, err := json.Marshal(Record{Op: op, Key: key, Value: []byte(value)})
+	assert.NoError(t, err)
+	lsn, err := recovery.Write(data)
+	assert.NoError(t, err)
+	return lsn
+}
+
+func TestRecovery(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestRecovery"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	machine := newRecordMachine()
+	recovery, err := wal.Recover(wal.NewSnapshotStore(walog), machine, wal.WithSnapshotEvery(3))
+	assert.NoError(t, err)
+
+	// A snapshot is saved every three entries, and the segments before the oldest snapshot kept are deleted.
+	for i, key := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		writeRecord(t, recovery, InsertOperation, key, key)
+		if i%2 == 1 {
+			assert.NoError(t, walog.Rotate())
+		}
+	}
+	writeRecord(t, recovery, DeleteOperation, "a", "")
+	assert.Len(t, machine.values, 6)
+	assert.Equal(t, uint64(10), recovery.Applied(), "The snapshot checkpoints aren't applied")
+	assert.NoError(t, walog.Close())
+
+	segments, err := filepath.Glob(filepath.Join(dirPath, "segment-*"))
+	assert.NoError(t, err)
+	assert.Len(t, segments, 3)
+
+	// The state is restored from the latest snapshot, and only the entries after it are applied.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	recovered := newRecordMachine()
+	recovery, err = wal.Recover(wal.NewSnapshotStore(walog), recovered, wal.WithSnapshotEvery(3))
+	assert.NoError(t, err)
+	assert.Equal(t, machine.values, recovered.values)
+	assert.Equal(t, 2, recovered.applied)
+	assert.Equal(t, uint64(10), recovery.Applied())
+
+	// A failed Apply stops the writes.
+	recovered.fail = true
+	data, err := json.Marshal(Record{Op: InsertOperation, Key: "h"})
+	assert.NoError(t, err)
+	_, err = recovery.Write(data)
+	assert.Error(t, err)
+	recovered.fail = false
+	_, err = recovery.Write(data)
+	assert.Error(t, err)
+	assert.Error(t, recovery.Snapshot())
+}
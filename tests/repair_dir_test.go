@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepairDir(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestRepairDir"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	}
+	assert.NoError(t, walog.WriteEntry([]byte("entry4")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry5")))
+	assert.NoError(t, walog.Close())
+
+	// Corrupt the last entry of the first segment and the tail of the second one.
+	firstSegment := filepath.Join(dirPath, "segment-0")
+	original, err := os.ReadFile(firstSegment)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(firstSegment, bytes.Replace(original, []byte("entry4"), []byte("entrX4"), 1), 0644))
+	secondSegment := filepath.Join(dirPath, "segment-1")
+	secondSize := int64(len(mustReadFile(t, secondSegment)))
+	appendToSegment(t, secondSegment, []byte("random data"))
+
+	report, err := wal.RepairDir(dirPath, true, true)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Len(t, report.Segments, 2)
+	assert.Equal(t, 3, report.Segments[0].EntriesKept)
+	assert.Equal(t, 1, report.Segments[1].EntriesKept)
+	assert.Equal(t, secondSize, report.Segments[1].TruncatedAt)
+	assert.Empty(t, report.Segments[0].Backup)
+
+	verifyReport, err := wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.True(t, verifyReport.Corrupt, "A dry run should not modify the segments")
+
+	report, err = wal.RepairDir(dirPath, false, true)
+	assert.NoError(t, err)
+	assert.Len(t, report.Segments, 2)
+	assert.Equal(t, filepath.Join(dirPath, "repair-backups"), filepath.Dir(report.Segments[0].Backup))
+	assert.Equal(t, bytes.Replace(original, []byte("entry4"), []byte("entrX4"), 1), mustReadFile(t, report.Segments[0].Backup))
+
+	verifyReport, err = wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.False(t, verifyReport.Corrupt)
+
+	// The repaired WAL opens, and the backups are not unknown files.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err)
+	defer walog.Close()
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return data
+}
+
+// Segments are repaired concurrently, and the report lists them in order.
+func TestRepairDir_Concurrent(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestRepairDir_Concurrent"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 20)
+	assert.NoError(t, err, "Failed to create WAL")
+	for i := 0; i < 12; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+		assert.NoError(t, walog.Rotate())
+	}
+	assert.NoError(t, walog.Close())
+
+	var corrupted []string
+	for i := 0; i < 12; i += 2 {
+		segment := filepath.Join(dirPath, "segment-"+strconv.Itoa(i))
+		appendToSegment(t, segment, []byte("random data"))
+		corrupted = append(corrupted, segment)
+	}
+
+	report, err := wal.RepairDir(dirPath, false, true, wal.WithRepairConcurrency(4))
+	assert.NoError(t, err)
+	var repaired []string
+	for _, segment := range report.Segments {
+		repaired = append(repaired, segment.Path)
+		assert.Equal(t, 1, segment.EntriesKept)
+		assert.FileExists(t, segment.Backup)
+	}
+	assert.Equal(t, corrupted, repaired)
+
+	verifyReport, err := wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.False(t, verifyReport.Corrupt)
+}
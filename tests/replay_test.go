@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// onceApplier commits the entries it applies and its progress together, failing after failAfter entries.
+type onceApplier struct {
+	failAfter int
+	applied   []string
+	progress  wal.ReplayProgress
+}
+
+func (a *onceApplier) Progress() (wal.ReplayProgress, error) {
+	return a.progress, nil
+}
+
+func (a *onceApplier) Apply(entry *wal.WAL_Entry, progress wal.ReplayProgress) error {
+	if a.failAfter >= 0 && len(a.applied) >= a.failAfter {
+		return errors.New("crashed")
+	}
+	a.applied = append(a.applied, string(entry.GetData()))
+	a.progress = progress
+	return nil
+}
+
+func TestReplayOnce(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestReplayOnce"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntryOpts([]byte("charge-1"), wal.WithKey([]byte("order-1"))))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("charge-2"), wal.WithKey([]byte("order-2"))))
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+	// A write retried by the producer is applied once.
+	assert.NoError(t, walog.WriteEntryOpts([]byte("charge-1 again"), wal.WithKey([]byte("order-1"))))
+	assert.NoError(t, walog.WriteEntry([]byte("charge-3")))
+
+	// The replay fails after the first entry, and resumes after it.
+	applier := &onceApplier{failAfter: 1}
+	applied, err := wal.ReplayOnce(walog, applier, wal.WithIdempotencyWindow(10))
+	assert.Error(t, err)
+	assert.Equal(t, 1, applied)
+	assert.Equal(t, wal.ReplayProgress{Applied: 1, Keys: []string{"order-1"}}, applier.progress)
+
+	applier.failAfter = -1
+	applied, err = wal.ReplayOnce(walog, applier, wal.WithIdempotencyWindow(10))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.Equal(t, []string{"charge-1", "charge-2", "charge-3"}, applier.applied)
+	assert.Equal(t, uint64(5), applier.progress.Applied)
+
+	// Nothing is applied twice.
+	applied, err = wal.ReplayOnce(walog, applier, wal.WithIdempotencyWindow(10))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	// Only the last keys are remembered.
+	assert.NoError(t, walog.WriteEntryOpts([]byte("charge-4"), wal.WithKey([]byte("order-4"))))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("charge-2 again"), wal.WithKey([]byte("order-2"))))
+	applied, err = wal.ReplayOnce(walog, applier, wal.WithIdempotencyWindow(1))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.Equal(t, []string{"order-2"}, applier.progress.Keys)
+}
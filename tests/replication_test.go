@@ -0,0 +1,625 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/replication"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// startReplicationServer serves the Replication service of server in memory and returns a client for it.
+func startReplicationServer(t *testing.T, server replication.ReplicationServer) replication.ReplicationClient {
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	replication.RegisterReplicationServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return replication.NewReplicationClient(conn)
+}
+
+// receiveEntries receives the next message with entries, skipping heartbeats, and returns their data.
+func receiveEntries(t *testing.T, stream replication.Replication_StreamClient) ([]string, []byte) {
+	for {
+		response, err := stream.Recv()
+		if !assert.NoError(t, err) {
+			return nil, nil
+		}
+		if response.GetEntries() == nil {
+			continue
+		}
+
+		var data []string
+		for _, marshaledEntry := range response.GetEntries().GetEntries() {
+			var entry wal.WAL_Entry
+			assert.NoError(t, proto.Unmarshal(marshaledEntry, &entry))
+			data = append(data, string(entry.GetData()))
+		}
+		return data, response.GetEntries().GetResumeToken()
+	}
+}
+
+func TestReplicationServer(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestReplicationServer"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 1; i <= 4; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+	}
+	assert.NoError(t, walog.Sync())
+
+	server := replication.NewServer(walog, replication.WithServerID("primary"))
+	client := startReplicationServer(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Stream(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&replication.StreamRequest{Request: &replication.StreamRequest_Start{
+		Start: &replication.Start{FollowerId: "replica-1", AfterLogSequenceNumber: 1, Window: 2},
+	}}))
+
+	// Only a window of entries is sent until they are acknowledged.
+	data, _ := receiveEntries(t, stream)
+	assert.Equal(t, []string{"entry2", "entry3"}, data)
+	assert.NoError(t, stream.Send(&replication.StreamRequest{Request: &replication.StreamRequest_Ack{
+		Ack: &replication.Ack{AppliedLogSequenceNumber: 3, DurableLogSequenceNumber: 2},
+	}}))
+	data, token := receiveEntries(t, stream)
+	assert.Equal(t, []string{"entry4"}, data)
+
+	// New entries are streamed as they are written.
+	assert.NoError(t, walog.WriteEntry([]byte("entry5")))
+	data, _ = receiveEntries(t, stream)
+	assert.Equal(t, []string{"entry5"}, data)
+
+	assert.Eventually(t, func() bool {
+		followers := server.Followers()
+		return len(followers) == 1 && followers[0].SentLogSequenceNumber == 5
+	}, time.Second, time.Millisecond)
+	follower := server.Followers()[0]
+	assert.Equal(t, "replica-1", follower.ID)
+	assert.True(t, follower.Connected)
+	assert.Equal(t, uint64(3), follower.AppliedLogSequenceNumber)
+	assert.Equal(t, uint64(2), follower.DurableLogSequenceNumber)
+	cancel()
+	assert.Eventually(t, func() bool { return !server.Followers()[0].Connected }, time.Second, time.Millisecond)
+
+	// A resume token resumes the stream after the last entry of its batch.
+	stream, err = client.Stream(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&replication.StreamRequest{Request: &replication.StreamRequest_Start{
+		Start: &replication.Start{FollowerId: "replica-1", ResumeToken: token},
+	}}))
+	data, _ = receiveEntries(t, stream)
+	assert.Equal(t, []string{"entry5"}, data)
+	assert.NoError(t, stream.CloseSend())
+}
+
+func TestReplicationServer_ResumeTokenFromAnotherServer(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestReplicationServer_ResumeTokenFromAnotherServer"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	client := startReplicationServer(t, replication.NewServer(walog, replication.WithServerID("primary")))
+
+	token, err := proto.Marshal(&replication.ResumeToken{ServerId: "other", LogSequenceNumber: 10})
+	assert.NoError(t, err)
+	stream, err := client.Stream(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&replication.StreamRequest{Request: &replication.StreamRequest_Start{
+		Start: &replication.Start{FollowerId: "replica-1", ResumeToken: token},
+	}}))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestReplicationServer_FollowerID(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestReplicationServer_FollowerID"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	server := replication.NewServer(walog)
+	client := startReplicationServer(t, server)
+
+	start := func(ctx context.Context, id string) replication.Replication_StreamClient {
+		stream, err := client.Stream(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&replication.StreamRequest{Request: &replication.StreamRequest_Start{
+			Start: &replication.Start{FollowerId: id},
+		}}))
+		return stream
+	}
+
+	// Followers without an ID can't be counted towards the quorum.
+	_, err = start(context.Background(), "").Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start(ctx, "replica-1")
+	assert.Eventually(t, func() bool {
+		followers := server.Followers()
+		return len(followers) == 1 && followers[0].Connected
+	}, 5*time.Second, time.Millisecond)
+	_, err = start(context.Background(), "replica-1").Recv()
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestReplicationServer_Heartbeat(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestReplicationServer_Heartbeat"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+
+	client := startReplicationServer(t, replication.NewServer(walog, replication.WithHeartbeatInterval(time.Millisecond)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Stream(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&replication.StreamRequest{Request: &replication.StreamRequest_Start{
+		Start: &replication.Start{FollowerId: "replica-1", AfterLogSequenceNumber: 1},
+	}}))
+
+	response, err := stream.Recv()
+	assert.NoError(t, err)
+	if assert.NotNil(t, response.GetHeartbeat()) {
+		assert.Equal(t, uint64(1), response.GetHeartbeat().GetLastLogSequenceNumber())
+	}
+}
+
+func TestReplicationServer_SyncedEntries(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestReplicationServer_SyncedEntries"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Hour))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Sync())
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Flush())
+	assert.Equal(t, uint64(1), walog.SyncedSequenceNumber())
+
+	server := replication.NewServer(walog, replication.WithHeartbeatInterval(time.Millisecond))
+	client := startReplicationServer(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Stream(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&replication.StreamRequest{Request: &replication.StreamRequest_Start{
+		Start: &replication.Start{FollowerId: "replica-1"},
+	}}))
+
+	// Entries that are flushed but not synced could still be lost by the primary, they aren't sent.
+	data, _ := receiveEntries(t, stream)
+	assert.Equal(t, []string{"entry1"}, data)
+	for range 5 {
+		response, err := stream.Recv()
+		if assert.NoError(t, err) {
+			assert.Nil(t, response.GetEntries())
+		}
+	}
+	assert.Equal(t, uint64(1), server.Followers()[0].SentLogSequenceNumber)
+
+	// The sync wakes up the stream, well before the sync interval.
+	assert.NoError(t, walog.Sync())
+	data, _ = receiveEntries(t, stream)
+	assert.Equal(t, []string{"entry2"}, data)
+}
+
+func TestReplicationServer_HeartbeatWhileStalled(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestReplicationServer_HeartbeatWhileStalled"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+	}
+	assert.NoError(t, walog.Sync())
+
+	client := startReplicationServer(t, replication.NewServer(walog, replication.WithHeartbeatInterval(time.Millisecond)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Stream(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&replication.StreamRequest{Request: &replication.StreamRequest_Start{
+		Start: &replication.Start{FollowerId: "replica-1", Window: 1},
+	}}))
+
+	// The window is full until the entry is acknowledged, which stalls the entries but not the heartbeats.
+	data, _ := receiveEntries(t, stream)
+	assert.Equal(t, []string{"entry1"}, data)
+	response, err := stream.Recv()
+	if assert.NoError(t, err) && assert.NotNil(t, response.GetHeartbeat()) {
+		assert.Equal(t, uint64(3), response.GetHeartbeat().GetLastLogSequenceNumber())
+	}
+}
+
+func TestReplicationFollower(t *testing.T) {
+	t.Parallel()
+	primaryPath := "TestReplicationFollower_primary"
+	followerPath := "TestReplicationFollower_follower"
+	defer os.RemoveAll(primaryPath)
+	defer os.RemoveAll(followerPath)
+
+	primary, err := wal.OpenWAL(primaryPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer primary.Close()
+	assert.NoError(t, primary.WriteEntryOpts([]byte("entry1"), wal.WithStream("orders"), wal.WithKey([]byte("k1"))))
+	assert.NoError(t, primary.CreateCheckpoint([]byte("checkpoint")))
+
+	client := startReplicationServer(t, replication.NewServer(primary))
+
+	local, err := wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	follower := replication.NewFollower(replication.GRPCTransport(client), local, replication.WithFollowerID("replica-1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- follower.Run(ctx) }()
+
+	assert.NoError(t, primary.WriteEntry([]byte("entry3")))
+	assert.Eventually(t, func() bool { return follower.DurableSequenceNumber() == 3 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, uint64(3), follower.AppliedSequenceNumber())
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.NoError(t, local.Close())
+
+	// The follower resumes after the last entry of its WAL.
+	assert.NoError(t, primary.WriteEntry([]byte("entry4")))
+	local, err = wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer local.Close()
+	// The primary may not have noticed yet that the previous stream ended, and reject the new one until it does.
+	follower = replication.NewFollower(replication.GRPCTransport(client), local,
+		replication.WithFollowerID("replica-1"), replication.WithReconnectInterval(time.Millisecond))
+	assert.Equal(t, uint64(3), follower.AppliedSequenceNumber())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go follower.Run(ctx)
+	assert.Eventually(t, func() bool { return follower.DurableSequenceNumber() == 4 }, 5*time.Second, time.Millisecond)
+
+	entries, err := local.ReadAll(false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 4) {
+		assert.Equal(t, "orders", entries[0].GetStream())
+		assert.Equal(t, []byte("k1"), entries[0].GetKey())
+		assert.True(t, entries[1].GetIsCheckpoint())
+		assert.Equal(t, []byte("entry4"), entries[3].GetData())
+	}
+	lsn, _, err := local.LastCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), lsn)
+}
+
+func TestReplicationFollower_Tombstone(t *testing.T) {
+	t.Parallel()
+	primaryPath := "TestReplicationFollower_Tombstone_primary"
+	followerPath := "TestReplicationFollower_Tombstone_follower"
+	defer os.RemoveAll(primaryPath)
+	defer os.RemoveAll(followerPath)
+
+	primary, err := wal.OpenWAL(primaryPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer primary.Close()
+	assert.NoError(t, primary.WriteEntryOpts([]byte("value1"), wal.WithStream("orders"), wal.WithKey([]byte("k1"))))
+	assert.NoError(t, primary.WriteEntryOpts(nil, wal.WithStream("orders"), wal.WithKey([]byte("k1")), wal.WithTombstone()))
+
+	client := startReplicationServer(t, replication.NewServer(primary))
+
+	local, err := wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer local.Close()
+	follower := replication.NewFollower(replication.GRPCTransport(client), local, replication.WithFollowerID("replica-1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go follower.Run(ctx)
+	assert.Eventually(t, func() bool { return follower.DurableSequenceNumber() == 2 }, 5*time.Second, time.Millisecond)
+
+	// The delete is applied as a tombstone, not as a put of an empty value.
+	entries, err := local.ReadAll(false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.False(t, entries[0].GetTombstone())
+		assert.True(t, entries[1].GetTombstone())
+		assert.Equal(t, "orders", entries[1].GetStream())
+		assert.Equal(t, []byte("k1"), entries[1].GetKey())
+	}
+}
+
+func TestReplicationFollower_Schema(t *testing.T) {
+	t.Parallel()
+	primaryPath := "TestReplicationFollower_Schema_primary"
+	followerPath := "TestReplicationFollower_Schema_follower"
+	defer os.RemoveAll(primaryPath)
+	defer os.RemoveAll(followerPath)
+
+	primary, err := wal.OpenWAL(primaryPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer primary.Close()
+	assert.NoError(t, primary.WriteEntryOpts([]byte("order1"), wal.WithSchema("example.Order", 2)))
+	assert.NoError(t, primary.WriteEntry([]byte("entry2")))
+
+	client := startReplicationServer(t, replication.NewServer(primary))
+
+	local, err := wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer local.Close()
+	follower := replication.NewFollower(replication.GRPCTransport(client), local, replication.WithFollowerID("replica-1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go follower.Run(ctx)
+	assert.Eventually(t, func() bool { return follower.DurableSequenceNumber() == 2 }, 5*time.Second, time.Millisecond)
+
+	entries, err := local.ReadAll(false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "example.Order", entries[0].GetSchema())
+		assert.Equal(t, uint32(2), entries[0].GetSchemaVersion())
+		assert.Empty(t, entries[1].GetSchema())
+		assert.Zero(t, entries[1].GetSchemaVersion())
+	}
+}
+
+func TestReplicationFollower_SequenceGap(t *testing.T) {
+	t.Parallel()
+	primaryPath := "TestReplicationFollower_SequenceGap_primary"
+	followerPath := "TestReplicationFollower_SequenceGap_follower"
+	defer os.RemoveAll(primaryPath)
+	defer os.RemoveAll(followerPath)
+
+	primary, err := wal.OpenWAL(primaryPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer primary.Close()
+	assert.NoError(t, primary.WriteEntry([]byte("entry1")))
+	assert.NoError(t, primary.WriteEntryOpts([]byte("entry5"), wal.WithSequenceNumber(5)))
+	assert.NoError(t, primary.Sync())
+
+	client := startReplicationServer(t, replication.NewServer(primary))
+
+	local, err := wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer local.Close()
+
+	err = replication.NewFollower(replication.GRPCTransport(client), local, replication.WithFollowerID("replica-1")).Run(context.Background())
+	assert.ErrorIs(t, err, replication.ErrSequenceGap)
+	assert.Equal(t, uint64(1), local.Stats().LastSequenceNumber)
+}
+
+func TestReplicationFollower_SnapshotRequired(t *testing.T) {
+	t.Parallel()
+	primaryPath := "TestReplicationFollower_SnapshotRequired_primary"
+	followerPath := "TestReplicationFollower_SnapshotRequired_follower"
+	defer os.RemoveAll(primaryPath)
+	defer os.RemoveAll(followerPath)
+
+	primary, err := wal.OpenWAL(primaryPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer primary.Close()
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, primary.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+		assert.NoError(t, primary.Rotate())
+	}
+	_, err = primary.TruncateBefore(3)
+	assert.NoError(t, err)
+
+	client := startReplicationServer(t, replication.NewServer(primary))
+
+	local, err := wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer local.Close()
+	assert.NoError(t, local.WriteEntry([]byte("entry1")))
+
+	// Entry 2 was deleted on the primary, so the follower can't resume after entry 1.
+	err = replication.NewFollower(replication.GRPCTransport(client), local, replication.WithFollowerID("replica-1")).Run(context.Background())
+	assert.ErrorIs(t, err, replication.ErrSnapshotRequired)
+	assert.Equal(t, uint64(1), local.Stats().LastSequenceNumber)
+}
+
+func TestReplicationFollower_Snapshot(t *testing.T) {
+	t.Parallel()
+	primaryPath := "TestReplicationFollower_Snapshot_primary"
+	followerPath := "TestReplicationFollower_Snapshot_follower"
+	defer os.RemoveAll(primaryPath)
+	defer os.RemoveAll(followerPath)
+
+	primary, err := wal.OpenWAL(primaryPath, true, maxFileSize, 10, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer primary.Close()
+	for i := 1; i <= 2; i++ {
+		assert.NoError(t, primary.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+		assert.NoError(t, primary.Rotate())
+	}
+	assert.NoError(t, primary.CreateCheckpoint([]byte("state")))
+	assert.NoError(t, primary.Rotate())
+	_, err = primary.TruncateBefore(3)
+	assert.NoError(t, err)
+
+	server := replication.NewServer(primary, replication.WithSnapshots(replication.CheckpointSnapshots(primary)))
+	client := startReplicationServer(t, server)
+
+	local, err := wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer local.Close()
+	assert.NoError(t, local.WriteEntry([]byte("entry1")))
+
+	// Followers that don't accept snapshots still can't resume after entry 1.
+	err = replication.NewFollower(replication.GRPCTransport(client), local, replication.WithFollowerID("replica-1")).Run(context.Background())
+	assert.ErrorIs(t, err, replication.ErrSnapshotRequired)
+
+	var restored []byte
+	follower := replication.NewFollower(replication.GRPCTransport(client), local, replication.WithFollowerID("replica-1"),
+		replication.WithSnapshotHandler(func(lsn uint64, data []byte) error {
+			assert.Equal(t, uint64(3), lsn)
+			restored = data
+			return nil
+		}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go follower.Run(ctx)
+
+	// The follower receives the checkpoint, then the entries written after it.
+	assert.NoError(t, primary.WriteEntry([]byte("entry4")))
+	assert.Eventually(t, func() bool { return follower.DurableSequenceNumber() == 4 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []byte("state"), restored)
+
+	lsn, data, err := local.LastCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), lsn)
+	assert.Equal(t, []byte("state"), data)
+	entries, err := local.ReadAll(false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, []byte("entry4"), entries[2].GetData())
+	}
+	assert.Eventually(t, func() bool { return server.Followers()[0].AppliedLogSequenceNumber == 4 }, 5*time.Second, time.Millisecond)
+}
+
+func TestReplicationServer_Quorum(t *testing.T) {
+	t.Parallel()
+	primaryPath := "TestReplicationServer_Quorum_primary"
+	followerPath := "TestReplicationServer_Quorum_follower"
+	defer os.RemoveAll(primaryPath)
+	defer os.RemoveAll(followerPath)
+
+	primary, err := wal.OpenWAL(primaryPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer primary.Close()
+	server := replication.NewServer(primary, replication.WithQuorum(1))
+	client := startReplicationServer(t, server)
+
+	// No follower is attached, so the write isn't acknowledged.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = server.WriteEntry(ctx, []byte("entry1"))
+	assert.ErrorIs(t, err, replication.ErrQuorumNotReached)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	local, err := wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer local.Close()
+	follower := replication.NewFollower(replication.GRPCTransport(client), local, replication.WithFollowerID("replica-1"))
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go follower.Run(runCtx)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, server.WriteEntry(ctx, []byte("entry2"), wal.WithStream("orders")))
+	assert.GreaterOrEqual(t, follower.DurableSequenceNumber(), uint64(2))
+	assert.NoError(t, server.WaitForDurable(ctx, 1))
+}
+
+// corruptServer streams a single entry with an invalid CRC.
+type corruptServer struct {
+	replication.UnimplementedReplicationServer
+}
+
+func (corruptServer) Stream(stream replication.Replication_StreamServer) error {
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+	entry := wal.MustMarshal(&wal.WAL_Entry{LogSequenceNumber: 1, Data: []byte("entry1"), CRC: 1})
+	return stream.Send(&replication.StreamResponse{Response: &replication.StreamResponse_Entries{
+		Entries: &replication.Entries{Entries: [][]byte{entry}},
+	}})
+}
+
+func TestReplicationFollower_CorruptEntry(t *testing.T) {
+	t.Parallel()
+	followerPath := "TestReplicationFollower_CorruptEntry"
+	defer os.RemoveAll(followerPath)
+
+	local, err := wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer local.Close()
+
+	client := startReplicationServer(t, corruptServer{})
+	err = replication.NewFollower(replication.GRPCTransport(client), local, replication.WithFollowerID("replica-1")).Run(context.Background())
+	assert.ErrorIs(t, err, wal.ErrCorruptEntry)
+	assert.Zero(t, local.Stats().LastSequenceNumber)
+}
+
+func TestReplicationFollower_TCPTransport(t *testing.T) {
+	t.Parallel()
+	primaryPath := "TestReplicationFollower_TCPTransport_primary"
+	followerPath := "TestReplicationFollower_TCPTransport_follower"
+	defer os.RemoveAll(primaryPath)
+	defer os.RemoveAll(followerPath)
+
+	primary, err := wal.OpenWAL(primaryPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer primary.Close()
+	assert.NoError(t, primary.WriteEntry([]byte("entry1")))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go replication.NewServer(primary).ServeListener(listener)
+	transport := replication.TCPTransport(listener.Addr().String())
+
+	local, err := wal.OpenWAL(followerPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer local.Close()
+	follower := replication.NewFollower(transport, local, replication.WithFollowerID("replica-1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go follower.Run(ctx)
+
+	assert.NoError(t, primary.WriteEntry([]byte("entry2")))
+	assert.Eventually(t, func() bool { return follower.DurableSequenceNumber() == 2 }, 5*time.Second, time.Millisecond)
+
+	// Errors of the stream are reported to the follower.
+	conn, err := transport.Open(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Send(&replication.StreamRequest{Request: &replication.StreamRequest_Ack{Ack: &replication.Ack{}}}))
+	_, err = conn.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestore(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestRestore"
+	targetPath := "TestRestore_target"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(targetPath)
+
+	target, err := wal.NewDirTarget(targetPath)
+	assert.NoError(t, err)
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithClock(clock), wal.WithShipping(target, time.Second))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	start := clock.Now()
+	assert.NoError(t, walog.WriteEntryOpts([]byte("entry1"), wal.WithTimestamp(start)))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("state2"), wal.WithCheckpoint(), wal.WithTimestamp(start.Add(time.Minute))))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("entry3"), wal.WithTimestamp(start.Add(2*time.Minute))))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntryOpts([]byte("state4"), wal.WithCheckpoint(), wal.WithTimestamp(start.Add(3*time.Minute))))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("entry5"), wal.WithTimestamp(start.Add(4*time.Minute))))
+	assert.NoError(t, walog.Sync())
+	assert.Eventually(t, func() bool {
+		clock.Fire()
+		return walog.Stats().Shipping.ShippedSequenceNumber == 5
+	}, 5*time.Second, time.Millisecond)
+
+	restore := func(name string, point wal.RestorePoint) (uint64, *wal.WAL) {
+		restorePath := "TestRestore_" + name
+		t.Cleanup(func() { os.RemoveAll(restorePath) })
+		lsn, err := wal.Restore(context.Background(), target, point, restorePath)
+		if !assert.NoError(t, err) {
+			return 0, nil
+		}
+		restored, err := wal.OpenWAL(restorePath, true, maxFileSize, 10, wal.WithOpenMode(wal.MustExist))
+		assert.NoError(t, err)
+		t.Cleanup(func() { restored.Close() })
+		return lsn, restored
+	}
+
+	tests := []struct {
+		name       string
+		point      wal.RestorePoint
+		last       uint64
+		checkpoint uint64
+	}{
+		{"latest", wal.RestorePoint{}, 5, 4},
+		{"lsn", wal.RestorePoint{LogSequenceNumber: 3}, 3, 2},
+		{"time", wal.RestorePoint{Time: start.Add(150 * time.Second)}, 3, 2},
+		{"lsn_and_time", wal.RestorePoint{LogSequenceNumber: 4, Time: start.Add(time.Hour)}, 4, 4},
+	}
+	for _, test := range tests {
+		lsn, restored := restore(test.name, test.point)
+		if restored == nil {
+			continue
+		}
+		assert.Equal(t, test.last, lsn, test.name)
+		assert.Equal(t, test.last, restored.Stats().LastSequenceNumber, test.name)
+		checkpoint, data, err := restored.LastCheckpoint()
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.checkpoint, checkpoint, test.name)
+		assert.Equal(t, []byte(fmt.Sprintf("state%d", test.checkpoint)), data, test.name)
+		entries, err := restored.ReadAllFromOffset(-1, false)
+		assert.NoError(t, err, test.name)
+		assert.Len(t, entries, int(test.last), test.name)
+	}
+
+	_, err = wal.Restore(context.Background(), target, wal.RestorePoint{LogSequenceNumber: 10}, "TestRestore_missing")
+	defer os.RemoveAll("TestRestore_missing")
+	assert.ErrorIs(t, err, wal.ErrRestorePointNotArchived)
+
+	// A directory holding a WAL isn't overwritten.
+	_, err = wal.Restore(context.Background(), target, wal.RestorePoint{}, dirPath)
+	assert.Error(t, err)
+}
+
+func TestRestore_FromBackup(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestRestore_FromBackup"
+	backupPath := "TestRestore_FromBackup_backup"
+	restorePath := "TestRestore_FromBackup_restore"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(backupPath)
+	defer os.RemoveAll(restorePath)
+	defer os.RemoveAll(restorePath + "_retried")
+
+	walog, err := wal.OpenWAL(dirPath, true, 256, 1000, wal.WithBlobThreshold(64))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	large := bytes.Repeat([]byte("large "), 20)
+	for i := 1; i <= 20; i++ {
+		data := []byte(fmt.Sprintf("entry %d", i))
+		if i == 5 {
+			data = large
+		}
+		assert.NoError(t, walog.WriteEntryOpts(data, wal.WithTimestamp(start.Add(time.Duration(i)*time.Minute))))
+	}
+	_, err = walog.Backup(context.Background(), backupPath)
+	assert.NoError(t, err)
+
+	_, err = wal.OpenBackup(dirPath)
+	assert.ErrorIs(t, err, wal.ErrIncompleteBackup)
+	archive, err := wal.OpenBackup(backupPath)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), archive.Manifest().LastSequenceNumber)
+
+	// The WAL is rolled back to the last entry written before the deployment at 12:12:30.
+	point := wal.RestorePoint{Time: start.Add(12*time.Minute + 30*time.Second)}
+	lsn, err := wal.Restore(context.Background(), archive, point, restorePath)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(12), lsn)
+
+	restored, err := wal.OpenWAL(restorePath, true, 256, 1000, wal.WithOpenMode(wal.MustExist))
+	assert.NoError(t, err, "Failed to open restored WAL")
+	defer restored.Close()
+	entries, err := restored.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 12)
+	assert.Equal(t, large, entries[4].GetData())
+	assert.Equal(t, []byte("entry 12"), entries[11].GetData())
+
+	// A failed restore leaves nothing behind, so it can be retried.
+	_, err = wal.Restore(context.Background(), archive, wal.RestorePoint{LogSequenceNumber: 21}, restorePath+"_retried")
+	assert.ErrorIs(t, err, wal.ErrRestorePointNotArchived)
+	lsn, err = wal.Restore(context.Background(), archive, wal.RestorePoint{LogSequenceNumber: 20}, restorePath+"_retried")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), lsn)
+	assert.NoDirExists(t, restorePath+"_retried.restoring")
+}
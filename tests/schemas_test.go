@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpconvert(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestUpconvert"
+	defer os.RemoveAll(dirPath)
+
+	// Version 1 had comma separated fields, version 2 semicolons, version 3 is upper case.
+	wal.RegisterUpconverter("TestUpconvert.order", 1, func(data []byte) ([]byte, error) {
+		return bytes.ReplaceAll(data, []byte(","), []byte(";")), nil
+	})
+	wal.RegisterUpconverter("TestUpconvert.order", 2, func(data []byte) ([]byte, error) {
+		return bytes.ToUpper(data), nil
+	})
+	wal.RegisterUpconverter("TestUpconvert.failing", 1, func(data []byte) ([]byte, error) {
+		return nil, errors.New("unknown field")
+	})
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntryOpts([]byte("a,b"), wal.WithSchema("TestUpconvert.order", 1)))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("c;d"), wal.WithSchema("TestUpconvert.order", 2)))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("E;F"), wal.WithSchema("TestUpconvert.order", 3)))
+	assert.NoError(t, walog.WriteEntry([]byte("no schema")))
+	assert.NoError(t, walog.Sync())
+
+	// The schema is stored with the entries, which are read as written by default.
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestUpconvert.order", entries[0].GetSchema())
+	assert.Equal(t, uint32(1), entries[0].GetSchemaVersion())
+	assert.Equal(t, []byte("a,b"), entries[0].GetData())
+
+	entries, err = walog.ReadAll(false, wal.WithUpconversion())
+	assert.NoError(t, err)
+	var data []string
+	for _, entry := range entries {
+		data = append(data, string(entry.GetData()))
+	}
+	assert.Equal(t, []string{"A;B", "C;D", "E;F", "no schema"}, data)
+	assert.Equal(t, uint32(3), entries[0].GetSchemaVersion())
+
+	converted, err := wal.Upconvert(entries[2])
+	assert.NoError(t, err)
+	assert.False(t, converted)
+
+	_, err = wal.Upconvert(&wal.WAL_Entry{LogSequenceNumber: 7, Schema: "TestUpconvert.failing", SchemaVersion: 1})
+	assert.EqualError(t, err, "could not upconvert entry 7 from TestUpconvert.failing version 1: unknown field")
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingTarget fails while failing is set, and ships to a DirTarget otherwise.
+type failingTarget struct {
+	*wal.DirTarget
+	lock    sync.Mutex
+	failing bool
+}
+
+func (t *failingTarget) setFailing(failing bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.failing = failing
+}
+
+func (t *failingTarget) PutTail(ctx context.Context, name string, offset int64, r io.Reader) error {
+	t.lock.Lock()
+	failing := t.failing
+	t.lock.Unlock()
+	if failing {
+		return errors.New("region unavailable")
+	}
+	return t.DirTarget.PutTail(ctx, name, offset, r)
+}
+
+func TestWAL_Shipping(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Shipping"
+	targetPath := "TestWAL_Shipping_target"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(targetPath)
+
+	dirTarget, err := wal.NewDirTarget(targetPath)
+	assert.NoError(t, err)
+	target := &failingTarget{DirTarget: dirTarget}
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, false, 64, 10, wal.WithClock(clock), wal.WithShipping(target, time.Second))
+	assert.NoError(t, err, "Failed to create WAL")
+
+	shipped := func(lsn uint64) func() bool {
+		return func() bool {
+			clock.Fire()
+			return walog.Stats().Shipping.ShippedSequenceNumber == lsn
+		}
+	}
+
+	// The tail of the active segment is shipped.
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Sync())
+	assert.Eventually(t, shipped(1), 5*time.Second, time.Millisecond)
+	segment, err := os.ReadFile(filepath.Join(dirPath, "segment-0"))
+	assert.NoError(t, err)
+	partial, err := os.ReadFile(filepath.Join(targetPath, "segment-0.partial"))
+	assert.NoError(t, err)
+	assert.Equal(t, segment, partial)
+
+	// While the target fails, the lag grows.
+	target.setFailing(true)
+	assert.NoError(t, walog.WriteEntry([]byte("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.Sync())
+	clock.Advance(10 * time.Second)
+	assert.Eventually(t, func() bool {
+		clock.Fire()
+		return walog.Stats().Shipping.Failures > 0
+	}, 5*time.Second, time.Millisecond)
+	stats := walog.Stats().Shipping
+	assert.Equal(t, uint64(2), stats.LagEntries)
+	assert.Positive(t, stats.LagBytes)
+	assert.GreaterOrEqual(t, stats.Lag, 10*time.Second)
+	assert.Contains(t, stats.LastError, "region unavailable")
+
+	// Once the target recovers, the sealed segment is shipped in full.
+	target.setFailing(false)
+	assert.Eventually(t, shipped(3), 5*time.Second, time.Millisecond)
+	stats = walog.Stats().Shipping
+	assert.Zero(t, stats.LagEntries)
+	assert.Zero(t, stats.LagBytes)
+	assert.Zero(t, stats.Lag)
+	assert.Empty(t, stats.LastError)
+	segment, err = os.ReadFile(filepath.Join(dirPath, "segment-0"))
+	assert.NoError(t, err)
+	sealed, err := os.ReadFile(filepath.Join(targetPath, "segment-0"))
+	assert.NoError(t, err)
+	assert.Equal(t, segment, sealed)
+	assert.NoFileExists(t, filepath.Join(targetPath, "segment-0.partial"))
+	assert.FileExists(t, filepath.Join(targetPath, "segment-1.partial"))
+	assert.NoError(t, walog.Close())
+
+	// Shipping resumes where it stopped.
+	walog, err = wal.OpenWAL(dirPath, false, 64, 10, wal.WithClock(clock), wal.WithShipping(target, time.Second),
+		wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err)
+	defer walog.Close()
+	assert.Equal(t, uint64(3), walog.Stats().Shipping.ShippedSequenceNumber)
+	assert.NoError(t, walog.WriteEntry([]byte("entry4")))
+	assert.NoError(t, walog.Sync())
+	assert.Eventually(t, shipped(4), 5*time.Second, time.Millisecond)
+	segment, err = os.ReadFile(filepath.Join(dirPath, "segment-1"))
+	assert.NoError(t, err)
+	partial, err = os.ReadFile(filepath.Join(targetPath, "segment-1.partial"))
+	assert.NoError(t, err)
+	assert.Equal(t, segment, partial)
+}
+
+func TestWAL_ShippingOpenFails(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ShippingOpenFails"
+	targetPath := "TestWAL_ShippingOpenFails_target"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(targetPath)
+
+	target, err := wal.NewDirTarget(targetPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(dirPath, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dirPath, "shipping"), []byte("not a position"), 0644))
+	_, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithShipping(target, time.Second))
+	assert.Error(t, err, "Expected the corrupt shipping position to fail the open")
+
+	assert.NoError(t, os.Remove(filepath.Join(dirPath, "shipping")))
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithShipping(target, time.Second))
+	assert.NoError(t, err)
+	assert.NoError(t, walog.Close())
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestSnapshotStore"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err, "Failed to create WAL")
+	store := wal.NewSnapshotStore(walog)
+
+	_, err = store.Latest()
+	assert.ErrorIs(t, err, wal.ErrNoSnapshot)
+	snapshot, entries, err := store.Load()
+	assert.NoError(t, err)
+	assert.Nil(t, snapshot)
+	assert.Empty(t, entries)
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	// An entry written after the state was taken is replayed on top of it.
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, store.Save(2, []byte("state2")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry5")))
+
+	lsn, data, err := walog.LastCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), lsn)
+	assert.Equal(t, "snapshot-00000000000000000002", string(data))
+
+	assert.Error(t, store.Save(6, []byte("state6")), "The snapshot is beyond the log")
+	assert.ErrorIs(t, store.Save(1, []byte("state1")), wal.ErrSequenceNumberTooLow)
+	assert.NoError(t, walog.Close())
+
+	// The snapshot is recovered after reopening, with the entries after it.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithUnknownFiles(wal.RejectUnknownFiles))
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	store = wal.NewSnapshotStore(walog)
+	snapshot, entries, err = store.Load()
+	assert.NoError(t, err)
+	if assert.NotNil(t, snapshot) {
+		assert.Equal(t, uint64(2), snapshot.LogSequenceNumber)
+		assert.Equal(t, []byte("state2"), snapshot.State)
+	}
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, []byte("entry3"), entries[0].GetData())
+		assert.True(t, entries[1].GetIsCheckpoint())
+		assert.Equal(t, []byte("entry5"), entries[2].GetData())
+	}
+
+	// Only the latest two snapshots are kept.
+	for _, lsn := range []uint64{5, 6, 7} {
+		assert.NoError(t, store.Save(lsn, []byte("state")))
+	}
+	files, err := filepath.Glob(filepath.Join(dirPath, "snapshots", "*"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+// A corrupted snapshot is skipped in favor of the previous one.
+func TestSnapshotStore_Corrupted(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestSnapshotStore_Corrupted"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	store := wal.NewSnapshotStore(walog)
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, store.Save(1, []byte("state1")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, store.Save(3, []byte("state3")))
+
+	path := filepath.Join(dirPath, "snapshots", "snapshot-00000000000000000003")
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+
+	snapshot, entries, err := store.Load()
+	assert.NoError(t, err)
+	if assert.NotNil(t, snapshot) {
+		assert.Equal(t, []byte("state1"), snapshot.State)
+	}
+	assert.Len(t, entries, 3)
+
+	// With no readable snapshot, Load fails rather than replaying the whole log.
+	path = filepath.Join(dirPath, "snapshots", "snapshot-00000000000000000001")
+	assert.NoError(t, os.WriteFile(path, []byte("garbage"), 0644))
+	_, _, err = store.Load()
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, wal.ErrNoSnapshot)
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStandby(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestStandby"
+	defer os.RemoveAll(dirPath)
+
+	primary, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithLease("primary", time.Minute))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, primary.WriteEntry([]byte("entry1")))
+	assert.NoError(t, primary.Rotate())
+
+	standby, err := wal.OpenStandby(dirPath, wal.WithSyncInterval(time.Millisecond), wal.WithLease("standby", time.Minute))
+	assert.NoError(t, err)
+	defer standby.Close()
+	assert.Equal(t, uint64(1), standby.LastSequenceNumber())
+
+	// The standby follows the entries appended by the primary.
+	for i := 2; i <= 3; i++ {
+		assert.NoError(t, primary.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+	}
+	assert.NoError(t, primary.Sync())
+	assert.Eventually(t, func() bool { return standby.LastSequenceNumber() == 3 }, 5*time.Second, time.Millisecond)
+	assert.NoError(t, standby.Err())
+
+	var entries []*wal.WAL_Entry
+	tail, err := standby.Tail(2)
+	assert.NoError(t, err)
+	assert.NoError(t, tail.Read(func(entry *wal.WAL_Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	tail.Stop()
+	assert.Len(t, entries, 2)
+
+	// The standby can't take over while the primary holds the lease.
+	_, err = standby.Promote(true, maxFileSize, 10)
+	assert.ErrorIs(t, err, wal.ErrLeaseHeld)
+	assert.NoError(t, primary.Close())
+
+	promoted, err := standby.Promote(true, maxFileSize, 10)
+	assert.NoError(t, err)
+	defer promoted.Close()
+	assert.Equal(t, uint64(3), promoted.Stats().LastSequenceNumber)
+	lsn, err := promoted.AppendEntry([]byte("entry4"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), lsn)
+
+	_, err = standby.Promote(true, maxFileSize, 10)
+	assert.ErrorIs(t, err, wal.ErrPromoted)
+}
+
+func TestStandby_ShippingTarget(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestStandby_ShippingTarget"
+	targetPath := "TestStandby_ShippingTarget_target"
+	defer os.RemoveAll(dirPath)
+	defer os.RemoveAll(targetPath)
+
+	target, err := wal.NewDirTarget(targetPath)
+	assert.NoError(t, err)
+	clock := newFakeClock()
+	primary, err := wal.OpenWAL(dirPath, true, maxFileSize, 10, wal.WithClock(clock), wal.WithShipping(target, time.Minute))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer primary.Close()
+	assert.NoError(t, primary.WriteEntry([]byte("entry1")))
+	assert.NoError(t, primary.Rotate())
+	assert.NoError(t, primary.WriteEntry([]byte("entry2")))
+	assert.NoError(t, primary.Sync())
+	clock.Fire()
+	assert.Eventually(t, func() bool {
+		stats := primary.Stats().Shipping
+		return stats != nil && stats.ShippedSequenceNumber == 2
+	}, 5*time.Second, time.Millisecond)
+
+	// Only the sealed segment is followed, the tail of the current one is adopted on promotion.
+	standby, err := wal.OpenStandby(targetPath)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), standby.LastSequenceNumber())
+
+	promoted, err := standby.Promote(true, maxFileSize, 10)
+	assert.NoError(t, err)
+	defer promoted.Close()
+	assert.Equal(t, uint64(2), promoted.Stats().LastSequenceNumber)
+
+	var data []string
+	err = wal.TailDir(context.Background(), targetPath, 0, false, func(entry *wal.WAL_Entry) error {
+		data = append(data, string(entry.GetData()))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"entry1", "entry2"}, data)
+}
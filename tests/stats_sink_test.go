@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/walotel"
+	"github.com/ashwaniYDV/goWAL/walprom"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestWAL_StatsSink(t *testing.T) {
+	t.Parallel()
+	dirPath := t.TempDir()
+
+	var lock sync.Mutex
+	var reports []wal.Stats
+	sink := wal.StatsSinkFunc(func(stats wal.Stats) {
+		lock.Lock()
+		defer lock.Unlock()
+		reports = append(reports, stats)
+	})
+	reported := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(reports)
+	}
+
+	clock := newFakeClock()
+	promSink := walprom.NewSink(nil)
+	expvarSink, err := wal.NewExpvarSink("TestWAL_StatsSink")
+	assert.NoError(t, err)
+	metricReader := sdkmetric.NewManualReader()
+	otelSink, err := walotel.NewSink(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader)).Meter("test"))
+	assert.NoError(t, err)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock),
+		wal.WithStatsSink(sink, time.Second),
+		wal.WithStatsSink(promSink, time.Second),
+		wal.WithStatsSink(expvarSink, time.Second),
+		wal.WithStatsSink(otelSink, time.Second))
+	assert.NoError(t, err, "Failed to create WAL")
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.Equal(t, 0, reported(), "Stats should only be reported when the interval elapses")
+
+	clock.Fire()
+	assert.Eventually(t, func() bool { return reported() == 1 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return otelSink.Stats().EntriesWritten == 1 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return expvarSink.Stats().EntriesWritten == 1 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return promSink.Stats().EntriesWritten == 1 }, time.Second, time.Millisecond)
+
+	lock.Lock()
+	assert.Equal(t, uint64(1), reports[0].LastSequenceNumber)
+	lock.Unlock()
+
+	// The adapters expose the reported stats.
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(promSink))
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "gowal_entries_written_total" {
+			assert.Equal(t, float64(1), family.GetMetric()[0].GetCounter().GetValue())
+		}
+	}
+	problems, err := testutil.CollectAndLint(promSink)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	var published wal.Stats
+	assert.NoError(t, json.Unmarshal([]byte(expvar.Get("TestWAL_StatsSink").String()), &published))
+	assert.Equal(t, uint64(1), published.EntriesWritten)
+
+	var metrics metricdata.ResourceMetrics
+	assert.NoError(t, metricReader.Collect(context.Background(), &metrics))
+	var entriesWritten int64
+	for _, m := range metrics.ScopeMetrics[0].Metrics {
+		if m.Name == "wal.entries.written" {
+			entriesWritten = m.Data.(metricdata.Sum[int64]).DataPoints[0].Value
+		}
+	}
+	assert.Equal(t, int64(1), entriesWritten)
+
+	// No more reports once the WAL is closed.
+	assert.NoError(t, walog.Close())
+	clock.Fire()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, reported())
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"encoding/json"
+	"expvar"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_Stats(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Stats"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	walog, err := wal.OpenWAL(dirPath, true, 64, 5, wal.WithClock(clock))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	stats := walog.Stats()
+	assert.Equal(t, uint64(0), stats.EntriesWritten)
+	assert.Equal(t, 1, stats.SegmentCount)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("0123456789abcdef0123456789abcdef")))
+	}
+
+	stats = walog.Stats()
+	assert.Equal(t, uint64(5), stats.EntriesWritten)
+	assert.Equal(t, uint64(5), stats.LastSequenceNumber)
+	assert.Greater(t, stats.BytesWritten, uint64(5*32))
+	assert.Greater(t, stats.Rotations, uint64(0), "Expected the small segment size to force rotations")
+	assert.Equal(t, int(stats.Rotations)+1, stats.SegmentCount)
+	assert.Greater(t, stats.BufferedBytes, 0)
+
+	assert.NoError(t, walog.Sync())
+
+	stats = walog.Stats()
+	assert.Equal(t, 0, stats.BufferedBytes)
+	assert.Greater(t, stats.ActiveSegmentSize, int64(0))
+	assert.Equal(t, stats.Rotations+1, stats.Fsyncs, "Expected one fsync per rotation plus the explicit sync")
+	assert.Equal(t, clock.Now(), stats.LastSyncTime)
+}
+
+func TestWAL_PublishExpvar(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_PublishExpvar"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.PublishExpvar("TestWAL_PublishExpvar"))
+	assert.Error(t, walog.PublishExpvar("TestWAL_PublishExpvar"), "Publishing the same name twice should fail")
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+
+	var stats wal.Stats
+	assert.NoError(t, json.Unmarshal([]byte(expvar.Get("TestWAL_PublishExpvar").String()), &stats))
+	assert.Equal(t, uint64(1), stats.EntriesWritten)
+	assert.Equal(t, uint64(1), stats.LastSequenceNumber)
+}
+
+func TestWAL_SlowSyncCallback(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_SlowSyncCallback"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	var slow atomic.Bool
+	fs := &faultyFS{onSync: func() {
+		if slow.Load() {
+			clock.Advance(300 * time.Millisecond)
+		} else {
+			clock.Advance(time.Millisecond)
+		}
+	}}
+
+	var slowSyncs []time.Duration
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments,
+		wal.WithClock(clock), wal.WithFS(fs),
+		wal.WithOnSlowSync(100*time.Millisecond, func(d time.Duration) {
+			slowSyncs = append(slowSyncs, d)
+		}))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	for i := 0; i < 9; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+		assert.NoError(t, walog.Sync())
+	}
+	assert.Empty(t, slowSyncs)
+
+	slow.Store(true)
+	assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	assert.NoError(t, walog.Sync())
+	assert.Equal(t, []time.Duration{300 * time.Millisecond}, slowSyncs)
+
+	stats := walog.Stats()
+	assert.Equal(t, uint64(10), stats.FsyncLatency.Count)
+	assert.Equal(t, uint64(1), stats.SlowSyncs)
+	assert.LessOrEqual(t, stats.FsyncLatencyP50, time.Millisecond)
+	assert.Greater(t, stats.FsyncLatencyP99, 250*time.Millisecond)
+	assert.LessOrEqual(t, stats.FsyncLatencyP50, stats.FsyncLatencyP95)
+	assert.LessOrEqual(t, stats.FsyncLatencyP95, stats.FsyncLatencyP99)
+}
+
+func TestWAL_FlushStats(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_FlushStats"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, false, maxFileSize, maxSegments, wal.WithClock(newFakeClock()))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	stats := walog.Stats()
+	assert.Greater(t, stats.BufferSize, 0)
+	assert.Equal(t, uint64(0), stats.Flushes)
+
+	assert.NoError(t, walog.WriteEntry([]byte("small")))
+	assert.NoError(t, walog.Flush())
+	assert.NoError(t, walog.Flush(), "Flushing an empty buffer should not count as a flush")
+
+	stats = walog.Stats()
+	assert.Equal(t, uint64(1), stats.Flushes)
+	assert.Equal(t, stats.BytesWritten, stats.FlushedBytes)
+	assert.Equal(t, int(stats.BytesWritten), stats.LastFlushSize)
+	assert.Equal(t, int(stats.BytesWritten)-segmentHeaderSize, stats.LargestEntrySize, "The segment header isn't an entry")
+
+	// An entry larger than the buffer forces flushes without an explicit call.
+	large := make([]byte, 2*stats.BufferSize)
+	assert.NoError(t, walog.WriteEntry(large))
+
+	stats = walog.Stats()
+	assert.Greater(t, stats.Flushes, uint64(1))
+	assert.Greater(t, stats.LargestEntrySize, len(large))
+	assert.Equal(t, stats.BytesWritten, stats.FlushedBytes+uint64(stats.BufferedBytes))
+
+	assert.NoError(t, walog.WriteEntry([]byte("small")))
+	assert.Greater(t, walog.Stats().LargestEntrySize, len(large), "Largest entry should not shrink")
+}
+
+func TestWAL_WriteAmplification(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_WriteAmplification"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, 64, 2, wal.WithClock(newFakeClock()))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.Equal(t, float64(0), walog.Stats().WriteAmplification)
+
+	data := []byte("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, walog.WriteEntry(data))
+	}
+	assert.NoError(t, walog.Sync())
+
+	stats := walog.Stats()
+	assert.Equal(t, uint64(3*len(data)), stats.LogicalBytesWritten)
+	assert.Equal(t, stats.BytesWritten, stats.PhysicalBytesWritten, "Only segment data should have been written")
+	assert.Greater(t, stats.WriteAmplification, float64(1))
+	assert.Equal(t, uint64(1), stats.SegmentsDeleted)
+	assert.Equal(t, stats.BytesWritten/3, stats.RetentionBytesDeleted, "The first segment holds one entry")
+
+	// Checkpoints are also written to the checkpoint file.
+	assert.NoError(t, walog.CreateCheckpoint(data))
+	stats = walog.Stats()
+	assert.Greater(t, stats.PhysicalBytesWritten, stats.BytesWritten)
+}
+
+func TestWAL_WriteAndSyncLatency(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_WriteAndSyncLatency"
+	defer os.RemoveAll(dirPath)
+
+	clock := newFakeClock()
+	fs := &faultyFS{onSync: func() { clock.Advance(20 * time.Millisecond) }}
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithClock(clock), wal.WithFS(fs))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	}
+	assert.NoError(t, walog.Sync())
+
+	stats := walog.Stats()
+	assert.Equal(t, uint64(10), stats.WriteLatency.Count)
+	assert.LessOrEqual(t, stats.WriteLatencyP99, time.Microsecond, "The fake clock doesn't advance during writes")
+	assert.Equal(t, uint64(1), stats.SyncLatency.Count)
+	assert.Equal(t, 20*time.Millisecond, stats.SyncLatency.Sum)
+	assert.Greater(t, stats.SyncLatencyP50, 10*time.Millisecond)
+	assert.LessOrEqual(t, stats.SyncLatencyP99, 25*time.Millisecond)
+}
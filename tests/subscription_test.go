@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_Subscribe(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Subscribe"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	var mu sync.Mutex
+	var handled []string
+	failed := false
+	handler := func(entry *wal.WAL_Entry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// The handler fails once on the second entry, which is retried.
+		if entry.GetLogSequenceNumber() == 2 && !failed {
+			failed = true
+			return errors.New("downstream unavailable")
+		}
+		handled = append(handled, string(entry.GetData()))
+		return nil
+	}
+	handledEntries := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), handled...)
+	}
+
+	for _, data := range []string{"one", "two", "three"} {
+		assert.NoError(t, walog.WriteEntry([]byte(data)))
+	}
+	subscription, err := walog.Subscribe("indexer", 0, handler, wal.WithRetryBackoff(time.Millisecond, time.Millisecond))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return subscription.Delivered() == 3 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []string{"one", "two", "three"}, handledEntries())
+
+	// Entries written while subscribed are delivered.
+	assert.NoError(t, walog.WriteEntry([]byte("four")))
+	assert.Eventually(t, func() bool { return subscription.Delivered() == 4 }, 5*time.Second, time.Millisecond)
+	assert.NoError(t, subscription.Close())
+	assert.NoError(t, subscription.Err())
+
+	// A subscription of the same name resumes after the last entry delivered, whatever fromLSN.
+	assert.NoError(t, walog.WriteEntry([]byte("five")))
+	subscription, err = walog.Subscribe("indexer", 1, handler, wal.WithCommitEvery(10))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return subscription.Delivered() == 5 }, 5*time.Second, time.Millisecond)
+	assert.NoError(t, subscription.Close())
+	assert.Equal(t, []string{"one", "two", "three", "four", "five"}, handledEntries())
+
+	// A handler failing more than the attempts allowed ends the subscription.
+	subscription, err = walog.Subscribe("failing", 1, func(entry *wal.WAL_Entry) error {
+		return errors.New("poison entry")
+	}, wal.WithRetryBackoff(time.Millisecond, time.Millisecond), wal.WithMaxAttempts(3))
+	assert.NoError(t, err)
+	select {
+	case <-subscription.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription didn't end")
+	}
+	assert.ErrorContains(t, subscription.Err(), "after 3 attempts")
+	assert.Equal(t, uint64(0), subscription.Delivered())
+	assert.Error(t, subscription.Close())
+}
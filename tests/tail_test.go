@@ -0,0 +1,294 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTailDir(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTailDir"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	for i := 1; i <= 6; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+		if i%2 == 0 {
+			assert.NoError(t, walog.Rotate())
+		}
+	}
+	// Buffered entries are not visible to other processes yet.
+	assert.NoError(t, walog.WriteEntry([]byte("entry7")))
+
+	var sequenceNumbers []uint64
+	err = wal.TailDir(context.Background(), dirPath, 3, false, func(entry *wal.WAL_Entry) error {
+		sequenceNumbers = append(sequenceNumbers, entry.GetLogSequenceNumber())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{3, 4, 5, 6}, sequenceNumbers)
+}
+
+func TestTail_ReadUntil(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTail_ReadUntil"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 1; i <= 4; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+		if i == 2 {
+			assert.NoError(t, walog.Rotate())
+		}
+	}
+	assert.NoError(t, walog.Flush())
+
+	tail, err := walog.Tail(0)
+	assert.NoError(t, err)
+	defer tail.Stop()
+
+	var sequenceNumbers []uint64
+	read := func(entry *wal.WAL_Entry) error {
+		sequenceNumbers = append(sequenceNumbers, entry.GetLogSequenceNumber())
+		return nil
+	}
+	// The entries after the limit are read by the next call, across segments too.
+	assert.NoError(t, tail.ReadUntil(1, read))
+	assert.Equal(t, []uint64{1}, sequenceNumbers)
+	assert.NoError(t, tail.ReadUntil(3, read))
+	assert.Equal(t, []uint64{1, 2, 3}, sequenceNumbers)
+	assert.NoError(t, tail.Read(read))
+	assert.Equal(t, []uint64{1, 2, 3, 4}, sequenceNumbers)
+}
+
+func TestTail_WaitWokenByFlush(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTail_WaitWokenByFlush"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(time.Hour))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	tail, err := walog.Tail(0)
+	assert.NoError(t, err)
+	defer tail.Stop()
+
+	var data []string
+	read := func(entry *wal.WAL_Entry) error {
+		data = append(data, string(entry.GetData()))
+		return nil
+	}
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, tail.Read(read))
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+		assert.NoError(t, walog.Flush())
+
+		// Wait returns once the entry is flushed, not after the sync interval.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		assert.NoError(t, tail.Wait(ctx))
+		cancel()
+	}
+	assert.NoError(t, tail.Read(read))
+	assert.Equal(t, []string{"entry1", "entry2", "entry3"}, data)
+}
+
+func TestTail_SegmentRewritten(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTail_SegmentRewritten"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+	}
+	assert.NoError(t, walog.Flush())
+
+	tail, err := walog.Tail(0)
+	assert.NoError(t, err)
+	defer tail.Stop()
+	var sequenceNumbers []uint64
+	read := func(entry *wal.WAL_Entry) error {
+		sequenceNumbers = append(sequenceNumbers, entry.GetLogSequenceNumber())
+		return nil
+	}
+	assert.NoError(t, tail.ReadUntil(1, read))
+
+	// The segment file kept open by the tail is replaced, the tail reads the new one.
+	_, err = walog.TruncateAfter(2)
+	assert.NoError(t, err)
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.Flush())
+	assert.NoError(t, tail.Read(read))
+	assert.Equal(t, []uint64{1, 2, 3}, sequenceNumbers)
+}
+
+func TestTailDir_Follow(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTailDir_Follow"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Flush())
+
+	errDone := errors.New("done")
+	entries := make(chan string, 10)
+	tailErr := make(chan error, 1)
+	go func() {
+		tailErr <- wal.TailDir(context.Background(), dirPath, 0, true, func(entry *wal.WAL_Entry) error {
+			entries <- string(entry.GetData())
+			if entry.GetLogSequenceNumber() == 3 {
+				return errDone
+			}
+			return nil
+		}, wal.WithSyncInterval(time.Millisecond))
+	}()
+
+	assert.Equal(t, "entry1", <-entries)
+
+	// New entries are followed across rotations.
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.NoError(t, walog.Flush())
+
+	assert.Equal(t, "entry2", <-entries)
+	assert.Equal(t, "entry3", <-entries)
+	assert.ErrorIs(t, <-tailErr, errDone)
+}
+
+func TestTailDir_ContextCancelled(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTailDir_ContextCancelled"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = wal.TailDir(ctx, dirPath, 0, true, func(*wal.WAL_Entry) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTailDir_EntriesDeleted(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTailDir_EntriesDeleted"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	for i := 1; i <= 6; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+		if i%2 == 0 {
+			assert.NoError(t, walog.Rotate())
+		}
+	}
+	deleted, err := walog.TruncateBefore(5)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	read := func(fromLSN uint64) ([]uint64, error) {
+		var sequenceNumbers []uint64
+		err := wal.TailDir(context.Background(), dirPath, fromLSN, false, func(entry *wal.WAL_Entry) error {
+			sequenceNumbers = append(sequenceNumbers, entry.GetLogSequenceNumber())
+			return nil
+		})
+		return sequenceNumbers, err
+	}
+
+	_, err = read(3)
+	assert.ErrorIs(t, err, wal.ErrEntriesDeleted)
+
+	// Reading from the oldest entry still in the log, or from the start of the log, is fine.
+	sequenceNumbers, err := read(5)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{5, 6}, sequenceNumbers)
+	sequenceNumbers, err = read(0)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{5, 6}, sequenceNumbers)
+}
+
+func TestTail_EntriesDeletedWhileReading(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTail_EntriesDeletedWhileReading"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.Rotate())
+
+	tail, err := walog.Tail(1)
+	assert.NoError(t, err)
+	defer tail.Stop()
+	var sequenceNumbers []uint64
+	collect := func(entry *wal.WAL_Entry) error {
+		sequenceNumbers = append(sequenceNumbers, entry.GetLogSequenceNumber())
+		return nil
+	}
+	assert.NoError(t, tail.Read(collect))
+	assert.Equal(t, []uint64{1}, sequenceNumbers)
+
+	// Entries 2 and 3 are deleted before the tail reads them.
+	for i := 2; i <= 4; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte(fmt.Sprintf("entry%d", i))))
+		assert.NoError(t, walog.Rotate())
+	}
+	_, err = walog.TruncateBefore(4)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, tail.Read(collect), wal.ErrEntriesDeleted)
+}
+
+func TestTailDir_EntryReuse(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestTailDir_EntryReuse"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, walog.WriteEntryOpts([]byte(fmt.Sprintf("entry%d", i)), wal.WithKey([]byte(fmt.Sprintf("key%d", i%2)))))
+	}
+	assert.NoError(t, walog.Sync())
+
+	// The same entry is passed for every record, overwritten with the next one.
+	var reused *wal.WAL_Entry
+	var data, keys []string
+	err = wal.TailDir(context.Background(), dirPath, 0, false, func(entry *wal.WAL_Entry) error {
+		if reused == nil {
+			reused = entry
+		}
+		assert.Same(t, reused, entry)
+		data = append(data, string(entry.GetData()))
+		keys = append(keys, string(entry.GetKey()))
+		return nil
+	}, wal.WithEntryReuse())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"entry1", "entry2", "entry3", "entry4", "entry5"}, data)
+	assert.Equal(t, []string{"key1", "key0", "key1", "key0", "key1"}, keys)
+}
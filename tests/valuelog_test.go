@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_ValueLog(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ValueLog"
+	defer os.RemoveAll(dirPath)
+
+	large := bytes.Repeat([]byte("large value "), 100)
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithValueLog(64))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry(large))
+	assert.NoError(t, walog.WriteEntry([]byte("small")))
+	assert.NoError(t, walog.Close())
+
+	// Appends continue in the same value log file after reopening.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithValueLog(64))
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry(bytes.ToUpper(large)))
+	assert.NoError(t, walog.Sync())
+
+	segments, err := filepath.Glob(filepath.Join(dirPath, "segment-*"))
+	assert.NoError(t, err)
+	fileInfo, err := os.Stat(segments[0])
+	assert.NoError(t, err)
+	assert.Less(t, fileInfo.Size(), int64(len(large)))
+	values, err := filepath.Glob(filepath.Join(dirPath, "valuelog", "segment-*"))
+	assert.NoError(t, err)
+	assert.Len(t, values, 1)
+	fileInfo, err = os.Stat(values[0])
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2*len(large)), fileInfo.Size())
+
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, large, entries[0].GetData())
+	assert.Nil(t, entries[0].GetValuePointer())
+	assert.Equal(t, []byte("small"), entries[1].GetData())
+	assert.Equal(t, bytes.ToUpper(large), entries[2].GetData())
+
+	var tailed [][]byte
+	assert.NoError(t, wal.TailDir(context.Background(), dirPath, 0, false, func(entry *wal.WAL_Entry) error {
+		tailed = append(tailed, entry.GetData())
+		return nil
+	}))
+	assert.Equal(t, [][]byte{large, []byte("small"), bytes.ToUpper(large)}, tailed)
+
+	// A value that doesn't match its CRC is corrupt.
+	file, err := os.OpenFile(values[0], os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = file.WriteAt([]byte("X"), 10)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	_, err = walog.ReadAll(false)
+	assert.ErrorIs(t, err, wal.ErrCorruptEntry)
+}
+
+func TestWAL_CollectValueLog(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_CollectValueLog"
+	defer os.RemoveAll(dirPath)
+
+	// Every value fills a value log file, and a few entries fill a segment.
+	walog, err := wal.OpenWAL(dirPath, true, 256, maxSegments, wal.WithValueLog(64))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	for i := 0; i < 60; i++ {
+		assert.NoError(t, walog.WriteEntry(bytes.Repeat([]byte{byte('a' + i%26)}, 200)))
+	}
+	assert.NoError(t, walog.Sync())
+	values, err := filepath.Glob(filepath.Join(dirPath, "valuelog", "segment-*"))
+	assert.NoError(t, err)
+	assert.Len(t, values, 60)
+
+	// The values of the entries of the deleted segments are reclaimed, the others are kept.
+	deleted, err := walog.CollectValueLog()
+	assert.NoError(t, err)
+	assert.Greater(t, deleted, 0)
+	values, err = filepath.Glob(filepath.Join(dirPath, "valuelog", "segment-*"))
+	assert.NoError(t, err)
+	assert.Len(t, values, 60-deleted)
+
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, entries)
+	for _, entry := range entries {
+		assert.Len(t, entry.GetData(), 200)
+	}
+	assert.Equal(t, bytes.Repeat([]byte{'a' + 59%26}, 200), entries[len(entries)-1].GetData())
+}
+
+func TestWAL_ValueLogAfterClose(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ValueLogAfterClose"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithValueLog(64))
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.Close())
+
+	// A rejected write doesn't append its value.
+	assert.ErrorIs(t, walog.WriteEntry(bytes.Repeat([]byte("large value "), 10)), wal.ErrClosed)
+	values, err := filepath.Glob(filepath.Join(dirPath, "valuelog", "segment-*"))
+	assert.NoError(t, err)
+	for _, value := range values {
+		info, err := os.Stat(value)
+		assert.NoError(t, err)
+		assert.Zero(t, info.Size())
+	}
+}
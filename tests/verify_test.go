@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestVerify"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	}
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.WriteEntry([]byte("entry4")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry5")))
+	assert.NoError(t, walog.Close())
+
+	report, err := wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.False(t, report.Corrupt)
+	assert.Len(t, report.Segments, 2)
+	assert.Equal(t, 3, report.Segments[0].Entries)
+	assert.Equal(t, uint64(4), report.Segments[1].FirstSequenceNumber)
+	assert.Equal(t, uint64(5), report.Segments[1].LastSequenceNumber)
+
+	// Corrupt the CRC of the first entry of the second segment and append a partial entry.
+	segmentPath := filepath.Join(dirPath, "segment-1")
+	content, err := os.ReadFile(segmentPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(segmentPath, bytes.Replace(content, []byte("entry4"), []byte("entrX4"), 1), 0644))
+	appendToSegment(t, segmentPath, []byte{0x10, 0x00, 0x00, 0x00, 0x01})
+
+	report, err = wal.Verify(dirPath)
+	assert.NoError(t, err)
+	assert.True(t, report.Corrupt)
+	assert.Empty(t, report.Segments[0].CorruptRanges)
+
+	segment := report.Segments[1]
+	assert.Equal(t, 1, segment.Entries, "The scan should continue past a CRC mismatch")
+	assert.Equal(t, uint64(5), segment.FirstSequenceNumber)
+	assert.Len(t, segment.CorruptRanges, 2)
+	assert.Equal(t, wal.CorruptionChecksum, segment.CorruptRanges[0].Kind)
+	assert.Equal(t, int64(segmentHeaderSize), segment.CorruptRanges[0].Start)
+	assert.Equal(t, wal.CorruptionTruncated, segment.CorruptRanges[1].Kind)
+	assert.Equal(t, int64(len(content)), segment.CorruptRanges[1].Start)
+	assert.Equal(t, segment.Size, segment.CorruptRanges[1].End)
+
+	// The report is machine-readable.
+	data, err := json.Marshal(report)
+	assert.NoError(t, err)
+	var decoded wal.VerifyReport
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, *report, decoded)
+	assert.Contains(t, string(data), `"kind":"CRC mismatch"`)
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	wal "github.com/ashwaniYDV/goWAL"
+	"google.golang.org/protobuf/proto"
 )
 
 const numEntries = 10_000_000 // Adjustable parameter for the number of entries
@@ -132,3 +133,73 @@ func prepopulateWAL(walog *wal.WAL, count int, b *testing.B) {
 
 	walog.Sync()
 }
+
+// BenchmarkEntryCodec compares the fast path codec of entries with the reflection based proto codec.
+func BenchmarkEntryCodec(b *testing.B) {
+	entry := &wal.WAL_Entry{
+		LogSequenceNumber: 123456,
+		Data:              make([]byte, 256),
+		CRC:               0xdeadbeef,
+		Labels:            map[string]string{"tenant": "acme"},
+		Stream:            "orders",
+		Key:               []byte("key123456"),
+		Timestamp:         time.Now().UnixNano(),
+	}
+	data := wal.MustMarshal(entry)
+
+	b.Run("MarshalVT", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := entry.MarshalVT(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ProtoMarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := proto.Marshal(entry); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("UnmarshalVT", func(b *testing.B) {
+		b.ReportAllocs()
+		var decoded wal.WAL_Entry
+		for i := 0; i < b.N; i++ {
+			if err := decoded.UnmarshalVT(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ProtoUnmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		var decoded wal.WAL_Entry
+		for i := 0; i < b.N; i++ {
+			if err := proto.Unmarshal(data, &decoded); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkWriteEntryAllocs reports the allocations of WriteEntry with the default options. There should
+// be none: TestWAL_WriteEntryAllocs fails otherwise.
+func BenchmarkWriteEntryAllocs(b *testing.B) {
+	directory := "benchmark_write_allocs"
+	walog, err := wal.OpenWAL(directory, false, maxFileSize, 10)
+	if err != nil {
+		b.Fatal("Failed to prepare WAL:", err)
+	}
+	defer cleanUpWAL(directory)
+	defer walog.Close()
+	data := make([]byte, 256)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := walog.WriteEntry(data); err != nil {
+			b.Fatal("Write error:", err)
+		}
+	}
+}
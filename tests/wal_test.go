@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	wal "github.com/ashwaniYDV/goWAL"
@@ -18,6 +20,8 @@ import (
 const (
 	maxSegments = 3
 	maxFileSize = 64 * 1000 * 1000 // 64MB
+	// segmentHeaderSize is the size of the header segments start with.
+	segmentHeaderSize = 8
 )
 
 func TestWAL_WriteAndRecover(t *testing.T) {
@@ -339,6 +343,54 @@ func TestWAL_ReadFromOffset(t *testing.T) {
 	assertCollectionsAreIdentical(t, entries, recoveredEntries)
 }
 
+// The slices returned by the read APIs are sized from the entry counts of the segments, or the capacity hint.
+func TestWAL_ReadCapacityHint(t *testing.T) {
+	t.Parallel()
+	directory := "TestWAL_ReadCapacityHint"
+	defer os.RemoveAll(directory)
+
+	walog, err := wal.OpenWAL(directory, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	}
+	assert.NoError(t, walog.Rotate())
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, walog.WriteEntry([]byte("entry")))
+	}
+	assert.NoError(t, walog.Sync())
+
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 15)
+	assert.Equal(t, 15, cap(entries))
+
+	entries, err = walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+	assert.Equal(t, 5, cap(entries))
+
+	entries, err = walog.ReadAllFromOffset(-1, false, wal.WithCapacityHint(100))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 15)
+	assert.Equal(t, 100, cap(entries))
+	assert.NoError(t, walog.Close())
+
+	// After reopening, the count of the current segment is known, and sealed segments are counted once read.
+	walog, err = wal.OpenWAL(directory, true, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to reopen WAL")
+	defer walog.Close()
+
+	entries, err = walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 15)
+
+	entries, err = walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 15)
+	assert.Equal(t, 15, cap(entries))
+}
+
 func generateTestData() []Record {
 	entries := []Record{}
 
@@ -551,3 +603,130 @@ func TestWAL_NoWritesAfterCheckpoint(t *testing.T) {
 	assert.Equal(t, true, recoveredEntries[0].GetIsCheckpoint(), "Expected checkpoint entry")
 	assert.Equal(t, []byte("checkpoint info"), recoveredEntries[0].GetData(), "Checkpoint info does not match")
 }
+
+func TestWAL_SequenceNumberAfterRotation(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_SequenceNumberAfterRotation"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.Close())
+
+	// The current segment is empty, numbering continues from the previous segment.
+	walog, err = wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err)
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntry([]byte("entry3")))
+	assert.Equal(t, uint64(3), walog.Stats().LastSequenceNumber)
+}
+
+// Concurrent writers get distinct, consecutive sequence numbers, and a rejected write only fails its writer.
+func TestWAL_ConcurrentWriters(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_ConcurrentWriters"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	const writers, entries = 16, 200
+	lsns := make([][]uint64, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < entries; j++ {
+				lsn, err := walog.AppendEntry([]byte(fmt.Sprintf("writer%d-entry%d", i, j)))
+				assert.NoError(t, err)
+				lsns[i] = append(lsns[i], lsn)
+
+				_, err = walog.AppendEntry([]byte("rejected"), wal.WithSequenceNumber(1))
+				assert.ErrorIs(t, err, wal.ErrSequenceNumberTooLow)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, walog.Sync())
+
+	seen := make(map[uint64]bool)
+	for i := range lsns {
+		for j, lsn := range lsns[i] {
+			assert.False(t, seen[lsn], "Sequence number %d assigned twice", lsn)
+			seen[lsn] = true
+			if j > 0 {
+				assert.Greater(t, lsn, lsns[i][j-1], "A writer's entries must be in order")
+			}
+		}
+	}
+
+	read, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	assert.Len(t, read, writers*entries)
+	for i, entry := range read {
+		assert.Equal(t, uint64(i+1), entry.GetLogSequenceNumber())
+		assert.True(t, seen[entry.GetLogSequenceNumber()])
+	}
+}
+
+// Segments start with a header, followed by the entries stored as frames: the size of the
+// marshaled entry as a little-endian int32, then the entry.
+func TestWAL_FrameFormat(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_FrameFormat"
+	defer os.RemoveAll(dirPath)
+
+	// The entries of the segment don't record their checksum, UnmarshalEntry verifies them with ChecksumIEEE.
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithChecksum(wal.ChecksumIEEE))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntryOpts([]byte("entry1"), wal.WithStream("orders")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Sync())
+
+	data, err := os.ReadFile(filepath.Join(dirPath, "segment-0"))
+	assert.NoError(t, err)
+	assert.Equal(t, walog.Stats().BytesWritten, uint64(len(data)))
+	assert.Equal(t, "WAL", string(data[:3]))
+	data = data[segmentHeaderSize:]
+
+	var read []string
+	for len(data) > 0 {
+		size := int(binary.LittleEndian.Uint32(data))
+		entry, err := wal.UnmarshalEntry(data[4 : 4+size])
+		assert.NoError(t, err)
+		read = append(read, string(entry.GetData()))
+		data = data[4+size:]
+	}
+	assert.Equal(t, []string{"entry1", "entry2"}, read)
+}
+
+// raceEnabled is set when the tests are run with the race detector, see race_test.go.
+var raceEnabled bool
+
+// WriteEntry doesn't allocate with the default options, see BenchmarkWriteEntryAllocs. The test isn't
+// parallel, as AllocsPerRun counts the allocations of every goroutine.
+func TestWAL_WriteEntryAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items under the race detector")
+	}
+	dirPath := "TestWAL_WriteEntryAllocs"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, false, maxFileSize, 10)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	data := make([]byte, 256)
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		if err := walog.WriteEntry(data); err != nil {
+			t.Fatal(err)
+		}
+	})
+	assert.Zero(t, allocs, "WriteEntry allocates")
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/walchange"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWALChange_Export(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWALChange_Export"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	timestamp := time.Date(2024, 6, 1, 12, 0, 0, 500000000, time.UTC)
+	assert.NoError(t, walog.WriteEntryOpts([]byte(`{"total":42}`), wal.WithStream("orders"),
+		wal.WithKey([]byte("order1")), wal.WithTimestamp(timestamp)))
+	assert.NoError(t, walog.WriteEntry([]byte{0xff, 0x00}))
+	_, err = walog.WriteTombstone([]byte("order1"), wal.WithStream("orders"))
+	assert.NoError(t, err)
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+	assert.NoError(t, walog.Close())
+
+	var buf bytes.Buffer
+	changes, err := walchange.Export(&buf, dirPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, changes)
+
+	var lines []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.Equal(t, []string{
+		`{"op":"I","lsn":"0/1","timestamp":"2024-06-01 12:00:00.5+00","stream":"orders","key":"b3JkZXIx","payload":{"total":42}}`,
+		`{"op":"I","lsn":"0/2","payload":"/wA=","encoding":"base64"}`,
+		`{"op":"D","lsn":"0/3","stream":"orders","key":"b3JkZXIx"}`,
+		`{"op":"M","lsn":"0/4","payload":"Y2hlY2twb2ludA==","encoding":"base64"}`,
+	}, lines)
+
+	// The changes decode back, and large sequence numbers are split like PostgreSQL LSNs.
+	var change walchange.Change
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &change))
+	assert.Equal(t, []byte(`"/wA="`), []byte(change.Payload))
+	assert.Equal(t, "1/A", walchange.NewChange(&wal.WAL_Entry{LogSequenceNumber: 1<<32 | 10}).LSN)
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/waletcd"
+	"github.com/stretchr/testify/assert"
+	pb "go.etcd.io/raft/v3/raftpb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// etcdWALWriter writes WAL files in the format of etcd.
+type etcdWALWriter struct {
+	t   *testing.T
+	dir string
+	crc uint32
+	buf []byte
+	seq int
+}
+
+func (w *etcdWALWriter) record(recordType int64, data []byte) {
+	crc := w.crc
+	if recordType != 4 {
+		crc = crc32.Update(w.crc, crc32.MakeTable(crc32.Castagnoli), data)
+		w.crc = crc
+	}
+	record := protowire.AppendTag(nil, 1, protowire.VarintType)
+	record = protowire.AppendVarint(record, uint64(recordType))
+	record = protowire.AppendTag(record, 2, protowire.VarintType)
+	record = protowire.AppendVarint(record, uint64(crc))
+	record = protowire.AppendTag(record, 3, protowire.BytesType)
+	record = protowire.AppendBytes(record, data)
+
+	frame := uint64(len(record))
+	padding := (8 - len(record)%8) % 8
+	if padding != 0 {
+		frame |= uint64(0x80|padding) << 56
+	}
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, frame)
+	w.buf = append(w.buf, record...)
+	w.buf = append(w.buf, make([]byte, padding)...)
+}
+
+func (w *etcdWALWriter) entries(first, last, term uint64) {
+	for i := first; i <= last; i++ {
+		entry := pb.Entry{Index: i, Term: term, Data: []byte(fmt.Sprintf("entry%d-%d", i, term))}
+		data, err := entry.Marshal()
+		assert.NoError(w.t, err)
+		w.record(2, data)
+	}
+}
+
+// cut writes the current file, with preallocated space at its end, and starts a new one.
+func (w *etcdWALWriter) cut() {
+	w.buf = append(w.buf, make([]byte, 64)...)
+	path := filepath.Join(w.dir, fmt.Sprintf("%016x-%016x.wal", w.seq, 0))
+	assert.NoError(w.t, os.WriteFile(path, w.buf, 0644))
+	w.seq++
+	w.buf = nil
+	w.record(4, nil)
+}
+
+func TestEtcdWAL_Convert(t *testing.T) {
+	t.Parallel()
+	etcdPath := "TestEtcdWAL_Convert_etcd"
+	dirPath := "TestEtcdWAL_Convert"
+	defer os.RemoveAll(etcdPath)
+	defer os.RemoveAll(dirPath)
+	assert.NoError(t, os.MkdirAll(etcdPath, 0755))
+
+	w := &etcdWALWriter{t: t, dir: etcdPath}
+	w.record(4, nil)
+	w.record(1, []byte("cluster metadata"))
+	snapshot := protowire.AppendTag(nil, 1, protowire.VarintType)
+	snapshot = protowire.AppendVarint(snapshot, 0)
+	w.record(5, snapshot)
+	w.entries(1, 5, 1)
+	w.cut()
+	// Entries 4 and 5 are overwritten by a new leader.
+	w.entries(4, 6, 2)
+	state := pb.HardState{Term: 2, Vote: 1, Commit: 5}
+	data, err := state.Marshal()
+	assert.NoError(t, err)
+	w.record(3, data)
+	w.cut()
+
+	var sequenceNumbers []uint64
+	etcdState, err := waletcd.ReadDir(etcdPath, func(entry *wal.WAL_Entry) error {
+		sequenceNumbers = append(sequenceNumbers, entry.GetLogSequenceNumber())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6}, sequenceNumbers)
+	assert.Equal(t, []byte("cluster metadata"), etcdState.Metadata)
+	assert.Equal(t, state, etcdState.HardState)
+
+	_, written, err := waletcd.Convert(etcdPath, dirPath, maxFileSize)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, written)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithOpenMode(wal.MustExist))
+	assert.NoError(t, err)
+	defer walog.Close()
+	entries, err := walog.ReadAll(false)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 6) {
+		assert.Equal(t, []byte("entry3-1"), entries[2].GetData())
+		assert.Equal(t, []byte("entry4-2"), entries[3].GetData())
+		assert.Equal(t, "2", entries[3].GetLabels()[waletcd.LabelTerm])
+		assert.Equal(t, "EntryNormal", entries[3].GetLabels()[waletcd.LabelType])
+	}
+
+	_, _, err = waletcd.Convert(etcdPath, dirPath, maxFileSize)
+	assert.Error(t, err)
+}
+
+func TestEtcdWAL_Corrupted(t *testing.T) {
+	t.Parallel()
+	etcdPath := "TestEtcdWAL_Corrupted"
+	defer os.RemoveAll(etcdPath)
+	assert.NoError(t, os.MkdirAll(etcdPath, 0755))
+
+	w := &etcdWALWriter{t: t, dir: etcdPath}
+	w.record(4, nil)
+	w.entries(1, 3, 1)
+	// Flip a byte of the data of the last entry.
+	w.buf[bytes.LastIndex(w.buf, []byte("entry3-1"))] ^= 0xff
+	w.cut()
+
+	_, err := waletcd.ReadDir(etcdPath, func(*wal.WAL_Entry) error { return nil })
+	assert.ErrorIs(t, err, wal.ErrCorruptEntry)
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ashwaniYDV/goWAL/waletcdraft"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/raft/v3"
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+func etcdEntries(first, last, term uint64) []pb.Entry {
+	var entries []pb.Entry
+	for i := first; i <= last; i++ {
+		entries = append(entries, pb.Entry{Index: i, Term: term, Type: pb.EntryNormal, Data: []byte{byte(i)}})
+	}
+	return entries
+}
+
+func TestEtcdRaftStorage(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestEtcdRaftStorage"
+	defer os.RemoveAll(dirPath)
+
+	storage, err := waletcdraft.Open(dirPath, 256)
+	assert.NoError(t, err)
+
+	assert.NoError(t, storage.Append(etcdEntries(1, 10, 1)))
+	// Entries 8 to 10 are replaced by those of a new leader.
+	assert.NoError(t, storage.Append(etcdEntries(8, 12, 2)))
+	assert.NoError(t, storage.SetHardState(pb.HardState{Term: 2, Vote: 3, Commit: 9}))
+
+	last, err := storage.LastIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(12), last)
+	term, err := storage.Term(7)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), term)
+	term, err = storage.Term(8)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), term)
+	_, err = storage.Term(13)
+	assert.ErrorIs(t, err, raft.ErrUnavailable)
+
+	entries, err := storage.Entries(6, 10, 1<<20)
+	assert.NoError(t, err)
+	assert.Equal(t, append(etcdEntries(6, 7, 1), etcdEntries(8, 9, 2)...), entries)
+	// At least one entry is returned, however small maxSize is.
+	entries, err = storage.Entries(6, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	snap, err := storage.CreateSnapshot(9, &pb.ConfState{Voters: []uint64{1, 2, 3}}, []byte("state"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), snap.Metadata.Term)
+	assert.NoError(t, storage.Compact(8))
+	assert.Error(t, storage.Compact(10))
+	first, err := storage.FirstIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(9), first)
+	_, err = storage.Entries(8, 10, 1<<20)
+	assert.ErrorIs(t, err, raft.ErrCompacted)
+	term, err = storage.Term(8)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), term)
+	assert.NoError(t, storage.Close())
+
+	// The state is recovered from the WALs, and the log restarts after the snapshot.
+	storage, err = waletcdraft.Open(dirPath, 256)
+	assert.NoError(t, err)
+	defer storage.Close()
+	hardState, confState, err := storage.InitialState()
+	assert.NoError(t, err)
+	assert.Equal(t, pb.HardState{Term: 2, Vote: 3, Commit: 9}, hardState)
+	assert.Equal(t, []uint64{1, 2, 3}, confState.Voters)
+	first, err = storage.FirstIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), first)
+	entries, err = storage.Entries(10, 13, 1<<20)
+	assert.NoError(t, err)
+	assert.Equal(t, etcdEntries(10, 12, 2), entries)
+
+	// A snapshot from the leader replaces the log.
+	assert.NoError(t, storage.ApplySnapshot(pb.Snapshot{Metadata: pb.SnapshotMetadata{Index: 100, Term: 5}}))
+	assert.ErrorIs(t, storage.ApplySnapshot(pb.Snapshot{Metadata: pb.SnapshotMetadata{Index: 50, Term: 5}}), raft.ErrSnapOutOfDate)
+	first, err = storage.FirstIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(101), first)
+	assert.NoError(t, storage.Append(etcdEntries(101, 102, 5)))
+	entries, err = storage.Entries(101, 103, 1<<20)
+	assert.NoError(t, err)
+	assert.Equal(t, etcdEntries(101, 102, 5), entries)
+}
+
+func TestEtcdRaftStorage_Node(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestEtcdRaftStorage_Node"
+	defer os.RemoveAll(dirPath)
+
+	storage, err := waletcdraft.Open(dirPath, maxFileSize)
+	assert.NoError(t, err)
+	defer storage.Close()
+
+	node := raft.StartNode(&raft.Config{
+		ID:              1,
+		ElectionTick:    10,
+		HeartbeatTick:   1,
+		Storage:         storage,
+		MaxSizePerMsg:   1 << 20,
+		MaxInflightMsgs: 256,
+	}, []raft.Peer{{ID: 1}})
+	defer node.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, node.Campaign(ctx))
+
+	var committed []string
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	proposed := false
+	for len(committed) < 3 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("committed %v before the timeout", committed)
+		case <-ticker.C:
+			node.Tick()
+		case rd := <-node.Ready():
+			if !raft.IsEmptyHardState(rd.HardState) {
+				assert.NoError(t, storage.SetHardState(rd.HardState))
+			}
+			assert.NoError(t, storage.Append(rd.Entries))
+			for _, entry := range rd.CommittedEntries {
+				if entry.Type == pb.EntryConfChange {
+					var cc pb.ConfChange
+					assert.NoError(t, cc.Unmarshal(entry.Data))
+					node.ApplyConfChange(cc)
+				} else if len(entry.Data) > 0 {
+					committed = append(committed, string(entry.Data))
+				}
+			}
+			if rd.SoftState != nil && rd.SoftState.RaftState == raft.StateLeader && !proposed {
+				proposed = true
+				go func() {
+					for _, data := range []string{"a", "b", "c"} {
+						node.Propose(ctx, []byte(data))
+					}
+				}()
+			}
+			node.Advance()
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, committed)
+
+	last, err := storage.LastIndex()
+	assert.NoError(t, err)
+	entries, err := storage.Entries(1, last+1, 1<<20)
+	assert.NoError(t, err)
+	assert.Len(t, entries, int(last))
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/walkafka"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// kafkaWriter records the messages written, failing the first write.
+type kafkaWriter struct {
+	mu       sync.Mutex
+	failed   bool
+	messages []kafka.Message
+}
+
+func (w *kafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.failed {
+		w.failed = true
+		return errors.New("leader not available")
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *kafkaWriter) written() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka.Message(nil), w.messages...)
+}
+
+func TestKafkaSink(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestKafkaSink"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	assert.NoError(t, walog.WriteEntryOpts([]byte("created"), wal.WithStream("orders"), wal.WithLabels(map[string]string{"type": "created"})))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("paid"), wal.WithStream("orders"), wal.WithKey([]byte("order-1"))))
+	assert.NoError(t, walog.Sync())
+
+	writer := &kafkaWriter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- walkafka.NewSink(walog, writer, walkafka.WithTopic("orders"), walkafka.WithRetryInterval(time.Millisecond)).Run(ctx)
+	}()
+
+	// The first publish fails and is retried.
+	assert.Eventually(t, func() bool { return walog.ConsumerOffset("kafka") == 2 }, 5*time.Second, time.Millisecond)
+	messages := writer.written()
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, "orders", messages[0].Topic)
+		assert.Equal(t, []byte("orders"), messages[0].Key)
+		assert.Equal(t, []byte("created"), messages[0].Value)
+		assert.Contains(t, messages[0].Headers, kafka.Header{Key: walkafka.HeaderLSN, Value: []byte("1")})
+		assert.Contains(t, messages[0].Headers, kafka.Header{Key: walkafka.HeaderStream, Value: []byte("orders")})
+		assert.Contains(t, messages[0].Headers, kafka.Header{Key: "type", Value: []byte("created")})
+		assert.Equal(t, []byte("order-1"), messages[1].Key)
+	}
+
+	// Entries written while the sink runs are published.
+	assert.NoError(t, walog.WriteEntry([]byte("shipped")))
+	assert.NoError(t, walog.Sync())
+	assert.Eventually(t, func() bool { return walog.ConsumerOffset("kafka") == 3 }, 5*time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// A restarted sink resumes after the committed offset.
+	assert.NoError(t, walog.WriteEntry([]byte("delivered")))
+	assert.NoError(t, walog.Sync())
+	writer = &kafkaWriter{failed: true}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		done <- walkafka.NewSink(walog, writer).Run(ctx)
+	}()
+	assert.Eventually(t, func() bool { return walog.ConsumerOffset("kafka") == 4 }, 5*time.Second, time.Millisecond)
+	messages = writer.written()
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, []byte("delivered"), messages[0].Value)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ashwaniYDV/goWAL/walkv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWALKV_Store(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWALKV_Store"
+	defer os.RemoveAll(dirPath)
+
+	store, err := walkv.Open(dirPath, walkv.WithSnapshotEvery(50))
+	assert.NoError(t, err, "Failed to open store")
+
+	for i := range 120 {
+		assert.NoError(t, store.Put(fmt.Sprintf("key%d", i%10), []byte(fmt.Sprintf("value%d", i))))
+	}
+	assert.NoError(t, store.Delete("key0"))
+	assert.ErrorIs(t, store.Put("", nil), walkv.ErrEmptyKey)
+	assert.Equal(t, 9, store.Len())
+	value, ok := store.Get("key3")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value113"), value)
+	_, ok = store.Get("key0")
+	assert.False(t, ok)
+
+	// The first segment is sealed, so compaction keeps only the last version of each key.
+	assert.NoError(t, store.WAL().Rotate())
+	dropped, err := store.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, 111, dropped)
+	assert.NoError(t, store.Close())
+
+	// The content is recovered from the latest snapshot and the entries after it.
+	store, err = walkv.Open(dirPath, walkv.WithSnapshotEvery(50))
+	assert.NoError(t, err, "Failed to reopen store")
+	defer store.Close()
+	assert.Equal(t, 9, store.Len())
+	for i := 111; i < 120; i++ {
+		value, ok := store.Get(fmt.Sprintf("key%d", i%10))
+		assert.True(t, ok)
+		assert.Equal(t, []byte(fmt.Sprintf("value%d", i)), value)
+	}
+	_, ok = store.Get("key0")
+	assert.False(t, ok)
+}
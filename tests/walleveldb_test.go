@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/walleveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+// levelDBLog writes records in the log format of LevelDB, or of recycled RocksDB log files if
+// logNumber isn't 0.
+type levelDBLog struct {
+	buf       bytes.Buffer
+	logNumber uint32
+}
+
+func (l *levelDBLog) write(record []byte) {
+	const blockSize = 32 << 10
+	headerSize := 7
+	if l.logNumber != 0 {
+		headerSize = 11
+	}
+	first := true
+	for {
+		left := blockSize - l.buf.Len()%blockSize
+		if left < headerSize {
+			l.buf.Write(make([]byte, left))
+			left = blockSize
+		}
+		fragment := record[:min(len(record), left-headerSize)]
+		record = record[len(fragment):]
+
+		typ := byte(1) // full
+		switch {
+		case first && len(record) > 0:
+			typ = 2
+		case !first && len(record) > 0:
+			typ = 3
+		case !first:
+			typ = 4
+		}
+		header := binary.LittleEndian.AppendUint16(make([]byte, 4), uint16(len(fragment)))
+		if l.logNumber != 0 {
+			header = append(header, typ+4)
+			header = binary.LittleEndian.AppendUint32(header, l.logNumber)
+		} else {
+			header = append(header, typ)
+		}
+		table := crc32.MakeTable(crc32.Castagnoli)
+		crc := crc32.Update(crc32.Checksum(header[6:], table), table, fragment)
+		binary.LittleEndian.PutUint32(header, (crc>>15|crc<<17)+0xa282ead8)
+		l.buf.Write(header)
+		l.buf.Write(fragment)
+
+		first = false
+		if len(record) == 0 {
+			return
+		}
+	}
+}
+
+// levelDBBatch encodes a write batch of the given operations, each a tag followed by its slices.
+func levelDBBatch(sequence uint64, count uint32, ops ...[]byte) []byte {
+	batch := binary.LittleEndian.AppendUint64(nil, sequence)
+	batch = binary.LittleEndian.AppendUint32(batch, count)
+	for _, op := range ops {
+		batch = append(batch, op...)
+	}
+	return batch
+}
+
+func levelDBOp(tag byte, columnFamily uint64, slices ...string) []byte {
+	op := []byte{tag}
+	if columnFamily != 0 {
+		op = binary.AppendUvarint(op, columnFamily)
+	}
+	for _, slice := range slices {
+		op = binary.AppendUvarint(op, uint64(len(slice)))
+		op = append(op, slice...)
+	}
+	return op
+}
+
+func TestWALLevelDB_Import(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWALLevelDB_Import"
+	defer os.RemoveAll(dirPath)
+
+	large := string(bytes.Repeat([]byte("v"), 80<<10))
+	var log levelDBLog
+	log.write(levelDBBatch(100, 3,
+		levelDBOp(1, 0, "a", "1"),
+		levelDBOp(3, 0, "blob"),
+		levelDBOp(0, 0, "b"),
+		levelDBOp(5, 2, "c", "3")))
+	// Fragmented across three blocks.
+	log.write(levelDBBatch(103, 2, levelDBOp(1, 0, "large", large), levelDBOp(2, 0, "counter", "+1")))
+	// Only partially written.
+	var torn levelDBLog
+	torn.buf.Write(log.buf.Bytes())
+	torn.write(levelDBBatch(105, 1, levelDBOp(1, 0, "torn", "value")))
+	data := torn.buf.Bytes()[:torn.buf.Len()-3]
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	imported, err := walleveldb.Import(walog, bytes.NewReader(data), walleveldb.WithSequenceNumbers())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, imported)
+
+	assert.NoError(t, walog.Flush())
+	entries, err := walog.ReadAllFromOffset(-1, false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+	assert.Equal(t, uint64(100), entries[0].GetLogSequenceNumber())
+	assert.Equal(t, []byte("a"), entries[0].GetKey())
+	assert.Equal(t, []byte("1"), entries[0].GetData())
+	assert.True(t, entries[1].GetTombstone())
+	assert.Equal(t, []byte("b"), entries[1].GetKey())
+	assert.Equal(t, "cf2", entries[2].GetStream())
+	assert.Equal(t, uint64(103), entries[3].GetLogSequenceNumber())
+	assert.Equal(t, large, string(entries[3].GetData()))
+	assert.Equal(t, []byte(walleveldb.MergeMetadata), entries[4].GetMetadata())
+	assert.Equal(t, uint64(104), entries[4].GetLogSequenceNumber())
+}
+
+func TestWALLevelDB_Reader(t *testing.T) {
+	t.Parallel()
+
+	// A corrupted record is reported.
+	var log levelDBLog
+	log.write(levelDBBatch(1, 1, levelDBOp(1, 0, "a", "1")))
+	data := bytes.Clone(log.buf.Bytes())
+	data[len(data)-1] ^= 0xff
+	_, err := walleveldb.NewReader(bytes.NewReader(data)).Next()
+	assert.ErrorIs(t, err, walleveldb.ErrCorrupt)
+
+	// A recycled log file ends at the first record of the previous file.
+	recycled := levelDBLog{logNumber: 7}
+	recycled.write([]byte("current"))
+	stale := levelDBLog{logNumber: 3}
+	stale.buf.Write(make([]byte, recycled.buf.Len()))
+	stale.write([]byte("stale"))
+	data = append(recycled.buf.Bytes(), stale.buf.Bytes()[recycled.buf.Len():]...)
+
+	reader := walleveldb.NewReader(bytes.NewReader(data))
+	record, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("current"), record)
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Write batches must hold as many operations as they declare.
+	_, err = walleveldb.DecodeBatch(levelDBBatch(1, 2, levelDBOp(1, 0, "a", "1")))
+	assert.ErrorIs(t, err, walleveldb.ErrCorrupt)
+}
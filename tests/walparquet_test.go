@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/walparquet"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWALParquet_Export(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWALParquet_Export"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	timestamp := time.Unix(1700000000, 0)
+	assert.NoError(t, walog.WriteEntryOpts([]byte("order1"), wal.WithStream("orders"), wal.WithKey([]byte("k1")), wal.WithTimestamp(timestamp)))
+	assert.NoError(t, walog.Rotate())
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+	assert.NoError(t, walog.Close())
+
+	var buf bytes.Buffer
+	rows, err := walparquet.Export(&buf, dirPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rows)
+
+	read, err := parquet.Read[walparquet.Row](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	assert.Len(t, read, 2)
+
+	assert.Equal(t, uint64(1), read[0].LSN)
+	assert.Equal(t, "orders", read[0].Stream)
+	assert.Equal(t, []byte("k1"), read[0].Key)
+	assert.Equal(t, int64(6), read[0].Size)
+	assert.Equal(t, []byte("order1"), read[0].Payload)
+	assert.Equal(t, timestamp.UnixNano(), read[0].Timestamp)
+	assert.False(t, read[0].Checkpoint)
+
+	assert.Equal(t, uint64(2), read[1].LSN)
+	assert.True(t, read[1].Checkpoint)
+	assert.Zero(t, read[1].Timestamp)
+}
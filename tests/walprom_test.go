@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/walprom"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWALProm_Collector(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWALProm_Collector"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntry([]byte("entry1")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.Sync())
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, walprom.Register(registry, walog, prometheus.Labels{"wal": "test"}))
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	values := map[string]float64{}
+	for _, family := range families {
+		metric := family.GetMetric()[0]
+		assert.Equal(t, "test", metric.GetLabel()[0].GetValue())
+		switch {
+		case metric.GetCounter() != nil:
+			values[family.GetName()] = metric.GetCounter().GetValue()
+		case metric.GetGauge() != nil:
+			values[family.GetName()] = metric.GetGauge().GetValue()
+		case metric.GetHistogram() != nil:
+			values[family.GetName()] = float64(metric.GetHistogram().GetSampleCount())
+		}
+	}
+
+	assert.Equal(t, float64(2), values["gowal_entries_written_total"])
+	assert.Equal(t, float64(2), values["gowal_last_sequence_number"])
+	assert.Equal(t, float64(1), values["gowal_segments"])
+	assert.Equal(t, float64(1), values["gowal_fsyncs_total"])
+	assert.Equal(t, float64(1), values["gowal_fsync_duration_seconds"])
+
+	problems, err := testutil.CollectAndLint(walprom.NewCollector(walog, nil))
+	assert.NoError(t, err)
+	assert.Empty(t, problems, "Metrics should follow the Prometheus naming conventions")
+}
+
+func TestWALProm_StreamsAndConsumers(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWALProm_StreamsAndConsumers"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments)
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+
+	assert.NoError(t, walog.WriteEntryOpts([]byte("order1"), wal.WithStream("orders")))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("order2"), wal.WithStream("orders")))
+	assert.NoError(t, walog.WriteEntryOpts([]byte("user1"), wal.WithStream("users")))
+	assert.NoError(t, walog.CommitOffset("indexer", 1))
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, walprom.Register(registry, walog, nil))
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if len(metric.GetLabel()) == 0 {
+				continue
+			}
+			name := family.GetName() + "/" + metric.GetLabel()[0].GetValue()
+			if metric.GetCounter() != nil {
+				values[name] = metric.GetCounter().GetValue()
+			} else {
+				values[name] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	assert.Equal(t, float64(2), values["gowal_stream_entries_written_total/orders"])
+	assert.Equal(t, float64(1), values["gowal_stream_entries_written_total/users"])
+	assert.Greater(t, values["gowal_stream_bytes_written_total/orders"], float64(0))
+	assert.Equal(t, float64(1), values["gowal_consumer_offset/indexer"])
+	assert.Equal(t, float64(2), values["gowal_consumer_lag/indexer"])
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ashwaniYDV/goWAL/walraft"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaftStore_Logs(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestRaftStore_Logs"
+	defer os.RemoveAll(dirPath)
+
+	store, err := walraft.Open(dirPath, 256)
+	assert.NoError(t, err)
+
+	first, err := store.FirstIndex()
+	assert.NoError(t, err)
+	assert.Zero(t, first)
+
+	appendedAt := time.Unix(0, 1700000000000000000)
+	var logs []*raft.Log
+	for i := uint64(1); i <= 20; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 1 + i/10, Type: raft.LogCommand, Data: []byte{byte(i)}, AppendedAt: appendedAt})
+	}
+	logs[0].Type = raft.LogConfiguration
+	logs[0].Extensions = []byte("extensions")
+	assert.NoError(t, store.StoreLogs(logs[:10]))
+	assert.NoError(t, store.StoreLog(logs[10]))
+	assert.NoError(t, store.StoreLogs(logs[11:]))
+
+	var log raft.Log
+	assert.NoError(t, store.GetLog(1, &log))
+	assert.Equal(t, *logs[0], log)
+	assert.NoError(t, store.GetLog(15, &log))
+	assert.Equal(t, *logs[14], log)
+	assert.ErrorIs(t, store.GetLog(21, &log), raft.ErrLogNotFound)
+
+	// Raft compacts the oldest logs after a snapshot...
+	assert.NoError(t, store.DeleteRange(1, 12))
+	first, err = store.FirstIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(13), first)
+	assert.ErrorIs(t, store.GetLog(12, &log), raft.ErrLogNotFound)
+
+	// ...and deletes the newest ones when they conflict with the leader.
+	assert.NoError(t, store.DeleteRange(18, 20))
+	last, err := store.LastIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(17), last)
+	assert.NoError(t, store.StoreLog(&raft.Log{Index: 18, Term: 3, Data: []byte("new leader")}))
+	assert.NoError(t, store.GetLog(18, &log))
+	assert.Equal(t, []byte("new leader"), log.Data)
+	assert.Error(t, store.DeleteRange(14, 15))
+	assert.NoError(t, store.Close())
+
+	// The deleted logs stay deleted after reopening, even if their segment is kept.
+	store, err = walraft.Open(dirPath, 256)
+	assert.NoError(t, err)
+	first, err = store.FirstIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(13), first)
+	assert.ErrorIs(t, store.GetLog(12, &log), raft.ErrLogNotFound)
+	last, err = store.LastIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(18), last)
+	assert.NoError(t, store.GetLog(17, &log))
+	assert.Equal(t, *logs[16], log)
+
+	// After a snapshot is installed, all logs are deleted and the log restarts after the snapshot.
+	assert.NoError(t, store.DeleteRange(1, 18))
+	first, err = store.FirstIndex()
+	assert.NoError(t, err)
+	assert.Zero(t, first)
+	assert.NoError(t, store.StoreLog(&raft.Log{Index: 100, Term: 5}))
+	first, err = store.FirstIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), first)
+	assert.NoError(t, store.Close())
+
+	store, err = walraft.Open(dirPath, 256)
+	assert.NoError(t, err)
+	defer store.Close()
+	first, err = store.FirstIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), first)
+}
+
+func TestRaftStore_Stable(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestRaftStore_Stable"
+	defer os.RemoveAll(dirPath)
+
+	store, err := walraft.Open(dirPath, maxFileSize)
+	assert.NoError(t, err)
+
+	_, err = store.Get([]byte("LastVoteCand"))
+	assert.ErrorIs(t, err, walraft.ErrKeyNotFound)
+	_, err = store.GetUint64([]byte("CurrentTerm"))
+	assert.EqualError(t, err, "not found")
+
+	assert.NoError(t, store.Set([]byte("LastVoteCand"), []byte("node-1")))
+	assert.NoError(t, store.SetUint64([]byte("CurrentTerm"), 7))
+	assert.NoError(t, store.Close())
+
+	store, err = walraft.Open(dirPath, maxFileSize)
+	assert.NoError(t, err)
+	defer store.Close()
+	val, err := store.Get([]byte("LastVoteCand"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("node-1"), val)
+	term, err := store.GetUint64([]byte("CurrentTerm"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), term)
+}
+
+// countingFSM counts the commands applied by Raft.
+type countingFSM struct {
+	applied int
+}
+
+func (f *countingFSM) Apply(*raft.Log) interface{}         { f.applied++; return f.applied }
+func (f *countingFSM) Snapshot() (raft.FSMSnapshot, error) { return nil, raft.ErrNothingNewToSnapshot }
+func (f *countingFSM) Restore(io.ReadCloser) error         { return nil }
+
+func TestRaftStore_Raft(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestRaftStore_Raft"
+	defer os.RemoveAll(dirPath)
+
+	store, err := walraft.Open(dirPath, maxFileSize)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	config := raft.DefaultConfig()
+	config.LocalID = "node-1"
+	config.LogOutput = io.Discard
+	config.HeartbeatTimeout = 50 * time.Millisecond
+	config.ElectionTimeout = 50 * time.Millisecond
+	config.LeaderLeaseTimeout = 50 * time.Millisecond
+	_, transport := raft.NewInmemTransport("node-1")
+	fsm := &countingFSM{}
+
+	r, err := raft.NewRaft(config, fsm, store, store, raft.NewInmemSnapshotStore(), transport)
+	assert.NoError(t, err)
+	defer r.Shutdown()
+	assert.NoError(t, r.BootstrapCluster(raft.Configuration{
+		Servers: []raft.Server{{ID: "node-1", Address: transport.LocalAddr()}},
+	}).Error())
+	assert.Eventually(t, func() bool { return r.State() == raft.Leader }, 5*time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, r.Apply([]byte("command"), time.Second).Error())
+	}
+	assert.Equal(t, 10, fsm.applied)
+
+	last, err := store.LastIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, r.LastIndex(), last)
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/ashwaniYDV/goWAL/walservice"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func startLogServer(t *testing.T, server walservice.LogServer) walservice.LogClient {
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	walservice.RegisterLogServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return walservice.NewLogClient(conn)
+}
+
+func TestLogService(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestLogService"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(10*time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	client := startLogServer(t, walservice.NewServer(walog, walservice.WithMaxReadEntries(2)))
+	ctx := context.Background()
+
+	appended, err := client.Append(ctx, &walservice.AppendRequest{Data: []byte("entry1"), Stream: "orders", Sync: true})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), appended.GetLogSequenceNumber())
+	for _, data := range []string{"entry2", "entry3"} {
+		_, err = client.Append(ctx, &walservice.AppendRequest{Data: []byte(data)})
+		assert.NoError(t, err)
+	}
+	checkpoint, err := client.Checkpoint(ctx, &walservice.CheckpointRequest{Data: []byte("checkpoint")})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), checkpoint.GetLogSequenceNumber())
+
+	// Reads return the entries appended, up to the maximum set on the server.
+	read, err := client.Read(ctx, &walservice.ReadRequest{FromLogSequenceNumber: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, read.GetEntries(), 2) {
+		assert.Equal(t, []byte("entry1"), read.GetEntries()[0].GetData())
+		assert.Equal(t, "orders", read.GetEntries()[0].GetStream())
+	}
+	read, err = client.Read(ctx, &walservice.ReadRequest{FromLogSequenceNumber: 2, ToLogSequenceNumber: 2})
+	assert.NoError(t, err)
+	if assert.Len(t, read.GetEntries(), 1) {
+		assert.Equal(t, []byte("entry2"), read.GetEntries()[0].GetData())
+	}
+
+	stats, err := client.Stats(ctx, &walservice.StatsRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), stats.GetLastLogSequenceNumber())
+	assert.Contains(t, stats.GetJson(), `"last_sequence_number":4`)
+
+	// Tails send the existing entries, then new ones.
+	tailCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tail, err := client.Tail(tailCtx, &walservice.TailRequest{FromLogSequenceNumber: 3})
+	assert.NoError(t, err)
+	for _, lsn := range []uint64{3, 4, 5} {
+		if lsn == 5 {
+			_, err = client.Append(ctx, &walservice.AppendRequest{Data: []byte("entry5")})
+			assert.NoError(t, err)
+		}
+		entry, err := tail.Recv()
+		if assert.NoError(t, err) {
+			assert.Equal(t, lsn, entry.GetLogSequenceNumber())
+		}
+	}
+
+	// Tails send deletes as tombstones.
+	assert.NoError(t, walog.WriteEntryOpts(nil, wal.WithKey([]byte("k1")), wal.WithTombstone()))
+	entry, err := tail.Recv()
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(6), entry.GetLogSequenceNumber())
+		assert.Equal(t, []byte("k1"), entry.GetKey())
+		assert.True(t, entry.GetTombstone())
+	}
+	assert.NoError(t, walog.WriteEntryOpts([]byte("order1"), wal.WithSchema("example.Order", 2)))
+	entry, err = tail.Recv()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.Order", entry.GetSchema())
+		assert.Equal(t, uint32(2), entry.GetSchemaVersion())
+	}
+	cancel()
+	_, err = tail.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err))
+}
+
+func TestLogService_HTTP(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestLogService_HTTP"
+	defer os.RemoveAll(dirPath)
+
+	walog, err := wal.OpenWAL(dirPath, true, maxFileSize, maxSegments, wal.WithSyncInterval(10*time.Millisecond))
+	assert.NoError(t, err, "Failed to create WAL")
+	defer walog.Close()
+	server := httptest.NewServer(walservice.NewServer(walog).Handler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/entries?stream=orders&key=order-1&label=type:created&sync=true", "application/octet-stream", strings.NewReader("entry1"))
+	assert.NoError(t, err)
+	var appended map[string]uint64
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&appended))
+	resp.Body.Close()
+	assert.Equal(t, uint64(1), appended["lsn"])
+
+	resp, err = http.Post(server.URL+"/entries?label=invalid", "application/octet-stream", strings.NewReader("entry2"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// The operational endpoints of the WAL are served too.
+	resp, err = http.Post(server.URL+"/checkpoint", "application/octet-stream", strings.NewReader("checkpoint"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/entries?from=1")
+	assert.NoError(t, err)
+	var entries []struct {
+		LSN        uint64            `json:"lsn"`
+		Checkpoint bool              `json:"checkpoint"`
+		Stream     string            `json:"stream"`
+		Key        []byte            `json:"key"`
+		Labels     map[string]string `json:"labels"`
+		Data       []byte            `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	resp.Body.Close()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, []byte("entry1"), entries[0].Data)
+		assert.Equal(t, "orders", entries[0].Stream)
+		assert.Equal(t, []byte("order-1"), entries[0].Key)
+		assert.Equal(t, "created", entries[0].Labels["type"])
+		assert.True(t, entries[1].Checkpoint)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/tail?from=2", nil)
+	assert.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	_, err = walog.AppendEntry([]byte("entry3"))
+	assert.NoError(t, err)
+	lines := bufio.NewScanner(resp.Body)
+	for _, lsn := range []uint64{2, 3} {
+		if assert.True(t, lines.Scan()) {
+			var entry struct {
+				LSN uint64 `json:"lsn"`
+			}
+			assert.NoError(t, json.Unmarshal(lines.Bytes(), &entry))
+			assert.Equal(t, lsn, entry.LSN)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_Webhook(t *testing.T) {
+	t.Parallel()
+	dirPath := "TestWAL_Webhook"
+	defer os.RemoveAll(dirPath)
+
+	secret := []byte("secret")
+	var lock sync.Mutex
+	var payloads []wal.WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.True(t, wal.VerifyWebhookSignature(secret, body, r.Header.Get(wal.WebhookSignatureHeader)))
+		assert.False(t, wal.VerifyWebhookSignature([]byte("other"), body, r.Header.Get(wal.WebhookSignatureHeader)))
+
+		var payload wal.WebhookPayload
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		lock.Lock()
+		payloads = append(payloads, payload)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	walog, err := wal.OpenWAL(dirPath, false, 64, 10, wal.WithWebhook(secret, server.URL))
+	assert.NoError(t, err, "Failed to create WAL")
+
+	assert.NoError(t, walog.WriteEntry([]byte("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")))
+	assert.NoError(t, walog.WriteEntry([]byte("entry2")))
+	assert.NoError(t, walog.CreateCheckpoint([]byte("checkpoint")))
+
+	// Corrupt the checkpoint so that its CRC no longer matches.
+	segmentPath := filepath.Join(dirPath, "segment-1")
+	content, err := os.ReadFile(segmentPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(segmentPath, bytes.Replace(content, []byte("checkpoint"), []byte("checkpoinX"), 1), 0644))
+	_, err = walog.ReadAll(false)
+	assert.ErrorIs(t, err, wal.ErrCorruptEntry)
+
+	// Close waits for the notifications to be delivered.
+	assert.NoError(t, walog.Close())
+	lock.Lock()
+	defer lock.Unlock()
+	if assert.Len(t, payloads, 3) {
+		assert.Equal(t, wal.WebhookEventRotate, payloads[0].Event)
+		assert.Equal(t, 1, payloads[0].Segment)
+		assert.Equal(t, dirPath, payloads[0].Directory)
+		assert.Equal(t, wal.WebhookEventCheckpoint, payloads[1].Event)
+		assert.Equal(t, uint64(3), payloads[1].LogSequenceNumber)
+		assert.Equal(t, wal.WebhookEventCorruption, payloads[2].Event)
+		if assert.NotNil(t, payloads[2].Corruption) {
+			assert.Equal(t, wal.CorruptionChecksum, payloads[2].Corruption.Kind)
+			assert.Equal(t, segmentPath, payloads[2].Corruption.Path)
+		}
+	}
+}
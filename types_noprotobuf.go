@@ -0,0 +1,158 @@
+//go:build noprotobuf
+
+package wal
+
+// WAL_Entry is the entry of types.proto, declared without the protobuf runtime when the package is built
+// with the noprotobuf tag, for environments that can't take the protobuf dependency. Its fields and
+// getters are those generated in types.pb.go, and entries are still encoded with the protobuf wire
+// format by default, see entry_codec.go. It doesn't implement proto.Message.
+type WAL_Entry struct {
+	LogSequenceNumber uint64
+	Data              []byte
+	CRC               uint32
+	// Optional field for checkpointing.
+	IsCheckpoint *bool
+	// Application defined metadata, stored alongside data without being part of it.
+	Metadata []byte
+	// Application defined labels, e.g. for attaching structured context to an entry.
+	Labels map[string]string
+	// Optional stream the entry belongs to, for applications multiplexing several logical logs.
+	Stream string
+	// Optional key of the entry, e.g. the key of a key-value record.
+	Key []byte
+	// Optional application timestamp of the entry, in nanoseconds since the Unix epoch.
+	Timestamp int64
+	// Optional hybrid logical clock timestamp of the entry, see HLC.
+	Hlc uint64
+	// Algorithm of the CRC, see Checksum. Segments record it in their header instead, it is set when the entry
+	// is read. 0 (CRC-32 IEEE) for entries written before it existed.
+	Checksum uint32
+	// Marks the entry as a tombstone, deleting its key, see WithTombstone.
+	Tombstone bool
+	// Optional identifier of the schema of the data, see WithSchema.
+	Schema string
+	// Version of the schema of the data, see WithSchema.
+	SchemaVersion uint32
+	// SHA-256 of the data of the entry, stored in the blobs directory instead of the entry, see
+	// WithBlobThreshold.
+	Blob []byte
+	// Location of the data of the entry in the value log instead of the entry, see WithValueLog.
+	ValuePointer  []byte
+	unknownFields []byte
+}
+
+func (x *WAL_Entry) Reset() {
+	*x = WAL_Entry{}
+}
+
+func (x *WAL_Entry) GetLogSequenceNumber() uint64 {
+	if x != nil {
+		return x.LogSequenceNumber
+	}
+	return 0
+}
+
+func (x *WAL_Entry) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *WAL_Entry) GetCRC() uint32 {
+	if x != nil {
+		return x.CRC
+	}
+	return 0
+}
+
+func (x *WAL_Entry) GetIsCheckpoint() bool {
+	if x != nil && x.IsCheckpoint != nil {
+		return *x.IsCheckpoint
+	}
+	return false
+}
+
+func (x *WAL_Entry) GetMetadata() []byte {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *WAL_Entry) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *WAL_Entry) GetStream() string {
+	if x != nil {
+		return x.Stream
+	}
+	return ""
+}
+
+func (x *WAL_Entry) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *WAL_Entry) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *WAL_Entry) GetHlc() uint64 {
+	if x != nil {
+		return x.Hlc
+	}
+	return 0
+}
+
+func (x *WAL_Entry) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+func (x *WAL_Entry) GetTombstone() bool {
+	if x != nil {
+		return x.Tombstone
+	}
+	return false
+}
+
+func (x *WAL_Entry) GetSchema() string {
+	if x != nil {
+		return x.Schema
+	}
+	return ""
+}
+
+func (x *WAL_Entry) GetSchemaVersion() uint32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *WAL_Entry) GetBlob() []byte {
+	if x != nil {
+		return x.Blob
+	}
+	return nil
+}
+
+func (x *WAL_Entry) GetValuePointer() []byte {
+	if x != nil {
+		return x.ValuePointer
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// valueLogDirName is the directory, inside the WAL directory, holding the value log of WithValueLog. Its
+// files are named like the segments, and hold the data of the entries back to back.
+const valueLogDirName = "valuelog"
+
+// WithValueLog stores the data of the entries larger than threshold bytes in a value log next to the
+// segments, and writes only its location in the log, like WiscKey does: the segments stay small, so
+// that rotating, reading and compacting them is cheap, while small entries stay inline. The value log is
+// synced before the segments, so entries are never durable before their data. The read APIs return the
+// entries with their data, read back from the value log; the value log files no longer referenced by any
+// segment are deleted by CollectValueLog, and by Compact. Checkpoints are always stored in the log, and
+// the data of the entries stored by WithBlobThreshold isn't stored in the value log. Value log files are
+// rotated at the maximum segment size. Defaults to 0, which disables it.
+func WithValueLog(threshold int) Option {
+	return func(o *options) {
+		o.valueLogThreshold = threshold
+	}
+}
+
+// valueLog appends the data of the entries to the files of the value log.
+type valueLog struct {
+	fs          FS
+	directory   string
+	threshold   int
+	maxFileSize int64
+
+	// lock guards the current file and the pending writes.
+	lock  sync.Mutex
+	file  File // current file, nil until the first append
+	index int
+	size  int64
+	dirty bool // written to since the last sync
+	// pending is the number of writes whose data is in each file, by index, and whose entry may not be in
+	// the log yet, see CollectValueLog.
+	pending map[int]int
+}
+
+func newValueLog(fs FS, directory string, threshold int, maxFileSize int64) *valueLog {
+	return &valueLog{
+		fs:          fs,
+		directory:   filepath.Join(directory, valueLogDirName),
+		threshold:   threshold,
+		maxFileSize: maxFileSize,
+		pending:     make(map[int]int),
+	}
+}
+
+// append appends the data of the entry to the value log, and replaces it with its location. The file is
+// marked pending until done is called, so that CollectValueLog keeps it until the entry is in the log.
+func (v *valueLog) append(entry *WAL_Entry) (done func(), err error) {
+	data := entry.GetData()
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.file == nil {
+		if err := v.openLast(); err != nil {
+			return nil, fmt.Errorf("could not open value log: %w", err)
+		}
+	} else if v.size > 0 && v.size+int64(len(data)) > v.maxFileSize {
+		if err := v.rotate(); err != nil {
+			return nil, fmt.Errorf("could not rotate value log: %w", err)
+		}
+	}
+
+	if _, err := v.file.Write(data); err != nil {
+		// The size of the file is unknown after a short write, it is read again by the next append.
+		v.file.Close()
+		v.file = nil
+		return nil, fmt.Errorf("could not write to value log: %w", err)
+	}
+	entry.ValuePointer = appendValuePointer(nil, v.index, v.size, data)
+	entry.Data = nil
+	v.size += int64(len(data))
+	v.dirty = true
+
+	index := v.index
+	v.pending[index]++
+	return func() {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+		if v.pending[index]--; v.pending[index] <= 0 {
+			delete(v.pending, index)
+		}
+	}, nil
+}
+
+// openLast opens the newest file of the value log, or creates the first one. The caller must hold v.lock.
+func (v *valueLog) openLast() error {
+	files, err := listSegmentFiles(v.fs, v.directory)
+	if err != nil {
+		return err
+	}
+	if err := v.fs.MkdirAll(v.directory, 0755); err != nil {
+		return err
+	}
+	index := 0
+	if len(files) > 0 {
+		index = files[len(files)-1].index
+	}
+	return v.open(index)
+}
+
+// open opens the file of the value log with the given index for appending. The caller must hold v.lock.
+func (v *valueLog) open(index int) error {
+	file, err := v.fs.OpenFile(v.path(index), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	v.file, v.index, v.size = file, index, size
+	return nil
+}
+
+// rotate syncs and closes the current file, and opens the next one. The caller must hold v.lock.
+func (v *valueLog) rotate() error {
+	if err := v.file.Sync(); err != nil {
+		return err
+	}
+	if err := v.file.Close(); err != nil {
+		return err
+	}
+	v.file = nil
+	return v.open(v.index + 1)
+}
+
+// sync commits the data appended to the value log to stable storage.
+func (v *valueLog) sync() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.file == nil || !v.dirty {
+		return nil
+	}
+	if err := v.file.Sync(); err != nil {
+		return err
+	}
+	v.dirty = false
+	return nil
+}
+
+// close syncs and closes the current file.
+func (v *valueLog) close() error {
+	if err := v.sync(); err != nil {
+		return err
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.file == nil {
+		return nil
+	}
+	err := v.file.Close()
+	v.file = nil
+	return err
+}
+
+func (v *valueLog) path(index int) string {
+	return filepath.Join(v.directory, segmentPrefix+strconv.Itoa(index))
+}
+
+// appendValuePointer appends the location of the data in the file of the value log with the given index
+// at the given offset: the index, offset and length as varints, then the CRC-32C of the data.
+func appendValuePointer(b []byte, index int, offset int64, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(index))
+	b = binary.AppendUvarint(b, uint64(offset))
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return binary.LittleEndian.AppendUint32(b, crc32.Checksum(data, castagnoliTable))
+}
+
+// parseValuePointer parses a location appended by appendValuePointer.
+func parseValuePointer(pointer []byte) (index int, offset, length int64, crc uint32, ok bool) {
+	var values [3]uint64
+	for i := range values {
+		value, n := binary.Uvarint(pointer)
+		if n <= 0 {
+			return 0, 0, 0, 0, false
+		}
+		values[i], pointer = value, pointer[n:]
+	}
+	if len(pointer) != 4 || values[0] > math.MaxInt32 || values[1] > math.MaxInt64 || values[2] > math.MaxInt32 {
+		return 0, 0, 0, 0, false
+	}
+	return int(values[0]), int64(values[1]), int64(values[2]), binary.LittleEndian.Uint32(pointer), true
+}
+
+// resolveValuePointer replaces the value pointer of the entry, if it has one, with the data read from the
+// value log of the WAL in directory. It returns ErrCorruptEntry if the data doesn't match its CRC.
+func resolveValuePointer(fs FS, directory string, entry *WAL_Entry) error {
+	if len(entry.GetValuePointer()) == 0 {
+		return nil
+	}
+	index, offset, length, crc, ok := parseValuePointer(entry.GetValuePointer())
+	if !ok {
+		return fmt.Errorf("%w: invalid value pointer in entry %d", ErrCorruptEntry, entry.GetLogSequenceNumber())
+	}
+	path := filepath.Join(directory, valueLogDirName, segmentPrefix+strconv.Itoa(index))
+	file, err := fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not read the value of entry %d: %w", entry.GetLogSequenceNumber(), err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("could not read the value of entry %d: %w", entry.GetLogSequenceNumber(), err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return fmt.Errorf("could not read the value of entry %d from %s at offset %d: %w",
+			entry.GetLogSequenceNumber(), path, offset, err)
+	}
+	if crc32.Checksum(data, castagnoliTable) != crc {
+		return fmt.Errorf("%w: the value of entry %d in %s at offset %d doesn't match its CRC",
+			ErrCorruptEntry, entry.GetLogSequenceNumber(), path, offset)
+	}
+
+	entry.Data = data
+	entry.ValuePointer = nil
+	entry.CRC = computeCRC(entry)
+	return nil
+}
+
+// CollectValueLog deletes the files of the value log no longer referenced by the entries of any segment,
+// e.g. once the segments referencing them were compacted or deleted, and returns how many it deleted.
+// The file being appended to is kept. It holds the lock of the WAL while it reads the segments, so
+// writes wait for it. It does nothing without WithValueLog.
+func (wal *WAL) CollectValueLog() (deleted int, err error) {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	defer func() {
+		wal.recordAdmin(AdminOpCollectValueLog, wal.directory, fmt.Sprintf("deleted %d value log files", deleted), err)
+	}()
+
+	return wal.collectValueLog()
+}
+
+// collectValueLog is CollectValueLog. The caller must hold wal.lock.
+func (wal *WAL) collectValueLog() (int, error) {
+	v := wal.valueLog
+	if v == nil {
+		return 0, nil
+	}
+	files, err := listSegmentFiles(wal.fs, v.directory)
+	if err != nil || len(files) == 0 {
+		return 0, err
+	}
+
+	// The buffered entries may reference the value log too.
+	if err := wal.flush(); err != nil {
+		return 0, err
+	}
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return 0, err
+	}
+	referenced := make(map[int]bool)
+	for _, segment := range segments {
+		entries, err := wal.readSegmentFile(segment.path)
+		if err != nil {
+			return 0, err
+		}
+		for _, entry := range entries {
+			if index, _, _, _, ok := parseValuePointer(entry.GetValuePointer()); ok {
+				referenced[index] = true
+			}
+		}
+	}
+
+	// Writers mark the file pending while holding v.lock, when they append to it.
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	deleted := 0
+	for _, file := range files {
+		if referenced[file.index] || v.pending[file.index] > 0 || (v.file != nil && file.index == v.index) {
+			continue
+		}
+		if err := wal.fs.Remove(file.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,179 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+	Directory string          `json:"directory"`
+	Segments  []SegmentReport `json:"segments"`
+	// Corrupt is set if any segment has a corrupt range or could not be read.
+	Corrupt bool `json:"corrupt"`
+}
+
+// SegmentReport is the result of verifying a single segment.
+type SegmentReport struct {
+	Index               int    `json:"index"`
+	Path                string `json:"path"`
+	Size                int64  `json:"size"`
+	Entries             int    `json:"entries"`
+	FirstSequenceNumber uint64 `json:"first_sequence_number,omitempty"`
+	LastSequenceNumber  uint64 `json:"last_sequence_number,omitempty"`
+	// Checksum and Encoding are the CRC algorithm and the encoding of the entries, recorded in the header
+	// of the segment. The records of segments without a header identify their encoding themselves, and
+	// are reported as EncodingProtobuf.
+	Checksum      Checksum       `json:"checksum"`
+	Encoding      Encoding       `json:"encoding"`
+	CorruptRanges []CorruptRange `json:"corrupt_ranges,omitempty"`
+	// Error is set if the segment could not be read.
+	Error string `json:"error,omitempty"`
+}
+
+// CorruptRange is a byte range of a segment holding corrupted data.
+type CorruptRange struct {
+	// Start is the offset of the first byte of the range, End the offset after the last byte.
+	Start int64          `json:"start"`
+	End   int64          `json:"end"`
+	Kind  CorruptionKind `json:"kind"`
+	Error string         `json:"error"`
+}
+
+// Verify scans every segment in the directory, in parallel, and checks the framing and the CRC
+// of every entry. It doesn't modify the directory, and may be used on the directory of a running WAL,
+// although entries written concurrently may be reported as truncated.
+// Entries failing CRC verification are reported and the scan continues with the next entry;
+// a truncated entry ends the scan of its segment, as the framing can't be trusted past it.
+// The only option used is WithFS.
+func Verify(directory string, opts ...Option) (*VerifyReport, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	segments, err := listSegmentFiles(o.fs, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{Directory: directory, Segments: make([]SegmentReport, len(segments))}
+
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, segment := range segments {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-limit }()
+			report.Segments[i], _ = verifySegment(o.fs, segment)
+		}()
+	}
+	wg.Wait()
+
+	for _, segment := range report.Segments {
+		if len(segment.CorruptRanges) > 0 || segment.Error != "" {
+			report.Corrupt = true
+		}
+	}
+
+	return report, nil
+}
+
+// verifySegment scans the given segment. Besides the report, it returns the number of valid entries
+// preceding the first corrupt range.
+func verifySegment(fs FS, segment segmentFile) (report SegmentReport, entriesBeforeCorruption int) {
+	report = SegmentReport{Index: segment.index, Path: segment.path}
+
+	file, err := fs.OpenFile(segment.path, os.O_RDONLY, 0644)
+	if err != nil {
+		report.Error = err.Error()
+		return report, 0
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		report.Error = err.Error()
+		return report, 0
+	}
+	report.Size = fileInfo.Size()
+
+	reader := bufio.NewReader(file)
+	format, err := readSegmentHeader(reader)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		report.truncated(0, fmt.Errorf("could not read segment header: %v", err))
+		return report, 0
+	}
+	if err != nil && err != io.EOF {
+		report.Error = err.Error()
+		return report, 0
+	}
+	report.Checksum, report.Encoding = format.checksum, format.encoding
+
+	// The entries are only checked, so the same buffer and entry are used for all of them.
+	buf := getEntryBuffer()
+	defer putEntryBuffer(buf)
+	var entry WAL_Entry
+	offset := format.headerSize()
+	var prefix [4]byte
+	for offset < report.Size {
+		size, err := readFrameSize(reader, &prefix)
+		if err != nil {
+			report.truncated(offset, fmt.Errorf("could not read entry size: %v", err))
+			return report, entriesBeforeCorruption
+		}
+		if size == 0 {
+			// The preallocated space of a segment written with WithMmap reads as zeros, it ends the data.
+			break
+		}
+		if size < 0 || offset+4+int64(size) > report.Size {
+			report.truncated(offset, fmt.Errorf("entry size %d exceeds the end of the segment", size))
+			return report, entriesBeforeCorruption
+		}
+
+		*buf = resizeBuffer(*buf, int(size))
+		data := *buf
+		if _, err := io.ReadFull(reader, data); err != nil {
+			report.truncated(offset, fmt.Errorf("could not read entry data: %v", err))
+			return report, entriesBeforeCorruption
+		}
+		end := offset + 4 + int64(size)
+
+		if err := unmarshalEntry(data, format, &entry); err != nil {
+			report.CorruptRanges = append(report.CorruptRanges, CorruptRange{
+				Start: offset, End: end, Kind: CorruptionInvalidEntry, Error: err.Error(),
+			})
+		} else if !verifyCRC(&entry) {
+			report.CorruptRanges = append(report.CorruptRanges, CorruptRange{
+				Start: offset, End: end, Kind: CorruptionChecksum, Error: ErrCorruptEntry.Error(),
+			})
+		} else {
+			if len(report.CorruptRanges) == 0 {
+				entriesBeforeCorruption++
+			}
+			if report.Entries == 0 {
+				report.FirstSequenceNumber = entry.GetLogSequenceNumber()
+			}
+			report.LastSequenceNumber = entry.GetLogSequenceNumber()
+			report.Entries++
+		}
+
+		offset = end
+	}
+
+	return report, entriesBeforeCorruption
+}
+
+// truncated records that the segment ends with a truncated entry starting at offset.
+func (r *SegmentReport) truncated(offset int64, err error) {
+	r.CorruptRanges = append(r.CorruptRanges, CorruptRange{
+		Start: offset, End: r.Size, Kind: CorruptionTruncated, Error: err.Error(),
+	})
+}
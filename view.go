@@ -0,0 +1,385 @@
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"sort"
+)
+
+// inPlaceEntry is an entry whose fields are read in place from its record, without unmarshaling it:
+// flatEntry and capnpEntry. Its accessors assume the record was checked by its verifier.
+type inPlaceEntry interface {
+	lsn() uint64
+	crc() uint32
+	isCheckpoint() (value, ok bool)
+	tombstone() bool
+	timestamp() int64
+	hlc() uint64
+	data() []byte
+	metadata() []byte
+	stream() []byte
+	key() []byte
+	schema() []byte
+	schemaVersion() uint32
+	blob() []byte
+	valuePointer() []byte
+	// labelCount and label return the labels, in key order.
+	labelCount() int
+	label(i int) (key, value []byte)
+}
+
+// verifyInPlaceCRC is verifyCRC for an entry read in place, checksummed with the given checksum. The
+// fields are checksummed like computeCRC does, the labels being stored in key order already.
+func verifyInPlaceCRC[E inPlaceEntry](e E, checksum Checksum) bool {
+	table := crc32.IEEETable
+	if checksum == ChecksumCastagnoli {
+		table = castagnoliTable
+	}
+	crc := crc32.Checksum(e.data(), table)
+	lowByte := int(byte(e.lsn()))
+	crc = crc32.Update(crc, table, byteValues[lowByte:lowByte+1])
+
+	crc = crc32.Update(crc, table, e.metadata())
+	for i := 0; i < e.labelCount(); i++ {
+		key, value := e.label(i)
+		crc = crc32.Update(crc, table, key)
+		crc = crc32.Update(crc, table, byteValues[:1])
+		crc = crc32.Update(crc, table, value)
+		crc = crc32.Update(crc, table, byteValues[:1])
+	}
+	crc = crc32.Update(crc, table, e.stream())
+	crc = crc32.Update(crc, table, e.key())
+	var scratch [8]byte
+	if timestamp := e.timestamp(); timestamp != 0 {
+		crc = crc32.Update(crc, table, binary.LittleEndian.AppendUint64(scratch[:0], uint64(timestamp)))
+	}
+	if hlc := e.hlc(); hlc != 0 {
+		crc = crc32.Update(crc, table, binary.LittleEndian.AppendUint64(scratch[:0], hlc))
+	}
+	if e.tombstone() {
+		crc = crc32.Update(crc, table, byteValues[1:2])
+	}
+	crc = crc32.Update(crc, table, e.schema())
+	if version := e.schemaVersion(); version != 0 {
+		crc = crc32.Update(crc, table, binary.LittleEndian.AppendUint32(scratch[:0], version))
+	}
+	crc = crc32.Update(crc, table, e.blob())
+	crc = crc32.Update(crc, table, e.valuePointer())
+	return crc == e.crc()
+}
+
+// copyInPlaceEntry sets the fields of the entry to copies of the fields of e, checksummed with the given
+// checksum, resetting it first.
+func copyInPlaceEntry[E inPlaceEntry](e E, checksum Checksum, entry *WAL_Entry) {
+	entry.Reset()
+	entry.LogSequenceNumber = e.lsn()
+	entry.CRC = e.crc()
+	entry.Checksum = uint32(checksum)
+	if isCheckpoint, ok := e.isCheckpoint(); ok {
+		entry.IsCheckpoint = &isCheckpoint
+	}
+	entry.Tombstone = e.tombstone()
+	entry.Timestamp = e.timestamp()
+	entry.Hlc = e.hlc()
+	entry.Data = cloneBytes(e.data())
+	entry.Metadata = cloneBytes(e.metadata())
+	entry.Stream = string(e.stream())
+	entry.Key = cloneBytes(e.key())
+	entry.Schema = string(e.schema())
+	entry.SchemaVersion = e.schemaVersion()
+	entry.Blob = cloneBytes(e.blob())
+	entry.ValuePointer = cloneBytes(e.valuePointer())
+	if n := e.labelCount(); n > 0 {
+		entry.Labels = make(map[string]string, n)
+		for i := 0; i < n; i++ {
+			key, value := e.label(i)
+			entry.Labels[string(key)] = string(value)
+		}
+	}
+}
+
+// lookupLabel returns the value of the label of e with the given key, with a binary search.
+func lookupLabel[E inPlaceEntry](e E, key string) (string, bool) {
+	n := e.labelCount()
+	i := sort.Search(n, func(i int) bool {
+		k, _ := e.label(i)
+		return string(k) >= key
+	})
+	if i == n {
+		return "", false
+	}
+	k, value := e.label(i)
+	if string(k) != key {
+		return "", false
+	}
+	return string(value), true
+}
+
+// copyEntry sets the fields of dst to copies of the fields of src, resetting it first, like proto.Reset
+// followed by proto.Merge would.
+func copyEntry(src, dst *WAL_Entry) {
+	dst.Reset()
+	dst.LogSequenceNumber = src.LogSequenceNumber
+	dst.Data = cloneBytes(src.Data)
+	dst.CRC = src.CRC
+	if src.IsCheckpoint != nil {
+		isCheckpoint := *src.IsCheckpoint
+		dst.IsCheckpoint = &isCheckpoint
+	}
+	dst.Metadata = cloneBytes(src.Metadata)
+	if len(src.Labels) > 0 {
+		dst.Labels = maps.Clone(src.Labels)
+	}
+	dst.Stream = src.Stream
+	dst.Key = cloneBytes(src.Key)
+	dst.Timestamp = src.Timestamp
+	dst.Hlc = src.Hlc
+	dst.Checksum = src.Checksum
+	dst.Tombstone = src.Tombstone
+	dst.Schema = src.Schema
+	dst.SchemaVersion = src.SchemaVersion
+	dst.Blob = cloneBytes(src.Blob)
+	dst.ValuePointer = cloneBytes(src.ValuePointer)
+	dst.unknownFields = cloneBytes(src.unknownFields)
+}
+
+func cloneBytes(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// EntryView gives access to the fields of an entry read by Tail.ReadViews. The entries written with
+// EncodingFlatBuffers or EncodingCapnProto are read in place, without unmarshaling or copying them: the
+// slices returned by its methods are only valid until the function the view was passed to returns.
+// Entries written with other encodings are unmarshaled first.
+type EntryView struct {
+	// record is the entry read in place, encoded with encoding and checksummed with checksum, or nil if
+	// entry is set.
+	record   []byte
+	encoding Encoding
+	checksum Checksum
+	entry    *WAL_Entry
+}
+
+// LogSequenceNumber returns the sequence number of the entry.
+func (v EntryView) LogSequenceNumber() uint64 {
+	switch {
+	case v.entry != nil:
+		return v.entry.GetLogSequenceNumber()
+	case v.encoding == EncodingCapnProto:
+		return capnpEntry(v.record).lsn()
+	default:
+		return flatEntry(v.record).lsn()
+	}
+}
+
+// IsCheckpoint reports whether the entry is a checkpoint.
+func (v EntryView) IsCheckpoint() bool {
+	var isCheckpoint bool
+	switch {
+	case v.entry != nil:
+		isCheckpoint = v.entry.GetIsCheckpoint()
+	case v.encoding == EncodingCapnProto:
+		isCheckpoint, _ = capnpEntry(v.record).isCheckpoint()
+	default:
+		isCheckpoint, _ = flatEntry(v.record).isCheckpoint()
+	}
+	return isCheckpoint
+}
+
+// Tombstone reports whether the entry is a tombstone, see WithTombstone.
+func (v EntryView) Tombstone() bool {
+	switch {
+	case v.entry != nil:
+		return v.entry.GetTombstone()
+	case v.encoding == EncodingCapnProto:
+		return capnpEntry(v.record).tombstone()
+	default:
+		return flatEntry(v.record).tombstone()
+	}
+}
+
+// Data returns the data of the entry.
+func (v EntryView) Data() []byte {
+	switch {
+	case v.entry != nil:
+		return v.entry.GetData()
+	case v.encoding == EncodingCapnProto:
+		return capnpEntry(v.record).data()
+	default:
+		return flatEntry(v.record).data()
+	}
+}
+
+// Metadata returns the metadata of the entry.
+func (v EntryView) Metadata() []byte {
+	switch {
+	case v.entry != nil:
+		return v.entry.GetMetadata()
+	case v.encoding == EncodingCapnProto:
+		return capnpEntry(v.record).metadata()
+	default:
+		return flatEntry(v.record).metadata()
+	}
+}
+
+// Stream returns the stream of the entry.
+func (v EntryView) Stream() string {
+	switch {
+	case v.entry != nil:
+		return v.entry.GetStream()
+	case v.encoding == EncodingCapnProto:
+		return string(capnpEntry(v.record).stream())
+	default:
+		return string(flatEntry(v.record).stream())
+	}
+}
+
+// Key returns the key of the entry.
+func (v EntryView) Key() []byte {
+	switch {
+	case v.entry != nil:
+		return v.entry.GetKey()
+	case v.encoding == EncodingCapnProto:
+		return capnpEntry(v.record).key()
+	default:
+		return flatEntry(v.record).key()
+	}
+}
+
+// Timestamp returns the application timestamp of the entry, in nanoseconds since the Unix epoch.
+func (v EntryView) Timestamp() int64 {
+	switch {
+	case v.entry != nil:
+		return v.entry.GetTimestamp()
+	case v.encoding == EncodingCapnProto:
+		return capnpEntry(v.record).timestamp()
+	default:
+		return flatEntry(v.record).timestamp()
+	}
+}
+
+// HLC returns the hybrid logical clock timestamp of the entry, see WithHybridClock.
+func (v EntryView) HLC() HLC {
+	switch {
+	case v.entry != nil:
+		return HLC(v.entry.GetHlc())
+	case v.encoding == EncodingCapnProto:
+		return HLC(capnpEntry(v.record).hlc())
+	default:
+		return HLC(flatEntry(v.record).hlc())
+	}
+}
+
+// Schema returns the identifier and the version of the schema of the data of the entry, see WithSchema.
+func (v EntryView) Schema() (string, uint32) {
+	switch {
+	case v.entry != nil:
+		return v.entry.GetSchema(), v.entry.GetSchemaVersion()
+	case v.encoding == EncodingCapnProto:
+		c := capnpEntry(v.record)
+		return string(c.schema()), c.schemaVersion()
+	default:
+		f := flatEntry(v.record)
+		return string(f.schema()), f.schemaVersion()
+	}
+}
+
+// hasExternalData reports whether the data of the entry is stored out of it, in the blobs directory or
+// the value log, see WithBlobThreshold and WithValueLog.
+func (v EntryView) hasExternalData() bool {
+	switch {
+	case v.entry != nil:
+		return len(v.entry.GetBlob()) > 0 || len(v.entry.GetValuePointer()) > 0
+	case v.encoding == EncodingCapnProto:
+		c := capnpEntry(v.record)
+		return len(c.blob()) > 0 || len(c.valuePointer()) > 0
+	default:
+		f := flatEntry(v.record)
+		return len(f.blob()) > 0 || len(f.valuePointer()) > 0
+	}
+}
+
+// Label returns the value of the label of the entry with the given key, and whether it is set.
+func (v EntryView) Label(key string) (string, bool) {
+	switch {
+	case v.entry != nil:
+		value, ok := v.entry.GetLabels()[key]
+		return value, ok
+	case v.encoding == EncodingCapnProto:
+		return lookupLabel(capnpEntry(v.record), key)
+	default:
+		return lookupLabel(flatEntry(v.record), key)
+	}
+}
+
+// Entry returns the entry, unmarshaled. Unlike the view, it can be kept after the function the view was
+// passed to returns.
+func (v EntryView) Entry() *WAL_Entry {
+	entry := &WAL_Entry{}
+	v.copyTo(entry)
+	return entry
+}
+
+// copyTo sets the fields of the entry to copies of the fields of the view.
+func (v EntryView) copyTo(entry *WAL_Entry) {
+	switch {
+	case v.entry != nil:
+		copyEntry(v.entry, entry)
+	case v.encoding == EncodingCapnProto:
+		copyInPlaceEntry(capnpEntry(v.record), v.checksum, entry)
+	default:
+		copyInPlaceEntry(flatEntry(v.record), v.checksum, entry)
+	}
+}
+
+// newEntryView returns the view of the record, read from a segment of the given format, verifying its CRC.
+// Records that aren't encoded with EncodingFlatBuffers or EncodingCapnProto are unmarshaled into entry,
+// or into a new entry if it is nil.
+func newEntryView(record []byte, format segmentFormat, entry *WAL_Entry) (EntryView, error) {
+	encoding := format.encoding
+	if format.version == 0 {
+		// The records of the segments without a header start with a marker instead.
+		encoding = EncodingProtobuf
+		if len(record) > 0 {
+			switch record[0] {
+			case flatBuffersEncodingMarker:
+				encoding, record = EncodingFlatBuffers, record[1:]
+			case capnpEncodingMarker:
+				encoding, record = EncodingCapnProto, record[1:]
+			}
+		}
+	}
+	switch encoding {
+	case EncodingFlatBuffers:
+		f, err := verifyFlatEntry(record)
+		if err != nil {
+			return EntryView{}, fmt.Errorf("%w: %v", ErrInvalidEntry, err)
+		}
+		if !verifyInPlaceCRC(f, format.checksum) {
+			return EntryView{}, ErrCorruptEntry
+		}
+		return EntryView{record: f, encoding: EncodingFlatBuffers, checksum: format.checksum}, nil
+	case EncodingCapnProto:
+		c, err := verifyCapnpEntry(record)
+		if err != nil {
+			return EntryView{}, fmt.Errorf("%w: %v", ErrInvalidEntry, err)
+		}
+		if !verifyInPlaceCRC(c, format.checksum) {
+			return EntryView{}, ErrCorruptEntry
+		}
+		return EntryView{record: c, encoding: EncodingCapnProto, checksum: format.checksum}, nil
+	default:
+		if entry == nil {
+			entry = &WAL_Entry{}
+		}
+		if err := unmarshalAndVerifyEntryInto(record, format, entry); err != nil {
+			return EntryView{}, err
+		}
+		return EntryView{entry: entry}, nil
+	}
+}
@@ -3,61 +3,236 @@ package wal
 import (
 	"bufio"
 	"context"
-	"encoding/binary"
+	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
 	"log"
+	"log/slog"
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-
-	"google.golang.org/protobuf/proto"
 )
 
 const (
-	syncInterval  = 200 * time.Millisecond
-	segmentPrefix = "segment-"
+	defaultSyncInterval   = 200 * time.Millisecond
+	defaultReadBufferSize = 1 << 20
+	segmentPrefix         = "segment-"
 )
 
+// ErrClosed is returned by writes issued after the WAL has been closed.
+var ErrClosed = errors.New("wal is closed")
+
+// ErrUnknownFiles is returned by OpenWAL with RejectUnknownFiles when the directory contains
+// files that don't belong to the WAL.
+var ErrUnknownFiles = errors.New("unknown files in wal directory")
+
+// ErrNotExist is returned by OpenWAL in MustExist mode when the directory or its segments don't exist.
+// It wraps os.ErrNotExist.
+var ErrNotExist = fmt.Errorf("wal does not exist: %w", os.ErrNotExist)
+
 // WAL structure
 type WAL struct {
 	directory           string
-	currentSegment      *os.File
+	currentSegment      File
 	currentSegmentIndex int
 	lastSequenceNo      uint64
 	shouldFsync         bool
 	maxFileSize         int64
 	maxSegments         int
-	bufWriter           *bufio.Writer
-	syncTimer           *time.Timer
+	bufWriter           segmentWriter
+	syncInterval        time.Duration
+	syncJitter          time.Duration
+	syncIntervalChanged chan struct{} // signals keepSyncing that syncInterval changed
+	syncerDone          chan struct{} // closed once keepSyncing returns, nil without background sync
+	syncMode            SyncMode
+	clock               Clock
+	fs                  FS
+	consumerOffsets     map[string]uint64 // offsets committed by consumers, by name
+	streamStats         map[string]*StreamStats
+	checkpoints         []*WAL_Entry // retained checkpoints, oldest first
+	checkpointRetention int
+	stats               Stats // counters, updated while holding lock
+	openedAt            time.Time
+	lastFlushTime       time.Time
+	lastSyncErr         error // error of the last background sync, nil if it succeeded
+	budget              byteBudget
+	instrumentation     Instrumentation // traces and measures the operations, nil without WithInstrumentation
+	slowSyncThreshold   time.Duration
+	onSlowSync          func(time.Duration)
+	hooks               Hooks
+	eventLogger         *slog.Logger
+	adminJournal        bool
+	lease               Lease            // lease held by the WAL, see WithLease
+	leaseDuration       time.Duration    // 0 if the WAL doesn't hold a lease
+	leaseErr            error            // ErrFenced once the lease was lost
+	webhooks            *webhookNotifier // nil unless WithWebhook is set
+	shipper             *shipper         // nil unless WithShipping is set
+	hybridClock         *hybridClock     // nil unless WithHybridClock is set
+	mirror              *mirrorFS        // nil unless WithMirror is set
+	writeback           int64            // bytes flushed between writebacks, 0 to disable them, see WithWriteback
+	writebackFlushed    uint64           // stats.FlushedBytes when the last writeback of the current segment started
+	dropSealedCache     bool             // see WithDropSealedCache
+	segmentEntries      map[string]int   // entry counts of the segments, by path, where known, to size reads
+	readBufferSize      int              // size of the buffer segments are scanned through, see WithReadBufferSize
+	flushThreshold      int              // buffered bytes flushed without waiting for the sync timer, 0 to disable, see WithFlushThresholdBytes
+	format              segmentFormat    // format of the segments created, see WithChecksum and WithEncoding
+	segmentFormat       segmentFormat    // format of the current segment, recorded in its header
+	blobThreshold       int              // see WithBlobThreshold
+	valueLog            *valueLog        // nil unless WithValueLog is set
+	entryCache          *entryCache      // nil unless WithEntryCache is set
+	mmap                bool             // see WithMmap
+	writePipeline       int              // see WithWritePipeline
+	dataSync            bool             // see WithDataSync
+	preallocate         bool             // see WithPreallocate
+	recycleSegments     bool             // see WithRecycleSegments
+	spareReady          bool             // whether the spare segment is ready, see createSegment
+	hasRecycled         bool             // whether a segment is kept for recycling
+	backups             int              // backups in progress, see Backup
+	spareSignal         chan struct{}    // wakes up keepSpare
+	spareDone           chan struct{}    // closed once keepSpare returns, nil without WithPreallocate
+	segmentEnd          int64            // end of the data of the current segment when it was opened
+	segmentSize         int64            // buffered size of the current segment, -1 until read, see rotateLogIfNeeded
+	journalLock         sync.Mutex       // serializes access to the admin journal
+	unregisterStats     func()           // stops exposing the Stats through the instrumentation
 	lock                sync.Mutex
 	ctx                 context.Context
 	cancel              context.CancelFunc
+
+	// closeLock guards closed and the registration of in-flight writers,
+	// so that CloseContext can stop accepting writes and wait for the ones in progress.
+	closeLock sync.Mutex
+	closed    bool
+	writers   sync.WaitGroup
+
+	// stageLock guards the writes staged by writeEntry, see stageEntry.
+	stageLock sync.Mutex
+	staged    []*stagedWrite
+	spare     []*stagedWrite // the slice of the last batch, reused for the next one
+	combining bool           // a writer is appending the staged entries
+
+	// Sync fsyncs the segment file without holding lock, so that writers aren't stalled by the fsync.
+	// syncLock guards the state of this group commit: a sync waits for the fsync in flight if it started
+	// after the sync flushed its data, or else for the next one, which covers the data of all its waiters.
+	// flushes counts the flushes of the buffer, and is updated while holding lock, like flushedLSN.
+	syncLock      sync.Mutex
+	syncCond      *sync.Cond
+	syncing       bool           // an fsync is in flight
+	flushes       uint64         // flushes of the buffer so far
+	flushedLSN    uint64         // sequence number of the last entry flushed
+	syncedFlushes uint64         // flushes known to be durable
+	syncedLSN     uint64         // sequence number of the last entry known to be durable
+	fsyncs        sync.WaitGroup // fsyncs running without lock, waited for before closing the segment file
+	// tailsNotify is closed, and replaced, when entries are flushed or synced, to wake up the tails of the
+	// WAL, see Tail.Wait. It is only replaced if a tail took it since, which tailsWaiting records.
+	tailsNotify  chan struct{}
+	tailsWaiting bool
+
+	// corruptionLock guards corruptionErr and the corruption counters, which record the corruption detected
+	// while reading or repairing the log. Reads do not hold lock, so it has its own mutex.
+	corruptionLock    sync.Mutex
+	corruptionErr     error
+	corruptionEvents  uint64
+	checksumFailures  uint64
+	unmarshalFailures uint64
+	truncations       uint64
+
+	// blobLock guards pendingBlobs, the number of writes storing each blob whose entry may not be in the
+	// log yet, by name, see storeBlob and CollectBlobs.
+	blobLock     sync.Mutex
+	pendingBlobs map[string]int
 }
 
 // OpenWAL initialize a new WAL.
-// If the directory does not exist, it will be created.
+// If the directory does not exist, it will be created, unless the MustExist open mode is set,
+// in which case ErrNotExist is returned.
 // If the directory exists, the last log segment file will be opened and the last sequence number will be read from it.
 // enableFsync enables fsync on the log segment file every time the log flushes.
 // maxFileSize is the maximum size of a log segment file in bytes.
 // maxSegments is the maximum number of log segment files to keep.
-func OpenWAL(directory string, enableFsync bool, maxFileSize int64, maxSegments int) (*WAL, error) {
-	// Create the directory if it doesn't exist
-	if err := os.MkdirAll(directory, 0755); err != nil {
+// opts can be used to configure optional behaviour, see Option.
+func OpenWAL(directory string, enableFsync bool, maxFileSize int64, maxSegments int, opts ...Option) (_ *WAL, err error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.durabilityProfile.apply(&o); err != nil {
 		return nil, err
 	}
+	if o.encoding < EncodingProtobuf || o.encoding > EncodingCapnProto {
+		return nil, fmt.Errorf("unknown encoding %v", o.encoding)
+	}
+
+	if o.openMode == MustExist {
+		if _, err := o.fs.Stat(directory); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("%w: directory %s not found", ErrNotExist, directory)
+			}
+			return nil, err
+		}
+	} else {
+		// Create the directory if it doesn't exist
+		if err := o.fs.MkdirAll(directory, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	var mirror *mirrorFS
+	if o.mirrorDirectory != "" {
+		var err error
+		if mirror, err = newMirrorFS(o.fs, directory, o.mirrorDirectory, o.mirrorPolicy); err != nil {
+			return nil, err
+		}
+		o.fs = mirror
+	}
+
+	if o.unknownFiles != AllowUnknownFiles {
+		if err := checkUnknownFiles(o.fs, directory, o.unknownFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	// The lease must be held before the segments are read or repaired.
+	var lease Lease
+	if o.leaseDuration > 0 {
+		if lease, err = acquireLease(o.fs, o.clock, directory, o.leaseHolder, o.leaseDuration); err != nil {
+			return nil, err
+		}
+	}
+
+	// What was acquired so far is released if the WAL can't be opened.
+	var wal *WAL
+	var file File
+	defer func() {
+		switch {
+		case err == nil:
+		case wal != nil:
+			wal.abortOpen()
+		default:
+			if file != nil {
+				file.Close()
+			}
+			if o.leaseDuration > 0 {
+				lease.Expires = o.clock.Now()
+				writeLease(o.fs, directory, lease)
+			}
+		}
+	}()
 
 	// Get the list of log segment files in the directory
-	files, err := filepath.Glob(filepath.Join(directory, segmentPrefix+"*"))
+	files, err := o.fs.Glob(filepath.Join(directory, segmentPrefix+"*"))
 	if err != nil {
 		return nil, err
 	}
 
+	if len(files) == 0 && o.openMode == MustExist {
+		return nil, fmt.Errorf("%w: no log segments found in %s", ErrNotExist, directory)
+	}
+
 	var lastSegmentID int
 	if len(files) > 0 {
 		// Find the last segment ID
@@ -67,7 +242,7 @@ func OpenWAL(directory string, enableFsync bool, maxFileSize int64, maxSegments
 		}
 	} else {
 		// Create the first log segment
-		file, err := createSegmentFile(directory, 0)
+		file, err := createSegmentFile(o.fs, directory, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -79,7 +254,7 @@ func OpenWAL(directory string, enableFsync bool, maxFileSize int64, maxSegments
 
 	// Open the last log segment file
 	filePath := filepath.Join(directory, fmt.Sprintf("%s%d", segmentPrefix, lastSegmentID))
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	file, err = o.fs.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
@@ -92,87 +267,458 @@ func OpenWAL(directory string, enableFsync bool, maxFileSize int64, maxSegments
 	// ctx and cancel are used to control the go routines
 	ctx, cancel := context.WithCancel(context.Background())
 
-	wal := &WAL{
+	wal = &WAL{
 		directory:           directory,
 		currentSegment:      file,
 		lastSequenceNo:      0,
-		bufWriter:           bufio.NewWriter(file),
-		syncTimer:           time.NewTimer(syncInterval), // syncInterval is a predefined duration
+		syncInterval:        o.syncInterval,
+		syncJitter:          o.syncJitter,
+		syncIntervalChanged: make(chan struct{}, 1),
+		tailsNotify:         make(chan struct{}),
+		syncMode:            o.syncMode,
+		checkpointRetention: o.checkpointRetention,
+		blobThreshold:       o.blobThreshold,
+		pendingBlobs:        make(map[string]int),
+		stats: Stats{
+			FsyncLatency: newLatencyHistogram(),
+			WriteLatency: newHistogram(writeLatencyBuckets),
+			SyncLatency:  newLatencyHistogram(),
+		},
+		streamStats:         make(map[string]*StreamStats),
+		openedAt:            o.clock.Now(),
+		budget:              o.budget,
+		instrumentation:     o.instrumentation,
+		slowSyncThreshold:   o.slowSyncThreshold,
+		onSlowSync:          o.onSlowSync,
+		hooks:               o.hooks,
+		eventLogger:         o.eventLogger,
+		adminJournal:        o.adminJournal,
+		lease:               lease,
+		mirror:              mirror,
+		writeback:           o.writeback,
+		dropSealedCache:     o.dropSealedCache,
+		leaseDuration:       o.leaseDuration,
+		clock:               o.clock,
+		fs:                  o.fs,
 		shouldFsync:         enableFsync,
 		maxFileSize:         maxFileSize,
 		maxSegments:         maxSegments,
 		currentSegmentIndex: lastSegmentID,
+		segmentEntries:      make(map[string]int),
+		readBufferSize:      o.readBufferSize,
+		flushThreshold:      o.flushThreshold,
+		mmap:                o.mmap,
+		writePipeline:       o.writePipeline,
+		dataSync:            o.dataSync,
+		preallocate:         o.preallocate || o.recycleSegments,
+		recycleSegments:     o.recycleSegments,
+		spareSignal:         make(chan struct{}, 1),
 		ctx:                 ctx,
 		cancel:              cancel,
 	}
+	wal.setSegmentWriter(file)
+	wal.syncCond = sync.NewCond(&wal.syncLock)
+	if o.valueLogThreshold > 0 {
+		wal.valueLog = newValueLog(o.fs, directory, o.valueLogThreshold, maxFileSize)
+	}
+	if o.entryCacheSize > 0 {
+		wal.entryCache = newEntryCache(o.entryCacheSize)
+	}
+	if mirror != nil {
+		mirror.setOnDetach(func(err error) {
+			wal.logEvent(slog.LevelError, EventMirrorDetached, slog.String("mirror", mirror.mirror), slog.String("error", err.Error()))
+		})
+	}
 
+	span := wal.startSpan("wal.Recover", slog.String("wal.directory", directory))
 	if wal.lastSequenceNo, err = wal.getLastSequenceNo(); err != nil {
+		span.End(err)
+		return nil, err
+	}
+	wal.resetSynced()
+	if err := wal.openCurrentSegment(); err != nil {
+		span.End(err)
+		return nil, err
+	}
+	if err := wal.initSpare(); err != nil {
+		span.End(err)
+		return nil, err
+	}
+	// Existing WALs keep the format of their current segment, which may have no header if it was written
+	// by an earlier version, so that they stay readable by it. Other formats apply from the next segment on.
+	wal.format = wal.segmentFormat
+	if len(files) == 0 {
+		wal.format = segmentFormat{version: segmentHeaderVersion, checksum: ChecksumCastagnoli}
+	}
+	if o.checksumSet && o.checksum != wal.format.checksum {
+		wal.format.version, wal.format.checksum = segmentHeaderVersion, o.checksum
+	}
+	if o.encoding != wal.format.encoding {
+		wal.format.version, wal.format.encoding = segmentHeaderVersion, o.encoding
+	}
+	if wal.segmentEnd == 0 {
+		if err := wal.startSegment(); err != nil {
+			span.End(err)
+			return nil, err
+		}
+	}
+
+	if o.hybridClock {
+		if wal.hybridClock, err = wal.newHybridClock(); err != nil {
+			span.End(err)
+			return nil, err
+		}
+	}
+
+	if wal.checkpoints, err = loadCheckpoints(o.fs, directory); err != nil {
+		span.End(err)
 		return nil, err
 	}
 
-	// fire a separate go routine for syncing the current log segment file
-	go wal.keepSyncing()
+	if wal.consumerOffsets, err = loadConsumerOffsets(o.fs, directory); err != nil {
+		span.End(err)
+		return nil, err
+	}
+	span.SetAttributes(slog.Uint64("wal.last_sequence_number", wal.lastSequenceNo))
+	span.End(nil)
+
+	if err := wal.registerStats(); err != nil {
+		return nil, err
+	}
+	// The shipper is created before the goroutines are started, so that no goroutine outlives a failed open.
+	if o.shipTarget != nil {
+		if wal.shipper, err = newShipper(o.fs, o.clock, directory, o.shipTarget, o.shipInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	// fire a separate go routine for syncing the current log segment file,
+	// unless a Manager drives the syncing of all its WALs.
+	if o.backgroundSync {
+		wal.syncerDone = make(chan struct{})
+		go wal.keepSyncing(newTicker(o.clock, o.syncInterval, o.syncJitter))
+	}
+	if wal.preallocate {
+		wal.spareDone = make(chan struct{})
+		go wal.keepSpare()
+	}
+	if wal.shipper != nil {
+		go wal.keepShipping(wal.shipper, o.clock.NewTimer(o.shipInterval))
+	}
+	if len(o.webhookURLs) > 0 {
+		wal.webhooks = newWebhookNotifier(o.webhookSecret, o.webhookURLs)
+		go wal.deliverWebhooks(wal.webhooks)
+	}
+	for _, s := range o.statsSinks {
+		go wal.reportStats(s.sink, o.clock.NewTimer(s.interval), s.interval)
+	}
+	if o.leaseDuration > 0 {
+		go wal.keepLease(o.clock.NewTimer(o.leaseDuration / 3))
+		wal.logEvent(slog.LevelInfo, EventLeaseAcquired,
+			slog.Uint64("epoch", lease.Epoch),
+			slog.String("holder", lease.Holder),
+			slog.Time("expires", lease.Expires))
+	}
+
+	wal.logEvent(slog.LevelInfo, EventOpened,
+		slog.Int("segment", lastSegmentID),
+		slog.Uint64("last_sequence_number", wal.lastSequenceNo),
+		slog.Int("checkpoints", len(wal.checkpoints)),
+		slog.Bool("created", len(files) == 0))
 
 	return wal, nil
 }
 
+// abortOpen releases what OpenWAL acquired for the WAL, once it failed to open it. The background
+// goroutines aren't started yet.
+func (wal *WAL) abortOpen() {
+	wal.cancel()
+	if wal.unregisterStats != nil {
+		wal.unregisterStats()
+	}
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	wal.releaseLease()
+	wal.stopSegmentWriter()
+	wal.currentSegment.Close()
+	if wal.valueLog != nil {
+		wal.valueLog.close()
+	}
+}
+
 // WriteEntry writes an entry to the WAL.
 func (wal *WAL) WriteEntry(data []byte) error {
-	return wal.writeEntry(data, false)
+	entry := entryPool.Get().(*WAL_Entry)
+	entry.Data = data
+	err := wal.writeEntry(entry)
+	entry.Reset()
+	entryPool.Put(entry)
+	return err
+}
+
+// WriteEntryWithMetadata writes an entry to the WAL with application defined metadata and labels
+// stored alongside the data. They are returned with the entry by the read APIs (GetMetadata, GetLabels)
+// and are covered by the entry's CRC. Either may be nil.
+func (wal *WAL) WriteEntryWithMetadata(data []byte, metadata []byte, labels map[string]string) error {
+	return wal.WriteEntryOpts(data, WithMetadata(metadata), WithLabels(labels))
 }
 
 // CreateCheckpoint creates a checkpoint entry in the WAL.
 // A checkpoint entry is a special entry that can be used to restore the state of the system to the point when the checkpoint was created.
 func (wal *WAL) CreateCheckpoint(data []byte) error {
-	return wal.writeEntry(data, true)
+	isCheckpoint := true
+	return wal.writeEntry(&WAL_Entry{Data: data, IsCheckpoint: &isCheckpoint})
 }
 
-func (wal *WAL) writeEntry(data []byte, isCheckpoint bool) error {
-	wal.lock.Lock()
-	defer wal.lock.Unlock()
+// writeEntry assigns the next sequence number and the CRC to the given entry and writes it to the WAL.
+// It doesn't allocate unless the entry is a checkpoint or instrumentation is set, see
+// BenchmarkWriteEntryAllocs.
+func (wal *WAL) writeEntry(entry *WAL_Entry) (err error) {
+	if wal.instrumentation != nil {
+		span := wal.startSpan("wal.WriteEntry",
+			slog.Int("wal.entry.size", len(entry.GetData())),
+			slog.Bool("wal.entry.checkpoint", entry.GetIsCheckpoint()))
+		defer func() {
+			span.SetAttributes(slog.Uint64("wal.entry.sequence_number", entry.GetLogSequenceNumber()))
+			span.End(err)
+		}()
+	}
 
-	if err := wal.rotateLogIfNeeded(); err != nil {
+	if err := validateStrings(entry); err != nil {
+		return err
+	}
+	if wal.budget != nil {
+		if err := wal.budget.admit(int64(entry.SizeVT())); err != nil {
+			return err
+		}
+	}
+	if !wal.beginWrite() {
+		return ErrClosed
+	}
+	defer wal.writers.Done()
+
+	// The data is only stored outside of the log once the write is accepted.
+	if wal.blobThreshold > 0 && len(entry.GetData()) > wal.blobThreshold && !entry.GetIsCheckpoint() {
+		done, err := wal.storeBlob(entry)
+		if err != nil {
+			return err
+		}
+		defer done()
+	}
+	if wal.valueLog != nil && len(entry.GetData()) > wal.valueLog.threshold && !entry.GetIsCheckpoint() {
+		done, err := wal.valueLog.append(entry)
+		if err != nil {
+			return err
+		}
+		defer done()
+	}
+
+	start := wal.clock.Now()
+	if err := wal.stageEntry(entry, start); err != nil || !entry.GetIsCheckpoint() {
 		return err
 	}
 
-	wal.lastSequenceNo++
-	entry := &WAL_Entry{
-		LogSequenceNumber: wal.lastSequenceNo,
-		Data:              data,
-		CRC:               crc32.ChecksumIEEE(append(data, byte(wal.lastSequenceNo))),
+	// The checkpoint entry must be durable before it is recorded in the side-file.
+	// It is synced without holding the lock, like any other sync.
+	err = wal.Sync()
+	wal.lock.Lock()
+	defer func() {
+		wal.stats.WriteLatency.observe(wal.clock.Now().Sub(start))
+		wal.lock.Unlock()
+	}()
+	if err != nil {
+		return fmt.Errorf("could not create checkpoint, error while syncing: %w", err)
+	}
+	if err := wal.saveCheckpoint(entry); err != nil {
+		return fmt.Errorf("could not create checkpoint, error while saving checkpoint file: %w", err)
 	}
+	if wal.hooks.OnCheckpoint != nil {
+		wal.hooks.OnCheckpoint(entry.GetLogSequenceNumber())
+	}
+	wal.notifyWebhooks(WebhookPayload{Event: WebhookEventCheckpoint, LogSequenceNumber: entry.GetLogSequenceNumber()})
+	return nil
+}
 
-	if isCheckpoint {
-		if err := wal.Sync(); err != nil {
-			return fmt.Errorf("could not create checkpoint, error while syncing: %v", err)
+// stagedWritePool holds the stagedWrites of stageEntry, so that staging doesn't allocate.
+var stagedWritePool = sync.Pool{New: func() any { return &stagedWrite{done: make(chan bool, 1)} }}
+
+// stagedWrite is an entry staged by writeEntry, waiting to be appended by the combining writer.
+type stagedWrite struct {
+	entry *WAL_Entry
+	start time.Time
+	err   error
+	// done receives false once the entry has been appended, or true if the write must combine the
+	// staged writes instead.
+	done chan bool
+}
+
+// stageEntry appends the entry to the buffer, like appendEntry, and returns the error of appendEntry.
+//
+// Concurrent writers don't all contend for wal.lock: they stage their entries under stageLock, which
+// is only held to add to the queue, and a single writer at a time, the combining writer, appends all of
+// the staged entries in one critical section. It then hands the combining over to the first write
+// staged meanwhile, if any, so that no writer keeps combining for the others indefinitely.
+func (wal *WAL) stageEntry(entry *WAL_Entry, start time.Time) error {
+	write := stagedWritePool.Get().(*stagedWrite)
+	write.entry, write.start = entry, start
+	wal.stageLock.Lock()
+	wal.staged = append(wal.staged, write)
+	combine := !wal.combining
+	wal.combining = true
+	wal.stageLock.Unlock()
+
+	if !combine {
+		combine = <-write.done
+	}
+	if combine {
+		wal.combineStaged()
+		// The combining writer's own write is in the batch it appended, so it was sent done too.
+		<-write.done
+	}
+	err := write.err
+	*write = stagedWrite{done: write.done}
+	stagedWritePool.Put(write)
+	return err
+}
+
+// combineStaged appends the staged entries, in the order they were staged, and hands the combining
+// over to the next staged write.
+func (wal *WAL) combineStaged() {
+	wal.stageLock.Lock()
+	batch := wal.staged
+	wal.staged, wal.spare = wal.spare[:0], nil
+	wal.stageLock.Unlock()
+
+	wal.lock.Lock()
+	for _, write := range batch {
+		write.err = wal.appendEntry(write.entry)
+		// The latency of checkpoints includes their sync, it is observed by writeEntry.
+		if write.err != nil || !write.entry.GetIsCheckpoint() {
+			wal.stats.WriteLatency.observe(wal.clock.Now().Sub(write.start))
+		}
+	}
+	wal.lock.Unlock()
+
+	wal.stageLock.Lock()
+	if len(wal.staged) > 0 {
+		wal.staged[0].done <- true
+	} else {
+		wal.combining = false
+	}
+	wal.stageLock.Unlock()
+
+	for _, write := range batch {
+		write.done <- false
+	}
+	clear(batch)
+	wal.stageLock.Lock()
+	wal.spare = batch
+	wal.stageLock.Unlock()
+}
+
+// appendEntry assigns the next sequence number and the CRC to the given entry and writes it to the buffer.
+// Checkpoints are only recorded in the side-file by writeEntry, once they are durable.
+// The caller must hold wal.lock.
+func (wal *WAL) appendEntry(entry *WAL_Entry) error {
+	if wal.leaseErr != nil {
+		return wal.leaseErr
+	}
+	if err := wal.rotateLogIfNeeded(); err != nil {
+		return err
+	}
+
+	// The sequence number is only consumed once the entry has been buffered,
+	// so that rejected writes don't leave gaps in the log.
+	sequenceNo := wal.lastSequenceNo + 1
+	if requested := entry.GetLogSequenceNumber(); requested != 0 {
+		if requested < sequenceNo {
+			return fmt.Errorf("%w: %d <= %d", ErrSequenceNumberTooLow, requested, wal.lastSequenceNo)
 		}
-		entry.IsCheckpoint = &isCheckpoint
+		sequenceNo = requested
 	}
+	entry.LogSequenceNumber = sequenceNo
+	wal.stampHLC(entry)
+	entry.Checksum = uint32(wal.segmentFormat.checksum)
+	entry.CRC = computeCRC(entry)
 
 	// initially writing the entry to in-memory buffer for faster writes
 	// periodic syncing to disc is done by the separate go-routine
-	return wal.writeEntryToBuffer(entry)
+	if err := wal.writeEntryToBuffer(entry); err != nil {
+		return err
+	}
+	wal.lastSequenceNo = sequenceNo
+
+	// The entry is buffered, so a failed flush is reported like a failed background sync, and the data is
+	// flushed again by the next one.
+	if wal.flushThreshold > 0 && wal.bufWriter.Buffered() >= wal.flushThreshold {
+		wal.stats.ThresholdFlushes++
+		if err := wal.flush(); err != nil {
+			wal.lastSyncErr = err
+		}
+	}
+	return nil
 }
 
 func (wal *WAL) writeEntryToBuffer(entry *WAL_Entry) error {
-	marshaledEntry := MustMarshal(entry)
+	// The frame is built in a single buffer, so that it is written with a single call.
+	buf := getEntryBuffer()
+	defer putEntryBuffer(buf)
+	*buf = appendEncodedFrame((*buf)[:0], entry, wal.segmentFormat.encoding)
+	frame := *buf
+
+	if wal.budget != nil {
+		if err := wal.budget.reserve(int64(len(frame))); err != nil {
+			return err
+		}
+	}
 
-	size := int32(len(marshaledEntry))
-	if err := binary.Write(wal.bufWriter, binary.LittleEndian, size); err != nil {
+	if _, err := wal.bufWriter.Write(frame); err != nil {
+		// Part of the frame may have been buffered.
+		wal.segmentSize = -1
+		if wal.budget != nil {
+			wal.budget.release(int64(len(frame)))
+		}
 		return err
 	}
-	_, err := wal.bufWriter.Write(marshaledEntry)
+	if wal.segmentSize >= 0 {
+		wal.segmentSize += int64(len(frame))
+	}
+	// The buffer may have been flushed to make room for the frame.
+	wal.maybeWriteback()
 
-	return err
+	if n, ok := wal.segmentEntries[wal.currentSegment.Name()]; ok {
+		wal.segmentEntries[wal.currentSegment.Name()] = n + 1
+	}
+	wal.stats.EntriesWritten++
+	wal.stats.BytesWritten += uint64(len(frame))
+	wal.stats.LogicalBytesWritten += uint64(len(entry.GetData()))
+	wal.stats.LargestEntrySize = max(wal.stats.LargestEntrySize, len(frame))
+
+	if stream := entry.GetStream(); stream != "" {
+		streamStats, ok := wal.streamStats[stream]
+		if !ok {
+			streamStats = &StreamStats{}
+			wal.streamStats[stream] = streamStats
+		}
+		streamStats.EntriesWritten++
+		streamStats.BytesWritten += uint64(len(frame))
+	}
+
+	return nil
 }
 
 func (wal *WAL) rotateLogIfNeeded() error {
-	fileInfo, err := wal.currentSegment.Stat()
-	if err != nil {
-		return err
+	// The size of the segment is only read from the file once, it is tracked as frames are buffered since.
+	if wal.segmentSize < 0 {
+		fileInfo, err := wal.currentSegment.Stat()
+		if err != nil {
+			return err
+		}
+		wal.segmentSize = fileInfo.Size() + int64(wal.bufWriter.Buffered()) - wal.segmentFormat.headerSize()
 	}
 
-	if fileInfo.Size()+int64(wal.bufWriter.Buffered()) >= wal.maxFileSize {
+	if wal.segmentSize >= wal.maxFileSize {
 		if err := wal.rotateLog(); err != nil {
 			return err
 		}
@@ -181,14 +727,38 @@ func (wal *WAL) rotateLogIfNeeded() error {
 	return nil
 }
 
-func (wal *WAL) rotateLog() error {
-	if err := wal.Sync(); err != nil {
+// Rotate syncs the current segment and starts writing to a new one, regardless of the segment's size.
+// As with size based rotation, the oldest segment is deleted if the segment limit is reached.
+func (wal *WAL) Rotate() error {
+	if !wal.beginWrite() {
+		return ErrClosed
+	}
+	defer wal.writers.Done()
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	err := wal.rotateLog()
+	wal.recordAdmin(AdminOpRotate, wal.currentSegment.Name(), "", err)
+	return err
+}
+
+func (wal *WAL) rotateLog() (err error) {
+	span := wal.startSpan("wal.Rotate", slog.Int("wal.segment", wal.currentSegmentIndex+1))
+	defer func() { span.End(err) }()
+
+	if err := wal.sync(); err != nil {
 		return err
 	}
 
+	sealed := wal.currentSegment.Name()
 	if err := wal.currentSegment.Close(); err != nil {
 		return err
 	}
+	// A shipped segment is read once more by the shipper, its pages are dropped once it is shipped.
+	if wal.shipper == nil {
+		wal.dropCache(sealed)
+	}
 
 	wal.currentSegmentIndex++
 	if wal.currentSegmentIndex >= wal.maxSegments {
@@ -197,20 +767,33 @@ func (wal *WAL) rotateLog() error {
 		}
 	}
 
-	newFile, err := createSegmentFile(wal.directory, wal.currentSegmentIndex)
+	newFile, err := wal.createSegment()
 	if err != nil {
 		return err
 	}
 
 	wal.currentSegment = newFile
-	wal.bufWriter = bufio.NewWriter(newFile)
+	wal.segmentEntries[newFile.Name()] = 0
+	wal.setSegmentWriter(newFile)
+	if err := wal.startSegment(); err != nil {
+		return err
+	}
+	wal.writebackFlushed = wal.stats.FlushedBytes
+	wal.stats.Rotations++
+	wal.logEvent(slog.LevelInfo, EventSegmentCreated,
+		slog.Int("segment", wal.currentSegmentIndex),
+		slog.String("path", newFile.Name()))
+	if wal.hooks.OnRotate != nil {
+		wal.hooks.OnRotate(wal.currentSegmentIndex)
+	}
+	wal.notifyWebhooks(WebhookPayload{Event: WebhookEventRotate, Segment: wal.currentSegmentIndex})
 
 	return nil
 }
 
 // removes the oldest log file
 func (wal *WAL) deleteOldestSegment() error {
-	files, err := filepath.Glob(filepath.Join(wal.directory, segmentPrefix+"*"))
+	files, err := wal.fs.Glob(filepath.Join(wal.directory, segmentPrefix+"*"))
 	if err != nil {
 		return err
 	}
@@ -226,14 +809,104 @@ func (wal *WAL) deleteOldestSegment() error {
 		return nil
 	}
 
-	// Delete the oldest segment file
-	if err := os.Remove(oldestSegmentFilePath); err != nil {
+	var size int64
+	if fileInfo, err := wal.fs.Stat(oldestSegmentFilePath); err == nil {
+		size = fileInfo.Size()
+	}
+
+	// Delete the oldest segment file, or keep it to prepare the next spare segment from with
+	// WithRecycleSegments, unless one is kept already, or a backup may be copying it.
+	if wal.recycleSegments && !wal.hasRecycled && wal.backups == 0 {
+		err = wal.fs.Rename(oldestSegmentFilePath, wal.recycledPath())
+		if err == nil {
+			wal.hasRecycled = true
+			wal.signalSpare()
+		}
+	} else {
+		err = wal.fs.Remove(oldestSegmentFilePath)
+	}
+	if err != nil {
+		wal.recordAdmin(AdminOpDeleteSegment, oldestSegmentFilePath, "segment limit", err)
 		return err
 	}
+	wal.recordAdmin(AdminOpDeleteSegment, oldestSegmentFilePath, "segment limit", nil)
+	delete(wal.segmentEntries, oldestSegmentFilePath)
+	if wal.entryCache != nil {
+		wal.evictDeletedEntries(files, oldestSegmentFilePath)
+	}
+
+	if wal.budget != nil {
+		wal.budget.release(size)
+	}
+	wal.stats.SegmentsDeleted++
+	wal.stats.RetentionBytesDeleted += uint64(size)
+	wal.logEvent(slog.LevelInfo, EventSegmentDeleted,
+		slog.String("path", oldestSegmentFilePath),
+		slog.Int64("size", size),
+		slog.String("reason", "segment limit"))
+	if wal.hooks.OnSegmentDelete != nil {
+		wal.hooks.OnSegmentDelete(oldestSegmentFilePath)
+	}
 
 	return nil
 }
 
+// evictDeletedEntries evicts the entries of the deleted segment from the entry cache: the ones before
+// the first entry of the oldest segment left, among files. The cache is cleared if it can't be read.
+func (wal *WAL) evictDeletedEntries(files []string, deleted string) {
+	remaining := slices.DeleteFunc(slices.Clone(files), func(file string) bool { return file == deleted })
+	oldest, err := wal.findOldestSegmentFile(remaining)
+	if err != nil || oldest == "" {
+		wal.entryCache.clear()
+		return
+	}
+	first, err := wal.firstSequenceNumberOf(oldest)
+	if err != nil || first == 0 {
+		wal.entryCache.clear()
+		return
+	}
+	wal.entryCache.evictBefore(first)
+}
+
+// firstSequenceNumberOf returns the sequence number of the first entry of the segment file at path, or 0
+// if it has none.
+func (wal *WAL) firstSequenceNumberOf(path string) (uint64, error) {
+	file, err := wal.fs.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	format, err := readSegmentHeader(reader)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var prefix [4]byte
+	size, err := readFrameSize(reader, &prefix)
+	if errors.Is(err, io.EOF) || (err == nil && size == 0) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if size < 0 {
+		return 0, ErrInvalidEntry
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return 0, err
+	}
+	entry, err := unmarshalAndVerifyEntry(data, format)
+	if err != nil {
+		return 0, err
+	}
+	return entry.GetLogSequenceNumber(), nil
+}
+
 func (wal *WAL) findOldestSegmentFile(files []string) (string, error) {
 	var oldestSegmentFilePath string
 	oldestSegmentID := math.MaxInt64
@@ -253,27 +926,126 @@ func (wal *WAL) findOldestSegmentFile(files []string) (string, error) {
 	return oldestSegmentFilePath, nil
 }
 
+// beginWrite registers an in-flight write. It returns false if the WAL is closed.
+func (wal *WAL) beginWrite() bool {
+	wal.closeLock.Lock()
+	defer wal.closeLock.Unlock()
+
+	if wal.closed {
+		return false
+	}
+	wal.writers.Add(1)
+	return true
+}
+
 // Close the WAL file. It also calls Sync() on the WAL.
+// It is equivalent to CloseContext with a context that never expires.
 func (wal *WAL) Close() error {
+	return wal.CloseContext(context.Background())
+}
+
+// CloseContext closes the WAL with draining semantics.
+// New writes are rejected with ErrClosed as soon as it is called, then it waits for the writes
+// already in progress to complete (or for ctx to expire) before syncing and closing the segment file.
+// If ctx expires first, the WAL is still synced and closed but ctx.Err() is returned.
+func (wal *WAL) CloseContext(ctx context.Context) error {
+	wal.closeLock.Lock()
+	if wal.closed {
+		wal.closeLock.Unlock()
+		return ErrClosed
+	}
+	wal.closed = true
+	wal.closeLock.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		wal.writers.Wait()
+		close(drained)
+	}()
+
+	var ctxErr error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+	}
+
+	// Stop the background syncing before the final sync.
 	wal.cancel()
-	if err := wal.Sync(); err != nil {
+	if wal.syncerDone != nil {
+		<-wal.syncerDone
+	}
+	if wal.spareDone != nil {
+		<-wal.spareDone
+	}
+	if wal.unregisterStats != nil {
+		wal.unregisterStats()
+	}
+	if wal.webhooks != nil {
+		wal.webhooks.close()
+	}
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	// A fenced WAL is still closed, but its buffered entries are dropped.
+	syncErr := wal.sync()
+	if syncErr != nil && !errors.Is(syncErr, ErrFenced) {
+		return syncErr
+	}
+	if err := wal.releaseLease(); err != nil {
+		return err
+	}
+	wal.stopSegmentWriter()
+	if err := wal.currentSegment.Close(); err != nil {
 		return err
 	}
-	return wal.currentSegment.Close()
+	if wal.valueLog != nil {
+		if err := wal.valueLog.close(); err != nil {
+			return err
+		}
+	}
+	if syncErr != nil {
+		return syncErr
+	}
+
+	wal.logEvent(slog.LevelInfo, EventClosed, slog.Uint64("last_sequence_number", wal.lastSequenceNo))
+	return ctxErr
 }
 
 // ReadAll reads all entries from the WAL.
 // If readFromCheckpoint is true, it will return all the entries from the last checkpoint
 // (if no checkpoint is found, it will return an empty slice.)
-func (wal *WAL) ReadAll(readFromCheckpoint bool) ([]*WAL_Entry, error) {
-	file, err := os.OpenFile(wal.currentSegment.Name(), os.O_RDONLY, 0644)
+// opts can be used to size the returned slice, see WithCapacityHint, and to upconvert the entries, see
+// WithUpconversion.
+func (wal *WAL) ReadAll(readFromCheckpoint bool, opts ...ReadOption) (_ []*WAL_Entry, err error) {
+	span := wal.startSpan("wal.ReadAll")
+	defer func() { span.End(err) }()
+
+	o := readOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	wal.lock.Lock()
+	path := wal.currentSegment.Name()
+	capacity := o.capacityHint
+	if capacity <= 0 {
+		capacity = wal.segmentEntries[path]
+	}
+	wal.lock.Unlock()
+
+	file, err := wal.fs.OpenFile(path, os.O_RDONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	entries, checkpoint, err := readAllEntriesFromFile(file, readFromCheckpoint)
+	reader := getSegmentReader(file, wal.readBufferSize)
+	defer putSegmentReader(reader)
+	entries, checkpoint, err := readSegmentEntries(reader, readFromCheckpoint, capacity)
 	if err != nil {
+		wal.flagCorruption("read", file.Name(), err)
 		return entries, err
 	}
 
@@ -282,6 +1054,14 @@ func (wal *WAL) ReadAll(readFromCheckpoint bool) ([]*WAL_Entry, error) {
 		return entries[:0], nil
 	}
 
+	if err := wal.resolveEntries(entries); err != nil {
+		return nil, err
+	}
+	if o.upconvert {
+		if err := upconvertEntries(entries); err != nil {
+			return nil, err
+		}
+	}
 	return entries, nil
 }
 
@@ -292,37 +1072,78 @@ func (wal *WAL) ReadAll(readFromCheckpoint bool) ([]*WAL_Entry, error) {
 // entries, err = wal.ReadAllFromOffset(-1, true)
 // this will start scanning from the first available segment, and get all entries after the last checkpoint
 // Note: segment offset starts from 0
-func (wal *WAL) ReadAllFromOffset(offset int, readFromCheckpoint bool) ([]*WAL_Entry, error) {
+//
+// The returned slice is sized up front from the entry counts of the segments, which the WAL knows for the
+// segments it wrote and the segments read before. opts can be used to size it otherwise, see WithCapacityHint.
+func (wal *WAL) ReadAllFromOffset(offset int, readFromCheckpoint bool, opts ...ReadOption) (_ []*WAL_Entry, err error) {
+	span := wal.startSpan("wal.ReadAllFromOffset", slog.Int("wal.offset", offset))
+	defer func() { span.End(err) }()
+
+	o := readOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	// Get the list of log segment files in the directory
-	files, err := filepath.Glob(filepath.Join(wal.directory, segmentPrefix+"*"))
+	files, err := wal.fs.Glob(filepath.Join(wal.directory, segmentPrefix+"*"))
 	if err != nil {
 		return nil, err
 	}
 
-	var entries []*WAL_Entry
-	prevCheckpointLogSequenceNo := uint64(0)
-
+	var paths []string
 	for _, file := range files {
 		// Get the segment index from the file name
 		segmentIndex, err := strconv.Atoi(strings.TrimPrefix(file, filepath.Join(wal.directory, "segment-")))
 		if err != nil {
-			return entries, err
+			return nil, err
 		}
 
-		if segmentIndex < offset {
-			continue
+		if segmentIndex >= offset {
+			paths = append(paths, file)
 		}
+	}
+
+	wal.lock.Lock()
+	current := wal.currentSegment.Name()
+	capacities := make([]int, len(paths))
+	total := 0
+	for i, path := range paths {
+		capacities[i] = wal.segmentEntries[path]
+		total += capacities[i]
+	}
+	wal.lock.Unlock()
+	if o.capacityHint > 0 {
+		total = o.capacityHint
+	}
+
+	entries := make([]*WAL_Entry, 0, total)
+	prevCheckpointLogSequenceNo := uint64(0)
 
-		file, err := os.OpenFile(file, os.O_RDONLY, 0644)
+	for i, path := range paths {
+		file, err := wal.fs.OpenFile(path, os.O_RDONLY, 0644)
 		if err != nil {
 			return nil, err
 		}
 
-		entriesFromSegment, checkpoint, err := readAllEntriesFromFile(file, readFromCheckpoint)
+		reader := getSegmentReader(file, wal.readBufferSize)
+		entriesFromSegment, checkpoint, err := readSegmentEntries(reader, readFromCheckpoint, capacities[i])
+		putSegmentReader(reader)
+		file.Close()
 		if err != nil {
+			wal.flagCorruption("read", file.Name(), err)
 			return entries, err
 		}
 
+		// The entry count of a sealed segment read in full is kept to size the next reads. The current
+		// segment is still written to, its count is kept up to date by the writes.
+		if checkpoint == 0 && path != current {
+			wal.lock.Lock()
+			if _, ok := wal.segmentEntries[path]; !ok {
+				wal.segmentEntries[path] = len(entriesFromSegment)
+			}
+			wal.lock.Unlock()
+		}
+
 		// If we find the latest checkpoint,
 		// we should return the entries from this latest checkpoint
 		// So we empty the entries slice and start appending entries from this checkpoint.
@@ -334,30 +1155,71 @@ func (wal *WAL) ReadAllFromOffset(offset int, readFromCheckpoint bool) ([]*WAL_E
 		entries = append(entries, entriesFromSegment...)
 	}
 
+	if err := wal.resolveEntries(entries); err != nil {
+		return nil, err
+	}
+	if o.upconvert {
+		if err := upconvertEntries(entries); err != nil {
+			return nil, err
+		}
+	}
 	return entries, nil
 }
 
-func readAllEntriesFromFile(file *os.File, readFromCheckpoint bool) ([]*WAL_Entry, uint64, error) {
-	var entries []*WAL_Entry
+// readSegmentEntries reads the header and the entries of the segment file read by reader, see
+// readAllEntriesFromFile.
+func readSegmentEntries(reader *bufio.Reader, readFromCheckpoint bool, capacity int) ([]*WAL_Entry, uint64, error) {
+	format, err := readSegmentHeader(reader)
+	if err == io.EOF {
+		return make([]*WAL_Entry, 0, capacity), 0, nil
+	}
+	if err != nil {
+		return nil, 0, &entryError{offset: 0, err: err}
+	}
+	return readAllEntriesFromFile(reader, format, readFromCheckpoint, capacity)
+}
+
+// readAllEntriesFromFile reads the entries of the file, of the given format, once past its header,
+// sizing the returned slice for capacity entries.
+func readAllEntriesFromFile(file io.Reader, format segmentFormat, readFromCheckpoint bool, capacity int) ([]*WAL_Entry, uint64, error) {
+	entries := make([]*WAL_Entry, 0, capacity)
 	checkpointLogSequenceNo := uint64(0)
+	offset := format.headerSize()
+
+	// The data of every entry is read into the same buffer, only the entries are allocated.
+	buf := getEntryBuffer()
+	defer putEntryBuffer(buf)
+	var prefix [4]byte
 	for {
-		var size int32
-		if err := binary.Read(file, binary.LittleEndian, &size); err != nil {
+		size, err := readFrameSize(file, &prefix)
+		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return entries, checkpointLogSequenceNo, err
+			return entries, checkpointLogSequenceNo, &entryError{offset: offset, err: err}
+		}
+		if size == 0 {
+			// The preallocated space of a segment written with WithMmap reads as zeros, it ends the data.
+			break
+		}
+		if size < 0 {
+			return entries, checkpointLogSequenceNo, &entryError{offset: offset, err: ErrInvalidEntry}
 		}
 
-		data := make([]byte, size)
+		*buf = resizeBuffer(*buf, int(size))
+		data := *buf
 		if _, err := io.ReadFull(file, data); err != nil {
-			return entries, checkpointLogSequenceNo, err
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return entries, checkpointLogSequenceNo, &entryError{offset: offset, err: err}
 		}
 
-		entry, err := unmarshalAndVerifyEntry(data)
+		entry, err := unmarshalAndVerifyEntry(data, format)
 		if err != nil {
-			return entries, checkpointLogSequenceNo, err
+			return entries, checkpointLogSequenceNo, &entryError{offset: offset, err: err}
 		}
+		offset += 4 + int64(size)
 
 		// If we are reading from checkpoint, and we find a checkpoint entry,
 		// we should return the entries from the last checkpoint.
@@ -374,42 +1236,283 @@ func readAllEntriesFromFile(file *os.File, readFromCheckpoint bool) ([]*WAL_Entr
 	return entries, checkpointLogSequenceNo, nil
 }
 
+// Flush writes out any data in the WAL's in-memory buffer to the segment file,
+// handing it to the OS without calling fsync.
+// Flushed entries survive a process crash but not necessarily a machine crash.
+func (wal *WAL) Flush() error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	return wal.flush()
+}
+
 // Sync writes out any data in the WAL's in-memory buffer to the segment file.
 // If fsync is enabled, it also calls fsync on the segment file.
 // It also resets the synchronization timer.
-func (wal *WAL) Sync() error {
+//
+// The fsync runs without blocking writers. Concurrent calls are batched: a call waits for the fsync in
+// flight if it covers the data the call flushed, or else joins the next fsync, issued once for all of
+// the calls waiting for it.
+func (wal *WAL) Sync() (err error) {
+	span := wal.startSpan("wal.Sync")
+	defer func() { span.End(err) }()
+
+	start := wal.clock.Now()
+	wal.lock.Lock()
+	if err := wal.flush(); err != nil || !wal.shouldFsync {
+		if err == nil {
+			wal.observeSync(start)
+		}
+		wal.lock.Unlock()
+		return err
+	}
+	flushed := wal.flushes
+	wal.lock.Unlock()
+
+	if err := wal.waitFsync(flushed); err != nil {
+		return err
+	}
+
+	wal.lock.Lock()
+	wal.observeSync(start)
+	wal.lock.Unlock()
+	return nil
+}
+
+// waitFsync returns once the given number of flushes are durable, fsyncing the segment file unless an
+// fsync is already in flight. It must be called without holding wal.lock.
+func (wal *WAL) waitFsync(flushed uint64) error {
+	wal.syncLock.Lock()
+	for wal.syncedFlushes < flushed {
+		if wal.syncing {
+			wal.syncCond.Wait()
+			continue
+		}
+
+		wal.syncing = true
+		wal.syncLock.Unlock()
+		err := wal.fsyncSegment()
+		wal.syncLock.Lock()
+		wal.syncing = false
+		wal.syncCond.Broadcast()
+		if err != nil {
+			wal.syncLock.Unlock()
+			return err
+		}
+	}
+	wal.syncLock.Unlock()
+	return nil
+}
+
+// fsyncSegment fsyncs the current segment file without holding wal.lock, which is only taken to read
+// the file and to record the fsync. The segment file is closed by rotations and by Close, which sync
+// first, and sync waits for the fsyncs in flight.
+func (wal *WAL) fsyncSegment() error {
+	wal.lock.Lock()
+	file := wal.currentSegment
+	flushed, flushedLSN := wal.flushes, wal.flushedLSN
+	wal.fsyncs.Add(1)
+	wal.lock.Unlock()
+
+	start := wal.clock.Now()
+	err := wal.syncFile(file)
+	duration := wal.clock.Now().Sub(start)
+	wal.fsyncs.Done()
+	if err != nil {
+		return err
+	}
+
+	wal.lock.Lock()
+	wal.observeFsync(duration)
+	wal.lock.Unlock()
+	wal.markSynced(flushed, flushedLSN)
+	return nil
+}
+
+// syncFile commits the data of the segment file to stable storage, with fdatasync with WithDataSync.
+// The value log is synced first, so that the entries are never durable before the data they point to.
+func (wal *WAL) syncFile(file File) error {
+	if wal.valueLog != nil {
+		if err := wal.valueLog.sync(); err != nil {
+			return err
+		}
+	}
+	if wal.dataSync {
+		return datasync(file)
+	}
+	return file.Sync()
+}
+
+// markSynced records that the given number of flushes, and the entries up to lsn, are durable.
+func (wal *WAL) markSynced(flushed, lsn uint64) {
+	wal.syncLock.Lock()
+	wal.syncedFlushes = max(wal.syncedFlushes, flushed)
+	wal.syncedLSN = max(wal.syncedLSN, lsn)
+	wal.notifyTails()
+	wal.syncLock.Unlock()
+}
+
+// tailNotification returns the channel closed the next time entries are flushed or synced.
+func (wal *WAL) tailNotification() <-chan struct{} {
+	wal.syncLock.Lock()
+	defer wal.syncLock.Unlock()
+	wal.tailsWaiting = true
+	return wal.tailsNotify
+}
+
+// notifyTails wakes up the tails waiting for entries. The caller must hold syncLock.
+func (wal *WAL) notifyTails() {
+	if wal.tailsWaiting {
+		close(wal.tailsNotify)
+		wal.tailsNotify = make(chan struct{})
+		wal.tailsWaiting = false
+	}
+}
+
+// resetSynced records that the entries up to the last one are durable, when the segments were just
+// read or rewritten. The caller must hold wal.lock, or have exclusive access to the WAL.
+func (wal *WAL) resetSynced() {
+	wal.flushedLSN = wal.lastSequenceNo
+	wal.syncLock.Lock()
+	wal.syncedLSN = wal.lastSequenceNo
+	wal.syncLock.Unlock()
+}
+
+// SyncedSequenceNumber returns the sequence number of the last entry synced to disk. Without fsync, see
+// OpenWAL, entries count as synced once they are flushed to the segment files. Entries can be read
+// from the segment files, e.g. by a Tail, before they are synced, and lost in a machine crash.
+func (wal *WAL) SyncedSequenceNumber() uint64 {
+	wal.syncLock.Lock()
+	defer wal.syncLock.Unlock()
+	return wal.syncedLSN
+}
+
+// flush drains the in-memory buffer to the segment file. The caller must hold wal.lock.
+func (wal *WAL) flush() error {
+	if err := wal.checkLease(); err != nil {
+		return err
+	}
 	if err := wal.bufWriter.Flush(); err != nil {
 		return err
 	}
+	wal.maybeWriteback()
+
+	wal.flushes++
+	wal.flushedLSN = wal.lastSequenceNo
+	wal.lastFlushTime = wal.clock.Now()
+	if !wal.shouldFsync {
+		wal.markSynced(wal.flushes, wal.flushedLSN)
+	} else {
+		wal.syncLock.Lock()
+		wal.notifyTails()
+		wal.syncLock.Unlock()
+	}
+	return nil
+}
+
+// sync flushes the buffer and fsyncs the segment file if fsync is enabled, while holding wal.lock,
+// for the callers that must not let writes in until the data is durable, such as rotations.
+// Once it returns, no fsync is in flight, so the segment file can be closed.
+// The caller must hold wal.lock.
+func (wal *WAL) sync() (err error) {
+	span := wal.startSpan("wal.Sync")
+	defer func() { span.End(err) }()
+
+	wal.fsyncs.Wait()
+	start := wal.clock.Now()
+
+	if err := wal.flush(); err != nil {
+		return err
+	}
 	if wal.shouldFsync {
-		if err := wal.currentSegment.Sync(); err != nil {
+		fsyncStart := wal.clock.Now()
+		if err := wal.syncFile(wal.currentSegment); err != nil {
 			return err
 		}
+		wal.observeFsync(wal.clock.Now().Sub(fsyncStart))
+		wal.markSynced(wal.flushes, wal.flushedLSN)
 	}
 
-	// Reset the keepSyncing timer, since we just synced.
-	wal.resetTimer()
-
+	wal.observeSync(start)
 	return nil
 }
 
-// resetTimer resets the synchronization timer.
-func (wal *WAL) resetTimer() {
-	wal.syncTimer.Reset(syncInterval)
+// observeFsync records an fsync of the segment file. The caller must hold wal.lock.
+func (wal *WAL) observeFsync(duration time.Duration) {
+	wal.stats.Fsyncs++
+	wal.stats.FsyncLatency.observe(duration)
+	if wal.instrumentation != nil {
+		wal.instrumentation.RecordFsync(duration)
+	}
+
+	if wal.onSlowSync != nil && duration > wal.slowSyncThreshold {
+		wal.stats.SlowSyncs++
+		wal.onSlowSync(duration)
+	}
+}
+
+// observeSync records a sync started at start. The caller must hold wal.lock.
+func (wal *WAL) observeSync(start time.Time) {
+	wal.stats.LastSyncTime = wal.clock.Now()
+	wal.stats.LastSyncDuration = wal.stats.LastSyncTime.Sub(start)
+	wal.stats.SyncLatency.observe(wal.stats.LastSyncDuration)
+	if wal.hooks.OnSync != nil {
+		wal.hooks.OnSync(wal.stats.LastSyncDuration)
+	}
+}
+
+// maybeWriteback starts the writeback of the data flushed to the current segment since the last
+// writeback, once there is enough of it, see WithWriteback. The caller must hold wal.lock.
+func (wal *WAL) maybeWriteback() {
+	pending := int64(wal.stats.FlushedBytes - wal.writebackFlushed)
+	if wal.writeback <= 0 || pending < wal.writeback {
+		return
+	}
+
+	end, err := wal.currentSegment.Seek(0, io.SeekCurrent)
+	if err == nil {
+		err = writeback(wal.currentSegment, max(0, end-pending), pending)
+	}
+	wal.writebackFlushed = wal.stats.FlushedBytes
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		wal.writeback = 0
+	case err != nil:
+		// Writeback is only an optimization, an I/O error is reported by the next fsync.
+		log.Printf("Error while starting writeback: %v", err)
+	default:
+		wal.stats.Writebacks++
+	}
+}
+
+// dropCache drops the pages of the sealed segment at path from the page cache, see WithDropSealedCache.
+func (wal *WAL) dropCache(path string) {
+	cacheDropFS, ok := wal.fs.(CacheDropFS)
+	if !wal.dropSealedCache || !ok {
+		return
+	}
+	if err := cacheDropFS.DropCache(path); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		log.Printf("Error while dropping %s from the page cache: %v", path, err)
+	}
 }
 
-func (wal *WAL) keepSyncing() {
+// keepSyncing performs the periodic sync on every tick, until the WAL is closed. Ticks are not postponed
+// by explicit syncs, they keep a fixed rate.
+func (wal *WAL) keepSyncing(ticker *ticker) {
+	defer close(wal.syncerDone)
+	defer ticker.stop()
+
 	for {
 		select {
-		case <-wal.syncTimer.C:
+		case <-ticker.C():
+			wal.periodicSync()
+			ticker.advance()
 
+		case <-wal.syncIntervalChanged:
 			wal.lock.Lock()
-			err := wal.Sync()
+			interval := wal.syncInterval
 			wal.lock.Unlock()
-
-			if err != nil {
-				log.Printf("Error while performing sync: %v", err)
-			}
+			ticker.setInterval(interval)
 
 		case <-wal.ctx.Done():
 			return
@@ -417,13 +1520,45 @@ func (wal *WAL) keepSyncing() {
 	}
 }
 
+// periodicSync performs the periodic flush or sync of the buffer, depending on the sync mode.
+func (wal *WAL) periodicSync() {
+	var err error
+	if wal.syncMode == PeriodicFlush {
+		// Only hand the buffer to the OS, fsync is left to explicit syncs.
+		wal.lock.Lock()
+		err = wal.flush()
+		wal.lock.Unlock()
+	} else {
+		err = wal.Sync()
+	}
+
+	wal.lock.Lock()
+	wal.lastSyncErr = err
+	wal.lock.Unlock()
+
+	if err != nil {
+		log.Printf("Error while performing sync: %v", err)
+	}
+}
+
 // Repair repairs a corrupted WAL by scanning the WAL from the start and
 // reading all entries until a corrupted entry is encountered, at which point the file is truncated.
 // The function returns the entries that were read before the corruption and overwrites the existing WAL file with the repaired entries.
 // It checks the CRC of each entry to verify if it is corrupted, and if the CRC is invalid,
 // the file is truncated at that point.
-func (wal *WAL) Repair() ([]*WAL_Entry, error) {
-	files, err := filepath.Glob(filepath.Join(wal.directory, segmentPrefix+"*"))
+func (wal *WAL) Repair() (_ []*WAL_Entry, err error) {
+	span := wal.startSpan("wal.Repair")
+	defer func() { span.End(err) }()
+	defer func() {
+		// Reaching the end of the segment without finding corruption is not a failure.
+		if errors.Is(err, io.EOF) {
+			wal.recordAdmin(AdminOpRepair, wal.currentSegment.Name(), "no corruption found", nil)
+		} else {
+			wal.recordAdmin(AdminOpRepair, wal.currentSegment.Name(), "", err)
+		}
+	}()
+
+	files, err := wal.fs.Glob(filepath.Join(wal.directory, segmentPrefix+"*"))
 	if err != nil {
 		return nil, err
 	}
@@ -440,7 +1575,7 @@ func (wal *WAL) Repair() ([]*WAL_Entry, error) {
 	}
 	// Open the last log segment file
 	filePath := filepath.Join(wal.directory, fmt.Sprintf("%s%d", segmentPrefix, lastSegmentID))
-	file, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
+	file, err := wal.fs.OpenFile(filePath, os.O_RDONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
@@ -451,20 +1586,46 @@ func (wal *WAL) Repair() ([]*WAL_Entry, error) {
 	if _, err = file.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
+	reader := getSegmentReader(file, wal.readBufferSize)
+	defer putSegmentReader(reader)
+
+	format, err := readSegmentHeader(reader)
+	if err != nil {
+		if err == io.EOF {
+			// The segment is empty, no corruption found.
+			return nil, err
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		// The header is incomplete, the segment is restarted with the format of the segments created.
+		wal.flagCorruption("repair", filePath, &entryError{offset: 0, err: io.ErrUnexpectedEOF})
+		if err := wal.replaceWithFixedFile(nil, wal.format, CorruptionTruncated.String()); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
 
 	var entries []*WAL_Entry
+	offset := format.headerSize()
+	var prefix [4]byte
 
 	for {
 		// Read the size of the next entry.
-		var size int32
-		if err := binary.Read(file, binary.LittleEndian, &size); err != nil {
+		size, err := readFrameSize(reader, &prefix)
+		if err == nil && size == 0 {
+			// The preallocated space of a segment written with WithMmap reads as zeros, it ends the data.
+			err = io.EOF
+		}
+		if err != nil {
 			if err == io.EOF {
 				// End of file reached, no corruption found.
 				return entries, err
 			}
 			log.Printf("Error while reading entry size: %v", err)
+			wal.flagCorruption("repair", filePath, &entryError{offset: offset, err: io.ErrUnexpectedEOF})
 			// Truncate the file at this point.
-			if err := wal.replaceWithFixedFile(entries); err != nil {
+			if err := wal.replaceWithFixedFile(entries, format, CorruptionTruncated.String()); err != nil {
 				return entries, err
 			}
 			return nil, nil
@@ -472,9 +1633,10 @@ func (wal *WAL) Repair() ([]*WAL_Entry, error) {
 
 		// Read the entry data.
 		data := make([]byte, size)
-		if _, err := io.ReadFull(file, data); err != nil {
+		if _, err := io.ReadFull(reader, data); err != nil {
+			wal.flagCorruption("repair", filePath, &entryError{offset: offset, err: io.ErrUnexpectedEOF})
 			// Truncate the file at this point
-			if err := wal.replaceWithFixedFile(entries); err != nil {
+			if err := wal.replaceWithFixedFile(entries, format, CorruptionTruncated.String()); err != nil {
 				return entries, err
 			}
 			return entries, nil
@@ -482,8 +1644,9 @@ func (wal *WAL) Repair() ([]*WAL_Entry, error) {
 
 		// Deserialize the entry.
 		var entry WAL_Entry
-		if err := proto.Unmarshal(data, &entry); err != nil {
-			if err := wal.replaceWithFixedFile(entries); err != nil {
+		if err := unmarshalEntry(data, format, &entry); err != nil {
+			wal.flagCorruption("repair", filePath, &entryError{offset: offset, err: fmt.Errorf("%w: %v", ErrInvalidEntry, err)})
+			if err := wal.replaceWithFixedFile(entries, format, CorruptionInvalidEntry.String()); err != nil {
 				return entries, err
 			}
 			return entries, nil
@@ -491,8 +1654,9 @@ func (wal *WAL) Repair() ([]*WAL_Entry, error) {
 
 		if !verifyCRC(&entry) {
 			log.Printf("CRC mismatch: data may be corrupted")
+			wal.flagCorruption("repair", filePath, &entryError{offset: offset, err: ErrCorruptEntry})
 			// Truncate the file at this point
-			if err := wal.replaceWithFixedFile(entries); err != nil {
+			if err := wal.replaceWithFixedFile(entries, format, CorruptionChecksum.String()); err != nil {
 				return entries, err
 			}
 
@@ -501,33 +1665,42 @@ func (wal *WAL) Repair() ([]*WAL_Entry, error) {
 
 		// Add the entry to the slice.
 		entries = append(entries, &entry)
+		offset += 4 + int64(size)
 	}
 }
 
-// replaceWithFixedFile replaces the existing WAL file with the given entries atomically.
-func (wal *WAL) replaceWithFixedFile(entries []*WAL_Entry) error {
+// replaceWithFixedFile replaces the existing WAL file with the given entries atomically, in a segment
+// of the given format. reason describes the corruption that caused the repair.
+func (wal *WAL) replaceWithFixedFile(entries []*WAL_Entry, format segmentFormat, reason string) error {
 	// Create a temporary file to make the operation look atomic.
 	tempFilePath := fmt.Sprintf("%s.tmp", wal.currentSegment.Name())
-	tempFile, err := os.OpenFile(tempFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	tempFile, err := wal.fs.OpenFile(tempFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
 
-	// Write the entries to the temporary file
+	// Write the header and the entries to the temporary file
+	buf := getEntryBuffer()
+	defer putEntryBuffer(buf)
+	*buf = appendSegmentHeader((*buf)[:0], format)
+	if _, err := tempFile.Write(*buf); err != nil {
+		return err
+	}
+	written := len(*buf)
 	for _, entry := range entries {
-		marshaledEntry := MustMarshal(entry)
-
-		size := int32(len(marshaledEntry))
-		if err := binary.Write(tempFile, binary.LittleEndian, size); err != nil {
-			return err
-		}
-		_, err := tempFile.Write(marshaledEntry)
-
-		if err != nil {
+		*buf = appendEncodedFrame((*buf)[:0], entry, format.encoding)
+		if _, err := tempFile.Write(*buf); err != nil {
 			return err
 		}
+		written += len(*buf)
 	}
 
+	// Repair doesn't hold the lock while rewriting the segment.
+	wal.lock.Lock()
+	wal.stats.PhysicalBytesWritten += uint64(written)
+	wal.segmentEntries[wal.currentSegment.Name()] = len(entries)
+	wal.lock.Unlock()
+
 	// Close the temporary file
 	if err := tempFile.Close(); err != nil {
 		return err
@@ -535,9 +1708,23 @@ func (wal *WAL) replaceWithFixedFile(entries []*WAL_Entry) error {
 
 	// Rename the temporary file to the original file name
 	// this OS operation is atomic
-	if err := os.Rename(tempFilePath, wal.currentSegment.Name()); err != nil {
+	details := fmt.Sprintf("kept %d entries: %s", len(entries), reason)
+	if err := wal.fs.Rename(tempFilePath, wal.currentSegment.Name()); err != nil {
+		wal.recordAdmin(AdminOpTruncateSegment, wal.currentSegment.Name(), details, err)
 		return err
 	}
+	wal.recordAdmin(AdminOpTruncateSegment, wal.currentSegment.Name(), details, nil)
+	if wal.entryCache != nil {
+		wal.entryCache.clear()
+	}
+
+	wal.logEvent(slog.LevelWarn, EventSegmentTruncated,
+		slog.String("path", wal.currentSegment.Name()),
+		slog.Int("entries_kept", len(entries)),
+		slog.String("reason", reason))
+	if wal.hooks.OnRepair != nil {
+		wal.hooks.OnRepair(wal.currentSegment.Name(), len(entries))
+	}
 
 	return nil
 }
@@ -553,25 +1740,148 @@ func (wal *WAL) getLastSequenceNo() (uint64, error) {
 		return entry.GetLogSequenceNumber(), nil
 	}
 
+	// The current segment is empty after a rotation, so the last entry is in an older segment.
+	segments, err := listSegmentFiles(wal.fs, wal.directory)
+	if err != nil {
+		return 0, err
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i].index >= wal.currentSegmentIndex {
+			continue
+		}
+		report, _ := verifySegment(wal.fs, segments[i])
+		if report.Entries > 0 {
+			// A crash right after a rotation leaves the current segment without its header: it gets the
+			// format of the segment before it.
+			if wal.segmentEnd == 0 {
+				if wal.segmentFormat, err = readSegmentFormat(wal.fs, segments[i].path); err != nil {
+					return 0, err
+				}
+			}
+			return report.LastSequenceNumber, nil
+		}
+	}
+
 	return 0, nil
 }
 
+// openCurrentSegment reopens the current segment once getLastSequenceNo found the end of its data,
+// mapping it into memory with WithMmap. The space past the data of a segment written with WithMmap, left
+// preallocated by a crash, is truncated first.
+// The caller must hold wal.lock.
+func (wal *WAL) openCurrentSegment() error {
+	path := wal.currentSegment.Name()
+	info, err := wal.fs.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() <= wal.segmentEnd && !wal.mmap {
+		return nil
+	}
+	if err := wal.currentSegment.Close(); err != nil {
+		return err
+	}
+
+	if info.Size() > wal.segmentEnd {
+		if err := truncateSegmentFile(wal.fs, path, wal.segmentEnd); err != nil {
+			return err
+		}
+		wal.logEvent(slog.LevelWarn, EventSegmentTruncated,
+			slog.String("path", path),
+			slog.Int("entries_kept", wal.segmentEntries[path]),
+			slog.String("reason", "preallocated space"))
+	}
+
+	file, err := wal.fs.OpenFile(path, os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if file, err = wal.mapSegment(file, wal.segmentEnd); err != nil {
+		return err
+	}
+	wal.currentSegment = file
+	wal.setSegmentWriter(file)
+	return nil
+}
+
+// setSegmentWriter makes the frames appended to the log go through a new buffer to file, the new
+// current segment. The caller must hold wal.lock.
+func (wal *WAL) setSegmentWriter(file File) {
+	wal.stopSegmentWriter()
+	wal.segmentSize = -1
+	counter := flushCounter{w: file, stats: &wal.stats}
+	if wal.writePipeline > 0 {
+		wal.bufWriter = newPipelineWriter(counter, wal.writePipeline)
+	} else {
+		wal.bufWriter = bufio.NewWriter(counter)
+	}
+}
+
+// stopSegmentWriter stops the goroutine of the buffer of the current segment, with WithWritePipeline.
+// The caller must hold wal.lock.
+func (wal *WAL) stopSegmentWriter() {
+	if pipeline, ok := wal.bufWriter.(*pipelineWriter); ok {
+		pipeline.stop()
+	}
+}
+
+// mapSegment maps the segment file, holding size bytes of data, into memory with WithMmap. The file is
+// returned as is otherwise, or if it can't be mapped.
+func (wal *WAL) mapSegment(file File, size int64) (File, error) {
+	if !wal.mmap {
+		return file, nil
+	}
+	mapped, err := newMmapFile(file, size, wal.maxFileSize)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return file, nil
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return mapped, nil
+}
+
 // iterates through all the entries of the log and returns the last entry.
+// The entry count and the end of the data of the current segment are recorded along the way.
 func (wal *WAL) getLastEntryInLog() (*WAL_Entry, error) {
-	file, err := os.OpenFile(wal.currentSegment.Name(), os.O_RDONLY, 0644)
+	file, err := wal.fs.OpenFile(wal.currentSegment.Name(), os.O_RDONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
+	// The sizes are read through a buffer, skipping the data of the entries, instead of seeking past them.
+	reader := getSegmentReader(file, wal.readBufferSize)
+	defer putSegmentReader(reader)
+
+	// A segment whose header is incomplete holds no entry, it is truncated and restarted by OpenWAL.
+	wal.segmentFormat, err = readSegmentHeader(reader)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		wal.segmentEntries[wal.currentSegment.Name()] = 0
+		wal.segmentEnd = 0
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	var previousSize int32
 	var offset int64
+	position := wal.segmentFormat.headerSize()
 	var entry *WAL_Entry
+	var entries int
+	var prefix [4]byte
 
 	for {
-		var size int32
-		if err := binary.Read(file, binary.LittleEndian, &size); err != nil {
+		size, err := readFrameSize(reader, &prefix)
+		if err == nil && size == 0 {
+			// The preallocated space of a segment written with WithMmap reads as zeros, it ends the data.
+			err = io.EOF
+		}
+		if err != nil {
 			if err == io.EOF {
+				wal.segmentEntries[wal.currentSegment.Name()] = entries
+				wal.segmentEnd = position
 				// End of file reached, read the last entry at the saved offset.
 				if offset == 0 {
 					return entry, nil
@@ -588,7 +1898,7 @@ func (wal *WAL) getLastEntryInLog() (*WAL_Entry, error) {
 					return nil, err
 				}
 
-				entry, err = unmarshalAndVerifyEntry(data)
+				entry, err = unmarshalAndVerifyEntry(data, wal.segmentFormat)
 				if err != nil {
 					return nil, err
 				}
@@ -599,16 +1909,14 @@ func (wal *WAL) getLastEntryInLog() (*WAL_Entry, error) {
 		}
 
 		// Get current offset
-		offset, err = file.Seek(0, io.SeekCurrent)
+		offset = position + 4
 		previousSize = size
 
-		if err != nil {
-			return nil, err
-		}
-
-		// Skip to the next entry.
-		if _, err := file.Seek(int64(size), io.SeekCurrent); err != nil {
+		// Skip to the next entry. An incomplete last entry is reported when it is read.
+		if _, err := reader.Discard(int(size)); err != nil && err != io.EOF {
 			return nil, err
 		}
+		position = offset + int64(size)
+		entries++
 	}
 }
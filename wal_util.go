@@ -1,33 +1,199 @@
 package wal
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc32"
-	"os"
+	"io"
+	"log"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
-// unmarshals the given data into a WAL entry and verifies CRC of the entry.
-// Only returns an error if the CRC is invalid.
-func unmarshalAndVerifyEntry(data []byte) (*WAL_Entry, error) {
+// ErrCorruptEntry is returned when an entry read from the log fails CRC verification.
+var ErrCorruptEntry = errors.New("CRC mismatch: data may be corrupted")
+
+// unmarshals the given data, read from a file of the given format, into a WAL entry and verifies CRC of the entry.
+func unmarshalAndVerifyEntry(data []byte, format segmentFormat) (*WAL_Entry, error) {
 	var entry WAL_Entry
-	MustUnmarshal(data, &entry)
+	if err := unmarshalAndVerifyEntryInto(data, format, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
 
-	if !verifyCRC(&entry) {
-		return nil, fmt.Errorf("CRC mismatch: data may be corrupted")
+// unmarshalAndVerifyEntryInto is unmarshalAndVerifyEntry, overwriting the given entry instead of
+// allocating a new one.
+func unmarshalAndVerifyEntryInto(data []byte, format segmentFormat, entry *WAL_Entry) error {
+	if err := unmarshalEntry(data, format, entry); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEntry, err)
 	}
 
-	return &entry, nil
+	if !verifyCRC(entry) {
+		return ErrCorruptEntry
+	}
+
+	return nil
+}
+
+// maxPooledEntryBuffer is the largest buffer returned to entryBufferPool, so that a few huge entries
+// don't keep large buffers alive.
+const maxPooledEntryBuffer = 1 << 20
+
+// entryBufferPool holds the buffers the entries read from segment files are read into, and the buffers
+// the frames of the entries written are built in. UnmarshalVT copies the fields of the entry, so a buffer
+// can be reused once the entry is unmarshaled.
+var entryBufferPool = sync.Pool{New: func() any { return new([]byte) }}
+
+// entryPool holds the entries built by WriteEntry, which aren't referenced anymore once written.
+var entryPool = sync.Pool{New: func() any { return new(WAL_Entry) }}
+
+// getEntryBuffer returns a buffer from entryBufferPool.
+func getEntryBuffer() *[]byte {
+	return entryBufferPool.Get().(*[]byte)
+}
+
+// putEntryBuffer returns a buffer to entryBufferPool.
+func putEntryBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledEntryBuffer {
+		entryBufferPool.Put(buf)
+	}
+}
+
+// appendFrame appends the frame of the entry, as stored in the side-files, to b: the size of the marshaled
+// entry as a little-endian int32, followed by the marshaled entry, checksum included, as side-files have
+// no header. Segments are written with appendEncodedFrame.
+func appendFrame(b []byte, entry *WAL_Entry) []byte {
+	start := len(b)
+	b = entry.appendVT(append(b, 0, 0, 0, 0))
+	binary.LittleEndian.PutUint32(b[start:], uint32(len(b)-start-4))
+	return b
+}
+
+// segmentReaderPool holds the buffered readers segment files are scanned through, see getSegmentReader.
+var segmentReaderPool sync.Pool
+
+// getSegmentReader returns a reader reading r through a buffer of the given size, to return to
+// segmentReaderPool with putSegmentReader. Scanning a segment through it takes a read syscall per
+// buffer instead of two per entry.
+func getSegmentReader(r io.Reader, size int) *bufio.Reader {
+	if reader, ok := segmentReaderPool.Get().(*bufio.Reader); ok && reader.Size() == max(size, 16) {
+		reader.Reset(r)
+		return reader
+	}
+	return bufio.NewReaderSize(r, size)
 }
 
+// putSegmentReader returns a reader to segmentReaderPool.
+func putSegmentReader(reader *bufio.Reader) {
+	reader.Reset(nil)
+	segmentReaderPool.Put(reader)
+}
+
+// readFrameSize reads the size prefixing the next frame from r, decoding it from prefix, which callers
+// reuse across frames. Like binary.Read, which it replaces as it goes through reflection and allocates,
+// it returns io.EOF if r is at its end, and io.ErrUnexpectedEOF if the size is incomplete.
+func readFrameSize(r io.Reader, prefix *[4]byte) (int32, error) {
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(prefix[:])), nil
+}
+
+// resizeBuffer returns buf resized to size bytes, reallocating it if it is too small.
+func resizeBuffer(buf []byte, size int) []byte {
+	if cap(buf) < size {
+		return make([]byte, size)
+	}
+	return buf[:size]
+}
+
+// byteValues holds every byte value, so that single bytes are checksummed without allocating them.
+var byteValues = func() (b [256]byte) {
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}()
+
+// castagnoliTable is the table of ChecksumCastagnoli.
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
 // Validates whether the given entry has a valid CRC.
 func verifyCRC(entry *WAL_Entry) bool {
-	// Reset the entry CRC for the verification.
-	actualCRC := crc32.ChecksumIEEE(append(entry.GetData(), byte(entry.GetLogSequenceNumber())))
+	if Checksum(entry.GetChecksum()) > ChecksumCastagnoli {
+		return false
+	}
+	return entry.CRC == computeCRC(entry)
+}
+
+// Computes the CRC of the given entry over its data and (the low byte of) its sequence number, with the
+// algorithm set in the entry (see Checksum).
+// Optional attributes (metadata, labels, stream, key, timestamp, HLC, tombstone, schema, blob, value pointer) are only included when present, so entries without them
+// have the same CRC as entries written before they existed.
+func computeCRC(entry *WAL_Entry) uint32 {
+	table := crc32.IEEETable
+	if Checksum(entry.GetChecksum()) == ChecksumCastagnoli {
+		table = castagnoliTable
+	}
+	crc := crc32.Checksum(entry.GetData(), table)
+	lowByte := int(byte(entry.GetLogSequenceNumber()))
+	crc = crc32.Update(crc, table, byteValues[lowByte:lowByte+1])
+
+	if len(entry.GetMetadata()) > 0 {
+		crc = crc32.Update(crc, table, entry.GetMetadata())
+	}
+
+	if len(entry.GetLabels()) > 0 {
+		// Map iteration order is random, so labels are checksummed in key order.
+		keys := make([]string, 0, len(entry.GetLabels()))
+		for key := range entry.GetLabels() {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			crc = crc32.Update(crc, table, []byte(key))
+			crc = crc32.Update(crc, table, byteValues[:1])
+			crc = crc32.Update(crc, table, []byte(entry.GetLabels()[key]))
+			crc = crc32.Update(crc, table, byteValues[:1])
+		}
+	}
+
+	if entry.GetStream() != "" {
+		crc = crc32.Update(crc, table, []byte(entry.GetStream()))
+	}
+	if len(entry.GetKey()) > 0 {
+		crc = crc32.Update(crc, table, entry.GetKey())
+	}
+	if entry.GetTimestamp() != 0 {
+		crc = crc32.Update(crc, table, binary.LittleEndian.AppendUint64(nil, uint64(entry.GetTimestamp())))
+	}
+	if entry.GetHlc() != 0 {
+		crc = crc32.Update(crc, table, binary.LittleEndian.AppendUint64(nil, entry.GetHlc()))
+	}
+	if entry.GetTombstone() {
+		crc = crc32.Update(crc, table, byteValues[1:2])
+	}
+	if entry.GetSchema() != "" {
+		crc = crc32.Update(crc, table, []byte(entry.GetSchema()))
+	}
+	if entry.GetSchemaVersion() != 0 {
+		crc = crc32.Update(crc, table, binary.LittleEndian.AppendUint32(nil, entry.GetSchemaVersion()))
+	}
+	if len(entry.GetBlob()) > 0 {
+		crc = crc32.Update(crc, table, entry.GetBlob())
+	}
+	if len(entry.GetValuePointer()) > 0 {
+		crc = crc32.Update(crc, table, entry.GetValuePointer())
+	}
 
-	return entry.CRC == actualCRC
+	return crc
 }
 
 // Finds the last segment ID from the given list of files.
@@ -47,11 +213,89 @@ func findLastSegmentIndexInFiles(files []string) (int, error) {
 }
 
 // Creates a log segment file with the given segment ID in the given directory.
-func createSegmentFile(directory string, segmentID int) (*os.File, error) {
+func createSegmentFile(fs FS, directory string, segmentID int) (File, error) {
 	filePath := filepath.Join(directory, fmt.Sprintf("segment-%d", segmentID))
-	file, err := os.Create(filePath)
+	file, err := fs.Create(filePath)
 	if err != nil {
 		return nil, err
 	}
 	return file, nil
 }
+
+// segmentFile is a log segment file found in the WAL directory.
+type segmentFile struct {
+	index int
+	path  string
+}
+
+// Lists the log segment files in the given directory, ordered by segment index.
+func listSegmentFiles(fs FS, directory string) ([]segmentFile, error) {
+	files, err := fs.Glob(filepath.Join(directory, segmentPrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segmentFile, 0, len(files))
+	for _, file := range files {
+		_, fileName := filepath.Split(file)
+		// Temporary files, and the segment tails stored by a DirTarget, aren't complete segments.
+		if strings.HasSuffix(fileName, ".tmp") || strings.HasSuffix(fileName, partialSuffix) {
+			continue
+		}
+		segmentID, err := strconv.Atoi(strings.TrimPrefix(fileName, segmentPrefix))
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segmentFile{index: segmentID, path: file})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].index < segments[j].index
+	})
+
+	return segments, nil
+}
+
+// Reports whether the given file name is one the WAL creates in its directory.
+func isKnownFileName(name string) bool {
+	switch name {
+	case checkpointFileName, checkpointFileName + ".tmp", healthProbeFileName,
+		consumerOffsetsFileName, consumerOffsetsFileName + ".tmp", adminJournalFileName, repairBackupDirName,
+		leaseFileName, leaseFileName + ".tmp", shippingFileName, shippingFileName + ".tmp",
+		spareSegmentFileName, spareSegmentFileName + ".tmp", recycledSegmentFileName, snapshotDirName,
+		queueDirName, blobDirName, valueLogDirName:
+		return true
+	}
+
+	segmentID := strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), ".tmp")
+	if !strings.HasPrefix(name, segmentPrefix) || segmentID == "" {
+		return false
+	}
+	_, err := strconv.Atoi(segmentID)
+	return err == nil
+}
+
+// Checks the WAL directory for files that don't belong to the WAL, which usually means
+// the directory is shared with another system. Depending on the policy, it logs a warning or fails.
+func checkUnknownFiles(fs FS, directory string, policy UnknownFilesPolicy) error {
+	files, err := fs.Glob(filepath.Join(directory, "*"))
+	if err != nil {
+		return err
+	}
+
+	var unknownFiles []string
+	for _, file := range files {
+		if _, fileName := filepath.Split(file); !isKnownFileName(fileName) {
+			unknownFiles = append(unknownFiles, fileName)
+		}
+	}
+	if len(unknownFiles) == 0 {
+		return nil
+	}
+
+	if policy == RejectUnknownFiles {
+		return fmt.Errorf("%w %s: %v", ErrUnknownFiles, directory, unknownFiles)
+	}
+	log.Printf("Unknown files in WAL directory %s: %v", directory, unknownFiles)
+	return nil
+}
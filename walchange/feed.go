@@ -0,0 +1,111 @@
+// Package walchange renders the entries of a WAL as a JSON change feed shaped like the output of the
+// wal2json logical decoding plugin of PostgreSQL, one change per line, for downstream systems that
+// already consume such feeds:
+//
+//	{"op":"I","lsn":"0/2A","timestamp":"2024-06-01 12:00:00.5+00","stream":"orders","key":"b3JkZXIx","payload":{"total":42}}
+//
+//	changes, err := walchange.Export(os.Stdout, "/wal/directory")
+package walchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+// Operations of the changes, with the action codes of wal2json.
+const (
+	// OpInsert is the operation of the entries writing data.
+	OpInsert = "I"
+	// OpDelete is the operation of the tombstones, see wal.WithTombstone.
+	OpDelete = "D"
+	// OpMessage is the operation of the checkpoints, like the logical decoding messages of wal2json.
+	OpMessage = "M"
+)
+
+// timestampLayout is the layout of the timestamps of wal2json, the text format of PostgreSQL.
+const timestampLayout = "2006-01-02 15:04:05.999999999-07"
+
+// Change is a change of the feed, one per entry.
+type Change struct {
+	// Op is the operation of the entry, OpInsert, OpDelete or OpMessage.
+	Op string `json:"op"`
+	// LSN is the sequence number of the entry, formatted like a PostgreSQL LSN: the high and low 32 bits
+	// in hexadecimal, separated by a slash.
+	LSN string `json:"lsn"`
+	// Timestamp is the application timestamp of the entry, empty if it has none.
+	Timestamp string `json:"timestamp,omitempty"`
+	Stream    string `json:"stream,omitempty"`
+	// Key is the key of the entry, base64 encoded.
+	Key []byte `json:"key,omitempty"`
+	// Payload is the data of the entry, embedded as is if it is JSON, and as a base64 encoded string
+	// otherwise, in which case Encoding is "base64".
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Encoding string          `json:"encoding,omitempty"`
+}
+
+// NewChange returns the change representing the given entry.
+func NewChange(entry *wal.WAL_Entry) Change {
+	lsn := entry.GetLogSequenceNumber()
+	change := Change{
+		Op:     OpInsert,
+		LSN:    fmt.Sprintf("%X/%X", lsn>>32, uint32(lsn)),
+		Stream: entry.GetStream(),
+		Key:    entry.GetKey(),
+	}
+	switch {
+	case entry.GetIsCheckpoint():
+		change.Op = OpMessage
+	case entry.GetTombstone():
+		change.Op = OpDelete
+	}
+	if t := entry.Time(); !t.IsZero() {
+		change.Timestamp = t.UTC().Format(timestampLayout)
+	}
+
+	data := entry.GetData()
+	switch {
+	case len(data) == 0:
+	case json.Valid(data):
+		change.Payload = data
+	default:
+		// Marshaling a byte slice can't fail.
+		change.Payload, _ = json.Marshal(data)
+		change.Encoding = "base64"
+	}
+	return change
+}
+
+// Encoder writes entries to a stream as changes, one JSON object per line.
+type Encoder struct {
+	encoder *json.Encoder
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{encoder: json.NewEncoder(w)}
+}
+
+// Encode writes the change representing the entry.
+func (e *Encoder) Encode(entry *wal.WAL_Entry) error {
+	return e.encoder.Encode(NewChange(entry))
+}
+
+// Export writes the entries of the WAL in directory, in order, to w as changes and returns the number
+// of changes written. The WAL may be written concurrently; entries written after the export reached
+// the end of the newest segment are not included. Corrupted entries fail the export.
+// The only option used is WithFS.
+func Export(w io.Writer, directory string, opts ...wal.Option) (changes int, err error) {
+	encoder := NewEncoder(w)
+	err = wal.TailDir(context.Background(), directory, 0, false, func(entry *wal.WAL_Entry) error {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+		changes++
+		return nil
+	}, opts...)
+	return changes, err
+}
@@ -0,0 +1,334 @@
+// Package waletcd reads the WAL directories written by etcd, to migrate etcd-embedded storage to goWAL.
+//
+//	state, entries, err := waletcd.Convert("/var/lib/etcd/member/wal", "/wal/directory", 64<<20)
+package waletcd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	pb "go.etcd.io/raft/v3/raftpb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Record types of the etcd WAL.
+const (
+	metadataType int64 = iota + 1
+	entryType
+	stateType
+	crcType
+	snapshotType
+)
+
+// Labels set on the entries returned by ReadDir.
+const (
+	LabelTerm = "etcd_term"
+	LabelType = "etcd_type"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// State is the state recorded in an etcd WAL besides the entries.
+type State struct {
+	// Metadata is the metadata the WAL was created with, e.g. the etcd member and cluster IDs.
+	Metadata []byte
+	// HardState is the last hard state of the Raft node.
+	HardState pb.HardState
+	// SnapshotIndex and SnapshotTerm identify the last snapshot recorded in the WAL.
+	SnapshotIndex uint64
+	SnapshotTerm  uint64
+	ConfState     pb.ConfState
+}
+
+// ReadDir reads the etcd WAL in directory and calls fn with its Raft entries, in order, converted
+// to WAL entries: the sequence number is the Raft index, the data the entry data, and the term and
+// type are set as the LabelTerm and LabelType labels. As in etcd, entries overwritten by a later
+// leader are dropped, so the entries are only passed to fn once the whole WAL has been read.
+//
+// The CRC of every record is verified: corrupted records fail with an error wrapping wal.ErrCorruptEntry.
+// A record torn at the end of the last file, by a crash while it was written, ends the WAL.
+func ReadDir(directory string, fn func(*wal.WAL_Entry) error) (State, error) {
+	var state State
+	var entries []pb.Entry
+
+	names, err := walFileNames(directory)
+	if err != nil {
+		return state, err
+	}
+	if len(names) == 0 {
+		return state, fmt.Errorf("%w: no etcd WAL files in %s", wal.ErrNotExist, directory)
+	}
+
+	var crc uint32
+	for i, name := range names {
+		err := readFile(filepath.Join(directory, name), i == len(names)-1, func(recordType int64, recordCRC uint32, data []byte) error {
+			if recordType == crcType {
+				if crc != 0 && recordCRC != crc {
+					return fmt.Errorf("%w: CRC record %08x, expected %08x", wal.ErrCorruptEntry, recordCRC, crc)
+				}
+				crc = recordCRC
+				return nil
+			}
+			crc = crc32.Update(crc, crcTable, data)
+			if recordCRC != crc {
+				return fmt.Errorf("%w: record CRC %08x, computed %08x", wal.ErrCorruptEntry, recordCRC, crc)
+			}
+
+			switch recordType {
+			case metadataType:
+				state.Metadata = data
+			case entryType:
+				var entry pb.Entry
+				if err := entry.Unmarshal(data); err != nil {
+					return fmt.Errorf("%w: %v", wal.ErrInvalidEntry, err)
+				}
+				// An entry at an index already read replaces it and the entries after it.
+				if len(entries) > 0 && entry.Index > entries[0].Index {
+					entries = entries[:min(entry.Index-entries[0].Index, uint64(len(entries)))]
+				} else {
+					entries = entries[:0]
+				}
+				entries = append(entries, entry)
+			case stateType:
+				if err := state.HardState.Unmarshal(data); err != nil {
+					return fmt.Errorf("%w: %v", wal.ErrInvalidEntry, err)
+				}
+			case snapshotType:
+				if err := decodeSnapshot(data, &state); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return state, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	for _, entry := range entries {
+		walEntry := &wal.WAL_Entry{
+			LogSequenceNumber: entry.Index,
+			Data:              entry.Data,
+			Labels: map[string]string{
+				LabelTerm: strconv.FormatUint(entry.Term, 10),
+				LabelType: entry.Type.String(),
+			},
+		}
+		if err := fn(walEntry); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+// Convert reads the etcd WAL in etcdDirectory, see ReadDir, and writes its entries to a new WAL in
+// directory, keeping their sequence numbers. It returns the state of the etcd WAL and the number of
+// entries written. directory must not contain a WAL already.
+func Convert(etcdDirectory, directory string, maxSegmentSize int64, opts ...wal.Option) (State, int, error) {
+	if matches, _ := filepath.Glob(filepath.Join(directory, "segment-*")); len(matches) > 0 {
+		return State{}, 0, fmt.Errorf("%s already contains a WAL", directory)
+	}
+
+	walog, err := wal.OpenWAL(directory, true, maxSegmentSize, math.MaxInt, opts...)
+	if err != nil {
+		return State{}, 0, err
+	}
+
+	written := 0
+	state, err := ReadDir(etcdDirectory, func(entry *wal.WAL_Entry) error {
+		err := walog.WriteEntryOpts(entry.GetData(),
+			wal.WithSequenceNumber(entry.GetLogSequenceNumber()),
+			wal.WithLabels(entry.GetLabels()))
+		if err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	if err == nil {
+		err = walog.Sync()
+	}
+	if closeErr := walog.Close(); err == nil {
+		err = closeErr
+	}
+	return state, written, err
+}
+
+// walFileNames returns the names of the WAL files of directory, ordered by sequence number.
+func walFileNames(directory string) ([]string, error) {
+	dirEntries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, dirEntry := range dirEntries {
+		// WAL files are named <sequence>-<index>.wal, in hexadecimal.
+		var seq, index uint64
+		name := dirEntry.Name()
+		if !strings.HasSuffix(name, ".wal") {
+			continue
+		}
+		if _, err := fmt.Sscanf(name, "%016x-%016x.wal", &seq, &index); err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readFile calls fn for every record of the WAL file at path. Files are preallocated, so the records
+// end at the first zero frame length or at the end of the file.
+func readFile(path string, last bool, fn func(recordType int64, crc uint32, data []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		var frame int64
+		if err := binary.Read(reader, binary.LittleEndian, &frame); err != nil {
+			if errors.Is(err, io.EOF) || (last && errors.Is(err, io.ErrUnexpectedEOF)) {
+				return nil
+			}
+			return err
+		}
+		if frame == 0 {
+			return nil
+		}
+
+		// The lower 56 bits are the size of the record, the top byte the padding to 8 bytes, if any.
+		size := int64(uint64(frame) & ^(uint64(0xff) << 56))
+		var padding int64
+		if frame < 0 {
+			padding = int64((uint64(frame) >> 56) & 0x7)
+		}
+		buf := make([]byte, size+padding)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			if last && errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+
+		recordType, crc, data, err := decodeRecord(buf[:size])
+		if err == nil {
+			err = fn(recordType, crc, data)
+		}
+		if err != nil {
+			if last && isTorn(buf) && (errors.Is(err, wal.ErrCorruptEntry) || errors.Is(err, wal.ErrInvalidEntry)) {
+				// The record was torn by a crash: some of its sectors weren't written over the preallocated space.
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// isTorn reports whether a sector of the record is all zeros, as when a write was interrupted.
+func isTorn(record []byte) bool {
+	const sectorSize = 512
+	for len(record) > 0 {
+		sector := record[:min(sectorSize, len(record))]
+		record = record[len(sector):]
+
+		zero := true
+		for _, b := range sector {
+			if b != 0 {
+				zero = false
+				break
+			}
+		}
+		if zero {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRecord decodes a walpb.Record: type (1), crc (2) and data (3).
+func decodeRecord(buf []byte) (recordType int64, crc uint32, data []byte, err error) {
+	err = decodeFields(buf, func(num protowire.Number, v uint64, b []byte) {
+		switch num {
+		case 1:
+			recordType = int64(v)
+		case 2:
+			crc = uint32(v)
+		case 3:
+			data = b
+		}
+	})
+	return recordType, crc, data, err
+}
+
+// decodeSnapshot decodes a walpb.Snapshot: index (1), term (2) and conf_state (3).
+func decodeSnapshot(buf []byte, state *State) error {
+	var confState []byte
+	err := decodeFields(buf, func(num protowire.Number, v uint64, b []byte) {
+		switch num {
+		case 1:
+			state.SnapshotIndex = v
+		case 2:
+			state.SnapshotTerm = v
+		case 3:
+			confState = b
+		}
+	})
+	if err != nil {
+		return err
+	}
+	state.ConfState = pb.ConfState{}
+	if err := state.ConfState.Unmarshal(confState); err != nil {
+		return fmt.Errorf("%w: %v", wal.ErrInvalidEntry, err)
+	}
+	return nil
+}
+
+// decodeFields calls fn with the varint and bytes fields of a protobuf message.
+func decodeFields(buf []byte, fn func(num protowire.Number, v uint64, b []byte)) error {
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", wal.ErrInvalidEntry, protowire.ParseError(n))
+		}
+		buf = buf[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(buf)
+			if n < 0 {
+				return fmt.Errorf("%w: %v", wal.ErrInvalidEntry, protowire.ParseError(n))
+			}
+			fn(num, v, nil)
+			buf = buf[n:]
+		case protowire.BytesType:
+			b, n := protowire.ConsumeBytes(buf)
+			if n < 0 {
+				return fmt.Errorf("%w: %v", wal.ErrInvalidEntry, protowire.ParseError(n))
+			}
+			fn(num, 0, b)
+			buf = buf[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, buf)
+			if n < 0 {
+				return fmt.Errorf("%w: %v", wal.ErrInvalidEntry, protowire.ParseError(n))
+			}
+			buf = buf[n:]
+		}
+	}
+	return nil
+}
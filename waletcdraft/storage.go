@@ -0,0 +1,414 @@
+// Package waletcdraft implements the Storage of etcd's raft library on top of goWAL.
+//
+//	storage, err := waletcdraft.Open("/raft/data", 64<<20)
+//	node := raft.RestartNode(&raft.Config{ID: id, Storage: storage, ...})
+package waletcdraft
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"go.etcd.io/raft/v3"
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+const (
+	logDirectoryName       = "log"
+	hardStateDirectoryName = "hardstate"
+	snapshotDirectoryName  = "snapshot"
+
+	// The hard state and snapshot WALs only need their last checkpoint, which is kept in the checkpoint
+	// side-file, so they keep two segments. Every snapshot is written to a new segment.
+	stateSegments        = 2
+	hardStateSegmentSize = 1 << 20
+	snapshotSegmentSize  = 1
+)
+
+var _ raft.Storage = (*Storage)(nil)
+
+// Storage is a raft.Storage persisting its state in WALs. Every entry of the Raft log is an entry of
+// the log WAL with the index of the Raft entry as its sequence number. The hard state and the latest
+// snapshot are stored as checkpoints of two small WALs, see wal.WAL.LastCheckpoint.
+//
+// As with raft.MemoryStorage, the application appends the entries and sets the hard state of every
+// Ready, and creates snapshots and compacts the log as it sees fit.
+type Storage struct {
+	log       *wal.WAL
+	hardState *wal.WAL
+	snapshots *wal.WAL
+
+	lock  sync.Mutex
+	state pb.HardState
+	snap  pb.Snapshot
+	// compacted is the index of the last compacted entry, whose term is still known, and last the index
+	// of the last entry. The entries in between are in the log WAL.
+	compacted uint64
+	last      uint64
+	// terms holds the index of the first entry of every term, from the compacted entry on.
+	terms []termStart
+}
+
+// termStart is the index of the first entry of a term.
+type termStart struct {
+	index uint64
+	term  uint64
+}
+
+// Open opens the Storage in directory, creating it if it doesn't exist. The Raft log is stored in the
+// log subdirectory, in segments of maxSegmentSize bytes, and is synced by every Append. Its segments
+// are only deleted by Compact and ApplySnapshot. opts configure the log WAL, see wal.Option.
+func Open(directory string, maxSegmentSize int64, opts ...wal.Option) (_ *Storage, err error) {
+	s := &Storage{}
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+
+	if s.log, err = wal.OpenWAL(filepath.Join(directory, logDirectoryName), true, maxSegmentSize, math.MaxInt, opts...); err != nil {
+		return nil, err
+	}
+	if s.hardState, err = wal.OpenWAL(filepath.Join(directory, hardStateDirectoryName), true, hardStateSegmentSize, stateSegments); err != nil {
+		return nil, err
+	}
+	if s.snapshots, err = wal.OpenWAL(filepath.Join(directory, snapshotDirectoryName), true, snapshotSegmentSize, stateSegments); err != nil {
+		return nil, err
+	}
+
+	if _, data, err := s.hardState.LastCheckpoint(); err == nil {
+		if err := s.state.Unmarshal(data); err != nil {
+			return nil, fmt.Errorf("could not read hard state: %w", err)
+		}
+	} else if !errors.Is(err, wal.ErrNoCheckpoint) {
+		return nil, err
+	}
+	if _, data, err := s.snapshots.LastCheckpoint(); err == nil {
+		if err := s.snap.Unmarshal(data); err != nil {
+			return nil, fmt.Errorf("could not read snapshot: %w", err)
+		}
+	} else if !errors.Is(err, wal.ErrNoCheckpoint) {
+		return nil, err
+	}
+
+	if err := s.loadTerms(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadTerms reads the terms of the entries after the snapshot.
+func (s *Storage) loadTerms() error {
+	s.compacted = s.snap.Metadata.Index
+	s.last = s.compacted
+	s.terms = []termStart{{index: s.compacted, term: s.snap.Metadata.Term}}
+
+	tail, err := s.log.Tail(s.compacted + 1)
+	if err != nil {
+		return err
+	}
+	defer tail.Stop()
+
+	return tail.Read(func(entry *wal.WAL_Entry) error {
+		index := entry.GetLogSequenceNumber()
+		if index != s.last+1 {
+			return fmt.Errorf("waletcdraft: missing entries between %d and %d", s.last, index)
+		}
+		term, _, err := decodeHeader(entry)
+		if err != nil {
+			return err
+		}
+		s.appendTerm(index, term)
+		s.last = index
+		return nil
+	})
+}
+
+// Close closes the WALs of the Storage.
+func (s *Storage) Close() error {
+	var errs []error
+	for _, w := range []*wal.WAL{s.log, s.hardState, s.snapshots} {
+		if w != nil {
+			errs = append(errs, w.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// InitialState returns the saved hard state and the configuration of the latest snapshot.
+func (s *Storage) InitialState() (pb.HardState, pb.ConfState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.state, s.snap.Metadata.ConfState, nil
+}
+
+// SetHardState saves the hard state.
+func (s *Storage) SetHardState(state pb.HardState) error {
+	data, err := state.Marshal()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.hardState.CreateCheckpoint(data); err != nil {
+		return fmt.Errorf("could not save hard state: %w", err)
+	}
+	s.state = state
+	return nil
+}
+
+// Entries returns the entries with an index in [lo, hi), limited to maxSize bytes but with at least one entry.
+func (s *Storage) Entries(lo, hi, maxSize uint64) ([]pb.Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if lo <= s.compacted {
+		return nil, raft.ErrCompacted
+	}
+	if hi > s.last+1 || lo >= hi {
+		return nil, raft.ErrUnavailable
+	}
+
+	tail, err := s.log.Tail(lo)
+	if err != nil {
+		return nil, err
+	}
+	defer tail.Stop()
+
+	var entries []pb.Entry
+	var size uint64
+	err = tail.Read(func(walEntry *wal.WAL_Entry) error {
+		entry, err := decodeEntry(walEntry)
+		if err != nil {
+			return err
+		}
+		size += uint64(entry.Size())
+		if entry.Index >= hi || (len(entries) > 0 && size > maxSize) {
+			return errDone
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDone) {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].Index != lo {
+		return nil, raft.ErrUnavailable
+	}
+	return entries, nil
+}
+
+// errDone stops reading the log once the entries looked for were read.
+var errDone = errors.New("done")
+
+// Term returns the term of the entry i, which must be between FirstIndex()-1 and LastIndex().
+func (s *Storage) Term(i uint64) (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.term(i)
+}
+
+func (s *Storage) term(i uint64) (uint64, error) {
+	if i < s.compacted {
+		return 0, raft.ErrCompacted
+	}
+	if i > s.last {
+		return 0, raft.ErrUnavailable
+	}
+	// Find the last term starting at or before i.
+	n := sort.Search(len(s.terms), func(n int) bool { return s.terms[n].index > i })
+	return s.terms[n-1].term, nil
+}
+
+// LastIndex returns the index of the last entry.
+func (s *Storage) LastIndex() (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.last, nil
+}
+
+// FirstIndex returns the index of the first entry that wasn't compacted.
+func (s *Storage) FirstIndex() (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.compacted + 1, nil
+}
+
+// Snapshot returns the latest snapshot.
+func (s *Storage) Snapshot() (pb.Snapshot, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.snap, nil
+}
+
+// Append appends the entries to the log and syncs it. Entries conflicting with existing ones
+// replace them and all the entries after them; compacted entries are ignored.
+func (s *Storage) Append(entries []pb.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	first := s.compacted + 1
+	if last := entries[0].Index + uint64(len(entries)) - 1; last < first {
+		return nil
+	}
+	if entries[0].Index < first {
+		entries = entries[first-entries[0].Index:]
+	}
+	if entries[0].Index > s.last+1 {
+		return fmt.Errorf("waletcdraft: missing entries between %d and %d", s.last, entries[0].Index)
+	}
+
+	if entries[0].Index <= s.last {
+		if _, err := s.log.TruncateAfter(entries[0].Index - 1); err != nil {
+			return err
+		}
+		s.truncateTerms(entries[0].Index - 1)
+	}
+
+	for _, entry := range entries {
+		err := s.log.WriteEntryOpts(entry.Data, wal.WithSequenceNumber(entry.Index), wal.WithMetadata(encodeHeader(entry)))
+		if err != nil {
+			return fmt.Errorf("could not append entry %d: %w", entry.Index, err)
+		}
+		s.appendTerm(entry.Index, entry.Term)
+		s.last = entry.Index
+	}
+	return s.log.Sync()
+}
+
+// CreateSnapshot saves a snapshot of the state after the entry i was applied, with the given
+// configuration (or the configuration of the previous snapshot if cs is nil), and returns it.
+func (s *Storage) CreateSnapshot(i uint64, cs *pb.ConfState, data []byte) (pb.Snapshot, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if i <= s.snap.Metadata.Index {
+		return pb.Snapshot{}, raft.ErrSnapOutOfDate
+	}
+	term, err := s.term(i)
+	if err != nil {
+		return pb.Snapshot{}, err
+	}
+
+	snap := pb.Snapshot{Data: data, Metadata: pb.SnapshotMetadata{Index: i, Term: term, ConfState: s.snap.Metadata.ConfState}}
+	if cs != nil {
+		snap.Metadata.ConfState = *cs
+	}
+	if err := s.saveSnapshot(snap); err != nil {
+		return pb.Snapshot{}, err
+	}
+	return snap, nil
+}
+
+// ApplySnapshot replaces the log with a snapshot received from the leader.
+func (s *Storage) ApplySnapshot(snap pb.Snapshot) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if snap.Metadata.Index <= s.snap.Metadata.Index {
+		return raft.ErrSnapOutOfDate
+	}
+	if err := s.saveSnapshot(snap); err != nil {
+		return err
+	}
+
+	if _, err := s.log.TruncateAfter(0); err != nil {
+		return err
+	}
+	s.compacted = snap.Metadata.Index
+	s.last = snap.Metadata.Index
+	s.terms = []termStart{{index: snap.Metadata.Index, term: snap.Metadata.Term}}
+	return nil
+}
+
+// Compact discards the entries up to compactIndex, which must be covered by the latest snapshot.
+// Segments of the log are deleted once all their entries are compacted.
+func (s *Storage) Compact(compactIndex uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if compactIndex <= s.compacted {
+		return raft.ErrCompacted
+	}
+	if compactIndex > s.snap.Metadata.Index {
+		return fmt.Errorf("waletcdraft: can't compact entry %d, the latest snapshot is at %d", compactIndex, s.snap.Metadata.Index)
+	}
+	term, err := s.term(compactIndex)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.log.TruncateBefore(compactIndex + 1); err != nil {
+		return err
+	}
+	n := sort.Search(len(s.terms), func(n int) bool { return s.terms[n].index > compactIndex })
+	s.terms = append([]termStart{{index: compactIndex, term: term}}, s.terms[n:]...)
+	s.compacted = compactIndex
+	return nil
+}
+
+// saveSnapshot saves snap as the latest snapshot.
+func (s *Storage) saveSnapshot(snap pb.Snapshot) error {
+	data, err := snap.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := s.snapshots.CreateCheckpoint(data); err != nil {
+		return fmt.Errorf("could not save snapshot: %w", err)
+	}
+	s.snap = snap
+	return nil
+}
+
+// appendTerm records the term of the entry following the last one.
+func (s *Storage) appendTerm(index, term uint64) {
+	if s.terms[len(s.terms)-1].term != term {
+		s.terms = append(s.terms, termStart{index: index, term: term})
+	}
+}
+
+// truncateTerms forgets the entries after index and their terms.
+func (s *Storage) truncateTerms(index uint64) {
+	n := sort.Search(len(s.terms), func(n int) bool { return s.terms[n].index > index })
+	s.terms = s.terms[:max(n, 1)]
+	s.last = index
+}
+
+// encodeHeader encodes the term and type of the entry, which are stored as the metadata of the WAL entry.
+func encodeHeader(entry pb.Entry) []byte {
+	return append(binary.AppendUvarint(nil, entry.Term), byte(entry.Type))
+}
+
+func decodeHeader(entry *wal.WAL_Entry) (term uint64, entryType pb.EntryType, err error) {
+	header := entry.GetMetadata()
+	term, n := binary.Uvarint(header)
+	if n <= 0 || n != len(header)-1 {
+		return 0, 0, fmt.Errorf("waletcdraft: invalid header for entry %d", entry.GetLogSequenceNumber())
+	}
+	return term, pb.EntryType(header[n]), nil
+}
+
+// decodeEntry decodes an entry appended by Append.
+func decodeEntry(entry *wal.WAL_Entry) (pb.Entry, error) {
+	term, entryType, err := decodeHeader(entry)
+	if err != nil {
+		return pb.Entry{}, err
+	}
+	return pb.Entry{Index: entry.GetLogSequenceNumber(), Term: term, Type: entryType, Data: entry.GetData()}, nil
+}
@@ -0,0 +1,191 @@
+// Package walkafka publishes the entries of a WAL to Kafka, so that the WAL doubles as a change feed.
+//
+//	writer := &kafka.Writer{Addr: kafka.TCP("localhost:9092"), Topic: "orders", Balancer: &kafka.Hash{}}
+//	err := walkafka.NewSink(walog, writer).Run(ctx)
+package walkafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers set on the published messages.
+const (
+	HeaderLSN    = "gowal-lsn"
+	HeaderStream = "gowal-stream"
+)
+
+const (
+	defaultConsumer      = "kafka"
+	defaultBatchSize     = 100
+	defaultRetryInterval = time.Second
+)
+
+// Writer publishes messages to Kafka. It is implemented by *kafka.Writer.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Sink tails a WAL and publishes its entries to Kafka with at-least-once delivery: the sequence number
+// of the last entry published is committed as a consumer offset of the WAL (see wal.WAL.CommitOffset)
+// once Kafka acknowledged it, and publishing resumes after it when the Sink is restarted.
+//
+// The message key is the key of the entry if it has one, and its stream otherwise, so that with a
+// hash balancer the entries of a key, or of an unkeyed stream, are published to the same partition
+// in order. The sequence number and stream of the entry, and its labels, are set as headers.
+// Checkpoints are not published.
+type Sink struct {
+	walog  *wal.WAL
+	writer Writer
+	sinkOptions
+}
+
+// SinkOption configures a Sink created with NewSink.
+type SinkOption func(*sinkOptions)
+
+type sinkOptions struct {
+	consumer      string
+	topic         string
+	batchSize     int
+	retryInterval time.Duration
+}
+
+// WithConsumer sets the name of the consumer offset of the WAL the Sink commits to. Defaults to "kafka".
+func WithConsumer(name string) SinkOption {
+	return func(o *sinkOptions) {
+		o.consumer = name
+	}
+}
+
+// WithTopic sets the topic of the messages, for writers that don't set one. Defaults to the topic of the writer.
+func WithTopic(topic string) SinkOption {
+	return func(o *sinkOptions) {
+		o.topic = topic
+	}
+}
+
+// WithBatchSize sets the maximum number of messages published at once. Defaults to 100.
+func WithBatchSize(messages int) SinkOption {
+	return func(o *sinkOptions) {
+		o.batchSize = messages
+	}
+}
+
+// WithRetryInterval sets how long the Sink waits before publishing again after Kafka failed. Defaults to 1s.
+func WithRetryInterval(interval time.Duration) SinkOption {
+	return func(o *sinkOptions) {
+		o.retryInterval = interval
+	}
+}
+
+// NewSink returns a Sink publishing the entries of walog with writer.
+func NewSink(walog *wal.WAL, writer Writer, opts ...SinkOption) *Sink {
+	o := sinkOptions{consumer: defaultConsumer, batchSize: defaultBatchSize, retryInterval: defaultRetryInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Sink{walog: walog, writer: writer, sinkOptions: o}
+}
+
+// Run publishes the entries after the committed offset of the Sink, then the entries as they are
+// written, until ctx is done. Entries are read once they have been flushed to the segment files.
+// Failed publishes are retried after the retry interval; errors reading the WAL or committing the
+// offset end Run.
+func (s *Sink) Run(ctx context.Context) error {
+	// A consumer that never committed starts at the oldest entry still in the log.
+	var from uint64
+	if offset := s.walog.ConsumerOffset(s.consumer); offset > 0 {
+		from = offset + 1
+	}
+	tail, err := s.walog.Tail(from)
+	if err != nil {
+		return err
+	}
+	defer tail.Stop()
+
+	var batch []kafka.Message
+	var batchLSN uint64
+	publish := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.publish(ctx, batch); err != nil {
+			return err
+		}
+		if err := s.walog.CommitOffset(s.consumer, batchLSN); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		err := tail.Read(func(entry *wal.WAL_Entry) error {
+			if entry.GetIsCheckpoint() {
+				return nil
+			}
+			batch = append(batch, s.message(entry))
+			batchLSN = entry.GetLogSequenceNumber()
+			if len(batch) >= s.batchSize {
+				return publish()
+			}
+			return nil
+		})
+		if err == nil {
+			err = publish()
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tail.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// publish writes the messages to Kafka, retrying until they are acknowledged or ctx is done.
+func (s *Sink) publish(ctx context.Context, messages []kafka.Message) error {
+	for {
+		err := s.writer.WriteMessages(ctx, messages...)
+		if err == nil {
+			return nil
+		}
+
+		timer := time.NewTimer(s.retryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// message returns the message publishing the entry.
+func (s *Sink) message(entry *wal.WAL_Entry) kafka.Message {
+	key := entry.GetKey()
+	if len(key) == 0 && entry.GetStream() != "" {
+		key = []byte(entry.GetStream())
+	}
+
+	headers := []kafka.Header{{Key: HeaderLSN, Value: []byte(strconv.FormatUint(entry.GetLogSequenceNumber(), 10))}}
+	if stream := entry.GetStream(); stream != "" {
+		headers = append(headers, kafka.Header{Key: HeaderStream, Value: []byte(stream)})
+	}
+	for name, value := range entry.GetLabels() {
+		headers = append(headers, kafka.Header{Key: name, Value: []byte(value)})
+	}
+
+	return kafka.Message{
+		Topic:   s.topic,
+		Key:     key,
+		Value:   entry.GetData(),
+		Headers: headers,
+		Time:    entry.Time(),
+	}
+}
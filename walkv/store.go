@@ -0,0 +1,200 @@
+// Package walkv is a small durable key-value store built on a WAL: puts and deletes are written to the
+// log and applied to an in-memory table, which is snapshotted periodically so that reopening the store
+// only replays the entries written since the last snapshot.
+//
+//	store, err := walkv.Open("/data/kv")
+//	err = store.Put("user:1", []byte("alice"))
+//	value, ok := store.Get("user:1")
+//
+// It is also a reference for building on the replay (wal.Recover), snapshot (wal.SnapshotStore) and
+// compaction (wal.WAL.Compact) subsystems.
+package walkv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"sync"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+// deleteMarker is the metadata of the entries deleting their key written before tombstones existed.
+const deleteMarker = "delete"
+
+const (
+	defaultSegmentSize   = 64 << 20
+	defaultSnapshotEvery = 10000
+)
+
+// ErrEmptyKey is returned when putting or deleting the empty key.
+var ErrEmptyKey = errors.New("key must not be empty")
+
+// Store is a durable map from string keys to byte values. It is safe for concurrent use.
+type Store struct {
+	walog    *wal.WAL
+	recovery *wal.Recovery
+	table    *memtable
+}
+
+// Option configures a Store.
+type Option func(*config)
+
+type config struct {
+	segmentSize   int64
+	snapshotEvery int
+	walOptions    []wal.Option
+}
+
+// WithSegmentSize sets the maximum size of the segments of the log. The default is 64MiB.
+func WithSegmentSize(bytes int64) Option {
+	return func(c *config) {
+		c.segmentSize = bytes
+	}
+}
+
+// WithSnapshotEvery snapshots the table every n writes, see wal.WithSnapshotEvery. The default is 10000.
+func WithSnapshotEvery(n int) Option {
+	return func(c *config) {
+		c.snapshotEvery = n
+	}
+}
+
+// WithWALOptions sets options of the WAL the store is written to.
+func WithWALOptions(opts ...wal.Option) Option {
+	return func(c *config) {
+		c.walOptions = append(c.walOptions, opts...)
+	}
+}
+
+// Open opens the store in directory, creating it if needed, and recovers its content.
+func Open(directory string, opts ...Option) (*Store, error) {
+	c := config{segmentSize: defaultSegmentSize, snapshotEvery: defaultSnapshotEvery}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	// Segments are only deleted once covered by a snapshot, never because of their number.
+	walog, err := wal.OpenWAL(directory, true, c.segmentSize, math.MaxInt, c.walOptions...)
+	if err != nil {
+		return nil, err
+	}
+	table := &memtable{values: map[string][]byte{}}
+	recovery, err := wal.Recover(wal.NewSnapshotStore(walog), table, wal.WithSnapshotEvery(c.snapshotEvery))
+	if err != nil {
+		walog.Close()
+		return nil, err
+	}
+	return &Store{walog: walog, recovery: recovery, table: table}, nil
+}
+
+// Get returns the value of key, and whether it is set.
+func (s *Store) Get(key string) ([]byte, bool) {
+	return s.table.get(key)
+}
+
+// Len returns the number of keys set.
+func (s *Store) Len() int {
+	return s.table.len()
+}
+
+// Put sets the value of key. It returns once the write is synced.
+func (s *Store) Put(key string, value []byte) error {
+	return s.write(key, value)
+}
+
+// Delete removes key. It returns once the write is synced. Deleting a key that isn't set is a no-op,
+// which is still written.
+func (s *Store) Delete(key string) error {
+	return s.write(key, nil, wal.WithTombstone())
+}
+
+func (s *Store) write(key string, value []byte, opts ...wal.EntryOption) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	if _, err := s.recovery.Write(value, append(opts, wal.WithKey([]byte(key)))...); err != nil {
+		return err
+	}
+	return s.walog.Sync()
+}
+
+// Snapshot snapshots the table now, and deletes the segments it covers.
+func (s *Store) Snapshot() error {
+	return s.recovery.Snapshot()
+}
+
+// Compact drops the superseded versions of the keys from the segments not covered by a snapshot yet,
+// and the tombstones of the deleted keys the snapshots include, see wal.WAL.Compact, and returns the
+// number of entries dropped.
+func (s *Store) Compact() (int, error) {
+	return s.walog.Compact()
+}
+
+// WAL returns the log of the store, e.g. to read its Stats.
+func (s *Store) WAL() *wal.WAL {
+	return s.walog
+}
+
+// Close closes the log of the store.
+func (s *Store) Close() error {
+	return s.walog.Close()
+}
+
+// memtable is the content of the store, the wal.StateMachine of its log.
+type memtable struct {
+	lock   sync.RWMutex
+	values map[string][]byte
+}
+
+func (t *memtable) get(key string) ([]byte, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	value, ok := t.values[key]
+	return value, ok
+}
+
+func (t *memtable) len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return len(t.values)
+}
+
+// Apply implements wal.StateMachine.
+func (t *memtable) Apply(entry *wal.WAL_Entry) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := string(entry.GetKey())
+	if entry.GetTombstone() || string(entry.GetMetadata()) == deleteMarker {
+		delete(t.values, key)
+		return nil
+	}
+	// The data of the entries written by Put is the caller's slice.
+	t.values[key] = bytes.Clone(entry.GetData())
+	return nil
+}
+
+// Snapshot implements wal.StateMachine.
+func (t *memtable) Snapshot() ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return json.Marshal(t.values)
+}
+
+// Restore implements wal.StateMachine.
+func (t *memtable) Restore(state []byte) error {
+	values := map[string][]byte{}
+	if err := json.Unmarshal(state, &values); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.values = values
+	return nil
+}
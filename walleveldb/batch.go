@@ -0,0 +1,163 @@
+package walleveldb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+// MergeMetadata is the metadata of the entries converted from the merge operands of RocksDB, whose
+// data is the operand.
+const MergeMetadata = "merge"
+
+// Tags of the operations of a write batch.
+const (
+	tagDeletion                   = 0
+	tagValue                      = 1
+	tagMerge                      = 2
+	tagLogData                    = 3
+	tagColumnFamilyDeletion       = 4
+	tagColumnFamilyValue          = 5
+	tagColumnFamilyMerge          = 6
+	tagSingleDeletion             = 7
+	tagColumnFamilySingleDeletion = 8
+)
+
+// batchHeaderSize is the size of the header of a write batch: sequence number (8 bytes) and count (4).
+const batchHeaderSize = 12
+
+// DecodeBatch converts the write batch held by a record of a log file into entries, one per operation,
+// in order. The sequence number of an entry is the LevelDB sequence number of its operation. Puts are
+// entries with a key and data, deletes are tombstones (see wal.WithTombstone), and merges are entries
+// with MergeMetadata. The operations on a column family other than the default one are in the stream
+// "cf<id>". Log data blobs, which have no sequence number, are skipped, and the transaction markers of
+// RocksDB aren't supported.
+func DecodeBatch(record []byte) ([]*wal.WAL_Entry, error) {
+	if len(record) < batchHeaderSize {
+		return nil, fmt.Errorf("%w: write batch of %d bytes", ErrCorrupt, len(record))
+	}
+	sequence := binary.LittleEndian.Uint64(record)
+	count := binary.LittleEndian.Uint32(record[8:])
+	data := record[batchHeaderSize:]
+
+	entries := make([]*wal.WAL_Entry, 0, count)
+	for len(data) > 0 {
+		tag := data[0]
+		data = data[1:]
+
+		var columnFamily uint64
+		switch tag {
+		case tagColumnFamilyDeletion, tagColumnFamilyValue, tagColumnFamilyMerge, tagColumnFamilySingleDeletion:
+			var n int
+			if columnFamily, n = binary.Uvarint(data); n <= 0 {
+				return nil, fmt.Errorf("%w: invalid column family", ErrCorrupt)
+			}
+			data = data[n:]
+		}
+
+		key, err := consumeSlice(&data)
+		if err != nil {
+			return nil, err
+		}
+		entry := &wal.WAL_Entry{LogSequenceNumber: sequence + uint64(len(entries)), Key: key}
+		if columnFamily != 0 {
+			entry.Stream = fmt.Sprintf("cf%d", columnFamily)
+		}
+		switch tag {
+		case tagValue, tagColumnFamilyValue:
+			if entry.Data, err = consumeSlice(&data); err != nil {
+				return nil, err
+			}
+		case tagMerge, tagColumnFamilyMerge:
+			if entry.Data, err = consumeSlice(&data); err != nil {
+				return nil, err
+			}
+			entry.Metadata = []byte(MergeMetadata)
+		case tagDeletion, tagColumnFamilyDeletion, tagSingleDeletion, tagColumnFamilySingleDeletion:
+			entry.Tombstone = true
+		case tagLogData:
+			// key is the blob.
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported write batch operation %d", tag)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) != int(count) {
+		return nil, fmt.Errorf("%w: write batch of %d operations holds %d", ErrCorrupt, count, len(entries))
+	}
+	return entries, nil
+}
+
+// consumeSlice consumes a length-prefixed slice from data, and returns a copy of it.
+func consumeSlice(data *[]byte) ([]byte, error) {
+	length, n := binary.Uvarint(*data)
+	if n <= 0 || uint64(len(*data)-n) < length {
+		return nil, fmt.Errorf("%w: truncated write batch", ErrCorrupt)
+	}
+	slice := append([]byte{}, (*data)[n:n+int(length)]...)
+	*data = (*data)[n+int(length):]
+	return slice, nil
+}
+
+// ImportOption configures Import.
+type ImportOption func(*importOptions)
+
+type importOptions struct {
+	preserveSequenceNumbers bool
+}
+
+// WithSequenceNumbers writes the entries with their LevelDB sequence numbers, see wal.WithSequenceNumber,
+// instead of the next sequence numbers of the WAL. The import then fails with wal.ErrSequenceNumberTooLow
+// if the WAL holds later entries.
+func WithSequenceNumbers() ImportOption {
+	return func(o *importOptions) {
+		o.preserveSequenceNumbers = true
+	}
+}
+
+// Import writes the operations of the log file read from r to the WAL, converted by DecodeBatch, and
+// returns the number of entries written. Several log files are imported in the order of their numbers.
+func Import(walog *wal.WAL, r io.Reader, opts ...ImportOption) (imported int, err error) {
+	var o importOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	reader := NewReader(r)
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return imported, nil
+		}
+		if err != nil {
+			return imported, err
+		}
+		entries, err := DecodeBatch(record)
+		if err != nil {
+			return imported, err
+		}
+
+		for _, entry := range entries {
+			entryOpts := []wal.EntryOption{
+				wal.WithKey(entry.GetKey()),
+				wal.WithStream(entry.GetStream()),
+				wal.WithMetadata(entry.GetMetadata()),
+			}
+			if entry.GetTombstone() {
+				entryOpts = append(entryOpts, wal.WithTombstone())
+			}
+			if o.preserveSequenceNumbers {
+				entryOpts = append(entryOpts, wal.WithSequenceNumber(entry.GetLogSequenceNumber()))
+			}
+			if err := walog.WriteEntryOpts(entry.GetData(), entryOpts...); err != nil {
+				return imported, err
+			}
+			imported++
+		}
+	}
+}
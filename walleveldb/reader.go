@@ -0,0 +1,179 @@
+// Package walleveldb reads the write-ahead logs of LevelDB and RocksDB, to migrate their content to a
+// WAL. Their log files are sequences of 32KiB blocks holding checksummed records, each record holding a
+// write batch, see Reader and DecodeBatch. Import converts a log file into the entries of a WAL:
+//
+//	file, err := os.Open("/rocksdb/000042.log")
+//	imported, err := walleveldb.Import(walog, file)
+package walleveldb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Layout of the log files, see doc/log_format.md in the LevelDB and RocksDB repositories.
+const (
+	blockSize = 32 << 10
+	// headerSize is the size of the header of the records: checksum (4 bytes), length (2) and type (1).
+	headerSize = 7
+	// recyclableHeaderSize is the size of the header of the records of recycled RocksDB log files, which
+	// is followed by the number of the log file (4 bytes).
+	recyclableHeaderSize = headerSize + 4
+)
+
+// Types of the physical records. A record larger than the space left in a block is split into a first,
+// middle and last fragment.
+const (
+	recordZero = iota // preallocated space
+	recordFull
+	recordFirst
+	recordMiddle
+	recordLast
+	recordRecyclableFull
+	recordRecyclableFirst
+	recordRecyclableMiddle
+	recordRecyclableLast
+)
+
+// ErrCorrupt is returned when a log file holds an invalid record.
+var ErrCorrupt = errors.New("corrupt log record")
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Reader reads the records of a LevelDB or RocksDB log file.
+type Reader struct {
+	r     io.Reader
+	block []byte // the current block
+	rest  []byte // the part of the block not read yet
+	err   error  // error reading the next block, returned once the block is read
+
+	// logNumber is the number of the log file, set by the first record of a recycled RocksDB log file:
+	// records with another number were written to the file before it was recycled.
+	logNumber    uint32
+	hasLogNumber bool
+}
+
+// NewReader returns a Reader reading the log file from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, block: make([]byte, blockSize)}
+}
+
+// Next returns the next record, which is only valid until the following call. It returns io.EOF at the
+// end of the log, including when the log ends with a record that was only partially written, e.g.
+// because of a crash, and an error wrapping ErrCorrupt for an invalid record.
+func (r *Reader) Next() ([]byte, error) {
+	var record []byte
+	inRecord := false
+	for {
+		typ, fragment, err := r.nextFragment()
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ {
+		case recordFull, recordRecyclableFull:
+			if inRecord {
+				return nil, fmt.Errorf("%w: full record inside a fragmented record", ErrCorrupt)
+			}
+			return fragment, nil
+		case recordFirst, recordRecyclableFirst:
+			if inRecord {
+				return nil, fmt.Errorf("%w: first fragment inside a fragmented record", ErrCorrupt)
+			}
+			record = append(record[:0], fragment...)
+			inRecord = true
+		case recordMiddle, recordRecyclableMiddle:
+			if !inRecord {
+				return nil, fmt.Errorf("%w: middle fragment outside a fragmented record", ErrCorrupt)
+			}
+			record = append(record, fragment...)
+		case recordLast, recordRecyclableLast:
+			if !inRecord {
+				return nil, fmt.Errorf("%w: last fragment outside a fragmented record", ErrCorrupt)
+			}
+			return append(record, fragment...), nil
+		default:
+			return nil, fmt.Errorf("%w: unknown record type %d", ErrCorrupt, typ)
+		}
+	}
+}
+
+// nextFragment returns the type and the payload of the next physical record.
+func (r *Reader) nextFragment() (byte, []byte, error) {
+	for {
+		// The end of a block too small for a header is padding.
+		if len(r.rest) < headerSize {
+			if err := r.readBlock(); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+
+		length := int(binary.LittleEndian.Uint16(r.rest[4:6]))
+		typ := r.rest[6]
+		if typ == recordZero && length == 0 {
+			// Preallocated space: the rest of the block is empty.
+			r.rest = nil
+			continue
+		}
+		size := headerSize
+		if typ >= recordRecyclableFull {
+			size = recyclableHeaderSize
+		}
+		if len(r.rest) < size+length {
+			if r.err != nil && len(r.block) < blockSize {
+				// The last block ends in the middle of the record: it was only partially written.
+				r.rest = nil
+				continue
+			}
+			return 0, nil, fmt.Errorf("%w: record of %d bytes overflows its block", ErrCorrupt, length)
+		}
+
+		header, payload := r.rest[:size], r.rest[size:size+length]
+		r.rest = r.rest[size+length:]
+		crc := crc32.Update(crc32.Checksum(header[6:], castagnoliTable), castagnoliTable, payload)
+		if unmask(binary.LittleEndian.Uint32(header[:4])) != crc {
+			return 0, nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+		}
+
+		if typ >= recordRecyclableFull {
+			logNumber := binary.LittleEndian.Uint32(header[7:11])
+			if !r.hasLogNumber {
+				r.logNumber, r.hasLogNumber = logNumber, true
+			} else if logNumber != r.logNumber {
+				// Written before the file was recycled: the log ends here.
+				r.rest, r.err = nil, io.EOF
+				continue
+			}
+		}
+		return typ, payload, nil
+	}
+}
+
+// readBlock reads the next block, returning the error of the previous read once its block is read.
+func (r *Reader) readBlock() error {
+	if r.err != nil {
+		return r.err
+	}
+	n, err := io.ReadFull(r.r, r.block[:blockSize])
+	r.block = r.block[:n]
+	r.rest = r.block
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	r.err = err
+	if n == 0 {
+		return err
+	}
+	return nil
+}
+
+// unmask reverses the masking of the checksums stored in the log, which is meant to make the checksum
+// of data holding checksums less likely to be valid.
+func unmask(crc uint32) uint32 {
+	rot := crc - 0xa282ead8
+	return rot>>17 | rot<<15
+}
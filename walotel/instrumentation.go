@@ -0,0 +1,106 @@
+package walotel
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentationName identifies the WAL's tracer and meter.
+const instrumentationName = "github.com/ashwaniYDV/goWAL"
+
+// Instrumentation is a wal.Instrumentation creating OpenTelemetry spans around writes, syncs,
+// rotations, recovery and repair, and metric instruments mirroring Stats, see wal.WithInstrumentation.
+type Instrumentation struct {
+	tracer        trace.Tracer
+	meter         metric.Meter
+	fsyncDuration metric.Float64Histogram
+}
+
+// NewInstrumentation returns an Instrumentation creating spans with a tracer from tp and metric
+// instruments with a meter from mp. Either provider may be nil, to only trace or only measure.
+//
+//	instrumentation, err := walotel.NewInstrumentation(tracerProvider, meterProvider)
+//	walog, err := wal.OpenWAL(dir, true, maxFileSize, maxSegments, wal.WithInstrumentation(instrumentation))
+func NewInstrumentation(tp trace.TracerProvider, mp metric.MeterProvider) (*Instrumentation, error) {
+	if tp == nil {
+		tp = tracenoop.NewTracerProvider()
+	}
+	if mp == nil {
+		mp = metricnoop.NewMeterProvider()
+	}
+
+	i := &Instrumentation{tracer: tp.Tracer(instrumentationName), meter: mp.Meter(instrumentationName)}
+	var err error
+	if i.fsyncDuration, err = i.meter.Float64Histogram("wal.fsync.duration",
+		metric.WithDescription("Duration of fsync calls on segment files."), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// StartSpan implements wal.Instrumentation.
+func (i *Instrumentation) StartSpan(name string, attrs ...slog.Attr) wal.Span {
+	_, span := i.tracer.Start(context.Background(), name, trace.WithAttributes(attributes(attrs)...))
+	return otelSpan{span}
+}
+
+// RecordFsync implements wal.Instrumentation.
+func (i *Instrumentation) RecordFsync(duration time.Duration) {
+	i.fsyncDuration.Record(context.Background(), duration.Seconds())
+}
+
+// RegisterStats implements wal.Instrumentation. The counters and gauges are observed on collection.
+func (i *Instrumentation) RegisterStats(stats func() wal.Stats) (func(), error) {
+	registration, err := registerStats(i.meter, stats)
+	if err != nil {
+		return nil, err
+	}
+	return func() { registration.Unregister() }, nil
+}
+
+// otelSpan is a wal.Span recorded by an OpenTelemetry span.
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttributes(attrs ...slog.Attr) {
+	s.span.SetAttributes(attributes(attrs)...)
+}
+
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// attributes converts the attributes of a wal.Span to OpenTelemetry attributes.
+func attributes(attrs []slog.Attr) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		value := attr.Value.Resolve()
+		switch value.Kind() {
+		case slog.KindBool:
+			kvs = append(kvs, attribute.Bool(attr.Key, value.Bool()))
+		case slog.KindInt64:
+			kvs = append(kvs, attribute.Int64(attr.Key, value.Int64()))
+		case slog.KindUint64:
+			kvs = append(kvs, attribute.Int64(attr.Key, int64(value.Uint64())))
+		case slog.KindFloat64:
+			kvs = append(kvs, attribute.Float64(attr.Key, value.Float64()))
+		default:
+			kvs = append(kvs, attribute.String(attr.Key, value.String()))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,109 @@
+package walotel
+
+import (
+	"context"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// registerStats creates OTel counters and gauges observing the Stats returned by source.
+func registerStats(meter metric.Meter, source func() wal.Stats) (metric.Registration, error) {
+	entriesWritten, err := meter.Int64ObservableCounter("wal.entries.written",
+		metric.WithDescription("Number of entries (including checkpoints) written."))
+	if err != nil {
+		return nil, err
+	}
+	bytesWritten, err := meter.Int64ObservableCounter("wal.bytes.written",
+		metric.WithDescription("Number of bytes, including framing, written."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	rotations, err := meter.Int64ObservableCounter("wal.rotations",
+		metric.WithDescription("Number of rotations to a new segment."))
+	if err != nil {
+		return nil, err
+	}
+	segmentsDeleted, err := meter.Int64ObservableCounter("wal.segments.deleted",
+		metric.WithDescription("Number of old segments deleted because of the segment limit."))
+	if err != nil {
+		return nil, err
+	}
+	fsyncs, err := meter.Int64ObservableCounter("wal.fsyncs",
+		metric.WithDescription("Number of fsync calls on segment files."))
+	if err != nil {
+		return nil, err
+	}
+	corruptionEvents, err := meter.Int64ObservableCounter("wal.corruption.events",
+		metric.WithDescription("Number of times corrupted entries were detected."))
+	if err != nil {
+		return nil, err
+	}
+	flushes, err := meter.Int64ObservableCounter("wal.flushes",
+		metric.WithDescription("Number of writes of the in-memory buffer to the segment file."))
+	if err != nil {
+		return nil, err
+	}
+	flushedBytes, err := meter.Int64ObservableCounter("wal.flushed",
+		metric.WithDescription("Number of bytes written to segment files by flushes."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	lastSequenceNumber, err := meter.Int64ObservableGauge("wal.last_sequence_number",
+		metric.WithDescription("Sequence number of the most recently written entry."))
+	if err != nil {
+		return nil, err
+	}
+	segments, err := meter.Int64ObservableGauge("wal.segments",
+		metric.WithDescription("Number of log segment files."))
+	if err != nil {
+		return nil, err
+	}
+	activeSegmentSize, err := meter.Int64ObservableGauge("wal.active_segment.size",
+		metric.WithDescription("Size on disk of the segment currently being written to."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	bufferedBytes, err := meter.Int64ObservableGauge("wal.buffered",
+		metric.WithDescription("Bytes in the in-memory buffer not yet written to the segment file."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+
+	bufferSize, err := meter.Int64ObservableGauge("wal.buffer.size",
+		metric.WithDescription("Capacity of the in-memory buffer."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	lastFlushSize, err := meter.Int64ObservableGauge("wal.last_flush.size",
+		metric.WithDescription("Number of bytes written by the last flush."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	largestEntrySize, err := meter.Int64ObservableGauge("wal.largest_entry.size",
+		metric.WithDescription("Size, including framing, of the largest entry written."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+
+	return meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stats := source()
+		o.ObserveInt64(entriesWritten, int64(stats.EntriesWritten))
+		o.ObserveInt64(bytesWritten, int64(stats.BytesWritten))
+		o.ObserveInt64(rotations, int64(stats.Rotations))
+		o.ObserveInt64(segmentsDeleted, int64(stats.SegmentsDeleted))
+		o.ObserveInt64(fsyncs, int64(stats.Fsyncs))
+		o.ObserveInt64(corruptionEvents, int64(stats.CorruptionEvents))
+		o.ObserveInt64(lastSequenceNumber, int64(stats.LastSequenceNumber))
+		o.ObserveInt64(segments, int64(stats.SegmentCount))
+		o.ObserveInt64(activeSegmentSize, stats.ActiveSegmentSize)
+		o.ObserveInt64(bufferedBytes, int64(stats.BufferedBytes))
+		o.ObserveInt64(flushes, int64(stats.Flushes))
+		o.ObserveInt64(flushedBytes, int64(stats.FlushedBytes))
+		o.ObserveInt64(bufferSize, int64(stats.BufferSize))
+		o.ObserveInt64(lastFlushSize, int64(stats.LastFlushSize))
+		o.ObserveInt64(largestEntrySize, int64(stats.LargestEntrySize))
+		return nil
+	}, entriesWritten, bytesWritten, rotations, segmentsDeleted, fsyncs, corruptionEvents, flushes, flushedBytes,
+		lastSequenceNumber, segments, activeSegmentSize, bufferedBytes, bufferSize, lastFlushSize, largestEntrySize)
+}
@@ -0,0 +1,23 @@
+// Package walotel exposes the operations and the operational counters of a WAL through OpenTelemetry,
+// keeping the OpenTelemetry dependencies out of the wal package: Instrumentation traces and measures a
+// WAL as it runs, and NewSink reports its Stats at a fixed interval.
+//
+//	sink, err := walotel.NewSink(meterProvider.Meter("orders"))
+//	walog, err := wal.OpenWAL(dir, true, maxFileSize, maxSegments, wal.WithStatsSink(sink, 10*time.Second))
+package walotel
+
+import (
+	wal "github.com/ashwaniYDV/goWAL"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// NewSink returns a StatsSink that exposes the last Stats reported to it as OTel counters and gauges
+// created with the given meter. It is an alternative to the metrics of Instrumentation for reporting
+// the Stats of a WAL at a fixed interval rather than on collection, see wal.WithStatsSink.
+func NewSink(meter metric.Meter) (*wal.StatsRecorder, error) {
+	recorder := &wal.StatsRecorder{}
+	if _, err := registerStats(meter, recorder.Stats); err != nil {
+		return nil, err
+	}
+	return recorder, nil
+}
@@ -0,0 +1,60 @@
+// Package walparquet converts the entries of a WAL into Parquet files for analytics.
+//
+//	rows, err := walparquet.Export(file, "/wal/directory")
+package walparquet
+
+import (
+	"context"
+	"io"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Row is a row of the Parquet files written by Export, one per entry.
+type Row struct {
+	LSN uint64 `parquet:"lsn"`
+	// Timestamp is the application timestamp of the entry in nanoseconds since the epoch,
+	// or null (0) if it has none.
+	Timestamp  int64  `parquet:"timestamp,optional,timestamp(nanosecond)"`
+	Checkpoint bool   `parquet:"checkpoint"`
+	Stream     string `parquet:"stream,dict"`
+	Key        []byte `parquet:"key"`
+	// Size is the size of the payload in bytes.
+	Size    int64  `parquet:"size"`
+	Payload []byte `parquet:"payload"`
+}
+
+// NewRow returns the row representing the given entry.
+func NewRow(entry *wal.WAL_Entry) Row {
+	return Row{
+		LSN:        entry.GetLogSequenceNumber(),
+		Checkpoint: entry.GetIsCheckpoint(),
+		Stream:     entry.GetStream(),
+		Key:        entry.GetKey(),
+		Size:       int64(len(entry.GetData())),
+		Timestamp:  entry.GetTimestamp(),
+		Payload:    entry.GetData(),
+	}
+}
+
+// Export writes the entries of the WAL in directory, in order, to w as a zstd compressed Parquet file
+// and returns the number of rows written. The WAL may be written concurrently; entries written after
+// the export reached the end of the newest segment are not included. Corrupted entries fail the export.
+// The only option used is WithFS.
+func Export(w io.Writer, directory string, opts ...wal.Option) (rows int, err error) {
+	writer := parquet.NewGenericWriter[Row](w, parquet.Compression(&parquet.Zstd))
+
+	err = wal.TailDir(context.Background(), directory, 0, false, func(entry *wal.WAL_Entry) error {
+		if _, err := writer.Write([]Row{NewRow(entry)}); err != nil {
+			return err
+		}
+		rows++
+		return nil
+	}, opts...)
+	if err != nil {
+		return rows, err
+	}
+
+	return rows, writer.Close()
+}
@@ -0,0 +1,169 @@
+// Package walprom exposes the operational counters of a WAL as Prometheus metrics.
+//
+//	prometheus.MustRegister(walprom.NewCollector(walog, prometheus.Labels{"wal": "orders"}))
+package walprom
+
+import (
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "gowal"
+
+// Collector is a prometheus.Collector reporting the Stats of a WAL.
+type Collector struct {
+	stats func() wal.Stats
+
+	entriesWritten     *prometheus.Desc
+	bytesWritten       *prometheus.Desc
+	lastSequenceNumber *prometheus.Desc
+	bufferedBytes      *prometheus.Desc
+	bufferSize         *prometheus.Desc
+	flushes            *prometheus.Desc
+	flushedBytes       *prometheus.Desc
+	lastFlushBytes     *prometheus.Desc
+	largestEntryBytes  *prometheus.Desc
+	segments           *prometheus.Desc
+	activeSegmentBytes *prometheus.Desc
+	rotations          *prometheus.Desc
+	segmentsDeleted    *prometheus.Desc
+	fsyncs             *prometheus.Desc
+	fsyncDuration      *prometheus.Desc
+	writeDuration      *prometheus.Desc
+	syncDuration       *prometheus.Desc
+	corruptionEvents   *prometheus.Desc
+
+	streamEntriesWritten *prometheus.Desc
+	streamBytesWritten   *prometheus.Desc
+	consumerOffset       *prometheus.Desc
+	consumerLag          *prometheus.Desc
+}
+
+// NewCollector returns a Collector for the given WAL. constLabels are attached to every metric,
+// which allows registering collectors for several WALs with the same registry.
+func NewCollector(w *wal.WAL, constLabels prometheus.Labels) *Collector {
+	return newCollector(w.Stats, constLabels)
+}
+
+// Sink is a wal.StatsSink exposing the last Stats reported to it as Prometheus metrics.
+// It is an alternative to NewCollector when the Stats should be collected at a fixed interval
+// (see wal.WithStatsSink) rather than on every scrape.
+type Sink struct {
+	*wal.StatsRecorder
+	*Collector
+}
+
+// NewSink returns a Sink. constLabels are attached to every metric, as with NewCollector.
+func NewSink(constLabels prometheus.Labels) *Sink {
+	recorder := &wal.StatsRecorder{}
+	return &Sink{StatsRecorder: recorder, Collector: newCollector(recorder.Stats, constLabels)}
+}
+
+func newCollector(stats func() wal.Stats, constLabels prometheus.Labels) *Collector {
+	desc := func(name, help string, variableLabels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, variableLabels, constLabels)
+	}
+
+	return &Collector{
+		stats:              stats,
+		entriesWritten:     desc("entries_written_total", "Number of entries (including checkpoints) written."),
+		bytesWritten:       desc("bytes_written_total", "Number of bytes, including framing, written."),
+		lastSequenceNumber: desc("last_sequence_number", "Sequence number of the most recently written entry."),
+		bufferedBytes:      desc("buffered_bytes", "Bytes in the in-memory buffer not yet written to the segment file."),
+		bufferSize:         desc("buffer_size_bytes", "Capacity of the in-memory buffer."),
+		flushes:            desc("flushes_total", "Number of writes of the in-memory buffer to the segment file."),
+		flushedBytes:       desc("flushed_bytes_total", "Number of bytes written to segment files by flushes."),
+		lastFlushBytes:     desc("last_flush_bytes", "Number of bytes written by the last flush."),
+		largestEntryBytes:  desc("largest_entry_bytes", "Size, including framing, of the largest entry written."),
+		segments:           desc("segments", "Number of log segment files."),
+		activeSegmentBytes: desc("active_segment_bytes", "Size on disk of the segment currently being written to."),
+		rotations:          desc("rotations_total", "Number of rotations to a new segment."),
+		segmentsDeleted:    desc("segments_deleted_total", "Number of old segments deleted because of the segment limit."),
+		fsyncs:             desc("fsyncs_total", "Number of fsync calls on segment files."),
+		fsyncDuration:      desc("fsync_duration_seconds", "Duration of fsync calls on segment files."),
+		writeDuration:      desc("write_duration_seconds", "Duration of writes, including waiting for the lock."),
+		syncDuration:       desc("sync_duration_seconds", "Duration of syncs (flush and fsync)."),
+		corruptionEvents:   desc("corruption_events_total", "Number of times corrupted entries were detected."),
+
+		streamEntriesWritten: desc("stream_entries_written_total", "Number of entries of a stream written.", "stream"),
+		streamBytesWritten:   desc("stream_bytes_written_total", "Number of bytes, including framing, of a stream written.", "stream"),
+		consumerOffset:       desc("consumer_offset", "Last offset committed by a consumer.", "consumer"),
+		consumerLag:          desc("consumer_lag", "Number of entries written after the offset committed by a consumer.", "consumer"),
+	}
+}
+
+// Register registers a Collector for the given WAL with reg.
+func Register(reg prometheus.Registerer, w *wal.WAL, constLabels prometheus.Labels) error {
+	return reg.Register(NewCollector(w, constLabels))
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entriesWritten
+	ch <- c.bytesWritten
+	ch <- c.lastSequenceNumber
+	ch <- c.bufferedBytes
+	ch <- c.bufferSize
+	ch <- c.flushes
+	ch <- c.flushedBytes
+	ch <- c.lastFlushBytes
+	ch <- c.largestEntryBytes
+	ch <- c.segments
+	ch <- c.activeSegmentBytes
+	ch <- c.rotations
+	ch <- c.segmentsDeleted
+	ch <- c.fsyncs
+	ch <- c.fsyncDuration
+	ch <- c.writeDuration
+	ch <- c.syncDuration
+	ch <- c.corruptionEvents
+	ch <- c.streamEntriesWritten
+	ch <- c.streamBytesWritten
+	ch <- c.consumerOffset
+	ch <- c.consumerLag
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+
+	ch <- prometheus.MustNewConstMetric(c.entriesWritten, prometheus.CounterValue, float64(stats.EntriesWritten))
+	ch <- prometheus.MustNewConstMetric(c.bytesWritten, prometheus.CounterValue, float64(stats.BytesWritten))
+	ch <- prometheus.MustNewConstMetric(c.lastSequenceNumber, prometheus.GaugeValue, float64(stats.LastSequenceNumber))
+	ch <- prometheus.MustNewConstMetric(c.bufferedBytes, prometheus.GaugeValue, float64(stats.BufferedBytes))
+	ch <- prometheus.MustNewConstMetric(c.bufferSize, prometheus.GaugeValue, float64(stats.BufferSize))
+	ch <- prometheus.MustNewConstMetric(c.flushes, prometheus.CounterValue, float64(stats.Flushes))
+	ch <- prometheus.MustNewConstMetric(c.flushedBytes, prometheus.CounterValue, float64(stats.FlushedBytes))
+	ch <- prometheus.MustNewConstMetric(c.lastFlushBytes, prometheus.GaugeValue, float64(stats.LastFlushSize))
+	ch <- prometheus.MustNewConstMetric(c.largestEntryBytes, prometheus.GaugeValue, float64(stats.LargestEntrySize))
+	ch <- prometheus.MustNewConstMetric(c.segments, prometheus.GaugeValue, float64(stats.SegmentCount))
+	ch <- prometheus.MustNewConstMetric(c.activeSegmentBytes, prometheus.GaugeValue, float64(stats.ActiveSegmentSize))
+	ch <- prometheus.MustNewConstMetric(c.rotations, prometheus.CounterValue, float64(stats.Rotations))
+	ch <- prometheus.MustNewConstMetric(c.segmentsDeleted, prometheus.CounterValue, float64(stats.SegmentsDeleted))
+	ch <- prometheus.MustNewConstMetric(c.fsyncs, prometheus.CounterValue, float64(stats.Fsyncs))
+	ch <- prometheus.MustNewConstMetric(c.corruptionEvents, prometheus.CounterValue, float64(stats.CorruptionEvents))
+
+	for stream, streamStats := range stats.Streams {
+		ch <- prometheus.MustNewConstMetric(c.streamEntriesWritten, prometheus.CounterValue, float64(streamStats.EntriesWritten), stream)
+		ch <- prometheus.MustNewConstMetric(c.streamBytesWritten, prometheus.CounterValue, float64(streamStats.BytesWritten), stream)
+	}
+	for consumer, consumerStats := range stats.Consumers {
+		ch <- prometheus.MustNewConstMetric(c.consumerOffset, prometheus.GaugeValue, float64(consumerStats.Offset), consumer)
+		ch <- prometheus.MustNewConstMetric(c.consumerLag, prometheus.GaugeValue, float64(consumerStats.Lag), consumer)
+	}
+
+	ch <- constHistogram(c.fsyncDuration, stats.FsyncLatency)
+	ch <- constHistogram(c.writeDuration, stats.WriteLatency)
+	ch <- constHistogram(c.syncDuration, stats.SyncLatency)
+}
+
+func constHistogram(desc *prometheus.Desc, h wal.Histogram) prometheus.Metric {
+	// Prometheus histograms have cumulative buckets.
+	buckets := make(map[float64]uint64, len(h.Bounds))
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		buckets[bound.Seconds()] = cumulative
+	}
+	return prometheus.MustNewConstHistogram(desc, h.Count, h.Sum.Seconds(), buckets)
+}
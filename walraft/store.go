@@ -0,0 +1,364 @@
+// Package walraft implements the log and stable stores of hashicorp/raft on top of goWAL.
+//
+//	store, err := walraft.Open("/raft/data", 64<<20)
+//	r, err := raft.NewRaft(config, fsm, raft.NewLogCache(512, store), store, snapshots, transport)
+package walraft
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	logDirectoryName = "log"
+	stableFileName   = "stable.json"
+	// firstIndexKey is the key of the stable store recording the index of the first log, since deleting
+	// the oldest logs doesn't delete the entries of their segment that follows them.
+	firstIndexKey = "walraft.first_index"
+)
+
+// ErrKeyNotFound is returned by the StableStore methods of Store for keys that were never set.
+// Raft recognizes it by its message.
+var ErrKeyNotFound = errors.New("not found")
+
+var (
+	_ raft.LogStore    = (*Store)(nil)
+	_ raft.StableStore = (*Store)(nil)
+)
+
+// Store is a raft.LogStore and raft.StableStore. Every Raft log is an entry of a WAL with the index
+// of the log as its sequence number, and the stable store is a small JSON file next to the WAL.
+//
+// Logs are read back from the segment files, which scans the segment containing them: wrap the Store
+// in a raft.LogCache so that followers are replicated from memory.
+type Store struct {
+	walog      *wal.WAL
+	stablePath string
+
+	lock sync.Mutex
+	// first and last are the indexes of the first and last logs, or 0 if there are none.
+	first  uint64
+	last   uint64
+	stable map[string][]byte
+}
+
+// Open opens the Store in directory, creating it if it doesn't exist. The WAL is stored in the log
+// subdirectory, in segments of maxSegmentSize bytes, and syncs every StoreLogs. Segments are only
+// deleted by DeleteRange, when Raft compacts its log after a snapshot.
+// opts configure the WAL, see wal.Option.
+func Open(directory string, maxSegmentSize int64, opts ...wal.Option) (*Store, error) {
+	walog, err := wal.OpenWAL(filepath.Join(directory, logDirectoryName), true, maxSegmentSize, math.MaxInt, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{walog: walog, stablePath: filepath.Join(directory, stableFileName), stable: make(map[string][]byte)}
+	if err := s.loadStable(); err != nil {
+		walog.Close()
+		return nil, err
+	}
+	s.last = walog.Stats().LastSequenceNumber
+	if s.first, err = s.firstSequenceNumber(); err != nil {
+		walog.Close()
+		return nil, err
+	}
+	if first, err := s.GetUint64([]byte(firstIndexKey)); err == nil && first > s.first {
+		s.first = first
+		if s.first > s.last {
+			s.first, s.last = 0, 0
+		}
+	}
+	return s, nil
+}
+
+// Close closes the WAL of the Store.
+func (s *Store) Close() error {
+	return s.walog.Close()
+}
+
+// WAL returns the WAL holding the logs, e.g. to inspect its Stats. It must not be written directly.
+func (s *Store) WAL() *wal.WAL {
+	return s.walog
+}
+
+// FirstIndex returns the index of the first log, or 0 if there are none.
+func (s *Store) FirstIndex() (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.first, nil
+}
+
+// LastIndex returns the index of the last log, or 0 if there are none.
+func (s *Store) LastIndex() (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.last, nil
+}
+
+// GetLog reads the log at the given index into log. It returns raft.ErrLogNotFound if there is no such log.
+func (s *Store) GetLog(index uint64, log *raft.Log) error {
+	s.lock.Lock()
+	first, last := s.first, s.last
+	s.lock.Unlock()
+	if index == 0 || index < first || index > last {
+		return raft.ErrLogNotFound
+	}
+
+	entry, err := s.readEntry(index)
+	if err != nil {
+		return err
+	}
+	if entry == nil || entry.GetLogSequenceNumber() != index {
+		return raft.ErrLogNotFound
+	}
+	return decodeLog(entry, log)
+}
+
+// StoreLog stores a log.
+func (s *Store) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs stores the logs, which must have increasing indexes after the last log, and syncs the WAL.
+func (s *Store) StoreLogs(logs []*raft.Log) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, log := range logs {
+		err := s.walog.WriteEntryOpts(log.Data, wal.WithSequenceNumber(log.Index), wal.WithMetadata(encodeHeader(log)))
+		if err != nil {
+			return fmt.Errorf("could not store log %d: %w", log.Index, err)
+		}
+		if s.first == 0 {
+			if err := s.setUint64([]byte(firstIndexKey), log.Index); err != nil {
+				return err
+			}
+			s.first = log.Index
+		}
+		s.last = log.Index
+	}
+	return s.walog.Sync()
+}
+
+// DeleteRange deletes the logs with an index between minIndex and maxIndex, inclusive. Raft only deletes the
+// oldest logs, after a snapshot, or the newest ones, when they conflict with the log of the leader;
+// other ranges are rejected. Deleting the oldest logs has the segment granularity of
+// wal.WAL.TruncateBefore: they are no longer returned, but their space is reclaimed once all the logs
+// of their segment are deleted.
+func (s *Store) DeleteRange(minIndex, maxIndex uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.last == 0 || minIndex > maxIndex || minIndex > s.last || maxIndex < s.first {
+		return nil
+	}
+
+	switch {
+	case maxIndex >= s.last:
+		if _, err := s.walog.TruncateAfter(max(minIndex, 1) - 1); err != nil {
+			return err
+		}
+		s.last = s.walog.Stats().LastSequenceNumber
+		if minIndex <= s.first {
+			s.first, s.last = 0, 0
+		}
+	case minIndex <= s.first:
+		// The first index is recorded first: the logs before it are deleted even if their entries are not.
+		if err := s.setUint64([]byte(firstIndexKey), maxIndex+1); err != nil {
+			return err
+		}
+		if _, err := s.walog.TruncateBefore(maxIndex + 1); err != nil {
+			return err
+		}
+		s.first = maxIndex + 1
+	default:
+		return fmt.Errorf("walraft: can't delete logs %d to %d from the middle of logs %d to %d", minIndex, maxIndex, s.first, s.last)
+	}
+	return nil
+}
+
+// errFound stops reading the log once the entry looked for was read.
+var errFound = errors.New("found")
+
+// readEntry returns the first entry with a sequence number of at least lsn, or nil if there is none.
+func (s *Store) readEntry(lsn uint64) (*wal.WAL_Entry, error) {
+	tail, err := s.walog.Tail(lsn)
+	if err != nil {
+		return nil, err
+	}
+	defer tail.Stop()
+
+	var found *wal.WAL_Entry
+	err = tail.Read(func(entry *wal.WAL_Entry) error {
+		found = entry
+		return errFound
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return nil, err
+	}
+	return found, nil
+}
+
+// firstSequenceNumber returns the sequence number of the first entry of the WAL, or 0 if it's empty.
+func (s *Store) firstSequenceNumber() (uint64, error) {
+	if s.last == 0 {
+		return 0, nil
+	}
+	entry, err := s.readEntry(0)
+	if err != nil || entry == nil {
+		return 0, err
+	}
+	return entry.GetLogSequenceNumber(), nil
+}
+
+// encodeHeader encodes the fields of the log other than its index and data, which are stored
+// as the sequence number and payload of the entry.
+func encodeHeader(log *raft.Log) []byte {
+	header := binary.AppendUvarint(nil, log.Term)
+	header = append(header, byte(log.Type))
+	var appendedAt int64
+	if !log.AppendedAt.IsZero() {
+		appendedAt = log.AppendedAt.UnixNano()
+	}
+	header = binary.AppendVarint(header, appendedAt)
+	return append(header, log.Extensions...)
+}
+
+// decodeLog decodes a log stored by StoreLogs.
+func decodeLog(entry *wal.WAL_Entry, log *raft.Log) error {
+	header := entry.GetMetadata()
+	term, n := binary.Uvarint(header)
+	if n <= 0 || n >= len(header) {
+		return fmt.Errorf("walraft: invalid header for log %d", entry.GetLogSequenceNumber())
+	}
+	logType := header[n]
+	header = header[n+1:]
+	appendedAt, n := binary.Varint(header)
+	if n <= 0 {
+		return fmt.Errorf("walraft: invalid header for log %d", entry.GetLogSequenceNumber())
+	}
+
+	*log = raft.Log{
+		Index: entry.GetLogSequenceNumber(),
+		Term:  term,
+		Type:  raft.LogType(logType),
+		Data:  entry.GetData(),
+	}
+	if extensions := header[n:]; len(extensions) > 0 {
+		log.Extensions = extensions
+	}
+	if appendedAt != 0 {
+		log.AppendedAt = time.Unix(0, appendedAt)
+	}
+	return nil
+}
+
+// Set stores the value of a key in the stable store.
+func (s *Store) Set(key []byte, val []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.set(key, val)
+}
+
+// set stores the value of a key in the stable store. The caller must hold s.lock.
+func (s *Store) set(key []byte, val []byte) error {
+	stable := make(map[string][]byte, len(s.stable)+1)
+	for k, v := range s.stable {
+		stable[k] = v
+	}
+	stable[string(key)] = append([]byte(nil), val...)
+	if err := s.saveStable(stable); err != nil {
+		return err
+	}
+	s.stable = stable
+	return nil
+}
+
+// Get returns the value of a key in the stable store, or ErrKeyNotFound.
+func (s *Store) Get(key []byte) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	val, ok := s.stable[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return val, nil
+}
+
+// SetUint64 stores an integer value of a key in the stable store.
+func (s *Store) SetUint64(key []byte, val uint64) error {
+	return s.Set(key, binary.BigEndian.AppendUint64(nil, val))
+}
+
+// setUint64 stores an integer value of a key in the stable store. The caller must hold s.lock.
+func (s *Store) setUint64(key []byte, val uint64) error {
+	return s.set(key, binary.BigEndian.AppendUint64(nil, val))
+}
+
+// GetUint64 returns an integer value of a key in the stable store, or ErrKeyNotFound.
+func (s *Store) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(val) != 8 {
+		return 0, fmt.Errorf("walraft: value of %q is not an integer", key)
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
+
+// loadStable reads the stable store file, if present.
+func (s *Store) loadStable() error {
+	data, err := os.ReadFile(s.stablePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &s.stable); err != nil {
+		return fmt.Errorf("could not read %s: %w", s.stablePath, err)
+	}
+	return nil
+}
+
+// saveStable atomically replaces the stable store file.
+func (s *Store) saveStable(stable map[string][]byte) error {
+	data, err := json.Marshal(stable)
+	if err != nil {
+		return err
+	}
+
+	tempFilePath := fmt.Sprintf("%s.tmp", s.stablePath)
+	tempFile, err := os.OpenFile(tempFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	// The file must be durable before it replaces the previous one.
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempFilePath, s.stablePath)
+}
@@ -0,0 +1,185 @@
+package walservice
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+)
+
+// maxAppendRequestSize limits the data of entries appended through the HTTP handler.
+const maxAppendRequestSize = 16 << 20
+
+// jsonEntry is the JSON representation of an entry served by the HTTP handler.
+// Byte fields are base64 encoded.
+type jsonEntry struct {
+	LSN           uint64            `json:"lsn"`
+	Timestamp     *time.Time        `json:"timestamp,omitempty"`
+	Checkpoint    bool              `json:"checkpoint"`
+	Tombstone     bool              `json:"tombstone,omitempty"`
+	Stream        string            `json:"stream,omitempty"`
+	Key           []byte            `json:"key,omitempty"`
+	Metadata      []byte            `json:"metadata,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Schema        string            `json:"schema,omitempty"`
+	SchemaVersion uint32            `json:"schema_version,omitempty"`
+	Data          []byte            `json:"data"`
+}
+
+func newJSONEntry(entry *wal.WAL_Entry) jsonEntry {
+	e := jsonEntry{
+		LSN:           entry.GetLogSequenceNumber(),
+		Checkpoint:    entry.GetIsCheckpoint(),
+		Tombstone:     entry.GetTombstone(),
+		Stream:        entry.GetStream(),
+		Key:           entry.GetKey(),
+		Metadata:      entry.GetMetadata(),
+		Labels:        entry.GetLabels(),
+		Schema:        entry.GetSchema(),
+		SchemaVersion: entry.GetSchemaVersion(),
+		Data:          entry.GetData(),
+	}
+	if t := entry.Time(); !t.IsZero() {
+		e.Timestamp = &t
+	}
+	return e
+}
+
+// Handler returns an http.Handler serving the Log service as JSON:
+//
+//	POST /entries  appends the request body as an entry and returns its "lsn"; the query parameters
+//	               stream, key and label (name:value, repeated) set its attributes, and sync=true
+//	               returns once it has been synced to disk
+//	GET  /entries  returns the entries from the sequence number "from" to "to", up to "limit" entries
+//	GET  /tail     streams the entries from the sequence number "from" on, one JSON object per line,
+//	               until the request is canceled
+//
+// Every other request is served by the handler of the WAL with admin actions, see wal.WAL.Handler,
+// e.g. GET /stats and POST /checkpoint.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /entries", s.appendHTTP)
+	mux.HandleFunc("GET /entries", s.readHTTP)
+	mux.HandleFunc("GET /tail", s.tailHTTP)
+	mux.Handle("/", s.walog.Handler(wal.WithAdminActions()))
+	return mux
+}
+
+func (s *Server) appendHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAppendRequestSize))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	query := r.URL.Query()
+	req := &AppendRequest{Data: data, Stream: query.Get("stream"), Sync: query.Get("sync") == "true"}
+	if key := query.Get("key"); key != "" {
+		req.Key = []byte(key)
+	}
+	for _, label := range query["label"] {
+		name, value, ok := strings.Cut(label, ":")
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "labels must be name:value"})
+			return
+		}
+		if req.Labels == nil {
+			req.Labels = make(map[string]string)
+		}
+		req.Labels[name] = value
+	}
+
+	lsn, err := s.append(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]uint64{"lsn": lsn})
+}
+
+func (s *Server) readHTTP(w http.ResponseWriter, r *http.Request) {
+	var from, to, limit uint64
+	for name, value := range map[string]*uint64{"from": &from, "to": &to, "limit": &limit} {
+		if param := r.URL.Query().Get(name); param != "" {
+			var err error
+			if *value, err = strconv.ParseUint(param, 10, 64); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name + ": " + err.Error()})
+				return
+			}
+		}
+	}
+
+	entries, err := s.read(from, to, int(min(limit, uint64(s.maxReadEntries))))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonEntries := make([]jsonEntry, 0, len(entries))
+	for _, entry := range entries {
+		jsonEntries = append(jsonEntries, newJSONEntry(entry))
+	}
+	writeJSON(w, http.StatusOK, jsonEntries)
+}
+
+func (s *Server) tailHTTP(w http.ResponseWriter, r *http.Request) {
+	var from uint64
+	if param := r.URL.Query().Get("from"); param != "" {
+		var err error
+		if from, err = strconv.ParseUint(param, 10, 64); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from: " + err.Error()})
+			return
+		}
+	}
+
+	// The tail is opened before the response is started, so that errors get a status code.
+	tail, err := s.walog.Tail(from)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer tail.Stop()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	err = follow(r.Context(), tail, func(entry *wal.WAL_Entry) error {
+		if err := encoder.Encode(newJSONEntry(entry)); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		log.Printf("Error while tailing the WAL: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, wal.ErrEntriesDeleted):
+		code = http.StatusGone
+	case errors.Is(err, wal.ErrClosed):
+		code = http.StatusServiceUnavailable
+	case errors.Is(err, wal.ErrFenced):
+		code = http.StatusConflict
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error while writing response: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+// Package walservice exposes a WAL as a durable log service over gRPC and HTTP, for clients that
+// aren't written in Go or that run in a separate process, as with the gowald daemon.
+//
+//	server := walservice.NewServer(walog)
+//	walservice.RegisterLogServer(grpcServer, server)
+//	http.ListenAndServe(":7071", server.Handler())
+package walservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	wal "github.com/ashwaniYDV/goWAL"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultMaxReadEntries = 1000
+
+// Server implements the Log service, and its HTTP counterpart, for a WAL.
+type Server struct {
+	UnimplementedLogServer
+
+	walog *wal.WAL
+	serverOptions
+}
+
+// ServerOption configures a Server created with NewServer.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	maxReadEntries int
+}
+
+// WithMaxReadEntries sets the maximum number of entries returned by a single read. Defaults to 1000.
+func WithMaxReadEntries(entries int) ServerOption {
+	return func(o *serverOptions) {
+		o.maxReadEntries = entries
+	}
+}
+
+// NewServer returns a Server for walog.
+func NewServer(walog *wal.WAL, opts ...ServerOption) *Server {
+	o := serverOptions{maxReadEntries: defaultMaxReadEntries}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Server{walog: walog, serverOptions: o}
+}
+
+// Append implements the Log service.
+func (s *Server) Append(ctx context.Context, req *AppendRequest) (*AppendResponse, error) {
+	lsn, err := s.append(req)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &AppendResponse{LogSequenceNumber: lsn}, nil
+}
+
+func (s *Server) append(req *AppendRequest) (uint64, error) {
+	opts := []wal.EntryOption{
+		wal.WithMetadata(req.GetMetadata()),
+		wal.WithLabels(req.GetLabels()),
+		wal.WithStream(req.GetStream()),
+		wal.WithKey(req.GetKey()),
+	}
+	if ts := req.GetTimestampUnixNano(); ts != 0 {
+		opts = append(opts, wal.WithTimestamp(time.Unix(0, ts)))
+	}
+
+	lsn, err := s.walog.AppendEntry(req.GetData(), opts...)
+	if err != nil {
+		return 0, err
+	}
+	if req.GetSync() {
+		if err := s.walog.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	return lsn, nil
+}
+
+// Read implements the Log service.
+func (s *Server) Read(ctx context.Context, req *ReadRequest) (*ReadResponse, error) {
+	entries, err := s.read(req.GetFromLogSequenceNumber(), req.GetToLogSequenceNumber(), int(req.GetLimit()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &ReadResponse{Entries: make([]*Entry, 0, len(entries))}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, newEntry(entry))
+	}
+	return resp, nil
+}
+
+// read returns the entries from the sequence number from to the sequence number to, if not 0,
+// up to limit entries, or the maximum set with WithMaxReadEntries if limit is 0 or greater.
+func (s *Server) read(from, to uint64, limit int) ([]*wal.WAL_Entry, error) {
+	if limit <= 0 || limit > s.maxReadEntries {
+		limit = s.maxReadEntries
+	}
+	return s.walog.ReadRange(from, to, limit)
+}
+
+// Tail implements the Log service.
+func (s *Server) Tail(req *TailRequest, stream Log_TailServer) error {
+	tail, err := s.walog.Tail(req.GetFromLogSequenceNumber())
+	if err != nil {
+		return statusError(err)
+	}
+	defer tail.Stop()
+
+	err = follow(stream.Context(), tail, func(entry *wal.WAL_Entry) error {
+		return stream.Send(newEntry(entry))
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return statusError(err)
+}
+
+// follow calls fn with the entries read by tail, then with new entries as they are flushed,
+// until ctx is done or fn returns an error.
+func follow(ctx context.Context, tail *wal.Tail, fn func(*wal.WAL_Entry) error) error {
+	for {
+		if err := tail.Read(fn); err != nil {
+			return err
+		}
+		if err := tail.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Checkpoint implements the Log service.
+func (s *Server) Checkpoint(ctx context.Context, req *CheckpointRequest) (*CheckpointResponse, error) {
+	lsn, err := s.walog.AppendEntry(req.GetData(), wal.WithCheckpoint())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &CheckpointResponse{LogSequenceNumber: lsn}, nil
+}
+
+// Stats implements the Log service.
+func (s *Server) Stats(ctx context.Context, req *StatsRequest) (*StatsResponse, error) {
+	stats := s.walog.Stats()
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &StatsResponse{
+		LastLogSequenceNumber: stats.LastSequenceNumber,
+		EntriesWritten:        stats.EntriesWritten,
+		BytesWritten:          stats.BytesWritten,
+		SegmentCount:          int64(stats.SegmentCount),
+		Json:                  string(data),
+	}, nil
+}
+
+// statusError returns the gRPC status error for an error of the WAL.
+func statusError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, wal.ErrEntriesDeleted):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, wal.ErrClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, wal.ErrFenced), errors.Is(err, wal.ErrSequenceNumberTooLow):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// newEntry converts an entry of the WAL to an Entry of the service.
+func newEntry(entry *wal.WAL_Entry) *Entry {
+	return &Entry{
+		LogSequenceNumber: entry.GetLogSequenceNumber(),
+		Data:              entry.GetData(),
+		IsCheckpoint:      entry.GetIsCheckpoint(),
+		Metadata:          entry.GetMetadata(),
+		Labels:            entry.GetLabels(),
+		Stream:            entry.GetStream(),
+		Key:               entry.GetKey(),
+		TimestampUnixNano: entry.GetTimestamp(),
+		Tombstone:         entry.GetTombstone(),
+		Schema:            entry.GetSchema(),
+		SchemaVersion:     entry.GetSchemaVersion(),
+	}
+}
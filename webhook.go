@@ -0,0 +1,168 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Events notified to the webhooks set with WithWebhook.
+const (
+	// WebhookEventCheckpoint is notified when a checkpoint has been made durable.
+	WebhookEventCheckpoint = "checkpoint"
+	// WebhookEventRotate is notified when the log has been rotated to a new segment.
+	WebhookEventRotate = "rotate"
+	// WebhookEventCorruption is notified when corrupted data is detected while reading or repairing the log.
+	WebhookEventCorruption = "corruption"
+)
+
+// WebhookSignatureHeader is the header carrying the signature of webhook payloads: "sha256=" followed
+// by the hex encoded HMAC-SHA256 of the request body with the webhook secret. See VerifyWebhookSignature.
+const WebhookSignatureHeader = "X-GoWAL-Signature"
+
+const (
+	webhookQueueSize = 64
+	webhookTimeout   = 10 * time.Second
+)
+
+// WebhookPayload is the JSON body POSTed to the webhooks set with WithWebhook.
+type WebhookPayload struct {
+	Event     string    `json:"event"`
+	Directory string    `json:"directory"`
+	Time      time.Time `json:"time"`
+	// LogSequenceNumber is the sequence number of the checkpoint, for WebhookEventCheckpoint.
+	LogSequenceNumber uint64 `json:"log_sequence_number,omitempty"`
+	// Segment is the index of the new segment, for WebhookEventRotate.
+	Segment int `json:"segment,omitempty"`
+	// Corruption describes the corrupted data, for WebhookEventCorruption.
+	Corruption *WebhookCorruption `json:"corruption,omitempty"`
+}
+
+// WebhookCorruption is the CorruptionEvent of a WebhookEventCorruption notification.
+type WebhookCorruption struct {
+	Kind      CorruptionKind `json:"kind"`
+	Operation string         `json:"operation"`
+	Path      string         `json:"path"`
+	Offset    int64          `json:"offset"`
+	Error     string         `json:"error"`
+}
+
+// VerifyWebhookSignature reports whether signature, the value of the WebhookSignatureHeader header,
+// is the signature of body with secret. Receivers should verify it before trusting a payload.
+func VerifyWebhookSignature(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signWebhook(secret, body)), []byte(signature))
+}
+
+func signWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookNotifier POSTs the payloads queued by the WAL to the webhook URLs from a dedicated goroutine,
+// so that slow endpoints don't hold the WAL's lock.
+type webhookNotifier struct {
+	urls   []string
+	secret []byte
+	client *http.Client
+
+	lock   sync.Mutex // guards closed and sends to queue
+	closed bool
+	queue  chan WebhookPayload
+	done   chan struct{}
+}
+
+func newWebhookNotifier(secret []byte, urls []string) *webhookNotifier {
+	return &webhookNotifier{
+		urls:   urls,
+		secret: secret,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan WebhookPayload, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// notifyWebhooks queues a notification of the event. Notifications are dropped, and logged as
+// EventWebhookFailed, when the queue is full or the WAL is closed.
+func (wal *WAL) notifyWebhooks(payload WebhookPayload) {
+	n := wal.webhooks
+	if n == nil {
+		return
+	}
+	payload.Directory = wal.directory
+	payload.Time = wal.clock.Now()
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	var err error
+	if n.closed {
+		err = ErrClosed
+	} else {
+		select {
+		case n.queue <- payload:
+			return
+		default:
+			err = errors.New("webhook queue is full")
+		}
+	}
+	wal.logEvent(slog.LevelWarn, EventWebhookFailed, slog.String("event", payload.Event), slog.String("error", err.Error()))
+}
+
+// deliverWebhooks POSTs the queued notifications until the notifier is closed and its queue drained.
+func (wal *WAL) deliverWebhooks(n *webhookNotifier) {
+	defer close(n.done)
+	for payload := range n.queue {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			wal.logEvent(slog.LevelWarn, EventWebhookFailed, slog.String("event", payload.Event), slog.String("error", err.Error()))
+			continue
+		}
+		for _, url := range n.urls {
+			if err := n.post(url, body); err != nil {
+				wal.logEvent(slog.LevelWarn, EventWebhookFailed,
+					slog.String("event", payload.Event),
+					slog.String("url", url),
+					slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func (n *webhookNotifier) post(url string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, signWebhook(n.secret, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// close stops accepting notifications and waits for the queued ones to be delivered.
+func (n *webhookNotifier) close() {
+	n.lock.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.lock.Unlock()
+	<-n.done
+}
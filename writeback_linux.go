@@ -0,0 +1,14 @@
+//go:build linux && !arm
+
+package wal
+
+import "syscall"
+
+// syncFileRangeWrite is SYNC_FILE_RANGE_WRITE: start the writeback of the dirty pages of the range
+// that aren't already being written back, without waiting for it.
+const syncFileRangeWrite = 0x2
+
+// writebackFd starts the writeback of the given range of the file with sync_file_range.
+func writebackFd(fd uintptr, offset, length int64) error {
+	return syscall.SyncFileRange(int(fd), offset, length, syncFileRangeWrite)
+}
@@ -0,0 +1,10 @@
+//go:build !linux || arm
+
+package wal
+
+import "errors"
+
+// writebackFd is not supported on this platform.
+func writebackFd(fd uintptr, offset, length int64) error {
+	return errors.ErrUnsupported
+}